@@ -0,0 +1,50 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// An assignment of a value to an lvalue.
+type Assignment struct {
+	numbered
+	Operator token.Token
+	Lhs      Expression
+	Rhs      Expression
+	Type     types.Type // Set by semantic analysis.
+}
+
+func (*Assignment) expressionNode() {}
+
+func (a *Assignment) Pos() token.Position {
+	return a.Lhs.Pos()
+}
+
+func (a *Assignment) String() string {
+	return fmt.Sprintf("(%v %s %v)", a.Lhs, a.Operator.Value, a.Rhs)
+}
+
+// A compound assignment, such as "a += b", which assigns to an lvalue the
+// result of an operator applied to its value and an operand. The lvalue is
+// evaluated once.
+type CompoundAssignment struct {
+	numbered
+	Operator token.Token
+	Lhs      Expression
+	Rhs      Expression
+	Type     types.Type // Set by semantic analysis.
+	// The type in which the operator is computed, to which the right operand
+	// is converted. Set by semantic analysis.
+	OperandType types.Type
+}
+
+func (*CompoundAssignment) expressionNode() {}
+
+func (a *CompoundAssignment) Pos() token.Position {
+	return a.Lhs.Pos()
+}
+
+func (a *CompoundAssignment) String() string {
+	return fmt.Sprintf("(%v %s %v)", a.Lhs, a.Operator.Value, a.Rhs)
+}
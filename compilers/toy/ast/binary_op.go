@@ -0,0 +1,26 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A binary operator applied to two operands.
+type BinaryOp struct {
+	numbered
+	Operator token.Token
+	Lhs      Expression
+	Rhs      Expression
+	Type     types.Type // Set by semantic analysis.
+}
+
+func (*BinaryOp) expressionNode() {}
+
+func (b *BinaryOp) Pos() token.Position {
+	return b.Lhs.Pos()
+}
+
+func (b *BinaryOp) String() string {
+	return fmt.Sprintf("(%v %s %v)", b.Lhs, b.Operator.Value, b.Rhs)
+}
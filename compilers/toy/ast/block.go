@@ -0,0 +1,30 @@
+package ast
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+)
+
+// A compound statement, which introduces a new scope.
+type Block struct {
+	numbered
+	Open       token.Position // The position of the opening brace.
+	Statements []Statement
+}
+
+func (*Block) statementNode() {}
+
+func (b *Block) Pos() token.Position {
+	return b.Open
+}
+
+func (b *Block) String() string {
+	if len(b.Statements) == 0 {
+		return "{ }"
+	}
+	statements := make([]string, len(b.Statements))
+	for i, s := range b.Statements {
+		statements[i] = s.String()
+	}
+	return "{ " + strings.Join(statements, " ") + " }"
+}
@@ -0,0 +1,30 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"strings"
+)
+
+// A call of a named function.
+type Call struct {
+	numbered
+	Function *Identifier
+	Args     []Expression
+	Type     types.Type // The result type, set by semantic analysis.
+}
+
+func (*Call) expressionNode() {}
+
+func (c *Call) Pos() token.Position {
+	return c.Function.Pos()
+}
+
+func (c *Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = a.String()
+	}
+	return fmt.Sprintf("%v(%s)", c.Function, strings.Join(args, ", "))
+}
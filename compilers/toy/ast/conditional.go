@@ -0,0 +1,27 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A conditional expression, "Cond ? Then : Else", which evaluates to Then if
+// Cond is non-zero, else to Else. Only one of Then and Else is evaluated.
+type ConditionalExpression struct {
+	numbered
+	Cond Expression
+	Then Expression
+	Else Expression
+	Type types.Type // Set by semantic analysis.
+}
+
+func (*ConditionalExpression) expressionNode() {}
+
+func (c *ConditionalExpression) Pos() token.Position {
+	return c.Cond.Pos()
+}
+
+func (c *ConditionalExpression) String() string {
+	return fmt.Sprintf("(%v ? %v : %v)", c.Cond, c.Then, c.Else)
+}
@@ -0,0 +1,35 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A conversion of a value to another type. Implicit conversions are inserted
+// by semantic analysis, and are not part of the source text. A cast is an
+// explicit conversion to a type name, whose type is set by semantic analysis.
+type Conversion struct {
+	numbered
+	Lparen   token.Token
+	TypeName *TypeName
+	Operand  Expression
+	Type     types.Type
+	Implicit bool
+}
+
+func (*Conversion) expressionNode() {}
+
+func (c *Conversion) Pos() token.Position {
+	if c.TypeName != nil {
+		return c.Lparen.Position()
+	}
+	return c.Operand.Pos()
+}
+
+func (c *Conversion) String() string {
+	if c.TypeName != nil {
+		return fmt.Sprintf("((%v)%v)", c.TypeName, c.Operand)
+	}
+	return fmt.Sprintf("((%v)%v)", c.Type, c.Operand)
+}
@@ -0,0 +1,124 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+)
+
+// A variable declaration, with an optional initializer.
+type VariableDeclaration struct {
+	numbered
+	Storage  token.Token // The storage class, "extern" or "static", if any.
+	Type     token.Token // The type keyword, or a typedef name.
+	Tag      token.Token // The struct name, if Type is "struct", or the rest of an integer type.
+	Pointers int         // The number of '*' before the name.
+	Name     token.Token
+	// The length of each dimension of an array, outermost first. Nil if the
+	// variable is not an array.
+	Lengths []Expression
+	Init    Expression // Nil if the variable is not initialized.
+	Symbol  *Symbol    // The declared symbol, set by semantic analysis.
+	// The value of the initializer of a global variable, converted to its
+	// type, set by semantic analysis: Constant if the type is floating-point,
+	// and otherwise IntConstant, which is the bits of an unsigned long.
+	Constant    float64
+	IntConstant int64
+}
+
+func (*VariableDeclaration) statementNode() {}
+
+func (d *VariableDeclaration) Pos() token.Position {
+	if d.Storage.Value != "" {
+		return d.Storage.Position()
+	}
+	return d.Type.Position()
+}
+
+// IsDefinition returns whether a declaration defines its variable, rather
+// than only declaring one which is defined elsewhere: whether it is not
+// extern, or has an initializer.
+func (d *VariableDeclaration) IsDefinition() bool {
+	return d.Storage.Type != token.ExternKeywordToken || d.Init != nil
+}
+
+func (d *VariableDeclaration) String() string {
+	decl := storage(d.Storage) + declarator(specifier(d.Type, d.Tag),
+		d.Pointers, d.Name, lengths(d.Lengths, Expression.String))
+	if d.Init == nil {
+		return decl + ";"
+	}
+	return fmt.Sprintf("%s = %v;", decl, d.Init)
+}
+
+// A type name, which names a type without declaring anything, as in
+// "sizeof(int *)": a type specifier followed by a declarator without a name.
+type TypeName struct {
+	numbered
+	Type     token.Token // The type keyword, or a typedef name.
+	Tag      token.Token // The struct name, if Type is "struct", or the rest of an integer type.
+	Pointers int         // The number of '*' after the specifier.
+	// The length of each dimension of an array, outermost first. Nil if the
+	// type is not an array.
+	Lengths []Expression
+}
+
+func (n *TypeName) Pos() token.Position {
+	return n.Type.Position()
+}
+
+func (n *TypeName) String() string {
+	return n.format(Expression.String)
+}
+
+// format formats a type name, using format for its array lengths.
+func (n *TypeName) format(format func(Expression) string) string {
+	return declarator(specifier(n.Type, n.Tag), n.Pointers, token.Token{},
+		lengths(n.Lengths, format))
+}
+
+// storage formats a storage class followed by a space, or nothing if it is
+// the zero Token.
+func storage(class token.Token) string {
+	if class.Value == "" {
+		return ""
+	}
+	return class.Value + " "
+}
+
+// specifier formats a type keyword, followed by the name of a struct if it
+// has one, as in "struct point", or by the rest of an integer type, as in
+// "unsigned long int".
+func specifier(typ, tag token.Token) string {
+	if tag.Value == "" {
+		return typ.Value
+	}
+	return typ.Value + " " + tag.Value
+}
+
+// declarator formats a type specifier, followed by a name declared with the
+// given number of '*' and followed by the given array lengths, as in "int *p"
+// or "int a[10]". The name may be the zero Token.
+func declarator(specifier string, pointers int, name token.Token,
+	lengths string) string {
+	stars := strings.Repeat("*", pointers)
+	if name.Value == "" && pointers == 0 && lengths == "" {
+		return specifier
+	}
+	return specifier + " " + stars + name.Value + lengths
+}
+
+// lengths formats the lengths of the dimensions of an array declarator, as in
+// "[2][3]", using format for each length. A nil length is omitted, as in
+// "[]".
+func lengths(lengths []Expression, format func(Expression) string) string {
+	var b strings.Builder
+	for _, l := range lengths {
+		b.WriteString("[")
+		if l != nil {
+			b.WriteString(format(l))
+		}
+		b.WriteString("]")
+	}
+	return b.String()
+}
@@ -0,0 +1,255 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The description of a node which is dumped: its kind, which is the name of
+// its type, such as "BinaryOp", its position, its type if it is an
+// expression or a declaration which has been resolved, its other
+// attributes, such as its operator or name, and its children, in the order
+// of Walk.
+type dumpedNode struct {
+	kind     string
+	pos      token.Position
+	typ      string
+	attrs    []dumpedAttr
+	children []*dumpedNode
+}
+
+type dumpedAttr struct {
+	name, value string
+}
+
+// dump returns the description of a tree.
+func dump(node Node) *dumpedNode {
+	d := &dumpedNode{
+		kind: strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."),
+		pos:  node.Pos(),
+	}
+	attr := func(name, value string) {
+		d.attrs = append(d.attrs, dumpedAttr{name, value})
+	}
+	name := func(t token.Token) {
+		if t.Value != "" {
+			attr("name", t.Value)
+		}
+	}
+	class := func(t token.Token) {
+		if t.Value != "" {
+			attr("storage", t.Value)
+		}
+	}
+	declared := func(s *Symbol) {
+		if s != nil && s.Type != nil {
+			d.typ = s.Type.String()
+		}
+	}
+	switch n := node.(type) {
+	case *EnumDeclaration:
+		name(n.Name)
+	case *Enumerator:
+		name(n.Name)
+		if n.Symbol != nil {
+			attr("value", strconv.FormatInt(n.Symbol.Value, 10))
+		}
+	case *TypedefDeclaration:
+		name(n.Name)
+		declared(n.Symbol)
+	case *StructDeclaration:
+		name(n.Name)
+		declared(n.Symbol)
+	case *Field:
+		name(n.Name)
+	case *VariableDeclaration:
+		name(n.Name)
+		declared(n.Symbol)
+		class(n.Storage)
+	case *Function:
+		name(n.Name)
+		declared(n.Symbol)
+		class(n.Storage)
+		if n.Prototype {
+			attr("prototype", "true")
+		}
+	case *Parameter:
+		name(n.Name)
+		declared(n.Symbol)
+	case *LabeledStatement:
+		attr("label", n.Label.Value)
+	case *GotoStatement:
+		attr("label", n.Label.Value)
+	case *CaseStatement:
+		if n.Value == nil {
+			attr("default", "true")
+		}
+	case *Identifier:
+		attr("name", n.Token.Value)
+	case *IntLiteral:
+		attr("value", n.Token.Value)
+	case *FloatLiteral:
+		attr("value", n.Token.Value)
+	case *StringLiteral:
+		attr("value", n.Value)
+	case *UnaryOp:
+		attr("op", n.Operator.Value)
+	case *BinaryOp:
+		attr("op", n.Operator.Value)
+	case *Assignment:
+		attr("op", n.Operator.Value)
+	case *CompoundAssignment:
+		attr("op", n.Operator.Value)
+	case *IncDecOp:
+		attr("op", n.Operator.Value)
+		if n.Postfix {
+			attr("postfix", "true")
+		}
+	case *Member:
+		attr("op", n.Operator.Value)
+		attr("name", n.Name.Value)
+	case *Conversion:
+		if n.Implicit {
+			attr("implicit", "true")
+		}
+	case *Sizeof:
+		if n.Of != nil {
+			attr("of", n.Of.String())
+		}
+	}
+	if e, ok := node.(Expression); ok {
+		if t := TypeOf(e); t != nil {
+			d.typ = t.String()
+		}
+	}
+	Inspect(node, func(child Node) bool {
+		if child == node {
+			return true
+		}
+		if child != nil {
+			d.children = append(d.children, dump(child))
+		}
+		return false
+	})
+	return d
+}
+
+// DumpTree writes a tree to w as an indented outline, for reading. Each node
+// is a line of its kind, position, type and attributes, such as:
+//
+//	BinaryOp <1:21> type=int op=+
+//	  IntLiteral <1:21> type=int value=1
+//	  Identifier <1:25> type=int name=a
+//
+// A value with spaces or quotes is quoted.
+func DumpTree(w io.Writer, node Node) error {
+	var b strings.Builder
+	var write func(d *dumpedNode, depth int)
+	write = func(d *dumpedNode, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(d.kind)
+		if d.pos.IsValid() {
+			fmt.Fprintf(&b, " <%v>", d.pos)
+		}
+		if d.typ != "" {
+			b.WriteString(" type=" + treeValue(d.typ))
+		}
+		for _, a := range d.attrs {
+			b.WriteString(" " + a.name + "=" + treeValue(a.value))
+		}
+		b.WriteString("\n")
+		for _, c := range d.children {
+			write(c, depth+1)
+		}
+	}
+	write(dump(node), 0)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// treeValue returns a value of an attribute of the outline of a tree.
+func treeValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\n\"\\") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// The JSON representation of a node. The line and column are omitted if
+// the position of the node is unknown.
+type jsonNode struct {
+	Kind       string            `json:"kind"`
+	File       string            `json:"file,omitempty"`
+	Line       int               `json:"line,omitempty"`
+	Column     int               `json:"column,omitempty"`
+	Type       string            `json:"type,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Children   []*jsonNode       `json:"children,omitempty"`
+}
+
+func newJSONNode(d *dumpedNode) *jsonNode {
+	j := &jsonNode{Kind: d.kind, File: d.pos.Filename, Type: d.typ}
+	if d.pos.IsValid() {
+		j.Line, j.Column = d.pos.Line, d.pos.Column
+	}
+	for _, a := range d.attrs {
+		if j.Attributes == nil {
+			j.Attributes = make(map[string]string)
+		}
+		j.Attributes[a.name] = a.value
+	}
+	for _, c := range d.children {
+		j.Children = append(j.Children, newJSONNode(c))
+	}
+	return j
+}
+
+// DumpJSON writes a tree to w as JSON, for other tools. Each node is an
+// object such as:
+//
+//	{"kind": "BinaryOp", "line": 1, "column": 21, "type": "int",
+//	 "attributes": {"op": "+"}, "children": [...]}
+//
+// The file is given only for a node of another file, as named by a line
+// directive.
+func DumpJSON(w io.Writer, node Node) error {
+	return json.NewEncoder(w).Encode(newJSONNode(dump(node)))
+}
+
+// DumpSExpr writes a tree to w as an S-expression, in which each node is a
+// list of its kind, its position, type and attributes as keywords followed
+// by quoted values, and its children, each on a line of its own, such as:
+//
+//	(BinaryOp :pos "1:21" :type "int" :op "+"
+//	  (IntLiteral :pos "1:21" :type "int" :value "1")
+//	  (Identifier :pos "1:25" :type "int" :name "a"))
+func DumpSExpr(w io.Writer, node Node) error {
+	var b strings.Builder
+	var write func(d *dumpedNode, depth int)
+	write = func(d *dumpedNode, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString("(" + d.kind)
+		if d.pos.IsValid() {
+			b.WriteString(" :pos " + strconv.Quote(d.pos.String()))
+		}
+		if d.typ != "" {
+			b.WriteString(" :type " + strconv.Quote(d.typ))
+		}
+		for _, a := range d.attrs {
+			b.WriteString(" :" + a.name + " " + strconv.Quote(a.value))
+		}
+		for _, c := range d.children {
+			b.WriteString("\n")
+			write(c, depth+1)
+		}
+		b.WriteString(")")
+	}
+	write(dump(node), 0)
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,90 @@
+package ast
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// dumped returns the statement "return 1 + a;", with the types which semantic
+// analysis gives it, followed by a string literal with a space.
+func dumped() Node {
+	return &Block{Open: token.Position{Line: 1, Column: 12}, Statements: []Statement{
+		&ReturnStatement{
+			Return: token.Position{Line: 1, Column: 14},
+			Value: &BinaryOp{
+				Operator: op(token.AdditionToken, "+"),
+				Lhs: &IntLiteral{Token: token.Token{Type: token.NumberToken, Value: "1",
+					Line: 1, Column: 21}, Value: 1, Type: types.Int},
+				Rhs: &Identifier{Token: token.Token{Type: token.IdentifierToken, Value: "a",
+					Line: 1, Column: 25}, Type: types.Int},
+				Type: types.Int,
+			},
+		},
+		&ExpressionStatement{Expression: &StringLiteral{Token: token.Token{
+			Type: token.StringLiteralToken, Line: 2, Column: 1}, Value: "a b"}},
+	}}
+}
+
+func TestDumpTree(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.NoError(DumpTree(&b, dumped()))
+	assert.Equal(`Block <1:12>
+  ReturnStatement <1:14>
+    BinaryOp <1:21> type=int op=+
+      IntLiteral <1:21> type=int value=1
+      Identifier <1:25> type=int name=a
+  ExpressionStatement <2:1>
+    StringLiteral <2:1> value="a b"
+`, b.String())
+}
+
+func TestDumpJSON(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.NoError(DumpJSON(&b, dumped()))
+	assert.JSONEq(`{"kind": "Block", "line": 1, "column": 12, "children": [
+		{"kind": "ReturnStatement", "line": 1, "column": 14, "children": [
+			{"kind": "BinaryOp", "line": 1, "column": 21, "type": "int",
+			 "attributes": {"op": "+"}, "children": [
+				{"kind": "IntLiteral", "line": 1, "column": 21, "type": "int",
+				 "attributes": {"value": "1"}},
+				{"kind": "Identifier", "line": 1, "column": 25, "type": "int",
+				 "attributes": {"name": "a"}}]}]},
+		{"kind": "ExpressionStatement", "line": 2, "column": 1, "children": [
+			{"kind": "StringLiteral", "line": 2, "column": 1,
+			 "attributes": {"value": "a b"}}]}]}`, b.String())
+}
+
+func TestDumpSExpr(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.NoError(DumpSExpr(&b, dumped()))
+	assert.Equal(`(Block :pos "1:12"
+  (ReturnStatement :pos "1:14"
+    (BinaryOp :pos "1:21" :type "int" :op "+"
+      (IntLiteral :pos "1:21" :type "int" :value "1")
+      (Identifier :pos "1:25" :type "int" :name "a")))
+  (ExpressionStatement :pos "2:1"
+    (StringLiteral :pos "2:1" :value "a b")))
+`, b.String())
+}
+
+func TestDumpDeclarations(t *testing.T) {
+	assert := assert.New(t)
+	// The declaration of a function has the type of its symbol.
+	f := function("main")
+	f.Symbol = &Symbol{Kind: FunctionSymbol, Name: "main", Type: &types.Function{Result: types.Int}}
+	var b bytes.Buffer
+	assert.NoError(DumpTree(&b, &Program{Functions: []*Function{f}}))
+	assert.Equal("Program\n  Function type=int() name=main\n", b.String())
+
+	// A storage class follows the name.
+	f.Storage = op(token.StaticKeywordToken, "static")
+	b.Reset()
+	assert.NoError(DumpTree(&b, &Program{Functions: []*Function{f}}))
+	assert.Equal("Program\n  Function type=int() name=main storage=static\n", b.String())
+}
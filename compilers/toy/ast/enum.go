@@ -0,0 +1,64 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+)
+
+// An enum declaration, which defines an enum type and its enumerators, each a
+// named int constant.
+type EnumDeclaration struct {
+	numbered
+	Enum        token.Position // The "enum" keyword.
+	Name        token.Token    // The zero Token if the enum is unnamed.
+	Enumerators []*Enumerator
+	Symbol      *Symbol // The declared symbol, set by semantic analysis.
+}
+
+func (d *EnumDeclaration) Pos() token.Position {
+	return d.Enum
+}
+
+func (d *EnumDeclaration) String() string {
+	enumerators := make([]string, len(d.Enumerators))
+	for i, e := range d.Enumerators {
+		enumerators[i] = e.String()
+	}
+	return fmt.Sprintf("%s { %s };", d.header(), strings.Join(enumerators, ", "))
+}
+
+// header formats the "enum" keyword, followed by the name of the enum if it
+// has one.
+func (d *EnumDeclaration) header() string {
+	if d.Name.Value == "" {
+		return "enum"
+	}
+	return "enum " + d.Name.Value
+}
+
+// An enumerator of an enum declaration. Its value is one more than that of
+// the enumerator before it, or zero for the first, unless it is given.
+type Enumerator struct {
+	numbered
+	Name   token.Token
+	Value  Expression // Nil if the value is not given.
+	Symbol *Symbol    // The declared symbol, set by semantic analysis.
+}
+
+func (e *Enumerator) Pos() token.Position {
+	return e.Name.Position()
+}
+
+func (e *Enumerator) String() string {
+	return e.format(Expression.String)
+}
+
+// format formats an enumerator, formatting its value with the given
+// function.
+func (e *Enumerator) format(format func(Expression) string) string {
+	if e.Value == nil {
+		return e.Name.Value
+	}
+	return e.Name.Value + " = " + format(e.Value)
+}
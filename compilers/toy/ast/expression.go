@@ -0,0 +1,50 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// An expression node.
+type Expression interface {
+	Node
+	expressionNode()
+}
+
+// TypeOf returns the type of an expression, as determined by semantic
+// analysis, or nil if the expression has not been checked.
+func TypeOf(e Expression) types.Type {
+	switch n := e.(type) {
+	case *IntLiteral:
+		return n.Type
+	case *FloatLiteral:
+		return n.Type
+	case *StringLiteral:
+		return n.Type
+	case *Identifier:
+		return n.Type
+	case *UnaryOp:
+		return n.Type
+	case *BinaryOp:
+		return n.Type
+	case *Assignment:
+		return n.Type
+	case *CompoundAssignment:
+		return n.Type
+	case *IncDecOp:
+		return n.Type
+	case *ConditionalExpression:
+		return n.Type
+	case *Conversion:
+		return n.Type
+	case *Call:
+		return n.Type
+	case *Subscript:
+		return n.Type
+	case *Member:
+		return n.Type
+	case *Sizeof:
+		return n.Type
+	}
+	panic(fmt.Sprintf("unhandled expression type %T", e))
+}
@@ -0,0 +1,23 @@
+package ast
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTypeOf(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(TypeOf(num(1)))
+	assert.Equal(types.Int, TypeOf(&IntLiteral{Value: 1, Type: types.Int}))
+	assert.Equal(types.Double,
+		TypeOf(&FloatLiteral{Value: 1, Type: types.Double}))
+	assert.Equal(types.Float, TypeOf(&BinaryOp{Type: types.Float}))
+	assert.Equal(types.Int, TypeOf(&UnaryOp{Type: types.Int}))
+	assert.Equal(types.Int, TypeOf(&Identifier{Type: types.Int}))
+	assert.Equal(types.Int, TypeOf(&Assignment{Type: types.Int}))
+	assert.Equal(types.Float, TypeOf(&ConditionalExpression{Type: types.Float}))
+	assert.Equal(types.Int, TypeOf(&CompoundAssignment{Type: types.Int}))
+	assert.Equal(types.Double, TypeOf(&IncDecOp{Type: types.Double}))
+	assert.Equal(types.Double, TypeOf(&Call{Type: types.Double}))
+}
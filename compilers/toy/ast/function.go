@@ -0,0 +1,80 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+)
+
+// A function definition, or a prototype which only declares the function.
+type Function struct {
+	numbered
+	Storage   token.Token // The storage class, "extern" or "static", if any.
+	Type      token.Token // The return type keyword, or a typedef name.
+	Tag       token.Token // The struct name, if Type is "struct", or the rest of an integer type.
+	Pointers  int         // The number of '*' before the name.
+	Name      token.Token
+	Params    []*Parameter
+	Variadic  bool // Whether the parameters end with "...".
+	Body      []Statement
+	Prototype bool    // Whether the function is declared without a body.
+	Symbol    *Symbol // The declared symbol, set by semantic analysis.
+}
+
+func (f *Function) Pos() token.Position {
+	if f.Storage.Value != "" {
+		return f.Storage.Position()
+	}
+	return f.Type.Position()
+}
+
+// header returns the storage class, return type, name and parameters of a
+// function, using format for the array lengths of the parameters.
+func (f *Function) header(format func(Expression) string) string {
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = declarator(specifier(p.Type, p.Tag), p.Pointers, p.Name,
+			lengths(p.Lengths, format))
+	}
+	if f.Variadic {
+		params = append(params, "...")
+	}
+	return fmt.Sprintf("%s%s(%s)", storage(f.Storage),
+		declarator(specifier(f.Type, f.Tag), f.Pointers, f.Name, ""),
+		strings.Join(params, ", "))
+}
+
+func (f *Function) String() string {
+	if f.Prototype {
+		return f.header(Expression.String) + ";"
+	}
+	body := make([]string, len(f.Body))
+	for i, s := range f.Body {
+		body[i] = s.String()
+	}
+	return fmt.Sprintf("%s { %s }", f.header(Expression.String), strings.Join(body, " "))
+}
+
+// A parameter of a function. The name may be omitted in a prototype. A
+// parameter declared as an array is a pointer to its first element, so the
+// length of its outermost dimension may be omitted.
+type Parameter struct {
+	numbered
+	Type     token.Token // The type keyword, or a typedef name.
+	Tag      token.Token // The struct name, if Type is "struct", or the rest of an integer type.
+	Pointers int         // The number of '*' before the name.
+	Name     token.Token // The zero Token if the parameter is unnamed.
+	// The length of each dimension of an array, outermost first, each of
+	// which is nil if omitted. Nil if the parameter is not an array.
+	Lengths []Expression
+	Symbol  *Symbol // The declared symbol, set by semantic analysis.
+}
+
+func (p *Parameter) Pos() token.Position {
+	return p.Type.Position()
+}
+
+func (p *Parameter) String() string {
+	return declarator(specifier(p.Type, p.Tag), p.Pointers, p.Name,
+		lengths(p.Lengths, Expression.String))
+}
@@ -0,0 +1,80 @@
+package ast
+
+import "github.com/ChrisCummins/phd/compilers/toy/types"
+
+// The identity of a node of a syntax tree, which is unique among the nodes
+// numbered by the same Numbering, and does not change as the tree is
+// analysed or rewritten. The zero NodeID is that of a node which has not been
+// numbered.
+type NodeID uint32
+
+// numbered is embedded in each type of node to hold its ID.
+type numbered struct {
+	id NodeID
+}
+
+// ID returns the ID of a node, or zero if it has not been numbered.
+func (n *numbered) ID() NodeID {
+	return n.id
+}
+
+// A Numbering assigns IDs to nodes, counting up from one. The zero value is
+// ready to use.
+type Numbering struct {
+	last NodeID // The last ID assigned.
+}
+
+// Number assigns the next IDs, in the order of Walk, to the nodes of a tree
+// which have not been numbered. The IDs of nodes which have been numbered are
+// kept, so nodes which a pass creates, such as the conversions which semantic
+// analysis inserts, may be numbered after it without changing the IDs of the
+// rest.
+func (n *Numbering) Number(node Node) {
+	Inspect(node, func(node Node) bool {
+		if node == nil {
+			return false
+		}
+		if m := node.(interface{ numbering() *numbered }).numbering(); m.id == 0 {
+			n.last++
+			m.id = n.last
+		}
+		return true
+	})
+}
+
+// Count returns the number of IDs assigned, which is the greatest of them.
+func (n *Numbering) Count() int {
+	return int(n.last)
+}
+
+func (n *numbered) numbering() *numbered {
+	return n
+}
+
+// Number assigns IDs to the nodes of a program which have not been numbered,
+// continuing from the last ID assigned to its nodes. The parser numbers the
+// programs which it returns.
+func (p *Program) Number() {
+	p.ids.Number(p)
+}
+
+// A TypeTable records types for nodes, such as the types of expressions, by
+// their IDs. Tables let an analysis annotate a tree without changing its
+// nodes, so analyses which record their results in tables of their own may
+// share a tree. Semantic analysis still annotates the nodes, and copies its
+// results into tables only if it is asked to.
+type TypeTable map[NodeID]types.Type
+
+// Of returns the type recorded for a node, or nil if there is none.
+func (t TypeTable) Of(n Node) types.Type {
+	return t[n.ID()]
+}
+
+// A SymbolTable records symbols for nodes, such as the symbols which
+// identifiers resolve to, by their IDs.
+type SymbolTable map[NodeID]*Symbol
+
+// Of returns the symbol recorded for a node, or nil if there is none.
+func (t SymbolTable) Of(n Node) *Symbol {
+	return t[n.ID()]
+}
@@ -0,0 +1,60 @@
+package ast
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// ids returns the IDs of the nodes under a node in the order of Inspect.
+func ids(node Node) []NodeID {
+	var result []NodeID
+	Inspect(node, func(n Node) bool {
+		if n != nil {
+			result = append(result, n.ID())
+		}
+		return n != nil
+	})
+	return result
+}
+
+func TestNumber(t *testing.T) {
+	assert := assert.New(t)
+	ret := &ReturnStatement{Value: add(num(1), num(2))}
+	p := &Program{Functions: []*Function{function("f", ret)}}
+	assert.Equal([]NodeID{0, 0, 0, 0, 0, 0}, ids(p))
+	p.Number()
+	assert.Equal([]NodeID{1, 2, 3, 4, 5, 6}, ids(p))
+	assert.Equal(NodeID(4), ret.Value.ID())
+
+	// Numbering again keeps the IDs, and numbers new nodes after the rest.
+	ret.Value = &Conversion{Operand: ret.Value}
+	p.Number()
+	assert.Equal([]NodeID{1, 2, 3, 7, 4, 5, 6}, ids(p))
+}
+
+func TestNumberingCount(t *testing.T) {
+	assert := assert.New(t)
+	var n Numbering
+	assert.Equal(0, n.Count())
+	a, b := add(num(1), num(2)), neg(num(3))
+	n.Number(a)
+	n.Number(b)
+	assert.Equal([]NodeID{4, 5}, ids(b))
+	assert.Equal(5, n.Count())
+}
+
+func TestTables(t *testing.T) {
+	assert := assert.New(t)
+	var n Numbering
+	a, b := num(1), num(2)
+	n.Number(a)
+	n.Number(b)
+	typeTable := TypeTable{a.ID(): types.Int}
+	assert.Equal(types.Int, typeTable.Of(a))
+	assert.Nil(typeTable.Of(b))
+	symbol := &Symbol{Name: "x"}
+	symbolTable := SymbolTable{b.ID(): symbol}
+	assert.Equal(symbol, symbolTable.Of(b))
+	assert.Nil(symbolTable.Of(a))
+}
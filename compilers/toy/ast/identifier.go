@@ -0,0 +1,24 @@
+package ast
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A reference to a named entity.
+type Identifier struct {
+	numbered
+	Token  token.Token
+	Symbol *Symbol    // The resolved symbol, set by semantic analysis.
+	Type   types.Type // Set by semantic analysis.
+}
+
+func (*Identifier) expressionNode() {}
+
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Position()
+}
+
+func (i *Identifier) String() string {
+	return i.Token.Value
+}
@@ -0,0 +1,28 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// An if statement, with an optional else branch.
+type IfStatement struct {
+	numbered
+	If   token.Position
+	Cond Expression
+	Then Statement
+	Else Statement // Nil if there is no else branch.
+}
+
+func (*IfStatement) statementNode() {}
+
+func (s *IfStatement) Pos() token.Position {
+	return s.If
+}
+
+func (s *IfStatement) String() string {
+	if s.Else == nil {
+		return fmt.Sprintf("if (%v) %v", s.Cond, s.Then)
+	}
+	return fmt.Sprintf("if (%v) %v else %v", s.Cond, s.Then, s.Else)
+}
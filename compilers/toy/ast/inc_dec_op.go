@@ -0,0 +1,34 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// An increment or decrement of an lvalue: ++x, --x, x++, or x--. A prefix
+// operator evaluates to the new value of the operand, and a postfix operator
+// to its old value.
+type IncDecOp struct {
+	numbered
+	Operator token.Token
+	Operand  Expression
+	Postfix  bool
+	Type     types.Type // Set by semantic analysis.
+}
+
+func (*IncDecOp) expressionNode() {}
+
+func (i *IncDecOp) Pos() token.Position {
+	if i.Postfix {
+		return i.Operand.Pos()
+	}
+	return i.Operator.Position()
+}
+
+func (i *IncDecOp) String() string {
+	if i.Postfix {
+		return fmt.Sprintf("(%v%s)", i.Operand, i.Operator.Value)
+	}
+	return fmt.Sprintf("(%s%v)", i.Operator.Value, i.Operand)
+}
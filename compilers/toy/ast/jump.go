@@ -0,0 +1,79 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// A break statement, which exits the innermost enclosing loop.
+type BreakStatement struct {
+	numbered
+	Break  token.Position
+	Target Statement // The loop exited, set by semantic analysis.
+}
+
+func (*BreakStatement) statementNode() {}
+
+func (s *BreakStatement) Pos() token.Position {
+	return s.Break
+}
+
+func (s *BreakStatement) String() string {
+	return "break;"
+}
+
+// A continue statement, which starts the next iteration of the innermost
+// enclosing loop.
+type ContinueStatement struct {
+	numbered
+	Continue token.Position
+	Target   Statement // The loop continued, set by semantic analysis.
+}
+
+func (*ContinueStatement) statementNode() {}
+
+func (s *ContinueStatement) Pos() token.Position {
+	return s.Continue
+}
+
+func (s *ContinueStatement) String() string {
+	return "continue;"
+}
+
+// A goto statement, which jumps to the statement with the given label in the
+// same function.
+type GotoStatement struct {
+	numbered
+	Goto   token.Position
+	Label  token.Token
+	Target *LabeledStatement // The statement jumped to, set by semantic analysis.
+}
+
+func (*GotoStatement) statementNode() {}
+
+func (s *GotoStatement) Pos() token.Position {
+	return s.Goto
+}
+
+func (s *GotoStatement) String() string {
+	return "goto " + s.Label.Value + ";"
+}
+
+// A statement labelled with a name, which goto statements may jump to. The
+// labels of a function are in their own namespace, so may have the same
+// names as variables.
+type LabeledStatement struct {
+	numbered
+	Label token.Token
+	Body  Statement
+}
+
+func (*LabeledStatement) statementNode() {}
+
+func (s *LabeledStatement) Pos() token.Position {
+	return s.Label.Position()
+}
+
+func (s *LabeledStatement) String() string {
+	return fmt.Sprintf("%s: %v", s.Label.Value, s.Body)
+}
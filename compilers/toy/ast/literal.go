@@ -0,0 +1,112 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"strconv"
+	"strings"
+)
+
+// An integer constant, which may have a "u" suffix for unsigned and an "l"
+// suffix for long, or a character constant, such as 'a', whose value is that
+// of the character and whose Token is a CharLiteralToken. The value of an
+// unsigned long is its bits.
+type IntLiteral struct {
+	numbered
+	Token token.Token
+	Value int64
+	Type  types.Type // Set by semantic analysis.
+}
+
+func (*IntLiteral) expressionNode() {}
+
+func (l *IntLiteral) Pos() token.Position {
+	return l.Token.Position()
+}
+
+func (l *IntLiteral) String() string {
+	s := strconv.FormatInt(l.Value, 10)
+	if l.HasUnsignedSuffix() || types.IsUnsigned(l.Type) {
+		s = strconv.FormatUint(uint64(l.Value), 10) + "u"
+	}
+	if l.HasLongSuffix() || l.Type == types.Long || l.Type == types.UnsignedLong {
+		s += "l"
+	}
+	return s
+}
+
+// HasUnsignedSuffix returns whether the literal is written with a "u"
+// suffix, which makes it unsigned.
+func (l *IntLiteral) HasUnsignedSuffix() bool {
+	return l.Token.Type == token.NumberToken && strings.ContainsAny(l.Token.Value, "uU")
+}
+
+// HasLongSuffix returns whether the literal is written with an "l" suffix,
+// which makes it long.
+func (l *IntLiteral) HasLongSuffix() bool {
+	return l.Token.Type == token.NumberToken && strings.ContainsAny(l.Token.Value, "lL")
+}
+
+// A floating-point constant. Constants with an "f" suffix have type float,
+// others have type double.
+type FloatLiteral struct {
+	numbered
+	Token token.Token
+	Value float64
+	Type  types.Type // Set by semantic analysis.
+}
+
+func (*FloatLiteral) expressionNode() {}
+
+func (l *FloatLiteral) Pos() token.Position {
+	return l.Token.Position()
+}
+
+func (l *FloatLiteral) String() string {
+	return strconv.FormatFloat(l.Value, 'g', -1, 64)
+}
+
+// A string literal, an array of the characters of Value followed by a NUL.
+type StringLiteral struct {
+	numbered
+	Token token.Token
+	Value string     // The decoded characters.
+	Type  types.Type // Set by semantic analysis.
+}
+
+func (*StringLiteral) expressionNode() {}
+
+func (l *StringLiteral) Pos() token.Position {
+	return l.Token.Position()
+}
+
+func (l *StringLiteral) String() string {
+	return Quote(l.Value, '"')
+}
+
+// Quote returns the C spelling of a string or character constant delimited by
+// quote, escaping the delimiter, backslashes, and non-printable characters.
+func Quote(s string, quote byte) string {
+	var b strings.Builder
+	b.WriteByte(quote)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == quote || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < ' ' || c > '~':
+			// An octal escape is at most three digits long, so is not
+			// continued by a following digit, unlike a hexadecimal escape.
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(quote)
+	return b.String()
+}
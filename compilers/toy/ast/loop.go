@@ -0,0 +1,73 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// A while loop, which tests its condition before each iteration.
+type WhileStatement struct {
+	numbered
+	While token.Position
+	Cond  Expression
+	Body  Statement
+}
+
+func (*WhileStatement) statementNode() {}
+
+func (s *WhileStatement) Pos() token.Position {
+	return s.While
+}
+
+func (s *WhileStatement) String() string {
+	return fmt.Sprintf("while (%v) %v", s.Cond, s.Body)
+}
+
+// A do-while loop, which tests its condition after each iteration.
+type DoWhileStatement struct {
+	numbered
+	Do   token.Position
+	Body Statement
+	Cond Expression
+}
+
+func (*DoWhileStatement) statementNode() {}
+
+func (s *DoWhileStatement) Pos() token.Position {
+	return s.Do
+}
+
+func (s *DoWhileStatement) String() string {
+	return fmt.Sprintf("do %v while (%v);", s.Body, s.Cond)
+}
+
+// A for loop. Any of its clauses may be omitted, and a missing condition is
+// always true.
+type ForStatement struct {
+	numbered
+	For  token.Position
+	Init Statement  // A declaration or expression statement, or nil.
+	Cond Expression // Nil if omitted.
+	Post Expression // Nil if omitted.
+	Body Statement
+}
+
+func (*ForStatement) statementNode() {}
+
+func (s *ForStatement) Pos() token.Position {
+	return s.For
+}
+
+func (s *ForStatement) String() string {
+	init, cond, post := ";", "", ""
+	if s.Init != nil {
+		init = s.Init.String()
+	}
+	if s.Cond != nil {
+		cond = fmt.Sprintf(" %v", s.Cond)
+	}
+	if s.Post != nil {
+		post = fmt.Sprintf(" %v", s.Post)
+	}
+	return fmt.Sprintf("for (%s%s;%s) %v", init, cond, post, s.Body)
+}
@@ -0,0 +1,28 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A member access s.x, which designates a field of a struct, or p->x, which
+// designates a field of the struct that a pointer points to. It is
+// equivalent to (*p).x.
+type Member struct {
+	numbered
+	X        Expression
+	Operator token.Token // The "." or "->".
+	Name     token.Token // The name of the field.
+	Type     types.Type  // The type of the field, set by semantic analysis.
+}
+
+func (*Member) expressionNode() {}
+
+func (m *Member) Pos() token.Position {
+	return m.X.Pos()
+}
+
+func (m *Member) String() string {
+	return fmt.Sprintf("%v%s%s", m.X, m.Operator.Value, m.Name.Value)
+}
@@ -0,0 +1,16 @@
+// Package ast defines the abstract syntax tree of the toy language.
+package ast
+
+import "github.com/ChrisCummins/phd/compilers/toy/token"
+
+// A node in the abstract syntax tree.
+type Node interface {
+	// Pos returns the source position of the first token of the node.
+	Pos() token.Position
+	// ID returns the identity of the node, or zero if it has not been
+	// numbered.
+	ID() NodeID
+	// String returns a compact, single-line representation of the node for
+	// debugging.
+	String() string
+}
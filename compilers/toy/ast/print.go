@@ -0,0 +1,449 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"io"
+	"strings"
+)
+
+// The string used for each level of indentation in formatted source, unless
+// another is given.
+const defaultIndent = "    "
+
+// The precedence of prefix unary operators, which bind tighter than any
+// binary operator.
+const unaryPrecedence = 100
+
+// The precedence of postfix operators and primary expressions, which bind
+// tightest of all.
+const postfixPrecedence = 101
+
+// The precedence of the conditional operator, which binds looser than any
+// binary operator.
+const conditionalPrecedence = 0
+
+// The precedence of assignment, which binds loosest of all.
+const assignmentPrecedence = -1
+
+type printer struct {
+	w      io.Writer
+	indent string // The string of each level of indentation.
+	depth  int
+	err    error
+}
+
+// Print writes the canonical source text of a node to w.
+func Print(w io.Writer, node Node) error {
+	p := &printer{w: w, indent: defaultIndent}
+	p.node(node)
+	return p.err
+}
+
+// Format returns the canonical source text of a node.
+func Format(node Node) string {
+	return FormatIndent(node, defaultIndent)
+}
+
+// FormatIndent returns the canonical source text of a node, indented by the
+// given string at each level, such as a tab, rather than four spaces.
+func FormatIndent(node Node, indent string) string {
+	var b bytes.Buffer
+	p := &printer{w: &b, indent: indent}
+	p.node(node)
+	return b.String()
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+// margin returns the indentation of the current depth.
+func (p *printer) margin() string {
+	return strings.Repeat(p.indent, p.depth)
+}
+
+func (p *printer) line(format string, args ...interface{}) {
+	p.printf("%s%s\n", p.margin(),
+		fmt.Sprintf(format, args...))
+}
+
+func (p *printer) node(node Node) {
+	switch n := node.(type) {
+	case *Program:
+		// Enums, structs and functions are separated by blank lines, and
+		// typedefs and globals are each grouped together. Typedefs precede
+		// structs, whose fields may use them.
+		printed := false
+		separate := func() {
+			if printed {
+				p.printf("\n")
+			}
+			printed = true
+		}
+		for _, e := range n.Enums {
+			separate()
+			p.node(e)
+		}
+		for i, t := range n.Typedefs {
+			if i == 0 {
+				separate()
+			}
+			p.node(t)
+		}
+		for _, s := range n.Structs {
+			separate()
+			p.node(s)
+		}
+		for i, g := range n.Globals {
+			if i == 0 {
+				separate()
+			}
+			p.node(g)
+		}
+		for _, f := range n.Functions {
+			separate()
+			p.node(f)
+		}
+	case *EnumDeclaration:
+		p.line("%s {", n.header())
+		p.depth++
+		for _, e := range n.Enumerators {
+			p.line("%s,", e.format(formatExpression))
+		}
+		p.depth--
+		p.line("};")
+	case *TypedefDeclaration:
+		p.line("%s", n.format(formatExpression))
+	case *StructDeclaration:
+		p.line("struct %s {", n.Name.Value)
+		p.depth++
+		for _, f := range n.Fields {
+			p.line("%s;", declarator(specifier(f.Type, f.Tag), f.Pointers,
+				f.Name, lengths(f.Lengths, formatExpression)))
+		}
+		p.depth--
+		p.line("};")
+	case *Function:
+		if n.Prototype {
+			p.line("%s;", n.header(formatExpression))
+			return
+		}
+		p.line("%s {", n.header(formatExpression))
+		p.depth++
+		for _, s := range n.Body {
+			p.node(s)
+		}
+		p.depth--
+		p.line("}")
+	case Statement:
+		p.statement(n)
+	case Expression:
+		p.printf("%s", formatExpression(n))
+	default:
+		panic(fmt.Sprintf("unhandled node type %T", node))
+	}
+}
+
+func (p *printer) statement(s Statement) {
+	switch n := s.(type) {
+	case *ReturnStatement:
+		p.line("return %s;", formatExpression(n.Value))
+	case *ExpressionStatement:
+		p.line("%s;", formatExpression(n.Expression))
+	case *VariableDeclaration:
+		p.line("%s;", formatDeclaration(n))
+	case *Block:
+		p.line("{")
+		p.block(n)
+		p.line("}")
+	case *IfStatement:
+		p.ifStatement(n, p.margin())
+	case *WhileStatement:
+		p.headed(fmt.Sprintf("while (%s)", formatExpression(n.Cond)), n.Body)
+	case *DoWhileStatement:
+		cond := formatExpression(n.Cond)
+		if p.branch(p.margin()+"do", n.Body) {
+			p.line("} while (%s);", cond)
+		} else {
+			p.line("while (%s);", cond)
+		}
+	case *ForStatement:
+		p.headed(fmt.Sprintf("for (%s)", formatForClauses(n)), n.Body)
+	case *SwitchStatement:
+		p.headed(fmt.Sprintf("switch (%s)", formatExpression(n.Value)), n.Body)
+	case *CaseStatement:
+		// Labels are outdented to the level of the enclosing switch.
+		p.depth--
+		if n.Value == nil {
+			p.line("default:")
+		} else {
+			p.line("case %s:", formatExpression(n.Value))
+		}
+		p.depth++
+		p.statement(n.Body)
+	case *LabeledStatement:
+		// Labels are outdented by one level.
+		p.depth--
+		p.line("%s:", n.Label.Value)
+		p.depth++
+		p.statement(n.Body)
+	case *GotoStatement:
+		p.line("goto %s;", n.Label.Value)
+	case *BreakStatement:
+		p.line("break;")
+	case *ContinueStatement:
+		p.line("continue;")
+	default:
+		panic(fmt.Sprintf("unhandled statement type %T", s))
+	}
+}
+
+// block prints the statements of a block, indented, without its braces.
+func (p *printer) block(b *Block) {
+	p.depth++
+	for _, s := range b.Statements {
+		p.statement(s)
+	}
+	p.depth--
+}
+
+// ifStatement prints an if statement whose first line begins with prefix.
+// Braced branches share lines with the keywords, as in "} else {", and an
+// if statement in an else branch continues the chain as "else if".
+func (p *printer) ifStatement(s *IfStatement, prefix string) {
+	open := fmt.Sprintf("%sif (%s)", prefix, formatExpression(s.Cond))
+	then := s.Then
+	if s.Else != nil && endsWithoutElse(then) {
+		// Without braces, the else would be parsed as part of the nested if.
+		then = &Block{Statements: []Statement{then}}
+	}
+	closed := p.branch(open, then)
+	if s.Else == nil {
+		if closed {
+			p.line("}")
+		}
+		return
+	}
+	var elsePrefix string
+	if closed {
+		elsePrefix = p.margin() + "} else"
+	} else {
+		elsePrefix = p.margin() + "else"
+	}
+	if elseIf, ok := s.Else.(*IfStatement); ok {
+		p.ifStatement(elseIf, elsePrefix+" ")
+		return
+	}
+	if p.branch(elsePrefix, s.Else) {
+		p.line("}")
+	}
+}
+
+// endsWithoutElse returns whether a statement ends with an if statement, or a
+// chain of else ifs, with no final else branch.
+func endsWithoutElse(s Statement) bool {
+	switch n := s.(type) {
+	case *IfStatement:
+		return n.Else == nil || endsWithoutElse(n.Else)
+	case *WhileStatement:
+		return endsWithoutElse(n.Body)
+	case *ForStatement:
+		return endsWithoutElse(n.Body)
+	case *SwitchStatement:
+		return endsWithoutElse(n.Body)
+	case *CaseStatement:
+		return endsWithoutElse(n.Body)
+	}
+	return false
+}
+
+// headed prints a while, for or switch statement with the given header.
+func (p *printer) headed(header string, body Statement) {
+	if p.branch(p.margin()+header, body) {
+		p.line("}")
+	}
+}
+
+// formatForClauses formats the clauses between the parentheses of a for
+// loop, as in "int i = 0; i < n; i = i + 1", or ";;" if all are omitted.
+func formatForClauses(s *ForStatement) string {
+	var init, cond, post string
+	switch n := s.Init.(type) {
+	case *VariableDeclaration:
+		init = formatDeclaration(n)
+	case *ExpressionStatement:
+		init = formatExpression(n.Expression)
+	}
+	if s.Cond != nil {
+		cond = " " + formatExpression(s.Cond)
+	}
+	if s.Post != nil {
+		post = " " + formatExpression(s.Post)
+	}
+	return init + ";" + cond + ";" + post
+}
+
+// formatDeclaration formats a variable declaration, without its semicolon.
+func formatDeclaration(d *VariableDeclaration) string {
+	decl := storage(d.Storage) + declarator(specifier(d.Type, d.Tag),
+		d.Pointers, d.Name, lengths(d.Lengths, formatExpression))
+	if d.Init == nil {
+		return decl
+	}
+	return fmt.Sprintf("%s = %s", decl, formatExpression(d.Init))
+}
+
+// branch prints the body of an if statement after its header, and returns
+// whether the body is a block whose closing brace is still to be printed.
+func (p *printer) branch(header string, body Statement) bool {
+	if b, ok := body.(*Block); ok {
+		p.printf("%s {\n", header)
+		p.block(b)
+		return true
+	}
+	p.printf("%s\n", header)
+	p.depth++
+	p.statement(body)
+	p.depth--
+	return false
+}
+
+// precedence returns the binding power of an expression.
+func precedence(e Expression) int {
+	switch n := e.(type) {
+	case *BinaryOp:
+		return n.Operator.Type.Precedence()
+	case *Assignment, *CompoundAssignment:
+		return assignmentPrecedence
+	case *ConditionalExpression:
+		return conditionalPrecedence
+	case *Conversion:
+		if n.Implicit {
+			return precedence(n.Operand)
+		}
+		return unaryPrecedence
+	case *UnaryOp, *Sizeof:
+		return unaryPrecedence
+	case *IncDecOp:
+		if !n.Postfix {
+			return unaryPrecedence
+		}
+	}
+	return postfixPrecedence
+}
+
+// parenthesize formats an expression, wrapping it in parentheses if it binds
+// more loosely than minPrecedence.
+func parenthesize(e Expression, minPrecedence int) string {
+	if precedence(e) < minPrecedence {
+		return "(" + formatExpression(e) + ")"
+	}
+	return formatExpression(e)
+}
+
+func formatExpression(e Expression) string {
+	switch n := e.(type) {
+	case *IntLiteral:
+		// The value of a character constant token is the decoded character.
+		if n.Token.Type == token.CharLiteralToken {
+			return Quote(string([]byte{byte(n.Value)}), '\'')
+		}
+		// Preserve the original spelling of literals, if known.
+		if n.Token.Value != "" {
+			return n.Token.Value
+		}
+		return n.String()
+	case *FloatLiteral:
+		if n.Token.Value != "" {
+			return n.Token.Value
+		}
+		return n.String()
+	case *StringLiteral:
+		return n.String()
+	case *Identifier:
+		return n.Token.Value
+	case *UnaryOp:
+		return prefix(n.Operator.Value, n.Operand)
+	case *Sizeof:
+		if n.TypeName != nil {
+			return "sizeof(" + n.TypeName.format(formatExpression) + ")"
+		}
+		// Only a postfix or primary operand is written without parentheses,
+		// as in "sizeof a[0]" but "sizeof(*p)".
+		if precedence(n.Operand) < postfixPrecedence {
+			return "sizeof(" + formatExpression(n.Operand) + ")"
+		}
+		return "sizeof " + formatExpression(n.Operand)
+	case *IncDecOp:
+		if n.Postfix {
+			return parenthesize(n.Operand, postfixPrecedence) + n.Operator.Value
+		}
+		return prefix(n.Operator.Value, n.Operand)
+	case *BinaryOp:
+		// The operand on the side away from which an operator associates
+		// needs parentheses if it has equal precedence.
+		prec := n.Operator.Type.Precedence()
+		lhs, rhs := prec, prec+1
+		if n.Operator.Type.Associativity() == token.RightAssociative {
+			lhs, rhs = prec+1, prec
+		}
+		return fmt.Sprintf("%s %s %s", parenthesize(n.Lhs, lhs),
+			n.Operator.Value, parenthesize(n.Rhs, rhs))
+	case *Subscript:
+		return fmt.Sprintf("%s[%s]", parenthesize(n.Array, postfixPrecedence),
+			formatExpression(n.Index))
+	case *Member:
+		return parenthesize(n.X, postfixPrecedence) + n.Operator.Value +
+			n.Name.Value
+	case *Call:
+		args := make([]string, len(n.Args))
+		for i, a := range n.Args {
+			args[i] = formatExpression(a)
+		}
+		return fmt.Sprintf("%s(%s)", n.Function.Token.Value,
+			strings.Join(args, ", "))
+	case *Conversion:
+		if n.Implicit {
+			return formatExpression(n.Operand)
+		}
+		if n.TypeName != nil {
+			return "(" + n.TypeName.format(formatExpression) + ")" +
+				parenthesize(n.Operand, unaryPrecedence)
+		}
+		return fmt.Sprintf("(%v)%s", n.Type,
+			parenthesize(n.Operand, unaryPrecedence))
+	case *ConditionalExpression:
+		// The middle operand is delimited by the operator, so needs no
+		// parentheses, and the conditional operator is right-associative.
+		return fmt.Sprintf("%s ? %s : %s",
+			parenthesize(n.Cond, conditionalPrecedence+1),
+			formatExpression(n.Then), parenthesize(n.Else, conditionalPrecedence))
+	case *Assignment:
+		// Assignment is right-associative.
+		return fmt.Sprintf("%s %s %s",
+			parenthesize(n.Lhs, assignmentPrecedence+1), n.Operator.Value,
+			parenthesize(n.Rhs, assignmentPrecedence))
+	case *CompoundAssignment:
+		return fmt.Sprintf("%s %s %s",
+			parenthesize(n.Lhs, assignmentPrecedence+1), n.Operator.Value,
+			parenthesize(n.Rhs, assignmentPrecedence))
+	}
+	panic(fmt.Sprintf("unhandled expression type %T", e))
+}
+
+// prefix formats a prefix operator applied to an operand.
+func prefix(operator string, operand Expression) string {
+	s := parenthesize(operand, unaryPrecedence)
+	// Avoid gluing operators together, e.g. "-(-x)" rather than "--x", which
+	// would be read as a decrement, or "&(&x)" rather than "&&x".
+	if strings.HasSuffix(operator, "-") && strings.HasPrefix(s, "-") ||
+		strings.HasSuffix(operator, "+") && strings.HasPrefix(s, "+") ||
+		operator == "&" && strings.HasPrefix(s, "&") {
+		s = "(" + s + ")"
+	}
+	return operator + s
+}
@@ -0,0 +1,582 @@
+package ast
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func op(t token.TokenType, value string) token.Token {
+	return token.Token{Type: t, Value: value}
+}
+
+func add(lhs, rhs Expression) *BinaryOp {
+	return &BinaryOp{Operator: op(token.AdditionToken, "+"), Lhs: lhs, Rhs: rhs}
+}
+
+func sub(lhs, rhs Expression) *BinaryOp {
+	return &BinaryOp{Operator: op(token.NegationToken, "-"), Lhs: lhs, Rhs: rhs}
+}
+
+func mul(lhs, rhs Expression) *BinaryOp {
+	return &BinaryOp{Operator: op(token.MultiplicationToken, "*"), Lhs: lhs,
+		Rhs: rhs}
+}
+
+func neg(operand Expression) *UnaryOp {
+	return &UnaryOp{Operator: op(token.NegationToken, "-"), Operand: operand}
+}
+
+func num(value int64) *IntLiteral {
+	return &IntLiteral{Value: value}
+}
+
+func function(name string, body ...Statement) *Function {
+	return &Function{
+		Type: op(token.IntKeywordToken, "int"),
+		Name: op(token.IdentifierToken, name),
+		Body: body,
+	}
+}
+
+func TestFormatProgram(t *testing.T) {
+	assert := assert.New(t)
+	p := &Program{Functions: []*Function{
+		function("foo", &ReturnStatement{Value: num(1)}),
+		function("main", &ReturnStatement{Value: num(2)}),
+	}}
+	assert.Equal(`int foo() {
+    return 1;
+}
+
+int main() {
+    return 2;
+}
+`, Format(p))
+}
+
+func TestFormatIndent(t *testing.T) {
+	assert := assert.New(t)
+	p := function("main", &IfStatement{
+		Cond: num(1),
+		Then: &Block{Statements: []Statement{&ReturnStatement{Value: num(2)}}},
+		Else: &ReturnStatement{Value: num(3)},
+	})
+	assert.Equal("int main() {\n\tif (1) {\n\t\treturn 2;\n\t} else\n\t\treturn 3;\n}\n",
+		FormatIndent(p, "\t"))
+	assert.Equal(Format(p), FormatIndent(p, "    "))
+}
+
+func TestFormatFunctionParameters(t *testing.T) {
+	assert := assert.New(t)
+	f := function("f", &ReturnStatement{Value: num(1)})
+	f.Params = []*Parameter{
+		{Type: op(token.IntKeywordToken, "int"), Name: op(token.IdentifierToken, "a")},
+		{Type: op(token.DoubleKeywordToken, "double"), Name: op(token.IdentifierToken, "b")},
+	}
+	assert.Equal("int f(int a, double b) {\n    return 1;\n}\n", Format(f))
+
+	g := function("g")
+	g.Params = []*Parameter{{Type: op(token.IntKeywordToken, "int")}}
+	g.Prototype = true
+	assert.Equal("int g(int);\n", Format(g))
+}
+
+func TestFormatPointers(t *testing.T) {
+	assert := assert.New(t)
+	f := function("f")
+	f.Pointers = 1
+	f.Params = []*Parameter{
+		{Type: op(token.IntKeywordToken, "int"), Pointers: 2,
+			Name: op(token.IdentifierToken, "p")},
+		{Type: op(token.DoubleKeywordToken, "double"), Pointers: 1},
+	}
+	f.Prototype = true
+	assert.Equal("int *f(int **p, double *);\n", Format(f))
+
+	p := &Identifier{Token: op(token.IdentifierToken, "p")}
+	deref := func(e Expression) *UnaryOp {
+		return &UnaryOp{Operator: op(token.MultiplicationToken, "*"), Operand: e}
+	}
+	addr := func(e Expression) *UnaryOp {
+		return &UnaryOp{Operator: op(token.BitwiseAndToken, "&"), Operand: e}
+	}
+	assert.Equal("int *q = &*p;\n", Format(&VariableDeclaration{
+		Type: op(token.IntKeywordToken, "int"), Pointers: 1,
+		Name: op(token.IdentifierToken, "q"), Init: addr(deref(p))}))
+	assert.Equal("**p * *(p + 1)", Format(mul(deref(deref(p)),
+		deref(add(p, num(1))))))
+	assert.Equal("&(&p)", Format(addr(addr(p))))
+}
+
+func TestFormatArrays(t *testing.T) {
+	assert := assert.New(t)
+	f := function("f")
+	f.Params = []*Parameter{
+		{Type: op(token.IntKeywordToken, "int"), Name: op(token.IdentifierToken, "m"),
+			Lengths: []Expression{nil, add(num(1), num(2))}},
+	}
+	f.Prototype = true
+	assert.Equal("int f(int m[][1 + 2]);\n", Format(f))
+	assert.Equal("int *a[2][3];\n", Format(&VariableDeclaration{
+		Type: op(token.IntKeywordToken, "int"), Pointers: 1,
+		Name:    op(token.IdentifierToken, "a"),
+		Lengths: []Expression{num(2), num(3)}}))
+
+	a := &Identifier{Token: op(token.IdentifierToken, "a")}
+	sub := &Subscript{Array: &Subscript{Array: a, Index: num(1)},
+		Index: add(num(1), num(2))}
+	assert.Equal("a[1][1 + 2]", Format(sub))
+	assert.Equal("-a[1][1 + 2]", Format(neg(sub)))
+	assert.Equal("(a + 1)[0]", Format(&Subscript{Array: add(a, num(1)),
+		Index: num(0)}))
+}
+
+func TestFormatSizeof(t *testing.T) {
+	assert := assert.New(t)
+	sizeof := op(token.SizeofKeywordToken, "sizeof")
+	a := &Identifier{Token: op(token.IdentifierToken, "a")}
+	assert.Equal("sizeof a[1]", Format(&Sizeof{Sizeof: sizeof,
+		Operand: &Subscript{Array: a, Index: num(1)}}))
+	// Other operands are parenthesized.
+	assert.Equal("sizeof(-a) * 2", Format(mul(&Sizeof{Sizeof: sizeof,
+		Operand: neg(a)}, num(2))))
+	assert.Equal("sizeof(a + 1)", Format(&Sizeof{Sizeof: sizeof,
+		Operand: add(a, num(1))}))
+	assert.Equal("-sizeof(struct s *[1 + 2])", Format(neg(&Sizeof{
+		Sizeof: sizeof, TypeName: &TypeName{Type: op(token.StructKeywordToken, "struct"),
+			Tag: op(token.IdentifierToken, "s"), Pointers: 1,
+			Lengths: []Expression{add(num(1), num(2))}}})))
+}
+
+func TestFormatStructs(t *testing.T) {
+	assert := assert.New(t)
+	point := op(token.IdentifierToken, "point")
+	p := &Program{
+		Structs: []*StructDeclaration{{Name: point, Fields: []*Field{
+			{Type: op(token.IntKeywordToken, "int"), Name: op(token.IdentifierToken, "x")},
+			{Type: op(token.StructKeywordToken, "struct"), Tag: point, Pointers: 1,
+				Name: op(token.IdentifierToken, "next"), Lengths: []Expression{num(2)}},
+		}}},
+		Functions: []*Function{function("main", &VariableDeclaration{
+			Type: op(token.StructKeywordToken, "struct"), Tag: point,
+			Name: op(token.IdentifierToken, "p")})},
+	}
+	assert.Equal(`struct point {
+    int x;
+    struct point *next[2];
+};
+
+int main() {
+    struct point p;
+}
+`, Format(p))
+
+	s := &Identifier{Token: op(token.IdentifierToken, "s")}
+	x := op(token.IdentifierToken, "x")
+	member := &Member{X: add(s, num(1)), Operator: op(token.ArrowToken, "->"),
+		Name: x}
+	assert.Equal("(s + 1)->x", Format(member))
+	assert.Equal("-(s + 1)->x.x", Format(neg(&Member{X: member,
+		Operator: op(token.DotToken, "."), Name: x})))
+}
+
+func TestFormatEnums(t *testing.T) {
+	assert := assert.New(t)
+	color := op(token.IdentifierToken, "color")
+	p := &Program{
+		Enums: []*EnumDeclaration{
+			{Name: color, Enumerators: []*Enumerator{
+				{Name: op(token.IdentifierToken, "RED")},
+				{Name: op(token.IdentifierToken, "GREEN"), Value: add(num(1), num(2))},
+			}},
+			{Enumerators: []*Enumerator{{Name: op(token.IdentifierToken, "N")}}},
+		},
+		Globals: []*VariableDeclaration{{Type: op(token.EnumKeywordToken, "enum"),
+			Tag: color, Name: op(token.IdentifierToken, "c")}},
+	}
+	// Every enumerator is followed by a comma.
+	assert.Equal(`enum color {
+    RED,
+    GREEN = 1 + 2,
+};
+
+enum {
+    N,
+};
+
+enum color c;
+`, Format(p))
+}
+
+func TestFormatTypedefs(t *testing.T) {
+	assert := assert.New(t)
+	name := op(token.IdentifierToken, "T")
+	p := &Program{
+		Typedefs: []*TypedefDeclaration{
+			{Type: op(token.IntKeywordToken, "int"), Name: name},
+			{Type: name, Pointers: 1, Name: op(token.IdentifierToken, "A"),
+				Lengths: []Expression{add(num(1), num(2))}},
+		},
+		Globals: []*VariableDeclaration{{Type: name, Name: op(token.IdentifierToken, "g")}},
+	}
+	// Typedefs are grouped together.
+	assert.Equal(`typedef int T;
+typedef T *A[1 + 2];
+
+T g;
+`, Format(p))
+}
+
+func TestFormatGlobals(t *testing.T) {
+	assert := assert.New(t)
+	p := &Program{
+		Globals: []*VariableDeclaration{
+			{Type: op(token.IntKeywordToken, "int"), Name: op(token.IdentifierToken, "a"),
+				Init: num(1)},
+			{Type: op(token.DoubleKeywordToken, "double"), Name: op(token.IdentifierToken, "b")},
+		},
+		Functions: []*Function{function("main")},
+	}
+	assert.Equal(`int a = 1;
+double b;
+
+int main() {
+}
+`, Format(p))
+}
+
+func TestFormatStorageClasses(t *testing.T) {
+	assert := assert.New(t)
+	f := function("f", &ReturnStatement{Value: num(0)})
+	f.Storage = op(token.StaticKeywordToken, "static")
+	p := &Program{
+		Globals: []*VariableDeclaration{
+			{Storage: op(token.ExternKeywordToken, "extern"),
+				Type: op(token.IntKeywordToken, "int"), Name: op(token.IdentifierToken, "a")},
+		},
+		Functions: []*Function{f},
+	}
+	assert.Equal(`extern int a;
+
+static int f() {
+    return 0;
+}
+`, Format(p))
+	assert.Equal("extern int a;", p.Globals[0].String())
+	assert.False(p.Globals[0].IsDefinition())
+}
+
+func TestFormatCall(t *testing.T) {
+	assert := assert.New(t)
+	f := &Identifier{Token: op(token.IdentifierToken, "f")}
+	assert.Equal("f()", Format(&Call{Function: f}))
+	assert.Equal("f(1 + 2, f(3)) * 4", Format(mul(&Call{Function: f,
+		Args: []Expression{add(num(1), num(2)),
+			&Call{Function: f, Args: []Expression{num(3)}}}}, num(4))))
+}
+
+func ifElse(cond Expression, then, els Statement) *IfStatement {
+	return &IfStatement{Cond: cond, Then: then, Else: els}
+}
+
+func ret(value int64) *ReturnStatement {
+	return &ReturnStatement{Value: num(value)}
+}
+
+func TestFormatIf(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("if (1)\n    return 2;\n", Format(ifElse(num(1), ret(2), nil)))
+	assert.Equal(`if (1) {
+    return 2;
+}
+`, Format(ifElse(num(1), &Block{Statements: []Statement{ret(2)}}, nil)))
+	assert.Equal(`if (1)
+    return 2;
+else
+    return 3;
+`, Format(ifElse(num(1), ret(2), ret(3))))
+	assert.Equal(`int f() {
+    if (1) {
+        return 2;
+    } else {
+    }
+}
+`, Format(function("f", ifElse(num(1),
+		&Block{Statements: []Statement{ret(2)}}, &Block{}))))
+}
+
+func TestFormatElseIf(t *testing.T) {
+	assert := assert.New(t)
+	block := func(s Statement) *Block { return &Block{Statements: []Statement{s}} }
+	assert.Equal(`if (1) {
+    return 1;
+} else if (2) {
+    return 2;
+} else {
+    return 3;
+}
+`, Format(ifElse(num(1), block(ret(1)),
+		ifElse(num(2), block(ret(2)), block(ret(3))))))
+	assert.Equal(`if (1)
+    return 1;
+else if (2)
+    return 2;
+`, Format(ifElse(num(1), ret(1), ifElse(num(2), ret(2), nil))))
+}
+
+func TestFormatDanglingElse(t *testing.T) {
+	assert := assert.New(t)
+	// The else belongs to the inner if.
+	assert.Equal(`if (1)
+    if (2)
+        return 2;
+    else
+        return 3;
+`, Format(ifElse(num(1), ifElse(num(2), ret(2), ret(3)), nil)))
+	// The else belongs to the outer if, so the inner if must be braced.
+	assert.Equal(`if (1) {
+    if (2)
+        return 2;
+} else
+    return 3;
+`, Format(ifElse(num(1), ifElse(num(2), ret(2), nil), ret(3))))
+	assert.Equal(`if (1) {
+    while (2)
+        if (3)
+            return 3;
+} else
+    return 4;
+`, Format(ifElse(num(1), &WhileStatement{Cond: num(2),
+		Body: ifElse(num(3), ret(3), nil)}, ret(4))))
+}
+
+func TestFormatLoops(t *testing.T) {
+	assert := assert.New(t)
+	i := &Identifier{Token: op(token.IdentifierToken, "i")}
+	assert.Equal(`while (i) {
+    break;
+}
+`, Format(&WhileStatement{Cond: i,
+		Body: &Block{Statements: []Statement{&BreakStatement{}}}}))
+	assert.Equal("while (i)\n    continue;\n",
+		Format(&WhileStatement{Cond: i, Body: &ContinueStatement{}}))
+	assert.Equal(`do {
+    break;
+} while (i);
+`, Format(&DoWhileStatement{Cond: i,
+		Body: &Block{Statements: []Statement{&BreakStatement{}}}}))
+	assert.Equal("do\n    break;\nwhile (i);\n",
+		Format(&DoWhileStatement{Cond: i, Body: &BreakStatement{}}))
+}
+
+func TestFormatFor(t *testing.T) {
+	assert := assert.New(t)
+	i := &Identifier{Token: op(token.IdentifierToken, "i")}
+	assert.Equal("for (;;) {\n}\n", Format(&ForStatement{Body: &Block{}}))
+	assert.Equal("for (int i = 0; i; i = i + 1) {\n}\n", Format(&ForStatement{
+		Init: &VariableDeclaration{Type: op(token.IntKeywordToken, "int"),
+			Name: op(token.IdentifierToken, "i"), Init: num(0)},
+		Cond: i,
+		Post: &Assignment{Operator: op(token.AssignmentToken, "="), Lhs: i,
+			Rhs: add(i, num(1))},
+		Body: &Block{},
+	}))
+	assert.Equal("for (i;; i)\n    break;\n", Format(&ForStatement{
+		Init: &ExpressionStatement{Expression: i}, Post: i,
+		Body: &BreakStatement{},
+	}))
+}
+
+func TestFormatGoto(t *testing.T) {
+	assert := assert.New(t)
+	out := op(token.IdentifierToken, "out")
+	f := function("f")
+	f.Body = []Statement{
+		&Block{Statements: []Statement{&GotoStatement{Label: out}}},
+		&LabeledStatement{Label: out, Body: ret(1)},
+	}
+	// Labels are outdented by one level.
+	assert.Equal(`int f() {
+    {
+        goto out;
+    }
+out:
+    return 1;
+}
+`, Format(f))
+}
+
+func TestFormatSwitch(t *testing.T) {
+	assert := assert.New(t)
+	s := &SwitchStatement{
+		Value: &Identifier{Token: op(token.IdentifierToken, "a")},
+		Body: &Block{Statements: []Statement{
+			&CaseStatement{Value: num(1), Body: &CaseStatement{Value: neg(num(2)),
+				Body: ret(1)}},
+			&BreakStatement{},
+			&CaseStatement{Body: &Block{}},
+		}},
+	}
+	// Case labels are at the level of the switch.
+	assert.Equal(`int f() {
+    switch (a) {
+    case 1:
+    case -2:
+        return 1;
+        break;
+    default:
+        {
+        }
+    }
+}
+`, Format(function("f", s)))
+	assert.Equal("switch (1)\ncase 2:\n    return 3;\n", Format(&SwitchStatement{
+		Value: num(1), Body: &CaseStatement{Value: num(2), Body: ret(3)}}))
+}
+
+func TestFormatMinimalParentheses(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("1 + 2 * 3", Format(add(num(1), mul(num(2), num(3)))))
+	assert.Equal("(1 + 2) * 3", Format(mul(add(num(1), num(2)), num(3))))
+	assert.Equal("1 - 2 - 3", Format(sub(sub(num(1), num(2)), num(3))))
+	assert.Equal("1 - (2 - 3)", Format(sub(num(1), sub(num(2), num(3)))))
+	assert.Equal("-(1 + 2)", Format(neg(add(num(1), num(2)))))
+	assert.Equal("-1 + 2", Format(add(neg(num(1)), num(2))))
+}
+
+func cond(c, then, els Expression) *ConditionalExpression {
+	return &ConditionalExpression{Cond: c, Then: then, Else: els}
+}
+
+func TestFormatConditional(t *testing.T) {
+	assert := assert.New(t)
+	a := &Identifier{Token: op(token.IdentifierToken, "a")}
+	assign := &Assignment{Operator: op(token.AssignmentToken, "="), Lhs: a,
+		Rhs: num(2)}
+	assert.Equal("1 + 2 ? 3 * 4 : -5", Format(cond(add(num(1), num(2)),
+		mul(num(3), num(4)), neg(num(5)))))
+	// The conditional operator is right-associative.
+	assert.Equal("1 ? 2 : 3 ? 4 : 5", Format(cond(num(1), num(2),
+		cond(num(3), num(4), num(5)))))
+	assert.Equal("(1 ? 2 : 3) ? 4 : 5", Format(cond(cond(num(1), num(2), num(3)),
+		num(4), num(5))))
+	// Any expression may be the middle operand, but an assignment binds
+	// looser than the last.
+	assert.Equal("1 ? a = 2 : 3", Format(cond(num(1), assign, num(3))))
+	assert.Equal("1 ? 2 : (a = 2)", Format(cond(num(1), num(2), assign)))
+	assert.Equal("(1 ? 2 : 3) + 4", Format(add(cond(num(1), num(2), num(3)), num(4))))
+	assert.Equal("a = 1 ? 2 : 3", Format(&Assignment{
+		Operator: op(token.AssignmentToken, "="), Lhs: a,
+		Rhs: cond(num(1), num(2), num(3))}))
+}
+
+func TestFormatIncDecOp(t *testing.T) {
+	assert := assert.New(t)
+	a := &Identifier{Token: op(token.IdentifierToken, "a")}
+	inc := func(e Expression, postfix bool) *IncDecOp {
+		return &IncDecOp{Operator: op(token.IncrementToken, "++"), Operand: e,
+			Postfix: postfix}
+	}
+	dec := &IncDecOp{Operator: op(token.DecrementToken, "--"), Operand: a}
+	assert.Equal("a++ + ++a", Format(add(inc(a, true), inc(a, false))))
+	// Postfix operators bind tighter than prefix operators.
+	assert.Equal("-a++", Format(neg(inc(a, true))))
+	assert.Equal("(-a)++", Format(inc(neg(a), true)))
+	assert.Equal("++a++", Format(inc(inc(a, true), false)))
+	assert.Equal("(++a)++", Format(inc(inc(a, false), true)))
+	// Operators are not glued together.
+	assert.Equal("-(--a)", Format(neg(dec)))
+	assert.Equal("--(-a)", Format(&IncDecOp{
+		Operator: op(token.DecrementToken, "--"), Operand: neg(a)}))
+	assert.Equal("-(-1)", Format(neg(&IntLiteral{Value: -1})))
+}
+
+func TestFormatCompoundAssignment(t *testing.T) {
+	assert := assert.New(t)
+	a := &Identifier{Token: op(token.IdentifierToken, "a")}
+	compound := func(lhs, rhs Expression) *CompoundAssignment {
+		return &CompoundAssignment{
+			Operator: op(token.AdditionAssignmentToken, "+="), Lhs: lhs, Rhs: rhs}
+	}
+	assert.Equal("a += 1 + 2", Format(compound(a, add(num(1), num(2)))))
+	// Assignments are right-associative.
+	assert.Equal("a += a += 1", Format(compound(a, compound(a, num(1)))))
+	assert.Equal("(a += 1) += 2", Format(compound(compound(a, num(1)), num(2))))
+	assert.Equal("(a += 1) * 2", Format(mul(compound(a, num(1)), num(2))))
+}
+
+func TestFormatBitwiseOperators(t *testing.T) {
+	assert := assert.New(t)
+	binary := func(t token.TokenType, value string) func(lhs, rhs Expression) Expression {
+		return func(lhs, rhs Expression) Expression {
+			return &BinaryOp{Operator: op(t, value), Lhs: lhs, Rhs: rhs}
+		}
+	}
+	and := binary(token.BitwiseAndToken, "&")
+	or := binary(token.BitwiseOrToken, "|")
+	xor := binary(token.BitwiseXorToken, "^")
+	shl := binary(token.ShiftLeftToken, "<<")
+	eq := binary(token.EqualToken, "==")
+	assert.Equal("1 | 2 ^ 3 & 4", Format(or(num(1), xor(num(2), and(num(3), num(4))))))
+	assert.Equal("((1 | 2) ^ 3) & 4", Format(and(xor(or(num(1), num(2)), num(3)), num(4))))
+	// Comparisons bind tighter than bitwise operators, but looser than shifts.
+	assert.Equal("1 == 2 & 3", Format(and(eq(num(1), num(2)), num(3))))
+	assert.Equal("1 == (2 & 3)", Format(eq(num(1), and(num(2), num(3)))))
+	assert.Equal("1 << 2 == 3", Format(eq(shl(num(1), num(2)), num(3))))
+	assert.Equal("1 << 2 + 3", Format(shl(num(1), add(num(2), num(3)))))
+	assert.Equal("(1 << 2) + 3", Format(add(shl(num(1), num(2)), num(3))))
+}
+
+func TestFormatNestedNegation(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("-(-1)", Format(neg(neg(num(1)))))
+	assert.Equal("!-1", Format(&UnaryOp{
+		Operator: op(token.LogicalNegationToken, "!"), Operand: neg(num(1))}))
+}
+
+func TestFormatLiteralSpelling(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("0012", Format(&IntLiteral{
+		Token: op(token.NumberToken, "0012"), Value: 12}))
+	assert.Equal("1.50f", Format(&FloatLiteral{
+		Token: op(token.FloatLiteralToken, "1.50f"), Value: 1.5}))
+	assert.Equal("0.25", Format(&FloatLiteral{Value: 0.25}))
+	// Character constants and string literals are written with the escapes of
+	// C, which need not be how they were written in the source.
+	assert.Equal(`'\''`, Format(&IntLiteral{
+		Token: op(token.CharLiteralToken, "'"), Value: '\''}))
+	assert.Equal(`'\377'`, Format(&IntLiteral{
+		Token: op(token.CharLiteralToken, "\xff"), Value: -1}))
+	assert.Equal(`"a\"b\\\n\001"`, Format(&StringLiteral{Value: "a\"b\\\n\x01"}))
+}
+
+func TestFormatConversion(t *testing.T) {
+	assert := assert.New(t)
+	// Implicit conversions are not part of the source.
+	assert.Equal("1 + 2", Format(add(num(1),
+		&Conversion{Operand: num(2), Type: types.Double, Implicit: true})))
+	assert.Equal("(float)(1 + 2) * 3", Format(mul(&Conversion{
+		Operand: add(num(1), num(2)), Type: types.Float}, num(3))))
+	// An implicit conversion binds as tightly as its operand.
+	assert.Equal("(1 + 2) * 3", Format(mul(&Conversion{
+		Operand: add(num(1), num(2)), Type: types.Float, Implicit: true},
+		num(3))))
+	// A cast is written with its type name.
+	p := &Identifier{Token: op(token.IdentifierToken, "p")}
+	assert.Equal("*(struct s *)p + (int)-1", Format(add(&UnaryOp{
+		Operator: op(token.MultiplicationToken, "*"), Operand: &Conversion{
+			TypeName: &TypeName{Type: op(token.StructKeywordToken, "struct"),
+				Tag: op(token.IdentifierToken, "s"), Pointers: 1}, Operand: p}},
+		&Conversion{TypeName: &TypeName{Type: op(token.IntKeywordToken, "int")},
+			Operand: neg(num(1))})))
+}
+
+func TestPrint(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.NoError(Print(&b, &ReturnStatement{Value: num(0)}))
+	assert.Equal("return 0;\n", b.String())
+}
@@ -0,0 +1,63 @@
+package ast
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+)
+
+// The root of the abstract syntax tree.
+type Program struct {
+	numbered
+	Enums     []*EnumDeclaration
+	Typedefs  []*TypedefDeclaration
+	Structs   []*StructDeclaration
+	Globals   []*VariableDeclaration // Variables declared at file scope.
+	Functions []*Function
+	ids       Numbering // Assigns the IDs of the nodes of the program.
+}
+
+func (p *Program) Pos() token.Position {
+	var first []Node
+	if len(p.Enums) > 0 {
+		first = append(first, p.Enums[0])
+	}
+	if len(p.Typedefs) > 0 {
+		first = append(first, p.Typedefs[0])
+	}
+	if len(p.Structs) > 0 {
+		first = append(first, p.Structs[0])
+	}
+	if len(p.Globals) > 0 {
+		first = append(first, p.Globals[0])
+	}
+	if len(p.Functions) > 0 {
+		first = append(first, p.Functions[0])
+	}
+	var pos token.Position
+	for _, n := range first {
+		if !pos.IsValid() || n.Pos().Offset < pos.Offset {
+			pos = n.Pos()
+		}
+	}
+	return pos
+}
+
+func (p *Program) String() string {
+	var decls []string
+	for _, e := range p.Enums {
+		decls = append(decls, e.String())
+	}
+	for _, t := range p.Typedefs {
+		decls = append(decls, t.String())
+	}
+	for _, s := range p.Structs {
+		decls = append(decls, s.String())
+	}
+	for _, g := range p.Globals {
+		decls = append(decls, g.String())
+	}
+	for _, f := range p.Functions {
+		decls = append(decls, f.String())
+	}
+	return strings.Join(decls, " ")
+}
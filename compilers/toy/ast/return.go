@@ -0,0 +1,23 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// A return statement.
+type ReturnStatement struct {
+	numbered
+	Return token.Position
+	Value  Expression
+}
+
+func (*ReturnStatement) statementNode() {}
+
+func (r *ReturnStatement) Pos() token.Position {
+	return r.Return
+}
+
+func (r *ReturnStatement) String() string {
+	return fmt.Sprintf("return %v;", r.Value)
+}
@@ -0,0 +1,34 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A sizeof expression, which gives the size in bytes of the type of its
+// operand, as in "sizeof x", or of a type name, as in "sizeof(int *)". The
+// operand is not evaluated.
+type Sizeof struct {
+	numbered
+	Sizeof   token.Token
+	Operand  Expression // Nil if the size of a type name is taken.
+	TypeName *TypeName  // Nil if the size of an operand is taken.
+	// The type whose size is taken, and the size, set by semantic analysis.
+	Of    types.Type
+	Value int64
+	Type  types.Type // Set by semantic analysis.
+}
+
+func (*Sizeof) expressionNode() {}
+
+func (s *Sizeof) Pos() token.Position {
+	return s.Sizeof.Position()
+}
+
+func (s *Sizeof) String() string {
+	if s.TypeName != nil {
+		return fmt.Sprintf("sizeof(%v)", s.TypeName)
+	}
+	return fmt.Sprintf("(sizeof %v)", s.Operand)
+}
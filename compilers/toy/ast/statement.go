@@ -0,0 +1,28 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// A statement node.
+type Statement interface {
+	Node
+	statementNode()
+}
+
+// An expression evaluated for its side effects.
+type ExpressionStatement struct {
+	numbered
+	Expression Expression
+}
+
+func (*ExpressionStatement) statementNode() {}
+
+func (s *ExpressionStatement) Pos() token.Position {
+	return s.Expression.Pos()
+}
+
+func (s *ExpressionStatement) String() string {
+	return fmt.Sprintf("%v;", s.Expression)
+}
@@ -0,0 +1,310 @@
+package ast
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIntLiteralString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("42", (&IntLiteral{Value: 42}).String())
+}
+
+func TestUnaryOpString(t *testing.T) {
+	assert := assert.New(t)
+	u := &UnaryOp{
+		Operator: token.Token{Type: token.NegationToken, Value: "-"},
+		Operand:  &IntLiteral{Value: 5},
+	}
+	assert.Equal("(-5)", u.String())
+}
+
+func TestIncDecOpString(t *testing.T) {
+	assert := assert.New(t)
+	a := &Identifier{Token: token.Token{Type: token.IdentifierToken, Value: "a",
+		Line: 1, Column: 3}}
+	inc := token.Token{Type: token.IncrementToken, Value: "++", Line: 1,
+		Column: 1}
+	prefix := &IncDecOp{Operator: inc, Operand: a}
+	assert.Equal("(++a)", prefix.String())
+	assert.Equal("1:1", prefix.Pos().String())
+	postfix := &IncDecOp{Operator: inc, Operand: a, Postfix: true}
+	assert.Equal("(a++)", postfix.String())
+	assert.Equal("1:3", postfix.Pos().String())
+}
+
+func TestCompoundAssignmentString(t *testing.T) {
+	assert := assert.New(t)
+	a := &CompoundAssignment{
+		Operator: token.Token{Type: token.ShiftLeftAssignmentToken, Value: "<<="},
+		Lhs:      &Identifier{Token: token.Token{Value: "a"}},
+		Rhs:      &IntLiteral{Value: 2},
+	}
+	assert.Equal("(a <<= 2)", a.String())
+}
+
+func TestBinaryOpString(t *testing.T) {
+	assert := assert.New(t)
+	b := &BinaryOp{
+		Operator: token.Token{Type: token.AdditionToken, Value: "+"},
+		Lhs:      &IntLiteral{Value: 1},
+		Rhs: &BinaryOp{
+			Operator: token.Token{Type: token.MultiplicationToken, Value: "*"},
+			Lhs:      &IntLiteral{Value: 2},
+			Rhs:      &IntLiteral{Value: 3},
+		},
+	}
+	assert.Equal("(1 + (2 * 3))", b.String())
+}
+
+func TestProgramString(t *testing.T) {
+	assert := assert.New(t)
+	p := &Program{Functions: []*Function{
+		{
+			Type: token.Token{Type: token.IntKeywordToken, Value: "int"},
+			Name: token.Token{Type: token.IdentifierToken, Value: "main"},
+			Body: []Statement{&ReturnStatement{Value: &IntLiteral{Value: 0}}},
+		},
+	}}
+	assert.Equal("int main() { return 0; }", p.String())
+	p.Structs = []*StructDeclaration{{
+		Name: token.Token{Type: token.IdentifierToken, Value: "s"},
+		Fields: []*Field{{
+			Type: token.Token{Type: token.IntKeywordToken, Value: "int"},
+			Name: token.Token{Type: token.IdentifierToken, Value: "x"},
+		}},
+	}}
+	assert.Equal("struct s { int x; }; int main() { return 0; }", p.String())
+	p.Globals = []*VariableDeclaration{{
+		Type: token.Token{Type: token.IntKeywordToken, Value: "int"},
+		Name: token.Token{Type: token.IdentifierToken, Value: "g"},
+	}}
+	assert.Equal("struct s { int x; }; int g; int main() { return 0; }", p.String())
+	p.Enums = []*EnumDeclaration{{Enumerators: []*Enumerator{
+		{Name: token.Token{Type: token.IdentifierToken, Value: "A"}},
+	}}}
+	assert.Equal("enum { A }; struct s { int x; }; int g; int main() { return 0; }",
+		p.String())
+	p.Typedefs = []*TypedefDeclaration{{
+		Type: token.Token{Type: token.IntKeywordToken, Value: "int"},
+		Name: token.Token{Type: token.IdentifierToken, Value: "T"},
+	}}
+	assert.Equal("enum { A }; typedef int T; struct s { int x; }; int g; int main() { return 0; }",
+		p.String())
+}
+
+func TestTypedefString(t *testing.T) {
+	assert := assert.New(t)
+	d := &TypedefDeclaration{
+		Typedef:  token.Position{Line: 3, Column: 1},
+		Type:     token.Token{Type: token.StructKeywordToken, Value: "struct"},
+		Tag:      token.Token{Type: token.IdentifierToken, Value: "s"},
+		Pointers: 1,
+		Name:     token.Token{Type: token.IdentifierToken, Value: "A"},
+		Lengths:  []Expression{&IntLiteral{Value: 2}},
+	}
+	assert.Equal("typedef struct s *A[2];", d.String())
+	assert.Equal("3:1", d.Pos().String())
+}
+
+func TestEnumString(t *testing.T) {
+	assert := assert.New(t)
+	d := &EnumDeclaration{
+		Enum: token.Position{Line: 2, Column: 1},
+		Name: token.Token{Type: token.IdentifierToken, Value: "color"},
+		Enumerators: []*Enumerator{
+			{Name: token.Token{Type: token.IdentifierToken, Value: "RED",
+				Line: 2, Column: 14}},
+			{Name: token.Token{Type: token.IdentifierToken, Value: "GREEN"},
+				Value: &IntLiteral{Value: 2}},
+		},
+	}
+	assert.Equal("enum color { RED, GREEN = 2 };", d.String())
+	assert.Equal("2:1", d.Pos().String())
+	assert.Equal("2:14", d.Enumerators[0].Pos().String())
+}
+
+func TestMemberString(t *testing.T) {
+	assert := assert.New(t)
+	p := &Identifier{Token: token.Token{Type: token.IdentifierToken, Value: "p",
+		Line: 1, Column: 1}}
+	m := &Member{
+		X:        &Member{X: p, Operator: token.Token{Type: token.ArrowToken, Value: "->"}, Name: token.Token{Value: "a"}},
+		Operator: token.Token{Type: token.DotToken, Value: "."},
+		Name:     token.Token{Type: token.IdentifierToken, Value: "b"},
+	}
+	assert.Equal("p->a.b", m.String())
+	assert.Equal("1:1", m.Pos().String())
+}
+
+func TestConditionalExpressionString(t *testing.T) {
+	assert := assert.New(t)
+	c := &ConditionalExpression{
+		Cond: &IntLiteral{Value: 1},
+		Then: &IntLiteral{Value: 2},
+		Else: &ConditionalExpression{Cond: &IntLiteral{Value: 3},
+			Then: &IntLiteral{Value: 4}, Else: &IntLiteral{Value: 5}},
+	}
+	assert.Equal("(1 ? 2 : (3 ? 4 : 5))", c.String())
+	assert.Equal(token.Position{}, c.Pos())
+}
+
+func TestPos(t *testing.T) {
+	assert := assert.New(t)
+	one := token.Token{Type: token.NumberToken, Value: "1", Offset: 3, Line: 1,
+		Column: 4}
+	b := &BinaryOp{
+		Operator: token.Token{Type: token.AdditionToken, Value: "+", Offset: 5,
+			Line: 1, Column: 6},
+		Lhs: &IntLiteral{Token: one, Value: 1},
+		Rhs: &IntLiteral{Value: 2},
+	}
+	assert.Equal(one.Position(), b.Pos())
+	assert.Equal(token.Position{}, (&Program{}).Pos())
+}
+
+func TestFloatLiteralString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("1.5", (&FloatLiteral{Value: 1.5}).String())
+	assert.Equal("1e+10", (&FloatLiteral{Value: 1e10}).String())
+}
+
+func TestFunctionString(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{
+		Type: token.Token{Type: token.IntKeywordToken, Value: "int"},
+		Name: token.Token{Type: token.IdentifierToken, Value: "f"},
+		Params: []*Parameter{
+			{Type: token.Token{Type: token.IntKeywordToken, Value: "int"},
+				Name: token.Token{Type: token.IdentifierToken, Value: "a"}},
+			{Type: token.Token{Type: token.FloatKeywordToken, Value: "float"}},
+		},
+		Prototype: true,
+	}
+	assert.Equal("int f(int a, float);", f.String())
+	f.Pointers = 1
+	f.Params[1].Pointers = 2
+	assert.Equal("int *f(int a, float **);", f.String())
+	f.Params[0].Lengths = []Expression{nil}
+	assert.Equal("int *f(int a[], float **);", f.String())
+}
+
+func TestVariableDeclarationString(t *testing.T) {
+	assert := assert.New(t)
+	d := &VariableDeclaration{
+		Type:     token.Token{Type: token.IntKeywordToken, Value: "int"},
+		Pointers: 1,
+		Name:     token.Token{Type: token.IdentifierToken, Value: "p"},
+	}
+	assert.Equal("int *p;", d.String())
+	d.Init = &IntLiteral{Value: 0}
+	assert.Equal("int *p = 0;", d.String())
+	d.Init = nil
+	d.Lengths = []Expression{&IntLiteral{Value: 2}, &IntLiteral{Value: 3}}
+	assert.Equal("int *p[2][3];", d.String())
+	d.Type = token.Token{Type: token.StructKeywordToken, Value: "struct"}
+	d.Tag = token.Token{Type: token.IdentifierToken, Value: "s"}
+	d.Lengths = nil
+	assert.Equal("struct s *p;", d.String())
+}
+
+func TestSubscriptString(t *testing.T) {
+	assert := assert.New(t)
+	a := &Identifier{Token: token.Token{Type: token.IdentifierToken, Value: "a"}}
+	s := &Subscript{Array: a, Index: &IntLiteral{Value: 1}}
+	assert.Equal("a[1]", s.String())
+	assert.Equal("a[1][a[1]]", (&Subscript{Array: s, Index: s}).String())
+	assert.Equal(a.Pos(), s.Pos())
+}
+
+func TestSizeofString(t *testing.T) {
+	assert := assert.New(t)
+	sizeof := token.Token{Type: token.SizeofKeywordToken, Value: "sizeof", Line: 1, Column: 3}
+	a := &Identifier{Token: token.Token{Type: token.IdentifierToken, Value: "a"}}
+	s := &Sizeof{Sizeof: sizeof, Operand: a}
+	assert.Equal("(sizeof a)", s.String())
+	assert.Equal(sizeof.Position(), s.Pos())
+	s = &Sizeof{Sizeof: sizeof, TypeName: &TypeName{
+		Type: token.Token{Type: token.IntKeywordToken, Value: "int"}}}
+	assert.Equal("sizeof(int)", s.String())
+	s.TypeName.Pointers = 2
+	s.TypeName.Lengths = []Expression{&IntLiteral{Value: 3}}
+	assert.Equal("sizeof(int **[3])", s.String())
+}
+
+func TestCallString(t *testing.T) {
+	assert := assert.New(t)
+	c := &Call{
+		Function: &Identifier{Token: token.Token{Type: token.IdentifierToken,
+			Value: "f"}},
+		Args: []Expression{&IntLiteral{Value: 1}, &BinaryOp{
+			Operator: token.Token{Type: token.AdditionToken, Value: "+"},
+			Lhs:      &IntLiteral{Value: 2},
+			Rhs:      &IntLiteral{Value: 3},
+		}},
+	}
+	assert.Equal("f(1, (2 + 3))", c.String())
+}
+
+func TestIfStatementString(t *testing.T) {
+	assert := assert.New(t)
+	s := &IfStatement{
+		Cond: &Identifier{Token: token.Token{Type: token.IdentifierToken,
+			Value: "a"}},
+		Then: &ReturnStatement{Value: &IntLiteral{Value: 1}},
+	}
+	assert.Equal("if (a) return 1;", s.String())
+	s.Else = &Block{}
+	assert.Equal("if (a) return 1; else { }", s.String())
+}
+
+func TestLoopString(t *testing.T) {
+	assert := assert.New(t)
+	i := &Identifier{Token: token.Token{Type: token.IdentifierToken, Value: "i"}}
+	assert.Equal("while (i) break;",
+		(&WhileStatement{Cond: i, Body: &BreakStatement{}}).String())
+	assert.Equal("do continue; while (i);",
+		(&DoWhileStatement{Body: &ContinueStatement{}, Cond: i}).String())
+	assert.Equal("for (;;) { }", (&ForStatement{Body: &Block{}}).String())
+	assert.Equal("for (i; i; i) { }", (&ForStatement{
+		Init: &ExpressionStatement{Expression: i}, Cond: i, Post: i,
+		Body: &Block{},
+	}).String())
+}
+
+func TestSwitchString(t *testing.T) {
+	assert := assert.New(t)
+	s := &SwitchStatement{
+		Value: &IntLiteral{Value: 1},
+		Body: &Block{Statements: []Statement{
+			&CaseStatement{Value: &IntLiteral{Value: 2}, Body: &BreakStatement{}},
+			&CaseStatement{Body: &ReturnStatement{Value: &IntLiteral{Value: 3}}},
+		}},
+	}
+	assert.Equal("switch (1) { case 2: break; default: return 3; }", s.String())
+}
+
+func TestGotoString(t *testing.T) {
+	assert := assert.New(t)
+	label := token.Token{Type: token.IdentifierToken, Value: "out", Line: 2, Column: 3}
+	s := &LabeledStatement{Label: label, Body: &GotoStatement{Label: label}}
+	assert.Equal("out: goto out;", s.String())
+	assert.Equal("2:3", s.Pos().String())
+}
+
+func TestConversionString(t *testing.T) {
+	assert := assert.New(t)
+	c := &Conversion{Operand: &IntLiteral{Value: 1}, Type: types.Double,
+		Implicit: true}
+	assert.Equal("((double)1)", c.String())
+	assert.Equal(c.Operand.Pos(), c.Pos())
+	// A cast is written with its type name, and begins at its parenthesis.
+	lparen := token.Token{Type: token.OpenParenthesisToken, Value: "(", Line: 1, Column: 5}
+	c = &Conversion{Lparen: lparen, TypeName: &TypeName{
+		Type: token.Token{Type: token.CharKeywordToken, Value: "char"}, Pointers: 1},
+		Operand: &IntLiteral{Value: 0}}
+	assert.Equal("((char *)0)", c.String())
+	assert.Equal(lparen.Position(), c.Pos())
+}
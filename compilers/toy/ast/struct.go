@@ -0,0 +1,50 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+)
+
+// A struct declaration, which defines a struct type and its fields.
+type StructDeclaration struct {
+	numbered
+	Struct token.Position // The "struct" keyword.
+	Name   token.Token
+	Fields []*Field
+	Symbol *Symbol // The declared symbol, set by semantic analysis.
+}
+
+func (d *StructDeclaration) Pos() token.Position {
+	return d.Struct
+}
+
+func (d *StructDeclaration) String() string {
+	fields := make([]string, len(d.Fields))
+	for i, f := range d.Fields {
+		fields[i] = f.String()
+	}
+	return fmt.Sprintf("struct %s { %s };", d.Name.Value,
+		strings.Join(fields, " "))
+}
+
+// A field of a struct declaration.
+type Field struct {
+	numbered
+	Type     token.Token // The type keyword, or a typedef name.
+	Tag      token.Token // The struct name, if Type is "struct", or the rest of an integer type.
+	Pointers int         // The number of '*' before the name.
+	Name     token.Token
+	// The length of each dimension of an array, outermost first. Nil if the
+	// field is not an array.
+	Lengths []Expression
+}
+
+func (f *Field) Pos() token.Position {
+	return f.Type.Position()
+}
+
+func (f *Field) String() string {
+	return declarator(specifier(f.Type, f.Tag), f.Pointers, f.Name,
+		lengths(f.Lengths, Expression.String)) + ";"
+}
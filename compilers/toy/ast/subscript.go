@@ -0,0 +1,26 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A subscript a[i], which designates the element i of an array or of the
+// array that a pointer points into. It is equivalent to *(a + i).
+type Subscript struct {
+	numbered
+	Array Expression
+	Index Expression
+	Type  types.Type // The element type, set by semantic analysis.
+}
+
+func (*Subscript) expressionNode() {}
+
+func (s *Subscript) Pos() token.Position {
+	return s.Array.Pos()
+}
+
+func (s *Subscript) String() string {
+	return fmt.Sprintf("%v[%v]", s.Array, s.Index)
+}
@@ -0,0 +1,49 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// A switch statement, which jumps to the case label in its body which matches
+// the value of an integer expression.
+type SwitchStatement struct {
+	numbered
+	Switch token.Position
+	Value  Expression
+	Body   Statement
+	Cases  []*CaseStatement // The case labels of the body, set by semantic analysis.
+}
+
+func (*SwitchStatement) statementNode() {}
+
+func (s *SwitchStatement) Pos() token.Position {
+	return s.Switch
+}
+
+func (s *SwitchStatement) String() string {
+	return fmt.Sprintf("switch (%v) %v", s.Value, s.Body)
+}
+
+// A statement labelled with a case or default label of a switch.
+type CaseStatement struct {
+	numbered
+	Case  token.Position
+	Value Expression // Nil for the default label.
+	Body  Statement
+	// The value of the constant expression, set by semantic analysis.
+	Constant int64
+}
+
+func (*CaseStatement) statementNode() {}
+
+func (s *CaseStatement) Pos() token.Position {
+	return s.Case
+}
+
+func (s *CaseStatement) String() string {
+	if s.Value == nil {
+		return fmt.Sprintf("default: %v", s.Body)
+	}
+	return fmt.Sprintf("case %v: %v", s.Value, s.Body)
+}
@@ -0,0 +1,55 @@
+package ast
+
+import "github.com/ChrisCummins/phd/compilers/toy/types"
+
+// The kind of entity that a symbol names.
+type SymbolKind int
+
+const (
+	VariableSymbol SymbolKind = iota
+	FunctionSymbol
+	// A struct tag, whose name is prefixed by "struct " so that tags do not
+	// conflict with the names of variables and functions.
+	StructSymbol
+	// An enum tag, whose name is prefixed by "enum ".
+	EnumSymbol
+	// A named int constant declared by an enum.
+	EnumeratorSymbol
+	// A name for a type, declared by a typedef.
+	TypedefSymbol
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case VariableSymbol:
+		return "variable"
+	case FunctionSymbol:
+		return "function"
+	case StructSymbol:
+		return "struct"
+	case EnumSymbol:
+		return "enum"
+	case EnumeratorSymbol:
+		return "enumerator"
+	case TypedefSymbol:
+		return "typedef"
+	}
+	return "unknown"
+}
+
+// A named entity which identifiers are resolved to by semantic analysis.
+type Symbol struct {
+	Kind SymbolKind
+	Name string
+	Type types.Type
+	// The node which declares the symbol. For a function or global variable
+	// which is declared more than once, this is its definition, if it has
+	// one, or else its first declaration.
+	Decl Node
+	// Whether a function or global variable has internal linkage, being
+	// declared static, so that it is not visible to other files.
+	Static bool
+	// Whether the address of a variable is taken, set by semantic analysis.
+	AddressTaken bool
+	Value        int64 // The value of an enumerator.
+}
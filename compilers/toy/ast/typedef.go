@@ -0,0 +1,32 @@
+package ast
+
+import "github.com/ChrisCummins/phd/compilers/toy/token"
+
+// A typedef declaration, which declares a name for a type. The name may then
+// be used as a type specifier, as in "typedef int *ptr; ptr p;".
+type TypedefDeclaration struct {
+	numbered
+	Typedef  token.Position // The "typedef" keyword.
+	Type     token.Token    // The type keyword, or a typedef name.
+	Tag      token.Token    // The struct or enum name, or the rest of an integer type, if any.
+	Pointers int            // The number of '*' before the name.
+	Name     token.Token
+	// The length of each dimension of an array, outermost first. Nil if the
+	// type is not an array.
+	Lengths []Expression
+	Symbol  *Symbol // The declared symbol, set by semantic analysis.
+}
+
+func (d *TypedefDeclaration) Pos() token.Position {
+	return d.Typedef
+}
+
+func (d *TypedefDeclaration) String() string {
+	return d.format(Expression.String)
+}
+
+// format formats a typedef declaration, using format for its array lengths.
+func (d *TypedefDeclaration) format(format func(Expression) string) string {
+	return "typedef " + declarator(specifier(d.Type, d.Tag), d.Pointers, d.Name,
+		lengths(d.Lengths, format)) + ";"
+}
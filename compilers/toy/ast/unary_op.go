@@ -0,0 +1,26 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A unary operator applied to an operand: -x, ~x, !x, or the dereference *p
+// or address-of &x.
+type UnaryOp struct {
+	numbered
+	Operator token.Token
+	Operand  Expression
+	Type     types.Type // Set by semantic analysis.
+}
+
+func (*UnaryOp) expressionNode() {}
+
+func (u *UnaryOp) Pos() token.Position {
+	return u.Operator.Position()
+}
+
+func (u *UnaryOp) String() string {
+	return fmt.Sprintf("(%s%v)", u.Operator.Value, u.Operand)
+}
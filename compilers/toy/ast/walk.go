@@ -0,0 +1,397 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called by Walk for each node. If the visitor w
+// which it returns is not nil, Walk visits each of the children of the node
+// with w, then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a syntax tree in depth-first order, and in the order of the
+// source: it calls v.Visit(node), and then, unless it returns nil, walks
+// each of the children of the node with the visitor returned. The children
+// are the nodes which the node contains, so the statements which a break,
+// continue or goto jumps to and the case labels of a switch, which semantic
+// analysis records, are not walked again. Nil children are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *Program:
+		for _, e := range n.Enums {
+			Walk(v, e)
+		}
+		for _, t := range n.Typedefs {
+			Walk(v, t)
+		}
+		for _, s := range n.Structs {
+			Walk(v, s)
+		}
+		for _, g := range n.Globals {
+			Walk(v, g)
+		}
+		for _, f := range n.Functions {
+			Walk(v, f)
+		}
+
+	// Declarations.
+	case *EnumDeclaration:
+		for _, e := range n.Enumerators {
+			Walk(v, e)
+		}
+	case *Enumerator:
+		walkExpression(v, n.Value)
+	case *TypedefDeclaration:
+		walkExpressions(v, n.Lengths)
+	case *StructDeclaration:
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+	case *Field:
+		walkExpressions(v, n.Lengths)
+	case *VariableDeclaration:
+		walkExpressions(v, n.Lengths)
+		walkExpression(v, n.Init)
+	case *Function:
+		for _, p := range n.Params {
+			Walk(v, p)
+		}
+		walkStatements(v, n.Body)
+	case *Parameter:
+		walkExpressions(v, n.Lengths)
+	case *TypeName:
+		walkExpressions(v, n.Lengths)
+
+	// Statements.
+	case *Block:
+		walkStatements(v, n.Statements)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *ReturnStatement:
+		walkExpression(v, n.Value)
+	case *IfStatement:
+		walkExpression(v, n.Cond)
+		walkStatement(v, n.Then)
+		walkStatement(v, n.Else)
+	case *WhileStatement:
+		walkExpression(v, n.Cond)
+		walkStatement(v, n.Body)
+	case *DoWhileStatement:
+		walkStatement(v, n.Body)
+		walkExpression(v, n.Cond)
+	case *ForStatement:
+		walkStatement(v, n.Init)
+		walkExpression(v, n.Cond)
+		walkExpression(v, n.Post)
+		walkStatement(v, n.Body)
+	case *SwitchStatement:
+		walkExpression(v, n.Value)
+		walkStatement(v, n.Body)
+	case *CaseStatement:
+		walkExpression(v, n.Value)
+		walkStatement(v, n.Body)
+	case *LabeledStatement:
+		walkStatement(v, n.Body)
+	case *BreakStatement, *ContinueStatement, *GotoStatement:
+
+	// Expressions.
+	case *Identifier, *IntLiteral, *FloatLiteral, *StringLiteral:
+	case *UnaryOp:
+		walkExpression(v, n.Operand)
+	case *BinaryOp:
+		walkExpression(v, n.Lhs)
+		walkExpression(v, n.Rhs)
+	case *Assignment:
+		walkExpression(v, n.Lhs)
+		walkExpression(v, n.Rhs)
+	case *CompoundAssignment:
+		walkExpression(v, n.Lhs)
+		walkExpression(v, n.Rhs)
+	case *IncDecOp:
+		walkExpression(v, n.Operand)
+	case *ConditionalExpression:
+		walkExpression(v, n.Cond)
+		walkExpression(v, n.Then)
+		walkExpression(v, n.Else)
+	case *Conversion:
+		if n.TypeName != nil {
+			Walk(v, n.TypeName)
+		}
+		walkExpression(v, n.Operand)
+	case *Call:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Args)
+	case *Subscript:
+		walkExpression(v, n.Array)
+		walkExpression(v, n.Index)
+	case *Member:
+		walkExpression(v, n.X)
+	case *Sizeof:
+		walkExpression(v, n.Operand)
+		if n.TypeName != nil {
+			Walk(v, n.TypeName)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+	v.Visit(nil)
+}
+
+func walkExpression(v Visitor, e Expression) {
+	if e != nil {
+		Walk(v, e)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		walkExpression(v, e)
+	}
+}
+
+func walkStatement(v Visitor, s Statement) {
+	if s != nil {
+		Walk(v, s)
+	}
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		walkStatement(v, s)
+	}
+}
+
+// An inspector is a Visitor which calls a function.
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a syntax tree in the order of Walk, calling f(node) for
+// each node. If f returns true, Inspect visits the children of the node, and
+// then calls f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite traverses a syntax tree in the order of Walk, but after the
+// children of each node rather than before them, and replaces each node with
+// the result of calling f on it, which is the node itself to keep it. The
+// rewritten tree is returned. An expression must be replaced by an
+// expression, a statement by a statement, or either by nil where the node is
+// optional, such as the else branch of an if statement. A statement or a
+// declaration in a list, such as the body of a function, is removed from it
+// if it is replaced by nil. A node of any other type may only be replaced by
+// a node of the same type.
+func Rewrite(node Node, f func(Node) Node) Node {
+	return (&rewriter{f}).node(node)
+}
+
+type rewriter struct {
+	f func(Node) Node
+}
+
+// node rewrites the children of a node, then the node itself.
+func (r *rewriter) node(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		enums := n.Enums[:0]
+		for _, e := range n.Enums {
+			if d := r.node(e); d != nil {
+				enums = append(enums, d.(*EnumDeclaration))
+			}
+		}
+		n.Enums = enums
+		typedefs := n.Typedefs[:0]
+		for _, t := range n.Typedefs {
+			if d := r.node(t); d != nil {
+				typedefs = append(typedefs, d.(*TypedefDeclaration))
+			}
+		}
+		n.Typedefs = typedefs
+		structs := n.Structs[:0]
+		for _, s := range n.Structs {
+			if d := r.node(s); d != nil {
+				structs = append(structs, d.(*StructDeclaration))
+			}
+		}
+		n.Structs = structs
+		globals := n.Globals[:0]
+		for _, g := range n.Globals {
+			if d := r.node(g); d != nil {
+				globals = append(globals, d.(*VariableDeclaration))
+			}
+		}
+		n.Globals = globals
+		functions := n.Functions[:0]
+		for _, f := range n.Functions {
+			if d := r.node(f); d != nil {
+				functions = append(functions, d.(*Function))
+			}
+		}
+		n.Functions = functions
+
+	// Declarations.
+	case *EnumDeclaration:
+		enumerators := n.Enumerators[:0]
+		for _, e := range n.Enumerators {
+			if d := r.node(e); d != nil {
+				enumerators = append(enumerators, d.(*Enumerator))
+			}
+		}
+		n.Enumerators = enumerators
+	case *Enumerator:
+		n.Value = r.expression(n.Value)
+	case *TypedefDeclaration:
+		r.expressions(n.Lengths)
+	case *StructDeclaration:
+		fields := n.Fields[:0]
+		for _, f := range n.Fields {
+			if d := r.node(f); d != nil {
+				fields = append(fields, d.(*Field))
+			}
+		}
+		n.Fields = fields
+	case *Field:
+		r.expressions(n.Lengths)
+	case *VariableDeclaration:
+		r.expressions(n.Lengths)
+		n.Init = r.expression(n.Init)
+	case *Function:
+		params := n.Params[:0]
+		for _, p := range n.Params {
+			if d := r.node(p); d != nil {
+				params = append(params, d.(*Parameter))
+			}
+		}
+		n.Params = params
+		n.Body = r.statements(n.Body)
+	case *Parameter:
+		r.expressions(n.Lengths)
+	case *TypeName:
+		r.expressions(n.Lengths)
+
+	// Statements.
+	case *Block:
+		n.Statements = r.statements(n.Statements)
+	case *ExpressionStatement:
+		n.Expression = r.expression(n.Expression)
+	case *ReturnStatement:
+		n.Value = r.expression(n.Value)
+	case *IfStatement:
+		n.Cond = r.expression(n.Cond)
+		n.Then = r.statement(n.Then)
+		n.Else = r.statement(n.Else)
+	case *WhileStatement:
+		n.Cond = r.expression(n.Cond)
+		n.Body = r.statement(n.Body)
+	case *DoWhileStatement:
+		n.Body = r.statement(n.Body)
+		n.Cond = r.expression(n.Cond)
+	case *ForStatement:
+		n.Init = r.statement(n.Init)
+		n.Cond = r.expression(n.Cond)
+		n.Post = r.expression(n.Post)
+		n.Body = r.statement(n.Body)
+	case *SwitchStatement:
+		n.Value = r.expression(n.Value)
+		n.Body = r.statement(n.Body)
+	case *CaseStatement:
+		n.Value = r.expression(n.Value)
+		n.Body = r.statement(n.Body)
+	case *LabeledStatement:
+		n.Body = r.statement(n.Body)
+	case *BreakStatement, *ContinueStatement, *GotoStatement:
+
+	// Expressions.
+	case *Identifier, *IntLiteral, *FloatLiteral, *StringLiteral:
+	case *UnaryOp:
+		n.Operand = r.expression(n.Operand)
+	case *BinaryOp:
+		n.Lhs = r.expression(n.Lhs)
+		n.Rhs = r.expression(n.Rhs)
+	case *Assignment:
+		n.Lhs = r.expression(n.Lhs)
+		n.Rhs = r.expression(n.Rhs)
+	case *CompoundAssignment:
+		n.Lhs = r.expression(n.Lhs)
+		n.Rhs = r.expression(n.Rhs)
+	case *IncDecOp:
+		n.Operand = r.expression(n.Operand)
+	case *ConditionalExpression:
+		n.Cond = r.expression(n.Cond)
+		n.Then = r.expression(n.Then)
+		n.Else = r.expression(n.Else)
+	case *Conversion:
+		if n.TypeName != nil {
+			n.TypeName = r.node(n.TypeName).(*TypeName)
+		}
+		n.Operand = r.expression(n.Operand)
+	case *Call:
+		n.Function = r.node(n.Function).(*Identifier)
+		r.expressions(n.Args)
+	case *Subscript:
+		n.Array = r.expression(n.Array)
+		n.Index = r.expression(n.Index)
+	case *Member:
+		n.X = r.expression(n.X)
+	case *Sizeof:
+		n.Operand = r.expression(n.Operand)
+		if n.TypeName != nil {
+			n.TypeName = r.node(n.TypeName).(*TypeName)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+	return r.f(node)
+}
+
+// expression rewrites an optional expression.
+func (r *rewriter) expression(e Expression) Expression {
+	if e == nil {
+		return nil
+	}
+	if n := r.node(e); n != nil {
+		return n.(Expression)
+	}
+	return nil
+}
+
+// expressions rewrites a list of expressions in place, each of which may be
+// nil, as an omitted length of an array is.
+func (r *rewriter) expressions(list []Expression) {
+	for i, e := range list {
+		list[i] = r.expression(e)
+	}
+}
+
+// statement rewrites an optional statement.
+func (r *rewriter) statement(s Statement) Statement {
+	if s == nil {
+		return nil
+	}
+	if n := r.node(s); n != nil {
+		return n.(Statement)
+	}
+	return nil
+}
+
+// statements rewrites a list of statements, removing those replaced by nil.
+func (r *rewriter) statements(list []Statement) []Statement {
+	result := list[:0]
+	for _, s := range list {
+		if s := r.statement(s); s != nil {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,195 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// nodes returns the types of the nodes under a node in the order in which
+// Inspect visits them, each indented by its depth.
+func nodes(node Node) []string {
+	var result []string
+	depth := 0
+	Inspect(node, func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		result = append(result, strings.Repeat(" ", depth)+strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+		depth++
+		return true
+	})
+	return result
+}
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: op(token.IdentifierToken, name)}
+}
+
+func TestInspect(t *testing.T) {
+	assert := assert.New(t)
+	f := function("f",
+		&VariableDeclaration{Name: op(token.IdentifierToken, "a"),
+			Lengths: []Expression{num(2)}},
+		&IfStatement{Cond: ident("b"),
+			Then: &ReturnStatement{Value: add(num(1), neg(ident("b")))}},
+		&ForStatement{Body: &BreakStatement{}},
+		&ExpressionStatement{Expression: &Call{Function: ident("f"),
+			Args: []Expression{&Conversion{TypeName: &TypeName{}, Operand: num(3)}}}})
+	f.Params = []*Parameter{{Name: op(token.IdentifierToken, "b"),
+		Lengths: []Expression{nil, num(4)}}}
+	assert.Equal([]string{
+		"Program",
+		" Function",
+		"  Parameter",
+		"   IntLiteral",
+		"  VariableDeclaration",
+		"   IntLiteral",
+		"  IfStatement",
+		"   Identifier",
+		"   ReturnStatement",
+		"    BinaryOp",
+		"     IntLiteral",
+		"     UnaryOp",
+		"      Identifier",
+		"  ForStatement",
+		"   BreakStatement",
+		"  ExpressionStatement",
+		"   Call",
+		"    Identifier",
+		"    Conversion",
+		"     TypeName",
+		"     IntLiteral",
+	}, nodes(&Program{Functions: []*Function{f}}))
+}
+
+func TestInspectProgramDeclarations(t *testing.T) {
+	assert := assert.New(t)
+	p := &Program{
+		Enums: []*EnumDeclaration{{Enumerators: []*Enumerator{
+			{Name: op(token.IdentifierToken, "A")},
+			{Name: op(token.IdentifierToken, "B"), Value: num(1)},
+		}}},
+		Typedefs: []*TypedefDeclaration{{}},
+		Structs: []*StructDeclaration{{Fields: []*Field{
+			{Lengths: []Expression{num(3)}},
+		}}},
+		Globals: []*VariableDeclaration{{Init: num(2)}},
+	}
+	assert.Equal([]string{
+		"Program",
+		" EnumDeclaration",
+		"  Enumerator",
+		"  Enumerator",
+		"   IntLiteral",
+		" TypedefDeclaration",
+		" StructDeclaration",
+		"  Field",
+		"   IntLiteral",
+		" VariableDeclaration",
+		"  IntLiteral",
+	}, nodes(p))
+}
+
+func TestInspectStopsAtFalse(t *testing.T) {
+	assert := assert.New(t)
+	var visited []string
+	Inspect(add(add(num(1), num(2)), mul(num(3), num(4))), func(n Node) bool {
+		if n != nil {
+			visited = append(visited, Format(n))
+		}
+		_, isMul := n.(*BinaryOp)
+		return !isMul || n.(*BinaryOp).Operator.Type != token.MultiplicationToken
+	})
+	assert.Equal([]string{"1 + 2 + 3 * 4", "1 + 2", "1", "2", "3 * 4"}, visited)
+}
+
+// A visitor which counts the nodes it visits, and the calls to it which end
+// their children.
+type counter struct {
+	nodes, ends int
+}
+
+func (c *counter) Visit(n Node) Visitor {
+	if n == nil {
+		c.ends++
+	} else {
+		c.nodes++
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	assert := assert.New(t)
+	c := &counter{}
+	Walk(c, &WhileStatement{Cond: num(1), Body: &Block{Statements: []Statement{
+		&ContinueStatement{},
+		&SwitchStatement{Value: ident("x"), Body: &CaseStatement{Value: num(2),
+			Body: &LabeledStatement{Body: &GotoStatement{}}}},
+	}}})
+	assert.Equal(10, c.nodes)
+	assert.Equal(10, c.ends)
+}
+
+func TestRewrite(t *testing.T) {
+	assert := assert.New(t)
+	f := function("f",
+		&ExpressionStatement{Expression: &Assignment{Operator: op(token.AssignmentToken, "="),
+			Lhs: ident("a"), Rhs: add(num(1), num(2))}},
+		&IfStatement{Cond: ident("a"), Then: &ReturnStatement{Value: num(1)},
+			Else: &ReturnStatement{Value: num(2)}},
+		&ReturnStatement{Value: neg(num(1))})
+	// Scale literals, then fold additions of them, and remove the returns
+	// of the scaled 2.
+	result := Rewrite(f, func(n Node) Node {
+		switch n := n.(type) {
+		case *BinaryOp:
+			return num(n.Lhs.(*IntLiteral).Value + n.Rhs.(*IntLiteral).Value)
+		case *IntLiteral:
+			return num(n.Value * 10)
+		case *ReturnStatement:
+			if v, ok := n.Value.(*IntLiteral); ok && v.Value == 20 {
+				return nil
+			}
+		}
+		return n
+	})
+	assert.Equal(f, result)
+	assert.Equal(`int f() {
+    a = 30;
+    if (a)
+        return 10;
+    return -10;
+}
+`, Format(f))
+}
+
+func TestRewriteRemovesDeclarations(t *testing.T) {
+	assert := assert.New(t)
+	p := &Program{Functions: []*Function{function("f"), function("g"), function("h")}}
+	Rewrite(p, func(n Node) Node {
+		if f, ok := n.(*Function); ok && f.Name.Value == "g" {
+			return nil
+		}
+		return n
+	})
+	assert.Equal(2, len(p.Functions))
+	assert.Equal("h", p.Functions[1].Name.Value)
+}
+
+func TestRewritePanicsOnWrongType(t *testing.T) {
+	assert := assert.New(t)
+	assert.Panics(func() {
+		Rewrite(&ReturnStatement{Value: num(1)}, func(n Node) Node {
+			if _, ok := n.(*IntLiteral); ok {
+				return &Block{}
+			}
+			return n
+		})
+	})
+	// A missing expression is left to the caller.
+	assert.Nil(Rewrite(num(1), func(Node) Node { return nil }))
+}
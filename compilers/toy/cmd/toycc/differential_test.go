@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/gen"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+var randomPrograms = flag.Int("random-programs", 20,
+	"The number of random programs which TestDifferential compares.")
+
+// The flags with which TestDifferential compiles each program.
+var differentialFlags = [][]string{nil, {"-O=1"}, {"-O=2"}}
+
+// differ compares the exit status and output of a program run by the
+// interpreter with those of the program compiled with each of
+// differentialFlags, reporting where they differ.
+func differ(t *testing.T, dir, name, input string) {
+	status, stdout := interpret(t, name, input)
+	for _, flags := range differentialFlags {
+		compiledStatus, compiledStdout := executeLinked(t, dir, input, flags...)
+		if compiledStatus != status || compiledStdout != stdout {
+			t.Errorf("the interpreter exits with status %d and output %q, but the "+
+				"program compiled with flags %v exits with status %d and output %q:\n%s",
+				status, stdout, flags, compiledStatus, compiledStdout, input)
+		}
+	}
+}
+
+// TestDifferential checks that each program behaves the same when
+// interpreted and when compiled, with and without optimizations: the
+// execution tests and the programs in testdata, and then as many random
+// programs of package gen as the -random-programs flag gives, unless the
+// tests are short. It is skipped if the programs cannot be linked and run on
+// this machine.
+func TestDifferential(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("generated code is for x86-64 Linux")
+	}
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("cc is required to link")
+	}
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range allExecutionTests(t) {
+		t.Run(test.name, func(t *testing.T) {
+			differ(t, dir, test.name, test.input)
+		})
+	}
+	if testing.Short() {
+		return
+	}
+	for seed := int64(1); seed <= int64(*randomPrograms); seed++ {
+		name := fmt.Sprintf("random_%d", seed)
+		t.Run(name, func(t *testing.T) {
+			differ(t, dir, name, gen.Generate(rand.New(rand.NewSource(seed))))
+		})
+	}
+}
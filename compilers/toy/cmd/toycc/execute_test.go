@@ -0,0 +1,799 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/interp"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/preprocessor"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// A program which is compiled, assembled, linked and run, with its expected
+// exit status and output.
+type executionTest struct {
+	name   string
+	input  string
+	status int
+	stdout string
+}
+
+var executionTests = []executionTest{
+	{"return", "int main() { return 42; }", 42, ""},
+	// Exit statuses are truncated to a byte.
+	{"negative_status", "int main() { return -1; }", 255, ""},
+	{"putchar", `int putchar(int c);
+int main() {
+  for (int c = 97; c <= 101; c++)
+    putchar(c);
+  putchar(10);
+  return 0;
+}`, 0, "abcde\n"},
+	{"short_circuit", `int putchar(int c);
+int say(int c) { putchar(c); return c; }
+int main() {
+  int a = 0 && say(120);
+  a = a || say(121);
+  a = a && say(122) > 0;
+  return a + (say(33) == 33);
+}`, 2, "yz!"},
+	{"recursion", `int fact(int n) { return n <= 1 ? 1 : n * fact(n - 1); }
+int main() { return fact(5); }`, 120, ""},
+	{"tail_calls", `int odd(int n);
+int even(int n) { if (n == 0) return 1; return odd(n - 1); }
+int odd(int n) { if (n == 0) return 0; return even(n - 1); }
+double halve(double x, int n) { if (n == 0) return x; return halve(x / 2, n - 1); }
+int main() { return even(1001) + halve(96.0, 3); }`, 12, ""},
+	{"stack_arguments", `int f(int a, int b, int c, int d, int e, int f, int g, int h) {
+  return a - b + c - d + e - f + g * h;
+}
+int main() { return f(1, 2, 3, 4, 5, 6, 7, 8); }`, 53, ""},
+	{"floating_point", `double g(double a, float b, int c, double d, double e,
+                      double f, double h, double i, double j, double k) {
+  return a + b + c + d + e + f + h + i + j * k;
+}
+int main() { return g(1, 2, 3, 4, 5, 6, 7, 8, 9, 10); }`, 126, ""},
+	{"division", `int main() {
+  int a = -7;
+  return (a / 2 == -3) + (a % 2 == -1) * 2 + (a >> 1 == -4) * 4;
+}`, 7, ""},
+	{"compound_assignment", `int main() {
+  int a = 1;
+  a += 2; a *= 10; a -= 5; a /= 5; a %= 4; a <<= 3; a |= 5; a ^= 1; a &= 12;
+  return a;
+}`, 12, ""},
+	{"nested_loops", `int main() {
+  int n = 0;
+  for (int i = 0; i < 10; i++)
+    for (int j = 0; j < 10; j++) {
+      if (j > i)
+        break;
+      n++;
+    }
+  return n;
+}`, 55, ""},
+	{"pointer_arguments", `int sum(int *a, int *b, int *c, int *d, int *e, int *f, int *g, int *h, int *i) {
+  *i = *a + *b + *c + *d + *e + *f + *g + *h;
+  return *i;
+}
+int main() {
+  int a = 1; int b = 2; int c = 3; int d = 4; int e = 5;
+  int f = 6; int g = 7; int h = 8; int i;
+  return sum(&a, &b, &c, &d, &e, &f, &g, &h, &i) + i;
+}`, 72, ""},
+	{"pointer_arithmetic", `int putchar(int c);
+double half(double *d) { return *d / 2; }
+int main() {
+  double d = 3;
+  double *p = &d;
+  double *q = p + 1;
+  int n = q - p;
+  q--;
+  n += (q == p) + (p < p + 1) + (p + 1 >= q);
+  p += 0;
+  *p += half(p);
+  putchar(48 + n);
+  return *q * 2 + (p ? 1 : 0) + !p;
+}`, 10, "4"},
+	{"arrays", `int putchar(int c);
+int main() {
+  int x = 1;
+  int y = 2;
+  int *ps[2];
+  ps[0] = &x;
+  ps[1] = &y;
+  *ps[1] += 5;
+  int s[3];
+  s[0] = 104;
+  s[1] = s[0] + 1;
+  s[2] = 10;
+  for (int *p = s; p < s + 3; p++)
+    putchar(*p);
+  return *ps[0] * 10 + y + (ps[1] != ps[0]);
+}`, 18, "hi\n"},
+	{"sizeof", `int putchar(int c);
+struct point { char tag; double x; int y; };
+int sum(int *a, int n) { int s = 0; for (int i = 0; i < n; i++) s += a[i]; return s; }
+int main() {
+  int a[7];
+  int n = sizeof a / sizeof a[0];
+  for (int i = 0; i < n; i++)
+    a[i] = i;
+  struct point ps[3];
+  putchar('0' + sizeof(struct point) / 8);
+  putchar('0' + sizeof ps[0].tag + sizeof(ps[n++].x));
+  return sum(a, n) + sizeof ps / sizeof(struct point) + sizeof(char *) + n;
+}`, 39, "39"},
+	{"casts", `int putchar(int c);
+int main() {
+  int x = 300 + 'A';
+  double d = 7.9;
+  char s[3];
+  char *p = (char *)(int *)s;
+  p[0] = (char)x;
+  p[1] = (char)-(int)-1.5 + '0';
+  s[2] = 0;
+  for (int i = 0; s[i]; i++)
+    putchar(s[i]);
+  return (int)d + (int)((double)x / 7) + (char)200 + (p == (char *)0);
+}`, 3, "m1"},
+	{"typedefs", `typedef int T;
+typedef T *P;
+typedef char Name[4];
+typedef struct pair Pair;
+struct pair { T a; T b; };
+int putchar(int c);
+T first(Name n) { return n[0]; }
+int main() {
+  Name n;
+  n[0] = 'o'; n[1] = 'k'; n[2] = 0;
+  for (T i = 0; i < 2; i++)
+    putchar(first(n + i));
+  Pair pr;
+  pr.a = sizeof(Name);
+  T * x = &pr.b;
+  *x = 5;
+  return pr.a * pr.b;
+}`, 20, "ok"},
+	{"goto", `int putchar(int c);
+int main() {
+  int i = 0;
+  int n = 0;
+again:
+  n = n + i;
+  i++;
+  if (i < 5)
+    goto again;
+  for (int j = 0; j < 3; j++) {
+    if (j == 1)
+      goto next;
+    putchar('a' + j);
+  next:
+    n++;
+  }
+  {
+    int k = 7;
+    goto inside;
+  }
+  while (0) {
+  inside:
+    n = n + 1;
+  }
+  switch (n) {
+    int m;
+  case 14:
+    m = 2;
+    goto out;
+  default:
+    m = 0;
+  out:
+    return n * m;
+  }
+}`, 28, "ac"},
+	{"strings", `int printf(char *format, ...);
+int puts(char *s);
+int length(char *s) { int n = 0; while (s[n]) n++; return n; }
+int main() {
+  char *s = "hello";
+  char c = 'a' + 200;
+  puts(s);
+  printf("%s, %d%c %5.2f|%-3x|\\%03o\n", "world", length(s), c, 2.5f, 255, 8);
+  return (s == "hello") + length("tab\tand" "\"quote\"");
+}`, 15, "hello\nworld, 5)  2.50|ff |\\010\n"},
+	{"macros", `#define SQUARE(x) ((x) * (x))
+#define MAX(a, b) ((a) > (b) ? (a) : (b))
+#define STR(x) #x
+#define CAT(a, b) a ## b
+#define DEBUG 0
+
+int puts(char *s);
+int CAT(add, 1)(int n) { return n + 1; }
+
+int main() {
+#if DEBUG
+  puts("debug");
+#elif defined(SQUARE) && !defined(CUBE)
+  puts(STR(SQUARE(2)));
+#endif
+  int line = __LINE__;
+  return MAX(SQUARE(3), add1(2)) + line;
+}`, 25, "SQUARE(2)\n"},
+	{"unsigned", `int printf(char *format, ...);
+unsigned g = -1;
+unsigned hash(char *s) {
+  unsigned h = 2166136261u;
+  while (*s)
+    h = (h ^ *s++) * 16777619;
+  return h;
+}
+int main() {
+  unsigned a = 7;
+  unsigned big = 3000000000u;
+  int fields[4];
+  fields[a & 3] = 1;
+  double d = big;
+  printf("%u %u %u %x %u\n", g / 2, big % 7, big >> 28, hash("toy"), (unsigned)d);
+  return (a > -1) + (g > a) * 2 + fields[3] * 4 + (d > 0) * 8;
+}`, 14, "2147483647 4 11 b010ea67 3000000000\n"},
+	{"integer widths", `int printf(char *format, ...);
+long big = 4294967296;
+short narrow = -2;
+unsigned long mask = -1;
+struct s { char c; long l; short h; };
+long fib(int n) {
+  long a = 0;
+  long b = 1;
+  while (n--) {
+    long t = a + b;
+    a = b;
+    b = t;
+  }
+  return a;
+}
+int main() {
+  short s = 40000;
+  unsigned short u = -1;
+  unsigned char c = 300;
+  signed char d = 200;
+  long l = 2147483647L + 1;
+  unsigned long h = mask / 3;
+  short a[4];
+  a[1] = 70000;
+  double f = h;
+  printf("%d %d %d %d %ld %lu %lx %d\n", s, u, c, d, l, h, mask >> 4, a[1]);
+  printf("%ld %ld %d %lu %d\n", fib(90), big * 3 / 2, narrow, (unsigned long)f,
+         (int)(sizeof(struct s) + sizeof(long) + sizeof 1L + sizeof(short)));
+  switch (l) {
+  case 2147483648:
+    return (l >> 31) + (u > s) * 2 + (-1L < 0u) * 4 + (-1 < 0ul) * 8;
+  }
+  return 0;
+}`, 7, "-25536 65535 44 -56 2147483648 6148914691236517205 fffffffffffffff 4464\n" +
+		"2880067194370816120 6442450944 -2 6148914691236516864 42\n"},
+	{"truncation", `int printf(char *format, ...);
+long f(long l) {
+  unsigned int u = (unsigned int)(int)l;
+  long r = u;
+  return r;
+}
+int main() {
+  printf("%ld\n", f(-4294967296L + 5));
+  return 0;
+}`, 0, "5\n"},
+}
+
+// The exit statuses of the programs in testdata.
+var testdataStatuses = map[string]int{
+	"arrays.c":      61,
+	"enums.c":       27,
+	"expressions.c": 4,
+	"functions.c":   58,
+	"globals.c":     36,
+	"goto.c":        20,
+	"loops.c":       23,
+	"pointers.c":    37,
+	"return.c":      2,
+	"structs.c":     41,
+	"switch.c":      36,
+}
+
+// allExecutionTests returns the execution tests and the programs in testdata.
+func allExecutionTests(t *testing.T) []executionTest {
+	tests := append([]executionTest{}, executionTests...)
+	for name, status := range testdataStatuses {
+		input, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests, executionTest{name, string(input), status, ""})
+	}
+	return tests
+}
+
+// interpret runs a program in the interpreter, returning its exit status,
+// truncated to a byte as that of a process is, and its output.
+func interpret(t *testing.T, name, input string) (int, string) {
+	preprocessed, err := preprocessor.Preprocess(name, []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(preprocessed.Text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	status, err := interp.Eval(program, new(bytes.Buffer), &stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status & 0xff, stdout.String()
+}
+
+// TestInterpret checks that the interpreter gives each program the exit status
+// and output that it has when compiled, so that the two can be compared.
+func TestInterpret(t *testing.T) {
+	for _, test := range allExecutionTests(t) {
+		t.Run(test.name, func(t *testing.T) {
+			status, stdout := interpret(t, test.name, test.input)
+			assert.Equal(t, test.status, status)
+			assert.Equal(t, test.stdout, stdout)
+		})
+	}
+}
+
+// execute compiles a program with the given flags, then assembles, links and
+// runs it, returning its exit status and output.
+func execute(t *testing.T, dir, input string, flags ...string) (int, string) {
+	asm := filepath.Join(dir, "a.s")
+	bin := filepath.Join(dir, "a.out")
+	status, _, stderr := toycc(input, append(flags, "-S", "-o", asm, "-")...)
+	if status != exitSuccess {
+		t.Fatalf("toycc exited with status %d:\n%s", status, stderr)
+	}
+	if out, err := exec.Command("gcc", "-o", bin, asm).CombinedOutput(); err != nil {
+		t.Fatalf("gcc failed: %v\n%s", err, out)
+	}
+	return runBinary(t, bin)
+}
+
+// executeLinked compiles a program to an executable with the given flags,
+// assembling it with the internal assembler and linking it with cc, then runs
+// it, returning its exit status and output.
+func executeLinked(t *testing.T, dir, input string, flags ...string) (int, string) {
+	bin := filepath.Join(dir, "a.out")
+	status, _, stderr := toycc(input, append(flags, "-o", bin, "-")...)
+	if status != exitSuccess {
+		t.Fatalf("toycc exited with status %d:\n%s", status, stderr)
+	}
+	return runBinary(t, bin)
+}
+
+// runBinary runs an executable, returning its exit status and output.
+func runBinary(t *testing.T, bin string) (int, string) {
+	var stdout bytes.Buffer
+	cmd := exec.Command(bin)
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), stdout.String()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return 0, stdout.String()
+}
+
+// TestExecute runs each program with and without optimizations and register
+// allocation, and written in Intel syntax. It is skipped if the programs
+// cannot be assembled and run on this machine.
+func TestExecute(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("generated code is for x86-64 Linux")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc is required to assemble and link")
+	}
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := allExecutionTests(t)
+
+	for _, flags := range [][]string{nil, {"-O"}, {"-O=2"}, {"--no-regalloc"}, {"--sanitize=stack"},
+		{"--no-tail-calls"}, {"--masm=intel"}, {"-O=2", "--masm=intel"}} {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				status, stdout := execute(t, dir, test.input, flags...)
+				assert.Equal(t, test.status, status, "flags: %v", flags)
+				assert.Equal(t, test.stdout, stdout, "flags: %v", flags)
+			})
+		}
+	}
+}
+
+// TestExecuteInternalAssembler runs each program assembled by the internal
+// assembler, with and without optimizations and register allocation. It is
+// skipped if the programs cannot be linked and run on this machine.
+func TestExecuteInternalAssembler(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("generated code is for x86-64 Linux")
+	}
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("cc is required to link")
+	}
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := allExecutionTests(t)
+
+	for _, flags := range [][]string{nil, {"-O=2"}, {"--no-regalloc"}, {"--sanitize=stack"}} {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				status, stdout := executeLinked(t, dir, test.input, flags...)
+				assert.Equal(t, test.status, status, "flags: %v", flags)
+				assert.Equal(t, test.stdout, stdout, "flags: %v", flags)
+			})
+		}
+	}
+}
+
+// TestExecuteStackSanitizer checks that a program which writes past the end
+// of a local array is aborted if the stack is sanitized.
+func TestExecuteStackSanitizer(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("generated code is for x86-64 Linux")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc is required to assemble and link")
+	}
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := `int fill(int n) {
+  int a[2];
+  for (int i = 0; i < n; i++)
+    a[i] = 7;
+  return a[0];
+}
+int main() { return fill(2) + fill(%d); }`
+	status, _ := execute(t, dir, fmt.Sprintf(input, 2), "--sanitize=stack")
+	assert.Equal(t, 14, status)
+	// The program is killed by SIGABRT.
+	status, _ = execute(t, dir, fmt.Sprintf(input, 5), "--sanitize=stack")
+	assert.Equal(t, -1, status)
+}
+
+// TestExecuteOverflowTrap checks that a program whose int arithmetic
+// overflows is killed if overflow is trapped, even if the arithmetic is
+// constant once optimized, and that it wraps around otherwise.
+func TestExecuteOverflowTrap(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("generated code is for x86-64 Linux")
+	}
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("cc is required to link")
+	}
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := `int twice(int n) { return n * 2; }
+int main() { return twice(%d) == 0 ? 3 : 4; }`
+	for _, flags := range [][]string{{"-foverflow=trap"}, {"-foverflow=trap", "-O=2"}} {
+		status, _ := executeLinked(t, dir, fmt.Sprintf(input, 1<<29), flags...)
+		assert.Equal(t, 4, status, "flags: %v", flags)
+		// The program is killed by SIGILL.
+		status, _ = executeLinked(t, dir, fmt.Sprintf(input, 1<<31-1), flags...)
+		assert.Equal(t, -1, status, "flags: %v", flags)
+	}
+	status, _ := executeLinked(t, dir, fmt.Sprintf(input, 1<<31-1), "-O=2")
+	assert.Equal(t, 4, status)
+	status, _ = execute(t, dir, fmt.Sprintf(input, -1<<30-1), "-foverflow=trap")
+	assert.Equal(t, -1, status)
+}
+
+// TestLink checks that toycc assembles and links programs of one or more
+// files, and stops at object files with -c.
+func TestLink(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("generated code is for x86-64 Linux")
+	}
+	for _, tool := range []string{"as", "cc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is required to assemble and link", tool)
+		}
+	}
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "main.c")
+	triple := filepath.Join(dir, "triple.c")
+	for name, source := range map[string]string{
+		main:   "int triple(int x);\nint main() { return triple(2); }\n",
+		triple: "int triple(int x) { return x * 3; }\n",
+	} {
+		if err := ioutil.WriteFile(name, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(bin string) int {
+		err := exec.Command(bin).Run()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		assert.NoError(err)
+		return 0
+	}
+
+	bin := filepath.Join(dir, "a.out")
+	status, _, stderr := toycc("", "-o", bin, main, triple)
+	assert.Equal(exitSuccess, status, stderr)
+	assert.Equal(6, run(bin))
+
+	status, _, stderr = toycc("", "-c", main, triple)
+	assert.Equal(exitSuccess, status, stderr)
+	object, err := ioutil.ReadFile(filepath.Join(dir, "triple.o"))
+	assert.NoError(err)
+	assert.True(bytes.HasPrefix(object, []byte("\x7fELF")))
+	bin = filepath.Join(dir, "b.out")
+	status, _, stderr = toycc("int main() { return 4; }", "-o", bin, "-")
+	assert.Equal(exitSuccess, status, stderr)
+	assert.Equal(4, run(bin))
+
+	// The linker reports undefined functions.
+	status, _, stderr = toycc("", "-o", bin, main)
+	assert.Equal(exitFailure, status)
+	assert.Contains(stderr, "triple")
+	assert.Contains(stderr, "toycc: cc: exit status 1\n")
+
+	// An external assembler may be used instead of the internal one.
+	bin = filepath.Join(dir, "c.out")
+	status, _, stderr = toycc("", "--assembler=as", "-o", bin, main, triple)
+	assert.Equal(exitSuccess, status, stderr)
+	assert.Equal(6, run(bin))
+
+	status, _, stderr = toycc("", "--assembler=/no/such/as", "-c", main)
+	assert.Equal(exitFailure, status)
+	assert.Contains(stderr, "toycc: /no/such/as: ")
+	_, err = os.Stat(filepath.Join(dir, "main.o"))
+	assert.True(os.IsNotExist(err))
+}
+
+// TestLinkShared checks that position-independent code may be linked into a
+// shared object, by both the internal assembler and an external one, and
+// that a program which is linked with it runs.
+// TestLinkExtern checks that files share the global variables which they
+// declare extern, and that each has its own static functions and variables,
+// even of the same names.
+func TestLinkExtern(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("generated code is for x86-64 Linux")
+	}
+	for _, tool := range []string{"as", "cc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is required to assemble and link", tool)
+		}
+	}
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "main.c")
+	count := filepath.Join(dir, "count.c")
+	for name, source := range map[string]string{
+		main: "extern int total;\nint add(int x);\nstatic int step = 2;\n" +
+			"static int helper(int x) { return x * step; }\n" +
+			"int main() { add(helper(3)); add(4); return total + helper(1); }\n",
+		count: "int total = 1;\nstatic int step = 10;\n" +
+			"static int helper(int x) { return x + step; }\n" +
+			"int add(int x) { total = total + helper(x); return total; }\n",
+	} {
+		if err := ioutil.WriteFile(name, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, flags := range [][]string{nil, {"-fPIC"}, {"--assembler=as"}, {"-O"}} {
+		bin := filepath.Join(dir, "a.out")
+		status, _, stderr := toycc("", append(flags, "-o", bin, main, count)...)
+		assert.Equal(exitSuccess, status, stderr)
+		err := exec.Command(bin).Run()
+		exitErr, ok := err.(*exec.ExitError)
+		if assert.True(ok, "%v", err) {
+			// 1 + (6 + 10) + (4 + 10) + 1 * 2
+			assert.Equal(33, exitErr.ExitCode(), flags)
+		}
+	}
+
+	// The linker reports an extern variable which no file defines.
+	status, _, stderr := toycc("", "-o", filepath.Join(dir, "b.out"), main)
+	assert.Equal(exitFailure, status)
+	assert.Contains(stderr, "total")
+}
+
+func TestLinkShared(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("generated code is for x86-64 Linux")
+	}
+	for _, tool := range []string{"as", "cc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is required to assemble and link", tool)
+		}
+	}
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "main.c")
+	count := filepath.Join(dir, "count.c")
+	for name, source := range map[string]string{
+		main: "int twice(int x);\nint main() { return twice(2); }\n",
+		count: "int count = 3;\nint add(int x) { count = count + x; return count; }\n" +
+			"int twice(int x) { return add(x) + add(0); }\n",
+	} {
+		if err := ioutil.WriteFile(name, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status, _, stderr := toycc("", "-c", "-o", filepath.Join(dir, "main.o"), main)
+	assert.Equal(exitSuccess, status, stderr)
+
+	for _, assembler := range []string{"", "as"} {
+		object := filepath.Join(dir, "count.o")
+		status, _, stderr := toycc("", "-c", "-fPIC", "--assembler="+assembler, "-o", object, count)
+		assert.Equal(exitSuccess, status, stderr)
+		lib := filepath.Join(dir, "libcount.so")
+		out, err := exec.Command("cc", "-shared", "-o", lib, object).CombinedOutput()
+		assert.NoError(err, string(out))
+		bin := filepath.Join(dir, "a.out")
+		out, err = exec.Command("cc", "-o", bin, filepath.Join(dir, "main.o"), lib).CombinedOutput()
+		assert.NoError(err, string(out))
+		err = exec.Command(bin).Run()
+		exitErr, ok := err.(*exec.ExitError)
+		if assert.True(ok, "%v", err) {
+			assert.Equal(10, exitErr.ExitCode(), assembler)
+		}
+	}
+}
+
+// TestAssembleArm64 checks that the AArch64 assembly of each program is
+// accepted by the LLVM assembler, since it cannot be run on this machine. It
+// is skipped if llvm-mc is not installed.
+func TestAssembleArm64(t *testing.T) {
+	if _, err := exec.LookPath("llvm-mc"); err != nil {
+		t.Skip("llvm-mc is required to assemble")
+	}
+	tests := allExecutionTests(t)
+
+	for _, flags := range [][]string{nil, {"-O"}} {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				status, stdout, stderr := toycc(test.input,
+					append(flags, "--target=arm64", "-")...)
+				if status != exitSuccess {
+					t.Fatalf("toycc exited with status %d:\n%s", status, stderr)
+				}
+				cmd := exec.Command("llvm-mc", "-triple=aarch64-linux-gnu",
+					"-filetype=obj", "-o", os.DevNull)
+				cmd.Stdin = bytes.NewBufferString(stdout)
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Errorf("llvm-mc failed with flags %v: %v\n%s", flags, err, out)
+				}
+			})
+		}
+	}
+}
+
+// TestAssembleWasm checks that the WebAssembly text format of each program is
+// accepted by wat2wasm, from the WebAssembly Binary Toolkit. It is skipped if
+// wat2wasm is not installed.
+func TestAssembleWasm(t *testing.T) {
+	if _, err := exec.LookPath("wat2wasm"); err != nil {
+		t.Skip("wat2wasm is required to assemble")
+	}
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := allExecutionTests(t)
+
+	for _, flags := range [][]string{nil, {"-O"}} {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if strings.Contains(test.input, "...") {
+					t.Skip("variadic functions are not supported by the wasm32 target")
+				}
+				wat := filepath.Join(dir, "a.wat")
+				status, _, stderr := toycc(test.input,
+					append(flags, "--target=wasm32", "-o", wat, "-")...)
+				if status != exitSuccess {
+					t.Fatalf("toycc exited with status %d:\n%s", status, stderr)
+				}
+				out, err := exec.Command("wat2wasm", "-o", os.DevNull, wat).CombinedOutput()
+				if err != nil {
+					t.Errorf("wat2wasm failed with flags %v: %v\n%s", flags, err, out)
+				}
+			})
+		}
+	}
+}
+
+// TestLLVM checks that the LLVM IR of each program is accepted by llvm-as,
+// and if lli is installed, that it runs with the expected exit status and
+// output. It is skipped if llvm-as is not installed.
+func TestLLVM(t *testing.T) {
+	if _, err := exec.LookPath("llvm-as"); err != nil {
+		t.Skip("llvm-as is required to assemble")
+	}
+	_, err := exec.LookPath("lli")
+	run := err == nil
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := allExecutionTests(t)
+
+	for _, flags := range [][]string{nil, {"-O"}} {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				ll := filepath.Join(dir, "a.ll")
+				status, _, stderr := toycc(test.input,
+					append(flags, "--emit=llvm", "-o", ll, "-")...)
+				if status != exitSuccess {
+					t.Fatalf("toycc exited with status %d:\n%s", status, stderr)
+				}
+				out, err := exec.Command("llvm-as", "-o", os.DevNull, ll).CombinedOutput()
+				if err != nil {
+					t.Fatalf("llvm-as failed with flags %v: %v\n%s", flags, err, out)
+				}
+				if !run {
+					return
+				}
+				var stdout bytes.Buffer
+				cmd := exec.Command("lli", ll)
+				cmd.Stdout = &stdout
+				status = 0
+				if err := cmd.Run(); err != nil {
+					exitErr, ok := err.(*exec.ExitError)
+					if !ok {
+						t.Fatal(err)
+					}
+					status = exitErr.ExitCode()
+				}
+				assert.Equal(t, test.status, status, "flags: %v", flags)
+				assert.Equal(t, test.stdout, stdout.String(), "flags: %v", flags)
+			})
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false,
+	"Regenerate the golden files of the programs in testdata.")
+
+// The stages of the compiler which are compared against golden files: the
+// extension of each golden file, and the flags which print the stage.
+var goldenStages = []struct {
+	ext  string
+	args []string
+}{
+	{".tokens", []string{"--dump-tokens"}},
+	{".ast", []string{"--dump-ast"}},
+	{".ir", []string{"--dump-ir"}},
+	{".opt.ir", []string{"-O=2", "--dump-ir"}},
+	{".s", nil},
+}
+
+// TestGolden compiles each program in testdata, and compares the output of
+// each stage against the golden file next to it. Run with -update to
+// regenerate the golden files after an intentional change.
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+	for _, input := range inputs {
+		source, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, stage := range goldenStages {
+			golden := strings.TrimSuffix(input, ".c") + stage.ext
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				status, stdout, stderr := toycc(string(source),
+					append(stage.args, "-o", "-", "-")...)
+				if status != exitSuccess {
+					t.Fatalf("toycc exited with status %d:\n%s", status, stderr)
+				}
+				if *update {
+					if err := ioutil.WriteFile(golden, []byte(stdout), 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%v; run with -update to create it", err)
+				}
+				assert.Equal(t, string(want), stdout)
+			})
+		}
+	}
+}
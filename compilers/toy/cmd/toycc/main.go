@@ -0,0 +1,1082 @@
+// toycc compiles toy language source files to x86-64 or AArch64 executables,
+// object files or assembly, or to WebAssembly text format. With --emit=llvm,
+// it writes LLVM IR instead.
+//
+// Usage:
+//
+//	toycc [flags] file.c... [-o a.out]
+//	toycc -c [flags] file.c...
+//	toycc -S [flags] file.c... [-o file.s]
+//
+// As with cc, the files are compiled, assembled and linked into an
+// executable, a.out by default. With -c, each file is assembled to an object
+// file next to it with a .o extension, and with -S, it is compiled to
+// assembly next to it with a .s extension. x86-64 code is assembled by the
+// internal assembler, which writes ELF object files, or Mach-O ones for
+// macOS, unless the --assembler flag gives an external one, and other code, or
+// code with debug information or in Intel syntax, is assembled by "as". The
+// linker is that of the --linker flag, by default "cc", since the linker links
+// the C runtime. WebAssembly and LLVM IR are always written as text, next to
+// the input with a .wat or .ll extension.
+//
+// Each file is compiled separately. A function which it declares but does not
+// define, or a global variable which it declares extern without defining it,
+// must be defined by another file, and those which are static are not visible
+// to other files, so that files may define static ones of the same name.
+//
+// The --masm=intel flag writes x86-64 assembly in the Intel syntax of the
+// Intel manuals, rather than AT&T syntax. With -fPIC, the code is
+// position-independent, so that its object files may be linked into a shared
+// object by "cc -shared".
+//
+// Signed overflow of ints is undefined behavior in C, and -foverflow chooses
+// what becomes of it: with wrap, the default, arithmetic wraps around in two's
+// complement; with trap, x86-64 code checks the overflow flag after each
+// addition, subtraction, multiplication and negation, and executes ud2 if it
+// is set, so that the program is killed by SIGILL, and the optimizer leaves
+// constant arithmetic which overflows to trap at run time; with warn, it
+// wraps, but a warning is reported for each constant expression whose
+// arithmetic overflows, as with -Woverflow.
+//
+// The --target flag selects a target of package target by name, such as
+// x86_64-linux or arm64-darwin, or by architecture, such as x86-64, arm64 or
+// wasm32, for the operating system of the host. Code for macOS follows the
+// conventions of its assembler and linker, and cannot have debug information.
+//
+// A file name of "-" reads from standard input or writes to standard output.
+// The output of standard input is standard output by default, which is
+// always written as text, as with -S.
+//
+// Several files are compiled at once, by as many workers as the -j flag
+// gives. Their diagnostics, and their output if it is written to standard
+// output, are written in the order of the files, as though they were compiled
+// one after another. The exit status is that of the first file which fails to
+// compile.
+//
+// The source file is preprocessed first. Included files are searched for in
+// the directories of -I flags, as in "toycc -Iinclude a.c". A file with a .i
+// extension, or given with -fpreprocessed, is the output of a preprocessor
+// such as "cpp a.c a.i", and is not preprocessed again; the line markers in it
+// give the source locations of diagnostics.
+//
+// Diagnostics are written to standard error, colored if it is a terminal.
+//
+// Exit status is 0 on success, 1 on an I/O or internal error, 2 on a usage
+// error, 3 on a lexical or preprocessing error, 4 on a syntax error, and 5 on a
+// semantic error.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	// The backends register their targets.
+	_ "github.com/ChrisCummins/phd/compilers/toy/codegen"
+	_ "github.com/ChrisCummins/phd/compilers/toy/codegen/arm64"
+	"github.com/ChrisCummins/phd/compilers/toy/codegen/asm"
+	"github.com/ChrisCummins/phd/compilers/toy/codegen/llvm"
+	_ "github.com/ChrisCummins/phd/compilers/toy/codegen/wasm"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/opt"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/preprocessor"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/target"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Process exit codes.
+const (
+	exitSuccess       = 0
+	exitFailure       = 1 // An I/O or internal error.
+	exitUsageError    = 2
+	exitLexicalError  = 3 // Or a preprocessing error.
+	exitSyntaxError   = 4
+	exitSemanticError = 5
+)
+
+// The options of a single compiler invocation.
+type options struct {
+	// The files to compile, and the one being compiled and its output.
+	inputs []string
+	input  string
+	output string
+	jobs   int // The number of files to compile at once.
+	// Whether to stop after compiling to assembly, or after assembling, and
+	// the paths of the assembler, if not the internal one, and the linker
+	// otherwise.
+	assemblyOnly bool
+	objectOnly   bool
+	assembler    string
+	linker       string
+	includePath  []string
+	// Whether the input is already preprocessed.
+	preprocessed bool
+	dumpTokens   string
+	dumpAst      string
+	dumpIr       bool
+	dumpCfg      string
+	optLevel     int
+	// The size of the largest function which is inlined at -O=2.
+	inlineThreshold int
+	// The passes to run instead of those of the optimization level, separated
+	// by commas, and those after which to print the program.
+	passes      string
+	printAfter  []string
+	noRegalloc  bool
+	noTailCalls bool
+	// The number of errors after which to stop reporting them, or 0 for no
+	// limit, whether warnings are errors, and which are enabled.
+	maxErrors  int
+	werror     bool
+	warnings   diag.WarningSet
+	debug      bool
+	sanitize   string
+	overflow   string // What becomes of int arithmetic which overflows.
+	color      string
+	diagFormat string
+	target     target.Target
+	emit       string
+	masm       string // The syntax of x86-64 assembly.
+	pic        bool
+}
+
+// A flag which sets an optimization level. It may be given without a value,
+// as "-O", to select level 1.
+type optLevelFlag struct {
+	level *int
+}
+
+func (f optLevelFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (f optLevelFlag) String() string {
+	if f.level == nil {
+		return "0"
+	}
+	return strconv.Itoa(*f.level)
+}
+
+func (f optLevelFlag) Set(s string) error {
+	if s == "true" {
+		*f.level = 1
+		return nil
+	}
+	level, err := strconv.Atoi(s)
+	if err != nil || level < 0 {
+		return fmt.Errorf("invalid optimization level %q", s)
+	}
+	*f.level = level
+	return nil
+}
+
+// A flag which may be given more than once, collecting its values.
+type listFlag struct {
+	values *[]string
+}
+
+func (f listFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f listFlag) Set(s string) error {
+	*f.values = append(*f.values, s)
+	return nil
+}
+
+// The modes of the --color flag.
+const (
+	colorAuto   = "auto" // Color diagnostics if stderr is a terminal.
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// The formats of the --diagnostics-format and --dump-tokens flags.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// The stages of compilation after which toycc stops, writing its output.
+const (
+	stageCompile  = iota // Write assembly or another text format.
+	stageAssemble        // Write an object file.
+	stageLink            // Write an executable.
+)
+
+// The kinds of output of the --emit flag.
+const (
+	emitAsm  = "asm"
+	emitLLVM = "llvm"
+)
+
+// The syntaxes of x86-64 assembly of the --masm flag.
+const (
+	masmATT   = "att"
+	masmIntel = "intel"
+)
+
+// The formats of the --dump-ast flag, besides json.
+const (
+	astSource = "source" // The formatted source of the tree.
+	astTree   = "tree"   // An indented outline of the nodes.
+	astSExpr  = "sexpr"
+)
+
+// The formats of the --dump-cfg flag.
+const (
+	graphDot = "dot"
+)
+
+// The runtime checks of the --sanitize flag.
+const (
+	sanitizeStack = "stack" // Check a canary on return from each function.
+)
+
+// The modes of the -foverflow flag.
+const (
+	overflowWrap = "wrap" // Wrap around in two's complement.
+	overflowTrap = "trap" // Trap at run time.
+	overflowWarn = "warn" // Wrap around, warning of constant arithmetic.
+)
+
+// A flag whose value is one of a list of choices.
+type choiceFlag struct {
+	value   *string
+	name    string // What the value is, for error messages.
+	choices []string
+}
+
+func (f choiceFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f choiceFlag) Set(s string) error {
+	for _, c := range f.choices {
+		if s == c {
+			*f.value = s
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s %q, expected one of %s",
+		f.name, s, strings.Join(f.choices, ", "))
+}
+
+// A choiceFlag which may be given without a value, as "--dump-tokens", to
+// select its first choice.
+type optionalChoiceFlag struct {
+	choiceFlag
+}
+
+func (f optionalChoiceFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (f optionalChoiceFlag) Set(s string) error {
+	if s == "true" {
+		s = f.choices[0]
+	}
+	return f.choiceFlag.Set(s)
+}
+
+// A flag which selects a registered target, by its name or that of its
+// architecture.
+type targetFlag struct {
+	value *target.Target
+}
+
+func (f targetFlag) String() string {
+	if f.value == nil || *f.value == nil {
+		return ""
+	}
+	return (*f.value).Name()
+}
+
+func (f targetFlag) Set(s string) error {
+	t, err := target.Lookup(s)
+	if err != nil {
+		return err
+	}
+	*f.value = t
+	return nil
+}
+
+// useColor returns whether diagnostics written to w should be colored.
+func useColor(mode string, w io.Writer) bool {
+	switch mode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// parseArgs parses the command line. Unlike the flag package's default
+// behaviour, flags may appear after the input file, as in "toycc a.c -o a.s".
+// Usage errors are reported to stderr.
+func parseArgs(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{
+		color:      colorAuto,
+		diagFormat: formatText,
+		emit:       emitAsm,
+		masm:       masmATT,
+		overflow:   overflowWrap,
+		warnings:   diag.DefaultWarnings(),
+	}
+	// x86-64 code follows the conventions of the host, as do those of the
+	// other architectures.
+	opts.target, _ = target.Lookup("x86-64")
+	flags := flag.NewFlagSet("toycc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.output, "o", "",
+		"The output file. Defaults to a.out, or to the input file with a .o\n"+
+			"extension with -c, .s with -S, .wat for wasm32, or .ll for LLVM IR.\n"+
+			"Only for a single input file unless linking.")
+	flags.BoolVar(&opts.assemblyOnly, "S", false,
+		"Compile to assembly, without assembling or linking.")
+	flags.BoolVar(&opts.objectOnly, "c", false,
+		"Compile and assemble to object files, without linking.")
+	flags.StringVar(&opts.assembler, "assembler", "",
+		"The `path` of an assembler to run as \"as -o file.o file.s\", instead of\n"+
+			"the internal assembler. Code for arm64, or with debug information,\n"+
+			"is assembled by \"as\" unless another is given.")
+	flags.StringVar(&opts.linker, "linker", "cc",
+		"The `path` of the linker, which is run as \"cc -o a.out file.o...\", and\n"+
+			"links the C runtime.")
+	flags.IntVar(&opts.jobs, "j", runtime.NumCPU(),
+		"The number of input files to compile at once.")
+	flags.Var(listFlag{&opts.includePath}, "I",
+		"Add a directory to search for included files. May be repeated, and\n"+
+			"may be joined to its value, as in -Iinclude.")
+	flags.BoolVar(&opts.preprocessed, "fpreprocessed", false,
+		"The input is already preprocessed, as is one with a .i extension.")
+	flags.Var(optionalChoiceFlag{choiceFlag{&opts.dumpTokens, "tokens format",
+		[]string{formatText, formatCSV, formatJSON}}}, "dump-tokens",
+		"Print the lexed tokens instead of compiling, with their positions.\n"+
+			"A format may be given, as in --dump-tokens=json: text, in aligned\n"+
+			"columns, which is the default, csv, or json.")
+	flags.Var(optionalChoiceFlag{choiceFlag{&opts.dumpAst, "syntax tree format",
+		[]string{astSource, astTree, formatJSON, astSExpr}}}, "dump-ast",
+		"Print the parsed abstract syntax tree instead of compiling. A format\n"+
+			"may be given, as in --dump-ast=json: source, as formatted source,\n"+
+			"which is the default, or tree, json or sexpr, with the kind,\n"+
+			"position and resolved type of each node, once the program is\n"+
+			"checked.")
+	flags.BoolVar(&opts.dumpIr, "dump-ir", false,
+		"Print the intermediate representation instead of compiling.")
+	flags.Var(choiceFlag{&opts.dumpCfg, "graph format", []string{graphDot}}, "dump-cfg",
+		"Print the control-flow graph of each function instead of compiling:\n"+
+			"dot, for Graphviz.")
+	flags.Var(optLevelFlag{&opts.optLevel}, "O",
+		"Enable optimizations. An optimization level may be given, as in -O=0.\n"+
+			"Level 2 also propagates constants and removes redundant\n"+
+			"computations in the IR, hoists invariants out of loops, and inlines\n"+
+			"small functions.")
+	flags.IntVar(&opts.inlineThreshold, "inline-threshold", opt.DefaultInlineThreshold,
+		"The number of instructions of the largest function which is inlined\n"+
+			"at -O=2, or 0 to inline none.")
+	flags.StringVar(&opts.passes, "passes", "",
+		"The optimization passes to run instead of those of the optimization\n"+
+			"level, separated by commas, as in --passes=inline,sccp. Passes of\n"+
+			"the syntax tree precede those of the IR. The passes are: "+
+			strings.Join(opt.PassNames(), ", ")+".")
+	flags.Var(listFlag{&opts.printAfter}, "print-after",
+		"Print the program to stderr after an optimization pass is run, as\n"+
+			"source text or IR. May be repeated.")
+	flags.Var(targetFlag{&opts.target}, "target",
+		"The target to generate code for: one of "+strings.Join(target.Names(), ", ")+".\n"+
+			"An architecture, such as x86-64, arm64 or wasm32, follows the\n"+
+			"conventions of the host.")
+	flags.Var(choiceFlag{&opts.emit, "output kind",
+		[]string{emitAsm, emitLLVM}}, "emit",
+		"The kind of output: asm for the target, or llvm for LLVM IR, which is\n"+
+			"independent of the target.")
+	flags.Var(choiceFlag{&opts.masm, "assembly syntax",
+		[]string{masmATT, masmIntel}}, "masm",
+		"The syntax of x86-64 assembly: att, or intel for that of the Intel\n"+
+			"manuals. Intel syntax is assembled by \"as\" unless another assembler\n"+
+			"is given.")
+	for _, name := range []string{"g", "debug"} {
+		flags.BoolVar(&opts.debug, name, false,
+			"Emit DWARF debug information, for debuggers such as gdb. Only for\n"+
+				"x86-64.")
+	}
+	flags.Var(choiceFlag{&opts.sanitize, "sanitizer", []string{sanitizeStack}}, "sanitize",
+		"Add runtime checks: stack, to abort a program which overwrites the\n"+
+			"stack canary of a function. Only for x86-64.")
+	flags.Var(choiceFlag{&opts.overflow, "overflow mode",
+		[]string{overflowWrap, overflowTrap, overflowWarn}}, "foverflow",
+		"What becomes of int arithmetic which overflows: wrap, to wrap around,\n"+
+			"trap, to kill the program with SIGILL, which is only for x86-64, or\n"+
+			"warn, to wrap around and warn of constant arithmetic which overflows.")
+	flags.BoolVar(&opts.pic, "fPIC", false,
+		"Generate position-independent code, which may be linked into a shared\n"+
+			"object, as with \"cc -shared\". Only for x86-64.")
+	flags.BoolVar(&opts.noRegalloc, "no-regalloc", false,
+		"Keep every temporary on the stack, for debugging. Only for x86-64, as\n"+
+			"the other targets always do.")
+	flags.BoolVar(&opts.noTailCalls, "no-tail-calls", false,
+		"Return from each call, rather than jumping to the callee of a call in\n"+
+			"tail position, so that every caller is in a backtrace. Only for x86-64.")
+	flags.Var(choiceFlag{&opts.color, "color mode",
+		[]string{colorAuto, colorAlways, colorNever}}, "color",
+		"When to color diagnostics: always, never, or auto if stderr is a terminal.")
+	flags.IntVar(&opts.maxErrors, "max-errors", 0,
+		"Stop after reporting this many errors, or 0 to report every error.")
+	flags.Var(opts.warnings, "W",
+		"Enable a warning, as in -Wshadow, or disable one, as in\n"+
+			"-Wno-unreachable-code. -Wall enables unused-variable,\n"+
+			"maybe-uninitialized, unreachable-code, confusable and overflow. May be\n"+
+			"repeated. The warnings are: "+
+			strings.Join(diag.WarningNames(), ", ")+".")
+	flags.BoolVar(&opts.werror, "Werror", false,
+		"Report warnings as errors, so that a program with warnings fails to\n"+
+			"compile.")
+	flags.Var(choiceFlag{&opts.diagFormat, "diagnostics format",
+		[]string{formatText, formatJSON}}, "diagnostics-format",
+		"The format of diagnostics: text, or json for tools.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: toycc [flags] file.c... [-o a.out]")
+		fmt.Fprintln(stderr, "       toycc -c [flags] file.c...")
+		fmt.Fprintln(stderr, "       toycc -S [flags] file.c... [-o file.s]")
+		flags.PrintDefaults()
+	}
+
+	// The flag package takes "-Idir" as a flag named "Idir", and "-Wall" as
+	// one named "Wall".
+	args = append([]string{}, args...)
+	for i, arg := range args {
+		for _, prefix := range []string{"-I", "-W"} {
+			if strings.HasPrefix(arg, prefix) && len(arg) > 2 && arg[2] != '=' &&
+				arg != "-Werror" {
+				args[i] = prefix + "=" + arg[2:]
+			}
+		}
+	}
+
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) == 0 {
+		err := fmt.Errorf("expected an input file")
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		flags.Usage()
+		return nil, err
+	}
+	opts.inputs = positional
+	if opts.overflow == overflowWarn {
+		opts.warnings[diag.Overflow] = true
+	}
+	if len(positional) > 1 {
+		var err error
+		if opts.output != "" && opts.stage() != stageLink {
+			err = fmt.Errorf("cannot use -o with several input files, unless linking them")
+		}
+		for _, input := range positional {
+			if input == "-" {
+				err = fmt.Errorf("cannot read standard input with other input files")
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "toycc: %v\n", err)
+			return nil, err
+		}
+	}
+	if opts.jobs < 1 {
+		err := fmt.Errorf("invalid number of jobs %d", opts.jobs)
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		return nil, err
+	}
+	if opts.maxErrors < 0 {
+		err := fmt.Errorf("invalid maximum number of errors %d", opts.maxErrors)
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		return nil, err
+	}
+	if opts.passes != "" {
+		if _, err := opt.NewPipeline(strings.Split(opts.passes, ",")); err != nil {
+			fmt.Fprintf(stderr, "toycc: %v\n", err)
+			return nil, err
+		}
+	}
+	for _, name := range opts.printAfter {
+		if !isPass(name) {
+			err := fmt.Errorf("unknown pass %q", name)
+			fmt.Fprintf(stderr, "toycc: %v\n", err)
+			return nil, err
+		}
+	}
+	if len(positional) == 1 {
+		opts = opts.forInput(positional[0])
+	}
+	return opts, nil
+}
+
+// forInput returns a copy of the options which compiles an input file. A file
+// with a .i extension is preprocessed, and the output defaults to standard
+// output if the input is standard input or something is dumped instead of
+// compiling, to a.out if linking, and otherwise to the input with the
+// extension of the output.
+func (opts *options) forInput(input string) *options {
+	o := *opts
+	o.input = input
+	if filepath.Ext(o.input) == ".i" {
+		o.preprocessed = true
+	}
+	if o.output == "" {
+		if o.input == "-" || o.dumpTokens != "" || o.dumpAst != "" || o.dumpIr || o.dumpCfg != "" {
+			o.output = "-"
+		} else if o.stage() == stageLink {
+			o.output = "a.out"
+		} else {
+			ext := ".s"
+			if o.emit == emitLLVM {
+				ext = ".ll"
+			} else if o.target.Syntax() == target.WAT {
+				ext = ".wat"
+			} else if o.stage() == stageAssemble {
+				ext = ".o"
+			}
+			o.output = strings.TrimSuffix(o.input, filepath.Ext(o.input)) + ext
+		}
+	}
+	return &o
+}
+
+// stage returns the stage of compilation after which to stop. Only native
+// code is assembled, and output to stdout or something dumped instead of
+// compiling is text.
+func (opts *options) stage() int {
+	switch {
+	case opts.emit == emitLLVM || opts.target.Syntax() == target.WAT || opts.output == "-" ||
+		opts.dumpTokens != "" || opts.dumpAst != "" || opts.dumpIr || opts.dumpCfg != "" ||
+		opts.assemblyOnly:
+		return stageCompile
+	case opts.objectOnly:
+		return stageAssemble
+	}
+	return stageLink
+}
+
+// isPass returns whether an optimization pass has a name.
+func isPass(name string) bool {
+	for _, p := range opt.PassNames() {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// passManager returns the manager of the optimization passes selected by the
+// options, which print the program to stderr after those requested.
+func passManager(opts *options, stderr io.Writer) *opt.Manager {
+	options := []opt.Option{
+		opt.InlineThreshold(opts.inlineThreshold),
+		opt.PrintAfter(stderr, opts.printAfter...),
+	}
+	if opts.overflow == overflowTrap {
+		options = append(options, opt.TrapOverflow)
+	}
+	if opts.passes == "" {
+		return opt.NewManager(opts.optLevel, options...)
+	}
+	// The pipeline was checked with the arguments.
+	m, _ := opt.NewPipeline(strings.Split(opts.passes, ","), options...)
+	return m
+}
+
+// readFiles reads the files which diagnostics and their notes are in, for the
+// snippets of a renderer, if it does not have them. These are the files named
+// by line directives, which may not exist.
+func readFiles(renderer *diag.Renderer, diagnostics []*diag.Diagnostic) {
+	for _, d := range diagnostics {
+		name := d.Pos.Filename
+		if _, ok := renderer.Files[name]; !ok && name != "" && name != renderer.Filename {
+			if source, err := ioutil.ReadFile(name); err == nil {
+				if renderer.Files == nil {
+					renderer.Files = map[string][]byte{}
+				}
+				renderer.Files[name] = source
+			}
+		}
+		readFiles(renderer, d.Notes)
+	}
+}
+
+// compile runs the compiler pipeline, writing the requested output to w.
+// Diagnostics are written to stderr. It returns a process exit code.
+func compile(opts *options, r io.Reader, w io.Writer, stderr io.Writer) int {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		return exitFailure
+	}
+	reporter := diag.Reporter{
+		MaxErrors:        opts.maxErrors,
+		WarningsAsErrors: opts.werror,
+		Warnings:         opts.warnings,
+	}
+	renderer := &diag.Renderer{
+		Filename: opts.input,
+		Source:   source,
+		Color:    useColor(opts.color, stderr),
+	}
+	var preprocessed *preprocessor.Output
+	defer func() {
+		// Diagnostics after preprocessing are moved to where their positions
+		// came from.
+		if preprocessed != nil {
+			for _, d := range reporter.Diagnostics() {
+				preprocessed.Translate(d)
+			}
+			renderer.Files = preprocessed.Files
+		}
+		if opts.diagFormat == formatJSON {
+			diag.WriteJSON(stderr, opts.input, reporter.Diagnostics())
+		} else {
+			readFiles(renderer, reporter.Diagnostics())
+			renderer.RenderAll(stderr, reporter.Diagnostics())
+		}
+	}()
+
+	text := string(source)
+	if !opts.preprocessed {
+		var preprocessorOptions []preprocessor.Option
+		for _, dir := range opts.includePath {
+			preprocessorOptions = append(preprocessorOptions, preprocessor.IncludePath(dir))
+		}
+		preprocessed, err = preprocessor.Preprocess(opts.input, source, preprocessorOptions...)
+		if err != nil {
+			reporter.Report(err.(*preprocessor.Error).Diagnostic())
+			return exitLexicalError
+		}
+		text = preprocessed.Text
+	}
+
+	if opts.dumpTokens != "" {
+		// Report every lexical error, not just the first.
+		status := exitSuccess
+		var tokens []token.Token
+		lex := lexer.Lex(text, lexer.RecoverFromErrors)
+		for t := lex.NextToken(); t.Type != token.EofToken && !reporter.LimitReached(); t = lex.NextToken() {
+			if t.Type == token.ErrorToken {
+				reporter.Errorf(t.Position(), 0, "%s", t.Value).Code = "lexical"
+				status = exitLexicalError
+				continue
+			}
+			tokens = append(tokens, t)
+		}
+		switch opts.dumpTokens {
+		case formatCSV:
+			err = token.WriteCSV(w, opts.input, tokens)
+		case formatJSON:
+			err = token.WriteJSON(w, opts.input, tokens)
+		default:
+			err = token.WriteText(w, tokens)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "toycc: %v\n", err)
+			return exitFailure
+		}
+		return status
+	}
+
+	// Report every syntax error, not just the first.
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(text)),
+		parser.RecoverFromErrors)
+	if err != nil {
+		errors := err.(parser.ErrorList)
+		for _, e := range errors {
+			if reporter.LimitReached() {
+				break
+			}
+			reporter.Report(e.Diagnostic())
+		}
+		if errors.IsLexical() {
+			return exitLexicalError
+		}
+		return exitSyntaxError
+	}
+
+	if opts.dumpAst == astSource {
+		for _, e := range program.Enums {
+			fmt.Fprintln(w, e)
+		}
+		for _, t := range program.Typedefs {
+			fmt.Fprintln(w, t)
+		}
+		for _, s := range program.Structs {
+			fmt.Fprintln(w, s)
+		}
+		for _, g := range program.Globals {
+			fmt.Fprintln(w, g)
+		}
+		for _, f := range program.Functions {
+			fmt.Fprintln(w, f)
+		}
+		return exitSuccess
+	}
+
+	// The sizes of types are those of the target, except in LLVM IR, which
+	// assumes a 64-bit target.
+	checkOptions := []sema.Option{sema.ReportWarnings(func(w *sema.Warning) {
+		reporter.Report(w.Diagnostic())
+	})}
+	if opts.emit != emitLLVM {
+		checkOptions = append(checkOptions, sema.Layout(opts.target.Layout()))
+	}
+	if err := sema.Check(program, checkOptions...); err != nil {
+		for _, e := range err.(sema.ErrorList) {
+			if reporter.LimitReached() {
+				break
+			}
+			reporter.Report(e.Diagnostic())
+		}
+		return exitSemanticError
+	}
+	if opts.dumpAst != "" {
+		switch opts.dumpAst {
+		case astTree:
+			err = ast.DumpTree(w, program)
+		case formatJSON:
+			err = ast.DumpJSON(w, program)
+		case astSExpr:
+			err = ast.DumpSExpr(w, program)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "toycc: %v\n", err)
+			return exitFailure
+		}
+		return exitSuccess
+	}
+
+	for _, w := range opt.EliminateDeadCode(program) {
+		reporter.Report(w.Diagnostic())
+	}
+	passes := passManager(opts, stderr)
+	passes.Run(program)
+
+	lowered, err := ir.Lower(program)
+	if err != nil {
+		reportError(stderr, opts.input, err)
+		return exitFailure
+	}
+	// The IR is checked before it is optimized, which may move or remove the
+	// uses of variables.
+	for _, w := range opt.CheckUninitialized(lowered) {
+		reporter.Report(w.Diagnostic())
+	}
+	// Warnings fail the compilation with -Werror.
+	if reporter.ErrorCount() > 0 {
+		return exitSemanticError
+	}
+	passes.RunIR(lowered)
+
+	if opts.dumpIr {
+		ir.Print(w, lowered)
+		return exitSuccess
+	}
+	if opts.dumpCfg == graphDot {
+		ir.PrintDot(w, lowered)
+		return exitSuccess
+	}
+
+	if err := generate(opts, w, lowered, preprocessed); err != nil {
+		reportError(stderr, opts.input, err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// reportError writes an error of compiling an input. An error at a position
+// follows the name of the input, as in "a.c:1:5: message", and any other
+// follows the name of the compiler, as in "toycc: a.c: message".
+func reportError(stderr io.Writer, input string, err error) {
+	if e, ok := err.(*ir.Error); ok && e.Pos.IsValid() {
+		fmt.Fprintf(stderr, "%s:%v\n", input, err)
+		return
+	}
+	fmt.Fprintf(stderr, "toycc: %s: %v\n", input, err)
+}
+
+// generate writes the code for a program for the target, or its LLVM IR. The
+// debug information of x86-64 code refers to the files which the
+// preprocessed program came from, if it was preprocessed.
+func generate(opts *options, w io.Writer, program *ir.Program, preprocessed *preprocessor.Output) error {
+	if opts.emit == emitLLVM {
+		return llvm.Generate(w, program)
+	}
+	options := target.Options{
+		NoRegisterAllocation: opts.noRegalloc,
+		NoTailCalls:          opts.noTailCalls,
+		SanitizeStack:        opts.sanitize == sanitizeStack,
+		TrapOverflow:         opts.overflow == overflowTrap,
+		Peephole:             opts.optLevel >= 1,
+		IntelSyntax:          opts.masm == masmIntel,
+		PIC:                  opts.pic,
+	}
+	if opts.debug {
+		source := &target.Source{Filename: opts.input}
+		source.Dir, _ = os.Getwd()
+		if preprocessed != nil {
+			source.Position = preprocessed.Position
+		}
+		options.Debug = source
+	}
+	return opts.target.Generate(w, program, options)
+}
+
+// compileFile compiles the input file of the options to its output, and
+// returns a process exit code. The output is removed if compilation fails,
+// unless it is not a regular file.
+func compileFile(opts *options, stdin io.Reader, stdout, stderr io.Writer) int {
+	r := stdin
+	if opts.input != "-" {
+		f, err := os.Open(opts.input)
+		if err != nil {
+			fmt.Fprintf(stderr, "toycc: %v\n", err)
+			return exitFailure
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if opts.output == "-" {
+		return compile(opts, r, stdout, stderr)
+	}
+
+	f, err := os.Create(opts.output)
+	if err != nil {
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		return exitFailure
+	}
+	status := compile(opts, r, f, stderr)
+	if err := f.Close(); err != nil && status == exitSuccess {
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		status = exitFailure
+	}
+	// Don't leave behind partial output.
+	if status != exitSuccess {
+		removeOutput(opts.output)
+	}
+	return status
+}
+
+// removeOutput removes an output which was left incomplete, if it is a
+// regular file. Other files, such as /dev/null or a named pipe, are written
+// to rather than created, and so are kept.
+func removeOutput(name string) {
+	if fi, err := os.Lstat(name); err == nil && fi.Mode().IsRegular() {
+		os.Remove(name)
+	}
+}
+
+// runTool runs the assembler or linker, writing its output to stderr.
+func runTool(stderr io.Writer, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// compileObject compiles the input file of the options to assembly in a
+// temporary file, and assembles it to the output, which is an object file.
+// It returns a process exit code.
+func compileObject(opts *options, stdin io.Reader, stdout, stderr io.Writer) int {
+	text, err := ioutil.TempFile("", "toycc*.s")
+	if err != nil {
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		return exitFailure
+	}
+	text.Close()
+	defer os.Remove(text.Name())
+	o := *opts
+	o.output = text.Name()
+	if status := compileFile(&o, stdin, stdout, stderr); status != exitSuccess {
+		return status
+	}
+	assembler := opts.assembler
+	if assembler == "" && (opts.debug || opts.masm != masmATT ||
+		opts.target.Syntax() != target.ATT) {
+		// The internal assembler only assembles x86-64 code in AT&T syntax,
+		// without debug information.
+		assembler = "as"
+	}
+	if assembler == "" {
+		err = assemble(opts.target, text.Name(), opts.output)
+	} else {
+		err = runTool(stderr, assembler, "-o", opts.output, text.Name())
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		removeOutput(opts.output)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// assemble assembles a file of x86-64 assembly to an object file with the
+// internal assembler: a Mach-O file for macOS, and otherwise an ELF file.
+func assemble(t target.Target, input, output string) error {
+	text, err := ioutil.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	var options []asm.Option
+	write := asm.WriteELF
+	if t.OS() == "darwin" {
+		options, write = append(options, asm.Darwin), asm.WriteMachO
+	}
+	object, err := asm.Assemble(string(text), options...)
+	if err != nil {
+		return fmt.Errorf("internal assembler: %v", err)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	err = write(f, object)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// link links object files into the output of the options, an executable, and
+// returns a process exit code.
+func link(opts *options, objects []string, stderr io.Writer) int {
+	if err := runTool(stderr, opts.linker, append([]string{"-o", opts.output}, objects...)...); err != nil {
+		fmt.Fprintf(stderr, "toycc: %v\n", err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// compileFiles compiles the input files with a pool of workers, then links
+// them if linking, and returns the exit code of the first which fails, or
+// exitSuccess. The output and diagnostics of each file are buffered, and
+// written in the order of the files once all of them are compiled. The object
+// files of an executable are written to a temporary directory.
+func compileFiles(opts *options, stdin io.Reader, stdout, stderr io.Writer) int {
+	var dir string
+	if opts.stage() == stageLink {
+		var err error
+		if dir, err = ioutil.TempDir("", "toycc"); err != nil {
+			fmt.Fprintf(stderr, "toycc: %v\n", err)
+			return exitFailure
+		}
+		defer os.RemoveAll(dir)
+	}
+	objects := make([]string, len(opts.inputs))
+
+	// Whether to color diagnostics depends on the real stderr.
+	if useColor(opts.color, stderr) {
+		opts.color = colorAlways
+	} else {
+		opts.color = colorNever
+	}
+	type result struct {
+		status         int
+		stdout, stderr bytes.Buffer
+	}
+	results := make([]result, len(opts.inputs))
+	inputs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.jobs && i < len(opts.inputs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range inputs {
+				r := &results[i]
+				o := opts.forInput(opts.inputs[i])
+				switch o.stage() {
+				case stageCompile:
+					r.status = compileFile(o, stdin, &r.stdout, &r.stderr)
+				case stageAssemble:
+					r.status = compileObject(o, stdin, &r.stdout, &r.stderr)
+				case stageLink:
+					o.output = filepath.Join(dir, fmt.Sprintf("%d.o", i))
+					objects[i] = o.output
+					r.status = compileObject(o, stdin, &r.stdout, &r.stderr)
+				}
+			}
+		}()
+	}
+	for i := range opts.inputs {
+		inputs <- i
+	}
+	close(inputs)
+	wg.Wait()
+
+	status := exitSuccess
+	for i := range results {
+		r := &results[i]
+		stdout.Write(r.stdout.Bytes())
+		stderr.Write(r.stderr.Bytes())
+		if status == exitSuccess {
+			status = r.status
+		}
+	}
+	if status == exitSuccess && opts.stage() == stageLink {
+		status = link(opts.forInput(opts.inputs[0]), objects, stderr)
+	}
+	return status
+}
+
+// run executes the compiler with the given command line arguments, returning
+// a process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseArgs(args, stderr)
+	if err == flag.ErrHelp {
+		return exitSuccess
+	} else if err != nil {
+		return exitUsageError
+	}
+	if len(opts.inputs) > 1 || opts.stage() != stageCompile {
+		return compileFiles(opts, stdin, stdout, stderr)
+	}
+	return compileFile(opts, stdin, stdout, stderr)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,935 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// toycc runs the compiler on the given standard input, returning the exit
+// code and the contents of standard output and standard error.
+func toycc(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestCompileStdin(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toycc("int main() { return 2; }", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmovl $2, %eax\n")
+	assert.Equal("", stderr)
+}
+
+func TestCompileFile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "return_2.c")
+	if err := ioutil.WriteFile(
+		input, []byte("int main() { return 2; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags may follow the input file.
+	output := filepath.Join(dir, "out.s")
+	status, _, _ := toycc("", input, "-S", "-o", output)
+	assert.Equal(exitSuccess, status)
+	asm, err := ioutil.ReadFile(output)
+	assert.NoError(err)
+	assert.Contains(string(asm), "main:\n")
+
+	// The default output file replaces the extension.
+	status, _, _ = toycc("", input, "-S")
+	assert.Equal(exitSuccess, status)
+	_, err = os.Stat(filepath.Join(dir, "return_2.s"))
+	assert.NoError(err)
+
+	// WebAssembly text format has its own extension.
+	status, _, _ = toycc("", input, "--target=wasm32")
+	assert.Equal(exitSuccess, status)
+	_, err = os.Stat(filepath.Join(dir, "return_2.wat"))
+	assert.NoError(err)
+
+	status, _, _ = toycc("", input, "--emit=llvm")
+	assert.Equal(exitSuccess, status)
+	_, err = os.Stat(filepath.Join(dir, "return_2.ll"))
+	assert.NoError(err)
+}
+
+func TestCompileFailureRemovesOutput(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := "int main() { return x; }"
+
+	// Partial output is removed.
+	output := filepath.Join(dir, "out.s")
+	status, _, _ := toycc(input, "-S", "-o", output, "-")
+	assert.Equal(exitSemanticError, status)
+	_, err = os.Lstat(output)
+	assert.True(os.IsNotExist(err))
+
+	// But an output which is not a regular file is kept, as /dev/null is.
+	fifo := filepath.Join(dir, "fifo")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Opening a pipe to write may block until it is opened to read.
+	r, err := os.OpenFile(fifo, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	status, _, _ = toycc(input, "-S", "-o", fifo, "-")
+	assert.Equal(exitSemanticError, status)
+	fi, err := os.Lstat(fifo)
+	if assert.NoError(err) {
+		assert.Equal(os.ModeNamedPipe, fi.Mode()&os.ModeType)
+	}
+}
+
+func TestDumpTokens(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, _ := toycc("int main() {\n  return 2;\n}", "--dump-tokens", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(`1:1   int         "int"
+1:5   identifier  "main"
+1:9   (           "("
+1:10  )           ")"
+1:12  {           "{"
+2:3   return      "return"
+2:10  number      "2"
+2:11  ;           ";"
+3:1   }           "}"
+`, stdout)
+
+	status, stdout, _ = toycc("int main", "--dump-tokens=csv", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(`file,line,column,offset,type,category,value
+-,1,1,0,int,keyword,int
+-,1,5,4,identifier,identifier,main
+`, stdout)
+
+	status, stdout, _ = toycc("int", "--dump-tokens=json", "-")
+	assert.Equal(exitSuccess, status)
+	assert.JSONEq(`[{"file": "-", "line": 1, "column": 1, "offset": 0, "type": "int",
+		"category": "keyword", "value": "int"}]`, stdout)
+
+	status, _, stderr := toycc("int", "--dump-tokens=xml", "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, `invalid tokens format "xml", expected one of text, csv, json`)
+}
+
+func TestDumpAst(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, _ := toycc("int main() { return 1 + 2 * 3; }",
+		"-dump-ast", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("int main() { return (1 + (2 * 3)); }\n", stdout)
+
+	// The other formats are of the checked tree, with its conversions.
+	input := "int main() { char c = 1; return c; }"
+	status, stdout, _ = toycc(input, "--dump-ast=tree", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(`Program <1:1>
+  Function <1:1> type=int() name=main
+    VariableDeclaration <1:14> type=char name=c
+      Conversion <1:23> type=char implicit=true
+        IntLiteral <1:23> type=int value=1
+    ReturnStatement <1:26>
+      Conversion <1:33> type=int implicit=true
+        Identifier <1:33> type=char name=c
+`, stdout)
+
+	status, stdout, _ = toycc("int main() { return 2; }", "--dump-ast=sexpr", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(`(Program :pos "1:1"
+  (Function :pos "1:1" :type "int()" :name "main"
+    (ReturnStatement :pos "1:14"
+      (IntLiteral :pos "1:21" :type "int" :value "2"))))
+`, stdout)
+
+	status, stdout, _ = toycc("int g;", "--dump-ast=json", "-")
+	assert.Equal(exitSuccess, status)
+	assert.JSONEq(`{"kind": "Program", "line": 1, "column": 1, "children": [
+		{"kind": "VariableDeclaration", "line": 1, "column": 1, "type": "int",
+		 "attributes": {"name": "g"}}]}`, stdout)
+
+	// A program with errors is not dumped.
+	status, stdout, _ = toycc("int main() { return x; }", "--dump-ast=json", "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Equal("", stdout)
+}
+
+func TestDumpIr(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, _ := toycc("int main() { int a = 2; return a * 3; }",
+		"-dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(`func main() int {
+	%a:int = 2
+	%1:int = mul %a, 3
+	return %1
+}
+`, stdout)
+}
+
+func TestDumpCfg(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, _ := toycc("int main() { return 2; }", "--dump-cfg=dot", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("digraph \"main\" {\n"+
+		"\tnode [shape=box, fontname=\"monospace\"];\n"+
+		"\tb0 [label=\"entry:\\l  return 2\\l\"];\n"+
+		"}\n", stdout)
+
+	status, _, _ = toycc("", "--dump-cfg=svg", "-")
+	assert.Equal(exitUsageError, status)
+}
+
+func TestOptimize(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, _ := toycc("int main() { return 2 * 3 + !0; }",
+		"-O", "-dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("func main() int {\n\treturn 7\n}\n", stdout)
+
+	status, stdout, _ = toycc("int main() { return 2 * 3; }",
+		"-O=0", "-dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "mul 2, 3")
+
+	// The assembly is optimized too.
+	input := "int main() { long a = 2; return a; }"
+	status, stdout, _ = toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmovq %rax, %rsi\n\tmovq %rsi, %rax\n")
+	status, stdout, _ = toycc(input, "-O", "-")
+	assert.Equal(exitSuccess, status)
+	assert.NotContains(stdout, "\tmovq %rax, %rsi\n\tmovq %rsi, %rax\n")
+}
+
+// instructions returns the number of instructions in an assembly listing.
+func instructions(asm string) int {
+	n := 0
+	for _, line := range strings.Split(asm, "\n") {
+		if strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "\t.") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestValueNumbering(t *testing.T) {
+	assert := assert.New(t)
+	input := `int f(int x, int y) {
+  int a = (x + y) * (x - y);
+  int b = (y + x) * (x - y);
+  return a + b + (x + y);
+}`
+	status, o1, _ := toycc(input, "-O", "-")
+	assert.Equal(exitSuccess, status)
+	status, o2, _ := toycc(input, "-O=2", "-")
+	assert.Equal(exitSuccess, status)
+	assert.True(instructions(o2) < instructions(o1), o2)
+	assert.Equal(1, strings.Count(o2, "imull"), o2)
+}
+
+func TestInlineThreshold(t *testing.T) {
+	assert := assert.New(t)
+	input := "int square(int x) { return x * x; }\nint main() { return square(3); }"
+	status, stdout, _ := toycc(input, "-O=2", "--dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.NotContains(stdout, "call square")
+	status, stdout, _ = toycc(input, "-O=2", "--inline-threshold=0", "--dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "call square(3)")
+	// Functions are only inlined at -O=2.
+	status, stdout, _ = toycc(input, "-O", "--dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "call square(3)")
+}
+
+func TestPasses(t *testing.T) {
+	assert := assert.New(t)
+	input := "int square(int x) { return x * x; }\nint main() { return square(3); }"
+	// The passes replace those of the optimization level.
+	status, stdout, _ := toycc(input, "-O=2", "--passes=fold", "--dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "call square(3)")
+	status, stdout, _ = toycc(input, "--passes=inline,sccp", "--dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "return 9\n")
+
+	status, _, stderr := toycc(input, "--passes=inline,unroll", "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, `unknown pass "unroll"`)
+	status, _, stderr = toycc(input, "--passes=inline,fold", "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, `pass "fold" of the syntax tree cannot run after pass "inline" of the IR`)
+}
+
+func TestPrintAfter(t *testing.T) {
+	assert := assert.New(t)
+	input := "int square(int x) { return x * x; }\nint main() { return square(1 + 2); }"
+	status, _, stderr := toycc(input, "-O=2", "--print-after=fold", "--print-after=inline", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stderr, "// After fold.\nint square(int x) {\n")
+	assert.Contains(stderr, "return square(3);\n")
+	assert.Contains(stderr, "// After inline.\nfunc square(%x:int) int {\n")
+	assert.NotContains(stderr, "After sccp")
+	// Passes which do not run print nothing.
+	status, _, stderr = toycc(input, "--print-after=inline", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stderr)
+
+	status, _, stderr = toycc(input, "--print-after=unroll", "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, `unknown pass "unroll"`)
+}
+
+func TestInvalidOptimizationLevel(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toycc("", "-O=fast", "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, `invalid optimization level "fast"`)
+}
+
+func TestUnreachableCodeWarning(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toycc("int main() { return 1; return 2; }",
+		"-dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("func main() int {\n\treturn 1\n}\n", stdout)
+	assert.Equal(`-:1:24: warning: unreachable code
+int main() { return 1; return 2; }
+                       ^
+`, stderr)
+}
+
+func TestWarningFlags(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main(int argc) { int a; int x = 0; { int x = 2.5; return x; } return 1; }"
+	status, _, stderr := toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(1, strings.Count(stderr, "warning:"))
+	assert.Contains(stderr, "-:1:67: warning: unreachable code\n")
+
+	status, _, stderr = toycc(input, "-Wall", "-Wno-unreachable-code", "-Wshadow", "-Wnarrowing", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stderr, "-:1:22: warning: unused variable 'a'\n")
+	assert.Contains(stderr, "-:1:42: warning: declaration of 'x' shadows a variable declared at 1:29\n")
+	assert.Contains(stderr, "-:1:50: warning: implicit conversion from double to int may change its value\n")
+	assert.NotContains(stderr, "unreachable code")
+	assert.NotContains(stderr, "unused parameter")
+	status, _, stderr = toycc(input, "-Wunused-parameter", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stderr, "-:1:10: warning: unused parameter 'argc'\n")
+
+	// Later flags override earlier ones.
+	status, _, stderr = toycc(input, "-Wno-all", "-Wall", "-Wno-unused-variable", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(1, strings.Count(stderr, "warning:"))
+	status, _, stderr = toycc(input, "-Wno-all", "-Werror", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stderr)
+
+	status, _, stderr = toycc(input, "-Wunused", "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, `unknown warning "unused"`)
+}
+
+func TestMaybeUninitializedWarning(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main(int argc) {\n  int x;\n  if (argc > 1)\n    x = 2;\n  return x;\n}"
+	status, _, stderr := toycc(input, "-Wall", "-O=2", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(`-:5:3: warning: 'x' may be used uninitialized
+  return x;
+  ^
+`, stderr)
+	status, _, stderr = toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stderr)
+	status, _, _ = toycc(input, "-Wmaybe-uninitialized", "-Werror", "-")
+	assert.Equal(exitSemanticError, status)
+}
+
+func TestNoRegalloc(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main() { int a = 2; return a; }"
+	status, stdout, _ := toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmovl %eax, %esi\n")
+
+	status, stdout, _ = toycc(input, "--no-regalloc", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmovl %eax, -8(%rbp)\n")
+}
+
+func TestNoTailCalls(t *testing.T) {
+	assert := assert.New(t)
+	input := "int g(int a) { return a; } int main() { return g(2); }"
+	status, stdout, _ := toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tjmp g\n")
+
+	status, stdout, _ = toycc(input, "--no-tail-calls", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tcall g\n")
+	assert.NotContains(stdout, "jmp g")
+}
+
+func TestDebug(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "a.c")
+	if err := ioutil.WriteFile(input, []byte("int main() {\n  return 2;\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, flag := range []string{"-g", "--debug"} {
+		status, stdout, _ := toycc("", flag, "-o", "-", input)
+		assert.Equal(exitSuccess, status, flag)
+		assert.Contains(stdout, "\t.file 1 \""+input+"\"\n", flag)
+		assert.Contains(stdout, "\t.loc 1 2 3\n", flag)
+		assert.Contains(stdout, "\t.section .debug_info,\"\",@progbits\n", flag)
+	}
+
+	// Functions from an included file are at lines of that file.
+	header := filepath.Join(dir, "b.h")
+	if err := ioutil.WriteFile(header, []byte("\nint two() { return 2; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(input, []byte("#include \"b.h\"\nint main() { return two(); }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, stdout, _ := toycc("", "-g", "-o", "-", input)
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "two:\n\t.cfi_startproc\n\t.file 1 \""+header+"\"\n\t.loc 1 2 1\n")
+	assert.Contains(stdout, "main:\n\t.cfi_startproc\n\t.file 2 \""+input+"\"\n\t.loc 2 2 1\n")
+}
+
+func TestSanitize(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, _ := toycc("int main() { return 2; }", "--sanitize=stack", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmovq %fs:40, %rax\n")
+
+	status, _, _ = toycc("", "--sanitize=address", "-")
+	assert.Equal(exitUsageError, status)
+}
+
+func TestOverflowFlag(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main(int argc) { return argc * 2 + (2147483647 + 1); }"
+	status, stdout, stderr := toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stderr)
+	assert.NotContains(stdout, "\tjo ")
+
+	status, stdout, _ = toycc(input, "-foverflow=trap", "-O", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\timull %ecx, %eax\n\tjo .Loverflow_main\n")
+	assert.Contains(stdout, "\taddl %ecx, %eax\n\tjo .Loverflow_main\n")
+	assert.Contains(stdout, "\tud2\n")
+
+	status, _, stderr = toycc(input, "-foverflow=warn", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stderr, "-:1:41: warning: integer overflow in expression of type int results in -2147483648\n")
+
+	status, _, _ = toycc(input, "-foverflow=saturate", "-")
+	assert.Equal(exitUsageError, status)
+}
+
+func TestPIC(t *testing.T) {
+	assert := assert.New(t)
+	input := "int a; int f() { return a; } int main() { return f(); }"
+	status, stdout, _ := toycc(input, "-fPIC", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmovq a@GOTPCREL(%rip), %rax\n")
+	assert.Contains(stdout, "\tjmp f@PLT\n")
+
+	status, stdout, _ = toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tleaq a(%rip), %rax\n")
+	assert.Contains(stdout, "\tjmp f\n")
+}
+
+func TestMasm(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main() { int a[2]; a[1] = 2; return a[1]; }"
+	status, stdout, _ := toycc(input, "--masm=intel", "--no-regalloc", "-")
+	assert.Equal(exitSuccess, status)
+	assert.True(strings.HasPrefix(stdout, "\t.intel_syntax noprefix\n"))
+	assert.Contains(stdout, "\tlea rax, [rax+rcx*4]\n\tmov QWORD PTR [rbp-32], rax\n")
+	assert.NotContains(stdout, "%")
+
+	status, stdout, _ = toycc(input, "--masm=att", "-")
+	assert.Equal(exitSuccess, status)
+	assert.NotContains(stdout, "intel_syntax")
+
+	status, _, _ = toycc(input, "--masm=nasm", "-")
+	assert.Equal(exitUsageError, status)
+
+	// Intel syntax cannot refer to symbols named like registers.
+	input = "int dx; int main() { return dx; }"
+	status, _, stderr := toycc(input, "--masm=intel", "-")
+	assert.Equal(exitFailure, status)
+	assert.Equal("-:1:22: symbol dx is the name of a register or operator in Intel syntax\n", stderr)
+	status, _, _ = toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	// An error without a position follows the name of the compiler.
+	status, _, stderr = toycc("int dx; int main() { return 0; }", "--masm=intel", "-")
+	assert.Equal(exitFailure, status)
+	assert.Equal("toycc: -: symbol dx is the name of a register or operator in Intel syntax\n", stderr)
+}
+
+func TestTarget(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main() { return 2; }"
+	status, stdout, _ := toycc(input, "--target=arm64", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmov w0, #2\n")
+
+	status, stdout, _ = toycc(input, "--target=x86-64", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmovl $2, %eax\n")
+
+	status, stdout, _ = toycc(input, "--target=wasm32", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "    i32.const 2\n    return\n")
+
+	status, _, _ = toycc(input, "--target=sparc", "-")
+	assert.Equal(exitUsageError, status)
+
+	// An instruction which the target does not support is reported at the
+	// statement which it was lowered from.
+	status, _, stderr := toycc("int printf(char *f, ...);\nint main() {\n    return printf(\"\");\n}",
+		"--target=wasm32", "-")
+	assert.Equal(exitFailure, status)
+	assert.Equal("-:3:5: call of variadic function 'printf' is not supported\n", stderr)
+
+	// A target may be named with its operating system.
+	status, stdout, _ = toycc(input, "--target=x86_64-darwin", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\t.globl _main\n")
+	status, stdout, _ = toycc(input, "--target=x86_64-linux", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\t.globl main\n")
+	status, stdout, _ = toycc(input, "--target=aarch64-linux", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\tmov w0, #2\n")
+
+	// The sizes of types are those of the target.
+	input = "int main() { return sizeof(int *); }"
+	status, stdout, _ = toycc(input, "--target=arm64", "--dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\treturn 8\n")
+	status, stdout, _ = toycc(input, "--target=wasm32", "--dump-ir", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stdout, "\treturn 4\n")
+}
+
+func TestEmitLLVM(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, _ := toycc("int main() { return 2; }", "--emit=llvm", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("define i32 @main() {\n.entry:\n  ret i32 2\n}\n", stdout)
+
+	status, _, _ = toycc("", "--emit=object", "-")
+	assert.Equal(exitUsageError, status)
+}
+
+func TestLexicalError(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toycc("int main() { return @; }", "-")
+	assert.Equal(exitLexicalError, status)
+	assert.Equal("", stdout)
+	assert.Equal("-:1:21: error: illegal character: `@`\n"+
+		"int main() { return @; }\n"+
+		"                    ^\n", stderr)
+
+	// Token dumps report all lexical errors.
+	status, stdout, stderr = toycc("int main() { return @ $; }",
+		"--dump-tokens", "-")
+	assert.Equal(exitLexicalError, status)
+	assert.Equal("-:1:21: error: illegal character: `@`\n"+
+		"int main() { return @ $; }\n"+
+		"                    ^\n"+
+		"-:1:23: error: illegal character: `$`\n"+
+		"int main() { return @ $; }\n"+
+		"                      ^\n", stderr)
+	assert.True(regexp.MustCompile(`(?m)^1:24 +; +";"$`).MatchString(stdout))
+}
+
+func TestSyntaxError(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toycc("int main() {\n  return 2 + abc\n}", "-")
+	assert.Equal(exitSyntaxError, status)
+	assert.Equal(`-:3:1: error: expected ';', found "}"
+}
+^
+`, stderr)
+
+	// The offending token is underlined.
+	status, _, stderr = toycc("int main() { return 2 abc; }", "-")
+	assert.Equal(exitSyntaxError, status)
+	assert.Equal(`-:1:23: error: expected ';', found "abc"
+int main() { return 2 abc; }
+                      ^~~
+`, stderr)
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	assert := assert.New(t)
+	// Every syntax error is reported.
+	status, _, stderr := toycc("int f() { return 1 +; }\nint main() { int x = 2 return x; }", "-")
+	assert.Equal(exitSyntaxError, status)
+	assert.Equal(`-:1:21: error: expected expression, found ";"
+int f() { return 1 +; }
+                    ^
+-:2:24: error: expected ';', found "return"
+int main() { int x = 2 return x; }
+                       ^~~~~~
+`, stderr)
+
+	// A lexical error is the last.
+	status, _, stderr = toycc("int f() { return 1 +; }\nint main() { return @; }", "-")
+	assert.Equal(exitLexicalError, status)
+	assert.Contains(stderr, "-:1:21: error: expected expression")
+	assert.Contains(stderr, "-:2:21: error: illegal character: `@`")
+}
+
+func TestMaxErrors(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main() { return a + b + c; }"
+	status, _, stderr := toycc(input, "--max-errors=2", "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Contains(stderr, "undefined identifier 'a'")
+	assert.Contains(stderr, "undefined identifier 'b'")
+	assert.NotContains(stderr, "undefined identifier 'c'")
+	assert.Contains(stderr, "-: error: too many errors, stopping after 2\n")
+
+	// Syntax errors are limited too.
+	status, _, stderr = toycc("int f() { return +; }\nint g() { return +; }", "--max-errors=1", "-")
+	assert.Equal(exitSyntaxError, status)
+	assert.Equal(1, strings.Count(stderr, "expected expression"))
+
+	// Without a limit, every error is reported.
+	status, _, stderr = toycc(input, "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Contains(stderr, "undefined identifier 'c'")
+	assert.NotContains(stderr, "too many errors")
+
+	status, _, stderr = toycc(input, "--max-errors=-1", "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, "invalid maximum number of errors -1")
+}
+
+func TestWerror(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main() { return 0; return 1; }"
+	status, stdout, stderr := toycc(input, "-Werror", "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Equal("", stdout)
+	assert.Contains(stderr, "-:1:24: error: unreachable code\n")
+
+	status, _, stderr = toycc(input, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stderr, "-:1:24: warning: unreachable code\n")
+}
+
+func TestSemanticError(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toycc("int main() { int a; int a; return b; }", "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Equal(`-:1:21: error: redefinition of 'a' (previously declared at 1:14)
+int main() { int a; int a; return b; }
+                    ^
+-:1:35: error: undefined identifier 'b'
+int main() { int a; int a; return b; }
+                                  ^
+`, stderr)
+}
+
+func TestIncludePath(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, text := range map[string]string{
+		"include/two.h":  "#define TWO 2\n",
+		"include/bad.h":  "int f() {\n  return y;\n}\n",
+		"include/open.h": "#ifdef TWO\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	include := filepath.Join(dir, "include")
+
+	status, stdout, _ := toycc("#include <two.h>\nint main() { return TWO; }",
+		"--dump-ast", "-I", include, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("int main() { return 2; }\n", stdout)
+
+	// The directory may be joined to the flag.
+	status, _, stderr := toycc("#include <two.h>\nint main() { return TWO; }",
+		"--dump-ast", "-I"+include, "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stderr)
+
+	// Preprocessing errors may be in included files.
+	status, _, stderr = toycc("#include <two.h>\n#include <open.h>\n", "-I", include, "-")
+	assert.Equal(exitLexicalError, status)
+	assert.Equal(filepath.Join(include, "open.h")+`:1:2: error: unterminated conditional directive
+#ifdef TWO
+ ^
+`, stderr)
+
+	status, _, stderr = toycc("#include <two.h>\n", "-")
+	assert.Equal(exitLexicalError, status)
+	assert.Equal(`-:1:10: error: 'two.h' file not found
+#include <two.h>
+         ^
+`, stderr)
+
+	// Diagnostics are in the file which the code came from.
+	status, _, stderr = toycc("#include \"bad.h\"\nint main() { return TWO; }",
+		"-I", include, "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Equal(filepath.Join(include, "bad.h")+`:2:10: error: undefined identifier 'y'
+  return y;
+         ^
+-:2:21: error: undefined identifier 'TWO'
+int main() { return TWO; }
+                    ^~~
+`, stderr)
+}
+
+func TestPreprocessingError(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toycc("#if 1\nint main() { return 0; }\n", "-")
+	assert.Equal(exitLexicalError, status)
+	assert.Equal("", stdout)
+	assert.Equal(`-:1:2: error: unterminated conditional directive
+#if 1
+ ^
+`, stderr)
+
+	// Errors after preprocessing are at the invocations of macros.
+	status, _, stderr = toycc("#define RETURN(x) return x + @;\nint main() {\n  RETURN(1)\n}", "-")
+	assert.Equal(exitLexicalError, status)
+	assert.Equal(`-:3:3: error: illegal character: `+"`@`"+`
+  RETURN(1)
+  ^
+`, stderr)
+}
+
+func TestPreprocessedInput(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "a.c")
+	if err := ioutil.WriteFile(source, []byte("#include \"a.h\"\nint main() {\n  return x;\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The output of a preprocessor, which is not preprocessed again.
+	preprocessed := "# 1 \"" + source + "\"\n# 1 \"a.h\" 1\nint y;\n# 2 \"" + source + "\" 2\nint main() {\n  return x;\n}\n"
+	input := filepath.Join(dir, "a.i")
+	if err := ioutil.WriteFile(input, []byte(preprocessed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, _, stderr := toycc("", "-o", "-", input)
+	assert.Equal(exitSemanticError, status)
+	assert.Equal(source+`:3:10: error: undefined identifier 'x'
+  return x;
+         ^
+`, stderr)
+
+	status, stdout, _ := toycc(preprocessed, "-fpreprocessed", "--dump-tokens", "-")
+	assert.Equal(exitSuccess, status)
+	assert.True(regexp.MustCompile(`(?m)^a\.h:1:1 +int +"int"$`).MatchString(stdout))
+	assert.True(regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(source) + `:2:1 +int +"int"$`).MatchString(stdout))
+
+	// A file named by a line directive need not exist.
+	status, _, stderr = toycc("#line 7 \"b.c\"\nint main() { return x; }", "-fpreprocessed", "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Equal("b.c:7:21: error: undefined identifier 'x'\n", stderr)
+
+	// JSON diagnostics are in the named file too.
+	status, _, stderr = toycc("#line 7 \"b.c\"\nint main() { return x; }",
+		"-fpreprocessed", "--diagnostics-format=json", "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Contains(stderr, `"file":"b.c","line":7,"column":21`)
+}
+
+func TestColor(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main() { return abc; }"
+	status, _, stderr := toycc(input, "--color=always", "-")
+	assert.Equal(exitSemanticError, status)
+	assert.Equal("\x1b[1m-:1:21:\x1b[0m \x1b[1;31merror:\x1b[0m "+
+		"\x1b[1mundefined identifier 'abc'\x1b[0m\n"+
+		"int main() { return abc; }\n"+
+		"                    \x1b[1m^~~\x1b[0m\n", stderr)
+
+	// Output which is not to a terminal is not colored by default.
+	for _, args := range [][]string{{"-"}, {"--color=auto", "-"}, {"--color=never", "-"}} {
+		_, _, stderr = toycc(input, args...)
+		assert.NotContains(stderr, "\x1b", args)
+	}
+
+	status, _, stderr = toycc(input, "--color=sometimes", "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr,
+		`invalid color mode "sometimes", expected one of auto, always, never`)
+}
+
+func TestJSONDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toycc("int main() { return 1; return abc; }",
+		"--diagnostics-format=json", "-")
+	assert.Equal(exitSemanticError, status)
+	assert.JSONEq(`[{"file": "-", "line": 1, "column": 31, "length": 3,
+		"severity": "error", "message": "undefined identifier 'abc'",
+		"code": "semantic"}]`, stderr)
+
+	status, _, stderr = toycc("int main() { return 1; return 2; }",
+		"--diagnostics-format=json", "-S", "-o", "/dev/null", "-")
+	assert.Equal(exitSuccess, status)
+	assert.JSONEq(`[{"file": "-", "line": 1, "column": 24,
+		"severity": "warning", "message": "unreachable code",
+		"code": "unreachable-code"}]`, stderr)
+
+	// Every lexical error is reported in a token dump.
+	status, _, stderr = toycc("@ $", "--dump-tokens", "--diagnostics-format=json", "-")
+	assert.Equal(exitLexicalError, status)
+	assert.JSONEq(`[
+		{"file": "-", "line": 1, "column": 1, "severity": "error",
+		 "message": "illegal character: `+"`@`"+`", "code": "lexical"},
+		{"file": "-", "line": 1, "column": 3, "severity": "error",
+		 "message": "illegal character: `+"`$`"+`", "code": "lexical"}]`, stderr)
+
+	// A successful compilation has no diagnostics.
+	status, _, stderr = toycc("int main() { return 0; }",
+		"--diagnostics-format=json", "-S", "-o", "/dev/null", "-")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("[]\n", stderr)
+
+	status, _, _ = toycc("", "--diagnostics-format=xml", "-")
+	assert.Equal(exitUsageError, status)
+}
+
+func TestUseColor(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.True(useColor(colorAlways, &b))
+	assert.False(useColor(colorNever, &b))
+	assert.False(useColor(colorAuto, &b))
+
+	// A regular file is not a terminal.
+	f, err := ioutil.TempFile("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	assert.False(useColor(colorAuto, f))
+}
+
+func TestUsageError(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toycc("")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, "expected an input file")
+
+	status, _, _ = toycc("", "--no-such-flag", "-")
+	assert.Equal(exitUsageError, status)
+}
+
+func TestCompileFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toycc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var inputs []string
+	for i, source := range []string{
+		"int main() { return 0; }",
+		"int f() { return a; }",
+		"int g() { return 2; }",
+		"int h() { return b; }",
+	} {
+		input := filepath.Join(dir, fmt.Sprintf("%d.c", i))
+		if err := ioutil.WriteFile(input, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, input)
+	}
+
+	// The diagnostics are in the order of the files, whichever finishes
+	// first.
+	status, _, stderr := toycc("", append([]string{"-S", "-j=4"}, inputs...)...)
+	assert.Equal(exitSemanticError, status)
+	assert.Equal(inputs[1]+":1:18: error: undefined identifier 'a'\n"+
+		"int f() { return a; }\n                 ^\n"+
+		inputs[3]+":1:18: error: undefined identifier 'b'\n"+
+		"int h() { return b; }\n                 ^\n", stderr)
+	for i, exists := range []bool{true, false, true, false} {
+		_, err := os.Stat(strings.TrimSuffix(inputs[i], ".c") + ".s")
+		assert.Equal(exists, err == nil, inputs[i])
+	}
+
+	// So is the output written to stdout.
+	status, stdout, _ := toycc("", "--dump-ast", "-j=2", inputs[2], inputs[0])
+	assert.Equal(exitSuccess, status)
+	assert.Equal("int g() { return 2; }\nint main() { return 0; }\n", stdout)
+
+	status, _, stderr = toycc("", "-S", inputs[0], inputs[2], "-o", "out.s")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, "cannot use -o with several input files, unless linking them")
+	status, _, stderr = toycc("", inputs[0], "-")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, "cannot read standard input with other input files")
+	status, _, stderr = toycc("", "-j=0", inputs[0])
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, "invalid number of jobs 0")
+}
+
+func TestMissingInputFile(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toycc("", "/no/such/file.c")
+	assert.Equal(exitFailure, status)
+	assert.Contains(stderr, "no such file")
+}
@@ -0,0 +1,26 @@
+int sum(int a[], int n) {
+    int s = 0;
+    for (int i = 0; i < n; i++)
+        s += a[i];
+    return s;
+}
+
+int trace(int m[][3]) {
+    return m[0][0] + m[1][1] + m[2][2];
+}
+
+int main() {
+    int a[5];
+    for (int i = 0; i < 5; i++)
+        a[i] = i * i;
+    int m[3][3];
+    for (int i = 0; i < 3; i++)
+        for (int j = 0; j < 3; j++)
+            m[i][j] = i * 3 + j;
+    double d[2];
+    d[0] = 1.5;
+    1[d] = d[0] * 2;
+    int *p = a + 1;
+    int *end = &a[5];
+    return sum(a, 5) + trace(m) + p[2] + (end - a) + d[1] + (&m[2] - m);
+}
@@ -0,0 +1,422 @@
+	.text
+	.globl sum
+sum:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movq %rdi, -8(%rbp)
+	movl %esi, -16(%rbp)
+	movq -8(%rbp), %rsi
+	movl -16(%rbp), %edi
+	movl $0, %eax
+	movl %eax, %r8d
+	movl $0, %eax
+	movl %eax, %r9d
+.Lsum.1:
+	movl %r9d, %eax
+	movl %edi, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %r10d
+	movl %r10d, %eax
+	cmpl $0, %eax
+	je .Lsum.4
+.Lsum.2:
+	movq %rsi, %rax
+	movl %r9d, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %r10
+	movq %r10, %rax
+	movl (%rax), %eax
+	movl %eax, %r10d
+	movl %r8d, %eax
+	movl %r10d, %ecx
+	addl %ecx, %eax
+	movl %eax, %r8d
+.Lsum.3:
+	movl %r9d, %eax
+	movl %eax, %r10d
+	movl %r9d, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %r9d
+	jmp .Lsum.1
+.Lsum.4:
+	movl %r8d, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl trace
+trace:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movq %rdi, -8(%rbp)
+	movq -8(%rbp), %rsi
+	movq %rsi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	imulq $12, %rcx
+	addq %rcx, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	imulq $12, %rcx
+	addq %rcx, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl (%rax), %eax
+	movl %eax, %r8d
+	movl %edi, %eax
+	movl %r8d, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movl $2, %ecx
+	movslq %ecx, %rcx
+	imulq $12, %rcx
+	addq %rcx, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $2, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %esi
+	movl %edi, %eax
+	movl %esi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $112, %rsp
+	movl $0, %eax
+	movl %eax, %esi
+.Lmain.1:
+	movl %esi, %eax
+	movl $5, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %edi
+	movl %edi, %eax
+	cmpl $0, %eax
+	je .Lmain.4
+.Lmain.2:
+	leaq -24(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl %esi, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rdi
+	movl %esi, %eax
+	movl %esi, %ecx
+	imull %ecx, %eax
+	movl %eax, %r8d
+	movq %rdi, %rax
+	movl %r8d, %ecx
+	movl %ecx, (%rax)
+.Lmain.3:
+	movl %esi, %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	jmp .Lmain.1
+.Lmain.4:
+	movl $0, %eax
+	movl %eax, %esi
+.Lmain.5:
+	movl %esi, %eax
+	movl $3, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %edi
+	movl %edi, %eax
+	cmpl $0, %eax
+	je .Lmain.12
+.Lmain.6:
+	movl $0, %eax
+	movl %eax, %edi
+.Lmain.7:
+	movl %edi, %eax
+	movl $3, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	je .Lmain.10
+.Lmain.8:
+	leaq -64(%rbp), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl %esi, %ecx
+	movslq %ecx, %rcx
+	imulq $12, %rcx
+	addq %rcx, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl %edi, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %r8
+	movl %esi, %eax
+	movl $3, %ecx
+	imull %ecx, %eax
+	movl %eax, %r9d
+	movl %r9d, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %r9d
+	movq %r8, %rax
+	movl %r9d, %ecx
+	movl %ecx, (%rax)
+.Lmain.9:
+	movl %edi, %eax
+	movl %eax, %r8d
+	movl %edi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	jmp .Lmain.7
+.Lmain.10:
+.Lmain.11:
+	movl %esi, %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	jmp .Lmain.5
+.Lmain.12:
+	leaq -80(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movsd .LC0(%rip), %xmm1
+	movsd %xmm1, (%rax)
+	leaq -80(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rsi
+	leaq -80(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movsd (%rax), %xmm0
+	movaps %xmm0, %xmm2
+	movl $2, %eax
+	cvtsi2sdl %eax, %xmm0
+	movaps %xmm0, %xmm3
+	movaps %xmm2, %xmm0
+	movaps %xmm3, %xmm1
+	mulsd %xmm1, %xmm0
+	movaps %xmm0, %xmm2
+	movq %rsi, %rax
+	movaps %xmm2, %xmm1
+	movsd %xmm1, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	leaq -24(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl $5, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	leaq -24(%rbp), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %rsi, -88(%rbp)
+	movq %rdi, -96(%rbp)
+	subq $16, %rsp
+	movq %r8, %rax
+	movq %rax, (%rsp)
+	movl $5, %eax
+	movl %eax, 8(%rsp)
+	movq (%rsp), %rdi
+	movl 8(%rsp), %esi
+	movl $0, %eax
+	call sum
+	addq $16, %rsp
+	movq -88(%rbp), %rsi
+	movq -96(%rbp), %rdi
+	movl %eax, %r8d
+	leaq -64(%rbp), %rax
+	movq %rax, %r9
+	movq %r9, %rax
+	movq %rax, %r9
+	movq %rsi, -88(%rbp)
+	movq %rdi, -96(%rbp)
+	movq %r8, -104(%rbp)
+	subq $16, %rsp
+	movq %r9, %rax
+	movq %rax, (%rsp)
+	movq (%rsp), %rdi
+	movl $0, %eax
+	call trace
+	addq $16, %rsp
+	movq -88(%rbp), %rsi
+	movq -96(%rbp), %rdi
+	movq -104(%rbp), %r8
+	movl %eax, %r9d
+	movl %r8d, %eax
+	movl %r9d, %ecx
+	addl %ecx, %eax
+	movl %eax, %r8d
+	movq %rsi, %rax
+	movl $2, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %esi
+	movl %r8d, %eax
+	movl %esi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	leaq -24(%rbp), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %rdi, %rax
+	movq %r8, %rcx
+	subq %rcx, %rax
+	sarq $2, %rax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	cvtsi2sdl %eax, %xmm0
+	movaps %xmm0, %xmm2
+	leaq -80(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movsd (%rax), %xmm0
+	movaps %xmm0, %xmm3
+	movaps %xmm2, %xmm0
+	movaps %xmm3, %xmm1
+	addsd %xmm1, %xmm0
+	movaps %xmm0, %xmm2
+	leaq -64(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $2, %ecx
+	movslq %ecx, %rcx
+	imulq $12, %rcx
+	addq %rcx, %rax
+	movq %rax, %rsi
+	leaq -64(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rsi, %rax
+	movq %rdi, %rcx
+	subq %rcx, %rax
+	movq $12, %rcx
+	cqto
+	idivq %rcx
+	movl %eax, %esi
+	movl %esi, %eax
+	cvtsi2sdl %eax, %xmm0
+	movaps %xmm0, %xmm3
+	movaps %xmm2, %xmm0
+	movaps %xmm3, %xmm1
+	addsd %xmm1, %xmm0
+	movaps %xmm0, %xmm2
+	movaps %xmm2, %xmm0
+	cvttsd2si %xmm0, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .rodata
+	.align 8
+.LC0:
+	.quad 0x3ff8000000000000
+	.section .note.GNU-stack,"",@progbits
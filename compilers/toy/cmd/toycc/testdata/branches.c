@@ -0,0 +1,36 @@
+// Branches on conditions which are constant, once constants are propagated
+// through variables and loops, are eliminated at -O=2.
+int verbose = 0;
+
+int count(int n) {
+  int step = 1;
+  int total = 0;
+  while (n > 0) {
+    // step is 1 on every iteration, so the else branch is never taken.
+    if (step == 1)
+      total = total + step;
+    else
+      total = total * 2;
+    n = n - 1;
+  }
+  return total;
+}
+
+int mode() {
+  int debug = 0;
+  int level = 2;
+  if (debug)
+    level = level + 1;
+  switch (level) {
+  case 1:
+    return verbose;
+  case 2:
+    return 20;
+  default:
+    return 30;
+  }
+}
+
+int main() {
+  return count(3) + mode();
+}
@@ -0,0 +1,142 @@
+	.text
+	.globl count
+count:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movl %edi, -8(%rbp)
+	movl -8(%rbp), %esi
+	movl $1, %eax
+	movl %eax, %edi
+	movl $0, %eax
+	movl %eax, %r8d
+.Lcount.1:
+	movl %esi, %eax
+	movl $0, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setg %al
+	movl %eax, %r9d
+	movl %r9d, %eax
+	cmpl $0, %eax
+	je .Lcount.6
+.Lcount.2:
+	movl %edi, %eax
+	movl $1, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	sete %al
+	movl %eax, %r9d
+	movl %r9d, %eax
+	cmpl $0, %eax
+	je .Lcount.4
+.Lcount.3:
+	movl %r8d, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %r9d
+	movl %r9d, %eax
+	movl %eax, %r8d
+	jmp .Lcount.5
+.Lcount.4:
+	movl %r8d, %eax
+	movl $2, %ecx
+	imull %ecx, %eax
+	movl %eax, %r9d
+	movl %r9d, %eax
+	movl %eax, %r8d
+.Lcount.5:
+	movl %esi, %eax
+	movl $1, %ecx
+	subl %ecx, %eax
+	movl %eax, %r9d
+	movl %r9d, %eax
+	movl %eax, %esi
+	jmp .Lcount.1
+.Lcount.6:
+	movl %r8d, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl mode
+mode:
+	pushq %rbp
+	movq %rsp, %rbp
+	movl $0, %eax
+	movl %eax, %esi
+	movl $2, %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	cmpl $0, %eax
+	je .Lmode.2
+.Lmode.1:
+	movl %edi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movl %eax, %edi
+.Lmode.2:
+	movl %edi, %eax
+	cmpl $1, %eax
+	je .Lmode.3
+	cmpl $2, %eax
+	je .Lmode.4
+	jmp .Lmode.5
+.Lmode.3:
+	leaq verbose(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lmode.4:
+	movl $20, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lmode.5:
+	movl $30, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lmode.6:
+	movl $0, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	subq $16, %rsp
+	movl $3, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call count
+	addq $16, %rsp
+	movl %eax, %esi
+	movq %rsi, -8(%rbp)
+	movl $0, %eax
+	call mode
+	movq -8(%rbp), %rsi
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.bss
+	.globl verbose
+	.align 4
+verbose:
+	.zero 4
+	.section .note.GNU-stack,"",@progbits
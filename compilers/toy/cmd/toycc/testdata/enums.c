@@ -0,0 +1,29 @@
+enum direction { NORTH, EAST, SOUTH, WEST };
+
+enum {
+    STEPS = 4,
+    LIMIT = STEPS * 2 - 1,
+};
+
+int visits[WEST + 1];
+
+enum direction turn(enum direction d) {
+    switch (d) {
+    case NORTH:
+        return EAST;
+    case EAST:
+        return SOUTH;
+    case SOUTH:
+        return WEST;
+    }
+    return NORTH;
+}
+
+int main() {
+    enum direction d = NORTH;
+    for (int i = 0; i < LIMIT; i++) {
+        visits[d]++;
+        d = turn(d);
+    }
+    return visits[NORTH] * 10 + d + sizeof visits / sizeof(enum direction);
+}
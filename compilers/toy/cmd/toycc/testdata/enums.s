@@ -0,0 +1,135 @@
+	.text
+	.globl turn
+turn:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movl %edi, -8(%rbp)
+	movl -8(%rbp), %esi
+	movl %esi, %eax
+	cmpl $0, %eax
+	je .Lturn.1
+	cmpl $1, %eax
+	je .Lturn.2
+	cmpl $2, %eax
+	je .Lturn.3
+	jmp .Lturn.4
+.Lturn.1:
+	movl $1, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lturn.2:
+	movl $2, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lturn.3:
+	movl $3, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lturn.4:
+	movl $0, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movl $0, %eax
+	movl %eax, %esi
+	movl $0, %eax
+	movl %eax, %edi
+.Lmain.1:
+	movl %edi, %eax
+	movl $7, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	je .Lmain.4
+.Lmain.2:
+	leaq visits(%rip), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl %esi, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl (%rax), %eax
+	movl %eax, %r9d
+	movl %r9d, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %r9d
+	movq %r8, %rax
+	movl %r9d, %ecx
+	movl %ecx, (%rax)
+	movq %rdi, -8(%rbp)
+	subq $16, %rsp
+	movl %esi, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call turn
+	addq $16, %rsp
+	movq -8(%rbp), %rdi
+	movl %eax, %r8d
+	movl %r8d, %eax
+	movl %eax, %esi
+.Lmain.3:
+	movl %edi, %eax
+	movl %eax, %r8d
+	movl %edi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	jmp .Lmain.1
+.Lmain.4:
+	leaq visits(%rip), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl $10, %ecx
+	imull %ecx, %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl %esi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl $16, %eax
+	movl $4, %ecx
+	cltd
+	idivl %ecx
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.bss
+	.globl visits
+	.align 4
+visits:
+	.zero 16
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,9 @@
+// Operators at each level of precedence.
+int main() {
+  int a = 7;
+  int b = 3;
+  int c = a * b + a / b - a % b;
+  c = c << 2 | a & b ^ ~a;
+  c += a < b || a >= b && !(a == b);
+  return c > 0 ? c : -c;
+}
@@ -0,0 +1,129 @@
+	.text
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	movl $7, %eax
+	movl %eax, %esi
+	movl $3, %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	imull %ecx, %eax
+	movl %eax, %r8d
+	movl %esi, %eax
+	movl %edi, %ecx
+	cltd
+	idivl %ecx
+	movl %eax, %r9d
+	movl %r8d, %eax
+	movl %r9d, %ecx
+	addl %ecx, %eax
+	movl %eax, %r8d
+	movl %esi, %eax
+	movl %edi, %ecx
+	cltd
+	idivl %ecx
+	movl %edx, %eax
+	movl %eax, %r9d
+	movl %r8d, %eax
+	movl %r9d, %ecx
+	subl %ecx, %eax
+	movl %eax, %r8d
+	movl %r8d, %eax
+	movl %eax, %r8d
+	movl %r8d, %eax
+	movl $2, %ecx
+	sall %cl, %eax
+	movl %eax, %r9d
+	movl %esi, %eax
+	movl %edi, %ecx
+	andl %ecx, %eax
+	movl %eax, %r10d
+	movl %esi, %eax
+	notl %eax
+	movl %eax, %r11d
+	movl %r10d, %eax
+	movl %r11d, %ecx
+	xorl %ecx, %eax
+	movl %eax, %r10d
+	movl %r9d, %eax
+	movl %r10d, %ecx
+	orl %ecx, %eax
+	movl %eax, %r9d
+	movl %r9d, %eax
+	movl %eax, %r8d
+	movl %esi, %eax
+	movl %edi, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %r9d
+	movl $1, %eax
+	movl %eax, %r10d
+	movl %r9d, %eax
+	cmpl $0, %eax
+	jne .Lmain.4
+.Lmain.1:
+	movl %esi, %eax
+	movl %edi, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setge %al
+	movl %eax, %r9d
+	movl $0, %eax
+	movl %eax, %r11d
+	movl %r9d, %eax
+	cmpl $0, %eax
+	je .Lmain.3
+.Lmain.2:
+	movl %esi, %eax
+	movl %edi, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	sete %al
+	movl %eax, %esi
+	movl %esi, %eax
+	movl $0, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	sete %al
+	movl %eax, %esi
+	movl %esi, %eax
+	movl $0, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setne %al
+	movl %eax, %r11d
+.Lmain.3:
+	movl %r11d, %eax
+	movl $0, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setne %al
+	movl %eax, %r10d
+.Lmain.4:
+	movl %r8d, %eax
+	movl %r10d, %ecx
+	addl %ecx, %eax
+	movl %eax, %r8d
+	movl %r8d, %eax
+	movl $0, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setg %al
+	movl %eax, %esi
+	movl %r8d, %eax
+	negl %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	cmpl $0, %eax
+	movl %edi, %eax
+	movl %r8d, %ecx
+	cmovne %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,16 @@
+int fib(int n);
+
+double scale(double x, float y) {
+  return x * y;
+}
+
+int main() {
+  int d = scale(1.5, 2.0f);
+  return fib(10) + d;
+}
+
+int fib(int n) {
+  if (n < 2)
+    return n;
+  return fib(n - 1) + fib(n - 2);
+}
@@ -0,0 +1,126 @@
+	.text
+	.globl scale
+scale:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movsd %xmm0, -8(%rbp)
+	movss %xmm1, -16(%rbp)
+	movsd -8(%rbp), %xmm2
+	movss -16(%rbp), %xmm3
+	movaps %xmm3, %xmm0
+	cvtss2sd %xmm0, %xmm0
+	movaps %xmm0, %xmm3
+	movaps %xmm2, %xmm0
+	movaps %xmm3, %xmm1
+	mulsd %xmm1, %xmm0
+	movaps %xmm0, %xmm2
+	movaps %xmm2, %xmm0
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	subq $16, %rsp
+	movsd .LC0(%rip), %xmm0
+	movsd %xmm0, (%rsp)
+	movss .LC1(%rip), %xmm0
+	movss %xmm0, 8(%rsp)
+	movsd (%rsp), %xmm0
+	movss 8(%rsp), %xmm1
+	movl $2, %eax
+	call scale
+	addq $16, %rsp
+	movaps %xmm0, %xmm2
+	movaps %xmm2, %xmm0
+	cvttsd2si %xmm0, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movl %eax, %esi
+	movq %rsi, -8(%rbp)
+	subq $16, %rsp
+	movl $10, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call fib
+	addq $16, %rsp
+	movq -8(%rbp), %rsi
+	movl %eax, %edi
+	movl %edi, %eax
+	movl %esi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl fib
+fib:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $32, %rsp
+	movl %edi, -24(%rbp)
+	movl -24(%rbp), %esi
+	movl %esi, %eax
+	movl $2, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %edi
+	movl %edi, %eax
+	cmpl $0, %eax
+	je .Lfib.2
+.Lfib.1:
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lfib.2:
+	movl %esi, %eax
+	movl $1, %ecx
+	subl %ecx, %eax
+	movl %eax, %edi
+	movq %rsi, -8(%rbp)
+	subq $16, %rsp
+	movl %edi, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call fib
+	addq $16, %rsp
+	movq -8(%rbp), %rsi
+	movl %eax, %edi
+	movl %esi, %eax
+	movl $2, %ecx
+	subl %ecx, %eax
+	movl %eax, %esi
+	movq %rdi, -16(%rbp)
+	subq $16, %rsp
+	movl %esi, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call fib
+	addq $16, %rsp
+	movq -16(%rbp), %rdi
+	movl %eax, %esi
+	movl %edi, %eax
+	movl %esi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .rodata
+	.align 8
+.LC0:
+	.quad 0x3ff8000000000000
+	.align 4
+.LC1:
+	.long 0x40000000
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,28 @@
+int counter = 10;
+int limit = -(1 << 3) + 20;
+float ratio = 0.5;
+double scale = -2.25;
+int table[4];
+int *last;
+
+struct pair {
+    int a;
+    int b;
+};
+
+struct pair totals;
+
+int next() {
+    counter++;
+    return counter;
+}
+
+int main() {
+    for (int i = 0; i < 4; i++) {
+        table[i] = next();
+        last = &table[i];
+    }
+    totals.a = table[0] + table[3];
+    totals.b = *last;
+    return totals.a + totals.b + limit * ratio + scale * 4;
+}
@@ -0,0 +1,237 @@
+	.text
+	.globl next
+next:
+	pushq %rbp
+	movq %rsp, %rbp
+	leaq counter(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movl %edi, %ecx
+	movl %ecx, (%rax)
+	leaq counter(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movl $0, %eax
+	movl %eax, %esi
+.Lmain.1:
+	movl %esi, %eax
+	movl $4, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %edi
+	movl %edi, %eax
+	cmpl $0, %eax
+	je .Lmain.4
+.Lmain.2:
+	leaq table(%rip), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl %esi, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rdi
+	movq %rsi, -8(%rbp)
+	movq %rdi, -16(%rbp)
+	movl $0, %eax
+	call next
+	movq -8(%rbp), %rsi
+	movq -16(%rbp), %rdi
+	movl %eax, %r8d
+	movq %rdi, %rax
+	movl %r8d, %ecx
+	movl %ecx, (%rax)
+	leaq last(%rip), %rax
+	movq %rax, %rdi
+	leaq table(%rip), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl %esi, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %r8
+	movq %rdi, %rax
+	movq %r8, %rcx
+	movq %rcx, (%rax)
+.Lmain.3:
+	movl %esi, %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	jmp .Lmain.1
+.Lmain.4:
+	leaq totals(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	leaq table(%rip), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	leaq table(%rip), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl $3, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl (%rax), %eax
+	movl %eax, %r8d
+	movl %edi, %eax
+	movl %r8d, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movl %edi, %ecx
+	movl %ecx, (%rax)
+	leaq totals(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	addq $4, %rax
+	movq %rax, %rsi
+	leaq last(%rip), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq (%rax), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movl %edi, %ecx
+	movl %ecx, (%rax)
+	leaq totals(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %esi
+	leaq totals(%rip), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	addq $4, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	cvtsi2ssl %eax, %xmm0
+	movaps %xmm0, %xmm2
+	leaq limit(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	cvtsi2ssl %eax, %xmm0
+	movaps %xmm0, %xmm3
+	leaq ratio(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movss (%rax), %xmm0
+	movaps %xmm0, %xmm4
+	movaps %xmm3, %xmm0
+	movaps %xmm4, %xmm1
+	mulss %xmm1, %xmm0
+	movaps %xmm0, %xmm3
+	movaps %xmm2, %xmm0
+	movaps %xmm3, %xmm1
+	addss %xmm1, %xmm0
+	movaps %xmm0, %xmm2
+	movaps %xmm2, %xmm0
+	cvtss2sd %xmm0, %xmm0
+	movaps %xmm0, %xmm2
+	leaq scale(%rip), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movsd (%rax), %xmm0
+	movaps %xmm0, %xmm3
+	movl $4, %eax
+	cvtsi2sdl %eax, %xmm0
+	movaps %xmm0, %xmm4
+	movaps %xmm3, %xmm0
+	movaps %xmm4, %xmm1
+	mulsd %xmm1, %xmm0
+	movaps %xmm0, %xmm3
+	movaps %xmm2, %xmm0
+	movaps %xmm3, %xmm1
+	addsd %xmm1, %xmm0
+	movaps %xmm0, %xmm2
+	movaps %xmm2, %xmm0
+	cvttsd2si %xmm0, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.data
+	.globl counter
+	.align 4
+counter:
+	.long 10
+	.globl limit
+	.align 4
+limit:
+	.long 12
+	.globl ratio
+	.align 4
+ratio:
+	.long 0x3f000000
+	.globl scale
+	.align 8
+scale:
+	.quad 0xc002000000000000
+	.bss
+	.globl table
+	.align 4
+table:
+	.zero 16
+	.globl last
+	.align 8
+last:
+	.zero 8
+	.globl totals
+	.align 4
+totals:
+	.zero 8
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,29 @@
+int find(int *a, int n, int x) {
+    for (int i = 0; i < n; i++) {
+        for (int j = 0; j < n; j++) {
+            if (a[i] + a[j] == x)
+                goto found;
+        }
+    }
+    return -1;
+found:
+    return x;
+}
+
+int main() {
+    int a[4];
+    int i = 0;
+loop:
+    a[i] = i * 3;
+    i++;
+    if (i < 4)
+        goto loop;
+    int total = 0;
+    goto first;
+    while (total < 20) {
+        total = total + 2;
+    first:
+        total = total + find(a, 4, 9);
+    }
+    return total;
+}
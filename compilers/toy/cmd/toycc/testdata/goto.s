@@ -0,0 +1,199 @@
+	.text
+	.globl find
+find:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $32, %rsp
+	movq %rbx, -8(%rbp)
+	movq %rdi, -16(%rbp)
+	movl %esi, -24(%rbp)
+	movl %edx, -32(%rbp)
+	movq -16(%rbp), %rsi
+	movl -24(%rbp), %edi
+	movl -32(%rbp), %r8d
+	movl $0, %eax
+	movl %eax, %r9d
+.Lfind.1:
+	movl %r9d, %eax
+	movl %edi, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %r10d
+	movl %r10d, %eax
+	cmpl $0, %eax
+	je .Lfind.10
+.Lfind.2:
+	movl $0, %eax
+	movl %eax, %r10d
+.Lfind.3:
+	movl %r10d, %eax
+	movl %edi, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %r11d
+	movl %r11d, %eax
+	cmpl $0, %eax
+	je .Lfind.8
+.Lfind.4:
+	movq %rsi, %rax
+	movl %r9d, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %r11
+	movq %r11, %rax
+	movl (%rax), %eax
+	movl %eax, %r11d
+	movq %rsi, %rax
+	movl %r10d, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rbx
+	movq %rbx, %rax
+	movl (%rax), %eax
+	movl %eax, %ebx
+	movl %r11d, %eax
+	movl %ebx, %ecx
+	addl %ecx, %eax
+	movl %eax, %r11d
+	movl %r11d, %eax
+	movl %r8d, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	sete %al
+	movl %eax, %r11d
+	movl %r11d, %eax
+	cmpl $0, %eax
+	je .Lfind.6
+.Lfind.5:
+	jmp .Lfind.11
+.Lfind.6:
+.Lfind.7:
+	movl %r10d, %eax
+	movl %eax, %r11d
+	movl %r10d, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %r10d
+	jmp .Lfind.3
+.Lfind.8:
+.Lfind.9:
+	movl %r9d, %eax
+	movl %eax, %r10d
+	movl %r9d, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %r9d
+	jmp .Lfind.1
+.Lfind.10:
+	movl $1, %eax
+	negl %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq -8(%rbp), %rbx
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lfind.11:
+	movl %r8d, %eax
+	movq -8(%rbp), %rbx
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $32, %rsp
+	movl $0, %eax
+	movl %eax, %esi
+.Lmain.1:
+	leaq -16(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl %esi, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rdi
+	movl %esi, %eax
+	movl $3, %ecx
+	imull %ecx, %eax
+	movl %eax, %r8d
+	movq %rdi, %rax
+	movl %r8d, %ecx
+	movl %ecx, (%rax)
+	movl %esi, %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movl $4, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %edi
+	movl %edi, %eax
+	cmpl $0, %eax
+	je .Lmain.3
+.Lmain.2:
+	jmp .Lmain.1
+.Lmain.3:
+	movl $0, %eax
+	movl %eax, %esi
+	jmp .Lmain.6
+.Lmain.4:
+	movl %esi, %eax
+	movl $20, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %edi
+	movl %edi, %eax
+	cmpl $0, %eax
+	je .Lmain.7
+.Lmain.5:
+	movl %esi, %eax
+	movl $2, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl %eax, %esi
+.Lmain.6:
+	leaq -16(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rsi, -24(%rbp)
+	subq $32, %rsp
+	movq %rdi, %rax
+	movq %rax, (%rsp)
+	movl $4, %eax
+	movl %eax, 8(%rsp)
+	movl $9, %eax
+	movl %eax, 16(%rsp)
+	movq (%rsp), %rdi
+	movl 8(%rsp), %esi
+	movl 16(%rsp), %edx
+	movl $0, %eax
+	call find
+	addq $32, %rsp
+	movq -24(%rbp), %rsi
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl %eax, %esi
+	jmp .Lmain.4
+.Lmain.7:
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,18 @@
+int main() {
+  int sum = 0;
+  for (int i = 0; i < 10; i++) {
+    if (i % 2 == 0)
+      continue;
+    sum += i;
+  }
+  int n = 100;
+  while (n > 1) {
+    n /= 2;
+    if (n == 3)
+      break;
+  }
+  do {
+    sum--;
+  } while (sum > 20);
+  return sum + n;
+}
@@ -0,0 +1,110 @@
+	.text
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	movl $0, %eax
+	movl %eax, %esi
+	movl $0, %eax
+	movl %eax, %edi
+.Lmain.1:
+	movl %edi, %eax
+	movl $10, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setl %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	je .Lmain.6
+.Lmain.2:
+	movl %edi, %eax
+	movl $2, %ecx
+	cltd
+	idivl %ecx
+	movl %edx, %eax
+	movl %eax, %r8d
+	movl %r8d, %eax
+	movl $0, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	sete %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	je .Lmain.4
+.Lmain.3:
+	jmp .Lmain.5
+.Lmain.4:
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+.Lmain.5:
+	movl %edi, %eax
+	movl %eax, %r8d
+	movl %edi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	jmp .Lmain.1
+.Lmain.6:
+	movl $100, %eax
+	movl %eax, %edi
+.Lmain.7:
+	movl %edi, %eax
+	movl $1, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setg %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	je .Lmain.11
+.Lmain.8:
+	movl %edi, %eax
+	movl $2, %ecx
+	cltd
+	idivl %ecx
+	movl %eax, %edi
+	movl %edi, %eax
+	movl $3, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	sete %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	je .Lmain.10
+.Lmain.9:
+	jmp .Lmain.11
+.Lmain.10:
+	jmp .Lmain.7
+.Lmain.11:
+.Lmain.12:
+	movl %esi, %eax
+	movl %eax, %r8d
+	movl %esi, %eax
+	movl $1, %ecx
+	subl %ecx, %eax
+	movl %eax, %esi
+.Lmain.13:
+	movl %esi, %eax
+	movl $20, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setg %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	jne .Lmain.12
+.Lmain.14:
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .note.GNU-stack,"",@progbits
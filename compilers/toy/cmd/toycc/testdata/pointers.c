@@ -0,0 +1,21 @@
+int swap(int *a, int *b) {
+  int t = *a;
+  *a = *b;
+  *b = t;
+  return t;
+}
+
+int *larger(int *a, int *b) {
+  return *a > *b ? a : b;
+}
+
+int main() {
+  int x = 3;
+  int y = 5;
+  swap(&x, &y);
+  int *p = larger(&x, &y);
+  *p += 10;
+  int **pp = &p;
+  (**pp)++;
+  return x * 2 + y + (p == &x) + (p + 1 > p);
+}
@@ -0,0 +1,208 @@
+	.text
+	.globl swap
+swap:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movq %rdi, -8(%rbp)
+	movq %rsi, -16(%rbp)
+	movq -8(%rbp), %rsi
+	movq -16(%rbp), %rdi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %r8d
+	movl %r8d, %eax
+	movl %eax, %r8d
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %r9d
+	movq %rsi, %rax
+	movl %r9d, %ecx
+	movl %ecx, (%rax)
+	movq %rdi, %rax
+	movl %r8d, %ecx
+	movl %ecx, (%rax)
+	movl %r8d, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl larger
+larger:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movq %rdi, -8(%rbp)
+	movq %rsi, -16(%rbp)
+	movq -8(%rbp), %rsi
+	movq -16(%rbp), %rdi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %r8d
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %r9d
+	movl %r8d, %eax
+	movl %r9d, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setg %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	movq %rdi, %rax
+	movq %rsi, %rcx
+	cmovne %rcx, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $32, %rsp
+	leaq -8(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $3, %ecx
+	movl %ecx, (%rax)
+	leaq -16(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $5, %ecx
+	movl %ecx, (%rax)
+	leaq -8(%rbp), %rax
+	movq %rax, %rsi
+	leaq -16(%rbp), %rax
+	movq %rax, %rdi
+	subq $16, %rsp
+	movq %rsi, %rax
+	movq %rax, (%rsp)
+	movq %rdi, %rax
+	movq %rax, 8(%rsp)
+	movq (%rsp), %rdi
+	movq 8(%rsp), %rsi
+	movl $0, %eax
+	call swap
+	addq $16, %rsp
+	movl %eax, %esi
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	leaq -8(%rbp), %rax
+	movq %rax, %rdi
+	leaq -16(%rbp), %rax
+	movq %rax, %r8
+	movq %rsi, -32(%rbp)
+	subq $16, %rsp
+	movq %rdi, %rax
+	movq %rax, (%rsp)
+	movq %r8, %rax
+	movq %rax, 8(%rsp)
+	movq (%rsp), %rdi
+	movq 8(%rsp), %rsi
+	movl $0, %eax
+	call larger
+	addq $16, %rsp
+	movq -32(%rbp), %rsi
+	movq %rax, %rdi
+	movq %rsi, %rax
+	movq %rdi, %rcx
+	movq %rcx, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq (%rax), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl $10, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movl %edi, %ecx
+	movl %ecx, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq (%rax), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movl %edi, %ecx
+	movl %ecx, (%rax)
+	leaq -8(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movl $2, %ecx
+	imull %ecx, %eax
+	movl %eax, %esi
+	leaq -16(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	leaq -24(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq (%rax), %rax
+	movq %rax, %rdi
+	leaq -8(%rbp), %rax
+	movq %rax, %r8
+	movq %rdi, %rax
+	movq %r8, %rcx
+	cmpq %rcx, %rax
+	movl $0, %eax
+	sete %al
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	leaq -24(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq (%rax), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,4), %rax
+	movq %rax, %rdi
+	leaq -24(%rbp), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq (%rax), %rax
+	movq %rax, %r8
+	movq %rdi, %rax
+	movq %r8, %rcx
+	cmpq %rcx, %rax
+	movl $0, %eax
+	seta %al
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .note.GNU-stack,"",@progbits
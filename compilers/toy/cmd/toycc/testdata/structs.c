@@ -0,0 +1,48 @@
+struct point {
+    int x;
+    int y;
+};
+
+struct node {
+    int value;
+    struct node *next;
+};
+
+struct shape {
+    struct point corners[2];
+    double scale;
+};
+
+int area(struct shape *s) {
+    int w = s->corners[1].x - s->corners[0].x;
+    int h = s->corners[1].y - s->corners[0].y;
+    return w * h * s->scale;
+}
+
+int sum(struct node *n) {
+    int s = 0;
+    for (; n != 0; n = n->next)
+        s += n->value;
+    return s;
+}
+
+int main() {
+    struct shape s;
+    s.corners[0].x = 1;
+    s.corners[0].y = 2;
+    s.corners[1].x = 4;
+    s.corners[1].y = 6;
+    s.scale = 1.5;
+    struct node a;
+    struct node b;
+    struct node c;
+    a.value = 3;
+    a.next = &b;
+    b.value = 5;
+    b.next = &c;
+    c.value = 7;
+    c.next = 0;
+    struct point *p = &s.corners[1];
+    p->x++;
+    return area(&s) + sum(&a) + (&s.corners[0])->y;
+}
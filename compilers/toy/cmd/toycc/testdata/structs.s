@@ -0,0 +1,355 @@
+	.text
+	.globl area
+area:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movq %rdi, -8(%rbp)
+	movq -8(%rbp), %rsi
+	movq %rsi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl (%rax), %eax
+	movl %eax, %r8d
+	movl %edi, %eax
+	movl %r8d, %ecx
+	subl %ecx, %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	addq $4, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl (%rax), %eax
+	movl %eax, %r8d
+	movq %rsi, %rax
+	movq %rax, %r9
+	movq %r9, %rax
+	movq %rax, %r9
+	movq %r9, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %r9
+	movq %r9, %rax
+	addq $4, %rax
+	movq %rax, %r9
+	movq %r9, %rax
+	movl (%rax), %eax
+	movl %eax, %r9d
+	movl %r8d, %eax
+	movl %r9d, %ecx
+	subl %ecx, %eax
+	movl %eax, %r8d
+	movl %r8d, %eax
+	movl %eax, %r8d
+	movl %edi, %eax
+	movl %r8d, %ecx
+	imull %ecx, %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	cvtsi2sdl %eax, %xmm0
+	movaps %xmm0, %xmm2
+	movq %rsi, %rax
+	addq $16, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movsd (%rax), %xmm0
+	movaps %xmm0, %xmm3
+	movaps %xmm2, %xmm0
+	movaps %xmm3, %xmm1
+	mulsd %xmm1, %xmm0
+	movaps %xmm0, %xmm2
+	movaps %xmm2, %xmm0
+	cvttsd2si %xmm0, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl sum
+sum:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movq %rdi, -8(%rbp)
+	movq -8(%rbp), %rsi
+	movl $0, %eax
+	movl %eax, %edi
+.Lsum.1:
+	movq %rsi, %rax
+	movq $0, %rcx
+	cmpq %rcx, %rax
+	movl $0, %eax
+	setne %al
+	movl %eax, %r8d
+	movl %r8d, %eax
+	cmpl $0, %eax
+	je .Lsum.4
+.Lsum.2:
+	movq %rsi, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movl (%rax), %eax
+	movl %eax, %r8d
+	movl %edi, %eax
+	movl %r8d, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+.Lsum.3:
+	movq %rsi, %rax
+	addq $8, %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq (%rax), %rax
+	movq %rax, %r8
+	movq %r8, %rax
+	movq %rax, %rsi
+	jmp .Lsum.1
+.Lsum.4:
+	movl %edi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $80, %rsp
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $1, %ecx
+	movl %ecx, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	addq $4, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $2, %ecx
+	movl %ecx, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $4, %ecx
+	movl %ecx, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	addq $4, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $6, %ecx
+	movl %ecx, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	addq $16, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movsd .LC0(%rip), %xmm1
+	movsd %xmm1, (%rax)
+	leaq -40(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $3, %ecx
+	movl %ecx, (%rax)
+	leaq -40(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	addq $8, %rax
+	movq %rax, %rsi
+	leaq -56(%rbp), %rax
+	movq %rax, %rdi
+	movq %rsi, %rax
+	movq %rdi, %rcx
+	movq %rcx, (%rax)
+	leaq -56(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $5, %ecx
+	movl %ecx, (%rax)
+	leaq -56(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	addq $8, %rax
+	movq %rax, %rsi
+	leaq -72(%rbp), %rax
+	movq %rax, %rdi
+	movq %rsi, %rax
+	movq %rdi, %rcx
+	movq %rcx, (%rax)
+	leaq -72(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $7, %ecx
+	movl %ecx, (%rax)
+	leaq -72(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	addq $8, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq $0, %rcx
+	movq %rcx, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl $1, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movq %rax, %rsi
+	movq %rsi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl $1, %ecx
+	addl %ecx, %eax
+	movl %eax, %edi
+	movq %rsi, %rax
+	movl %edi, %ecx
+	movl %ecx, (%rax)
+	leaq -24(%rbp), %rax
+	movq %rax, %rsi
+	subq $16, %rsp
+	movq %rsi, %rax
+	movq %rax, (%rsp)
+	movq (%rsp), %rdi
+	movl $0, %eax
+	call area
+	addq $16, %rsp
+	movl %eax, %esi
+	leaq -40(%rbp), %rax
+	movq %rax, %rdi
+	movq %rsi, -80(%rbp)
+	subq $16, %rsp
+	movq %rdi, %rax
+	movq %rax, (%rsp)
+	movq (%rsp), %rdi
+	movl $0, %eax
+	call sum
+	addq $16, %rsp
+	movq -80(%rbp), %rsi
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	leaq -24(%rbp), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl $0, %ecx
+	movslq %ecx, %rcx
+	leaq (%rax,%rcx,8), %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	addq $4, %rax
+	movq %rax, %rdi
+	movq %rdi, %rax
+	movl (%rax), %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .rodata
+	.align 8
+.LC0:
+	.quad 0x3ff8000000000000
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,19 @@
+int classify(int x) {
+  switch (x) {
+  case 0:
+    return 10;
+  case 1:
+  case 2:
+    return 20;
+  case 3:
+    x = x * 2;
+  case 4:
+    return x;
+  default:
+    return -1;
+  }
+}
+
+int main() {
+  return classify(0) + classify(2) + classify(3);
+}
@@ -0,0 +1,105 @@
+	.text
+	.globl classify
+classify:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	movl %edi, -8(%rbp)
+	movl -8(%rbp), %esi
+	movl %esi, %eax
+	cmpl $4, %eax
+	ja .Lclassify.6
+	leaq .LJT0(%rip), %rcx
+	movslq (%rcx,%rax,4), %rax
+	addq %rcx, %rax
+	jmp *%rax
+.Lclassify.1:
+	movl $10, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lclassify.2:
+.Lclassify.3:
+	movl $20, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lclassify.4:
+	movl %esi, %eax
+	movl $2, %ecx
+	imull %ecx, %eax
+	movl %eax, %edi
+	movl %edi, %eax
+	movl %eax, %esi
+.Lclassify.5:
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lclassify.6:
+	movl $1, %eax
+	negl %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+.Lclassify.7:
+	movl $0, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	subq $16, %rsp
+	movl $0, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call classify
+	addq $16, %rsp
+	movl %eax, %esi
+	movq %rsi, -8(%rbp)
+	subq $16, %rsp
+	movl $2, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call classify
+	addq $16, %rsp
+	movq -8(%rbp), %rsi
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movq %rsi, -8(%rbp)
+	subq $16, %rsp
+	movl $3, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call classify
+	addq $16, %rsp
+	movq -8(%rbp), %rsi
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	addl %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .rodata
+	.align 4
+.LJT0:
+	.long .Lclassify.1-.LJT0
+	.long .Lclassify.2-.LJT0
+	.long .Lclassify.3-.LJT0
+	.long .Lclassify.4-.LJT0
+	.long .Lclassify.5-.LJT0
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,109 @@
+// toyfmt formats toy language source files.
+//
+// Usage:
+//
+//	toyfmt [-w] [file ...]
+//
+// With no files, toyfmt formats standard input. By default the formatted
+// source is written to standard output. The source is printed from its
+// syntax tree, which has no comments, so source with comments is not
+// formatted, rather than losing them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Process exit codes.
+const (
+	exitSuccess    = 0
+	exitFailure    = 1 // A file could not be parsed, read or written.
+	exitUsageError = 2
+)
+
+// format parses the source read from r and returns its canonical form. It
+// is an error for the source to have comments.
+func format(r io.Reader) (string, error) {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if pos, ok := lexer.FindComment(string(source)); ok {
+		return "", fmt.Errorf("%v: cannot format source with comments, which would be removed", pos)
+	}
+	program, err := parser.Parse(
+		lexer.NewLexerTokenStream(lexer.Lex(string(source))))
+	if err != nil {
+		return "", err
+	}
+	return ast.Format(program), nil
+}
+
+// formatFile formats a file, writing the result to stdout, or else to the
+// file if write is set.
+func formatFile(path string, write bool, stdout io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	formatted, err := format(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s:%v", path, err)
+	}
+	if write {
+		return ioutil.WriteFile(path, []byte(formatted), 0644)
+	}
+	_, err = fmt.Fprint(stdout, formatted)
+	return err
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("toyfmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false,
+		"Write the result to the source file instead of stdout.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: toyfmt [-w] [file ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return exitSuccess
+	} else if err != nil {
+		return exitUsageError
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "toyfmt: cannot use -w with standard input")
+			return exitUsageError
+		}
+		formatted, err := format(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "<stdin>:%v\n", err)
+			return exitFailure
+		}
+		fmt.Fprint(stdout, formatted)
+		return exitSuccess
+	}
+
+	status := exitSuccess
+	for _, path := range flags.Args() {
+		if err := formatFile(path, *write, stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			status = exitFailure
+		}
+	}
+	return status
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// toyfmt runs the tool on the given standard input, returning the exit code
+// and the contents of standard output and standard error.
+func toyfmt(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+// The canonical form of unformatted.
+const (
+	unformatted = "int  main(){int a=1;\nif(a)return a+2*3;return 0;}"
+	formatted   = "int main() {\n    int a = 1;\n    if (a)\n        return a + 2 * 3;\n    return 0;\n}\n"
+)
+
+func TestFormatStdin(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toyfmt(unformatted)
+	assert.Equal(exitSuccess, status)
+	assert.Equal(formatted, stdout)
+	assert.Equal("", stderr)
+
+	status, stdout, stderr = toyfmt("int main() { return 2 }")
+	assert.Equal(exitFailure, status)
+	assert.Equal("", stdout)
+	assert.True(strings.HasPrefix(stderr, "<stdin>:1:"), stderr)
+}
+
+func TestFormatIsIdempotent(t *testing.T) {
+	assert := assert.New(t)
+	for _, input := range []string{
+		unformatted,
+		"enum E { A, B = 2 }; typedef int T; struct S { T x; char *s[2]; };\n" +
+			"int g = 1; static int f(int a, ...);\n" +
+			"int main() { struct S s; s.x = A ? -g : ~B; return sizeof(s) + (long)f(1, 2); }",
+		"int main() { int i; for (i = 0; i < 3; i++) { switch (i) { case 0: break; default: continue; } }\n" +
+			"do i--; while (i > 0); l: goto l; }",
+	} {
+		status, once, stderr := toyfmt(input)
+		assert.Equal(exitSuccess, status, stderr)
+		status, twice, stderr := toyfmt(once)
+		assert.Equal(exitSuccess, status, stderr)
+		assert.Equal(once, twice)
+	}
+}
+
+func TestFormatFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toyfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.c")
+	b := filepath.Join(dir, "b.c")
+	if err := ioutil.WriteFile(a, []byte(unformatted), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(b, []byte("int main() {"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without -w, the files are formatted to standard output.
+	status, stdout, _ := toyfmt("", a)
+	assert.Equal(exitSuccess, status)
+	assert.Equal(formatted, stdout)
+	source, _ := ioutil.ReadFile(a)
+	assert.Equal(unformatted, string(source))
+
+	// With -w, each file is rewritten, unless it cannot be parsed, and the
+	// others are formatted regardless.
+	status, stdout, stderr := toyfmt("", "-w", b, a)
+	assert.Equal(exitFailure, status)
+	assert.Equal("", stdout)
+	assert.True(strings.HasPrefix(stderr, b+":1:"), stderr)
+	source, _ = ioutil.ReadFile(a)
+	assert.Equal(formatted, string(source))
+	source, _ = ioutil.ReadFile(b)
+	assert.Equal("int main() {", string(source))
+
+	status, _, stderr = toyfmt("", filepath.Join(dir, "c.c"))
+	assert.Equal(exitFailure, status)
+	assert.Contains(stderr, "no such file or directory")
+}
+
+func TestFormatComments(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toyfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Source with comments is left alone, rather than losing them.
+	input := "int main() {\n    // keep me\n    return /* and me */ 0;\n}\n"
+	a := filepath.Join(dir, "a.c")
+	if err := ioutil.WriteFile(a, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, _, stderr := toyfmt("", "-w", a)
+	assert.Equal(exitFailure, status)
+	assert.Equal(a+":2:5: cannot format source with comments, which would be removed\n", stderr)
+	source, _ := ioutil.ReadFile(a)
+	assert.Equal(input, string(source))
+
+	status, stdout, stderr := toyfmt("int x; /* a */")
+	assert.Equal(exitFailure, status)
+	assert.Equal("", stdout)
+	assert.Equal("<stdin>:1:8: cannot format source with comments, which would be removed\n", stderr)
+	// Comment delimiters in literals and division are not comments.
+	status, stdout, _ = toyfmt("char *s = \"/* a */ // b\"; int x = 4 / 2;")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("char *s = \"/* a */ // b\";\nint x = 4 / 2;\n", stdout)
+}
+
+func TestUsageErrors(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toyfmt(unformatted, "-w")
+	assert.Equal(exitUsageError, status)
+	assert.Equal("toyfmt: cannot use -w with standard input\n", stderr)
+
+	status, _, _ = toyfmt("", "-x")
+	assert.Equal(exitUsageError, status)
+}
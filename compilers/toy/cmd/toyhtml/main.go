@@ -0,0 +1,182 @@
+// toyhtml renders a toy language source file as HTML, for reading and
+// reviewing programs.
+//
+// Usage:
+//
+//	toyhtml [-o output] [file]
+//
+// With no file, toyhtml renders standard input. By default the HTML is
+// written to standard output. The source is highlighted, and each name which
+// refers to a symbol links to the declaration of the symbol, with a title
+// which gives its type. The program is checked first, and if it has errors
+// they are reported to standard error, and nothing is rendered. The source is
+// not preprocessed.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/xref"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Process exit codes.
+const (
+	exitSuccess    = 0
+	exitFailure    = 1 // The program has errors, or an I/O error.
+	exitUsageError = 2
+)
+
+// The style sheet of a rendered file, keyed by the names of the classes of
+// the lexer.
+const style = `pre { font-family: monospace; line-height: 1.4; }
+a.identifier { color: inherit; text-decoration: none; }
+a.identifier:hover { text-decoration: underline; }
+.identifier:target { background: #ffef9f; }
+.keyword { color: #0033b3; font-weight: bold; }
+.literal { color: #067d17; }
+.comment { color: #8c8c8c; font-style: italic; }
+.directive { color: #9e880d; }
+.invalid { color: #f50000; text-decoration: underline wavy; }`
+
+// check parses and checks a program, reporting its errors, and returns its
+// names, or false if it has errors.
+func check(filename string, source []byte, stderr io.Writer) ([]xref.Name, bool) {
+	reporter := diag.Reporter{}
+	symbols := make(ast.SymbolTable)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(string(source))),
+		parser.RecoverFromErrors)
+	if err != nil {
+		for _, e := range err.(parser.ErrorList) {
+			reporter.Report(e.Diagnostic())
+		}
+	} else if err := sema.Check(program, sema.RecordSymbols(symbols)); err != nil {
+		for _, e := range err.(sema.ErrorList) {
+			reporter.Report(e.Diagnostic())
+		}
+	}
+	if reporter.ErrorCount() > 0 {
+		renderer := &diag.Renderer{Filename: filename, Source: source}
+		renderer.RenderAll(stderr, reporter.Diagnostics())
+		return nil, false
+	}
+	return xref.Names(program, symbols), true
+}
+
+// anchor returns the ID of the element of a declaration in the source file,
+// or "" if it is in another file.
+func anchor(t token.Token) string {
+	if t.Value == "" || t.Filename != "" {
+		return ""
+	}
+	return fmt.Sprintf("L%dC%d", t.Line, t.Column)
+}
+
+// render writes an HTML document of a source file, whose spans of each class
+// have the name of the class as their own. The names of declarations are
+// anchors, and names which refer to declarations link to them.
+func render(w io.Writer, title, source string, names []xref.Name) error {
+	byOffset := make(map[int]xref.Name)
+	for _, n := range names {
+		if n.Token.Filename == "" {
+			byOffset[n.Token.Offset] = n
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n"+
+		"<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<pre>",
+		html.EscapeString(title), style)
+	for _, s := range lexer.Highlight(source) {
+		text := html.EscapeString(s.Text(source))
+		n, ok := byOffset[s.Offset]
+		switch {
+		case s.Class == lexer.WhitespaceClass:
+			b.WriteString(text)
+		case s.Class == lexer.IdentifierClass && ok && n.IsDeclaration():
+			fmt.Fprintf(&b, `<span class="identifier" id="%s" title="%s">%s</span>`,
+				anchor(n.Token), html.EscapeString(xref.Describe(n.Symbol)), text)
+		case s.Class == lexer.IdentifierClass && ok && anchor(xref.Declaration(n.Symbol)) != "":
+			fmt.Fprintf(&b, `<a class="identifier" href="#%s" title="%s">%s</a>`,
+				anchor(xref.Declaration(n.Symbol)), html.EscapeString(xref.Describe(n.Symbol)), text)
+		case s.Class == lexer.IdentifierClass && ok:
+			fmt.Fprintf(&b, `<span class="identifier" title="%s">%s</span>`,
+				html.EscapeString(xref.Describe(n.Symbol)), text)
+		default:
+			fmt.Fprintf(&b, `<span class="%v">%s</span>`, s.Class, text)
+		}
+	}
+	b.WriteString("</pre>\n</body>\n</html>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("toyhtml", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "Write the HTML to `output` instead of stdout.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: toyhtml [-o output] [file]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return exitSuccess
+	} else if err != nil {
+		return exitUsageError
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintf(stderr, "toyhtml: unexpected argument %q\n", flags.Arg(1))
+		flags.Usage()
+		return exitUsageError
+	}
+
+	filename, title := "<stdin>", "<stdin>"
+	var source []byte
+	var err error
+	if flags.NArg() == 1 {
+		filename = flags.Arg(0)
+		title = filepath.Base(filename)
+		source, err = ioutil.ReadFile(filename)
+	} else {
+		source, err = ioutil.ReadAll(stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "toyhtml: %v\n", err)
+		return exitFailure
+	}
+	names, ok := check(filename, source, stderr)
+	if !ok {
+		return exitFailure
+	}
+
+	if *output == "" {
+		err = render(stdout, title, string(source), names)
+	} else {
+		var f *os.File
+		if f, err = os.Create(*output); err == nil {
+			err = render(f, title, string(source), names)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "toyhtml: %v\n", err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// toyhtml runs the renderer on the given standard input, returning the exit
+// code and the contents of standard output and standard error.
+func toyhtml(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+// body returns the contents of the pre element of a rendered document.
+func body(html string) string {
+	start := strings.Index(html, "<pre>") + len("<pre>")
+	return html[start:strings.Index(html, "</pre>")]
+}
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toyhtml(`// Sum.
+int add(int a, int b) {
+  return a + b;
+}
+int main() { return add(1, 2) < 4; }
+`)
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stderr)
+	assert.True(strings.HasPrefix(stdout, "<!DOCTYPE html>\n"))
+	assert.Contains(stdout, "<title>&lt;stdin&gt;</title>")
+	assert.Equal(`<span class="comment">// Sum.</span>
+<span class="keyword">int</span> <span class="identifier" id="L2C5" title="function add: int(int, int)">add</span>`+
+		`<span class="operator">(</span><span class="keyword">int</span> `+
+		`<span class="identifier" id="L2C13" title="variable a: int">a</span><span class="operator">,</span> `+
+		`<span class="keyword">int</span> <span class="identifier" id="L2C20" title="variable b: int">b</span>`+
+		`<span class="operator">)</span> <span class="operator">{</span>
+  <span class="keyword">return</span> <a class="identifier" href="#L2C13" title="variable a: int">a</a> `+
+		`<span class="operator">+</span> <a class="identifier" href="#L2C20" title="variable b: int">b</a>`+
+		`<span class="operator">;</span>
+<span class="operator">}</span>
+<span class="keyword">int</span> <span class="identifier" id="L5C5" title="function main: int()">main</span>`+
+		`<span class="operator">(</span><span class="operator">)</span> <span class="operator">{</span> `+
+		`<span class="keyword">return</span> <a class="identifier" href="#L2C5" title="function add: int(int, int)">add</a>`+
+		`<span class="operator">(</span><span class="literal">1</span><span class="operator">,</span> `+
+		`<span class="literal">2</span><span class="operator">)</span> <span class="operator">&lt;</span> `+
+		`<span class="literal">4</span><span class="operator">;</span> <span class="operator">}</span>
+`, body(stdout))
+}
+
+func TestRenderEscapes(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, _ := toyhtml("int main() { return \"<a href='x'>&\"[0]; }\n")
+	assert.Contains(body(stdout), `<span class="literal">&#34;&lt;a href=&#39;x&#39;&gt;&amp;&#34;</span>`)
+}
+
+func TestRenderErrors(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toyhtml("int main() { return x; }\n")
+	assert.Equal(exitFailure, status)
+	assert.Equal("", stdout)
+	assert.Contains(stderr, "<stdin>:1:21: error: undefined identifier 'x'")
+
+	status, stdout, stderr = toyhtml("int main() { return 1 }\n")
+	assert.Equal(exitFailure, status)
+	assert.Equal("", stdout)
+	assert.Contains(stderr, "error:")
+}
+
+func TestRenderFile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toyhtml")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "main.toy")
+	output := filepath.Join(dir, "main.html")
+	assert.NoError(ioutil.WriteFile(input, []byte("int main() { return 0; }\n"), 0644))
+	status, stdout, stderr := toyhtml("", "-o", output, input)
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stdout)
+	assert.Equal("", stderr)
+	html, err := ioutil.ReadFile(output)
+	assert.NoError(err)
+	assert.Contains(string(html), "<title>main.toy</title>")
+	assert.Contains(string(html), `id="L1C5"`)
+
+	status, _, stderr = toyhtml("", filepath.Join(dir, "missing.toy"))
+	assert.Equal(exitFailure, status)
+	assert.Contains(stderr, "toyhtml: ")
+}
+
+func TestUsage(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toyhtml("", "a.toy", "b.toy")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, `toyhtml: unexpected argument "b.toy"`)
+	status, _, _ = toyhtml("", "-x")
+	assert.Equal(exitUsageError, status)
+}
@@ -0,0 +1,112 @@
+// toylex prints the tokens of a toy language source file, for debugging the
+// lexer and for teaching how source text is scanned.
+//
+// Usage:
+//
+//	toylex [-format text|csv|json] [file]
+//
+// With no file, toylex lexes standard input. Each token is printed with its
+// position, type and value: as aligned text, which is the default, as CSV
+// with a header row, or as a JSON array of objects. The source is not
+// preprocessed. Lexical errors are reported to standard error, and the
+// tokens around them are still printed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Process exit codes.
+const (
+	exitSuccess    = 0
+	exitFailure    = 1 // The source has lexical errors, or an I/O error.
+	exitUsageError = 2
+)
+
+// lex returns the tokens of a source file, reporting its lexical errors.
+func lex(source string, reporter *diag.Reporter) []token.Token {
+	var tokens []token.Token
+	l := lexer.Lex(source, lexer.RecoverFromErrors)
+	for t := l.NextToken(); t.Type != token.EofToken; t = l.NextToken() {
+		if t.Type == token.ErrorToken {
+			reporter.Errorf(t.Position(), 0, "%s", t.Value).Code = "lexical"
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("toylex", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "text",
+		"The `format` of the tokens: text, csv or json.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: toylex [-format text|csv|json] [file]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return exitSuccess
+	} else if err != nil {
+		return exitUsageError
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintf(stderr, "toylex: unexpected argument %q\n", flags.Arg(1))
+		flags.Usage()
+		return exitUsageError
+	}
+	var write func([]token.Token, string) error
+	switch *format {
+	case "text":
+		write = func(tokens []token.Token, _ string) error { return token.WriteText(stdout, tokens) }
+	case "csv":
+		write = func(tokens []token.Token, filename string) error {
+			return token.WriteCSV(stdout, filename, tokens)
+		}
+	case "json":
+		write = func(tokens []token.Token, filename string) error {
+			return token.WriteJSON(stdout, filename, tokens)
+		}
+	default:
+		fmt.Fprintf(stderr, "toylex: invalid format %q, expected one of text, csv, json\n", *format)
+		return exitUsageError
+	}
+
+	filename := "<stdin>"
+	var source []byte
+	var err error
+	if flags.NArg() == 1 {
+		filename = flags.Arg(0)
+		source, err = ioutil.ReadFile(filename)
+	} else {
+		source, err = ioutil.ReadAll(stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "toylex: %v\n", err)
+		return exitFailure
+	}
+	reporter := diag.Reporter{}
+	tokens := lex(string(source), &reporter)
+	if err := write(tokens, filename); err != nil {
+		fmt.Fprintf(stderr, "toylex: %v\n", err)
+		return exitFailure
+	}
+	if reporter.ErrorCount() > 0 {
+		renderer := &diag.Renderer{Filename: filename, Source: source}
+		renderer.RenderAll(stderr, reporter.Diagnostics())
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
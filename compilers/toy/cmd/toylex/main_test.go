@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// toylex runs the tool on the given standard input, returning the exit code
+// and the contents of standard output and standard error.
+func toylex(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestText(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toylex("int main() {\n  return 2.5;\n}")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stderr)
+	assert.Equal(`1:1   int                      "int"
+1:5   identifier               "main"
+1:9   (                        "("
+1:10  )                        ")"
+1:12  {                        "{"
+2:3   return                   "return"
+2:10  floating-point constant  "2.5"
+2:13  ;                        ";"
+3:1   }                        "}"
+`, stdout)
+}
+
+func TestCSV(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, _ := toylex(`char *s = "a, b";`, "-format", "csv")
+	assert.Equal(exitSuccess, status)
+	assert.Equal(`file,line,column,offset,type,category,value
+<stdin>,1,1,0,char,keyword,char
+<stdin>,1,6,5,*,operator,*
+<stdin>,1,7,6,identifier,identifier,s
+<stdin>,1,9,8,=,operator,=
+<stdin>,1,11,10,string literal,literal,"a, b"
+<stdin>,1,17,16,;,punctuation,;
+`, stdout)
+}
+
+func TestJSON(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "toylex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "a.c")
+	if err := ioutil.WriteFile(input, []byte("x\n  1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, stdout, _ := toylex("", "-format=json", input)
+	assert.Equal(exitSuccess, status)
+	assert.JSONEq(`[
+		{"file": "`+input+`", "line": 1, "column": 1, "offset": 0,
+		 "type": "identifier", "category": "identifier", "value": "x"},
+		{"file": "`+input+`", "line": 2, "column": 3, "offset": 4,
+		 "type": "number", "category": "literal", "value": "1"}]`, stdout)
+}
+
+func TestLexicalErrors(t *testing.T) {
+	assert := assert.New(t)
+	// The tokens around an error are printed.
+	status, stdout, stderr := toylex("a @ b")
+	assert.Equal(exitFailure, status)
+	assert.Equal("1:1  identifier  \"a\"\n1:5  identifier  \"b\"\n", stdout)
+	assert.Equal("<stdin>:1:3: error: illegal character: `@`\n"+
+		"a @ b\n"+
+		"  ^\n", stderr)
+}
+
+func TestUsageErrors(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toylex("", "-format", "xml")
+	assert.Equal(exitUsageError, status)
+	assert.Equal("toylex: invalid format \"xml\", expected one of text, csv, json\n", stderr)
+
+	status, _, stderr = toylex("", "a.c", "b.c")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, "toylex: unexpected argument \"b.c\"\n")
+
+	status, _, stderr = toylex("", "does-not-exist.c")
+	assert.Equal(exitFailure, status)
+	assert.Contains(stderr, "toylex: open does-not-exist.c: no such file or directory\n")
+}
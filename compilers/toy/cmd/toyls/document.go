@@ -0,0 +1,177 @@
+package main
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/opt"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/xref"
+	"strings"
+	"unicode/utf8"
+)
+
+// An open document, analysed when it is opened and each time it changes.
+type document struct {
+	uri         string
+	version     int
+	text        string
+	lines       []string // The lines of the text, without their newlines.
+	diagnostics []*diag.Diagnostic
+	// The names in the text which refer to, or declare, a symbol.
+	names []xref.Name
+}
+
+// newDocument parses and checks the text of a document. Its diagnostics are
+// the lexical and syntax errors, or else the semantic errors, or the warnings
+// of -Wall which are found before the program is lowered.
+func newDocument(uri string, version int, text string) *document {
+	d := &document{
+		uri:     uri,
+		version: version,
+		text:    text,
+		lines:   strings.Split(text, "\n"),
+	}
+	warnings := diag.DefaultWarnings()
+	warnings.Set("all")
+	reporter := diag.Reporter{Warnings: warnings}
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(text)),
+		parser.RecoverFromErrors)
+	if err != nil {
+		for _, e := range err.(parser.ErrorList) {
+			reporter.Report(e.Diagnostic())
+		}
+		d.diagnostics = reporter.Diagnostics()
+		return d
+	}
+	symbols := make(ast.SymbolTable)
+	err = sema.Check(program, sema.RecordSymbols(symbols),
+		sema.ReportWarnings(func(w *sema.Warning) {
+			reporter.Report(w.Diagnostic())
+		}))
+	// The symbols which were resolved are known even if there are errors.
+	d.names = xref.Names(program, symbols)
+	if err != nil {
+		for _, e := range err.(sema.ErrorList) {
+			reporter.Report(e.Diagnostic())
+		}
+	} else {
+		for _, w := range opt.EliminateDeadCode(program) {
+			reporter.Report(w.Diagnostic())
+		}
+	}
+	d.diagnostics = reporter.Diagnostics()
+	return d
+}
+
+// nameAt returns the name which contains a position, or nil if there is
+// none.
+func (d *document) nameAt(p position) *xref.Name {
+	pos := d.tokenPosition(p)
+	for i := range d.names {
+		n := &d.names[i]
+		start := n.Token.Position()
+		if start.Filename == "" && start.Line == pos.Line && start.Column <= pos.Column &&
+			pos.Column <= start.Column+utf8.RuneCountInString(n.Token.Value) {
+			return n
+		}
+	}
+	return nil
+}
+
+// tokenPosition returns the position of the text, whose line and column are
+// numbered from 1 and whose column counts runes, at a position of the
+// protocol.
+func (d *document) tokenPosition(p position) token.Position {
+	pos := token.Position{Line: p.Line + 1, Column: 1}
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return pos
+	}
+	units := 0
+	for _, r := range d.lines[p.Line] {
+		if units += utf16Length(r); units > p.Character {
+			break
+		}
+		pos.Column++
+	}
+	return pos
+}
+
+// textRange returns the range of the protocol of the span of length runes
+// which starts at a position of the text.
+func (d *document) textRange(pos token.Position, length int) textRange {
+	start := d.position(pos.Line, pos.Column)
+	return textRange{Start: start, End: d.position(pos.Line, pos.Column+length)}
+}
+
+// position returns the position of the protocol of a line and column of
+// the text.
+func (d *document) position(line, column int) position {
+	p := position{Line: line - 1}
+	if line < 1 || line > len(d.lines) {
+		return p
+	}
+	for _, r := range d.lines[line-1] {
+		if column--; column < 1 {
+			break
+		}
+		p.Character += utf16Length(r)
+	}
+	return p
+}
+
+// end returns the position of the protocol of the end of the text.
+func (d *document) end() position {
+	return d.position(len(d.lines), utf8.RuneCountInString(d.lines[len(d.lines)-1])+1)
+}
+
+// utf16Length returns the number of UTF-16 code units which encode a rune.
+func utf16Length(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// protocolDiagnostics returns the diagnostics of the document for the
+// protocol, with their notes as related information.
+func (d *document) protocolDiagnostics() []diagnostic {
+	diagnostics := []diagnostic{}
+	for _, e := range d.diagnostics {
+		// Positions in other files, from line directives, are unknown to the
+		// client.
+		if e.Pos.Filename != "" {
+			continue
+		}
+		p := diagnostic{
+			Range:    d.textRange(e.Pos, e.Length),
+			Severity: severity(e.Severity),
+			Code:     e.Code,
+			Source:   "toy",
+			Message:  e.Msg,
+		}
+		for _, n := range e.Notes {
+			if n.Pos.Filename == "" {
+				p.RelatedInformation = append(p.RelatedInformation, diagnosticRelatedInformation{
+					Location: location{URI: d.uri, Range: d.textRange(n.Pos, n.Length)},
+					Message:  n.Msg,
+				})
+			}
+		}
+		diagnostics = append(diagnostics, p)
+	}
+	return diagnostics
+}
+
+// severity returns the severity of the protocol of a diagnostic.
+func severity(s diag.Severity) int {
+	switch s {
+	case diag.Error:
+		return severityError
+	case diag.Warning:
+		return severityWarning
+	}
+	return severityInformation
+}
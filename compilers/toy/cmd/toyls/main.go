@@ -0,0 +1,331 @@
+// toyls is a language server for the toy language, which editors run to
+// check and navigate toy source files as they are edited.
+//
+// Usage:
+//
+//	toyls
+//
+// The server speaks the Language Server Protocol over standard input and
+// output. Each open document is parsed and checked as it changes, and its
+// errors and warnings are published as diagnostics. Hovering over a name
+// shows the type of its symbol, going to its definition goes to the
+// declaration which the name resolves to, and formatting a document replaces
+// it with its canonical form, as printed by toyfmt, unless it has comments.
+// Documents are not preprocessed.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/xref"
+	"io"
+	"os"
+	"strings"
+)
+
+// Process exit codes. The server exits with a failure if it is told to exit
+// before it is shut down.
+const (
+	exitSuccess = 0
+	exitFailure = 1
+)
+
+type server struct {
+	stdin       *bufio.Reader
+	stdout      io.Writer
+	stderr      io.Writer
+	initialized bool
+	shutdown    bool
+	documents   map[string]*document
+}
+
+// A handler of the requests and notifications of a method. The result of a
+// notification is ignored.
+type handler func(s *server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":              (*server).initialize,
+	"initialized":             func(*server, json.RawMessage) (interface{}, error) { return nil, nil },
+	"shutdown":                (*server).shutdownServer,
+	"textDocument/didOpen":    (*server).didOpen,
+	"textDocument/didChange":  (*server).didChange,
+	"textDocument/didClose":   (*server).didClose,
+	"textDocument/hover":      (*server).hover,
+	"textDocument/definition": (*server).definition,
+	"textDocument/formatting": (*server).formatting,
+}
+
+// loop handles messages until the client says to exit, or closes the input,
+// and returns a process exit code.
+func (s *server) loop() int {
+	for {
+		m, err := readMessage(s.stdin)
+		if e, ok := err.(*responseError); ok {
+			s.respond(nil, nil, e)
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(s.stderr, "toyls: %v\n", err)
+			}
+			return exitFailure
+		}
+		if m.Method == "exit" {
+			if s.shutdown {
+				return exitSuccess
+			}
+			return exitFailure
+		}
+		if err := s.handle(m); err != nil {
+			fmt.Fprintf(s.stderr, "toyls: %v\n", err)
+			return exitFailure
+		}
+	}
+}
+
+// handle dispatches a message to the handler of its method, and responds to
+// it if it is a request. Responses from the client are ignored, since the
+// server makes no requests.
+func (s *server) handle(m *message) error {
+	if m.Method == "" {
+		return nil
+	}
+	h, ok := handlers[m.Method]
+	var result interface{}
+	var err error
+	switch {
+	case !ok:
+		err = &responseError{Code: methodNotFound, Message: fmt.Sprintf("unknown method %q", m.Method)}
+	case !s.initialized && m.Method != "initialize":
+		err = &responseError{Code: serverNotInitialized, Message: "the server is not initialized"}
+	case s.shutdown:
+		err = &responseError{Code: invalidRequest, Message: "the server is shut down"}
+	default:
+		result, err = h(s, m.Params)
+	}
+	if m.ID == nil {
+		// Notifications have no response, so their errors are logged.
+		if err != nil && ok {
+			fmt.Fprintf(s.stderr, "toyls: %s: %v\n", m.Method, err)
+		}
+		return nil
+	}
+	return s.respond(m.ID, result, err)
+}
+
+// respond writes the response to a request.
+func (s *server) respond(id *json.RawMessage, result interface{}, err error) error {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	response := &message{ID: id}
+	if err != nil {
+		e, ok := err.(*responseError)
+		if !ok {
+			e = &responseError{Code: requestFailed, Message: err.Error()}
+		}
+		response.Error = e
+	} else {
+		content, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		raw := json.RawMessage(content)
+		response.Result = &raw
+	}
+	return writeMessage(s.stdout, response)
+}
+
+// notify writes a notification to the client.
+func (s *server) notify(method string, params interface{}) error {
+	content, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.stdout, &message{Method: method, Params: content})
+}
+
+// unmarshal decodes the parameters of a method.
+func unmarshal(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: invalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *server) initialize(json.RawMessage) (interface{}, error) {
+	s.initialized = true
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			// Documents are synchronized by sending their full text.
+			"textDocumentSync":           map[string]interface{}{"openClose": true, "change": 1},
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "toyls"},
+	}, nil
+}
+
+func (s *server) shutdownServer(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+// update analyses the text of a document and publishes its diagnostics.
+func (s *server) update(d *document) error {
+	s.documents[d.uri] = d
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: d.protocolDiagnostics(),
+	})
+}
+
+func (s *server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p didOpenParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	item := p.TextDocument
+	return nil, s.update(newDocument(item.URI, item.Version, item.Text))
+}
+
+func (s *server) didChange(params json.RawMessage) (interface{}, error) {
+	var p didChangeParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	// Only the last of several changes of the full text matters.
+	text := p.ContentChanges[len(p.ContentChanges)-1].Text
+	return nil, s.update(newDocument(p.TextDocument.URI, p.TextDocument.Version, text))
+}
+
+func (s *server) didClose(params json.RawMessage) (interface{}, error) {
+	var p didCloseParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	// The diagnostics of a closed document are cleared.
+	return nil, s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []diagnostic{},
+	})
+}
+
+// document returns the open document with a URI.
+func (s *server) document(uri string) (*document, error) {
+	d, ok := s.documents[uri]
+	if !ok {
+		return nil, &responseError{Code: invalidParams, Message: fmt.Sprintf("document %s is not open", uri)}
+	}
+	return d, nil
+}
+
+// nameAt returns the document and the name at the position of a request, or
+// a nil name if there is none.
+func (s *server) nameAt(params json.RawMessage) (*document, *xref.Name, error) {
+	var p textDocumentPositionParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, d.nameAt(p.Position), nil
+}
+
+func (s *server) hover(params json.RawMessage) (interface{}, error) {
+	d, n, err := s.nameAt(params)
+	if err != nil || n == nil {
+		return nil, err
+	}
+	return &hover{
+		Contents: markupContent{Kind: "plaintext", Value: xref.Describe(n.Symbol)},
+		Range:    d.textRange(n.Token.Position(), len([]rune(n.Token.Value))),
+	}, nil
+}
+
+func (s *server) definition(params json.RawMessage) (interface{}, error) {
+	d, n, err := s.nameAt(params)
+	if err != nil || n == nil {
+		return nil, err
+	}
+	t := xref.Declaration(n.Symbol)
+	if t.Value == "" || t.Position().Filename != "" {
+		return nil, nil
+	}
+	return &location{
+		URI:   d.uri,
+		Range: d.textRange(t.Position(), len([]rune(t.Value))),
+	}, nil
+}
+
+// formatting returns an edit which replaces the whole of a document with its
+// canonical form, indented as the options ask. The text is parsed again, as
+// by toyfmt, since semantic analysis changes the tree. A document with syntax
+// errors cannot be formatted, and nor can one with comments, which the tree
+// does not keep.
+func (s *server) formatting(params json.RawMessage) (interface{}, error) {
+	var p formattingParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := lexer.FindComment(d.text); ok {
+		return nil, fmt.Errorf("cannot format %s, which has comments that formatting would remove", d.uri)
+	}
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(d.text)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot format %s, which has syntax errors", d.uri)
+	}
+	formatted := ast.Format(program)
+	if p.Options != nil {
+		formatted = ast.FormatIndent(program, p.Options.indent())
+	}
+	if formatted == d.text {
+		return []textEdit{}, nil
+	}
+	return []textEdit{{
+		Range:   textRange{End: d.end()},
+		NewText: formatted,
+	}}, nil
+}
+
+// indent returns the indentation of a level which formatting options ask
+// for: a tab, unless spaces are inserted.
+func (o *formattingOptions) indent() string {
+	if o.InsertSpaces {
+		return strings.Repeat(" ", o.TabSize)
+	}
+	return "\t"
+}
+
+// run runs a server of the given input and output, and returns a process
+// exit code.
+func run(stdin io.Reader, stdout, stderr io.Writer) int {
+	s := &server{
+		stdin:     bufio.NewReader(stdin),
+		stdout:    stdout,
+		stderr:    stderr,
+		documents: make(map[string]*document),
+	}
+	return s.loop()
+}
+
+func main() {
+	os.Exit(run(os.Stdin, os.Stdout, os.Stderr))
+}
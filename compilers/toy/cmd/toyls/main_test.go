@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const uri = "file:///test.toy"
+
+// A message from the client to the server, with an ID if it is a request.
+type clientMessage struct {
+	id     int
+	method string
+	params interface{}
+}
+
+// toyls runs the server on the given messages, and returns the exit code, the
+// messages which the server wrote, with their results decoded into maps, and
+// the contents of standard error.
+func toyls(t *testing.T, messages ...clientMessage) (int, []map[string]interface{}, string) {
+	var stdin, stdout, stderr bytes.Buffer
+	for _, m := range messages {
+		content := map[string]interface{}{"jsonrpc": "2.0", "method": m.method}
+		if m.id != 0 {
+			content["id"] = m.id
+		}
+		if m.params != nil {
+			content["params"] = m.params
+		}
+		encoded, err := json.Marshal(content)
+		assert.NoError(t, err)
+		fmt.Fprintf(&stdin, "Content-Length: %d\r\n\r\n%s", len(encoded), encoded)
+	}
+	status := run(&stdin, &stdout, &stderr)
+	var written []map[string]interface{}
+	r := bufio.NewReader(&stdout)
+	for {
+		content, err := readContent(r)
+		if err != nil {
+			break
+		}
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(content, &decoded))
+		written = append(written, decoded)
+	}
+	return status, written, stderr.String()
+}
+
+// session returns the messages which initialize the server, open a document
+// with the given text, then make the given requests, and shut down.
+func session(text string, requests ...clientMessage) []clientMessage {
+	messages := []clientMessage{
+		{id: 1, method: "initialize", params: map[string]interface{}{}},
+		{method: "initialized", params: map[string]interface{}{}},
+		{method: "textDocument/didOpen", params: map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "version": 1, "languageId": "toy", "text": text},
+		}},
+	}
+	messages = append(messages, requests...)
+	return append(messages, clientMessage{id: 99, method: "shutdown"}, clientMessage{method: "exit"})
+}
+
+// at returns the parameters of a request at a position of the document.
+func at(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}
+}
+
+// span returns a range of the protocol, as decoded.
+func span(startLine, startCharacter, endLine, endCharacter int) map[string]interface{} {
+	return map[string]interface{}{
+		"start": map[string]interface{}{"line": float64(startLine), "character": float64(startCharacter)},
+		"end":   map[string]interface{}{"line": float64(endLine), "character": float64(endCharacter)},
+	}
+}
+
+func TestInitializeAndShutdown(t *testing.T) {
+	assert := assert.New(t)
+	status, written, stderr := toyls(t,
+		clientMessage{id: 1, method: "initialize", params: map[string]interface{}{}},
+		clientMessage{id: 2, method: "shutdown"},
+		clientMessage{method: "exit"})
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stderr)
+	assert.Equal(2, len(written))
+	capabilities := written[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+	assert.Equal(true, capabilities["hoverProvider"])
+	assert.Equal(true, capabilities["definitionProvider"])
+	assert.Equal(true, capabilities["documentFormattingProvider"])
+	assert.Equal(float64(2), written[1]["id"])
+	assert.Contains(written[1], "result")
+	assert.Nil(written[1]["result"])
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	assert := assert.New(t)
+	status, _, _ := toyls(t,
+		clientMessage{id: 1, method: "initialize", params: map[string]interface{}{}},
+		clientMessage{method: "exit"})
+	assert.Equal(exitFailure, status)
+}
+
+func TestRequestErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, written, _ := toyls(t,
+		clientMessage{id: 1, method: "textDocument/hover", params: at(0, 0)},
+		clientMessage{id: 2, method: "initialize", params: map[string]interface{}{}},
+		clientMessage{id: 3, method: "textDocument/rename", params: at(0, 0)},
+		clientMessage{id: 4, method: "textDocument/hover", params: at(0, 0)})
+	assert.Equal(4, len(written))
+	assert.Equal(float64(serverNotInitialized), written[0]["error"].(map[string]interface{})["code"])
+	assert.Equal(float64(methodNotFound), written[2]["error"].(map[string]interface{})["code"])
+	assert.Equal(map[string]interface{}{
+		"code":    float64(invalidParams),
+		"message": "document file:///test.toy is not open",
+	}, written[3]["error"])
+}
+
+func TestPublishDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+	_, written, _ := toyls(t, session("int main() {\n  return x;\n}\n",
+		clientMessage{method: "textDocument/didChange", params: map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []interface{}{map[string]interface{}{"text": "int main() {\n  int y;\n  return 0\n}\n"}},
+		}},
+		clientMessage{method: "textDocument/didChange", params: map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 3},
+			"contentChanges": []interface{}{map[string]interface{}{"text": "int main() {\n  int y;\n  return 0;\n}\n"}},
+		}},
+		clientMessage{method: "textDocument/didClose", params: map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+		}})...)
+	assert.Equal(6, len(written))
+	for _, m := range written[1:5] {
+		assert.Equal("textDocument/publishDiagnostics", m["method"])
+	}
+	// A semantic error.
+	assert.Equal(map[string]interface{}{
+		"uri":     uri,
+		"version": float64(1),
+		"diagnostics": []interface{}{map[string]interface{}{
+			"range":    span(1, 9, 1, 10),
+			"severity": float64(severityError),
+			"code":     "semantic",
+			"source":   "toy",
+			"message":  "undefined identifier 'x'",
+		}},
+	}, written[1]["params"])
+	// A syntax error.
+	diagnostics := written[2]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	assert.Equal(1, len(diagnostics))
+	assert.Equal("syntax", diagnostics[0].(map[string]interface{})["code"])
+	// A warning, which is enabled by default.
+	assert.Equal([]interface{}{map[string]interface{}{
+		"range":    span(1, 2, 1, 2),
+		"severity": float64(severityWarning),
+		"code":     "unused-variable",
+		"source":   "toy",
+		"message":  "unused variable 'y'",
+	}}, written[3]["params"].(map[string]interface{})["diagnostics"])
+	// Closing the document clears its diagnostics.
+	assert.Equal([]interface{}{}, written[4]["params"].(map[string]interface{})["diagnostics"])
+}
+
+const program = `struct point {
+  int x;
+};
+enum color { RED, GREEN = 4 };
+double scale(struct point *p, double k) {
+  return p->x * k;
+}
+int main() {
+  struct point p;
+  p.x = GREEN;
+  return scale(&p, 2.0);
+}
+`
+
+func TestHover(t *testing.T) {
+	assert := assert.New(t)
+	_, written, _ := toyls(t, session(program,
+		clientMessage{id: 2, method: "textDocument/hover", params: at(5, 10)},
+		clientMessage{id: 3, method: "textDocument/hover", params: at(10, 10)},
+		clientMessage{id: 4, method: "textDocument/hover", params: at(9, 8)},
+		clientMessage{id: 5, method: "textDocument/hover", params: at(4, 37)},
+		clientMessage{id: 6, method: "textDocument/hover", params: at(0, 8)},
+		clientMessage{id: 7, method: "textDocument/hover", params: at(10, 2)})...)
+	assert.Equal(9, len(written))
+	hover := func(m map[string]interface{}) interface{} {
+		return m["result"].(map[string]interface{})["contents"].(map[string]interface{})["value"]
+	}
+	assert.Equal("variable p: struct point *", hover(written[2]))
+	assert.Equal(span(5, 9, 5, 10), written[2]["result"].(map[string]interface{})["range"])
+	assert.Equal("function scale: double(struct point *, double)", hover(written[3]))
+	assert.Equal("enumerator GREEN = 4", hover(written[4]))
+	// The names of declarations.
+	assert.Equal("variable k: double", hover(written[5]))
+	assert.Equal("struct point", hover(written[6]))
+	// A keyword.
+	assert.Nil(written[7]["result"])
+}
+
+func TestDefinition(t *testing.T) {
+	assert := assert.New(t)
+	_, written, _ := toyls(t, session(program,
+		clientMessage{id: 2, method: "textDocument/definition", params: at(5, 16)},
+		clientMessage{id: 3, method: "textDocument/definition", params: at(10, 9)},
+		clientMessage{id: 4, method: "textDocument/definition", params: at(9, 2)},
+		clientMessage{id: 5, method: "textDocument/definition", params: at(9, 9)})...)
+	assert.Equal(7, len(written))
+	location := func(startLine, startCharacter, endLine, endCharacter int) map[string]interface{} {
+		return map[string]interface{}{"uri": uri, "range": span(startLine, startCharacter, endLine, endCharacter)}
+	}
+	assert.Equal(location(4, 37, 4, 38), written[2]["result"])
+	assert.Equal(location(4, 7, 4, 12), written[3]["result"])
+	assert.Equal(location(8, 15, 8, 16), written[4]["result"])
+	assert.Equal(location(3, 18, 3, 23), written[5]["result"])
+}
+
+func TestFormatting(t *testing.T) {
+	assert := assert.New(t)
+	formatting := map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}}
+	_, written, _ := toyls(t, session("int main(){return 1+2;}",
+		clientMessage{id: 2, method: "textDocument/formatting", params: formatting},
+		clientMessage{method: "textDocument/didChange", params: map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []interface{}{map[string]interface{}{"text": "int main() {\n    return 1 + 2;\n}\n"}},
+		}},
+		clientMessage{id: 3, method: "textDocument/formatting", params: formatting},
+		clientMessage{method: "textDocument/didChange", params: map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 3},
+			"contentChanges": []interface{}{map[string]interface{}{"text": "int main() {"}},
+		}},
+		clientMessage{id: 4, method: "textDocument/formatting", params: formatting})...)
+	assert.Equal(8, len(written))
+	assert.Equal([]interface{}{map[string]interface{}{
+		"range":   span(0, 0, 0, 23),
+		"newText": "int main() {\n    return 1 + 2;\n}\n",
+	}}, written[2]["result"])
+	// The text is already formatted.
+	assert.Equal([]interface{}{}, written[4]["result"])
+	assert.Equal("cannot format file:///test.toy, which has syntax errors",
+		written[6]["error"].(map[string]interface{})["message"])
+}
+
+func TestFormattingOptions(t *testing.T) {
+	assert := assert.New(t)
+	formatting := func(options map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}, "options": options}
+	}
+	_, written, _ := toyls(t, session("int main(){if(1)return 1+2;}",
+		clientMessage{id: 2, method: "textDocument/formatting",
+			params: formatting(map[string]interface{}{"tabSize": 2, "insertSpaces": true})},
+		clientMessage{id: 3, method: "textDocument/formatting",
+			params: formatting(map[string]interface{}{"tabSize": 8, "insertSpaces": false})})...)
+	assert.Equal(5, len(written))
+	newText := func(m map[string]interface{}) interface{} {
+		return m["result"].([]interface{})[0].(map[string]interface{})["newText"]
+	}
+	assert.Equal("int main() {\n  if (1)\n    return 1 + 2;\n}\n", newText(written[2]))
+	assert.Equal("int main() {\n\tif (1)\n\t\treturn 1 + 2;\n}\n", newText(written[3]))
+}
+
+func TestFormattingComments(t *testing.T) {
+	assert := assert.New(t)
+	formatting := map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}}
+	_, written, _ := toyls(t, session("int main(){return 1; // one\n}",
+		clientMessage{id: 2, method: "textDocument/formatting", params: formatting})...)
+	assert.Equal(4, len(written))
+	assert.Nil(written[2]["result"])
+	assert.Equal("cannot format file:///test.toy, which has comments that formatting would remove",
+		written[2]["error"].(map[string]interface{})["message"])
+}
+
+func TestPositionsCountUTF16(t *testing.T) {
+	assert := assert.New(t)
+	d := newDocument(uri, 1, "// \U0001F600é\nint x = 1;\nint f() { return \"\U0001F600\"[0] + x; }\n")
+	assert.Equal(span(2, 27, 2, 28), toMap(d.textRange(d.names[len(d.names)-1].Token.Position(), 1)))
+	assert.Equal("x", d.nameAt(position{Line: 2, Character: 27}).Token.Value)
+	assert.Equal(position{Line: 3}, d.end())
+	assert.Equal(position{Line: 0, Character: 6}, d.position(1, 6))
+}
+
+// toMap returns a value of the protocol as decoded.
+func toMap(v interface{}) map[string]interface{} {
+	encoded, _ := json.Marshal(v)
+	var m map[string]interface{}
+	json.Unmarshal(encoded, &m)
+	return m
+}
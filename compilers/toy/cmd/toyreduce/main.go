@@ -0,0 +1,120 @@
+// toyreduce reduces a toy language program which is interesting, such as one
+// which crashes the compiler, to a small program which is still interesting,
+// for reporting bugs.
+//
+// Usage:
+//
+//	toyreduce [-o output] [-valid] [-v] file command [arg...]
+//
+// Whether a program is interesting is decided by running the command, as a
+// predicate: each candidate program is written to a file with the base name
+// of the input in a temporary directory, and the command is run in that
+// directory with the name of the file as its last argument. The program is
+// interesting if the command exits with status 0. For example, to find a
+// small program which makes toycc exit with status 3:
+//
+//	toyreduce crash.c sh -c 'toycc -S -o /dev/null "$0"; test $? -eq 3'
+//
+// Statements, declarations and expressions are removed from the syntax tree
+// of the program until no smaller candidate is interesting. The reduced
+// program is written to standard output, or to the output file. With
+// -valid, every candidate must pass semantic analysis, which is needed to
+// reduce a miscompilation rather than a crash. With -v, the size of each
+// smaller program which is found is reported to standard error.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/reduce"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Process exit codes.
+const (
+	exitSuccess    = 0
+	exitFailure    = 1 // The input is not interesting or does not parse, or an I/O error.
+	exitUsageError = 2
+)
+
+// predicate returns a function which runs a command on a candidate program,
+// written to a file named base in dir, and reports whether it succeeds.
+func predicate(dir, base string, command []string) func(string) bool {
+	path := filepath.Join(dir, base)
+	return func(source string) bool {
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			return false
+		}
+		cmd := exec.Command(command[0], append(command[1:], base)...)
+		cmd.Dir = dir
+		return cmd.Run() == nil
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("toyreduce", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "Write the reduced program to `file`.")
+	valid := flags.Bool("valid", false,
+		"Keep only programs which pass semantic analysis.")
+	verbose := flags.Bool("v", false, "Report the size of each smaller program.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr,
+			"Usage: toyreduce [-o output] [-valid] [-v] file command [arg...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return exitSuccess
+	} else if err != nil {
+		return exitUsageError
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return exitUsageError
+	}
+	filename, command := flags.Arg(0), flags.Args()[1:]
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "toyreduce: %v\n", err)
+		return exitFailure
+	}
+	dir, err := ioutil.TempDir("", "toyreduce")
+	if err != nil {
+		fmt.Fprintf(stderr, "toyreduce: %v\n", err)
+		return exitFailure
+	}
+	defer os.RemoveAll(dir)
+
+	options := []reduce.Option{reduce.Progress(func(source string) {
+		if *verbose {
+			fmt.Fprintf(stderr, "toyreduce: %d bytes\n", len(source))
+		}
+	})}
+	if *valid {
+		options = append(options, reduce.Valid)
+	}
+	interesting := predicate(dir, filepath.Base(filename), command)
+	reduced, err := reduce.Reduce(string(source), interesting, options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "toyreduce: %s: %v\n", filename, err)
+		return exitFailure
+	}
+	if *output != "" {
+		err = ioutil.WriteFile(*output, []byte(reduced), 0644)
+	} else {
+		_, err = io.WriteString(stdout, reduced)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "toyreduce: %v\n", err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
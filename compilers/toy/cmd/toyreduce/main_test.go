@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// toyreduce runs the tool, returning the exit code and the contents of
+// standard output and standard error.
+func toyreduce(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+// input writes a program to a.c in a temporary directory, returning its
+// path and a function which removes the directory.
+func input(t *testing.T, source string) (string, func()) {
+	dir, err := ioutil.TempDir("", "toyreduce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "a.c")
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+const program = `int g = 1;
+int main() {
+  int y = 0;
+  for (int i = 0; i < 3; i++) {
+    y += i * 1234;
+  }
+  return y + g;
+}
+`
+
+func TestReduce(t *testing.T) {
+	assert := assert.New(t)
+	if _, err := exec.LookPath("grep"); err != nil {
+		t.Skip("grep is required for the predicate")
+	}
+	path, cleanup := input(t, program)
+	defer cleanup()
+	status, stdout, stderr := toyreduce("-v", path, "grep", "-q", "1234")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("int main() {\n    1234;\n}\n", stdout)
+	assert.Contains(stderr, "toyreduce: 25 bytes\n")
+
+	// The input is not changed, unless it is the output.
+	source, _ := ioutil.ReadFile(path)
+	assert.Equal(program, string(source))
+	status, stdout, _ = toyreduce("-valid", "-o", path, path, "grep", "-q", "y +=")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("", stdout)
+	source, _ = ioutil.ReadFile(path)
+	assert.Equal("int main() {\n    int y;\n    y += 0;\n}\n", string(source))
+}
+
+func TestNotInteresting(t *testing.T) {
+	assert := assert.New(t)
+	if _, err := exec.LookPath("false"); err != nil {
+		t.Skip("false is required for the predicate")
+	}
+	path, cleanup := input(t, program)
+	defer cleanup()
+	status, stdout, stderr := toyreduce(path, "false")
+	assert.Equal(exitFailure, status)
+	assert.Equal("", stdout)
+	assert.Equal("toyreduce: "+path+": the program is not interesting\n", stderr)
+}
+
+func TestUsage(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toyreduce("a.c")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, "Usage: toyreduce")
+	status, _, stderr = toyreduce("missing.c", "true")
+	assert.Equal(exitFailure, status)
+	assert.Contains(stderr, "missing.c")
+}
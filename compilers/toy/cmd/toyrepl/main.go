@@ -0,0 +1,202 @@
+// toyrepl is an interactive interpreter for the toy language.
+//
+// Usage:
+//
+//	toyrepl
+//
+// Each line of input may contain function definitions and statements, which
+// are checked and run as they are entered. A line may end with an expression
+// without a semicolon, whose value is printed. Variables declared by
+// statements are kept for later input, and may be redeclared. They are
+// globals, which the functions defined after them may use. Input which is
+// incomplete, such as a function whose body has not been closed, is continued
+// on the next line. Errors are reported to standard error, and the rest of
+// their line of input is discarded.
+//
+// Programs read with getchar from the input which follows the line that calls
+// it, and write with putchar to standard output.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/interp"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"io"
+	"os"
+)
+
+// Process exit codes.
+const (
+	exitSuccess    = 0
+	exitFailure    = 1 // An I/O error.
+	exitUsageError = 2
+)
+
+// The prompts for a new line of input, and for the continuation of incomplete
+// input.
+const (
+	prompt             = "> "
+	continuationPrompt = ". "
+)
+
+// The name of the input in diagnostics.
+const inputName = "<stdin>"
+
+type repl struct {
+	stdin   *bufio.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	session *sema.Session
+	interp  *interp.Interpreter
+}
+
+// loop reads and runs input until the end of stdin, and returns a process
+// exit code.
+func (r *repl) loop() int {
+	input := ""
+	for {
+		if input == "" {
+			fmt.Fprint(r.stdout, prompt)
+		} else {
+			fmt.Fprint(r.stdout, continuationPrompt)
+		}
+		line, err := r.stdin.ReadString('\n')
+		input += line
+		if err != nil {
+			// Incomplete input is reported, since nothing can complete it.
+			if input != "" {
+				r.eval(input, true)
+			}
+			fmt.Fprintln(r.stdout)
+			if err != io.EOF {
+				fmt.Fprintf(r.stderr, "toyrepl: %v\n", err)
+				return exitFailure
+			}
+			return exitSuccess
+		}
+		if r.eval(input, false) {
+			input = ""
+		}
+	}
+}
+
+// eval parses and runs input. It returns false if the input is incomplete,
+// unless it is final, in which case the error is reported.
+func (r *repl) eval(input string, final bool) bool {
+	renderer := &diag.Renderer{Filename: inputName, Source: []byte(input)}
+	// An identifier is a typedef name if it was declared as one by earlier
+	// input.
+	nodes, err := parser.ParseInput(lexer.NewLexerTokenStream(lexer.Lex(input)),
+		parser.Typedefs(r.session.IsTypedef))
+	if err != nil {
+		e := err.(*parser.Error)
+		if e.IsIncomplete() && !final {
+			return false
+		}
+		renderer.Render(r.stderr, e.Diagnostic())
+		return true
+	}
+	for _, n := range nodes {
+		if err := r.execute(n); err != nil {
+			r.report(renderer, err)
+			break
+		}
+	}
+	return true
+}
+
+// report writes an error found in a line of input.
+func (r *repl) report(renderer *diag.Renderer, err error) {
+	switch err := err.(type) {
+	case sema.ErrorList:
+		for _, e := range err {
+			renderer.Render(r.stderr, e.Diagnostic())
+		}
+	case *interp.Error:
+		renderer.Render(r.stderr, &diag.Diagnostic{
+			Severity: diag.Error,
+			Pos:      err.Pos,
+			Msg:      err.Msg,
+			Code:     "runtime",
+		})
+	default:
+		fmt.Fprintf(r.stderr, "toyrepl: %v\n", err)
+	}
+}
+
+// execute checks an enum, typedef or struct definition, checks and runs a
+// function definition or statement, or evaluates an expression and prints its
+// value.
+func (r *repl) execute(n ast.Node) error {
+	switch n := n.(type) {
+	case *ast.EnumDeclaration:
+		return r.session.CheckEnum(n)
+	case *ast.TypedefDeclaration:
+		return r.session.CheckTypedef(n)
+	case *ast.StructDeclaration:
+		return r.session.CheckStruct(n)
+	case *ast.Function:
+		if err := r.session.CheckFunction(n); err != nil {
+			return err
+		}
+		r.interp.Define(n)
+	case ast.Expression:
+		if err := r.session.CheckExpression(n); err != nil {
+			return err
+		}
+		v, err := r.interp.Evaluate(n)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(r.stdout, v)
+	case ast.Statement:
+		if err := r.session.CheckStatement(n); err != nil {
+			return err
+		}
+		return r.interp.Exec(n)
+	}
+	return nil
+}
+
+// run executes the interpreter with the given command line arguments,
+// returning a process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("toyrepl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: toyrepl")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return exitSuccess
+	} else if err != nil {
+		return exitUsageError
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "toyrepl: unexpected argument %q\n", flags.Arg(0))
+		flags.Usage()
+		return exitUsageError
+	}
+
+	// Programs read from the same buffer as the interpreter, so that getchar
+	// reads the input which follows the line that calls it.
+	in := bufio.NewReader(stdin)
+	r := &repl{
+		stdin:   in,
+		stdout:  stdout,
+		stderr:  stderr,
+		session: sema.NewSession(),
+		interp:  interp.New(in, stdout),
+	}
+	return r.loop()
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// toyrepl runs the interpreter on the given standard input, returning the
+// exit code and the contents of standard output and standard error.
+func toyrepl(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestExpressions(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, stderr := toyrepl("1 + 2\n2.5 * 2; 7 / 2\n2.5 * 2\n")
+	assert.Equal(exitSuccess, status)
+	// Only the value of an expression which ends a line is printed.
+	assert.Equal("> 3\n> 3\n> 5\n> \n", stdout)
+	assert.Equal("", stderr)
+}
+
+func TestVariables(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, stderr := toyrepl("int a = 2;\na = a * 10;\nfor (int i = 0; i < 2; i++) a++;\na\n")
+	assert.Equal("> > > > 22\n> \n", stdout)
+	assert.Equal("", stderr)
+}
+
+func TestFunctions(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, stderr := toyrepl(`int fact(int n) {
+  if (n <= 1)
+    return 1;
+  return n * fact(n - 1);
+}
+fact(5)
+`)
+	assert.Equal("> . . . . > 120\n> \n", stdout)
+	assert.Equal("", stderr)
+}
+
+func TestFunctionsUseVariables(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, stderr := toyrepl("int x = 3;\nint f(int a) { return a + x; }\nf(1)\nx = 10;\nf(1)\n")
+	assert.Equal("> > > 4\n> > 11\n> \n", stdout)
+	assert.Equal("", stderr)
+}
+
+func TestStructs(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, stderr := toyrepl("struct point {\n  int x;\n  int y;\n};\nstruct point p; p.x = 3; p.y = 4;\n(&p)->x * p.y\n")
+	assert.Equal("> . . . > > 12\n> \n", stdout)
+	assert.Equal("", stderr)
+}
+
+func TestEnums(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, stderr := toyrepl("enum color {\n  RED,\n  GREEN = 4,\n  BLUE\n};\nenum color c = BLUE; c * 2\n")
+	assert.Equal("> . . . . > 10\n> \n", stdout)
+	assert.Equal("", stderr)
+}
+
+func TestTypedefs(t *testing.T) {
+	assert := assert.New(t)
+	// A typedef name declared by one line begins a declaration on the next.
+	_, stdout, stderr := toyrepl("typedef int *P;\nint x = 3; P p = &x;\nP * q = &p; **q * 2\n")
+	assert.Equal("> > > 6\n> \n", stdout)
+	assert.Equal("", stderr)
+}
+
+func TestPutchar(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, _ := toyrepl("int putchar(int c);\nputchar(104); putchar(10);\n")
+	assert.Equal("> > h\n> \n", stdout)
+}
+
+func TestGetchar(t *testing.T) {
+	assert := assert.New(t)
+	// getchar reads the input which follows its line.
+	_, stdout, _ := toyrepl("int getchar();\ngetchar(); getchar()\nx\n1\n")
+	assert.Equal("> > 10\n> 1\n> \n", stdout)
+}
+
+func TestErrors(t *testing.T) {
+	assert := assert.New(t)
+	// An error discards the rest of its line, and the session continues.
+	_, stdout, stderr := toyrepl("int a = 1; b; a = 2;\na\n")
+	assert.Equal("> > 1\n> \n", stdout)
+	assert.Equal("<stdin>:1:12: error: undefined identifier 'b'\n"+
+		"int a = 1; b; a = 2;\n"+
+		"           ^\n", stderr)
+
+	_, _, stderr = toyrepl("1 +; 2\n")
+	assert.Equal("<stdin>:1:4: error: expected expression, found \";\"\n"+
+		"1 +; 2\n"+
+		"   ^\n", stderr)
+
+	_, stdout, stderr = toyrepl("int a = 0;\n1 / a\n")
+	assert.Equal("> > > \n", stdout)
+	assert.Equal("<stdin>:1:1: error: division by zero\n"+
+		"1 / a\n"+
+		"^\n", stderr)
+}
+
+func TestIncompleteInput(t *testing.T) {
+	assert := assert.New(t)
+	// Input which is incomplete at the end of stdin is reported.
+	status, stdout, stderr := toyrepl("int f() {\n")
+	assert.Equal(exitSuccess, status)
+	assert.Equal("> . \n", stdout)
+	assert.Contains(stderr, "<stdin>:2:1: error: expected '}', found EOF\n")
+}
+
+func TestUsage(t *testing.T) {
+	assert := assert.New(t)
+	status, _, stderr := toyrepl("", "file.c")
+	assert.Equal(exitUsageError, status)
+	assert.Contains(stderr, `toyrepl: unexpected argument "file.c"`)
+	status, _, stderr = toyrepl("", "-h")
+	assert.Equal(exitSuccess, status)
+	assert.Contains(stderr, "Usage: toyrepl")
+}
@@ -0,0 +1,781 @@
+// Package arm64 generates AArch64 assembly from the intermediate
+// representation.
+//
+// The generated code targets the AAPCS64 procedure call standard, for Linux
+// or, with the Darwin option, for macOS on Apple silicon. Every temporary is
+// kept in a slot in the stack frame. Each instruction loads its operands into
+// w0 and w1, or x0 and x1 for pointers, or s0 and s1 or d0 and d1 for
+// floating-point values, computes its result, and stores it back to the slot
+// of its destination. x16 and x17 are scratch registers for addresses.
+package arm64
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+	"math"
+)
+
+type generator struct {
+	w      *bufio.Writer
+	err    error
+	pos    token.Position // The position of the code being compiled, if known.
+	darwin bool
+	// The sp-relative offset of the slot of each temporary in the current
+	// function, and of each of its IR slots.
+	offsets     map[*ir.Temp]int
+	slotOffsets map[*ir.Slot]int
+	// The number of jump tables emitted so far.
+	tables int
+	names  ir.NameGenerator // The names of the labels of the functions.
+}
+
+// An Option configures code generation.
+type Option func(*generator)
+
+// Darwin is an Option which targets macOS rather than Linux. Symbols are
+// prefixed with an underscore, and arguments on the stack are packed
+// according to their size.
+func Darwin(g *generator) {
+	g.darwin = true
+}
+
+// Generate writes the assembly for a program to w.
+func Generate(w io.Writer, program *ir.Program, options ...Option) error {
+	g := &generator{w: bufio.NewWriter(w)}
+	for _, option := range options {
+		option(g)
+	}
+	// Assembler-local labels start with L on macOS.
+	g.names.Prefix = ".L"
+	if g.darwin {
+		g.names.Prefix = "L"
+	}
+	g.program(program)
+	if g.err != nil {
+		return g.err
+	}
+	return g.w.Flush()
+}
+
+// emit writes an instruction.
+func (g *generator) emit(format string, args ...interface{}) {
+	g.printf("\t"+format+"\n", args...)
+}
+
+// label writes a label definition.
+func (g *generator) label(name string) {
+	g.printf("%s:\n", name)
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	if g.err == nil {
+		_, g.err = fmt.Fprintf(g.w, format, args...)
+	}
+}
+
+// errorf records an error for an instruction which cannot be compiled, at
+// its position.
+func (g *generator) errorf(format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = &ir.Error{Pos: g.pos, Msg: fmt.Sprintf(format, args...)}
+	}
+}
+
+// symbol returns the assembly name of a function.
+func (g *generator) symbol(name string) string {
+	if g.darwin {
+		return "_" + name
+	}
+	return name
+}
+
+// localLabel returns the name of an assembler-local label with a prefix and
+// number.
+func (g *generator) localLabel(prefix string, n int) string {
+	if g.darwin {
+		return fmt.Sprintf("L%s%d", prefix, n)
+	}
+	return fmt.Sprintf(".L%s%d", prefix, n)
+}
+
+// labelName returns the assembly name of a label.
+func (g *generator) labelName(l *ir.Label) string {
+	return g.names.Name(l)
+}
+
+func (g *generator) program(program *ir.Program) {
+	// The GNU assembler ignores the declarations of the symbols which are
+	// defined elsewhere, since every undefined symbol is global, but they
+	// document the object's dependencies.
+	if !g.darwin {
+		for _, name := range externs(program) {
+			g.emit(".extern %s", name)
+		}
+	}
+	g.emit(".text")
+	for _, f := range program.Functions {
+		g.function(f)
+	}
+	g.globals(program.Globals)
+	g.strings(program.Strings)
+	if !g.darwin {
+		// Mark the stack as non-executable.
+		g.emit(".section .note.GNU-stack,\"\",@progbits")
+	}
+}
+
+// externs returns the names of the functions which a program calls but does
+// not define, in order of their first call, followed by those of the global
+// variables which it declares but does not define.
+func externs(program *ir.Program) []string {
+	seen := make(map[string]bool)
+	for _, f := range program.Functions {
+		seen[f.Name] = true
+	}
+	var names []string
+	for _, f := range program.Functions {
+		for _, instr := range f.Instrs {
+			if c, ok := instr.(*ir.Call); ok && !seen[c.Function] {
+				seen[c.Function] = true
+				names = append(names, c.Function)
+			}
+		}
+	}
+	for _, v := range program.Globals {
+		if v.Extern {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+// globals emits the globals which have an initial value to the data section,
+// and the others to the zero-initialized bss section, each aligned to its
+// type. Those which are extern are defined elsewhere.
+func (g *generator) globals(globals []*ir.Global) {
+	var data, bss []*ir.Global
+	for _, v := range globals {
+		switch {
+		case v.Extern:
+		case v.Init != nil:
+			data = append(data, v)
+		default:
+			bss = append(bss, v)
+		}
+	}
+	if len(data) > 0 {
+		g.emit(".data")
+	}
+	for _, v := range data {
+		g.globalLabel(v)
+		switch init := v.Init.(type) {
+		case *ir.FloatConst:
+			if v.Type == types.Float {
+				g.emit(".word %#x", math.Float32bits(float32(init.Value)))
+			} else {
+				g.emit(".quad %#x", math.Float64bits(init.Value))
+			}
+		case *ir.IntConst:
+			g.emit("%s %d", dataDirectives[types.LP64.Sizeof(v.Type)], init.Value)
+		}
+	}
+	if len(bss) > 0 {
+		if g.darwin {
+			g.emit(".section __DATA,__bss")
+		} else {
+			g.emit(".bss")
+		}
+	}
+	for _, v := range bss {
+		g.globalLabel(v)
+		g.emit(".zero %d", size(v.Type))
+	}
+}
+
+// strings emits the string literals to the read-only data section, which on
+// Darwin is that of C strings, whose identical strings the linker merges.
+func (g *generator) strings(strings []*ir.Global) {
+	if len(strings) == 0 {
+		return
+	}
+	if g.darwin {
+		g.emit(".section __TEXT,__cstring,cstring_literals")
+	} else {
+		g.emit(".section .rodata")
+	}
+	for _, s := range strings {
+		g.label(g.globalName(s))
+		// The directive appends the terminating NUL.
+		g.emit(".asciz %s", ast.Quote(s.Data[:len(s.Data)-1], '"'))
+	}
+}
+
+// globalName returns the assembly name of a global: its symbol if it is a
+// variable, or an assembler-local label if it is a string literal.
+func (g *generator) globalName(v *ir.Global) string {
+	switch {
+	case v.Data == "":
+		return g.symbol(v.Name)
+	case g.darwin:
+		return "L" + v.Name
+	}
+	return ".L" + v.Name
+}
+
+// globalLabel emits the aligned label of a global, which is visible to other
+// objects unless it is static.
+func (g *generator) globalLabel(v *ir.Global) {
+	name := g.symbol(v.Name)
+	if !v.Static {
+		g.emit(".globl %s", name)
+	}
+	if n, _ := log2(types.LP64.Alignof(v.Type)); n > 0 {
+		g.emit(".p2align %d", n)
+	}
+	g.label(name)
+}
+
+// The size of a stack slot, in bytes.
+const slotSize = 8
+
+// The required alignment of the stack pointer, in bytes.
+const stackAlignment = 16
+
+// align rounds a size up to a multiple of the stack alignment.
+func align(size int) int {
+	if r := size % stackAlignment; r != 0 {
+		size += stackAlignment - r
+	}
+	return size
+}
+
+// layoutFrame assigns a slot to each temporary of a function, and then to each
+// of its IR slots, above the area in which the arguments of calls are passed
+// on the stack, so that sp is constant in the body of the function. It
+// returns the size of the frame.
+func (g *generator) layoutFrame(f *ir.Function) int {
+	args := 0
+	for _, instr := range f.Instrs {
+		if c, ok := instr.(*ir.Call); ok {
+			if _, size := g.classify(c.Args, fixedArgs(c)); size > args {
+				args = size
+			}
+		}
+	}
+	g.offsets = make(map[*ir.Temp]int)
+	for i, t := range f.Temps {
+		g.offsets[t] = align(args) + slotSize*i
+	}
+	g.slotOffsets = make(map[*ir.Slot]int)
+	offset := align(args) + slotSize*len(f.Temps)
+	for _, s := range f.Slots {
+		g.slotOffsets[s] = offset
+		// Each takes a whole number of 8-byte slots, so the next is aligned.
+		offset += (size(s.Type) + slotSize - 1) / slotSize * slotSize
+	}
+	return align(offset)
+}
+
+func (g *generator) function(f *ir.Function) {
+	g.pos = f.Pos
+	defer func() { g.pos = token.Position{} }()
+	name := g.symbol(f.Name)
+	if !f.Static {
+		g.emit(".globl %s", name)
+	}
+	g.emit(".p2align 2")
+	g.label(name)
+	g.names.Function(f)
+	// Save the frame pointer and link register.
+	g.emit("stp x29, x30, [sp, #-16]!")
+	g.emit("mov x29, sp")
+	if size := g.layoutFrame(f); size > 0 {
+		if size <= maxImmediate {
+			g.emit("sub sp, sp, #%d", size)
+		} else {
+			g.movImmediate("x16", uint64(size))
+			g.emit("sub sp, sp, x16")
+		}
+	}
+	g.moveParams(f)
+
+	for i, instr := range f.Instrs {
+		var next ir.Instr
+		if i+1 < len(f.Instrs) {
+			next = f.Instrs[i+1]
+		}
+		if pos := f.Position(i); pos.IsValid() {
+			g.pos = pos
+		}
+		g.instr(instr, next)
+	}
+}
+
+// The largest unsigned immediate of an arithmetic instruction, and of the
+// offset of a load or store.
+const maxImmediate = 4095
+
+// movImmediate moves a constant to a register, 16 bits at a time. Zero
+// halfwords above the lowest are skipped.
+func (g *generator) movImmediate(reg string, value uint64) {
+	g.emit("mov %s, #%d", reg, value&0xffff)
+	for shift := uint(16); shift < 64 && value>>shift != 0; shift += 16 {
+		if half := (value >> shift) & 0xffff; half != 0 {
+			g.emit("movk %s, #%d, lsl #%d", reg, half, shift)
+		}
+	}
+}
+
+// slot returns the memory operand of the slot at an sp-relative offset.
+func (g *generator) slot(offset int) string {
+	if offset <= maxImmediate {
+		return fmt.Sprintf("[sp, #%d]", offset)
+	}
+	g.movImmediate("x16", uint64(offset))
+	g.emit("add x16, sp, x16")
+	return "[x16]"
+}
+
+// The data directive of an integer of each size.
+var dataDirectives = map[int]string{1: ".byte", 2: ".hword", 4: ".word", 8: ".quad"}
+
+// isWide returns whether a value of type t is held in an x register: a
+// pointer or a long.
+func isWide(t types.Type) bool {
+	return types.IsPointer(t) || types.IsInteger(t) && types.Width(t) == 64
+}
+
+// reg returns the name of the n'th register for a value of type t: wn for an
+// int, xn for a pointer or a long, sn for a float, or dn for a double.
+func reg(t types.Type, n int) string {
+	switch {
+	case t == types.Float:
+		return fmt.Sprintf("s%d", n)
+	case t == types.Double:
+		return fmt.Sprintf("d%d", n)
+	case isWide(t):
+		return fmt.Sprintf("x%d", n)
+	}
+	return fmt.Sprintf("w%d", n)
+}
+
+// The instruction which loads each integer type narrower than an int from
+// memory, extending it to 32 bits, in which it is held in a register.
+var narrowLoads = map[types.Type]string{
+	types.Char:          "ldrsb",
+	types.UnsignedChar:  "ldrb",
+	types.Short:         "ldrsh",
+	types.UnsignedShort: "ldrh",
+}
+
+// loadOp returns the instruction which loads a value of type t from memory.
+func loadOp(t types.Type) string {
+	if op, ok := narrowLoads[t]; ok {
+		return op
+	}
+	return "ldr"
+}
+
+// storeOp returns the instruction which stores a value of type t to memory.
+func storeOp(t types.Type) string {
+	switch types.LP64.Sizeof(t) {
+	case 1:
+		return "strb"
+	case 2:
+		return "strh"
+	}
+	return "str"
+}
+
+// load moves a value to the n'th register for its type.
+func (g *generator) load(v ir.Value, n int) {
+	dst := reg(v.Type(), n)
+	switch v := v.(type) {
+	case *ir.Temp:
+		g.emit("ldr %s, %s", dst, g.slot(g.offsets[v]))
+	case *ir.IntConst:
+		value := v.Value
+		if !isWide(v.Type()) {
+			value = int64(int32(value))
+		}
+		switch {
+		case value >= -0x10000 && value <= 0xffff:
+			g.emit("mov %s, #%d", dst, value)
+		case isWide(v.Type()):
+			g.movImmediate(dst, uint64(value))
+		default:
+			g.movImmediate(dst, uint64(uint32(value)))
+		}
+	case *ir.FloatConst:
+		// Build the bits of the constant in an integer register.
+		if v.Type() == types.Float {
+			g.movImmediate("w16", uint64(math.Float32bits(float32(v.Value))))
+			g.emit("fmov %s, w16", dst)
+		} else {
+			g.movImmediate("x16", math.Float64bits(v.Value))
+			g.emit("fmov %s, x16", dst)
+		}
+	default:
+		g.errorf("invalid operand %v", v)
+	}
+}
+
+// store moves the result in w0, x0, s0 or d0 to the slot of a temporary.
+func (g *generator) store(t *ir.Temp) {
+	g.emit("str %s, %s", reg(t.Type(), 0), g.slot(g.offsets[t]))
+}
+
+func (g *generator) epilogue() {
+	g.emit("mov sp, x29")
+	g.emit("ldp x29, x30, [sp], #16")
+	g.emit("ret")
+}
+
+// instr emits an instruction. The instruction which follows it, if any, is
+// used to avoid jumps to the next instruction.
+func (g *generator) instr(instr ir.Instr, next ir.Instr) {
+	switch i := instr.(type) {
+	case *ir.Copy:
+		g.load(i.Src, 0)
+		g.store(i.Dst)
+	case *ir.Unary:
+		g.load(i.Src, 0)
+		g.unary(i)
+		g.store(i.Dst)
+	case *ir.Binary:
+		g.load(i.Lhs, 0)
+		g.load(i.Rhs, 1)
+		g.binary(i)
+		g.store(i.Dst)
+	case *ir.Convert:
+		g.load(i.Src, 0)
+		g.convert(i.Src.Type(), i.Dst.Type())
+		g.store(i.Dst)
+	case *ir.Select:
+		g.selectInstr(i)
+	case *ir.GlobalAddr:
+		// The address is that of its 4KB page, plus the offset within it.
+		name := g.globalName(i.Global)
+		if g.darwin {
+			g.emit("adrp x0, %s@PAGE", name)
+			g.emit("add x0, x0, %s@PAGEOFF", name)
+		} else {
+			g.emit("adrp x0, %s", name)
+			g.emit("add x0, x0, :lo12:%s", name)
+		}
+		g.store(i.Dst)
+	case *ir.Addr:
+		if offset := g.slotOffsets[i.Slot]; offset <= maxImmediate {
+			g.emit("add x0, sp, #%d", offset)
+		} else {
+			g.movImmediate("x16", uint64(offset))
+			g.emit("add x0, sp, x16")
+		}
+		g.store(i.Dst)
+	case *ir.Load:
+		g.load(i.Addr, 0)
+		g.emit("%s %s, [x0]", loadOp(i.Dst.Type()), reg(i.Dst.Type(), 0))
+		g.store(i.Dst)
+	case *ir.Store:
+		g.load(i.Addr, 0)
+		g.load(i.Src, 1)
+		g.emit("%s %s, [x0]", storeOp(i.Src.Type()), reg(i.Src.Type(), 1))
+	case *ir.PtrAdd:
+		g.load(i.Ptr, 0)
+		g.load(i.Index, 1)
+		g.ptrAdd(i.Ptr.Type().(*types.Pointer).Elem, i.Index.Type())
+		g.store(i.Dst)
+	case *ir.FieldAddr:
+		g.load(i.Ptr, 0)
+		s := i.Ptr.Type().(*types.Pointer).Elem.(*types.Struct)
+		g.fieldAddr(types.LP64.Offsetof(s, i.Field))
+		g.store(i.Dst)
+	case *ir.PtrDiff:
+		g.load(i.Lhs, 0)
+		g.load(i.Rhs, 1)
+		g.ptrDiff(i.Lhs.Type().(*types.Pointer).Elem)
+		g.store(i.Dst)
+	case *ir.Label:
+		g.label(g.labelName(i))
+	case *ir.Jump:
+		if next != ir.Instr(i.Target) {
+			g.emit("b %s", g.labelName(i.Target))
+		}
+	case *ir.Branch:
+		g.load(i.Cond, 0)
+		if next == ir.Instr(i.True) {
+			g.emit("cbz w0, %s", g.labelName(i.False))
+			return
+		}
+		g.emit("cbnz w0, %s", g.labelName(i.True))
+		if next != ir.Instr(i.False) {
+			g.emit("b %s", g.labelName(i.False))
+		}
+	case *ir.Switch:
+		g.switchInstr(i, next)
+	case *ir.Call:
+		g.call(i)
+	case *ir.Return:
+		g.load(i.Value, 0)
+		g.epilogue()
+	default:
+		g.errorf("unsupported instruction %v", instr)
+	}
+}
+
+// selectInstr emits a conditional select. Loading the operands does not
+// affect the flags set by the comparison of the condition.
+func (g *generator) selectInstr(i *ir.Select) {
+	if types.IsFloating(i.Dst.Type()) {
+		g.errorf("unsupported instruction %v", i)
+		return
+	}
+	t := i.Dst.Type()
+	g.load(i.Cond, 0)
+	g.emit("cmp w0, #0")
+	g.load(i.False, 0)
+	g.load(i.True, 1)
+	g.emit("csel %s, %s, %s, ne", reg(t, 0), reg(t, 1), reg(t, 0))
+	g.store(i.Dst)
+}
+
+// log2 returns the base 2 logarithm of a size, and whether it is a power of
+// two.
+func log2(size int) (uint, bool) {
+	var n uint
+	for 1<<n < size {
+		n++
+	}
+	return n, 1<<n == size
+}
+
+// ptrAdd adds the integer index in w1 or x1, scaled by the size of elem, to
+// the pointer in x0. An index narrower than a long is extended with its sign
+// unless it is unsigned.
+func (g *generator) ptrAdd(elem, index types.Type) {
+	size := types.LP64.Sizeof(elem)
+	if isWide(index) {
+		if n, ok := log2(size); ok && n <= 4 {
+			g.emit("add x0, x0, x1, lsl #%d", n)
+			return
+		}
+		g.movImmediate("x2", uint64(size))
+		g.emit("madd x0, x1, x2, x0")
+		return
+	}
+	extend, madd := "sxtw", "smaddl"
+	if types.IsUnsigned(index) {
+		extend, madd = "uxtw", "umaddl"
+	}
+	if n, ok := log2(size); ok && n <= 4 {
+		g.emit("add x0, x0, w1, %s #%d", extend, n)
+		return
+	}
+	g.movImmediate("w2", uint64(size))
+	g.emit("%s x0, w1, w2, x0", madd)
+}
+
+// fieldAddr adds the byte offset of a field to the pointer in x0.
+func (g *generator) fieldAddr(offset int) {
+	switch {
+	case offset == 0:
+	case offset <= maxImmediate:
+		g.emit("add x0, x0, #%d", offset)
+	default:
+		g.movImmediate("x1", uint64(offset))
+		g.emit("add x0, x0, x1")
+	}
+}
+
+// ptrDiff leaves in w0 the number of elements of type elem between the
+// pointers in x0 and x1. The difference in bytes is an exact multiple of the
+// size.
+func (g *generator) ptrDiff(elem types.Type) {
+	g.emit("sub x0, x0, x1")
+	size := types.LP64.Sizeof(elem)
+	if n, ok := log2(size); ok {
+		if n > 0 {
+			g.emit("asr x0, x0, #%d", n)
+		}
+		return
+	}
+	g.movImmediate("x2", uint64(size))
+	g.emit("sdiv x0, x0, x2")
+}
+
+func (g *generator) unary(i *ir.Unary) {
+	t := i.Src.Type()
+	switch {
+	case i.Op == ir.Neg && types.IsFloating(t):
+		g.emit("fneg %s, %s", reg(t, 0), reg(t, 0))
+	case i.Op == ir.Neg && types.IsInteger(t):
+		g.emit("neg %s, %s", reg(t, 0), reg(t, 0))
+	case i.Op == ir.Not && types.IsInteger(t):
+		g.emit("mvn %s, %s", reg(t, 0), reg(t, 0))
+	default:
+		g.errorf("unsupported instruction %v", i)
+	}
+}
+
+// The instruction for each integer arithmetic operator, other than
+// remainder.
+var intArithmetic = map[ir.Op]string{
+	ir.Add: "add",
+	ir.Sub: "sub",
+	ir.Mul: "mul",
+	ir.Div: "sdiv",
+	ir.And: "and",
+	ir.Or:  "orr",
+	ir.Xor: "eor",
+	// A shift by a register takes the count modulo the width of the
+	// register.
+	ir.Shl: "lsl",
+	ir.Shr: "asr",
+}
+
+// The instruction for each arithmetic operator on unsigned integers, other than
+// remainder, of which division and right shift differ from those on ints.
+var unsignedArithmetic = map[ir.Op]string{
+	ir.Add: "add",
+	ir.Sub: "sub",
+	ir.Mul: "mul",
+	ir.Div: "udiv",
+	ir.And: "and",
+	ir.Or:  "orr",
+	ir.Xor: "eor",
+	ir.Shl: "lsl",
+	ir.Shr: "lsr",
+}
+
+// The instruction for each floating-point arithmetic operator.
+var floatArithmetic = map[ir.Op]string{
+	ir.Add: "fadd",
+	ir.Sub: "fsub",
+	ir.Mul: "fmul",
+	ir.Div: "fdiv",
+}
+
+// The condition under which each integer comparison is true.
+var intConditions = map[ir.Op]string{
+	ir.Eq: "eq",
+	ir.Ne: "ne",
+	ir.Lt: "lt",
+	ir.Le: "le",
+	ir.Gt: "gt",
+	ir.Ge: "ge",
+}
+
+// The condition under which each comparison of unsigned integers or of
+// pointers, which are unsigned, is true.
+var unsignedConditions = map[ir.Op]string{
+	ir.Eq: "eq",
+	ir.Ne: "ne",
+	ir.Lt: "lo",
+	ir.Le: "ls",
+	ir.Gt: "hi",
+	ir.Ge: "hs",
+}
+
+// The condition under which each floating-point comparison is true. An
+// unordered comparison, of a NaN, sets C and V, so that only ne is true.
+var floatConditions = map[ir.Op]string{
+	ir.Eq: "eq",
+	ir.Ne: "ne",
+	ir.Lt: "mi",
+	ir.Le: "ls",
+	ir.Gt: "gt",
+	ir.Ge: "ge",
+}
+
+func (g *generator) binary(i *ir.Binary) {
+	t := i.Lhs.Type()
+	lhs, rhs := reg(t, 0), reg(t, 1)
+	if types.IsFloating(t) {
+		if cond, ok := floatConditions[i.Op]; ok {
+			g.emit("fcmp %s, %s", lhs, rhs)
+			g.emit("cset w0, %s", cond)
+		} else if op, ok := floatArithmetic[i.Op]; ok {
+			g.emit("%s %s, %s, %s", op, lhs, lhs, rhs)
+		} else {
+			g.errorf("unsupported instruction %v", i)
+		}
+		return
+	}
+
+	unsigned := types.IsUnsigned(t)
+	if cond, ok := intConditions[i.Op]; ok {
+		if types.IsPointer(t) || unsigned {
+			cond = unsignedConditions[i.Op]
+		}
+		g.emit("cmp %s, %s", lhs, rhs)
+		g.emit("cset w0, %s", cond)
+	} else if op, ok := intArithmetic[i.Op]; ok {
+		if unsigned {
+			op = unsignedArithmetic[i.Op]
+		}
+		g.emit("%s %s, %s, %s", op, lhs, lhs, rhs)
+	} else if i.Op == ir.Rem {
+		// a % b = a - (a / b) * b
+		div := "sdiv"
+		if unsigned {
+			div = "udiv"
+		}
+		g.emit("%s %s, %s, %s", div, reg(t, 2), lhs, rhs)
+		g.emit("msub %s, %s, %s, %s", lhs, reg(t, 2), rhs, lhs)
+	} else {
+		g.errorf("unsupported instruction %v", i)
+	}
+}
+
+// The instruction which extends each integer type narrower than an int from
+// the low bits of w0, in which it is held extended to 32 bits.
+var extensions = map[types.Type]string{
+	types.Char:          "sxtb",
+	types.UnsignedChar:  "uxtb",
+	types.Short:         "sxth",
+	types.UnsignedShort: "uxth",
+}
+
+// convert converts the value in w0, x0, s0 or d0 between arithmetic types, or
+// between an integer and a pointer. Conversions from floating-point to
+// integer types truncate towards zero, and those from wider to narrower
+// integer types keep the low bits, which are extended if the result is
+// narrower than an int. A conversion to a long or a pointer extends a signed
+// value. An unsigned int is held zero-extended to 64 bits, as the
+// instructions which write a w register leave it, and is converted from a
+// floating-point type as a long, whose low 32 bits are those of the result,
+// like the x86-64 code.
+func (g *generator) convert(from, to types.Type) {
+	if from == to {
+		return
+	}
+	switch {
+	case (types.IsInteger(from) || types.IsPointer(from)) && (types.IsInteger(to) || types.IsPointer(to)):
+		if isWide(to) && !isWide(from) && !types.IsUnsigned(from) {
+			g.emit("sxtw x0, w0")
+		}
+	case types.IsUnsigned(from) && types.IsFloating(to):
+		g.emit("ucvtf %s, %s", reg(to, 0), reg(from, 0))
+	case types.IsInteger(from) && types.IsFloating(to):
+		g.emit("scvtf %s, %s", reg(to, 0), reg(from, 0))
+	case types.IsFloating(from) && to == types.UnsignedLong:
+		g.emit("fcvtzu x0, %s", reg(from, 0))
+	case types.IsFloating(from) && (to == types.UnsignedInt || isWide(to)):
+		g.emit("fcvtzs x0, %s", reg(from, 0))
+	case types.IsFloating(from) && types.IsInteger(to):
+		g.emit("fcvtzs w0, %s", reg(from, 0))
+	case types.IsFloating(from) && types.IsFloating(to):
+		g.emit("fcvt %s, %s", reg(to, 0), reg(from, 0))
+	default:
+		g.errorf("unsupported conversion from %v to %v", from, to)
+		return
+	}
+	if op, ok := extensions[to]; ok {
+		g.emit("%s w0, w0", op)
+	}
+}
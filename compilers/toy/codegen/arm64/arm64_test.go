@@ -0,0 +1,293 @@
+package arm64
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// generate compiles a program to assembly.
+func generate(t *testing.T, input string, options ...Option) string {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	lowered, err := ir.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := Generate(&b, lowered, options...); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestGenerateReturn(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`	.text
+	.globl main
+	.p2align 2
+main:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+	mov w0, #2
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+	.section .note.GNU-stack,"",@progbits
+`, generate(t, "int main() { return 2; }"))
+}
+
+func TestGenerateDarwin(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f() { return 1; } int main() { return f() ? 2 : 3; }", Darwin)
+	assert.Contains(asm, "\t.globl _main\n\t.p2align 2\n_main:\n")
+	assert.Contains(asm, "\tbl _f\n")
+	assert.NotContains(asm, ".note.GNU-stack")
+}
+
+func TestGenerateBinaryOp(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 7; return a - 3; }")
+	assert.Contains(asm, `	sub sp, sp, #16
+	mov w0, #7
+	str w0, [sp, #0]
+	ldr w0, [sp, #0]
+	mov w1, #3
+	sub w0, w0, w1
+	str w0, [sp, #8]
+	ldr w0, [sp, #8]
+`)
+}
+
+func TestGenerateUnaryOps(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 5; return -~a; }")
+	assert.Contains(asm, "\tldr w0, [sp, #0]\n\tmvn w0, w0\n\tstr w0, [sp, #8]\n")
+	assert.Contains(asm, "\tldr w0, [sp, #8]\n\tneg w0, w0\n\tstr w0, [sp, #16]\n")
+}
+
+func TestGenerateRemainder(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 7; return a % 2; }")
+	assert.Contains(asm, "\tsdiv w2, w0, w1\n\tmsub w0, w2, w1, w0\n")
+}
+
+func TestGenerateBitwiseOps(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 7; return (a | 1) ^ (a & 2) ^ (a << 3) ^ (a >> 1); }")
+	for _, op := range []string{"orr", "and", "eor", "lsl", "asr"} {
+		assert.Contains(asm, "\t"+op+" w0, w0, w1\n")
+	}
+}
+
+func TestGenerateComparison(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 3; return a <= 4; }")
+	assert.Contains(asm, "\tmov w1, #4\n\tcmp w0, w1\n\tcset w0, le\n")
+}
+
+func TestGenerateLargeConstants(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 100000; return 65536; }")
+	assert.Contains(asm, "\tmov w0, #34464\n\tmovk w0, #1, lsl #16\n")
+	assert.Contains(asm, "\tmov w0, #0\n\tmovk w0, #1, lsl #16\n")
+}
+
+func TestGenerateLargeFrame(t *testing.T) {
+	assert := assert.New(t)
+	f := &ir.Function{Name: "main", Result: types.Int}
+	var last *ir.Temp
+	for i := 0; i < 600; i++ {
+		last = f.NewTemp(types.Int)
+		f.Emit(&ir.Copy{Dst: last, Src: ir.NewInt(int64(i), types.Int)})
+	}
+	f.Emit(&ir.Return{Value: last})
+	var b bytes.Buffer
+	assert.NoError(Generate(&b, &ir.Program{Functions: []*ir.Function{f}}))
+	asm := b.String()
+	assert.Contains(asm, "\tmov x16, #4800\n\tsub sp, sp, x16\n")
+	// Slots beyond the range of an immediate offset are addressed with x16.
+	assert.Contains(asm, "\tmov w0, #599\n\tmov x16, #4792\n\tadd x16, sp, x16\n\tstr w0, [x16]\n")
+	assert.Contains(asm, "\tstr w0, [sp, #4088]\n")
+}
+
+func TestGenerateBranch(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { while (a) a = a - 1; return a; }")
+	assert.Contains(asm, ".Lf.1:\n\tldr w0, [sp, #0]\n\tcbz w0, .Lf.3\n.Lf.2:\n")
+	assert.Contains(asm, "\tb .Lf.1\n.Lf.3:\n")
+}
+
+func TestGenerateConditionalSelect(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { return a ? 3 : 4; }")
+	assert.Contains(asm, `	cmp w0, #0
+	mov w0, #4
+	mov w1, #3
+	csel w0, w1, w0, ne
+`)
+}
+
+func TestGenerateDoubleArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "double f() { return 1.5 * 2.0; }")
+	assert.Contains(asm, `	mov x16, #0
+	movk x16, #16376, lsl #48
+	fmov d0, x16
+	mov x16, #0
+	movk x16, #16384, lsl #48
+	fmov d1, x16
+	fmul d0, d0, d1
+	str d0, [sp, #0]
+`)
+}
+
+func TestGenerateFloatComparison(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { float a; return a < 1.0f; }")
+	// mi rather than lt, which is true of an unordered comparison.
+	assert.Contains(asm, "\tfcmp s0, s1\n\tcset w0, mi\n")
+	asm = generate(t, "int main() { double a; return a <= 1.0; }")
+	assert.Contains(asm, "\tfcmp d0, d1\n\tcset w0, ls\n")
+}
+
+func TestGenerateConversions(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { double d = 1; float f = d; return f; }")
+	assert.Contains(asm, "\tmov w0, #1\n\tscvtf d0, w0\n")
+	assert.Contains(asm, "\tfcvt s0, d0\n")
+	assert.Contains(asm, "\tfcvtzs w0, s0\n")
+}
+
+func TestGenerateCasts(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int x, char *p) { int *q = (int *)x; return (char)x + (int)(p == (char *)q); }")
+	assert.Contains(asm, "\tldr w0, [sp, #0]\n\tsxtw x0, w0\n")
+	assert.Contains(asm, "\tldr w0, [sp, #0]\n\tsxtb w0, w0\n")
+}
+
+func TestGenerateUnsupportedInstruction(t *testing.T) {
+	assert := assert.New(t)
+	f := &ir.Function{Name: "main", Result: types.Double}
+	d := f.NewTemp(types.Double)
+	f.Emit(&ir.Unary{Op: ir.Not, Dst: d, Src: d})
+	f.Emit(&ir.Return{Value: d})
+	var b bytes.Buffer
+	err := Generate(&b, &ir.Program{Functions: []*ir.Function{f}})
+	assert.EqualError(err, "unsupported instruction %0:double = not %0")
+}
+
+func TestGenerateAddressOf(t *testing.T) {
+	assert := assert.New(t)
+	// Slots follow the slots of temporaries.
+	asm := generate(t, "int main() { int a = 1; int *p = &a; *p = 2; return *p; }")
+	assert.Contains(asm, "\tadd x0, sp, #32\n\tstr x0, [sp, #0]\n")
+	assert.Contains(asm, "\tldr x0, [sp, #0]\n\tmov w1, #1\n\tstr w1, [x0]\n")
+	assert.Contains(asm, "\tldr x0, [sp, #8]\n\tldr w0, [x0]\n")
+}
+
+func TestGeneratePointerArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int *p, int *q) { return (p + 1) - q + (p < q); }")
+	assert.Contains(asm, "\tstr x0, [sp, #0]\n\tstr x1, [sp, #8]\n")
+	assert.Contains(asm, "\tadd x0, x0, w1, sxtw #2\n")
+	assert.Contains(asm, "\tsub x0, x0, x1\n\tasr x0, x0, #2\n\tstr w0, [sp, #24]\n")
+	assert.Contains(asm, "\tcmp x0, x1\n\tcset w0, lo\n")
+}
+
+func TestGenerateUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(unsigned a, unsigned b, int *p) {
+  return a / b + a % b + (a >> b) + (a < b) + p[a];
+}`)
+	assert.Contains(asm, "\tudiv w0, w0, w1\n")
+	assert.Contains(asm, "\tudiv w2, w0, w1\n\tmsub w0, w2, w1, w0\n")
+	assert.Contains(asm, "\tlsr w0, w0, w1\n")
+	assert.Contains(asm, "\tcmp w0, w1\n\tcset w0, lo\n")
+	assert.Contains(asm, "\tadd x0, x0, w1, uxtw #2\n")
+
+	asm = generate(t, "unsigned f(double d) { return d + (unsigned)d; }")
+	assert.Contains(asm, "\tfcvtzs x0, d0\n")
+	assert.Contains(asm, "\tucvtf d0, w0\n")
+}
+
+func TestGenerateIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `long f(long a, long b, short *s, unsigned short *u, int *p) {
+  *s = a;
+  *u = b;
+  return a / b + a % b + (a >> b) + -a + *s + *u + p[a];
+}`)
+	assert.Contains(asm, "\tsdiv x0, x0, x1\n")
+	assert.Contains(asm, "\tsdiv x2, x0, x1\n\tmsub x0, x2, x1, x0\n")
+	assert.Contains(asm, "\tasr x0, x0, x1\n")
+	assert.Contains(asm, "\tneg x0, x0\n")
+	assert.Contains(asm, "\tsxth w0, w0\n")
+	assert.Contains(asm, "\tuxth w0, w0\n")
+	assert.Contains(asm, "\tstrh w1, [x0]\n")
+	assert.Contains(asm, "\tldrsh w0, [x0]\n")
+	assert.Contains(asm, "\tldrh w0, [x0]\n")
+	assert.Contains(asm, "\tsxtw x0, w0\n")
+	assert.Contains(asm, "\tadd x0, x0, x1, lsl #2\n")
+
+	asm = generate(t, "unsigned long f(double d, unsigned long a) { return d + a; }")
+	assert.Contains(asm, "\tucvtf d0, x0\n")
+	assert.Contains(asm, "\tfcvtzu x0, d0\n")
+}
+
+func TestGenerateGlobals(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int a = 3; float f = 1; double *p; int main() { return a; }")
+	assert.Contains(asm, "\t.data\n\t.globl a\n\t.p2align 2\na:\n\t.word 3\n"+
+		"\t.globl f\n\t.p2align 2\nf:\n\t.word 0x3f800000\n")
+	assert.Contains(asm, "\t.bss\n\t.globl p\n\t.p2align 3\np:\n\t.zero 8\n")
+	assert.Contains(asm, "\tadrp x0, a\n\tadd x0, x0, :lo12:a\n")
+	asm = generate(t, "int a; int main() { return a; }", Darwin)
+	assert.Contains(asm, "\t.section __DATA,__bss\n\t.globl _a\n\t.p2align 2\n_a:\n")
+	assert.Contains(asm, "\tadrp x0, _a@PAGE\n\tadd x0, x0, _a@PAGEOFF\n")
+}
+
+func TestGenerateLinkage(t *testing.T) {
+	assert := assert.New(t)
+	input := `int puts(char *s); extern int n; static int count;
+static int f(int x) { return x; }
+int main() { puts("hi"); count = n; return f(count); }`
+	asm := generate(t, input)
+	assert.True(strings.HasPrefix(asm, "\t.extern puts\n\t.extern n\n\t.text\n"), asm)
+	assert.Contains(asm, "\t.text\n\t.p2align 2\nf:\n")
+	assert.Contains(asm, "\t.globl main\n\t.p2align 2\nmain:\n")
+	assert.Contains(asm, "\t.bss\n\t.p2align 2\ncount:\n\t.zero 4\n")
+	assert.NotContains(asm, "\nn:")
+	assert.NotContains(generate(t, input, Darwin), ".extern")
+}
+
+func TestGenerateStrings(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int puts(char *s); int main() { puts("hi"); return puts("hi"); }`)
+	assert.Contains(asm, "\t.section .rodata\n.Lstr.0:\n\t.asciz \"hi\"\n")
+	assert.NotContains(asm, ".Lstr.1")
+	assert.Contains(asm, "\tadrp x0, .Lstr.0\n\tadd x0, x0, :lo12:.Lstr.0\n")
+	asm = generate(t, `int puts(char *s); int main() { return puts("hi"); }`, Darwin)
+	assert.Contains(asm, "\t.section __TEXT,__cstring,cstring_literals\nLstr.0:\n\t.asciz \"hi\"\n")
+	assert.Contains(asm, "\tadrp x0, Lstr.0@PAGE\n\tadd x0, x0, Lstr.0@PAGEOFF\n")
+}
+
+func TestGenerateChars(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "char g = -1; int main() { char c = g; c++; g = c; return c; }")
+	assert.Contains(asm, "\t.globl g\ng:\n\t.byte -1\n")
+	assert.Contains(asm, "\tldrsb w0, [x0]\n")
+	assert.Contains(asm, "\tsxtb w0, w0\n")
+	assert.Contains(asm, "\tstrb w1, [x0]\n")
+}
@@ -0,0 +1,113 @@
+package arm64
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// The number of registers in which integer and pointer arguments are passed,
+// x0 to x7, and in which floating-point arguments are passed, v0 to v7.
+const argRegisters = 8
+
+// Where an argument is passed: in the n'th register for its type, or at an
+// offset in the arguments on the stack.
+type argLocation struct {
+	inRegister bool
+	register   int
+	stack      int
+}
+
+// size returns the size in bytes of a value of type t.
+func size(t types.Type) int {
+	return types.LP64.Sizeof(t)
+}
+
+// classify returns the locations of arguments according to the AAPCS64, and
+// the size in bytes of those passed on the stack. Integer and floating-point
+// arguments are assigned registers separately, in order, and the rest are
+// passed on the stack from left to right, each in an 8-byte slot, or on
+// Darwin, aligned to its size. The arguments after the first fixed are the
+// variable arguments of a variadic function, which Darwin passes on the stack,
+// each in an 8-byte slot.
+func (g *generator) classify(args []ir.Value, fixed int) ([]argLocation, int) {
+	locations := make([]argLocation, len(args))
+	ints, floats, stack := 0, 0, 0
+	for i, a := range args {
+		t := a.Type()
+		switch {
+		case g.darwin && i >= fixed:
+			stack += (slotSize - stack%slotSize) % slotSize
+			locations[i] = argLocation{stack: stack}
+			stack += slotSize
+		case types.IsFloating(t) && floats < argRegisters:
+			locations[i] = argLocation{inRegister: true, register: floats}
+			floats++
+		case !types.IsFloating(t) && ints < argRegisters:
+			locations[i] = argLocation{inRegister: true, register: ints}
+			ints++
+		case g.darwin:
+			stack += (size(t) - stack%size(t)) % size(t)
+			locations[i] = argLocation{stack: stack}
+			stack += size(t)
+		default:
+			locations[i] = argLocation{stack: stack}
+			stack += slotSize
+		}
+	}
+	return locations, stack
+}
+
+// fixedArgs returns the number of arguments of a call which are not variable
+// arguments.
+func fixedArgs(c *ir.Call) int {
+	if c.Variadic {
+		return c.Fixed
+	}
+	return len(c.Args)
+}
+
+// params returns the parameters of a function as values, to classify them.
+func params(f *ir.Function) []ir.Value {
+	values := make([]ir.Value, len(f.Params))
+	for i, p := range f.Params {
+		values[i] = p
+	}
+	return values
+}
+
+// moveParams stores the arguments of the current function to the slots of
+// its parameters. Arguments on the stack are above the saved frame pointer
+// and link register.
+func (g *generator) moveParams(f *ir.Function) {
+	locations, _ := g.classify(params(f), len(f.Params))
+	for i, p := range f.Params {
+		if locations[i].inRegister {
+			g.emit("str %s, %s", reg(p.Type(), locations[i].register), g.slot(g.offsets[p]))
+		} else {
+			g.emit("%s %s, [x29, #%d]", loadOp(p.Type()), reg(p.Type(), 0),
+				2*slotSize+locations[i].stack)
+			g.store(p)
+		}
+	}
+}
+
+// call emits a call. Since every temporary is in memory, the arguments are
+// loaded directly into the registers in which they are passed, once those
+// passed on the stack have been stored at the bottom of the frame.
+func (g *generator) call(c *ir.Call) {
+	locations, _ := g.classify(c.Args, fixedArgs(c))
+	for i, a := range c.Args {
+		if !locations[i].inRegister {
+			g.load(a, 0)
+			g.emit("%s %s, %s", storeOp(a.Type()), reg(a.Type(), 0),
+				g.slot(locations[i].stack))
+		}
+	}
+	for i, a := range c.Args {
+		if locations[i].inRegister {
+			g.load(a, locations[i].register)
+		}
+	}
+	g.emit("bl %s", g.symbol(c.Function))
+	g.store(c.Dst)
+}
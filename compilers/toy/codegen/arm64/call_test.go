@@ -0,0 +1,113 @@
+package arm64
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// values returns temporaries of the given types.
+func values(ts ...types.Type) []ir.Value {
+	f := &ir.Function{}
+	var values []ir.Value
+	for _, t := range ts {
+		values = append(values, f.NewTemp(t))
+	}
+	return values
+}
+
+func TestClassify(t *testing.T) {
+	assert := assert.New(t)
+	args := []types.Type{types.Int, types.Double, types.Float}
+	for i := 0; i < 8; i++ {
+		args = append(args, types.Int)
+	}
+	args = append(args, types.Double)
+	g := &generator{}
+	locations, stack := g.classify(values(args...), len(args))
+	assert.Equal(argLocation{inRegister: true, register: 0}, locations[0])
+	assert.Equal(argLocation{inRegister: true, register: 0}, locations[1])
+	assert.Equal(argLocation{inRegister: true, register: 1}, locations[2])
+	assert.Equal(argLocation{inRegister: true, register: 7}, locations[9])
+	// The ninth int argument is the first on the stack.
+	assert.Equal(argLocation{stack: 0}, locations[10])
+	assert.Equal(argLocation{inRegister: true, register: 2}, locations[11])
+	assert.Equal(8, stack)
+
+	locations, stack = g.classify(nil, 0)
+	assert.Empty(locations)
+	assert.Equal(0, stack)
+}
+
+func TestClassifyStackArguments(t *testing.T) {
+	assert := assert.New(t)
+	var args []types.Type
+	for i := 0; i < 8; i++ {
+		args = append(args, types.Int)
+	}
+	args = append(args, types.Int, types.Int, types.Int)
+	for i := 0; i < 9; i++ {
+		args = append(args, types.Double)
+	}
+
+	g := &generator{}
+	locations, stack := g.classify(values(args...), len(args))
+	assert.Equal(argLocation{stack: 8}, locations[9])
+	assert.Equal(argLocation{stack: 16}, locations[10])
+	assert.Equal(argLocation{stack: 24}, locations[19])
+	assert.Equal(32, stack)
+
+	// On Darwin, arguments on the stack are packed by size.
+	g = &generator{darwin: true}
+	locations, stack = g.classify(values(args...), len(args))
+	assert.Equal(argLocation{stack: 4}, locations[9])
+	assert.Equal(argLocation{stack: 8}, locations[10])
+	assert.Equal(argLocation{stack: 16}, locations[19])
+	assert.Equal(24, stack)
+
+	// On Darwin, the variable arguments of a call are on the stack, each in
+	// its own eight bytes.
+	locations, stack = g.classify(values(types.Int, types.Int, types.Double), 1)
+	assert.Equal(argLocation{inRegister: true, register: 0}, locations[0])
+	assert.Equal(argLocation{stack: 0}, locations[1])
+	assert.Equal(argLocation{stack: 8}, locations[2])
+	assert.Equal(16, stack)
+}
+
+func TestGenerateCall(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int putchar(int); int main() { return putchar(65); }")
+	assert.Contains(asm, "\tmov w0, #65\n\tbl putchar\n\tstr w0, [sp, #0]\n")
+}
+
+func TestGenerateCallArguments(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a, double b, int c, int d, int e, int g, int h, int i, int j, int k);
+int main() { return f(1, 2.5, 3, 4, 5, 6, 7, 8, 9, 10); }`)
+	// The last argument is stored at the bottom of the frame, then the
+	// others are loaded into registers.
+	assert.Contains(asm, `	sub sp, sp, #32
+	mov w0, #10
+	str w0, [sp, #0]
+	mov w0, #1
+	mov x16, #0
+	movk x16, #16388, lsl #48
+	fmov d0, x16
+	mov w1, #3
+`)
+	assert.Contains(asm, "\tmov w7, #9\n")
+	assert.Contains(asm, "\tbl f\n\tstr w0, [sp, #16]\n")
+}
+
+func TestGenerateParameters(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a, int b, int c, int d, int e, int g, int h, int i, int j) {
+  return a + j;
+}`)
+	assert.Contains(asm, "\tstr w0, [sp, #0]\n\tstr w1, [sp, #8]\n")
+	assert.Contains(asm, "\tstr w7, [sp, #56]\n")
+	// Arguments on the stack are above the saved frame pointer and link
+	// register.
+	assert.Contains(asm, "\tldr w0, [x29, #16]\n\tstr w0, [sp, #64]\n")
+}
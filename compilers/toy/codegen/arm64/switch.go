@@ -0,0 +1,74 @@
+package arm64
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// compare compares w0, or x0 for a long, with a constant of type t.
+func (g *generator) compare(t types.Type, value int64) {
+	if !isWide(t) {
+		value = int64(int32(value))
+	}
+	switch {
+	case value >= 0 && value <= maxImmediate:
+		g.emit("cmp %s, #%d", reg(t, 0), value)
+	case value < 0 && value >= -maxImmediate:
+		g.emit("cmn %s, #%d", reg(t, 0), -value)
+	default:
+		g.load(ir.NewInt(value, t), 1)
+		g.emit("cmp %s, %s", reg(t, 0), reg(t, 1))
+	}
+}
+
+// switchInstr emits the dispatch of a switch. The instruction which follows
+// it is used to avoid a jump to the next instruction.
+func (g *generator) switchInstr(s *ir.Switch, next ir.Instr) {
+	g.load(s.Value, 0)
+	t := s.Value.Type()
+	// The values of a switch of a long are dispatched by comparisons, so
+	// that the range of the case values can't overflow.
+	if low, high, ok := s.JumpTableRange(); ok && !isWide(t) {
+		g.jumpTable(s, low, high)
+		return
+	}
+	for _, c := range s.Cases {
+		g.compare(t, c.Value)
+		g.emit("b.eq %s", g.labelName(c.Target))
+	}
+	if next != ir.Instr(s.Default) {
+		g.emit("b %s", g.labelName(s.Default))
+	}
+}
+
+// jumpTable emits a dispatch of the value in w0 by an indirect branch through
+// a table of target offsets, relative to the table. The table follows the
+// branch in the text section, so that it is addressed without relocations.
+// Values outside of the table jump to the default.
+func (g *generator) jumpTable(s *ir.Switch, low, high int64) {
+	targets := make([]*ir.Label, high-low+1)
+	for i := range targets {
+		targets[i] = s.Default
+	}
+	for _, c := range s.Cases {
+		targets[c.Value-low] = c.Target
+	}
+	table := g.localLabel("JT", g.tables)
+	g.tables++
+
+	if low != 0 {
+		g.load(ir.NewInt(low, types.Int), 1)
+		g.emit("sub w0, w0, w1")
+	}
+	// An unsigned comparison also rejects values below the lowest case.
+	g.compare(types.Int, high-low)
+	g.emit("b.hi %s", g.labelName(s.Default))
+	g.emit("adr x16, %s", table)
+	g.emit("ldrsw x17, [x16, w0, uxtw #2]")
+	g.emit("add x16, x16, x17")
+	g.emit("br x16")
+	g.label(table)
+	for _, target := range targets {
+		g.emit(".word %s-%s", g.labelName(target), table)
+	}
+}
@@ -0,0 +1,53 @@
+package arm64
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGenerateJumpTable(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a) {
+  switch (a) { case 1: return 1; case 2: return 2; case 4: return 4; case 5: return 5; }
+  return 0;
+}`)
+	assert.Contains(asm, `	ldr w0, [sp, #0]
+	mov w1, #1
+	sub w0, w0, w1
+	cmp w0, #4
+	b.hi .Lf.5
+	adr x16, .LJT0
+	ldrsw x17, [x16, w0, uxtw #2]
+	add x16, x16, x17
+	br x16
+.LJT0:
+	.word .Lf.1-.LJT0
+	.word .Lf.2-.LJT0
+	.word .Lf.5-.LJT0
+	.word .Lf.3-.LJT0
+	.word .Lf.4-.LJT0
+`)
+
+	asm = generate(t, `int f(int a) {
+  switch (a) { case 1: return 1; case 2: return 2; case 3: return 3; case 4: return 4; }
+  return 0;
+}`, Darwin)
+	assert.Contains(asm, "\tadr x16, LJT0\n")
+	assert.Contains(asm, "\t.word Lf.1-LJT0\n")
+}
+
+func TestGenerateComparisonChain(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a) {
+  switch (a) { case 1: return 1; case -2: return 2; case 100000: return 3; default: return 4; }
+}`)
+	assert.Contains(asm, `	cmp w0, #1
+	b.eq .Lf.1
+	cmn w0, #2
+	b.eq .Lf.2
+	mov w1, #34464
+	movk w1, #1, lsl #16
+	cmp w0, w1
+	b.eq .Lf.3
+`)
+}
@@ -0,0 +1,54 @@
+package arm64
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/target"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+)
+
+// The AArch64 targets, for Linux and macOS. Every temporary is in memory, so
+// no registers hold temporaries.
+type aarch64 struct {
+	name string
+	os   string
+}
+
+func init() {
+	target.Register(aarch64{"aarch64-linux", "linux"})
+	target.Register(aarch64{"arm64-darwin", "darwin"})
+}
+
+func (t aarch64) Name() string                { return t.name }
+func (t aarch64) Arch() string                { return "arm64" }
+func (t aarch64) OS() string                  { return t.os }
+func (t aarch64) Layout() types.Layout        { return types.LP64 }
+func (t aarch64) Registers() target.Registers { return target.Registers{} }
+func (t aarch64) Syntax() target.Syntax       { return target.ARM }
+
+func (t aarch64) CallingConvention() target.CallingConvention {
+	c := target.CallingConvention{
+		Name:        "AAPCS64",
+		IntResult:   "x0",
+		FloatResult: "d0",
+		StackAlign:  16,
+	}
+	if t.os == "darwin" {
+		c.Name = "Apple arm64"
+	}
+	for i := 0; i < argRegisters; i++ {
+		c.IntArgs = append(c.IntArgs, fmt.Sprintf("x%d", i))
+		c.FloatArgs = append(c.FloatArgs, fmt.Sprintf("d%d", i))
+	}
+	return c
+}
+
+// Generate ignores the options, since the generator has none.
+func (t aarch64) Generate(w io.Writer, program *ir.Program, options target.Options) error {
+	var opts []Option
+	if t.os == "darwin" {
+		opts = append(opts, Darwin)
+	}
+	return Generate(w, program, opts...)
+}
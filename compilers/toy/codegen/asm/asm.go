@@ -0,0 +1,489 @@
+// Package asm assembles the x86-64 assembly written by the code generator
+// into relocatable object files, so that programs can be compiled without an
+// external assembler.
+//
+// The assembler accepts the AT&T syntax of package codegen: the instructions
+// which it emits, labels, and the directives which lay out its code and data.
+// Every jump and call has a 32-bit displacement, rather than the shortest
+// which reaches its target, so that the size of each instruction is known as
+// it is encoded. References to labels which are not yet defined are recorded
+// and resolved once the whole program is assembled, and those which cannot be
+// resolved, to other sections or to symbols defined elsewhere, become
+// relocations for the linker.
+//
+// With the Darwin option, the assembler accepts the dialect of macOS, in which
+// local labels start with L rather than .L, sections are named by their
+// segment, as in "__TEXT,__text", and alignments are powers of two. Its
+// objects are written by WriteMachO rather than WriteELF.
+//
+// The directives of debug information are not supported.
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The kind of a section, which determines its attributes in an object file.
+type SectionKind int
+
+const (
+	Text   SectionKind = iota // Executable code.
+	Data                      // Writable data.
+	Bss                       // Zero-initialized writable data.
+	Rodata                    // Read-only data.
+	Note                      // Data which is not loaded, such as .note.GNU-stack.
+)
+
+// A Section is the contents of a section of an object file. The contents of
+// a Bss section are all zero, and are not written to the file.
+type Section struct {
+	Name   string
+	Kind   SectionKind
+	Data   []byte
+	Align  int
+	Relocs []Reloc
+}
+
+// A Symbol is a label, which may be defined in a section of the object or
+// elsewhere.
+type Symbol struct {
+	Name      string
+	Section   *Section // The section of its definition, or nil if undefined.
+	Value     int      // Its offset in its section.
+	Global    bool
+	temporary bool
+}
+
+// Temporary returns whether a symbol is a local label of the assembly, such
+// as one of a branch target, which is not written to the symbol table of an
+// object file.
+func (s *Symbol) Temporary() bool {
+	return s.temporary
+}
+
+// The kind of a relocation.
+type RelocType int
+
+const (
+	// PC32 is the 32-bit displacement of a symbol from the location of the
+	// relocation: S + A - P.
+	PC32 RelocType = iota
+	// PLT32 is the 32-bit displacement of the procedure linkage table entry
+	// of a function, or of the function itself if it is linked statically.
+	PLT32
+	// GOTPCREL is the 32-bit displacement of the entry of a symbol in the
+	// global offset table, which holds its address.
+	GOTPCREL
+)
+
+// A Reloc is a relocation: a reference to a symbol whose value is not known
+// until the object is linked, to be written at an offset in a section.
+type Reloc struct {
+	Offset int
+	Symbol *Symbol
+	Type   RelocType
+	Addend int64
+}
+
+// An Object is an assembled program.
+type Object struct {
+	Sections []*Section
+	// The symbols of the object, in the order in which they are first
+	// referenced or defined.
+	Symbols []*Symbol
+}
+
+// An Error is an error in a line of assembly.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Line, e.Msg)
+}
+
+// A reference to a symbol from an instruction or a directive, which is
+// resolved once every label is defined. The 32-bit value at the offset in the
+// section is the displacement of the symbol, plus the addend, from the offset.
+type fixup struct {
+	line    int
+	section *Section
+	offset  int
+	symbol  *Symbol
+	typ     RelocType
+	addend  int64
+}
+
+type assembler struct {
+	object   *Object
+	section  *Section
+	symbols  map[string]*Symbol
+	fixups   []fixup
+	line     int
+	sections map[string]*Section
+	darwin   bool
+}
+
+// An Option configures the assembler.
+type Option func(*assembler)
+
+// Darwin is an Option which accepts the assembly of macOS.
+func Darwin(a *assembler) {
+	a.darwin = true
+}
+
+// Assemble assembles a program.
+func Assemble(text string, options ...Option) (*Object, error) {
+	a := &assembler{
+		object:   &Object{},
+		symbols:  make(map[string]*Symbol),
+		sections: make(map[string]*Section),
+	}
+	for _, option := range options {
+		option(a)
+	}
+	a.section = a.sectionNamed(a.sectionName(".text"), Text)
+	for i, line := range strings.Split(text, "\n") {
+		a.line = i + 1
+		if err := a.assembleLine(line); err != nil {
+			return nil, &Error{Line: a.line, Msg: err.Error()}
+		}
+	}
+	if err := a.resolve(); err != nil {
+		return nil, err
+	}
+	return a.object, nil
+}
+
+// sectionNamed returns the section with a name, which is added to the object
+// if it is not yet in it.
+func (a *assembler) sectionNamed(name string, kind SectionKind) *Section {
+	s, ok := a.sections[name]
+	if !ok {
+		s = &Section{Name: name, Kind: kind, Align: 1}
+		a.sections[name] = s
+		a.object.Sections = append(a.object.Sections, s)
+	}
+	return s
+}
+
+// symbol returns the symbol with a name, which is added to the object if it
+// is not yet in it.
+func (a *assembler) symbol(name string) *Symbol {
+	s, ok := a.symbols[name]
+	if !ok {
+		prefix := ".L"
+		if a.darwin {
+			prefix = "L"
+		}
+		s = &Symbol{Name: name, temporary: strings.HasPrefix(name, prefix)}
+		a.symbols[name] = s
+		a.object.Symbols = append(a.object.Symbols, s)
+	}
+	return s
+}
+
+func (a *assembler) assembleLine(line string) error {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+		return nil
+	case strings.HasSuffix(line, ":"):
+		return a.label(strings.TrimSuffix(line, ":"))
+	case strings.HasPrefix(line, "."):
+		return a.directive(line)
+	}
+	fields := strings.SplitN(line, " ", 2)
+	var operands []operand
+	if len(fields) == 2 {
+		for _, s := range splitOperands(fields[1]) {
+			op, err := parseOperand(s)
+			if err != nil {
+				return err
+			}
+			operands = append(operands, op)
+		}
+	}
+	if a.darwin {
+		// The relocations of Mach-O files which are relative to the
+		// instruction pointer assume that the displacement ends the
+		// instruction.
+		for _, op := range operands {
+			if op.kind == immOperand {
+				for _, op := range operands {
+					if op.rip && op.symbol != "" {
+						return fmt.Errorf("an immediate may not follow the address of %s", op.symbol)
+					}
+				}
+			}
+		}
+	}
+	return a.instruction(fields[0], operands)
+}
+
+// label defines a label at the end of the current section.
+func (a *assembler) label(name string) error {
+	s := a.symbol(name)
+	if s.Section != nil {
+		return fmt.Errorf("label %s is already defined", name)
+	}
+	s.Section = a.section
+	s.Value = len(a.section.Data)
+	return nil
+}
+
+// The attributes of each section which may be named by a .section directive.
+var sectionKinds = map[string]SectionKind{
+	".text":           Text,
+	".data":           Data,
+	".bss":            Bss,
+	".rodata":         Rodata,
+	".note.GNU-stack": Note,
+}
+
+// The attributes of each section which may be named by a .section directive
+// on Darwin, by segment and section.
+var darwinSectionKinds = map[string]SectionKind{
+	"__TEXT,__text":    Text,
+	"__DATA,__data":    Data,
+	"__DATA,__bss":     Bss,
+	"__TEXT,__const":   Rodata,
+	"__TEXT,__cstring": Rodata,
+}
+
+// sectionName returns the name of the section of a .text, .data or .bss
+// directive.
+func (a *assembler) sectionName(directive string) string {
+	if !a.darwin {
+		return directive
+	}
+	return map[string]string{
+		".text": "__TEXT,__text",
+		".data": "__DATA,__data",
+		".bss":  "__DATA,__bss",
+	}[directive]
+}
+
+func (a *assembler) directive(line string) error {
+	fields := strings.SplitN(line, " ", 2)
+	name, args := fields[0], ""
+	if len(fields) == 2 {
+		args = strings.TrimSpace(fields[1])
+	}
+	switch name {
+	case ".text", ".data", ".bss":
+		a.section = a.sectionNamed(a.sectionName(name), sectionKinds[name])
+	case ".section":
+		// The flags and type which may follow the name are those of the
+		// section's kind.
+		fields, kinds := strings.Split(args, ","), sectionKinds
+		section := strings.TrimSpace(fields[0])
+		if a.darwin {
+			kinds = darwinSectionKinds
+			if len(fields) > 1 {
+				section += "," + strings.TrimSpace(fields[1])
+			}
+		}
+		kind, ok := kinds[section]
+		if !ok {
+			return fmt.Errorf("unsupported section %s", section)
+		}
+		a.section = a.sectionNamed(section, kind)
+	case ".globl", ".global":
+		a.symbol(args).Global = true
+	case ".extern":
+		// Like the GNU assembler, which ignores the directive, a symbol which
+		// is not defined is global when it is referred to.
+	case ".align", ".p2align":
+		n, err := parseInt(args)
+		if err != nil {
+			return err
+		}
+		if name == ".p2align" || a.darwin {
+			n = 1 << uint(n)
+		}
+		if n <= 0 || n&(n-1) != 0 {
+			return fmt.Errorf("invalid alignment %s", args)
+		}
+		a.align(int(n))
+	case ".byte", ".short", ".value", ".long", ".quad":
+		size := map[string]int{".byte": 1, ".short": 2, ".value": 2, ".long": 4, ".quad": 8}[name]
+		for _, arg := range strings.Split(args, ",") {
+			if err := a.data(strings.TrimSpace(arg), size); err != nil {
+				return err
+			}
+		}
+	case ".string", ".asciz", ".ascii":
+		s, err := unquote(args)
+		if err != nil {
+			return err
+		}
+		a.emit([]byte(s)...)
+		if name != ".ascii" {
+			a.emit(0)
+		}
+	case ".zero":
+		n, err := parseInt(args)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid size %s", args)
+		}
+		a.emit(make([]byte, n)...)
+	default:
+		return fmt.Errorf("unsupported directive %s", name)
+	}
+	return nil
+}
+
+// align pads the current section to a multiple of n bytes, with no-ops if
+// it holds code.
+func (a *assembler) align(n int) {
+	s := a.section
+	pad := byte(0)
+	if s.Kind == Text {
+		pad = 0x90
+	}
+	for len(s.Data)%n != 0 {
+		s.Data = append(s.Data, pad)
+	}
+	if n > s.Align {
+		s.Align = n
+	}
+}
+
+// data emits a value of a .byte, .long or other data directive: a number, or
+// the difference between a label and one in the current section, as in a
+// jump table.
+func (a *assembler) data(arg string, size int) error {
+	if i := strings.LastIndex(arg, "-"); i > 0 && size == 4 {
+		target := strings.TrimSpace(arg[:i])
+		base := a.symbol(strings.TrimSpace(arg[i+1:]))
+		if base.Section != a.section {
+			return fmt.Errorf("%s is not defined in section %s", base.Name, a.section.Name)
+		}
+		offset := len(a.section.Data)
+		a.fixup(a.symbol(target), PC32, int64(offset-base.Value))
+		a.emit(0, 0, 0, 0)
+		return nil
+	}
+	n, err := parseInt(arg)
+	if err != nil {
+		return err
+	}
+	a.emit(little(n, size)...)
+	return nil
+}
+
+// emit appends bytes to the current section.
+func (a *assembler) emit(b ...byte) {
+	a.section.Data = append(a.section.Data, b...)
+}
+
+// fixup records a reference to a symbol by the 32-bit displacement which is
+// about to be emitted.
+func (a *assembler) fixup(s *Symbol, typ RelocType, addend int64) {
+	a.fixups = append(a.fixups, fixup{
+		line:    a.line,
+		section: a.section,
+		offset:  len(a.section.Data),
+		symbol:  s,
+		typ:     typ,
+		addend:  addend,
+	})
+}
+
+// resolve writes the displacements of the labels which are defined in the
+// sections which refer to them, and not visible outside the object, and
+// records relocations for the others, and for every entry of the global
+// offset table. A symbol which is not defined must be defined elsewhere, so it
+// is global.
+func (a *assembler) resolve() error {
+	for _, f := range a.fixups {
+		s := f.symbol
+		if s.Section == nil {
+			if s.Temporary() {
+				return &Error{Line: f.line, Msg: fmt.Sprintf("undefined label %s", s.Name)}
+			}
+			s.Global = true
+		}
+		if s.Section == f.section && !s.Global && f.typ != GOTPCREL {
+			d := int64(s.Value) + f.addend - int64(f.offset)
+			copy(f.section.Data[f.offset:], little(d, 4))
+			continue
+		}
+		f.section.Relocs = append(f.section.Relocs, Reloc{
+			Offset: f.offset,
+			Symbol: s,
+			Type:   f.typ,
+			Addend: f.addend,
+		})
+	}
+	return nil
+}
+
+// little returns the low size bytes of a number, least significant first.
+func little(n int64, size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(n >> (8 * uint(i)))
+	}
+	return b
+}
+
+// parseInt parses a decimal or hexadecimal number. Numbers as large as
+// 64-bit unsigned values are accepted, and wrap around.
+func parseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err == nil {
+		return n, nil
+	}
+	u, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", s)
+	}
+	return int64(u), nil
+}
+
+// unquote returns the value of a string literal of a .string directive, as
+// quoted by ast.Quote, with backslash escapes for quotes, backslashes, new
+// lines and tabs, and three-digit octal escapes for other characters.
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("invalid string %s", s)
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 == len(s) {
+			return "", fmt.Errorf("invalid escape at end of string")
+		}
+		i++
+		switch c = s[i]; {
+		case c == 'n':
+			b.WriteByte('\n')
+		case c == 't':
+			b.WriteByte('\t')
+		case c >= '0' && c <= '7':
+			n := 0
+			for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+				n = n*8 + int(s[i]-'0')
+				i++
+			}
+			i--
+			b.WriteByte(byte(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
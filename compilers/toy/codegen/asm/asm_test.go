@@ -0,0 +1,181 @@
+package asm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAssembleLabels(t *testing.T) {
+	assert := assert.New(t)
+	object, err := Assemble(`	.text
+	.globl main
+main:
+	jmp .L1
+	call f
+.L1:
+	je .L1
+	call g@PLT
+	ret
+	.globl f
+f:
+	ret
+`)
+	assert.NoError(err)
+	text := object.Sections[0]
+	assert.Equal(".text", text.Name)
+	// Jumps to local labels are resolved, and calls to global functions are
+	// relocated, even if they are defined in the object.
+	assert.Equal([]byte{
+		0xe9, 0x05, 0, 0, 0,
+		0xe8, 0, 0, 0, 0,
+		0x0f, 0x84, 0xfa, 0xff, 0xff, 0xff,
+		0xe8, 0, 0, 0, 0,
+		0xc3,
+		0xc3,
+	}, text.Data)
+	assert.Equal([]Reloc{
+		{Offset: 6, Symbol: object.Symbols[2], Type: PC32, Addend: -4},
+		{Offset: 17, Symbol: object.Symbols[3], Type: PLT32, Addend: -4},
+	}, text.Relocs)
+
+	var names []string
+	for _, s := range object.Symbols {
+		names = append(names, s.Name)
+	}
+	assert.Equal([]string{"main", ".L1", "f", "g"}, names)
+	assert.Equal(&Symbol{Name: "f", Section: text, Value: 22, Global: true}, object.Symbols[2])
+	// An undefined symbol is global.
+	assert.Equal(&Symbol{Name: "g", Global: true}, object.Symbols[3])
+	assert.True(object.Symbols[1].Temporary())
+}
+
+func TestAssembleExtern(t *testing.T) {
+	assert := assert.New(t)
+	object, err := Assemble(`	.extern g
+	.extern h
+	.text
+	call g@PLT
+	ret
+`)
+	assert.NoError(err)
+	// Like any undefined symbol, one which is declared is global if it is
+	// referred to, and otherwise not in the object.
+	assert.Equal([]*Symbol{{Name: "g", Global: true}}, object.Symbols)
+}
+
+func TestAssembleData(t *testing.T) {
+	assert := assert.New(t)
+	object, err := Assemble(`	.text
+	leaq .LC0(%rip), %rax
+	movss .LC1(%rip), %xmm0
+.L2:
+	.data
+	.globl x
+	.align 4
+x:
+	.long 0x40490fdb
+	.byte -1, 2
+	.quad 0xbff0000000000000
+	.bss
+	.zero 3
+	.section .rodata
+.LC0:
+	.string "a\tb\"\\\001"
+	.align 4
+.LC1:
+	.long .L2-.LC1
+	.section .note.GNU-stack,"",@progbits
+`)
+	assert.NoError(err)
+	var names []string
+	var kinds []SectionKind
+	for _, s := range object.Sections {
+		names = append(names, s.Name)
+		kinds = append(kinds, s.Kind)
+	}
+	assert.Equal([]string{".text", ".data", ".bss", ".rodata", ".note.GNU-stack"}, names)
+	assert.Equal([]SectionKind{Text, Data, Bss, Rodata, Note}, kinds)
+
+	text, data, bss, rodata := object.Sections[0], object.Sections[1], object.Sections[2],
+		object.Sections[3]
+	assert.Equal([]byte{0xdb, 0x0f, 0x49, 0x40, 0xff, 2, 0, 0, 0, 0, 0, 0, 0xf0, 0xbf}, data.Data)
+	assert.Equal(4, data.Align)
+	assert.Equal([]byte{0, 0, 0}, bss.Data)
+	assert.Equal([]byte("a\tb\"\\\001\x00\x00\x00\x00\x00\x00"), rodata.Data)
+
+	// References to labels in other sections are relocated.
+	lc0, lc1, l2 := object.Symbols[0], object.Symbols[1], object.Symbols[2]
+	assert.Equal([]Reloc{
+		{Offset: 3, Symbol: lc0, Type: PC32, Addend: -4},
+		{Offset: 11, Symbol: lc1, Type: PC32, Addend: -4},
+	}, text.Relocs)
+	// The difference of a label and one in the same section is relative to
+	// the location of the value.
+	assert.Equal([]Reloc{{Offset: 8, Symbol: l2, Type: PC32, Addend: 0}}, rodata.Relocs)
+}
+
+func TestAssembleDarwin(t *testing.T) {
+	assert := assert.New(t)
+	object, err := Assemble(`	.text
+	.globl _main
+_main:
+	movq ___stack_chk_guard@GOTPCREL(%rip), %rax
+	leaq Lstr.0(%rip), %rdi
+	call _puts
+	jmp L1
+L1:
+	ret
+	.section __DATA,__bss
+	.p2align 3
+	.zero 8
+	.section __TEXT,__cstring,cstring_literals
+Lstr.0:
+	.asciz "hi"
+	.section __TEXT,__const
+	.align 2
+	.long 1
+`, Darwin)
+	assert.NoError(err)
+	var names []string
+	var kinds []SectionKind
+	for _, s := range object.Sections {
+		names = append(names, s.Name)
+		kinds = append(kinds, s.Kind)
+	}
+	assert.Equal([]string{"__TEXT,__text", "__DATA,__bss", "__TEXT,__cstring", "__TEXT,__const"}, names)
+	assert.Equal([]SectionKind{Text, Bss, Rodata, Rodata}, kinds)
+	// Alignments are powers of two.
+	assert.Equal(8, object.Sections[1].Align)
+	assert.Equal(4, object.Sections[3].Align)
+
+	// Labels which start with L are temporary, and every call may be to a
+	// stub of the linker.
+	guard, str, puts, l1 := object.Symbols[1], object.Symbols[2], object.Symbols[3], object.Symbols[4]
+	assert.False(guard.Temporary())
+	assert.True(str.Temporary())
+	assert.True(l1.Temporary())
+	assert.Equal([]Reloc{
+		{Offset: 3, Symbol: guard, Type: GOTPCREL, Addend: -4},
+		{Offset: 10, Symbol: str, Type: PC32, Addend: -4},
+		{Offset: 15, Symbol: puts, Type: PLT32, Addend: -4},
+	}, object.Sections[0].Relocs)
+
+	_, err = Assemble("\tmovl $1, _x(%rip)\n", Darwin)
+	assert.EqualError(err, "1: an immediate may not follow the address of _x")
+}
+
+func TestAssembleErrors(t *testing.T) {
+	assert := assert.New(t)
+	for text, msg := range map[string]string{
+		"\tjmp .L1\n":                "1: undefined label .L1",
+		"f:\n\tret\nf:\n":            "3: label f is already defined",
+		"\t.loc 1 2 3\n":             "1: unsupported directive .loc",
+		"\t.section .debug_info\n":   "1: unsupported section .debug_info",
+		"\t.align 3\n":               "1: invalid alignment 3",
+		"\t.string \"a\n":            "1: invalid string \"a",
+		"\t.data\n\t.long .L1-.L2\n": "2: .L2 is not defined in section .data",
+	} {
+		_, err := Assemble(text)
+		assert.EqualError(err, msg, text)
+	}
+}
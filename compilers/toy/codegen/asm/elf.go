@@ -0,0 +1,226 @@
+package asm
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+)
+
+// The flags and type of each kind of section in an ELF file.
+var elfSections = map[SectionKind]struct {
+	typ   elf.SectionType
+	flags elf.SectionFlag
+}{
+	Text:   {elf.SHT_PROGBITS, elf.SHF_ALLOC | elf.SHF_EXECINSTR},
+	Data:   {elf.SHT_PROGBITS, elf.SHF_ALLOC | elf.SHF_WRITE},
+	Bss:    {elf.SHT_NOBITS, elf.SHF_ALLOC | elf.SHF_WRITE},
+	Rodata: {elf.SHT_PROGBITS, elf.SHF_ALLOC},
+	Note:   {elf.SHT_PROGBITS, 0},
+}
+
+// The ELF type of each kind of relocation.
+var elfRelocs = map[RelocType]elf.R_X86_64{
+	PC32:     elf.R_X86_64_PC32,
+	PLT32:    elf.R_X86_64_PLT32,
+	GOTPCREL: elf.R_X86_64_GOTPCREL,
+}
+
+// A table of the strings of an ELF file, each of which is terminated by a
+// NUL.
+type stringTable struct {
+	data    bytes.Buffer
+	offsets map[string]uint32
+}
+
+func newStringTable() *stringTable {
+	t := &stringTable{offsets: map[string]uint32{"": 0}}
+	t.data.WriteByte(0)
+	return t
+}
+
+// add returns the offset of a string in the table, adding it if needed.
+func (t *stringTable) add(s string) uint32 {
+	if offset, ok := t.offsets[s]; ok {
+		return offset
+	}
+	offset := uint32(t.data.Len())
+	t.data.WriteString(s)
+	t.data.WriteByte(0)
+	t.offsets[s] = offset
+	return offset
+}
+
+// WriteELF writes an object as a relocatable ELF64 file for x86-64.
+//
+// The sections of the object are followed by a relocation section for each
+// which has relocations, and by the symbol table. Relocations against
+// temporary labels refer to the symbol of the section in which the label is
+// defined instead, with the label's offset in the addend, since the labels
+// are not in the symbol table.
+func WriteELF(w io.Writer, object *Object) error {
+	// The section headers are, in order: the null section, those of the
+	// object, their relocations, and the tables of symbols and strings.
+	var headers []elf.Section64
+	shstrtab := newStringTable()
+	strtab := newStringTable()
+	index := make(map[*Section]int)
+	var contents [][]byte
+	addSection := func(name string, h elf.Section64, data []byte) int {
+		h.Name = shstrtab.add(name)
+		headers = append(headers, h)
+		contents = append(contents, data)
+		return len(headers) - 1
+	}
+	addSection("", elf.Section64{}, nil)
+	for _, s := range object.Sections {
+		attrs := elfSections[s.Kind]
+		data := s.Data
+		h := elf.Section64{
+			Type:      uint32(attrs.typ),
+			Flags:     uint64(attrs.flags),
+			Size:      uint64(len(s.Data)),
+			Addralign: uint64(s.Align),
+		}
+		if s.Kind == Bss {
+			data = nil
+		}
+		index[s] = addSection(s.Name, h, data)
+	}
+
+	// The symbol table starts with a null symbol and those of the sections,
+	// followed by the other local symbols and then the global ones.
+	syms := []elf.Sym64{{}}
+	sectionSyms := make(map[*Section]uint32)
+	for _, s := range object.Sections {
+		sectionSyms[s] = uint32(len(syms))
+		syms = append(syms, elf.Sym64{
+			Info:  elf.ST_INFO(elf.STB_LOCAL, elf.STT_SECTION),
+			Shndx: uint16(index[s]),
+		})
+	}
+	symIndex := make(map[*Symbol]uint32)
+	var firstGlobal int
+	for _, global := range []bool{false, true} {
+		if global {
+			firstGlobal = len(syms)
+		}
+		for _, s := range object.Symbols {
+			if s.Global != global || s.Temporary() {
+				continue
+			}
+			sym := elf.Sym64{Name: strtab.add(s.Name), Value: uint64(s.Value)}
+			binding := elf.STB_LOCAL
+			if s.Global {
+				binding = elf.STB_GLOBAL
+			}
+			sym.Info = elf.ST_INFO(binding, elf.STT_NOTYPE)
+			if s.Section != nil {
+				sym.Shndx = uint16(index[s.Section])
+			}
+			symIndex[s] = uint32(len(syms))
+			syms = append(syms, sym)
+		}
+	}
+
+	symtabIndex := len(headers) + countRelocSections(object)
+	for _, s := range object.Sections {
+		if len(s.Relocs) == 0 {
+			continue
+		}
+		var data bytes.Buffer
+		for _, r := range s.Relocs {
+			sym, addend := symIndex[r.Symbol], r.Addend
+			if r.Symbol.Temporary() {
+				sym, addend = sectionSyms[r.Symbol.Section], addend+int64(r.Symbol.Value)
+			}
+			binary.Write(&data, binary.LittleEndian, elf.Rela64{
+				Off:    uint64(r.Offset),
+				Info:   elf.R_INFO(sym, uint32(elfRelocs[r.Type])),
+				Addend: addend,
+			})
+		}
+		addSection(".rela"+s.Name, elf.Section64{
+			Type:      uint32(elf.SHT_RELA),
+			Flags:     uint64(elf.SHF_INFO_LINK),
+			Link:      uint32(symtabIndex),
+			Info:      uint32(index[s]),
+			Addralign: 8,
+			Entsize:   24,
+		}, data.Bytes())
+	}
+
+	var symtab bytes.Buffer
+	binary.Write(&symtab, binary.LittleEndian, syms)
+	addSection(".symtab", elf.Section64{
+		Type:      uint32(elf.SHT_SYMTAB),
+		Link:      uint32(symtabIndex + 1),
+		Info:      uint32(firstGlobal),
+		Addralign: 8,
+		Entsize:   24,
+	}, symtab.Bytes())
+	addSection(".strtab", elf.Section64{Type: uint32(elf.SHT_STRTAB), Addralign: 1},
+		strtab.data.Bytes())
+	// The name of the table of section names is in the table, so it is added
+	// before the table is complete.
+	shstrndx := addSection(".shstrtab", elf.Section64{Type: uint32(elf.SHT_STRTAB),
+		Addralign: 1}, nil)
+	contents[shstrndx] = shstrtab.data.Bytes()
+
+	// The contents of the sections follow the file header, each aligned, and
+	// are followed by the section headers.
+	var body bytes.Buffer
+	offset := func() uint64 { return uint64(binary.Size(elf.Header64{}) + body.Len()) }
+	for i := range headers {
+		h := &headers[i]
+		if i == 0 {
+			continue
+		}
+		if h.Type != uint32(elf.SHT_NOBITS) {
+			h.Size = uint64(len(contents[i]))
+		}
+		if align := h.Addralign; align > 1 {
+			for offset()%align != 0 {
+				body.WriteByte(0)
+			}
+		}
+		h.Off = offset()
+		body.Write(contents[i])
+	}
+	for offset()%8 != 0 {
+		body.WriteByte(0)
+	}
+	header := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     offset(),
+		Ehsize:    uint16(binary.Size(elf.Header64{})),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     uint16(len(headers)),
+		Shstrndx:  uint16(shstrndx),
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, header)
+	b.Write(body.Bytes())
+	binary.Write(&b, binary.LittleEndian, headers)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// countRelocSections returns the number of sections of an object which have
+// relocations, each of which has a relocation section.
+func countRelocSections(object *Object) int {
+	n := 0
+	for _, s := range object.Sections {
+		if len(s.Relocs) > 0 {
+			n++
+		}
+	}
+	return n
+}
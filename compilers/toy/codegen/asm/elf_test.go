@@ -0,0 +1,99 @@
+package asm
+
+import (
+	"bytes"
+	"debug/elf"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteELF(t *testing.T) {
+	assert := assert.New(t)
+	object, err := Assemble(`	.text
+	.globl main
+main:
+	leaq .Lstr0(%rip), %rdi
+	call puts@PLT
+	movl x(%rip), %eax
+	ret
+	.data
+	.globl x
+	.align 4
+x:
+	.long 7
+	.bss
+	.zero 8
+	.section .rodata
+.Lstr0:
+	.string "hi"
+	.section .note.GNU-stack,"",@progbits
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	assert.NoError(WriteELF(&b, object))
+
+	f, err := elf.NewFile(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(elf.ET_REL, f.Type)
+	assert.Equal(elf.EM_X86_64, f.Machine)
+	assert.Equal(elf.ELFCLASS64, f.Class)
+
+	var names []string
+	for _, s := range f.Sections {
+		names = append(names, s.Name)
+	}
+	assert.Equal([]string{"", ".text", ".data", ".bss", ".rodata", ".note.GNU-stack",
+		".rela.text", ".symtab", ".strtab", ".shstrtab"}, names)
+	text, _ := f.Section(".text").Data()
+	assert.Equal(object.Sections[0].Data, text)
+	assert.Equal(elf.SHF_ALLOC|elf.SHF_EXECINSTR, f.Section(".text").Flags)
+	assert.Equal(elf.SHF_ALLOC|elf.SHF_WRITE, f.Section(".data").Flags)
+	assert.Equal(uint64(4), f.Section(".data").Addralign)
+	assert.Equal(elf.SHT_NOBITS, f.Section(".bss").Type)
+	assert.Equal(uint64(8), f.Section(".bss").Size)
+	rodata, _ := f.Section(".rodata").Data()
+	assert.Equal([]byte("hi\x00"), rodata)
+	assert.Equal(elf.SectionFlag(0), f.Section(".note.GNU-stack").Flags)
+
+	symbols, err := f.Symbols()
+	assert.NoError(err)
+	type symbol struct {
+		name    string
+		section elf.SectionIndex
+		value   uint64
+		binding elf.SymBind
+	}
+	var got []symbol
+	for _, s := range symbols {
+		if elf.ST_TYPE(s.Info) != elf.STT_SECTION {
+			got = append(got, symbol{s.Name, s.Section, s.Value, elf.ST_BIND(s.Info)})
+		}
+	}
+	// Temporary labels are not in the symbol table.
+	assert.Equal([]symbol{
+		{"main", 1, 0, elf.STB_GLOBAL},
+		{"puts", elf.SHN_UNDEF, 0, elf.STB_GLOBAL},
+		{"x", 2, 0, elf.STB_GLOBAL},
+	}, got)
+
+	rela, _ := f.Section(".rela.text").Data()
+	var relocs []elf.Rela64
+	for i := 0; i < len(rela); i += 24 {
+		var r elf.Rela64
+		r.Off = f.ByteOrder.Uint64(rela[i:])
+		r.Info = f.ByteOrder.Uint64(rela[i+8:])
+		r.Addend = int64(f.ByteOrder.Uint64(rela[i+16:]))
+		relocs = append(relocs, r)
+	}
+	// The reference to the string is relative to the symbol of .rodata,
+	// which is the fourth section symbol.
+	assert.Equal([]elf.Rela64{
+		{Off: 3, Info: elf.R_INFO(4, uint32(elf.R_X86_64_PC32)), Addend: -4},
+		{Off: 8, Info: elf.R_INFO(7, uint32(elf.R_X86_64_PLT32)), Addend: -4},
+		{Off: 14, Info: elf.R_INFO(8, uint32(elf.R_X86_64_PC32)), Addend: -4},
+	}, relocs)
+}
@@ -0,0 +1,867 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The kinds of operands.
+type operandKind int
+
+const (
+	regOperand operandKind = iota
+	immOperand
+	memOperand
+	symbolOperand   // The target of a jump or call.
+	indirectOperand // The register of an indirect jump, as in "jmp *%rax".
+)
+
+// A register: its number in the encoding of instructions, and its size in
+// bytes, which is 16 for an SSE register.
+type reg struct {
+	num  int
+	size int
+}
+
+const xmmSize = 16
+
+// An operand of an instruction.
+type operand struct {
+	kind operandKind
+	reg  reg
+	imm  int64
+	// The parts of a memory operand: a segment register, a displacement,
+	// which is a symbol plus a number, and a base and an index register, each
+	// of which may be absent, or a base of %rip.
+	segment byte
+	symbol  string
+	disp    int64
+	base    *reg
+	index   *reg
+	scale   int
+	rip     bool
+	// Whether a symbol is referred to through the procedure linkage table,
+	// as in "call putchar@PLT", or its address is loaded from the global
+	// offset table, as in "movq x@GOTPCREL(%rip), %rax".
+	plt bool
+	got bool
+}
+
+// The registers, by name.
+var registers = func() map[string]reg {
+	r := make(map[string]reg)
+	names := [][]string{
+		{"rax", "eax", "ax", "al"}, {"rcx", "ecx", "cx", "cl"},
+		{"rdx", "edx", "dx", "dl"}, {"rbx", "ebx", "bx", "bl"},
+		{"rsp", "esp", "sp", "spl"}, {"rbp", "ebp", "bp", "bpl"},
+		{"rsi", "esi", "si", "sil"}, {"rdi", "edi", "di", "dil"},
+	}
+	for n := 8; n <= 15; n++ {
+		q := fmt.Sprintf("r%d", n)
+		names = append(names, []string{q, q + "d", q + "w", q + "b"})
+	}
+	for num, family := range names {
+		for i, name := range family {
+			r[name] = reg{num: num, size: 8 >> uint(i)}
+		}
+	}
+	for n := 0; n < 16; n++ {
+		r[fmt.Sprintf("xmm%d", n)] = reg{num: n, size: xmmSize}
+	}
+	return r
+}()
+
+// The prefixes of the segment registers which may be used in addresses.
+var segments = map[string]byte{"fs": 0x64, "gs": 0x65}
+
+// splitOperands splits the operands of an instruction at the commas which
+// are not within the parentheses of an address.
+func splitOperands(s string) []string {
+	var operands []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				operands = append(operands, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(operands, strings.TrimSpace(s[start:]))
+}
+
+// parseRegister parses the name of a register, preceded by "%".
+func parseRegister(s string) (reg, error) {
+	if r, ok := registers[strings.TrimPrefix(s, "%")]; ok && strings.HasPrefix(s, "%") {
+		return r, nil
+	}
+	return reg{}, fmt.Errorf("invalid register %s", s)
+}
+
+func parseOperand(s string) (operand, error) {
+	switch {
+	case strings.HasPrefix(s, "$"):
+		n, err := parseInt(s[1:])
+		return operand{kind: immOperand, imm: n}, err
+	case strings.HasPrefix(s, "*"):
+		r, err := parseRegister(s[1:])
+		return operand{kind: indirectOperand, reg: r}, err
+	case strings.HasPrefix(s, "%") && !strings.Contains(s, ":"):
+		r, err := parseRegister(s)
+		return operand{kind: regOperand, reg: r}, err
+	case !strings.ContainsAny(s, "(:"):
+		op := operand{kind: symbolOperand, symbol: s}
+		if strings.HasSuffix(s, "@PLT") {
+			op.symbol, op.plt = strings.TrimSuffix(s, "@PLT"), true
+		}
+		return op, nil
+	}
+	return parseMemory(s)
+}
+
+// parseMemory parses an address, as in "%fs:40", "-8(%rbp)",
+// "(%rax,%rcx,4)" or ".LC0(%rip)".
+func parseMemory(s string) (operand, error) {
+	op := operand{kind: memOperand, scale: 1}
+	text := s
+	if i := strings.Index(s, ":"); i >= 0 {
+		seg, ok := segments[strings.TrimPrefix(s[:i], "%")]
+		if !ok {
+			return op, fmt.Errorf("invalid segment in %s", text)
+		}
+		op.segment, s = seg, s[i+1:]
+	}
+	disp := s
+	if i := strings.Index(s, "("); i >= 0 {
+		if !strings.HasSuffix(s, ")") {
+			return op, fmt.Errorf("invalid address %s", text)
+		}
+		disp = s[:i]
+		parts := strings.Split(s[i+1:len(s)-1], ",")
+		if len(parts) > 3 {
+			return op, fmt.Errorf("invalid address %s", text)
+		}
+		if base := strings.TrimSpace(parts[0]); base == "%rip" {
+			op.rip = true
+		} else if base != "" {
+			r, err := parseRegister(base)
+			if err != nil {
+				return op, err
+			}
+			op.base = &r
+		}
+		if len(parts) > 1 {
+			r, err := parseRegister(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return op, err
+			}
+			op.index = &r
+		}
+		if len(parts) > 2 {
+			n, err := parseInt(strings.TrimSpace(parts[2]))
+			if err != nil || (n != 1 && n != 2 && n != 4 && n != 8) {
+				return op, fmt.Errorf("invalid scale in %s", text)
+			}
+			op.scale = int(n)
+		}
+		for _, r := range []*reg{op.base, op.index} {
+			if r != nil && r.size != 8 {
+				return op, fmt.Errorf("invalid address %s", text)
+			}
+		}
+		if op.index != nil && (op.rip || op.index.num == 4) {
+			return op, fmt.Errorf("invalid index in %s", text)
+		}
+	}
+	if disp != "" {
+		if n, err := parseInt(disp); err == nil {
+			op.disp = n
+		} else if op.rip {
+			op.symbol = disp
+			if strings.HasSuffix(disp, "@GOTPCREL") {
+				op.symbol, op.got = strings.TrimSuffix(disp, "@GOTPCREL"), true
+			}
+		} else {
+			return op, fmt.Errorf("invalid displacement in %s", text)
+		}
+	}
+	return op, nil
+}
+
+// fitsInt8 and fitsInt32 return whether a number is in the range of a signed
+// byte or 32-bit value.
+func fitsInt8(n int64) bool  { return n >= -128 && n <= 127 }
+func fitsInt32(n int64) bool { return n >= -1<<31 && n <= 1<<31-1 }
+
+// An instruction which is encoded with a ModR/M byte: an optional mandatory
+// prefix, the opcode, the register or opcode extension of the reg field, the
+// register or memory operand of the r/m field, and an immediate.
+type modrm struct {
+	prefix  byte // 0x66, 0xf2 or 0xf3, or 0 for none.
+	w       bool // Whether REX.W selects a 64-bit operand size.
+	opcode  []byte
+	reg     int
+	rm      operand
+	imm     int64
+	immSize int
+	// Whether the reg field holds a register, rather than an opcode
+	// extension, and whether a REX prefix is needed to select the low byte of
+	// %rsp, %rbp, %rsi or %rdi, rather than %ah, %ch, %dh or %bh.
+	regIsByte bool
+	byteRegs  bool
+}
+
+// encode emits an instruction with a ModR/M byte, and a SIB byte and a
+// displacement for a memory operand.
+func (a *assembler) encode(i modrm) {
+	rm := i.rm
+	if rm.segment != 0 {
+		a.emit(rm.segment)
+	}
+	if i.prefix != 0 {
+		a.emit(i.prefix)
+	}
+	rex := byte(0x40)
+	if i.w {
+		rex |= 8
+	}
+	if i.reg&8 != 0 {
+		rex |= 4
+	}
+	if rm.kind == regOperand && rm.reg.num&8 != 0 || rm.base != nil && rm.base.num&8 != 0 {
+		rex |= 1
+	}
+	if rm.index != nil && rm.index.num&8 != 0 {
+		rex |= 2
+	}
+	if rex != 0x40 || i.byteRegs {
+		a.emit(rex)
+	}
+	a.emit(i.opcode...)
+
+	reg := byte(i.reg&7) << 3
+	switch {
+	case rm.kind == regOperand:
+		a.emit(0xc0 | reg | byte(rm.reg.num&7))
+	case rm.rip:
+		a.emit(reg | 5)
+		if rm.symbol != "" {
+			// The displacement is from the end of the instruction.
+			typ := PC32
+			if rm.got {
+				typ = GOTPCREL
+			}
+			a.fixup(a.symbol(rm.symbol), typ, rm.disp-4-int64(i.immSize))
+			a.emit(0, 0, 0, 0)
+		} else {
+			a.emit(little(rm.disp, 4)...)
+		}
+	case rm.base == nil && rm.index == nil:
+		// An absolute address needs a SIB byte with neither a base nor an
+		// index.
+		a.emit(reg|4, 0x25)
+		a.emit(little(rm.disp, 4)...)
+	default:
+		// A base of %rbp or %r13 with no displacement is encoded with one of
+		// zero, since the encoding without one means no base.
+		var mod byte
+		switch {
+		case rm.base == nil:
+		case rm.disp == 0 && rm.base.num&7 != 5:
+		case fitsInt8(rm.disp):
+			mod = 0x40
+		default:
+			mod = 0x80
+		}
+		if rm.index == nil && rm.base != nil && rm.base.num&7 != 4 {
+			a.emit(mod | reg | byte(rm.base.num&7))
+		} else {
+			// A SIB byte is needed for an index, and for a base of %rsp or
+			// %r12, whose encodings in the r/m field mean that one follows.
+			index, base := byte(4), byte(5)
+			if rm.index != nil {
+				index = byte(rm.index.num & 7)
+			}
+			if rm.base != nil {
+				base = byte(rm.base.num & 7)
+			}
+			scale := map[int]byte{1: 0, 2: 1, 4: 2, 8: 3}[rm.scale]
+			a.emit(mod|reg|4, scale<<6|index<<3|base)
+		}
+		switch {
+		case rm.base == nil || mod == 0x80:
+			a.emit(little(rm.disp, 4)...)
+		case mod == 0x40:
+			a.emit(byte(rm.disp))
+		}
+	}
+	a.emit(little(i.imm, i.immSize)...)
+}
+
+// The condition codes of conditional jumps, sets and moves.
+var conditions = map[string]byte{
+	"o": 0, "no": 1, "b": 2, "c": 2, "nae": 2, "ae": 3, "nb": 3, "nc": 3,
+	"e": 4, "z": 4, "ne": 5, "nz": 5, "be": 6, "na": 6, "a": 7, "nbe": 7,
+	"s": 8, "ns": 9, "p": 10, "pe": 10, "np": 11, "po": 11,
+	"l": 12, "nge": 12, "ge": 13, "nl": 13, "le": 14, "ng": 14, "g": 15, "nle": 15,
+}
+
+// The extensions of the opcodes 0x81 and 0x83 for the arithmetic and logical
+// instructions, whose register forms are at eight times the extension.
+var arithmetic = map[string]int{
+	"add": 0, "or": 1, "adc": 2, "sbb": 3, "and": 4, "sub": 5, "xor": 6, "cmp": 7,
+}
+
+// The extensions of the opcodes 0xf7 and 0xf6 for the unary instructions.
+var unary = map[string]int{"not": 2, "neg": 3, "mul": 4, "imul": 5, "div": 6, "idiv": 7}
+
+// The extensions of the opcodes of the shifts.
+var shifts = map[string]int{"rol": 0, "ror": 1, "shl": 4, "sal": 4, "shr": 5, "sar": 7}
+
+// The other integer instructions, which have a suffix for their size.
+var otherIntegers = map[string]bool{
+	"mov": true, "imul": true, "test": true, "bt": true, "bts": true, "btr": true, "btc": true,
+}
+
+// The sizes of the suffixes of integer instructions.
+var suffixes = map[byte]int{'b': 1, 'w': 2, 'l': 4, 'q': 8}
+
+// The mandatory prefixes and opcodes of the scalar SSE instructions, without
+// their "ss" or "sd" suffix, whose operands are both SSE registers or the
+// second one is.
+var scalarSSE = map[string]byte{
+	"add": 0x58, "mul": 0x59, "sub": 0x5c, "div": 0x5e, "min": 0x5d, "max": 0x5f,
+	"sqrt": 0x51,
+}
+
+// instruction encodes an instruction. Its operands are in AT&T order, with
+// the destination last.
+func (a *assembler) instruction(m string, ops []operand) error {
+	switch m {
+	case "ret":
+		return a.fixed(ops, 0xc3)
+	case "leave":
+		return a.fixed(ops, 0xc9)
+	case "nop":
+		return a.fixed(ops, 0x90)
+	case "ud2":
+		return a.fixed(ops, 0x0f, 0x0b)
+	case "cltd", "cdq":
+		return a.fixed(ops, 0x99)
+	case "cqto", "cqo":
+		return a.fixed(ops, 0x48, 0x99)
+	case "cltq", "cdqe":
+		return a.fixed(ops, 0x48, 0x98)
+	case "pushq", "popq":
+		if len(ops) != 1 || ops[0].kind != regOperand || ops[0].reg.size != 8 {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		opcode := byte(0x50)
+		if m == "popq" {
+			opcode = 0x58
+		}
+		if ops[0].reg.num&8 != 0 {
+			a.emit(0x41)
+		}
+		a.emit(opcode + byte(ops[0].reg.num&7))
+		return nil
+	case "call", "jmp":
+		if len(ops) != 1 {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		if ops[0].kind == indirectOperand && ops[0].reg.size == 8 {
+			ext := 2
+			if m == "jmp" {
+				ext = 4
+			}
+			a.encode(modrm{opcode: []byte{0xff}, reg: ext,
+				rm: operand{kind: regOperand, reg: ops[0].reg}})
+			return nil
+		}
+		if m == "call" {
+			return a.branch(ops, 0xe8)
+		}
+		return a.branch(ops, 0xe9)
+	case "leaq":
+		if len(ops) != 2 || ops[0].kind != memOperand || !isReg(ops[1], 8) {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		a.encode(modrm{w: true, opcode: []byte{0x8d}, reg: ops[1].reg.num, rm: ops[0]})
+		return nil
+	case "movslq":
+		return a.extend(m, ops, 4, 8, 0x63)
+	case "movsbl":
+		return a.extend(m, ops, 1, 4, 0x0f, 0xbe)
+	case "movsbq":
+		return a.extend(m, ops, 1, 8, 0x0f, 0xbe)
+	case "movzbl":
+		return a.extend(m, ops, 1, 4, 0x0f, 0xb6)
+	case "movswl":
+		return a.extend(m, ops, 2, 4, 0x0f, 0xbf)
+	case "movzwl":
+		return a.extend(m, ops, 2, 4, 0x0f, 0xb7)
+	case "movss", "movsd":
+		prefix := byte(0xf3)
+		if m == "movsd" {
+			prefix = 0xf2
+		}
+		return a.sseMove(m, ops, prefix, 0x10, 0x11)
+	case "movaps":
+		return a.sseMove(m, ops, 0, 0x28, 0x29)
+	case "movd", "movq":
+		if len(ops) == 2 && (isReg(ops[0], xmmSize) || isReg(ops[1], xmmSize)) {
+			return a.sseTransfer(m, ops)
+		}
+	case "ucomiss", "ucomisd", "comiss", "comisd":
+		var prefix byte
+		if strings.HasSuffix(m, "sd") {
+			prefix = 0x66
+		}
+		opcode := byte(0x2e)
+		if m[0] == 'c' {
+			opcode = 0x2f
+		}
+		return a.sse(m, ops, prefix, false, xmmSize, xmmSize, 0x0f, opcode)
+	case "cvtss2sd":
+		return a.sse(m, ops, 0xf3, false, xmmSize, xmmSize, 0x0f, 0x5a)
+	case "cvtsd2ss":
+		return a.sse(m, ops, 0xf2, false, xmmSize, xmmSize, 0x0f, 0x5a)
+	}
+
+	switch {
+	case strings.HasPrefix(m, "cvtsi2s") && len(m) == 9:
+		// As in cvtsi2sdl, from an int of the size of the suffix.
+		size, ok := suffixes[m[8]]
+		if !ok || size < 4 {
+			break
+		}
+		return a.sse(m, ops, ssePrefix(m[6:8]), size == 8, size, xmmSize, 0x0f, 0x2a)
+	case (strings.HasPrefix(m, "cvtts") || strings.HasPrefix(m, "cvts")) &&
+		strings.HasSuffix(m, "2si"):
+		// The truncating conversions from floating-point to integers, whose
+		// size is that of the destination.
+		opcode := byte(0x2d)
+		if strings.HasPrefix(m, "cvtt") {
+			opcode = 0x2c
+		}
+		kind := strings.TrimSuffix(m, "2si")
+		kind = kind[len(kind)-2:]
+		if len(ops) != 2 || ops[1].kind != regOperand || ops[1].reg.size < 4 ||
+			ops[1].reg.size == xmmSize {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		size := ops[1].reg.size
+		return a.sse(m, ops, ssePrefix(kind), size == 8, xmmSize, size, 0x0f, opcode)
+	case len(m) > 2 && scalarSSE[m[:len(m)-2]] != 0 &&
+		(strings.HasSuffix(m, "ss") || strings.HasSuffix(m, "sd")):
+		return a.sse(m, ops, ssePrefix(m[len(m)-2:]), false, xmmSize, xmmSize,
+			0x0f, scalarSSE[m[:len(m)-2]])
+	case strings.HasPrefix(m, "j") && conditions[m[1:]] != 0 || m == "jo":
+		return a.branch(ops, 0x0f, 0x80+conditions[m[1:]])
+	case strings.HasPrefix(m, "set"):
+		cc, ok := conditions[m[3:]]
+		if !ok {
+			break
+		}
+		if len(ops) != 1 || !isReg(ops[0], 1) && ops[0].kind != memOperand {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		a.encode(modrm{opcode: []byte{0x0f, 0x90 + cc}, rm: ops[0],
+			byteRegs: needsREX(ops[0])})
+		return nil
+	case strings.HasPrefix(m, "cmov"):
+		name := m[4:]
+		size := 0
+		// The suffix of the size is optional, as the destination register
+		// gives it.
+		if _, ok := conditions[name]; !ok && len(name) > 1 {
+			size = suffixes[name[len(name)-1]]
+			name = name[:len(name)-1]
+		}
+		cc, ok := conditions[name]
+		if !ok {
+			break
+		}
+		if len(ops) != 2 || ops[1].kind != regOperand || ops[1].reg.size < 4 ||
+			ops[1].reg.size == xmmSize || size != 0 && size != ops[1].reg.size {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		size = ops[1].reg.size
+		if ops[0].kind == regOperand && ops[0].reg.size != size || ops[0].kind == immOperand {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		a.encode(modrm{w: size == 8, opcode: []byte{0x0f, 0x40 + cc},
+			reg: ops[1].reg.num, rm: ops[0]})
+		return nil
+	}
+
+	// The integer instructions, with a suffix for their operand size.
+	if len(m) < 2 {
+		return fmt.Errorf("unknown instruction %s", m)
+	}
+	name := m[:len(m)-1]
+	size, ok := suffixes[m[len(m)-1]]
+	_, isArithmetic := arithmetic[name]
+	_, isUnary := unary[name]
+	_, isShift := shifts[name]
+	if !ok || !isArithmetic && !isUnary && !isShift && !otherIntegers[name] {
+		return fmt.Errorf("unknown instruction %s", m)
+	}
+	if err := checkSize(m, ops, size); err != nil {
+		return err
+	}
+	if n, ok := arithmetic[name]; ok {
+		return a.arithmetic(m, ops, size, n)
+	}
+	if n, ok := unary[name]; ok && (name != "imul" || len(ops) == 1) {
+		if len(ops) != 1 || ops[0].kind != regOperand && ops[0].kind != memOperand {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		a.encode(sized(size, modrm{opcode: opcode(size, 0xf6, 0xf7), reg: n, rm: ops[0]}))
+		return nil
+	}
+	if n, ok := shifts[name]; ok {
+		return a.shift(m, ops, size, n)
+	}
+	switch name {
+	case "mov":
+		return a.mov(m, ops, size)
+	case "imul":
+		return a.imul(m, ops, size)
+	case "test":
+		if len(ops) != 2 || ops[1].kind == immOperand {
+			break
+		}
+		if ops[0].kind == immOperand {
+			a.encode(sized(size, modrm{opcode: opcode(size, 0xf6, 0xf7), rm: ops[1],
+				imm: ops[0].imm, immSize: immSize(size)}))
+			return nil
+		}
+		if ops[0].kind != regOperand {
+			break
+		}
+		a.encode(sized(size, modrm{opcode: opcode(size, 0x84, 0x85), reg: ops[0].reg.num,
+			rm: ops[1]}))
+		return nil
+	case "bt", "bts", "btr", "btc":
+		if len(ops) != 2 || ops[0].kind != immOperand || size < 2 {
+			break
+		}
+		ext := map[string]int{"bt": 4, "bts": 5, "btr": 6, "btc": 7}[name]
+		a.encode(sized(size, modrm{opcode: []byte{0x0f, 0xba}, reg: ext, rm: ops[1],
+			imm: ops[0].imm, immSize: 1}))
+		return nil
+	}
+	return fmt.Errorf("invalid operands for %s", m)
+}
+
+// fixed emits an instruction which has no operands.
+func (a *assembler) fixed(ops []operand, b ...byte) error {
+	if len(ops) != 0 {
+		return fmt.Errorf("unexpected operands")
+	}
+	a.emit(b...)
+	return nil
+}
+
+// branch emits a jump or call to a symbol with a 32-bit displacement.
+func (a *assembler) branch(ops []operand, opcode ...byte) error {
+	if len(ops) != 1 || ops[0].kind != symbolOperand {
+		return fmt.Errorf("invalid target")
+	}
+	a.emit(opcode...)
+	// On Darwin, every branch to a symbol may be to a stub of the linker.
+	typ := PC32
+	if ops[0].plt || a.darwin {
+		typ = PLT32
+	}
+	a.fixup(a.symbol(ops[0].symbol), typ, -4)
+	a.emit(0, 0, 0, 0)
+	return nil
+}
+
+// isReg returns whether an operand is a register of a size.
+func isReg(op operand, size int) bool {
+	return op.kind == regOperand && op.reg.size == size
+}
+
+// needsREX returns whether an operand is the low byte of %rsp, %rbp, %rsi or
+// %rdi, which can only be named with a REX prefix.
+func needsREX(op operand) bool {
+	return op.kind == regOperand && op.reg.size == 1 && op.reg.num >= 4 && op.reg.num < 8
+}
+
+// checkSize checks that the registers of an integer instruction are of the
+// size of its suffix. The count of a shift may be %cl.
+func checkSize(m string, ops []operand, size int) error {
+	for i, op := range ops {
+		if op.kind != regOperand || op.reg.size == size {
+			continue
+		}
+		if i == 0 && len(ops) == 2 && op.reg == (reg{num: 1, size: 1}) {
+			continue
+		}
+		return fmt.Errorf("invalid operand size for %s", m)
+	}
+	return nil
+}
+
+// sized sets the operand size of an integer instruction of 1, 2, 4 or 8
+// bytes.
+func sized(size int, i modrm) modrm {
+	switch size {
+	case 1:
+		i.byteRegs = needsREX(i.rm) || i.reg >= 4 && i.reg < 8 && i.regIsByte
+	case 2:
+		i.prefix = 0x66
+	case 8:
+		i.w = true
+	}
+	return i
+}
+
+// opcode returns the opcode of an integer instruction of a size: one for
+// bytes, and another for larger operands.
+func opcode(size int, byteOpcode, opcode byte) []byte {
+	if size == 1 {
+		return []byte{byteOpcode}
+	}
+	return []byte{opcode}
+}
+
+// immSize returns the size of the immediate of an integer instruction, which
+// is at most 32 bits, and sign-extended for a 64-bit instruction.
+func immSize(size int) int {
+	if size == 8 {
+		return 4
+	}
+	return size
+}
+
+// checkImm checks that an immediate fits in an instruction of a size, as a
+// signed or an unsigned value.
+func checkImm(m string, n int64, size int) error {
+	switch {
+	case size == 8 && fitsInt32(n),
+		size < 8 && n >= -1<<uint(8*size-1) && n < 1<<uint(8*size):
+		return nil
+	}
+	return fmt.Errorf("immediate %d out of range for %s", n, m)
+}
+
+// arithmetic emits an arithmetic or logical instruction, with the extension
+// n of its immediate form, whose other forms have opcodes of eight times n
+// plus an offset.
+func (a *assembler) arithmetic(m string, ops []operand, size, n int) error {
+	if len(ops) != 2 || ops[1].kind == immOperand || ops[1].kind == symbolOperand ||
+		ops[0].kind == memOperand && ops[1].kind == memOperand {
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	src, dst := ops[0], ops[1]
+	base := byte(n << 3)
+	switch {
+	case src.kind == immOperand:
+		if err := checkImm(m, src.imm, size); err != nil {
+			return err
+		}
+		switch {
+		case size > 1 && fitsInt8(src.imm):
+			a.encode(sized(size, modrm{opcode: []byte{0x83}, reg: n, rm: dst,
+				imm: src.imm, immSize: 1}))
+		case dst.kind == regOperand && dst.reg.num == 0:
+			// The accumulator has a shorter encoding, without a ModR/M byte.
+			i := sized(size, modrm{})
+			if i.prefix != 0 {
+				a.emit(i.prefix)
+			}
+			if i.w {
+				a.emit(0x48)
+			}
+			a.emit(opcode(size, base+4, base+5)...)
+			a.emit(little(src.imm, immSize(size))...)
+		default:
+			a.encode(sized(size, modrm{opcode: opcode(size, 0x80, 0x81), reg: n, rm: dst,
+				imm: src.imm, immSize: immSize(size)}))
+		}
+	case src.kind != regOperand && src.kind != memOperand:
+		return fmt.Errorf("invalid operands for %s", m)
+	case src.kind == regOperand:
+		a.encode(sized(size, modrm{opcode: opcode(size, base, base+1), reg: src.reg.num,
+			regIsByte: true, rm: dst}))
+	default:
+		a.encode(sized(size, modrm{opcode: opcode(size, base+2, base+3), reg: dst.reg.num,
+			regIsByte: true, rm: src}))
+	}
+	return nil
+}
+
+// mov emits a move between registers and memory, or of an immediate.
+func (a *assembler) mov(m string, ops []operand, size int) error {
+	if len(ops) != 2 || ops[1].kind != regOperand && ops[1].kind != memOperand ||
+		ops[0].kind == memOperand && ops[1].kind == memOperand {
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	src, dst := ops[0], ops[1]
+	switch src.kind {
+	case immOperand:
+		if size == 8 && !fitsInt32(src.imm) && dst.kind == regOperand {
+			// A 64-bit immediate can only be moved to a register.
+			a.emit(0x48 | byte(dst.reg.num>>3))
+			a.emit(0xb8 + byte(dst.reg.num&7))
+			a.emit(little(src.imm, 8)...)
+			return nil
+		}
+		if err := checkImm(m, src.imm, size); err != nil {
+			return err
+		}
+		if dst.kind == regOperand && size != 8 {
+			i := sized(size, modrm{rm: dst})
+			if i.prefix != 0 {
+				a.emit(i.prefix)
+			}
+			if dst.reg.num&8 != 0 || i.byteRegs {
+				a.emit(0x40 | byte(dst.reg.num>>3))
+			}
+			a.emit(opcode(size, 0xb0, 0xb8)[0] + byte(dst.reg.num&7))
+			a.emit(little(src.imm, size)...)
+			return nil
+		}
+		a.encode(sized(size, modrm{opcode: opcode(size, 0xc6, 0xc7), rm: dst,
+			imm: src.imm, immSize: immSize(size)}))
+	case regOperand:
+		a.encode(sized(size, modrm{opcode: opcode(size, 0x88, 0x89), reg: src.reg.num,
+			regIsByte: true, rm: dst}))
+	case memOperand:
+		a.encode(sized(size, modrm{opcode: opcode(size, 0x8a, 0x8b), reg: dst.reg.num,
+			regIsByte: true, rm: src}))
+	default:
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	return nil
+}
+
+// imul emits a signed multiplication of two operands, or of an immediate and
+// a register or memory operand into a register, which may be the same.
+func (a *assembler) imul(m string, ops []operand, size int) error {
+	if size == 1 || len(ops) < 2 || len(ops) > 3 || ops[len(ops)-1].kind != regOperand {
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	dst := ops[len(ops)-1]
+	if ops[0].kind != immOperand {
+		if len(ops) != 2 || ops[0].kind != regOperand && ops[0].kind != memOperand {
+			return fmt.Errorf("invalid operands for %s", m)
+		}
+		a.encode(sized(size, modrm{opcode: []byte{0x0f, 0xaf}, reg: dst.reg.num, rm: ops[0]}))
+		return nil
+	}
+	src := dst
+	if len(ops) == 3 {
+		src = ops[1]
+	}
+	if err := checkImm(m, ops[0].imm, size); err != nil {
+		return err
+	}
+	if fitsInt8(ops[0].imm) {
+		a.encode(sized(size, modrm{opcode: []byte{0x6b}, reg: dst.reg.num, rm: src,
+			imm: ops[0].imm, immSize: 1}))
+	} else {
+		a.encode(sized(size, modrm{opcode: []byte{0x69}, reg: dst.reg.num, rm: src,
+			imm: ops[0].imm, immSize: immSize(size)}))
+	}
+	return nil
+}
+
+// shift emits a shift or rotation by %cl or an immediate, with the opcode
+// extension n.
+func (a *assembler) shift(m string, ops []operand, size, n int) error {
+	if len(ops) == 1 {
+		ops = []operand{{kind: immOperand, imm: 1}, ops[0]}
+	}
+	if len(ops) != 2 || ops[1].kind != regOperand && ops[1].kind != memOperand {
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	switch count := ops[0]; {
+	case count.kind == regOperand:
+		if count.reg != (reg{num: 1, size: 1}) {
+			return fmt.Errorf("the count of %s must be %%cl", m)
+		}
+		a.encode(sized(size, modrm{opcode: opcode(size, 0xd2, 0xd3), reg: n, rm: ops[1]}))
+	case count.kind == immOperand && count.imm == 1:
+		a.encode(sized(size, modrm{opcode: opcode(size, 0xd0, 0xd1), reg: n, rm: ops[1]}))
+	case count.kind == immOperand && count.imm >= 0 && count.imm < 64:
+		a.encode(sized(size, modrm{opcode: opcode(size, 0xc0, 0xc1), reg: n, rm: ops[1],
+			imm: count.imm, immSize: 1}))
+	default:
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	return nil
+}
+
+// extend emits a sign or zero extension from a register or memory operand
+// of one size into a register of a larger size.
+func (a *assembler) extend(m string, ops []operand, from, to int, op ...byte) error {
+	if len(ops) != 2 || !isReg(ops[1], to) ||
+		ops[0].kind != memOperand && !isReg(ops[0], from) {
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	a.encode(modrm{w: to == 8, opcode: op, reg: ops[1].reg.num, rm: ops[0],
+		byteRegs: from == 1 && needsREX(ops[0])})
+	return nil
+}
+
+// ssePrefix returns the mandatory prefix of a scalar SSE instruction on
+// single precision values, "ss", or double precision values, "sd".
+func ssePrefix(kind string) byte {
+	if kind == "sd" {
+		return 0xf2
+	}
+	return 0xf3
+}
+
+// sse emits an SSE instruction from a register or memory operand of size
+// from to a register of size to.
+func (a *assembler) sse(m string, ops []operand, prefix byte, w bool, from, to int, op ...byte) error {
+	if len(ops) != 2 || !isReg(ops[1], to) ||
+		ops[0].kind != memOperand && !isReg(ops[0], from) {
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	a.encode(modrm{prefix: prefix, w: w, opcode: op, reg: ops[1].reg.num, rm: ops[0]})
+	return nil
+}
+
+// sseMove emits a move between SSE registers or memory, with the opcode of
+// a load or move between registers, and that of a store.
+func (a *assembler) sseMove(m string, ops []operand, prefix, load, store byte) error {
+	if len(ops) == 2 && ops[1].kind == memOperand && isReg(ops[0], xmmSize) {
+		a.encode(modrm{prefix: prefix, opcode: []byte{0x0f, store}, reg: ops[0].reg.num,
+			rm: ops[1]})
+		return nil
+	}
+	return a.sse(m, ops, prefix, false, xmmSize, xmmSize, 0x0f, load)
+}
+
+// sseTransfer emits a movd or movq between a general purpose register and
+// an SSE register.
+func (a *assembler) sseTransfer(m string, ops []operand) error {
+	size := 4
+	if m == "movq" {
+		size = 8
+	}
+	src, dst := ops[0], ops[1]
+	switch {
+	case isReg(dst, xmmSize) && isReg(src, size):
+		a.encode(modrm{prefix: 0x66, w: size == 8, opcode: []byte{0x0f, 0x6e},
+			reg: dst.reg.num, rm: src})
+	case isReg(src, xmmSize) && isReg(dst, size):
+		a.encode(modrm{prefix: 0x66, w: size == 8, opcode: []byte{0x0f, 0x7e},
+			reg: src.reg.num, rm: dst})
+	default:
+		return fmt.Errorf("invalid operands for %s", m)
+	}
+	return nil
+}
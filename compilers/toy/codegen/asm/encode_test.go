@@ -0,0 +1,136 @@
+package asm
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// The encodings of instructions, as given by the GNU assembler.
+var encodingTests = []struct {
+	instr string
+	hex   string
+}{
+	{"ret", "c3"},
+	{"cltd", "99"},
+	{"cqto", "4899"},
+	{"ud2", "0f0b"},
+	{"pushq %rbp", "55"},
+	{"popq %r15", "415f"},
+	{"movq %rsp, %rbp", "4889e5"},
+	{"movl %r9d, %eax", "4489c8"},
+	{"movl $0, %eax", "b800000000"},
+	{"movl $-5, %r10d", "41baf bffffff"},
+	{"movq $12, %rcx", "48c7c10c000000"},
+	{"movq $0x123456789, %rax", "48b88967452301000000"},
+	{"movb $5, %dil", "40b705"},
+	{"movw $5, %ax", "66b80500"},
+	{"movl -16(%rbp), %eax", "8b45f0"},
+	{"movq %rdi, -8(%rbp)", "48897df8"},
+	{"movq 100000(%rbp), %r15", "4c8bbda0860100"},
+	{"movl (%rax), %eax", "8b00"},
+	{"movl (%r13), %eax", "418b4500"},
+	{"movl %eax, 8(%r12)", "4189442408"},
+	{"movb %cl, (%rax)", "8808"},
+	{"movb %sil, (%rax)", "408830"},
+	{"movq %r9, (%rax,%r10,8)", "4e890cd0"},
+	{"movslq (%rcx,%rax,4), %rax", "48630481"},
+	{"movslq %ecx, %rcx", "4863c9"},
+	{"movsbl (%rax), %eax", "0fbe00"},
+	{"movsbl %al, %eax", "0fbec0"},
+	{"movzbl %al, %eax", "0fb6c0"},
+	{"movswl (%rax), %eax", "0fbf00"},
+	{"movzwl %ax, %eax", "0fb7c0"},
+	{"movw %cx, (%rax)", "668908"},
+	{"leaq (%rax,%rcx,4), %rax", "488d0488"},
+	{"leaq -24(%rbp), %rax", "488d45e8"},
+	{"addl %ecx, %eax", "01c8"},
+	{"addq $16, %rsp", "4883c410"},
+	{"addl $1000, %eax", "05e8030000"},
+	{"addq $1000, %rbx", "4881c3e8030000"},
+	{"subq $16, %rsp", "4883ec10"},
+	{"cmpl $0, %eax", "83f800"},
+	{"cmpq %rcx, %rax", "4839c8"},
+	{"cmpb $3, %al", "3c03"},
+	{"xorq %fs:40, %rcx", "644833 0c2528000000"},
+	{"movq %fs:40, %rax", "64488b042528000000"},
+	{"imull %ecx, %eax", "0fafc1"},
+	{"imulq $12, %rcx", "486bc90c"},
+	{"imulq $300, %rcx", "4869c92c010000"},
+	{"imull $7, %ecx, %edx", "6bd107"},
+	{"idivl %ecx", "f7f9"},
+	{"idivq %rcx", "48f7f9"},
+	{"negl %eax", "f7d8"},
+	{"notq %r11", "49f7d3"},
+	{"negb %al", "f6d8"},
+	{"sall %cl, %eax", "d3e0"},
+	{"sarl %cl, %eax", "d3f8"},
+	{"sarq $3, %rax", "48c1f803"},
+	{"shrl $1, %eax", "d1e8"},
+	{"btcl $31, %eax", "0fbaf81f"},
+	{"btcq $63, %rax", "480fbaf83f"},
+	{"testl %eax, %eax", "85c0"},
+	{"sete %al", "0f94c0"},
+	{"setnp %cl", "0f9bc1"},
+	{"setne %sil", "400f95c6"},
+	{"cmovne %ecx, %eax", "0f45c1"},
+	{"cmovne %rcx, %rax", "480f45c1"},
+	{"cmovgq %r8, %r9", "4d0f4fc8"},
+	{"jmp *%rax", "ffe0"},
+	{"jmp *%r10", "41ffe2"},
+	{"call *%rax", "ffd0"},
+	{"movss -4(%rbp), %xmm0", "f30f1045fc"},
+	{"movsd %xmm0, -8(%rbp)", "f20f1145f8"},
+	{"movss %xmm10, -4(%rbp)", "f3440f1155fc"},
+	{"movaps %xmm2, %xmm0", "0f28c2"},
+	{"movaps %xmm15, %xmm1", "410f28cf"},
+	{"addsd %xmm1, %xmm0", "f20f58c1"},
+	{"divss %xmm1, %xmm0", "f30f5ec1"},
+	{"ucomiss %xmm1, %xmm0", "0f2ec1"},
+	{"ucomisd %xmm0, %xmm1", "660f2ec8"},
+	{"cvtsi2sdl %eax, %xmm0", "f20f2ac0"},
+	{"cvtsi2ssq %rax, %xmm9", "f34c0f2ac8"},
+	{"cvttss2si %xmm0, %eax", "f30f2cc0"},
+	{"cvttsd2si %xmm8, %r10", "f24d0f2cd0"},
+	{"cvtss2sd %xmm0, %xmm0", "f30f5ac0"},
+	{"cvtsd2ss %xmm0, %xmm0", "f20f5ac0"},
+	{"movd %xmm0, %eax", "660f7ec0"},
+	{"movd %eax, %xmm0", "660f6ec0"},
+	{"movq %xmm0, %rax", "66480f7ec0"},
+	{"movq %rax, %xmm0", "66480f6ec0"},
+}
+
+func TestEncoding(t *testing.T) {
+	for _, test := range encodingTests {
+		object, err := Assemble("\t" + test.instr + "\n")
+		if !assert.NoError(t, err, test.instr) {
+			continue
+		}
+		want, err := hex.DecodeString(strings.Replace(test.hex, " ", "", -1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, hex.EncodeToString(want),
+			hex.EncodeToString(object.Sections[0].Data), test.instr)
+	}
+}
+
+func TestEncodingErrors(t *testing.T) {
+	assert := assert.New(t)
+	for instr, msg := range map[string]string{
+		"frob %eax":               "1: unknown instruction frob",
+		"addl %ecx, %rax":         "1: invalid operand size for addl",
+		"addl %eax, $1":           "1: invalid operands for addl",
+		"movl (%rax), (%rcx)":     "1: invalid operands for movl",
+		"addl $0x100000000, %eax": "1: immediate 4294967296 out of range for addl",
+		"movl %eax, %foo":         "1: invalid register %foo",
+		"movl (%rax,%rsp), %eax":  "1: invalid index in (%rax,%rsp)",
+		"sall %edx, %eax":         "1: the count of sall must be %cl",
+		"ret %eax":                "1: unexpected operands",
+		"jmp $1":                  "1: invalid target",
+	} {
+		_, err := Assemble("\t" + instr + "\n")
+		assert.EqualError(err, msg, instr)
+	}
+}
@@ -0,0 +1,286 @@
+package asm
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The flags of Mach-O sections.
+const (
+	machoZerofill         = 0x1
+	machoCstringLiterals  = 0x2
+	machoPureInstructions = 0x80000000
+	machoSomeInstructions = 0x400
+)
+
+// The build version load command, for macOS. The earliest version which may
+// load the object, 10.14, has a byte for each of its major, minor and patch
+// numbers.
+const (
+	machoLoadCmdBuildVersion = 0x32
+	machoPlatformMacOS       = 1
+	machoMinOS               = 10<<16 | 14<<8
+)
+
+// The types of the symbols of a Mach-O file.
+const (
+	machoExternal  = 0x1
+	machoUndefined = 0x0
+	machoSection   = 0xe
+)
+
+// A build version load command, which gives the platform for which an object
+// is built, without the tools which built it.
+type machoBuildVersion struct {
+	Cmd      macho.LoadCmd
+	Len      uint32
+	Platform uint32
+	Minos    uint32
+	Sdk      uint32
+	Ntools   uint32
+}
+
+// WriteMachO writes an object as a relocatable Mach-O file for x86-64, as
+// assembled with the Darwin option.
+//
+// Every section of the object is in a single unnamed segment, as is usual in
+// object files, at addresses in the order of the sections, with the
+// zero-filled sections last. The object is not divided into subsections at
+// its symbols, since the assembler has resolved the references between
+// them. Relocations against temporary labels, which are not in the symbol
+// table, refer to the section of the label instead, and hold the address of
+// the label relative to the end of the relocation, as a reference within the
+// file would.
+func WriteMachO(w io.Writer, object *Object) error {
+	sections := object.Sections
+	ordinal := make(map[*Section]int)
+	addr := make(map[*Section]uint64)
+	var size, fileSize, align uint64 = 0, 0, 1
+	for _, zerofill := range []bool{false, true} {
+		for _, s := range sections {
+			if (s.Kind == Bss) != zerofill {
+				continue
+			}
+			size = alignTo(size, uint64(s.Align))
+			if uint64(s.Align) > align {
+				align = uint64(s.Align)
+			}
+			addr[s] = size
+			size += uint64(len(s.Data))
+			if !zerofill {
+				fileSize = size
+			}
+		}
+	}
+	for i, s := range sections {
+		ordinal[s] = i + 1
+	}
+
+	// The symbol table has the local symbols, then the defined global ones,
+	// then the undefined ones, each of the latter sorted by name.
+	var locals, defined, undefined []*Symbol
+	for _, s := range object.Symbols {
+		switch {
+		case s.Temporary():
+		case !s.Global:
+			locals = append(locals, s)
+		case s.Section != nil:
+			defined = append(defined, s)
+		default:
+			undefined = append(undefined, s)
+		}
+	}
+	for _, symbols := range [][]*Symbol{defined, undefined} {
+		sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	}
+	strtab := newStringTable()
+	var syms []macho.Nlist64
+	symIndex := make(map[*Symbol]uint32)
+	for _, symbols := range [][]*Symbol{locals, defined, undefined} {
+		for _, s := range symbols {
+			sym := macho.Nlist64{Name: strtab.add(s.Name), Type: machoUndefined}
+			if s.Section != nil {
+				sym.Type = machoSection
+				sym.Sect = uint8(ordinal[s.Section])
+				sym.Value = addr[s.Section] + uint64(s.Value)
+			}
+			if s.Global {
+				sym.Type |= machoExternal
+			}
+			symIndex[s] = uint32(len(syms))
+			syms = append(syms, sym)
+		}
+	}
+
+	// Each relocation is an address and a word of bits: the number of its
+	// symbol or section, whether it is relative to the instruction pointer,
+	// the log2 of its size, whether it refers to a symbol, and its type.
+	contents := make([][]byte, len(sections))
+	relocs := make([][]byte, len(sections))
+	for i, s := range sections {
+		contents[i] = append([]byte(nil), s.Data...)
+		var b bytes.Buffer
+		for _, r := range s.Relocs {
+			if s.Kind != Text {
+				return fmt.Errorf("unsupported relocation against %s in section %s",
+					r.Symbol.Name, s.Name)
+			}
+			typ := macho.X86_64_RELOC_SIGNED
+			switch {
+			case r.Type == PLT32:
+				typ = macho.X86_64_RELOC_BRANCH
+			case r.Type == GOTPCREL && r.Offset >= 2 && s.Data[r.Offset-2] == 0x8b:
+				// The linker may replace a load from the table by the
+				// address itself.
+				typ = macho.X86_64_RELOC_GOT_LOAD
+			case r.Type == GOTPCREL:
+				typ = macho.X86_64_RELOC_GOT
+			}
+			// The value in the section is the displacement from the end of
+			// the relocation.
+			value := r.Addend + 4
+			num, extern := symIndex[r.Symbol], uint32(1)
+			if r.Symbol.Temporary() {
+				value = int64(addr[r.Symbol.Section]) + int64(r.Symbol.Value) + r.Addend -
+					int64(addr[s]) - int64(r.Offset)
+				num, extern = uint32(ordinal[r.Symbol.Section]), 0
+			}
+			copy(contents[i][r.Offset:], little(value, 4))
+			binary.Write(&b, binary.LittleEndian, []uint32{
+				uint32(r.Offset),
+				num | 1<<24 | 2<<25 | extern<<27 | uint32(typ)<<28,
+			})
+		}
+		relocs[i] = b.Bytes()
+	}
+
+	// The load commands follow the file header, and are followed by the
+	// contents of the sections, at the offsets of their addresses from the
+	// start of the segment, their relocations, and the tables of symbols and
+	// strings.
+	headerSize := binary.Size(macho.FileHeader{}) + 4
+	segmentSize := binary.Size(macho.Segment64{}) + len(sections)*binary.Size(macho.Section64{})
+	cmds := []int{
+		segmentSize,
+		binary.Size(machoBuildVersion{}),
+		binary.Size(macho.SymtabCmd{}),
+		binary.Size(macho.DysymtabCmd{}),
+	}
+	cmdsSize := 0
+	for _, n := range cmds {
+		cmdsSize += n
+	}
+	var body bytes.Buffer
+	offset := func() uint32 { return uint32(headerSize + cmdsSize + body.Len()) }
+	pad := func(align int) {
+		for offset()%uint32(align) != 0 {
+			body.WriteByte(0)
+		}
+	}
+	pad(int(align))
+	segmentOffset := offset()
+	headers := make([]macho.Section64, len(sections))
+	for i, s := range sections {
+		h := &headers[i]
+		segment := strings.SplitN(s.Name, ",", 2)
+		if len(segment) != 2 {
+			return fmt.Errorf("invalid section name %s", s.Name)
+		}
+		copy(h.Seg[:], segment[0])
+		copy(h.Name[:], segment[1])
+		h.Addr = addr[s]
+		h.Size = uint64(len(s.Data))
+		for 1<<h.Align < s.Align {
+			h.Align++
+		}
+		switch {
+		case s.Kind == Text:
+			h.Flags = machoPureInstructions | machoSomeInstructions
+		case s.Kind == Bss:
+			h.Flags = machoZerofill
+		case segment[1] == "__cstring":
+			h.Flags = machoCstringLiterals
+		}
+		if s.Kind != Bss {
+			for uint64(offset()) < uint64(segmentOffset)+h.Addr {
+				body.WriteByte(0)
+			}
+			h.Offset = offset()
+			body.Write(contents[i])
+		}
+	}
+	for i := range sections {
+		if len(relocs[i]) == 0 {
+			continue
+		}
+		pad(4)
+		headers[i].Reloff = offset()
+		headers[i].Nreloc = uint32(len(relocs[i]) / 8)
+		body.Write(relocs[i])
+	}
+	pad(8)
+	symoff := offset()
+	binary.Write(&body, binary.LittleEndian, syms)
+	stroff := offset()
+	body.Write(strtab.data.Bytes())
+	pad(8)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, macho.FileHeader{
+		Magic:  macho.Magic64,
+		Cpu:    macho.CpuAmd64,
+		SubCpu: 3, // Every x86-64 processor.
+		Type:   macho.TypeObj,
+		Ncmd:   uint32(len(cmds)),
+		Cmdsz:  uint32(cmdsSize),
+	})
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	segment := macho.Segment64{
+		Cmd:     macho.LoadCmdSegment64,
+		Len:     uint32(segmentSize),
+		Memsz:   size,
+		Offset:  uint64(segmentOffset),
+		Filesz:  fileSize,
+		Maxprot: 7,
+		Prot:    7,
+		Nsect:   uint32(len(sections)),
+	}
+	binary.Write(&b, binary.LittleEndian, segment)
+	binary.Write(&b, binary.LittleEndian, headers)
+	binary.Write(&b, binary.LittleEndian, machoBuildVersion{
+		Cmd:      machoLoadCmdBuildVersion,
+		Len:      uint32(cmds[1]),
+		Platform: machoPlatformMacOS,
+		Minos:    machoMinOS,
+	})
+	binary.Write(&b, binary.LittleEndian, macho.SymtabCmd{
+		Cmd:     macho.LoadCmdSymtab,
+		Len:     uint32(cmds[2]),
+		Symoff:  symoff,
+		Nsyms:   uint32(len(syms)),
+		Stroff:  stroff,
+		Strsize: uint32(strtab.data.Len()),
+	})
+	binary.Write(&b, binary.LittleEndian, macho.DysymtabCmd{
+		Cmd:        macho.LoadCmdDysymtab,
+		Len:        uint32(cmds[3]),
+		Nlocalsym:  uint32(len(locals)),
+		Iextdefsym: uint32(len(locals)),
+		Nextdefsym: uint32(len(defined)),
+		Iundefsym:  uint32(len(locals) + len(defined)),
+		Nundefsym:  uint32(len(undefined)),
+	})
+	b.Write(body.Bytes())
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// alignTo rounds a number up to a multiple of n.
+func alignTo(x, n uint64) uint64 {
+	return (x + n - 1) / n * n
+}
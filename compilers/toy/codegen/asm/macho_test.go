@@ -0,0 +1,110 @@
+package asm
+
+import (
+	"bytes"
+	"debug/macho"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteMachO(t *testing.T) {
+	assert := assert.New(t)
+	object, err := Assemble(`	.text
+	.globl _main
+_main:
+	leaq Lstr0(%rip), %rdi
+	call _puts
+	movq ___stack_chk_guard@GOTPCREL(%rip), %rax
+	movl _x(%rip), %eax
+	ret
+	.data
+	.globl _x
+	.p2align 2
+_x:
+	.long 7
+	.section __DATA,__bss
+	.zero 8
+	.section __TEXT,__cstring,cstring_literals
+Lstr0:
+	.asciz "hi"
+`, Darwin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	assert.NoError(WriteMachO(&b, object))
+
+	f, err := macho.NewFile(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(macho.Magic64, f.Magic)
+	assert.Equal(macho.CpuAmd64, f.Cpu)
+	assert.Equal(macho.TypeObj, f.Type)
+
+	type section struct {
+		seg, name  string
+		addr, size uint64
+		align      uint32
+		flags      uint32
+	}
+	var sections []section
+	for _, s := range f.Sections {
+		sections = append(sections, section{s.Seg, s.Name, s.Addr, s.Size, s.Align, s.Flags})
+	}
+	// Zero-filled sections are at the end of the segment.
+	assert.Equal([]section{
+		{"__TEXT", "__text", 0, 26, 0, machoPureInstructions | machoSomeInstructions},
+		{"__DATA", "__data", 28, 4, 2, 0},
+		{"__DATA", "__bss", 35, 8, 0, machoZerofill},
+		{"__TEXT", "__cstring", 32, 3, 0, machoCstringLiterals},
+	}, sections)
+	cstring, _ := f.Sections[3].Data()
+	assert.Equal([]byte("hi\x00"), cstring)
+
+	// Temporary labels are not in the symbol table, and the undefined
+	// symbols follow the defined ones.
+	type symbol struct {
+		name  string
+		typ   uint8
+		sect  uint8
+		value uint64
+	}
+	var symbols []symbol
+	for _, s := range f.Symtab.Syms {
+		symbols = append(symbols, symbol{s.Name, s.Type, s.Sect, s.Value})
+	}
+	assert.Equal([]symbol{
+		{"_main", machoSection | machoExternal, 1, 0},
+		{"_x", machoSection | machoExternal, 2, 28},
+		{"___stack_chk_guard", machoExternal, 0, 0},
+		{"_puts", machoExternal, 0, 0},
+	}, symbols)
+	assert.Equal(uint32(2), f.Dysymtab.Nextdefsym)
+	assert.Equal(uint32(2), f.Dysymtab.Nundefsym)
+
+	type reloc struct {
+		addr   uint32
+		value  uint32
+		typ    macho.RelocTypeX86_64
+		extern bool
+	}
+	var relocs []reloc
+	for _, r := range f.Sections[0].Relocs {
+		assert.True(r.Pcrel)
+		assert.Equal(uint8(2), r.Len)
+		relocs = append(relocs, reloc{r.Addr, r.Value, macho.RelocTypeX86_64(r.Type), r.Extern})
+	}
+	// The reference to the string is to its section, the fourth.
+	assert.Equal([]reloc{
+		{3, 4, macho.X86_64_RELOC_SIGNED, false},
+		{8, 3, macho.X86_64_RELOC_BRANCH, true},
+		{15, 2, macho.X86_64_RELOC_GOT_LOAD, true},
+		{21, 1, macho.X86_64_RELOC_SIGNED, true},
+	}, relocs)
+	text, _ := f.Sections[0].Data()
+	// The displacement of the string is from the end of the instruction,
+	// and those of symbols are the offsets from them.
+	assert.Equal([]byte{0x19, 0, 0, 0}, text[3:7])
+	assert.Equal([]byte{0, 0, 0, 0}, text[21:25])
+}
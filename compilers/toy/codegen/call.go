@@ -0,0 +1,235 @@
+package codegen
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// The registers in which the first integer arguments of a call are passed.
+var intArgRegisters = []register{
+	{"edi", "rdi", false},
+	{"esi", "rsi", false},
+	{"edx", "rdx", false},
+	{"ecx", "rcx", false},
+	{"r8d", "r8", false},
+	{"r9d", "r9", false},
+}
+
+// The registers in which the first floating-point arguments of a call are
+// passed.
+var floatArgRegisters = []register{
+	{"xmm0", "xmm0", false},
+	{"xmm1", "xmm1", false},
+	{"xmm2", "xmm2", false},
+	{"xmm3", "xmm3", false},
+	{"xmm4", "xmm4", false},
+	{"xmm5", "xmm5", false},
+	{"xmm6", "xmm6", false},
+	{"xmm7", "xmm7", false},
+}
+
+// Where an argument is passed: in a register, or in the i'th eightbyte of the
+// arguments on the stack.
+type argLocation struct {
+	inRegister bool
+	register   register
+	stack      int
+}
+
+// classify returns the locations of arguments of the given types according
+// to the System V ABI, and the number of stack slots they occupy. Integer and
+// floating-point arguments are assigned registers separately, in order, and
+// the rest are passed on the stack from left to right.
+func classify(args []types.Type) ([]argLocation, int) {
+	locations := make([]argLocation, len(args))
+	ints, floats, stack := 0, 0, 0
+	for i, t := range args {
+		switch {
+		case types.IsFloating(t) && floats < len(floatArgRegisters):
+			locations[i] = argLocation{inRegister: true,
+				register: floatArgRegisters[floats]}
+			floats++
+		case !types.IsFloating(t) && ints < len(intArgRegisters):
+			locations[i] = argLocation{inRegister: true,
+				register: intArgRegisters[ints]}
+			ints++
+		default:
+			locations[i] = argLocation{stack: stack}
+			stack++
+		}
+	}
+	return locations, stack
+}
+
+// isFloat returns whether a register is an SSE register.
+func (r register) isFloat() bool {
+	return r.name.isXMM()
+}
+
+// move copies a value of type t between a register and memory.
+func (g *generator) move(t types.Type, src, dst Operand) {
+	if types.IsFloating(t) {
+		g.emit("mov"+sse(t), src, dst)
+	} else {
+		g.emit("mov"+integer(t), src, dst)
+	}
+}
+
+// moveParams moves the arguments of the current function from where they are
+// passed to the locations of its parameters. Arguments in registers are all
+// stored to memory first, in case one parameter's register is another's
+// argument register.
+func (g *generator) moveParams(f *ir.Function) {
+	paramTypes := make([]types.Type, len(f.Params))
+	for i, p := range f.Params {
+		paramTypes[i] = p.Type()
+	}
+	locations, _ := classify(paramTypes)
+	for i, p := range f.Params {
+		if !locations[i].inRegister {
+			continue
+		}
+		offset, ok := g.paramOffsets[p]
+		if !ok {
+			offset = g.offsets[p]
+		}
+		g.move(p.Type(), locations[i].register.sized(p.Type()), memory(offset, rbp))
+	}
+	for i, p := range f.Params {
+		if offset, ok := g.paramOffsets[p]; ok && locations[i].inRegister {
+			g.move(p.Type(), memory(offset, rbp), g.registers[p].sized(p.Type()))
+		}
+	}
+	// Arguments on the stack are above the return address and saved %rbp.
+	for i, p := range f.Params {
+		if !locations[i].inRegister {
+			offset := 2*slotSize + slotSize*locations[i].stack
+			g.move(p.Type(), memory(offset, rbp), scratch(p.Type()))
+			g.store(p)
+		}
+	}
+}
+
+// scratch returns the first scratch register for a value of type t.
+func scratch(t types.Type) Reg {
+	switch {
+	case types.IsFloating(t):
+		return xmm0
+	case isQuad(t):
+		return rax
+	}
+	return eax
+}
+
+// scratch2 returns the second scratch register for a value of type t.
+func scratch2(t types.Type) Reg {
+	switch {
+	case types.IsFloating(t):
+		return xmm1
+	case isQuad(t):
+		return rcx
+	}
+	return ecx
+}
+
+// saveRegister stores the whole of a register to a slot of the frame.
+func (g *generator) saveRegister(r register, offset int) {
+	if r.isFloat() {
+		g.emit("movsd", r.name, memory(offset, rbp))
+	} else {
+		g.emit("movq", r.quad, memory(offset, rbp))
+	}
+}
+
+// restoreRegister loads a register saved by saveRegister.
+func (g *generator) restoreRegister(r register, offset int) {
+	if r.isFloat() {
+		g.emit("movsd", memory(offset, rbp), r.name)
+	} else {
+		g.emit("movq", memory(offset, rbp), r.quad)
+	}
+}
+
+// callee returns the assembly name of a function which is called. On Linux,
+// functions defined elsewhere, such as in a shared library, or any function
+// in position-independent code which is not static, are called through the
+// procedure linkage table.
+func (g *generator) callee(name string) Sym {
+	f := g.defined[name]
+	sym := g.symbol(name)
+	if !g.darwin && (f == nil || g.pic && !f.Static) {
+		return Sym(sym + "@PLT")
+	}
+	return Sym(sym)
+}
+
+// call emits a call. The caller-saved registers which hold live temporaries
+// are saved around it. The arguments are evaluated from left to right into
+// an area at the top of the stack, with those passed on the stack at the
+// bottom, where the callee expects them, and then those passed in registers
+// are loaded. The area is a multiple of 16 bytes, so that the stack remains
+// aligned.
+//
+// A call in tail position whose arguments are all passed in registers is a
+// jump instead, once the frame is freed, so that the callee returns to the
+// caller of the function.
+func (g *generator) call(c *ir.Call) {
+	argTypes := make([]types.Type, len(c.Args))
+	for i, a := range c.Args {
+		argTypes[i] = a.Type()
+	}
+	locations, stackArgs := classify(argTypes)
+	tail := g.tailCalls[c] && stackArgs == 0
+	if !tail {
+		for _, r := range g.preserved[c] {
+			g.saveRegister(r, g.callerSaveOffsets[r])
+		}
+	}
+
+	area := align(slotSize * len(c.Args))
+	if area > 0 {
+		g.emit("subq", Imm(area), rsp)
+	}
+	offsets := make([]int, len(c.Args))
+	next := stackArgs
+	for i, a := range c.Args {
+		if locations[i].inRegister {
+			offsets[i] = slotSize * next
+			next++
+		} else {
+			offsets[i] = slotSize * locations[i].stack
+		}
+		g.load(a, false)
+		g.move(a.Type(), scratch(a.Type()), memory(offsets[i], rsp))
+	}
+	floats := 0
+	for i, a := range c.Args {
+		if locations[i].inRegister {
+			g.move(a.Type(), memory(offsets[i], rsp), locations[i].register.sized(a.Type()))
+			if locations[i].register.isFloat() {
+				floats++
+			}
+		}
+	}
+
+	// A variadic callee expects the number of SSE registers used in %al.
+	g.emit("movl", Imm(floats), eax)
+	name := g.callee(c.Function)
+	if tail {
+		// The arguments are in registers, and the number of SSE registers in
+		// %eax, so the canary is checked in %r11, which passes neither.
+		g.leave(r11)
+		g.emit("jmp", name)
+		g.cfi(".cfi_restore_state")
+		return
+	}
+	g.emit("call", name)
+	if area > 0 {
+		g.emit("addq", Imm(area), rsp)
+	}
+
+	for _, r := range g.preserved[c] {
+		g.restoreRegister(r, g.callerSaveOffsets[r])
+	}
+	g.store(c.Dst)
+}
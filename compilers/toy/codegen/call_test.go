@@ -0,0 +1,145 @@
+package codegen
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	assert := assert.New(t)
+	args := []types.Type{types.Int, types.Double, types.Float}
+	for i := 0; i < 6; i++ {
+		args = append(args, types.Int)
+	}
+	locations, stack := classify(args)
+	assert.Equal(1, stack)
+	assert.Equal(Reg("edi"), locations[0].register.name)
+	assert.Equal(Reg("xmm0"), locations[1].register.name)
+	assert.Equal(Reg("xmm1"), locations[2].register.name)
+	assert.Equal(Reg("r9d"), locations[7].register.name)
+	// The seventh int argument is the first on the stack.
+	assert.Equal(argLocation{stack: 0}, locations[8])
+
+	locations, stack = classify(nil)
+	assert.Empty(locations)
+	assert.Equal(0, stack)
+}
+
+func TestGenerateCall(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int putchar(int); int main() { return putchar(65); }",
+		NoRegisterAllocation, NoTailCalls)
+	assert.Contains(asm, `	subq $16, %rsp
+	movl $65, %eax
+	movl %eax, (%rsp)
+	movl (%rsp), %edi
+	movl $0, %eax
+	call putchar@PLT
+	addq $16, %rsp
+	movl %eax, -8(%rbp)
+`)
+
+	// Functions defined in the program are called directly.
+	asm = generate(t, "double f() { return 1.5; } double main() { return f(); }",
+		NoRegisterAllocation, NoTailCalls)
+	assert.Contains(asm, "\tmovl $0, %eax\n\tcall f\n\tmovsd %xmm0, -8(%rbp)\n")
+}
+
+func TestGenerateTailCall(t *testing.T) {
+	assert := assert.New(t)
+	// The frame is freed before the jump, so that the callee returns to the
+	// caller of main.
+	asm := generate(t, "int putchar(int); int main() { return putchar(65); }",
+		NoRegisterAllocation)
+	assert.Contains(asm, `	movl (%rsp), %edi
+	movl $0, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	jmp putchar@PLT
+`)
+	assert.NotContains(asm, "call")
+
+	// The stack canary is checked in a register which passes no argument.
+	asm = generate(t, "int g(int, int); int f(int a) { return g(a, a); }", SanitizeStack)
+	assert.Contains(asm, "\txorq %fs:40, %r11\n")
+	assert.Contains(asm, "\tjmp g@PLT\n")
+
+	// A call with arguments on the stack needs the frame of the caller.
+	asm = generate(t, `int g(int a, int b, int c, int d, int e, int f, int h);
+int f() { return g(1, 2, 3, 4, 5, 6, 7); }`)
+	assert.Contains(asm, "\tcall g@PLT\n")
+	assert.NotContains(asm, "jmp g")
+
+	asm = generate(t, "int g(int); int f(int a) { return g(a); }", NoTailCalls)
+	assert.Contains(asm, "\tcall g@PLT\n")
+	assert.NotContains(asm, "jmp g")
+}
+
+func TestGenerateCallArguments(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a, double b, int c, int d, int e, int g, int h, int i);
+int main() { return f(1, 2.5, 3, 4, 5, 6, 7, 8); }`, NoRegisterAllocation)
+	// The last int argument is passed on the stack, below the staging slots
+	// of the others.
+	assert.Contains(asm, "\tsubq $64, %rsp\n\tmovl $1, %eax\n\tmovl %eax, 8(%rsp)\n")
+	assert.Contains(asm, "\tmovsd %xmm0, 16(%rsp)\n")
+	assert.Contains(asm, "\tmovl $8, %eax\n\tmovl %eax, (%rsp)\n")
+	assert.Contains(asm, `	movl 8(%rsp), %edi
+	movsd 16(%rsp), %xmm0
+	movl 24(%rsp), %esi
+	movl 32(%rsp), %edx
+	movl 40(%rsp), %ecx
+	movl 48(%rsp), %r8d
+	movl 56(%rsp), %r9d
+	movl $1, %eax
+	call f@PLT
+	addq $64, %rsp
+`)
+}
+
+func TestGenerateParameters(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a, double b, int c, int d, int e, int g, int h, int i) {
+  return a + i;
+}`, NoRegisterAllocation)
+	assert.Contains(asm, `	movl %edi, -8(%rbp)
+	movsd %xmm0, -16(%rbp)
+	movl %esi, -24(%rbp)
+	movl %edx, -32(%rbp)
+	movl %ecx, -40(%rbp)
+	movl %r8d, -48(%rbp)
+	movl %r9d, -56(%rbp)
+	movl 16(%rbp), %eax
+	movl %eax, -64(%rbp)
+`)
+}
+
+func TestGenerateParametersInRegisters(t *testing.T) {
+	assert := assert.New(t)
+	// a is allocated %esi, which is b's argument register, so the arguments
+	// are stored before any is moved to its register.
+	asm := generate(t, "int f(int a, int b) { return a - b; }")
+	assert.Contains(asm, `	movl %edi, -8(%rbp)
+	movl %esi, -16(%rbp)
+	movl -8(%rbp), %esi
+	movl -16(%rbp), %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	subl %ecx, %eax
+`)
+}
+
+func TestGeneratePreservesCallerSavedRegisters(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int g();
+int f() { int a = 1; double d = 2.5; int b = g(); return a + b + d; }`)
+	assert.Contains(asm, `	movq %rsi, -8(%rbp)
+	movsd %xmm2, -16(%rbp)
+	movl $0, %eax
+	call g@PLT
+	movq -8(%rbp), %rsi
+	movsd -16(%rbp), %xmm2
+	movl %eax, %edi
+`)
+}
@@ -0,0 +1,1059 @@
+// Package codegen generates x86-64 assembly from the intermediate
+// representation.
+//
+// The generated code targets the System V AMD64 ABI, so it can be assembled
+// and linked with gcc or as, for Linux or, with the Darwin option, for macOS.
+// It is generated as lines of instructions, labels and directives, which are
+// written in AT&T syntax, or in Intel syntax with the IntelSyntax option.
+// Temporaries are kept in registers where possible, and otherwise in slots in
+// the stack frame. Each instruction loads its operands into %eax and %ecx, or
+// %rax and %rcx for pointers, or %xmm0 and %xmm1 for floating-point values,
+// computes its result, and stores it back to the location of its destination.
+package codegen
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+	"math"
+)
+
+type generator struct {
+	lines         []Line // The lines of the program, as they are emitted.
+	err           error
+	pos           token.Position // The position of the code being compiled, if known.
+	noRegalloc    bool
+	noTailCalls   bool
+	sanitizeStack bool
+	trapOverflow  bool
+	peephole      bool
+	darwin        bool
+	pic           bool
+	printer       printer // The syntax of the assembly.
+	// The calls of the current function which are in tail position.
+	tailCalls map[*ir.Call]bool
+	names     ir.NameGenerator // The names of the labels of the functions.
+	// The register of each temporary in the current function which has one.
+	registers map[*ir.Temp]register
+	// The %rbp-relative offset of each other temporary.
+	offsets map[*ir.Temp]int
+	// The %rbp-relative offset of each stack slot.
+	slotOffsets map[*ir.Slot]int
+	// The callee-saved registers used by the current function, and the
+	// offsets of the slots in which they are saved.
+	saved       []register
+	saveOffsets []int
+	// The caller-saved registers which hold live temporaries at each call,
+	// and the offset of the slot in which each register is saved.
+	preserved         map[*ir.Call][]register
+	callerSaveOffsets map[register]int
+	// The offset of the slot in which each parameter which has a register is
+	// first stored on entry.
+	paramOffsets map[*ir.Temp]int
+	// The %rbp-relative offset of the stack canary of the current function,
+	// and the label of its check failure, if the stack is sanitized.
+	canaryOffset int
+	canaryFail   string
+	// The label of the trap of the current function for int arithmetic which
+	// overflows, if overflow is trapped.
+	overflowTrap string
+	// The functions defined by the program, by name.
+	defined map[string]*ir.Function
+	// Floating-point constants and jump tables, which are emitted after the
+	// program text.
+	constants []constant
+	tables    []jumpTable
+	// The number of local labels of conversions emitted so far.
+	conversionLabels int
+	// The debug information of the program, if it is enabled.
+	debug *debugInfo
+}
+
+// The location of the stack guard of the C library, in the thread control
+// block. On Darwin, the guard is a global variable, whose address is loaded
+// from the global offset table.
+var (
+	stackGuard       = Mem{Seg: fs, Disp: 40}
+	darwinStackGuard = ripRelative("___stack_chk_guard@GOTPCREL")
+)
+
+// A floating-point constant in the read-only data section.
+type constant struct {
+	label string
+	value *ir.FloatConst
+}
+
+// An Option configures code generation.
+type Option func(*generator)
+
+// NoRegisterAllocation is an Option which keeps every temporary on the stack,
+// for debugging.
+func NoRegisterAllocation(g *generator) {
+	g.noRegalloc = true
+}
+
+// NoTailCalls is an Option which returns from each call, rather than jumping
+// to the callee of a call in tail position, so that every caller is in a
+// backtrace.
+func NoTailCalls(g *generator) {
+	g.noTailCalls = true
+}
+
+// SanitizeStack is an Option which protects each function's frame with a
+// canary, in the manner of a stack protector. The canary is copied from the
+// guard value of the C library to the top of the frame on entry, and is
+// checked on return, calling __stack_chk_fail to abort the program if a
+// write past the end of a local array has changed it.
+func SanitizeStack(g *generator) {
+	g.sanitizeStack = true
+}
+
+// TrapOverflow is an Option which checks the overflow flag after each
+// addition, subtraction, multiplication and negation of ints, which wrap
+// around otherwise, and executes ud2 if it is set, so that the program is
+// killed by SIGILL where the undefined behavior would be.
+func TrapOverflow(g *generator) {
+	g.trapOverflow = true
+}
+
+// Darwin is an Option which targets macOS rather than Linux. Symbols are
+// prefixed with an underscore, and assembler-local labels with L rather than
+// .L. Functions defined elsewhere are called directly, since the linker adds
+// stubs for those in shared libraries, and jump tables are in the text
+// section, so that their entries are resolved by the assembler. Debug
+// information is not supported.
+func Darwin(g *generator) {
+	g.darwin = true
+}
+
+// PIC is an Option which generates position-independent code, which may be
+// linked into a shared object. On Linux, the functions and global variables
+// of the program may then be replaced by those of another object when it is
+// loaded, so every function is called through the procedure linkage table,
+// and the addresses of global variables are loaded from the global offset
+// table. Static functions and global variables, which can't be replaced, are
+// called and addressed directly. Code for Darwin is always
+// position-independent.
+func PIC(g *generator) {
+	g.pic = true
+}
+
+// Generate writes the assembly for a program to w.
+func Generate(w io.Writer, program *ir.Program, options ...Option) error {
+	g := &generator{printer: attPrinter{}}
+	for _, option := range options {
+		option(g)
+	}
+	g.names.Prefix = g.localLabel("", -1)
+	if g.darwin && g.debug != nil {
+		return fmt.Errorf("debug information is not supported on Darwin")
+	}
+	g.program(program)
+	if g.err != nil {
+		return g.err
+	}
+	lines := g.lines
+	if g.peephole {
+		lines = peephole(lines)
+	}
+	b := bufio.NewWriter(w)
+	b.WriteString(g.printer.header())
+	for _, l := range lines {
+		b.WriteString(printLine(g.printer, l))
+		b.WriteByte('\n')
+	}
+	return b.Flush()
+}
+
+// emit emits an instruction.
+func (g *generator) emit(op string, args ...Operand) {
+	g.lines = append(g.lines, Instr{op, args})
+}
+
+// label emits a label definition.
+func (g *generator) label(name string) {
+	g.lines = append(g.lines, Label(name))
+}
+
+// directive emits a directive.
+func (g *generator) directive(format string, args ...interface{}) {
+	g.lines = append(g.lines, Directive(fmt.Sprintf(format, args...)))
+}
+
+// errorf records an error for an instruction which cannot be compiled.
+func (g *generator) errorf(format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = &ir.Error{Pos: g.pos, Msg: fmt.Sprintf(format, args...)}
+	}
+}
+
+// symbol returns the assembly name of a function or global variable.
+func (g *generator) symbol(name string) string {
+	if g.darwin {
+		return "_" + name
+	}
+	g.checkSymbol(name)
+	return name
+}
+
+// localLabel returns the name of an assembler-local label with a prefix and
+// number, or without a number if it is negative.
+func (g *generator) localLabel(prefix string, n int) string {
+	label := ".L" + prefix
+	if g.darwin {
+		label = "L" + prefix
+	}
+	if n >= 0 {
+		label += fmt.Sprint(n)
+	}
+	return label
+}
+
+// align emits a directive which aligns the next label to n bytes, which on
+// Darwin is given as a power of two.
+func (g *generator) align(n int) {
+	if !g.darwin {
+		g.directive(".align %d", n)
+		return
+	}
+	shift := 0
+	for 1<<uint(shift) < n {
+		shift++
+	}
+	g.directive(".p2align %d", shift)
+}
+
+// labelName returns the assembly name of a label.
+func (g *generator) labelName(l *ir.Label) string {
+	return g.names.Name(l)
+}
+
+func (g *generator) program(program *ir.Program) {
+	g.defined = make(map[string]*ir.Function)
+	for _, f := range program.Functions {
+		g.defined[f.Name] = f
+	}
+	// The GNU assembler ignores the declarations of the symbols which are
+	// defined elsewhere, since every undefined symbol is global, but they
+	// document the object's dependencies.
+	if !g.darwin {
+		for _, name := range g.externs(program) {
+			g.directive(".extern %s", name)
+		}
+	}
+	g.directive(".text")
+	if g.debug != nil {
+		g.label(".Ltext0")
+	}
+	for _, f := range program.Functions {
+		g.function(f)
+	}
+	if g.debug != nil {
+		g.label(".Letext0")
+	}
+	if g.darwin {
+		g.jumpTables()
+	}
+	g.globals(program.Globals)
+	if g.darwin {
+		// String literals are in the section of C strings, whose identical
+		// strings the linker merges.
+		if len(program.Strings) > 0 {
+			g.directive(".section __TEXT,__cstring,cstring_literals")
+		}
+		g.strings(program.Strings)
+		if len(g.constants) > 0 {
+			g.directive(".section __TEXT,__const")
+		}
+		g.constantPool()
+		return
+	}
+	if len(program.Strings) > 0 || len(g.constants) > 0 || len(g.tables) > 0 {
+		g.directive(".section .rodata")
+	}
+	g.strings(program.Strings)
+	g.constantPool()
+	g.jumpTables()
+	if g.debug != nil {
+		g.debugSections()
+	}
+	// Mark the stack as non-executable.
+	g.directive(".section .note.GNU-stack,\"\",@progbits")
+}
+
+// externs returns the names of the functions which a program calls but does
+// not define, in order of their first call, followed by those of the global
+// variables which it declares but does not define.
+func (g *generator) externs(program *ir.Program) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, f := range program.Functions {
+		for _, instr := range f.Instrs {
+			c, ok := instr.(*ir.Call)
+			if ok && g.defined[c.Function] == nil && !seen[c.Function] {
+				seen[c.Function] = true
+				names = append(names, c.Function)
+			}
+		}
+	}
+	for _, v := range program.Globals {
+		if v.Extern {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+// strings emits the string literals of the program.
+func (g *generator) strings(strings []*ir.Global) {
+	for _, s := range strings {
+		g.label(g.globalName(s))
+		// The directive appends the terminating NUL.
+		if g.darwin {
+			g.directive(".asciz %s", ast.Quote(s.Data[:len(s.Data)-1], '"'))
+		} else {
+			g.directive(".string %s", ast.Quote(s.Data[:len(s.Data)-1], '"'))
+		}
+	}
+}
+
+// constantPool emits the floating-point constants of the program.
+func (g *generator) constantPool() {
+	for _, c := range g.constants {
+		if c.value.Type() == types.Float {
+			g.align(4)
+			g.label(c.label)
+			g.directive(".long %#x", math.Float32bits(float32(c.value.Value)))
+		} else {
+			g.align(8)
+			g.label(c.label)
+			g.directive(".quad %#x", math.Float64bits(c.value.Value))
+		}
+	}
+}
+
+// globals emits the globals which have an initial value to the data section,
+// and the others to the zero-initialized bss section, each aligned to its
+// type. Those which are extern are defined elsewhere.
+func (g *generator) globals(globals []*ir.Global) {
+	var data, bss []*ir.Global
+	for _, v := range globals {
+		switch {
+		case v.Extern:
+		case v.Init != nil:
+			data = append(data, v)
+		default:
+			bss = append(bss, v)
+		}
+	}
+	if len(data) > 0 {
+		g.directive(".data")
+	}
+	for _, v := range data {
+		g.globalLabel(v)
+		switch init := v.Init.(type) {
+		case *ir.FloatConst:
+			if v.Type == types.Float {
+				g.directive(".long %#x", math.Float32bits(float32(init.Value)))
+			} else {
+				g.directive(".quad %#x", math.Float64bits(init.Value))
+			}
+		case *ir.IntConst:
+			g.directive("%s %d", dataDirectives[types.LP64.Sizeof(v.Type)], init.Value)
+		}
+	}
+	if len(bss) > 0 {
+		if g.darwin {
+			g.directive(".section __DATA,__bss")
+		} else {
+			g.directive(".bss")
+		}
+	}
+	for _, v := range bss {
+		g.globalLabel(v)
+		g.directive(".zero %d", types.LP64.Sizeof(v.Type))
+	}
+}
+
+// The data directive of an integer of each size.
+var dataDirectives = map[int]string{1: ".byte", 2: ".short", 4: ".long", 8: ".quad"}
+
+// globalName returns the assembly name of a global: its symbol if it is a
+// variable, or a local label if it is a string literal.
+func (g *generator) globalName(v *ir.Global) string {
+	if v.Data != "" {
+		return g.localLabel(v.Name, -1)
+	}
+	return g.symbol(v.Name)
+}
+
+// globalLabel emits the aligned label of a global, which is visible to other
+// objects unless it is static.
+func (g *generator) globalLabel(v *ir.Global) {
+	name := g.symbol(v.Name)
+	if !v.Static {
+		g.directive(".globl %s", name)
+	}
+	g.align(types.LP64.Alignof(v.Type))
+	g.label(name)
+}
+
+func (g *generator) function(f *ir.Function) {
+	g.pos = f.Pos
+	defer func() { g.pos = token.Position{} }()
+	name := g.symbol(f.Name)
+	if !f.Static {
+		g.directive(".globl %s", name)
+	}
+	g.label(name)
+	g.names.Function(f)
+	g.startFunction(f)
+	g.emit("pushq", rbp)
+	g.cfi(".cfi_def_cfa_offset 16")
+	g.cfi(".cfi_offset %%rbp, -16")
+	g.emit("movq", rsp, rbp)
+	g.cfi(".cfi_def_cfa_register %%rbp")
+
+	liveness := ir.AnalyzeLiveness(f)
+	g.tailCalls = make(map[*ir.Call]bool)
+	if !g.noTailCalls {
+		g.tailCalls = ir.TailCalls(f)
+	}
+	g.registers = make(map[*ir.Temp]register)
+	if !g.noRegalloc {
+		g.registers = allocateRegisters(f, liveness)
+	}
+	frameSize := g.layoutFrame(f, liveness)
+	if frameSize > 0 {
+		g.emit("subq", Imm(frameSize), rsp)
+	}
+	for i, r := range g.saved {
+		g.emit("movq", r.quad, memory(g.saveOffsets[i], rbp))
+	}
+	if g.sanitizeStack {
+		g.canaryFail = g.localLabel("stack_chk_fail_"+f.Name, -1)
+		g.loadStackGuard(rax)
+		g.emit("movq", rax, memory(g.canaryOffset, rbp))
+	}
+	if g.trapOverflow {
+		g.overflowTrap = g.localLabel("overflow_"+f.Name, -1)
+	}
+	g.moveParams(f)
+
+	for i, instr := range f.Instrs {
+		var next ir.Instr
+		if i+1 < len(f.Instrs) {
+			next = f.Instrs[i+1]
+		}
+		if _, ok := instr.(*ir.Label); !ok {
+			g.loc(f.Position(i))
+		}
+		if pos := f.Position(i); pos.IsValid() {
+			g.pos = pos
+		}
+		g.instr(instr, next)
+	}
+	if g.sanitizeStack {
+		g.label(g.canaryFail)
+		g.emit("call", g.callee("__stack_chk_fail"))
+	}
+	if g.trapOverflow {
+		g.label(g.overflowTrap)
+		g.emit("ud2")
+	}
+	g.endFunction(f)
+}
+
+// uses returns whether a register is assigned to any temporary of the current
+// function.
+func (g *generator) uses(r register) bool {
+	for _, assigned := range g.registers {
+		if assigned == r {
+			return true
+		}
+	}
+	return false
+}
+
+// sse returns the suffix of the scalar SSE instructions for a floating-point
+// type: "ss" for float, or "sd" for double.
+func sse(t types.Type) string {
+	if t == types.Float {
+		return "ss"
+	}
+	return "sd"
+}
+
+// isQuad returns whether a value of type t is held in a 64-bit register: a
+// pointer or a long. Narrower integers are held in 32 bits, extended with
+// their sign unless they are unsigned, and an unsigned int is held
+// zero-extended to 64 bits, as the 32-bit moves which load it leave it.
+func isQuad(t types.Type) bool {
+	return types.IsPointer(t) || types.IsInteger(t) && types.Width(t) == 64
+}
+
+// integer returns the suffix of the integer instructions for a value of type
+// t: "q" for a pointer or a long, which are 64 bits, or else "l".
+func integer(t types.Type) string {
+	if isQuad(t) {
+		return "q"
+	}
+	return "l"
+}
+
+// sized returns the name of a register for a value of type t, which is the
+// 64-bit name for a pointer or a long.
+func (r register) sized(t types.Type) Reg {
+	if isQuad(t) {
+		return r.quad
+	}
+	return r.name
+}
+
+// load moves a value to a register: %eax or %ecx for integers, %rax or %rcx
+// for pointers, or %xmm0 or %xmm1 for floating-point values, according to
+// whether it is the first or second operand.
+func (g *generator) load(v ir.Value, second bool) {
+	t := v.Type()
+	if types.IsFloating(t) {
+		reg := xmm0
+		if second {
+			reg = xmm1
+		}
+		switch v := v.(type) {
+		case *ir.Temp:
+			if r, ok := g.registers[v]; ok {
+				g.emit("movaps", r.name, reg)
+			} else {
+				g.emit("mov"+sse(t), memory(g.offsets[v], rbp), reg)
+			}
+		case *ir.FloatConst:
+			c := constant{label: g.localLabel("C", len(g.constants)), value: v}
+			g.constants = append(g.constants, c)
+			g.emit("mov"+sse(t), ripRelative(c.label), reg)
+		default:
+			g.errorf("invalid operand %v", v)
+		}
+		return
+	}
+	reg := scratch(t)
+	if second {
+		reg = scratch2(t)
+	}
+	switch v := v.(type) {
+	case *ir.Temp:
+		if r, ok := g.registers[v]; ok {
+			g.emit("mov"+integer(t), r.sized(t), reg)
+		} else {
+			g.emit("mov"+integer(t), memory(g.offsets[v], rbp), reg)
+		}
+	case *ir.IntConst:
+		if isQuad(t) {
+			g.emit("movq", Imm(v.Value), reg)
+		} else {
+			g.emit("movl", Imm(int32(v.Value)), reg)
+		}
+	default:
+		g.errorf("invalid operand %v", v)
+	}
+}
+
+// store moves the result in %eax, %rax or %xmm0 to the location of a
+// temporary.
+func (g *generator) store(t *ir.Temp) {
+	r, ok := g.registers[t]
+	switch {
+	case ok && types.IsFloating(t.Type()):
+		g.emit("movaps", xmm0, r.name)
+	case ok:
+		g.emit("mov"+integer(t.Type()), scratch(t.Type()), r.sized(t.Type()))
+	case types.IsFloating(t.Type()):
+		g.emit("mov"+sse(t.Type()), xmm0, memory(g.offsets[t], rbp))
+	default:
+		g.emit("mov"+integer(t.Type()), scratch(t.Type()), memory(g.offsets[t], rbp))
+	}
+}
+
+// globalAddr loads the address of a global to %rax. That of a global variable
+// which is not static in position-independent code on Linux is in the global
+// offset table, and the others are relative to the instruction.
+func (g *generator) globalAddr(v *ir.Global) {
+	if g.pic && !g.darwin && v.Data == "" && !v.Static {
+		g.emit("movq", ripRelative(g.globalName(v)+"@GOTPCREL"), rax)
+		return
+	}
+	g.emit("leaq", ripRelative(g.globalName(v)), rax)
+}
+
+// loadStackGuard loads the guard value of the C library to a register.
+func (g *generator) loadStackGuard(r Reg) {
+	if g.darwin {
+		g.emit("movq", darwinStackGuard, r)
+		g.emit("movq", memory(0, r), r)
+		return
+	}
+	g.emit("movq", stackGuard, r)
+}
+
+// epilogue returns from the function. Code may follow it, so the call frame
+// information of the function body is restored after it.
+func (g *generator) epilogue() {
+	// The result is in %rax or %xmm0, so the canary is checked in %rcx.
+	g.leave(rcx)
+	g.emit("ret")
+	g.cfi(".cfi_restore_state")
+}
+
+// leave frees the frame of the function and restores the registers which it
+// saved, checking the stack canary in a scratch register if the stack is
+// sanitized, so that the return address is at the top of the stack. The
+// call frame information of the function body is remembered first.
+func (g *generator) leave(scratch Reg) {
+	g.cfi(".cfi_remember_state")
+	if g.sanitizeStack {
+		if g.darwin {
+			g.loadStackGuard(scratch)
+			g.emit("xorq", memory(g.canaryOffset, rbp), scratch)
+		} else {
+			g.emit("movq", memory(g.canaryOffset, rbp), scratch)
+			g.emit("xorq", stackGuard, scratch)
+		}
+		g.emit("jne", Sym(g.canaryFail))
+	}
+	for i, r := range g.saved {
+		g.emit("movq", memory(g.saveOffsets[i], rbp), r.quad)
+	}
+	g.emit("movq", rbp, rsp)
+	g.emit("popq", rbp)
+	g.cfi(".cfi_def_cfa %%rsp, 8")
+}
+
+// instr emits an instruction. The instruction which follows it, if any, is
+// used to avoid jumps to the next instruction.
+func (g *generator) instr(instr ir.Instr, next ir.Instr) {
+	switch i := instr.(type) {
+	case *ir.Copy:
+		g.load(i.Src, false)
+		g.store(i.Dst)
+	case *ir.Unary:
+		g.load(i.Src, false)
+		g.unary(i)
+		g.store(i.Dst)
+	case *ir.Binary:
+		g.load(i.Lhs, false)
+		g.load(i.Rhs, true)
+		g.binary(i)
+		g.store(i.Dst)
+	case *ir.Convert:
+		g.load(i.Src, false)
+		g.convert(i.Src.Type(), i.Dst.Type())
+		g.store(i.Dst)
+	case *ir.Select:
+		g.selectInstr(i)
+	case *ir.Addr:
+		g.emit("leaq", memory(g.slotOffsets[i.Slot], rbp), rax)
+		g.store(i.Dst)
+	case *ir.GlobalAddr:
+		g.globalAddr(i.Global)
+		g.store(i.Dst)
+	case *ir.Load:
+		g.load(i.Addr, false)
+		if op, ok := extensions[i.Dst.Type()]; ok {
+			g.emit(op, Mem{Base: rax}, eax)
+		} else {
+			g.move(i.Dst.Type(), memory(0, rax), scratch(i.Dst.Type()))
+		}
+		g.store(i.Dst)
+	case *ir.Store:
+		g.load(i.Addr, false)
+		g.load(i.Src, true)
+		switch types.LP64.Sizeof(i.Src.Type()) {
+		case 1:
+			g.emit("movb", cl, Mem{Base: rax})
+		case 2:
+			g.emit("movw", cx, Mem{Base: rax})
+		default:
+			g.move(i.Src.Type(), scratch2(i.Src.Type()), memory(0, rax))
+		}
+	case *ir.PtrAdd:
+		g.load(i.Ptr, false)
+		g.load(i.Index, true)
+		g.ptrAdd(i.Ptr.Type().(*types.Pointer).Elem, i.Index.Type())
+		g.store(i.Dst)
+	case *ir.FieldAddr:
+		g.load(i.Ptr, false)
+		s := i.Ptr.Type().(*types.Pointer).Elem.(*types.Struct)
+		if offset := types.LP64.Offsetof(s, i.Field); offset != 0 {
+			g.emit("addq", Imm(offset), rax)
+		}
+		g.store(i.Dst)
+	case *ir.PtrDiff:
+		g.load(i.Lhs, false)
+		g.load(i.Rhs, true)
+		g.ptrDiff(i.Lhs.Type().(*types.Pointer).Elem)
+		g.store(i.Dst)
+	case *ir.Label:
+		g.label(g.labelName(i))
+	case *ir.Jump:
+		if next != ir.Instr(i.Target) {
+			g.emit("jmp", Sym(g.labelName(i.Target)))
+		}
+	case *ir.Branch:
+		g.load(i.Cond, false)
+		g.emit("cmpl", Imm(0), eax)
+		if next == ir.Instr(i.True) {
+			g.emit("je", Sym(g.labelName(i.False)))
+			return
+		}
+		g.emit("jne", Sym(g.labelName(i.True)))
+		if next != ir.Instr(i.False) {
+			g.emit("jmp", Sym(g.labelName(i.False)))
+		}
+	case *ir.Switch:
+		g.switchInstr(i, next)
+	case *ir.Call:
+		g.call(i)
+	case *ir.Return:
+		g.load(i.Value, false)
+		g.epilogue()
+	default:
+		g.errorf("unsupported instruction %v", instr)
+	}
+}
+
+// selectInstr emits a conditional move. Loading the operands does not affect
+// the flags set by the comparison of the condition.
+func (g *generator) selectInstr(i *ir.Select) {
+	if types.IsFloating(i.Dst.Type()) {
+		g.errorf("unsupported instruction %v", i)
+		return
+	}
+	t := i.Dst.Type()
+	g.load(i.Cond, false)
+	g.emit("cmpl", Imm(0), eax)
+	g.load(i.False, false)
+	g.load(i.True, true)
+	g.emit("cmovne", scratch2(t), scratch(t))
+	g.store(i.Dst)
+}
+
+// ptrAdd adds the integer index in %ecx or %rcx, scaled by the size of elem,
+// to the pointer in %rax. An unsigned index narrower than a long was loaded
+// by a 32-bit move, which zero-extends it to %rcx, and a signed one is
+// sign-extended.
+func (g *generator) ptrAdd(elem, index types.Type) {
+	if !types.IsUnsigned(index) && !isQuad(index) {
+		g.emit("movslq", ecx, rcx)
+	}
+	switch size := types.LP64.Sizeof(elem); size {
+	case 1, 2, 4, 8:
+		g.emit("leaq", Mem{Base: rax, Index: rcx, Scale: size}, rax)
+	default:
+		g.emit("imulq", Imm(size), rcx)
+		g.emit("addq", rcx, rax)
+	}
+}
+
+// ptrDiff leaves in %eax the number of elements of type elem between the
+// pointers in %rax and %rcx. The difference in bytes is an exact multiple of
+// the size.
+func (g *generator) ptrDiff(elem types.Type) {
+	g.emit("subq", rcx, rax)
+	size := types.LP64.Sizeof(elem)
+	if size&(size-1) == 0 {
+		shift := 0
+		for 1<<uint(shift) < size {
+			shift++
+		}
+		if shift > 0 {
+			g.emit("sarq", Imm(shift), rax)
+		}
+		return
+	}
+	g.emit("movq", Imm(size), rcx)
+	g.emit("cqto")
+	g.emit("idivq", rcx)
+}
+
+func (g *generator) unary(i *ir.Unary) {
+	t := i.Src.Type()
+	switch {
+	case i.Op == ir.Neg && t == types.Float:
+		// Flip the sign bit.
+		g.emit("movd", xmm0, eax)
+		g.emit("btcl", Imm(31), eax)
+		g.emit("movd", eax, xmm0)
+	case i.Op == ir.Neg && t == types.Double:
+		g.emit("movq", xmm0, rax)
+		g.emit("btcq", Imm(63), rax)
+		g.emit("movq", rax, xmm0)
+	case i.Op == ir.Neg && types.IsInteger(t):
+		g.emit("neg"+integer(t), scratch(t))
+		g.checkOverflow(t)
+	case i.Op == ir.Not && types.IsInteger(t):
+		g.emit("not"+integer(t), scratch(t))
+	default:
+		g.errorf("unsupported instruction %v", i)
+	}
+}
+
+// checkOverflow jumps to the overflow trap if the arithmetic just emitted on
+// values of type t overflowed, and overflow of ints and longs is trapped.
+func (g *generator) checkOverflow(t types.Type) {
+	if g.trapOverflow && (t == types.Int || t == types.Long) {
+		g.emit("jo", Sym(g.overflowTrap))
+	}
+}
+
+// The set instruction used to materialize the result of each integer
+// comparison.
+var comparisonSet = map[ir.Op]string{
+	ir.Eq: "sete",
+	ir.Ne: "setne",
+	ir.Lt: "setl",
+	ir.Le: "setle",
+	ir.Gt: "setg",
+	ir.Ge: "setge",
+}
+
+// The set instruction used to materialize the result of each comparison of
+// unsigned integers or of pointers, which are unsigned.
+var unsignedSet = map[ir.Op]string{
+	ir.Eq: "sete",
+	ir.Ne: "setne",
+	ir.Lt: "setb",
+	ir.Le: "setbe",
+	ir.Gt: "seta",
+	ir.Ge: "setae",
+}
+
+// The SSE instruction for each floating-point arithmetic operator, without its
+// precision suffix.
+var floatArithmetic = map[ir.Op]string{
+	ir.Add: "add",
+	ir.Sub: "sub",
+	ir.Mul: "mul",
+	ir.Div: "div",
+}
+
+func (g *generator) binary(i *ir.Binary) {
+	t := i.Lhs.Type()
+	if types.IsFloating(t) {
+		if i.Op.IsComparison() {
+			g.floatComparison(i.Op, t)
+		} else if op, ok := floatArithmetic[i.Op]; ok {
+			g.emit(op+sse(t), xmm1, xmm0)
+		} else {
+			g.errorf("unsupported instruction %v", i)
+		}
+		return
+	}
+
+	if set, ok := comparisonSet[i.Op]; ok {
+		if types.IsPointer(t) || types.IsUnsigned(t) {
+			set = unsignedSet[i.Op]
+		}
+		g.emit("cmp"+integer(t), scratch2(t), scratch(t))
+		g.emit("movl", Imm(0), eax)
+		g.emit(set, al)
+		return
+	}
+	lhs, rhs, suffix := scratch(t), scratch2(t), integer(t)
+	switch i.Op {
+	case ir.Add:
+		g.emit("add"+suffix, rhs, lhs)
+		g.checkOverflow(t)
+	case ir.Sub:
+		g.emit("sub"+suffix, rhs, lhs)
+		g.checkOverflow(t)
+	case ir.Mul:
+		g.emit("imul"+suffix, rhs, lhs)
+		g.checkOverflow(t)
+	case ir.Div:
+		g.divide(t)
+	case ir.Rem:
+		// The remainder of a division is left in %edx or %rdx.
+		g.divide(t)
+		if isQuad(t) {
+			g.emit("movq", rdx, rax)
+		} else {
+			g.emit("movl", edx, eax)
+		}
+	case ir.And:
+		g.emit("and"+suffix, rhs, lhs)
+	case ir.Or:
+		g.emit("or"+suffix, rhs, lhs)
+	case ir.Xor:
+		g.emit("xor"+suffix, rhs, lhs)
+	case ir.Shl:
+		// The count of a shift must be in %cl.
+		g.emit("sal"+suffix, cl, lhs)
+	case ir.Shr:
+		// That of an unsigned integer is a logical shift.
+		if types.IsUnsigned(t) {
+			g.emit("shr"+suffix, cl, lhs)
+		} else {
+			g.emit("sar"+suffix, cl, lhs)
+		}
+	default:
+		g.errorf("unsupported instruction %v", i)
+	}
+}
+
+// divide divides %eax by %ecx, or %rax by %rcx for longs, leaving the
+// quotient in %eax or %rax and the remainder in %edx or %rdx. The dividend
+// is extended to %edx or %rdx, with its sign unless it is unsigned.
+func (g *generator) divide(t types.Type) {
+	switch {
+	case types.IsUnsigned(t):
+		g.emit("xorl", edx, edx)
+		g.emit("div"+integer(t), scratch2(t))
+	case isQuad(t):
+		g.emit("cqto")
+		g.emit("idivq", rcx)
+	default:
+		g.emit("cltd")
+		g.emit("idivl", ecx)
+	}
+}
+
+// floatComparison compares %xmm0 with %xmm1, leaving 0 or 1 in %eax. If
+// either operand is NaN, only Ne is true.
+func (g *generator) floatComparison(op ir.Op, t types.Type) {
+	ucomis := "ucomi" + sse(t)
+	switch op {
+	case ir.Eq:
+		// An unordered result sets the parity flag.
+		g.emit(ucomis, xmm1, xmm0)
+		g.emit("movl", Imm(0), eax)
+		g.emit("movl", Imm(0), ecx)
+		g.emit("sete", al)
+		g.emit("setnp", cl)
+		g.emit("andl", ecx, eax)
+	case ir.Ne:
+		g.emit(ucomis, xmm1, xmm0)
+		g.emit("movl", Imm(0), eax)
+		g.emit("movl", Imm(0), ecx)
+		g.emit("setne", al)
+		g.emit("setp", cl)
+		g.emit("orl", ecx, eax)
+	case ir.Lt, ir.Le:
+		// An unordered result sets the carry flag, so compare the operands in
+		// reverse to test for "above" rather than "below".
+		g.emit(ucomis, xmm0, xmm1)
+		g.emit("movl", Imm(0), eax)
+		if op == ir.Lt {
+			g.emit("seta", al)
+		} else {
+			g.emit("setae", al)
+		}
+	case ir.Gt, ir.Ge:
+		g.emit(ucomis, xmm1, xmm0)
+		g.emit("movl", Imm(0), eax)
+		if op == ir.Gt {
+			g.emit("seta", al)
+		} else {
+			g.emit("setae", al)
+		}
+	}
+}
+
+// The instruction which loads each integer type narrower than an int from
+// memory, or extends it from the low bits of a register, to 32 bits.
+var extensions = map[types.Type]string{
+	types.Char:          "movsbl",
+	types.UnsignedChar:  "movzbl",
+	types.Short:         "movswl",
+	types.UnsignedShort: "movzwl",
+}
+
+// The low parts of %eax, by the size of an integer narrower than an int.
+var lowParts = map[int]Reg{1: al, 2: ax}
+
+// convert converts the value in %eax, %rax or %xmm0 between arithmetic types,
+// or between an integer and a pointer. Conversions from floating-point to
+// integer types truncate towards zero, through an int, or through a long for
+// unsigned ints and longs, as consteval.FloatToInt does. Those to an integer
+// type keep the low bits of the result, which are extended if it is narrower
+// than an int, and a conversion to a wider integer type or a pointer
+// extends a signed value. An unsigned int is converted to and from
+// floating-point types as a long, and an unsigned long by halving it if it
+// is too large for a long.
+func (g *generator) convert(from, to types.Type) {
+	if from == to {
+		return
+	}
+	switch {
+	case (types.IsInteger(from) || types.IsPointer(from)) && (types.IsInteger(to) || types.IsPointer(to)):
+		if isQuad(to) && !isQuad(from) && !types.IsUnsigned(from) {
+			g.emit("movslq", eax, rax)
+		}
+	case from == types.UnsignedLong && types.IsFloating(to):
+		g.unsignedLongToFloat(to)
+	case types.IsUnsigned(from) && types.IsFloating(to) || isQuad(from) && types.IsFloating(to):
+		g.emit("cvtsi2"+sse(to)+"q", rax, xmm0)
+	case types.IsInteger(from) && types.IsFloating(to):
+		g.emit("cvtsi2"+sse(to)+"l", eax, xmm0)
+	case types.IsFloating(from) && to == types.UnsignedLong:
+		g.floatToUnsignedLong(from)
+	case types.IsFloating(from) && (to == types.UnsignedInt || isQuad(to)):
+		g.emit("cvtt"+sse(from)+"2si", xmm0, rax)
+	case types.IsFloating(from) && types.IsInteger(to):
+		g.emit("cvtt"+sse(from)+"2si", xmm0, eax)
+	case types.IsFloating(from) && types.IsFloating(to):
+		g.emit("cvt"+sse(from)+"2"+sse(to), xmm0, xmm0)
+	default:
+		g.errorf("unsupported conversion from %v to %v", from, to)
+		return
+	}
+	switch {
+	case extensions[to] != "":
+		g.emit(extensions[to], lowParts[types.LP64.Sizeof(to)], eax)
+	case to == types.UnsignedInt && (isQuad(from) || types.IsFloating(from)):
+		// A 32-bit move zero-extends the result.
+		g.emit("movl", eax, eax)
+	}
+}
+
+// unsignedLongToFloat converts the unsigned long in %rax to a floating-point
+// type in %xmm0. One which is too large for a long is halved, keeping its
+// low bit so that it rounds the same, and the result doubled.
+func (g *generator) unsignedLongToFloat(to types.Type) {
+	large, done := g.localLabel("U", g.conversionLabels), g.localLabel("U", g.conversionLabels+1)
+	g.conversionLabels += 2
+	g.emit("testq", rax, rax)
+	g.emit("js", Sym(large))
+	g.emit("cvtsi2"+sse(to)+"q", rax, xmm0)
+	g.emit("jmp", Sym(done))
+	g.label(large)
+	g.emit("movq", rax, rcx)
+	g.emit("shrq", Imm(1), rcx)
+	g.emit("andl", Imm(1), eax)
+	g.emit("orq", rcx, rax)
+	g.emit("cvtsi2"+sse(to)+"q", rax, xmm0)
+	g.emit("add"+sse(to), xmm0, xmm0)
+	g.label(done)
+}
+
+// floatToUnsignedLong converts the floating-point value in %xmm0 to an
+// unsigned long in %rax. One which is too large for a long has 2 to the
+// power of 63 subtracted from it before it is converted, and the top bit of
+// the result set.
+func (g *generator) floatToUnsignedLong(from types.Type) {
+	large, done := g.localLabel("U", g.conversionLabels), g.localLabel("U", g.conversionLabels+1)
+	g.conversionLabels += 2
+	g.load(ir.NewFloat(math.Ldexp(1, 63), from), true)
+	g.emit("ucomi"+sse(from), xmm1, xmm0)
+	g.emit("jae", Sym(large))
+	g.emit("cvtt"+sse(from)+"2si", xmm0, rax)
+	g.emit("jmp", Sym(done))
+	g.label(large)
+	g.emit("sub"+sse(from), xmm1, xmm0)
+	g.emit("cvtt"+sse(from)+"2si", xmm0, rax)
+	g.emit("btcq", Imm(63), rax)
+	g.label(done)
+}
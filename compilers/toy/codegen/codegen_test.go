@@ -0,0 +1,595 @@
+package codegen
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// lower compiles a program to IR.
+func lower(t *testing.T, input string) *ir.Program {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	lowered, err := ir.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lowered
+}
+
+// generate compiles a program to assembly.
+func generate(t *testing.T, input string, options ...Option) string {
+	var b bytes.Buffer
+	if err := Generate(&b, lower(t, input), options...); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestGenerateReturn(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`	.text
+	.globl main
+main:
+	pushq %rbp
+	movq %rsp, %rbp
+	movl $2, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.section .note.GNU-stack,"",@progbits
+`, generate(t, "int main() { return 2; }", NoRegisterAllocation))
+}
+
+// The tests of instruction selection keep every temporary on the stack, so
+// that the operands are easily identified.
+
+func TestGenerateUnaryOps(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { return -~!5; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl $5, %eax
+	movl $0, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	sete %al
+	movl %eax, -8(%rbp)
+	movl -8(%rbp), %eax
+	notl %eax
+	movl %eax, -16(%rbp)
+	movl -16(%rbp), %eax
+	negl %eax
+	movl %eax, -24(%rbp)
+`)
+}
+
+func TestGenerateBinaryOp(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { return 7 - 3; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl $7, %eax
+	movl $3, %ecx
+	subl %ecx, %eax
+	movl %eax, -8(%rbp)
+	movl -8(%rbp), %eax
+`)
+}
+
+func TestGenerateTrapOverflow(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a, char c) { return -(a * a + 1) - c; }", NoRegisterAllocation, TrapOverflow)
+	// Each int operation which may overflow jumps to the trap if it does.
+	for _, op := range []string{"imull %ecx, %eax", "addl %ecx, %eax", "negl %eax", "subl %ecx, %eax"} {
+		assert.Contains(asm, "\t"+op+"\n\tjo .Loverflow_f\n")
+	}
+	assert.Contains(asm, ".Loverflow_f:\n\tud2\n")
+	assert.NotContains(generate(t, "int f(int a) { return a + 1; }"), "jo")
+}
+
+func TestGenerateDivision(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { return 6 / 2; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tcltd\n\tidivl %ecx\n")
+}
+
+func TestGenerateRemainder(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { return a % 3; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl -8(%rbp), %eax
+	movl $3, %ecx
+	cltd
+	idivl %ecx
+	movl %edx, %eax
+`)
+}
+
+func TestGenerateShift(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a, int b) { return a << b; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl -8(%rbp), %eax
+	movl -16(%rbp), %ecx
+	sall %cl, %eax
+`)
+}
+
+func TestGenerateBitwiseAssignments(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a, int b) { a &= b; a |= b; a ^= b; a <<= b; a >>= b; return a; }",
+		NoRegisterAllocation)
+	for _, op := range []string{"andl %ecx, %eax", "orl %ecx, %eax", "xorl %ecx, %eax",
+		"sall %cl, %eax", "sarl %cl, %eax"} {
+		assert.Contains(asm, "\tmovl -8(%rbp), %eax\n\tmovl -16(%rbp), %ecx\n\t"+op+
+			"\n\tmovl %eax, -8(%rbp)\n")
+	}
+}
+
+func TestGenerateComparison(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { return 1 <= 2; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tcmpl %ecx, %eax\n\tmovl $0, %eax\n\tsetle %al\n")
+}
+
+func TestGenerateFrameIsAligned(t *testing.T) {
+	assert := assert.New(t)
+	// Three temporaries need 24 bytes, which is rounded up to 32.
+	asm := generate(t, "int main() { int a = 1; int b = 2; return a + b; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tmovq %rsp, %rbp\n\tsubq $32, %rsp\n")
+}
+
+func TestGenerateLogicalAndShortCircuits(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { return 0 && 2; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl $0, %eax
+	movl %eax, -8(%rbp)
+	movl $0, %eax
+	cmpl $0, %eax
+	je .Lmain.2
+.Lmain.1:
+	movl $2, %eax
+	movl $0, %ecx
+	cmpl %ecx, %eax
+	movl $0, %eax
+	setne %al
+	movl %eax, -8(%rbp)
+.Lmain.2:
+	movl -8(%rbp), %eax
+`)
+}
+
+func TestGenerateLogicalOrShortCircuits(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { return 1 || 2; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl $1, %eax
+	movl %eax, -8(%rbp)
+	movl $1, %eax
+	cmpl $0, %eax
+	jne .Lmain.2
+.Lmain.1:
+`)
+}
+
+func TestGenerateLogicalOrSkipsCall(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int g(); int main() { int a = 0; return a || g(); }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl -8(%rbp), %eax
+	cmpl $0, %eax
+	jne .Lmain.2
+.Lmain.1:
+	movl $0, %eax
+	call g@PLT
+`)
+}
+
+func TestGenerateLabelsAreUnique(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int foo() { return 1 || 2; } int main() { return 1 || 2 && 3; }", NoRegisterAllocation)
+	// The labels of each function are numbered from one, after its name.
+	for _, label := range []string{".Lfoo.1:", ".Lfoo.2:", ".Lmain.1:", ".Lmain.2:", ".Lmain.3:", ".Lmain.4:"} {
+		assert.Equal(1, strings.Count(asm, label), label)
+	}
+}
+
+func TestGenerateBranch(t *testing.T) {
+	assert := assert.New(t)
+	program := &ir.Program{}
+	f := &ir.Function{Name: "main", Result: types.Int}
+	program.Functions = append(program.Functions, f)
+	a := f.NewVariable("a", types.Int)
+	l1, l2, l3 := program.NewLabel(), program.NewLabel(), program.NewLabel()
+	f.Emit(&ir.Branch{Cond: a, True: l2, False: l3})
+	f.Emit(l1)
+	f.Emit(&ir.Jump{Target: l2})
+	f.Emit(l2)
+	f.Emit(&ir.Return{Value: a})
+	f.Emit(l3)
+	f.Emit(&ir.Return{Value: ir.NewInt(0, types.Int)})
+
+	var b bytes.Buffer
+	assert.Nil(Generate(&b, program, NoRegisterAllocation))
+	// A jump to the next instruction is omitted.
+	assert.Contains(b.String(), `	movl -8(%rbp), %eax
+	cmpl $0, %eax
+	jne .Lmain.2
+	jmp .Lmain.3
+.Lmain.1:
+.Lmain.2:
+`)
+}
+
+func TestGenerateIfElse(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { if (a) a = 2; else a = 3; return a; }",
+		NoRegisterAllocation)
+	assert.Contains(asm, `	movl -8(%rbp), %eax
+	cmpl $0, %eax
+	je .Lf.2
+.Lf.1:
+	movl $2, %eax
+	movl %eax, -8(%rbp)
+	jmp .Lf.3
+.Lf.2:
+	movl $3, %eax
+	movl %eax, -8(%rbp)
+.Lf.3:
+	movl -8(%rbp), %eax
+`)
+}
+
+func TestGenerateConditionalMove(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a, int b) { return a ? b : 3; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl -8(%rbp), %eax
+	cmpl $0, %eax
+	movl $3, %eax
+	movl -16(%rbp), %ecx
+	cmovne %ecx, %eax
+	movl %eax, -24(%rbp)
+`)
+}
+
+func TestGenerateLoop(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { while (a) a = a - 1; return a; }",
+		NoRegisterAllocation)
+	assert.Contains(asm, `.Lf.1:
+	movl -8(%rbp), %eax
+	cmpl $0, %eax
+	je .Lf.3
+.Lf.2:
+	movl -8(%rbp), %eax
+	movl $1, %ecx
+	subl %ecx, %eax
+	movl %eax, -16(%rbp)
+	movl -16(%rbp), %eax
+	movl %eax, -8(%rbp)
+	jmp .Lf.1
+.Lf.3:
+`)
+}
+
+func TestGenerateImplicitReturn(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int foo() { } int main() { return 1; }", NoRegisterAllocation)
+	assert.Contains(asm, `foo:
+	pushq %rbp
+	movq %rsp, %rbp
+	movl $0, %eax
+	movq %rbp, %rsp
+	popq %rbp
+	ret
+	.globl main
+`)
+}
+
+func TestGenerateLocalVariables(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 2; int b; b = a; return b; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movl $2, %eax
+	movl %eax, -8(%rbp)
+	movl -8(%rbp), %eax
+	movl %eax, -16(%rbp)
+	movl -16(%rbp), %eax
+`)
+}
+
+func TestGenerateShadowedVariable(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 1; { int a = 2; a = 3; } return a; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tmovl $3, %eax\n\tmovl %eax, -16(%rbp)\n")
+	assert.Contains(asm, "\tmovl -8(%rbp), %eax\n\tmovq %rbp, %rsp\n")
+}
+
+func TestGenerateUnsupportedInstruction(t *testing.T) {
+	assert := assert.New(t)
+	f := &ir.Function{Name: "main", Result: types.Double}
+	d := f.NewTemp(types.Double)
+	f.Emit(&ir.Unary{Op: ir.Not, Dst: d, Src: d})
+	f.Emit(&ir.Return{Value: d})
+	var b bytes.Buffer
+	err := Generate(&b, &ir.Program{Functions: []*ir.Function{f}})
+	assert.EqualError(err, "unsupported instruction %0:double = not %0")
+}
+
+func TestGenerateDoubleArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "double f() { return 1.5 * 2.0; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movsd .LC0(%rip), %xmm0
+	movsd .LC1(%rip), %xmm1
+	mulsd %xmm1, %xmm0
+	movsd %xmm0, -8(%rbp)
+`)
+	assert.Contains(asm, `	.section .rodata
+	.align 8
+.LC0:
+	.quad 0x3ff8000000000000
+	.align 8
+.LC1:
+	.quad 0x4000000000000000
+`)
+}
+
+func TestGenerateFloatVariables(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "float f() { float a = 0.5f; a = a - a; return a; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tmovss .LC0(%rip), %xmm0\n\tmovss %xmm0, -8(%rbp)\n")
+	assert.Contains(asm, "\tsubss %xmm1, %xmm0\n\tmovss %xmm0, -16(%rbp)\n")
+	assert.Contains(asm, "\tmovss -8(%rbp), %xmm0\n\tmovq %rbp, %rsp\n")
+	assert.Contains(asm, "\t.align 4\n.LC0:\n\t.long 0x3f000000\n")
+}
+
+func TestGenerateDoubleComparison(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { double a; return a < 1.0; }", NoRegisterAllocation)
+	// The operands are compared in reverse so that NaN compares false.
+	assert.Contains(asm, "\tucomisd %xmm0, %xmm1\n\tmovl $0, %eax\n\tseta %al\n")
+
+	asm = generate(t, "int main() { double a; return a == a; }", NoRegisterAllocation)
+	assert.Contains(asm, `	ucomisd %xmm1, %xmm0
+	movl $0, %eax
+	movl $0, %ecx
+	sete %al
+	setnp %cl
+	andl %ecx, %eax
+`)
+}
+
+func TestGenerateDoubleNegation(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "double f() { double a; return -a; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tmovq %xmm0, %rax\n\tbtcq $63, %rax\n"+
+		"\tmovq %rax, %xmm0\n")
+}
+
+func TestGenerateDoubleCondition(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { double a; return a && 1; }", NoRegisterAllocation)
+	assert.Contains(asm, `	movsd -8(%rbp), %xmm0
+	movsd .LC0(%rip), %xmm1
+	ucomisd %xmm1, %xmm0
+	movl $0, %eax
+	movl $0, %ecx
+	setne %al
+	setp %cl
+	orl %ecx, %eax
+`)
+	assert.Contains(asm, ".LC0:\n\t.quad 0x0\n")
+}
+
+func TestGenerateConversions(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { double d = 1; float f = d; return f; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tmovl $1, %eax\n\tcvtsi2sdl %eax, %xmm0\n")
+	assert.Contains(asm, "\tmovsd -8(%rbp), %xmm0\n\tcvtsd2ss %xmm0, %xmm0\n")
+	assert.Contains(asm, "\tmovss -24(%rbp), %xmm0\n\tcvttss2si %xmm0, %eax\n")
+
+	asm = generate(t, "float f() { return 1.5 + 2; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tmovl $2, %eax\n\tcvtsi2sdl %eax, %xmm0\n")
+	assert.Contains(asm, "\taddsd %xmm1, %xmm0\n")
+	assert.Contains(asm, "\tcvtsd2ss %xmm0, %xmm0\n")
+}
+
+func TestGenerateCasts(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int x, char *p) { int *q = (int *)x; return (char)x + (int)(p == (char *)q); }", NoRegisterAllocation)
+	assert.Contains(asm, "\tmovslq %eax, %rax\n")
+	assert.Contains(asm, "\tmovsbl %al, %eax\n")
+}
+
+func TestGenerateAddressOf(t *testing.T) {
+	assert := assert.New(t)
+	// The slot of a variable whose address is taken precedes the slots of
+	// temporaries. Pointers are 64 bits.
+	asm := generate(t, "int main() { int a = 1; int *p = &a; *p = 2; return *p; }",
+		NoRegisterAllocation)
+	assert.Contains(asm, `	leaq -8(%rbp), %rax
+	movq %rax, -16(%rbp)
+	movq -16(%rbp), %rax
+	movl $1, %ecx
+	movl %ecx, (%rax)
+`)
+	assert.Contains(asm, `	movq -24(%rbp), %rax
+	movl (%rax), %eax
+	movl %eax, -40(%rbp)
+`)
+}
+
+func TestGeneratePointerArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int *p, int i) { return (p + i) - p; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tmovq %rdi, -8(%rbp)\n\tmovl %esi, -16(%rbp)\n")
+	// The index is sign-extended and scaled by the size of an int.
+	assert.Contains(asm, "\tmovslq %ecx, %rcx\n\tleaq (%rax,%rcx,4), %rax\n")
+	assert.Contains(asm, "\tsubq %rcx, %rax\n\tsarq $2, %rax\n")
+}
+
+func TestGeneratePointerComparison(t *testing.T) {
+	assert := assert.New(t)
+	// Pointers are compared as unsigned.
+	asm := generate(t, "int f(int *p, int *q) { return p < q; }")
+	assert.Contains(asm, "\tcmpq %rcx, %rax\n\tmovl $0, %eax\n\tsetb %al\n")
+}
+
+func TestGenerateGlobals(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int a = 3; double d = 1.5; int b[3]; int main() { return a + b[1]; }")
+	assert.Contains(asm, "\t.data\n\t.globl a\n\t.align 4\na:\n\t.long 3\n"+
+		"\t.globl d\n\t.align 8\nd:\n\t.quad 0x3ff8000000000000\n")
+	assert.Contains(asm, "\t.bss\n\t.globl b\n\t.align 4\nb:\n\t.zero 12\n")
+	// Globals are addressed relative to the instruction pointer.
+	assert.Contains(asm, "\tleaq a(%rip), %rax\n")
+}
+
+func TestGenerateStrings(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int puts(char *s);
+int main() { puts("hi"); puts("a\tb"); return "hi"[1]; }`)
+	// Equal literals share a single copy in read-only data.
+	assert.Contains(asm, "\t.section .rodata\n.Lstr.0:\n\t.string \"hi\"\n.Lstr.1:\n\t.string \"a\\tb\"\n")
+	assert.NotContains(asm, ".Lstr.2")
+	assert.Contains(asm, "\tleaq .Lstr.0(%rip), %rax\n")
+}
+
+func TestGenerateDarwin(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int puts(char *s); int a; double d = 1.5;
+int f(int x) { switch (x) { case 0: return 1; case 1: return 2; case 2: return 3; case 3: return 4; } return 0; }
+int main() { puts("hi"); return f(a) * d * 2.0; }`, Darwin, SanitizeStack)
+	assert.Contains(asm, "\t.globl _main\n_main:\n")
+	assert.Contains(asm, "\tcall _puts\n")
+	assert.Contains(asm, "\tcall _f\n")
+	assert.Contains(asm, "\tleaq _a(%rip), %rax\n")
+	assert.Contains(asm, "\t.data\n\t.globl _d\n\t.p2align 3\n_d:\n")
+	assert.Contains(asm, "\t.section __DATA,__bss\n\t.globl _a\n\t.p2align 2\n_a:\n\t.zero 4\n")
+	assert.Contains(asm, "\t.section __TEXT,__cstring,cstring_literals\nLstr.0:\n\t.asciz \"hi\"\n")
+	assert.Contains(asm, "\t.section __TEXT,__const\n\t.p2align 3\nLC0:\n")
+	// The jump table is in the text section, before the data.
+	assert.Contains(asm, "\t.p2align 2\nLJT0:\n\t.long Lf.1-LJT0\n")
+	assert.True(strings.Index(asm, "LJT0:") < strings.Index(asm, "\t.data\n"))
+	// The stack guard is a global variable.
+	assert.Contains(asm, "\tmovq ___stack_chk_guard@GOTPCREL(%rip), %rax\n\tmovq (%rax), %rax\n")
+	assert.Contains(asm, "\tcall ___stack_chk_fail\n")
+	assert.NotContains(asm, "@PLT")
+	assert.NotContains(asm, ".L")
+	assert.NotContains(asm, ".note.GNU-stack")
+}
+
+func TestGenerateDarwinDebug(t *testing.T) {
+	var b bytes.Buffer
+	err := Generate(&b, &ir.Program{}, Darwin, Debug(Source{Filename: "a.c"}))
+	assert.EqualError(t, err, "debug information is not supported on Darwin")
+}
+
+func TestGeneratePIC(t *testing.T) {
+	assert := assert.New(t)
+	input := `int puts(char *s); int a;
+int f(int x) { return x; }
+int main() { puts("hi"); a = 2; return f(a) + 1; }`
+	asm := generate(t, input, PIC)
+	// Global variables are addressed through the global offset table, and
+	// every function is called through the procedure linkage table.
+	assert.Contains(asm, "\tmovq a@GOTPCREL(%rip), %rax\n")
+	assert.NotContains(asm, "\tleaq a(%rip)")
+	assert.Contains(asm, "\tcall puts@PLT\n")
+	assert.Contains(asm, "\tcall f@PLT\n")
+	// String literals are local, so are addressed directly.
+	assert.Contains(asm, "\tleaq .Lstr.0(%rip), %rax\n")
+
+	// Code for Darwin is always position-independent.
+	assert.Equal(generate(t, input, Darwin), generate(t, input, Darwin, PIC))
+}
+
+func TestGenerateLinkage(t *testing.T) {
+	assert := assert.New(t)
+	input := `int puts(char *s); extern int n; static int count; extern int total;
+static int f(int x) { return x; }
+int main() { puts("hi"); count = n; return f(count) + total; }
+int total = 1;`
+	asm := generate(t, input)
+	// The symbols which are defined elsewhere are declared, and those which
+	// are static are not global.
+	assert.True(strings.HasPrefix(asm, "\t.extern puts\n\t.extern n\n\t.text\n"), asm)
+	assert.Contains(asm, "\t.text\nf:\n")
+	assert.Contains(asm, "\t.globl main\nmain:\n")
+	assert.Contains(asm, "\t.data\n\t.globl total\n\t.align 4\ntotal:\n\t.long 1\n")
+	assert.Contains(asm, "\t.bss\n\t.align 4\ncount:\n\t.zero 4\n")
+	assert.NotContains(asm, "\nn:")
+
+	// Static symbols can't be replaced by those of another object, so are
+	// called and addressed directly in position-independent code.
+	asm = generate(t, input, PIC)
+	assert.Contains(asm, "\tleaq count(%rip), %rax\n")
+	assert.Contains(asm, "\tmovq n@GOTPCREL(%rip), %rax\n")
+	assert.Contains(asm, "\tcall f\n")
+	assert.Contains(asm, "\tcall puts@PLT\n")
+
+	// The Mach-O assembler has no declarations of undefined symbols.
+	assert.NotContains(generate(t, input, Darwin), ".extern")
+}
+
+func TestGenerateChars(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "char g = 'a'; int main() { char c = g; c++; g = c; return c; }")
+	assert.Contains(asm, "\t.globl g\n\t.align 1\ng:\n\t.byte 97\n")
+	// Chars are sign-extended when loaded, and truncated when stored.
+	assert.Contains(asm, "\tmovsbl (%rax), %eax\n")
+	assert.Contains(asm, "\tmovsbl %al, %eax\n")
+	assert.Contains(asm, "\tmovb %cl, (%rax)\n")
+}
+
+func TestGenerateUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(unsigned a, unsigned b, int *p) {
+  return a / b + a % b + (a >> b) + (a < b) + p[a];
+}`, NoRegisterAllocation)
+	// Unsigned division zero-extends the dividend, and a right shift is
+	// logical.
+	assert.Contains(asm, "\txorl %edx, %edx\n\tdivl %ecx\n")
+	assert.Contains(asm, "\tdivl %ecx\n\tmovl %edx, %eax\n")
+	assert.Contains(asm, "\tshrl %cl, %eax\n")
+	assert.Contains(asm, "\tcmpl %ecx, %eax\n\tmovl $0, %eax\n\tsetb %al\n")
+	// An unsigned index is already zero-extended.
+	assert.NotContains(asm, "movslq")
+
+	asm = generate(t, "unsigned f(double d) { return d + (unsigned)d; }", NoRegisterAllocation)
+	assert.Contains(asm, "\tcvttsd2si %xmm0, %rax\n")
+	assert.Contains(asm, "\tcvtsi2sdq %rax, %xmm0\n")
+}
+
+func TestGenerateIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `long f(long a, long b, short *s, unsigned short *u, int *p) {
+  *s = a;
+  *u = b;
+  return a / b + a % b + (a >> b) + -a + *s + *u + p[a];
+}`, NoRegisterAllocation)
+	// A long is held in a 64-bit register, and a short is extended to 32
+	// bits when it is loaded and truncated when it is stored.
+	assert.Contains(asm, "\tcqto\n\tidivq %rcx\n")
+	assert.Contains(asm, "\tidivq %rcx\n\tmovq %rdx, %rax\n")
+	assert.Contains(asm, "\tsarq %cl, %rax\n")
+	assert.Contains(asm, "\tnegq %rax\n")
+	assert.Contains(asm, "\tmovswl %ax, %eax\n")
+	assert.Contains(asm, "\tmovzwl %ax, %eax\n")
+	assert.Contains(asm, "\tmovw %cx, (%rax)\n")
+	assert.Contains(asm, "\tmovswl (%rax), %eax\n")
+	assert.Contains(asm, "\tmovzwl (%rax), %eax\n")
+	assert.Contains(asm, "\tleaq (%rax,%rcx,4), %rax\n")
+
+	asm = generate(t, "unsigned long x = -1; short y = -2; double f(unsigned long a) { return a; }",
+		NoRegisterAllocation)
+	assert.Contains(asm, "x:\n\t.quad -1\n")
+	assert.Contains(asm, "y:\n\t.short -2\n")
+	// An unsigned long too large for a long is halved before it is
+	// converted.
+	assert.Contains(asm, "\ttestq %rax, %rax\n\tjs .LU0\n\tcvtsi2sdq %rax, %xmm0\n")
+	assert.Contains(asm, "\tcvtsi2sdq %rax, %xmm0\n\taddsd %xmm0, %xmm0\n.LU1:\n")
+}
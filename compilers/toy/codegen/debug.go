@@ -0,0 +1,514 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"strings"
+)
+
+// The source of a program, for debug information.
+type Source struct {
+	Filename string // The name of the source file.
+	Dir      string // The directory it was compiled in, if the name is relative.
+	// Position returns the position in a source file which a position of the
+	// program came from, such as in a file which it includes, or is nil if
+	// the positions of the program are in the source file. A position whose
+	// filename is empty is in the source file.
+	Position func(token.Position) token.Position
+}
+
+// Debug is an Option which emits DWARF debug information: the source line of
+// each instruction, and the functions and their parameters and variables,
+// with their types and locations, so that the program can be debugged at the
+// level of its source, as in gdb. A temporary which is in a register is
+// described as being in it throughout its function, though the register is
+// shared with other temporaries where it is not live.
+func Debug(source Source) Option {
+	return func(g *generator) {
+		g.debug = &debugInfo{
+			source: source,
+			files:  make(map[string]int),
+			types:  make(map[types.Type]string),
+		}
+	}
+}
+
+// The debug information of a program, which is collected as its code is
+// generated, and then emitted.
+type debugInfo struct {
+	source Source
+	// The number of each file in the line table, and the file and line of
+	// the last .loc directive, or 0 at the start of a function.
+	files      map[string]int
+	file, line int
+	functions  []debugFunction
+	// The label of the entry of each type, and the types in the order that
+	// they were first used.
+	types     map[types.Type]string
+	typeOrder []types.Type
+}
+
+// A function and the locations of its variables.
+type debugFunction struct {
+	function  *ir.Function
+	end       string // The label after its last instruction.
+	params    []debugVariable
+	variables []debugVariable
+}
+
+// A named variable and its DWARF location expression.
+type debugVariable struct {
+	name     string
+	typ      types.Type
+	location []byte
+}
+
+// The DWARF constants which are used, from the DWARF 4 standard.
+const (
+	dwTagArrayType       = 0x01
+	dwTagFormalParameter = 0x05
+	dwTagMember          = 0x0d
+	dwTagPointerType     = 0x0f
+	dwTagCompileUnit     = 0x11
+	dwTagStructureType   = 0x13
+	dwTagSubrangeType    = 0x21
+	dwTagBaseType        = 0x24
+	dwTagSubprogram      = 0x2e
+	dwTagVariable        = 0x34
+
+	dwAtLocation           = 0x02
+	dwAtName               = 0x03
+	dwAtByteSize           = 0x0b
+	dwAtStmtList           = 0x10
+	dwAtLowPC              = 0x11
+	dwAtHighPC             = 0x12
+	dwAtLanguage           = 0x13
+	dwAtCompDir            = 0x1b
+	dwAtProducer           = 0x25
+	dwAtCount              = 0x37
+	dwAtDataMemberLocation = 0x38
+	dwAtDeclFile           = 0x3a
+	dwAtDeclLine           = 0x3b
+	dwAtDeclaration        = 0x3c
+	dwAtEncoding           = 0x3e
+	dwAtExternal           = 0x3f
+	dwAtFrameBase          = 0x40
+	dwAtType               = 0x49
+
+	dwFormAddr        = 0x01
+	dwFormData2       = 0x05
+	dwFormData4       = 0x06
+	dwFormData8       = 0x07
+	dwFormString      = 0x08
+	dwFormData1       = 0x0b
+	dwFormRef4        = 0x13
+	dwFormSecOffset   = 0x17
+	dwFormExprloc     = 0x18
+	dwFormFlagPresent = 0x19
+
+	dwAteFloat        = 0x04
+	dwAteSigned       = 0x05
+	dwAteSignedChar   = 0x06
+	dwAteUnsigned     = 0x07
+	dwAteUnsignedChar = 0x08
+
+	dwOpReg0  = 0x50
+	dwOpRegx  = 0x90
+	dwOpFbreg = 0x91
+
+	dwLangC99 = 0x0c
+)
+
+// An abbreviation, which declares the tag and attributes of entries.
+type abbrev struct {
+	tag      int
+	children bool
+	attrs    [][2]int // The name and form of each attribute.
+}
+
+// The abbreviations of the entries, by code.
+const (
+	abbrevCompileUnit = 1 + iota
+	abbrevSubprogram
+	abbrevParameter
+	abbrevVariable
+	abbrevBaseType
+	abbrevPointerType
+	abbrevArrayType
+	abbrevSubrangeType
+	abbrevStructType
+	abbrevIncompleteStructType
+	abbrevMember
+	abbrevStaticSubprogram
+)
+
+var abbrevs = map[int]abbrev{
+	abbrevCompileUnit: {dwTagCompileUnit, true, [][2]int{
+		{dwAtProducer, dwFormString}, {dwAtLanguage, dwFormData2},
+		{dwAtName, dwFormString}, {dwAtCompDir, dwFormString},
+		{dwAtLowPC, dwFormAddr}, {dwAtHighPC, dwFormData8},
+		{dwAtStmtList, dwFormSecOffset}}},
+	abbrevSubprogram: {dwTagSubprogram, true, [][2]int{
+		{dwAtName, dwFormString}, {dwAtDeclFile, dwFormData4},
+		{dwAtDeclLine, dwFormData4}, {dwAtType, dwFormRef4},
+		{dwAtExternal, dwFormFlagPresent}, {dwAtLowPC, dwFormAddr},
+		{dwAtHighPC, dwFormData8}, {dwAtFrameBase, dwFormExprloc}}},
+	abbrevParameter: {dwTagFormalParameter, false, [][2]int{
+		{dwAtName, dwFormString}, {dwAtType, dwFormRef4},
+		{dwAtLocation, dwFormExprloc}}},
+	abbrevVariable: {dwTagVariable, false, [][2]int{
+		{dwAtName, dwFormString}, {dwAtType, dwFormRef4},
+		{dwAtLocation, dwFormExprloc}}},
+	abbrevBaseType: {dwTagBaseType, false, [][2]int{
+		{dwAtName, dwFormString}, {dwAtEncoding, dwFormData1},
+		{dwAtByteSize, dwFormData1}}},
+	abbrevPointerType: {dwTagPointerType, false, [][2]int{
+		{dwAtByteSize, dwFormData1}, {dwAtType, dwFormRef4}}},
+	abbrevArrayType: {dwTagArrayType, true, [][2]int{
+		{dwAtType, dwFormRef4}}},
+	abbrevSubrangeType: {dwTagSubrangeType, false, [][2]int{
+		{dwAtCount, dwFormData8}}},
+	abbrevStructType: {dwTagStructureType, true, [][2]int{
+		{dwAtName, dwFormString}, {dwAtByteSize, dwFormData4}}},
+	abbrevIncompleteStructType: {dwTagStructureType, false, [][2]int{
+		{dwAtName, dwFormString}, {dwAtDeclaration, dwFormFlagPresent}}},
+	abbrevMember: {dwTagMember, false, [][2]int{
+		{dwAtName, dwFormString}, {dwAtType, dwFormRef4},
+		{dwAtDataMemberLocation, dwFormData4}}},
+	// A static function is not external.
+	abbrevStaticSubprogram: {dwTagSubprogram, true, [][2]int{
+		{dwAtName, dwFormString}, {dwAtDeclFile, dwFormData4},
+		{dwAtDeclLine, dwFormData4}, {dwAtType, dwFormRef4},
+		{dwAtLowPC, dwFormAddr}, {dwAtHighPC, dwFormData8},
+		{dwAtFrameBase, dwFormExprloc}}},
+}
+
+// The DWARF register number of each register which may hold a temporary.
+var dwarfRegisters = map[Reg]int{
+	"rbx": 3, "rsi": 4, "rdi": 5, "rbp": 6,
+	"r8": 8, "r9": 9, "r10": 10, "r11": 11,
+	"r12": 12, "r13": 13, "r14": 14, "r15": 15,
+	"xmm2": 19, "xmm3": 20, "xmm4": 21, "xmm5": 22,
+	"xmm6": 23, "xmm7": 24, "xmm8": 25, "xmm9": 26,
+	"xmm10": 27, "xmm11": 28, "xmm12": 29, "xmm13": 30,
+	"xmm14": 31, "xmm15": 32,
+}
+
+// position returns the position in a source file which a position of the
+// program came from, and the number of that file in the line table, emitting
+// a .file directive for a file which is not yet numbered.
+func (g *generator) position(pos token.Position) (int, token.Position) {
+	d := g.debug
+	if d.source.Position != nil {
+		pos = d.source.Position(pos)
+	}
+	if pos.Filename == "" {
+		pos.Filename = d.source.Filename
+	}
+	file, ok := d.files[pos.Filename]
+	if !ok {
+		file = len(d.files) + 1
+		d.files[pos.Filename] = file
+		g.directive(".file %d %s", file, ast.Quote(pos.Filename, '"'))
+	}
+	return file, pos
+}
+
+// loc emits a .loc directive, which gives the source line of the
+// instructions which follow, if debug information is enabled and the position
+// is known and on a different line from the last.
+func (g *generator) loc(pos token.Position) {
+	if g.debug == nil || !pos.IsValid() {
+		return
+	}
+	file, pos := g.position(pos)
+	if file == g.debug.file && pos.Line == g.debug.line {
+		return
+	}
+	g.debug.file, g.debug.line = file, pos.Line
+	g.directive(".loc %d %d %d", file, pos.Line, pos.Column)
+}
+
+// cfi emits a call frame information directive, which describes how to
+// unwind the stack, if debug information is enabled.
+func (g *generator) cfi(format string, args ...interface{}) {
+	if g.debug != nil {
+		g.directive(format, args...)
+	}
+}
+
+// startFunction starts the debug information of a function, at its label.
+func (g *generator) startFunction(f *ir.Function) {
+	if g.debug == nil {
+		return
+	}
+	g.debug.file, g.debug.line = 0, 0
+	g.directive(".cfi_startproc")
+	g.loc(f.Pos)
+}
+
+// endFunction ends the debug information of a function, after its last
+// instruction, recording the locations of its variables while those of the
+// function are known.
+func (g *generator) endFunction(f *ir.Function) {
+	d := g.debug
+	if d == nil {
+		return
+	}
+	df := debugFunction{function: f, end: fmt.Sprintf(".Lfunc_end%d", len(d.functions))}
+	g.label(df.end)
+	g.directive(".cfi_endproc")
+
+	params := make(map[*ir.Temp]*ir.Slot)
+	for _, s := range f.Slots {
+		if s.Param != nil {
+			params[s.Param] = s
+		}
+	}
+	for _, p := range f.Params {
+		location := g.tempLocation(p)
+		if s, ok := params[p]; ok {
+			location = fbreg(g.slotOffsets[s])
+		}
+		df.params = append(df.params, debugVariable{sourceName(p.Name), p.Type(), location})
+	}
+	isParam := make(map[*ir.Temp]bool)
+	for _, p := range f.Params {
+		isParam[p] = true
+	}
+	for _, t := range f.Temps {
+		if t.Name != "" && !isParam[t] {
+			df.variables = append(df.variables, debugVariable{sourceName(t.Name), t.Type(), g.tempLocation(t)})
+		}
+	}
+	for _, s := range f.Slots {
+		if s.Param == nil {
+			df.variables = append(df.variables, debugVariable{sourceName(s.Name), s.Type, fbreg(g.slotOffsets[s])})
+		}
+	}
+	d.functions = append(d.functions, df)
+}
+
+// sourceName returns the name of a variable in the source, without the suffix
+// which makes the names of shadowed variables unique.
+func sourceName(name string) string {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// tempLocation returns the location expression of a temporary: its
+// register, or its slot in the frame.
+func (g *generator) tempLocation(t *ir.Temp) []byte {
+	r, ok := g.registers[t]
+	if !ok {
+		return fbreg(g.offsets[t])
+	}
+	n := dwarfRegisters[r.quad]
+	if n < 32 {
+		return []byte{byte(dwOpReg0 + n)}
+	}
+	return append([]byte{dwOpRegx}, uleb128(n)...)
+}
+
+// fbreg returns the location expression of an offset from the frame base,
+// which is %rbp.
+func fbreg(offset int) []byte {
+	return append([]byte{dwOpFbreg}, sleb128(offset)...)
+}
+
+// uleb128 encodes an unsigned integer in the variable-length LEB128 format.
+func uleb128(n int) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// sleb128 encodes a signed integer in the variable-length LEB128 format.
+func sleb128(n int) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 && c&0x40 == 0 || n == -1 && c&0x40 != 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// debugSections emits the DWARF sections which describe the program. The
+// line table is generated by the assembler from the .loc directives, at the
+// label of the .debug_line section.
+func (g *generator) debugSections() {
+	d := g.debug
+	g.directive(".section .debug_abbrev,\"\",@progbits")
+	g.label(".Ldebug_abbrev0")
+	for code := 1; code <= len(abbrevs); code++ {
+		a := abbrevs[code]
+		children := 0
+		if a.children {
+			children = 1
+		}
+		g.directive(".uleb128 %d", code)
+		g.directive(".uleb128 %#x", a.tag)
+		g.directive(".byte %d", children)
+		for _, attr := range a.attrs {
+			g.directive(".uleb128 %#x", attr[0])
+			g.directive(".uleb128 %#x", attr[1])
+		}
+		g.directive(".byte 0, 0")
+	}
+	g.directive(".byte 0")
+
+	g.directive(".section .debug_info,\"\",@progbits")
+	g.label(".Ldebug_info0")
+	g.directive(".long .Ldebug_info_end0 - .Ldebug_info_start0")
+	g.label(".Ldebug_info_start0")
+	g.directive(".value 4")
+	g.directive(".long .Ldebug_abbrev0")
+	g.directive(".byte 8")
+	g.directive(".uleb128 %d", abbrevCompileUnit)
+	g.directive(".string \"toycc\"")
+	g.directive(".value %#x", dwLangC99)
+	g.directive(".string %s", ast.Quote(d.source.Filename, '"'))
+	g.directive(".string %s", ast.Quote(d.source.Dir, '"'))
+	g.directive(".quad .Ltext0")
+	g.directive(".quad .Letext0 - .Ltext0")
+	g.directive(".long .Ldebug_line0")
+	for _, df := range d.functions {
+		g.subprogram(df)
+	}
+	// Entries may be added for the types which others refer to, as they are
+	// emitted.
+	for i := 0; i < len(d.typeOrder); i++ {
+		g.typeEntry(d.typeOrder[i])
+	}
+	g.directive(".byte 0")
+	g.label(".Ldebug_info_end0")
+
+	g.directive(".section .debug_line,\"\",@progbits")
+	g.label(".Ldebug_line0")
+}
+
+// subprogram emits the entry of a function, and those of its parameters and
+// variables.
+func (g *generator) subprogram(df debugFunction) {
+	f := df.function
+	// A file number of 0 is no file.
+	file, pos := 0, f.Pos
+	if pos.IsValid() {
+		file, pos = g.position(pos)
+	}
+	if f.Static {
+		g.directive(".uleb128 %d", abbrevStaticSubprogram)
+	} else {
+		g.directive(".uleb128 %d", abbrevSubprogram)
+	}
+	g.directive(".string %s", ast.Quote(f.Name, '"'))
+	g.directive(".long %d", file)
+	g.directive(".long %d", pos.Line)
+	g.directive(".long %s - .Ldebug_info0", g.typeLabel(f.Result))
+	g.directive(".quad %s", f.Name)
+	g.directive(".quad %s - %s", df.end, f.Name)
+	g.exprloc([]byte{dwOpReg0 + 6})
+	for _, v := range df.params {
+		g.variable(abbrevParameter, v)
+	}
+	for _, v := range df.variables {
+		g.variable(abbrevVariable, v)
+	}
+	g.directive(".byte 0")
+}
+
+// variable emits the entry of a parameter or a variable.
+func (g *generator) variable(code int, v debugVariable) {
+	g.directive(".uleb128 %d", code)
+	g.directive(".string %s", ast.Quote(v.name, '"'))
+	g.directive(".long %s - .Ldebug_info0", g.typeLabel(v.typ))
+	g.exprloc(v.location)
+}
+
+// exprloc emits a DWARF expression, preceded by its length.
+func (g *generator) exprloc(expr []byte) {
+	b := append(uleb128(len(expr)), expr...)
+	bytes := make([]string, len(b))
+	for i, c := range b {
+		bytes[i] = fmt.Sprintf("%#x", c)
+	}
+	g.directive(".byte %s", strings.Join(bytes, ", "))
+}
+
+// typeLabel returns the label of the entry of a type, which is emitted after
+// the functions.
+func (g *generator) typeLabel(t types.Type) string {
+	d := g.debug
+	label, ok := d.types[t]
+	if !ok {
+		label = fmt.Sprintf(".Ldebug_type%d", len(d.typeOrder))
+		d.types[t] = label
+		d.typeOrder = append(d.typeOrder, t)
+	}
+	return label
+}
+
+// typeEntry emits the entry of a type.
+func (g *generator) typeEntry(t types.Type) {
+	g.label(g.typeLabel(t))
+	switch t := t.(type) {
+	case *types.Basic:
+		encoding := dwAteSigned
+		switch {
+		case t == types.Char:
+			encoding = dwAteSignedChar
+		case t == types.UnsignedChar:
+			encoding = dwAteUnsignedChar
+		case types.IsUnsigned(t):
+			encoding = dwAteUnsigned
+		case types.IsFloating(t):
+			encoding = dwAteFloat
+		}
+		g.directive(".uleb128 %d", abbrevBaseType)
+		g.directive(".string %s", ast.Quote(t.String(), '"'))
+		g.directive(".byte %#x", encoding)
+		g.directive(".byte %d", types.LP64.Sizeof(t))
+	case *types.Pointer:
+		g.directive(".uleb128 %d", abbrevPointerType)
+		g.directive(".byte %d", types.LP64.Sizeof(t))
+		g.directive(".long %s - .Ldebug_info0", g.typeLabel(t.Elem))
+	case *types.Array:
+		g.directive(".uleb128 %d", abbrevArrayType)
+		g.directive(".long %s - .Ldebug_info0", g.typeLabel(t.Elem))
+		g.directive(".uleb128 %d", abbrevSubrangeType)
+		g.directive(".quad %d", t.Len)
+		g.directive(".byte 0")
+	case *types.Struct:
+		if !t.Complete {
+			g.directive(".uleb128 %d", abbrevIncompleteStructType)
+			g.directive(".string %s", ast.Quote(t.Tag, '"'))
+			return
+		}
+		g.directive(".uleb128 %d", abbrevStructType)
+		g.directive(".string %s", ast.Quote(t.Tag, '"'))
+		g.directive(".long %d", types.LP64.Sizeof(t))
+		for i, field := range t.Fields {
+			g.directive(".uleb128 %d", abbrevMember)
+			g.directive(".string %s", ast.Quote(field.Name, '"'))
+			g.directive(".long %s - .Ldebug_info0", g.typeLabel(field.Type))
+			g.directive(".long %d", types.LP64.Offsetof(t, i))
+		}
+		g.directive(".byte 0")
+	default:
+		g.errorf("no debug information for type %v", t)
+	}
+}
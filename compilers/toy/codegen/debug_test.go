@@ -0,0 +1,55 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGenerateDebugLineTable(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() {\n  int a = 2;\n  return a;\n}", Debug(Source{Filename: "a.c", Dir: "/src"}))
+	assert.Contains(asm, "\t.text\n.Ltext0:\n")
+	assert.Contains(asm, "main:\n\t.cfi_startproc\n\t.file 1 \"a.c\"\n\t.loc 1 1 1\n\tpushq %rbp\n")
+	assert.Contains(asm, "\t.loc 1 2 3\n")
+	assert.Contains(asm, "\t.loc 1 3 3\n")
+	assert.Contains(asm, ".Lfunc_end0:\n\t.cfi_endproc\n")
+	assert.Contains(asm, "\t.section .debug_info,\"\",@progbits\n.Ldebug_info0:\n")
+	assert.Contains(asm, "\t.string \"/src\"\n")
+}
+
+func TestGenerateDebugVariables(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "struct s { int x; };\nint f(int n) { int *p = &n; struct s v; return *p; }",
+		Debug(Source{Filename: "a.c"}))
+	for _, name := range []string{"f", "n", "p", "v", "s", "x", "int"} {
+		assert.Contains(asm, "\t.string \""+name+"\"\n", name)
+	}
+
+	// Without the option, there is no debug information.
+	asm = generate(t, "int main() { return 2; }")
+	assert.NotContains(asm, ".loc")
+	assert.NotContains(asm, ".cfi_startproc")
+	assert.NotContains(asm, ".debug_info")
+}
+
+func TestGenerateDebugStaticFunction(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "static int f() { return 1; }\nint main() { return f(); }",
+		Debug(Source{Filename: "a.c"}))
+	// The entry of a static function is not external.
+	assert.Contains(asm, fmt.Sprintf("\t.uleb128 %d\n\t.string \"f\"\n", abbrevStaticSubprogram))
+	assert.Contains(asm, fmt.Sprintf("\t.uleb128 %d\n\t.string \"main\"\n", abbrevSubprogram))
+}
+
+func TestLEB128(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]byte{2}, uleb128(2))
+	assert.Equal([]byte{0x7f}, uleb128(127))
+	assert.Equal([]byte{0x80, 0x01}, uleb128(128))
+	assert.Equal([]byte{0xe5, 0x8e, 0x26}, uleb128(624485))
+	assert.Equal([]byte{2}, sleb128(2))
+	assert.Equal([]byte{0x7e}, sleb128(-2))
+	assert.Equal([]byte{0xff, 0x00}, sleb128(127))
+	assert.Equal([]byte{0x80, 0x7f}, sleb128(-128))
+}
@@ -0,0 +1,100 @@
+package codegen
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// The size of a stack slot, in bytes.
+const slotSize = 8
+
+// The required alignment of the stack pointer, in bytes.
+const stackAlignment = 16
+
+// A frame allocates the slots of a function's stack frame, below the saved
+// %rbp.
+type frame struct {
+	slots int
+}
+
+// allocate returns the %rbp-relative offset of a new slot.
+func (fr *frame) allocate() int {
+	return fr.reserve(slotSize)
+}
+
+// reserve returns the %rbp-relative offset of enough consecutive new slots to
+// hold an object of the given size, such as an array.
+func (fr *frame) reserve(size int) int {
+	fr.slots += (size + slotSize - 1) / slotSize
+	return -slotSize * fr.slots
+}
+
+// size returns the number of bytes by which %rsp is adjusted to make room for
+// the slots, keeping it aligned.
+func (fr *frame) size() int {
+	return align(slotSize * fr.slots)
+}
+
+// align rounds a size up to a multiple of the stack alignment.
+func align(size int) int {
+	if r := size % stackAlignment; r != 0 {
+		size += stackAlignment - r
+	}
+	return size
+}
+
+// layoutFrame assigns a slot in the stack frame of a function to the stack
+// canary, if the stack is sanitized, to each IR slot, to each temporary
+// without a register, to each callee-saved register it uses, to each
+// caller-saved register which must be preserved across a call, and to each
+// parameter which is passed in a register. It returns the size of the frame.
+func (g *generator) layoutFrame(f *ir.Function, liveness *ir.Liveness) int {
+	var fr frame
+	// The canary is above the other slots, so that it is overwritten by an
+	// overflow of any of them.
+	if g.sanitizeStack {
+		g.canaryOffset = fr.allocate()
+	}
+	g.slotOffsets = make(map[*ir.Slot]int)
+	for _, s := range f.Slots {
+		g.slotOffsets[s] = fr.reserve(types.LP64.Sizeof(s.Type))
+	}
+	g.offsets = make(map[*ir.Temp]int)
+	for _, t := range f.Temps {
+		if _, ok := g.registers[t]; !ok {
+			g.offsets[t] = fr.allocate()
+		}
+	}
+	g.saved, g.saveOffsets = nil, nil
+	for _, r := range intRegisters {
+		if r.calleeSaved && g.uses(r) {
+			g.saved = append(g.saved, r)
+			g.saveOffsets = append(g.saveOffsets, fr.allocate())
+		}
+	}
+	g.preserved = make(map[*ir.Call][]register)
+	g.callerSaveOffsets = make(map[register]int)
+	for i, instr := range f.Instrs {
+		call, ok := instr.(*ir.Call)
+		if !ok {
+			continue
+		}
+		for _, t := range f.Temps {
+			r, ok := g.registers[t]
+			if !ok || r.calleeSaved || t == call.Dst || !liveness.Out[i][t] {
+				continue
+			}
+			g.preserved[call] = append(g.preserved[call], r)
+			if _, ok := g.callerSaveOffsets[r]; !ok {
+				g.callerSaveOffsets[r] = fr.allocate()
+			}
+		}
+	}
+	g.paramOffsets = make(map[*ir.Temp]int)
+	for _, p := range f.Params {
+		if _, ok := g.registers[p]; ok {
+			g.paramOffsets[p] = fr.allocate()
+		}
+	}
+	return fr.size()
+}
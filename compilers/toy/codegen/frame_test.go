@@ -0,0 +1,79 @@
+package codegen
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestFrameAllocate(t *testing.T) {
+	assert := assert.New(t)
+	var fr frame
+	assert.Equal(0, fr.size())
+	assert.Equal(-8, fr.allocate())
+	assert.Equal(16, fr.size())
+	assert.Equal(-16, fr.allocate())
+	assert.Equal(16, fr.size())
+	assert.Equal(-24, fr.allocate())
+	assert.Equal(32, fr.size())
+	// An array of five ints takes three slots.
+	assert.Equal(-48, fr.reserve(20))
+	assert.Equal(48, fr.size())
+	assert.Equal(-56, fr.reserve(8))
+}
+
+func TestAlign(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(0, align(0))
+	assert.Equal(16, align(8))
+	assert.Equal(16, align(16))
+	assert.Equal(48, align(40))
+}
+
+func TestGenerateFrameLayout(t *testing.T) {
+	assert := assert.New(t)
+	// Each variable has its own slot, in order of declaration, including a
+	// variable of an inner scope which shadows another.
+	asm := generate(t, `int main() {
+  int a = 1;
+  double d = 2.5;
+  { int a = 3; }
+  return a;
+}`, NoRegisterAllocation)
+	assert.Contains(asm, `	subq $32, %rsp
+	movl $1, %eax
+	movl %eax, -8(%rbp)
+	movsd .LC0(%rip), %xmm0
+	movsd %xmm0, -16(%rbp)
+	movl $3, %eax
+	movl %eax, -24(%rbp)
+	movl -8(%rbp), %eax
+`)
+}
+
+func TestGenerateFrameWithoutSlots(t *testing.T) {
+	assert := assert.New(t)
+	// With every variable in a register, the frame is empty.
+	asm := generate(t, "int main() { int a = 1; int b = a + 2; return b; }")
+	assert.NotContains(asm, "subq")
+	assert.Contains(asm, "\tmovq %rbp, %rsp\n\tpopq %rbp\n\tret\n")
+}
+
+func TestGenerateStackCanary(t *testing.T) {
+	assert := assert.New(t)
+	// The canary is in the top slot, above the array, and is checked at each
+	// return.
+	asm := generate(t, "int main() { int a[2]; a[0] = 1; if (a[0]) return 2; return 3; }", SanitizeStack)
+	assert.Contains(asm, `	subq $16, %rsp
+	movq %fs:40, %rax
+	movq %rax, -8(%rbp)
+`)
+	assert.Contains(asm, "\tleaq -16(%rbp), %rax\n")
+	check := `	movq -8(%rbp), %rcx
+	xorq %fs:40, %rcx
+	jne .Lstack_chk_fail_main
+	movq %rbp, %rsp
+`
+	assert.Equal(2, strings.Count(asm, check))
+	assert.Contains(asm, ".Lstack_chk_fail_main:\n\tcall __stack_chk_fail@PLT\n")
+}
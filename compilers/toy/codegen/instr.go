@@ -0,0 +1,109 @@
+package codegen
+
+import (
+	"strings"
+)
+
+// A Line of assembly: an Instr, a Label or a Directive. The generator emits
+// the lines of a program, which the peephole optimizer rewrites, and which a
+// printer writes in the syntax of an assembler.
+type Line interface {
+	line()
+}
+
+// An Instr is an instruction. Its mnemonic is that of AT&T syntax, whose
+// suffix gives the size of the operands, as in "movl", and its operands are
+// in AT&T order, with the destination last.
+type Instr struct {
+	Op   string
+	Args []Operand
+}
+
+// A Label is the definition of a label.
+type Label string
+
+// A Directive is an assembler directive, such as ".text", which is written
+// the same in every syntax.
+type Directive string
+
+func (Instr) line()     {}
+func (Label) line()     {}
+func (Directive) line() {}
+
+// An Operand of an instruction: a Reg, an Imm, a Mem, a Sym or an Indirect.
+// Operands are comparable.
+type Operand interface {
+	operand()
+}
+
+// A Reg is a register, named without a prefix, as in "eax".
+type Reg string
+
+// An Imm is an immediate integer.
+type Imm int64
+
+// A Mem is a memory operand. Its address is the sum of the address of a
+// symbol, a displacement, a base register, and an index register times a
+// scale, any of which may be absent, or else an offset in a segment.
+type Mem struct {
+	Seg   Reg    // The segment register of an offset, as in %fs:40.
+	Sym   string // The symbol, with any relocation, as in "f@GOTPCREL".
+	Disp  int
+	Base  Reg // %rip for an address relative to the next instruction.
+	Index Reg
+	Scale int // 1, 2, 4 or 8, if there is an index.
+}
+
+// A Sym is the address of a label or function, as the target of a jump or
+// call.
+type Sym string
+
+// An Indirect is the target of a jump or call whose address is in a register
+// or memory.
+type Indirect struct {
+	Target Operand
+}
+
+func (Reg) operand()      {}
+func (Imm) operand()      {}
+func (Mem) operand()      {}
+func (Sym) operand()      {}
+func (Indirect) operand() {}
+
+// The registers which the generator uses by name, besides those which hold
+// temporaries and arguments.
+const (
+	rax  Reg = "rax"
+	eax  Reg = "eax"
+	ax   Reg = "ax"
+	al   Reg = "al"
+	rcx  Reg = "rcx"
+	ecx  Reg = "ecx"
+	cx   Reg = "cx"
+	cl   Reg = "cl"
+	rdx  Reg = "rdx"
+	edx  Reg = "edx"
+	rbp  Reg = "rbp"
+	rsp  Reg = "rsp"
+	rip  Reg = "rip"
+	r11  Reg = "r11"
+	xmm0 Reg = "xmm0"
+	xmm1 Reg = "xmm1"
+	fs   Reg = "fs"
+)
+
+// isXMM returns whether a register is an SSE register.
+func (r Reg) isXMM() bool {
+	return strings.HasPrefix(string(r), "xmm")
+}
+
+// memory returns the operand of an offset from a register.
+func memory(offset int, base Reg) Mem {
+	return Mem{Disp: offset, Base: base}
+}
+
+// ripRelative returns the operand of a symbol, addressed relative to the
+// next instruction.
+func ripRelative(sym string) Mem {
+	return Mem{Sym: sym, Base: rip}
+}
@@ -0,0 +1,535 @@
+package llvm
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"strings"
+)
+
+// A basic block of a function: the instructions from start up to end.
+type block struct {
+	name       string
+	start, end int
+	// The block from which each incoming edge comes. A block appears once for
+	// each of its edges, as LLVM requires of phi nodes.
+	preds []int
+	// The temporaries which have a phi node at the start of the block, and the
+	// SSA value of each temporary at the start and end of the block.
+	phis    []*ir.Temp
+	in, out map[*ir.Temp]string
+	lines   []string
+}
+
+// The state of the translation of a function.
+type function struct {
+	g      *generator
+	f      *ir.Function
+	blocks []*block
+	// The index of the block which starts at each label, and at each
+	// instruction.
+	labels  map[*ir.Label]int
+	starts  map[int]int
+	block   *block
+	current map[*ir.Temp]string // The SSA value of each temporary.
+	defs    map[*ir.Temp]int    // The number of SSA values of each temporary.
+	scratch int                 // The number of scratch values.
+}
+
+func newFunction(g *generator, f *ir.Function) *function {
+	return &function{
+		g:      g,
+		f:      f,
+		labels: make(map[*ir.Label]int),
+		starts: make(map[int]int),
+		defs:   make(map[*ir.Temp]int),
+	}
+}
+
+// isTerminator returns whether an instruction ends a basic block.
+func isTerminator(instr ir.Instr) bool {
+	switch instr.(type) {
+	case *ir.Jump, *ir.Branch, *ir.Switch, *ir.Return:
+		return true
+	}
+	return false
+}
+
+// splitBlocks divides the instructions of the function into basic blocks. The
+// entry block, which may be empty, has no predecessors. A new block starts at
+// each label, and after each terminator, where the code is unreachable unless
+// it is labelled.
+func (fn *function) splitBlocks() {
+	instrs := fn.f.Instrs
+	fn.blocks = []*block{{name: ".entry"}}
+	names := ir.NameGenerator{Prefix: ".L", Local: true}
+	names.Function(fn.f)
+	for i, instr := range instrs {
+		var name string
+		if l, ok := instr.(*ir.Label); ok {
+			name = names.Name(l)
+			fn.labels[l] = len(fn.blocks)
+		} else if i > 0 && isTerminator(instrs[i-1]) {
+			name = fmt.Sprintf(".dead%d", i)
+		} else {
+			continue
+		}
+		fn.blocks[len(fn.blocks)-1].end = i
+		fn.starts[i] = len(fn.blocks)
+		fn.blocks = append(fn.blocks, &block{name: name, start: i})
+	}
+	fn.blocks[len(fn.blocks)-1].end = len(instrs)
+
+	successors := ir.Successors(fn.f)
+	for i, b := range fn.blocks {
+		if b.end == b.start {
+			if i+1 < len(fn.blocks) {
+				fn.blocks[i+1].preds = append(fn.blocks[i+1].preds, i)
+			}
+			continue
+		}
+		for _, s := range successors[b.end-1] {
+			fn.blocks[fn.starts[s]].preds = append(fn.blocks[fn.starts[s]].preds, i)
+		}
+	}
+}
+
+// newValue returns a new SSA value for a temporary. Values are named after the
+// temporary with a numeric suffix, or for anonymous temporaries, after its
+// number, after a dot, so that names are unique and do not clash with
+// parameters or basic blocks.
+func (fn *function) newValue(t *ir.Temp) string {
+	n := fn.defs[t]
+	fn.defs[t]++
+	switch {
+	case t.Name != "":
+		return fmt.Sprintf("%%%s.%d", t.Name, n)
+	case n == 0:
+		return fmt.Sprintf("%%.%d", t.ID)
+	}
+	return fmt.Sprintf("%%.%d.%d", t.ID, n)
+}
+
+// slotName returns the name of the alloca of a slot, which cannot clash with
+// an SSA value or parameter.
+func slotName(s *ir.Slot) string {
+	return "%" + s.Name + ".addr"
+}
+
+// newScratch returns a new SSA value for an intermediate result.
+func (fn *function) newScratch() string {
+	fn.scratch++
+	return fmt.Sprintf("%%.tmp%d", fn.scratch)
+}
+
+// assignPhis decides the temporaries which have phi nodes at the start of
+// each block: those which are live there, unless the block has a single
+// predecessor which precedes it, whose values it inherits.
+func (fn *function) assignPhis() {
+	liveness := ir.AnalyzeLiveness(fn.f)
+	for i, b := range fn.blocks[1:] {
+		if len(b.preds) == 0 || len(b.preds) == 1 && b.preds[0] <= i {
+			continue
+		}
+		b.in = make(map[*ir.Temp]string)
+		for _, t := range fn.f.Temps {
+			if liveness.In[b.start][t] {
+				b.phis = append(b.phis, t)
+				b.in[t] = fn.newValue(t)
+			}
+		}
+	}
+}
+
+func (fn *function) generate() {
+	g, f := fn.g, fn.f
+	g.pos = f.Pos
+	defer func() { g.pos = token.Position{} }()
+	params := make([]string, len(f.Params))
+	entry := make(map[*ir.Temp]string)
+	for i, p := range f.Params {
+		entry[p] = "%" + p.Name
+		if p.Name == "" {
+			entry[p] = fn.newValue(p)
+		}
+		params[i] = fmt.Sprintf("%s %s", llvmType(p.Type()), entry[p])
+	}
+	g.printf("define %s%s @%s(%s) {\n", linkage(f.Static), llvmType(f.Result), f.Name,
+		strings.Join(params, ", "))
+
+	fn.splitBlocks()
+	fn.blocks[0].in = entry
+	fn.assignPhis()
+	for _, s := range f.Slots {
+		fn.block = fn.blocks[0]
+		fn.emit("%s = alloca %s", slotName(s), llvmType(s.Type))
+	}
+	for i, b := range fn.blocks {
+		fn.block = b
+		fn.current = make(map[*ir.Temp]string)
+		in := b.in
+		if in == nil && len(b.preds) == 1 {
+			in = fn.blocks[b.preds[0]].out
+		}
+		for t, v := range in {
+			fn.current[t] = v
+		}
+		for j := b.start; j < b.end; j++ {
+			if pos := f.Position(j); pos.IsValid() {
+				g.pos = pos
+			}
+			fn.instr(f.Instrs[j])
+		}
+		if b.end == b.start || !isTerminator(f.Instrs[b.end-1]) {
+			if i+1 < len(fn.blocks) {
+				fn.emit("br label %%%s", fn.blocks[i+1].name)
+			} else {
+				fn.emit("unreachable")
+			}
+		}
+		b.out = fn.current
+	}
+
+	for _, b := range fn.blocks {
+		g.printf("%s:\n", b.name)
+		for _, t := range b.phis {
+			incoming := make([]string, len(b.preds))
+			for i, p := range b.preds {
+				v, ok := fn.blocks[p].out[t]
+				if !ok {
+					v = "undef"
+				}
+				incoming[i] = fmt.Sprintf("[ %s, %%%s ]", v, fn.blocks[p].name)
+			}
+			g.printf("  %s = phi %s %s\n", b.in[t], llvmType(t.Type()), strings.Join(incoming, ", "))
+		}
+		for _, line := range b.lines {
+			g.printf("  %s\n", line)
+		}
+	}
+	g.printf("}\n")
+}
+
+// emit appends an instruction to the current block.
+func (fn *function) emit(format string, args ...interface{}) {
+	fn.block.lines = append(fn.block.lines, fmt.Sprintf(format, args...))
+}
+
+// operand returns a constant, or the current SSA value of a temporary, which
+// is undef if it has not been assigned.
+func (fn *function) operand(v ir.Value) string {
+	if c, ok := constant(v); ok {
+		return c
+	}
+	if t, ok := v.(*ir.Temp); ok {
+		if value, ok := fn.current[t]; ok {
+			return value
+		}
+		return "undef"
+	}
+	fn.g.errorf("invalid operand %v", v)
+	return "undef"
+}
+
+// typed returns the type and operand of a value, as in an argument.
+func (fn *function) typed(v ir.Value) string {
+	return llvmType(v.Type()) + " " + fn.operand(v)
+}
+
+// define returns a new SSA value for the destination of an instruction.
+func (fn *function) define(t *ir.Temp) string {
+	v := fn.newValue(t)
+	fn.current[t] = v
+	return v
+}
+
+// condition compares an int condition with zero, returning the i1 result.
+func (fn *function) condition(v ir.Value) string {
+	c := fn.newScratch()
+	fn.emit("%s = icmp ne %s, 0", c, fn.typed(v))
+	return c
+}
+
+func (fn *function) instr(instr ir.Instr) {
+	switch i := instr.(type) {
+	case *ir.Copy:
+		fn.current[i.Dst] = fn.operand(i.Src)
+	case *ir.Unary:
+		fn.unary(i)
+	case *ir.Binary:
+		fn.binary(i)
+	case *ir.Convert:
+		fn.convert(i)
+	case *ir.Select:
+		c := fn.condition(i.Cond)
+		t, f := fn.typed(i.True), fn.typed(i.False)
+		fn.emit("%s = select i1 %s, %s, %s", fn.define(i.Dst), c, t, f)
+	case *ir.Addr:
+		fn.current[i.Dst] = slotName(i.Slot)
+	case *ir.GlobalAddr:
+		fn.current[i.Dst] = globalName(i.Global)
+	case *ir.Load:
+		addr := fn.typed(i.Addr)
+		fn.emit("%s = load %s, %s", fn.define(i.Dst), llvmType(i.Dst.Type()), addr)
+	case *ir.Store:
+		fn.emit("store %s, %s", fn.typed(i.Src), fn.typed(i.Addr))
+	case *ir.PtrAdd:
+		elem := llvmType(i.Ptr.Type().(*types.Pointer).Elem)
+		ptr, index := fn.typed(i.Ptr), fn.typed(i.Index)
+		if types.IsUnsigned(i.Index.Type()) && types.Width(i.Index.Type()) < 64 {
+			// An index is sign-extended, so an unsigned one is widened first.
+			wide := fn.newScratch()
+			fn.emit("%s = zext %s to i64", wide, index)
+			index = "i64 " + wide
+		}
+		fn.emit("%s = getelementptr %s, %s, %s", fn.define(i.Dst), elem, ptr, index)
+	case *ir.FieldAddr:
+		elem := llvmType(i.Ptr.Type().(*types.Pointer).Elem)
+		fn.emit("%s = getelementptr %s, %s, i32 0, i32 %d", fn.define(i.Dst), elem,
+			fn.typed(i.Ptr), i.Field)
+	case *ir.PtrDiff:
+		fn.ptrDiff(i)
+	case *ir.Label:
+	case *ir.Jump:
+		fn.emit("br label %%%s", fn.blocks[fn.labels[i.Target]].name)
+	case *ir.Branch:
+		c := fn.condition(i.Cond)
+		fn.emit("br i1 %s, label %%%s, label %%%s", c,
+			fn.blocks[fn.labels[i.True]].name, fn.blocks[fn.labels[i.False]].name)
+	case *ir.Switch:
+		cases := make([]string, len(i.Cases))
+		for j, c := range i.Cases {
+			cases[j] = fmt.Sprintf("%s %d, label %%%s", llvmType(i.Value.Type()),
+				signed(c.Value, i.Value.Type()), fn.blocks[fn.labels[c.Target]].name)
+		}
+		fn.emit("switch %s, label %%%s [ %s ]", fn.typed(i.Value),
+			fn.blocks[fn.labels[i.Default]].name, strings.Join(cases, " "))
+	case *ir.Call:
+		args := make([]string, len(i.Args))
+		for j, a := range i.Args {
+			args[j] = fn.typed(a)
+		}
+		// The type of a variadic function is given with the call, since the
+		// types of its arguments do not determine it.
+		result := llvmType(i.Dst.Type())
+		if i.Variadic {
+			result = fmt.Sprintf("%s (%s)", result, paramTypes(i))
+		}
+		fn.emit("%s = call %s @%s(%s)", fn.define(i.Dst), result,
+			i.Function, strings.Join(args, ", "))
+	case *ir.Return:
+		fn.emit("ret %s", fn.typed(i.Value))
+	default:
+		fn.g.errorf("unsupported instruction %v", instr)
+	}
+}
+
+func (fn *function) unary(i *ir.Unary) {
+	t := i.Src.Type()
+	src := fn.operand(i.Src)
+	switch {
+	case i.Op == ir.Neg && types.IsFloating(t):
+		fn.emit("%s = fneg %s %s", fn.define(i.Dst), llvmType(t), src)
+	case i.Op == ir.Neg && types.IsInteger(t):
+		fn.emit("%s = sub %s 0, %s", fn.define(i.Dst), llvmType(t), src)
+	case i.Op == ir.Not && types.IsInteger(t):
+		fn.emit("%s = xor %s %s, -1", fn.define(i.Dst), llvmType(t), src)
+	default:
+		fn.g.errorf("unsupported instruction %v", i)
+	}
+}
+
+// The instruction for each integer arithmetic operator.
+var intArithmetic = map[ir.Op]string{
+	ir.Add: "add",
+	ir.Sub: "sub",
+	ir.Mul: "mul",
+	ir.Div: "sdiv",
+	ir.Rem: "srem",
+	ir.And: "and",
+	ir.Or:  "or",
+	ir.Xor: "xor",
+	ir.Shl: "shl",
+	ir.Shr: "ashr",
+}
+
+// The instruction for each floating-point arithmetic operator.
+var floatArithmetic = map[ir.Op]string{
+	ir.Add: "fadd",
+	ir.Sub: "fsub",
+	ir.Mul: "fmul",
+	ir.Div: "fdiv",
+}
+
+// The predicate of each integer comparison.
+var intPredicates = map[ir.Op]string{
+	ir.Eq: "eq",
+	ir.Ne: "ne",
+	ir.Lt: "slt",
+	ir.Le: "sle",
+	ir.Gt: "sgt",
+	ir.Ge: "sge",
+}
+
+// The instruction for each arithmetic operator on unsigned integers.
+var unsignedArithmetic = map[ir.Op]string{
+	ir.Add: "add",
+	ir.Sub: "sub",
+	ir.Mul: "mul",
+	ir.Div: "udiv",
+	ir.Rem: "urem",
+	ir.And: "and",
+	ir.Or:  "or",
+	ir.Xor: "xor",
+	ir.Shl: "shl",
+	ir.Shr: "lshr",
+}
+
+// The predicate of each comparison of unsigned integers or of pointers, which
+// are unsigned.
+var pointerPredicates = map[ir.Op]string{
+	ir.Eq: "eq",
+	ir.Ne: "ne",
+	ir.Lt: "ult",
+	ir.Le: "ule",
+	ir.Gt: "ugt",
+	ir.Ge: "uge",
+}
+
+// The predicate of each floating-point comparison. Comparisons of NaN are
+// false, other than ne.
+var floatPredicates = map[ir.Op]string{
+	ir.Eq: "oeq",
+	ir.Ne: "une",
+	ir.Lt: "olt",
+	ir.Le: "ole",
+	ir.Gt: "ogt",
+	ir.Ge: "oge",
+}
+
+func (fn *function) binary(i *ir.Binary) {
+	t := i.Lhs.Type()
+	arithmetic, predicates, compare := intArithmetic, intPredicates, "icmp"
+	switch {
+	case types.IsFloating(t):
+		arithmetic, predicates, compare = floatArithmetic, floatPredicates, "fcmp"
+	case types.IsPointer(t):
+		arithmetic, predicates = nil, pointerPredicates
+	case types.IsUnsigned(t):
+		arithmetic, predicates = unsignedArithmetic, pointerPredicates
+	}
+	lhs, rhs := fn.operand(i.Lhs), fn.operand(i.Rhs)
+	if p, ok := predicates[i.Op]; ok {
+		c := fn.newScratch()
+		fn.emit("%s = %s %s %s %s, %s", c, compare, p, llvmType(t), lhs, rhs)
+		fn.emit("%s = zext i1 %s to i32", fn.define(i.Dst), c)
+		return
+	}
+	op, ok := arithmetic[i.Op]
+	if !ok {
+		fn.g.errorf("unsupported instruction %v", i)
+		return
+	}
+	if i.Op == ir.Shl || i.Op == ir.Shr {
+		// A shift by the width of the operand or more is poison in LLVM, so
+		// the count is taken modulo the width explicitly, after giving it the
+		// type of the operand.
+		width := int64(types.Width(t))
+		if c, ok := i.Rhs.(*ir.IntConst); ok {
+			rhs = fmt.Sprintf("%d", c.Value&(width-1))
+		} else {
+			if from := i.Rhs.Type(); types.Width(from) != types.Width(t) {
+				op := "trunc"
+				if types.Width(from) < types.Width(t) {
+					op = "zext"
+				}
+				wide := fn.newScratch()
+				fn.emit("%s = %s %s to %s", wide, op, fn.typed(i.Rhs), llvmType(t))
+				rhs = wide
+			}
+			count := fn.newScratch()
+			fn.emit("%s = and %s %s, %d", count, llvmType(t), rhs, width-1)
+			rhs = count
+		}
+	}
+	fn.emit("%s = %s %s %s, %s", fn.define(i.Dst), op, llvmType(t), lhs, rhs)
+}
+
+// ptrDiff divides the difference in bytes between two pointers, as 64-bit
+// integers, by the size of the type which they point to, which is computed
+// by indexing a null pointer so that the output does not depend on the
+// target.
+func (fn *function) ptrDiff(i *ir.PtrDiff) {
+	t := llvmType(i.Lhs.Type())
+	elem := llvmType(i.Lhs.Type().(*types.Pointer).Elem)
+	lhs, rhs, bytes, n := fn.newScratch(), fn.newScratch(), fn.newScratch(), fn.newScratch()
+	fn.emit("%s = ptrtoint %s to i64", lhs, fn.typed(i.Lhs))
+	fn.emit("%s = ptrtoint %s to i64", rhs, fn.typed(i.Rhs))
+	fn.emit("%s = sub i64 %s, %s", bytes, lhs, rhs)
+	fn.emit("%s = sdiv exact i64 %s, ptrtoint (%s getelementptr (%s, %s null, i32 1) to i64)",
+		n, bytes, t, elem, t)
+	fn.emit("%s = trunc i64 %s to i32", fn.define(i.Dst), n)
+}
+
+// convert converts between arithmetic types, or between an integer and a
+// pointer. Conversions from floating-point to integer types truncate towards
+// zero, and those between integer types extend the value, with its sign
+// unless it is unsigned, or keep its low bits. Those from floating-point
+// types to unsigned int are through a long, whose low 32 bits are the
+// result, like the other targets.
+func (fn *function) convert(i *ir.Convert) {
+	from, to := i.Src.Type(), i.Dst.Type()
+	var op string
+	switch {
+	case from == to, types.IsInteger(from) && types.IsInteger(to) &&
+		types.Width(from) == types.Width(to):
+		fn.current[i.Dst] = fn.operand(i.Src)
+		return
+	case types.IsInteger(from) && types.IsInteger(to):
+		switch {
+		case types.Width(from) > types.Width(to):
+			op = "trunc"
+		case types.IsUnsigned(from):
+			op = "zext"
+		default:
+			op = "sext"
+		}
+	case types.IsUnsigned(from) && types.IsFloating(to):
+		op = "uitofp"
+	case types.IsInteger(from) && types.IsFloating(to):
+		op = "sitofp"
+	case types.IsFloating(from) && to == types.UnsignedLong:
+		op = "fptoui"
+	case types.IsFloating(from) && to == types.UnsignedInt:
+		wide := fn.newScratch()
+		fn.emit("%s = fptosi %s to i64", wide, fn.typed(i.Src))
+		fn.emit("%s = trunc i64 %s to %s", fn.define(i.Dst), wide, llvmType(to))
+		return
+	case types.IsFloating(from) && types.IsInteger(to):
+		op = "fptosi"
+	case from == types.Float && to == types.Double:
+		op = "fpext"
+	case from == types.Double && to == types.Float:
+		op = "fptrunc"
+	case types.IsInteger(from) && types.IsPointer(to) &&
+		(types.IsUnsigned(from) || types.Width(from) == 64):
+		op = "inttoptr"
+	case types.IsInteger(from) && types.IsPointer(to):
+		// Like the other targets, sign-extend the integer to the width of a
+		// pointer, which inttoptr would zero-extend.
+		wide := fn.newScratch()
+		fn.emit("%s = sext %s to i64", wide, fn.typed(i.Src))
+		fn.emit("%s = inttoptr i64 %s to %s", fn.define(i.Dst), wide, llvmType(to))
+		return
+	case types.IsPointer(from) && types.IsInteger(to):
+		op = "ptrtoint"
+	case types.IsPointer(from) && types.IsPointer(to):
+		op = "bitcast"
+	default:
+		fn.g.errorf("unsupported conversion from %v to %v", from, to)
+		return
+	}
+	src := fn.typed(i.Src)
+	fn.emit("%s = %s %s to %s", fn.define(i.Dst), op, src, llvmType(to))
+}
@@ -0,0 +1,53 @@
+package llvm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGenerateLoop(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int x) { int s = 0; while (x) { s = s + x; x = x - 1; } return s; }")
+	assert.Equal(`define i32 @f(i32 %x) {
+.entry:
+  br label %.L1
+.L1:
+  %x.0 = phi i32 [ %x, %.entry ], [ %.3, %.L2 ]
+  %s.0 = phi i32 [ 0, %.entry ], [ %.2, %.L2 ]
+  %.tmp1 = icmp ne i32 %x.0, 0
+  br i1 %.tmp1, label %.L2, label %.L3
+.L2:
+  %.2 = add i32 %s.0, %x.0
+  %.3 = sub i32 %x.0, 1
+  br label %.L1
+.L3:
+  ret i32 %s.0
+}
+`, asm)
+}
+
+func TestGenerateJoin(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { int b = 1; if (a) b = 2; else b = 3; return b; }")
+	assert.Contains(asm, "  %b.0 = phi i32 [ 2, %.L1 ], [ 3, %.L2 ]\n  ret i32 %b.0\n")
+}
+
+func TestGenerateUndefined(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { int b; if (a) b = 2; return b; }")
+	assert.Contains(asm, "  %b.0 = phi i32 [ undef, %.entry ], [ 2, %.L1 ]\n")
+}
+
+func TestGenerateSwitch(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a) {
+  switch (a) { case 1: return 1; case -2: return 2; default: return 3; }
+}`)
+	assert.Contains(asm, "  switch i32 %a, label %.L3 [ i32 1, label %.L1 i32 -2, label %.L2 ]\n")
+}
+
+func TestGenerateUnreachableCode(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f() { return 1; return 2; }")
+	assert.Contains(asm, ".entry:\n  ret i32 1\n.dead1:\n  ret i32 2\n")
+}
@@ -0,0 +1,270 @@
+// Package llvm generates textual LLVM IR from the intermediate
+// representation, to be optimized and compiled by LLVM's tools.
+//
+// The temporaries of a function, which may be assigned many times, are
+// translated to SSA values, with a phi node at the start of a basic block for
+// each temporary which is live there and may have been assigned by more than
+// one predecessor. A temporary which is read before it is assigned is undef.
+// Each slot is an alloca in the entry block. Pointer types are written in the
+// typed form, such as i32*, which versions of LLVM with opaque pointers also
+// accept.
+package llvm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+type generator struct {
+	w   *bufio.Writer
+	err error
+	pos token.Position // The position of the code being compiled, if known.
+}
+
+// Generate writes the LLVM IR module for a program to w.
+func Generate(w io.Writer, program *ir.Program) error {
+	g := &generator{w: bufio.NewWriter(w)}
+	g.program(program)
+	if g.err != nil {
+		return g.err
+	}
+	return g.w.Flush()
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	if g.err == nil {
+		_, g.err = fmt.Fprintf(g.w, format, args...)
+	}
+}
+
+// errorf records an error for an instruction which cannot be compiled, at
+// its position.
+func (g *generator) errorf(format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = &ir.Error{Pos: g.pos, Msg: fmt.Sprintf(format, args...)}
+	}
+}
+
+// llvmType returns the LLVM type of values of type t.
+func llvmType(t types.Type) string {
+	switch t := t.(type) {
+	case *types.Pointer:
+		return llvmType(t.Elem) + "*"
+	case *types.Array:
+		return fmt.Sprintf("[%d x %s]", t.Len, llvmType(t.Elem))
+	case *types.Struct:
+		return "%struct." + t.Tag
+	}
+	switch {
+	case t == types.Float:
+		return "float"
+	case t == types.Double:
+		return "double"
+	case types.IsInteger(t):
+		return fmt.Sprintf("i%d", types.Width(t))
+	}
+	return "i32"
+}
+
+func (g *generator) program(program *ir.Program) {
+	g.structs(program)
+	g.globals(program.Globals)
+	g.strings(program.Strings)
+	for i, f := range program.Functions {
+		if i > 0 {
+			g.printf("\n")
+		}
+		newFunction(g, f).generate()
+	}
+	g.declarations(program)
+}
+
+// structs emits a definition of each struct type which the program uses, in
+// order of first use.
+func (g *generator) structs(program *ir.Program) {
+	var structs []*types.Struct
+	seen := make(map[*types.Struct]bool)
+	var use func(t types.Type)
+	use = func(t types.Type) {
+		switch t := t.(type) {
+		case *types.Pointer:
+			use(t.Elem)
+		case *types.Array:
+			use(t.Elem)
+		case *types.Struct:
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+			structs = append(structs, t)
+			for _, f := range t.Fields {
+				use(f.Type)
+			}
+		}
+	}
+	for _, f := range program.Functions {
+		for _, t := range f.Temps {
+			use(t.Type())
+		}
+		for _, s := range f.Slots {
+			use(s.Type)
+		}
+	}
+	for _, s := range structs {
+		fields := make([]string, len(s.Fields))
+		for i, f := range s.Fields {
+			fields[i] = llvmType(f.Type)
+		}
+		g.printf("%s = type { %s }\n", llvmType(s), strings.Join(fields, ", "))
+	}
+	if len(structs) > 0 {
+		g.printf("\n")
+	}
+}
+
+// globals emits a definition of each global variable, which has internal
+// linkage if it is static, or a declaration of one which is extern. Those
+// without an initial value are zero-initialized.
+func (g *generator) globals(globals []*ir.Global) {
+	for _, v := range globals {
+		if v.Extern {
+			g.printf("@%s = external global %s, align %d\n", v.Name, llvmType(v.Type),
+				types.LP64.Alignof(v.Type))
+			continue
+		}
+		init := "zeroinitializer"
+		if v.Init != nil {
+			init, _ = constant(v.Init)
+		}
+		g.printf("@%s = %sglobal %s %s, align %d\n", v.Name, linkage(v.Static),
+			llvmType(v.Type), init, types.LP64.Alignof(v.Type))
+	}
+	if len(globals) > 0 {
+		g.printf("\n")
+	}
+}
+
+// linkage returns the linkage of a global variable or function, followed by
+// a space, which is internal if it is static, and otherwise the default.
+func linkage(static bool) string {
+	if static {
+		return "internal "
+	}
+	return ""
+}
+
+// strings emits a constant for each string literal. Its address is not
+// significant, so identical constants may be merged.
+func (g *generator) strings(strings []*ir.Global) {
+	for _, v := range strings {
+		g.printf("%s = private unnamed_addr constant %s c\"%s\", align 1\n",
+			globalName(v), llvmType(v.Type), escape(v.Data))
+	}
+	if len(strings) > 0 {
+		g.printf("\n")
+	}
+}
+
+// escape formats the characters of a string constant, writing the quote,
+// the backslash, and non-printable characters as hexadecimal escapes.
+func escape(data string) string {
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, "\\%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// globalName returns the name of a global: that of a string literal is
+// prefixed with ".", so that it is distinct from those of variables.
+func globalName(v *ir.Global) string {
+	if v.Data != "" {
+		return "@." + v.Name
+	}
+	return "@" + v.Name
+}
+
+// declarations emits a declaration of each function which is called but not
+// defined, with the signature of its first call, in order of name. A variadic
+// function is declared with the parameters that its fixed arguments are
+// passed to.
+func (g *generator) declarations(program *ir.Program) {
+	defined := make(map[string]bool)
+	for _, f := range program.Functions {
+		defined[f.Name] = true
+	}
+	calls := make(map[string]*ir.Call)
+	var names []string
+	for _, f := range program.Functions {
+		for _, instr := range f.Instrs {
+			if c, ok := instr.(*ir.Call); ok && !defined[c.Function] && calls[c.Function] == nil {
+				calls[c.Function] = c
+				names = append(names, c.Function)
+			}
+		}
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if i == 0 {
+			g.printf("\n")
+		}
+		c := calls[name]
+		g.printf("declare %s @%s(%s)\n", llvmType(c.Dst.Type()), name, paramTypes(c))
+	}
+}
+
+// paramTypes returns the parameter types of the function that a call calls,
+// which are those of its fixed arguments, followed by "..." if the function
+// is variadic.
+func paramTypes(c *ir.Call) string {
+	args := c.Args
+	if c.Variadic {
+		args = args[:c.Fixed]
+	}
+	params := make([]string, len(args))
+	for i, a := range args {
+		params[i] = llvmType(a.Type())
+	}
+	if c.Variadic {
+		params = append(params, "...")
+	}
+	return strings.Join(params, ", ")
+}
+
+// constant formats a constant operand. Floating-point constants are written
+// as the hexadecimal bits of a double, which is exact for both types.
+func constant(v ir.Value) (string, bool) {
+	switch v := v.(type) {
+	case *ir.IntConst:
+		if types.IsPointer(v.Type()) {
+			return "null", true
+		}
+		return fmt.Sprintf("%d", signed(v.Value, v.Type())), true
+	case *ir.FloatConst:
+		value := v.Value
+		if v.Type() == types.Float {
+			value = float64(float32(value))
+		}
+		return fmt.Sprintf("0x%016X", math.Float64bits(value)), true
+	}
+	return "", false
+}
+
+// signed returns the value of an integer of type t, which is written signed
+// whether or not the type is, since LLVM's integer types have no sign.
+func signed(v int64, t types.Type) int64 {
+	shift := 64 - types.Width(t)
+	return v << shift >> shift
+}
@@ -0,0 +1,267 @@
+package llvm
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// generate compiles a program to LLVM IR.
+func generate(t *testing.T, input string) string {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	lowered, err := ir.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := Generate(&b, lowered); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestGenerateReturn(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`define i32 @main() {
+.entry:
+  ret i32 2
+}
+`, generate(t, "int main() { return 2; }"))
+}
+
+func TestGenerateDeclarations(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int putchar(int c);
+double g(int a, double b);
+int main() { putchar(65); g(1, 2.5); return 0; }`)
+	assert.Contains(asm, "  %.0 = call i32 @putchar(i32 65)\n")
+	assert.Contains(asm, "  %.1 = call double @g(i32 1, double 0x4004000000000000)\n")
+	assert.Contains(asm, "}\n\ndeclare double @g(i32, double)\ndeclare i32 @putchar(i32)\n")
+}
+
+func TestGenerateArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a, int b) { return a / b % 3 - a; }")
+	assert.Equal(`define i32 @f(i32 %a, i32 %b) {
+.entry:
+  %.2 = sdiv i32 %a, %b
+  %.3 = srem i32 %.2, 3
+  %.4 = sub i32 %.3, %a
+  ret i32 %.4
+}
+`, asm)
+	asm = generate(t, "double f(double a) { return a * 0.5; }")
+	assert.Contains(asm, "  %.1 = fmul double %a, 0x3FE0000000000000\n")
+}
+
+func TestGenerateShift(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a, int b) { return (a << b) >> 33; }")
+	// The count is taken modulo 32.
+	assert.Contains(asm, "  %.tmp1 = and i32 %b, 31\n  %.2 = shl i32 %a, %.tmp1\n")
+	assert.Contains(asm, "  %.3 = ashr i32 %.2, 1\n")
+}
+
+func TestGenerateUnaryOps(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { return -~a; }")
+	assert.Contains(asm, "  %.1 = xor i32 %a, -1\n  %.2 = sub i32 0, %.1\n")
+	asm = generate(t, "float f(float a) { return -a; }")
+	assert.Contains(asm, "  %.1 = fneg float %a\n")
+}
+
+func TestGenerateComparison(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { return a <= 2; }")
+	assert.Contains(asm, "  %.tmp1 = icmp sle i32 %a, 2\n  %.1 = zext i1 %.tmp1 to i32\n")
+	asm = generate(t, "int f(float a) { return a != 0.1f; }")
+	// Constants are exact: 0.1 as a float, widened to a double.
+	assert.Contains(asm, "  %.tmp1 = fcmp une float %a, 0x3FB99999A0000000\n")
+}
+
+func TestGenerateConversions(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int i) { double d = i; float f = d; return f; }")
+	assert.Contains(asm, `  %.2 = sitofp i32 %i to double
+  %.4 = fptrunc double %.2 to float
+  %.5 = fptosi float %.4 to i32
+`)
+	asm = generate(t, "double f(float a) { return a; }")
+	assert.Contains(asm, "  %.1 = fpext float %a to double\n")
+}
+
+func TestGenerateCasts(t *testing.T) {
+	assert := assert.New(t)
+	// An int is sign-extended to the width of a pointer.
+	asm := generate(t, "int f(int x, char *p) { int *q = (int *)x; return (char)x + (int)(p == (char *)q); }")
+	assert.Contains(asm, `  %.tmp1 = sext i32 %x to i64
+  %.3 = inttoptr i64 %.tmp1 to i32*
+  %.4 = trunc i32 %x to i8
+  %.5 = sext i8 %.4 to i32
+  %.6 = bitcast i32* %.3 to i8*
+`)
+	asm = generate(t, "int f(int *p) { return (int)p + (int)(int)1; }")
+	assert.Contains(asm, "  %.1 = ptrtoint i32* %p to i32\n  %.2 = add i32 %.1, 1\n")
+}
+
+func TestGenerateUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(unsigned a, unsigned b, int *p) {
+  return a / b + a % b + (a >> b) + (a < b) + p[a] + (int)a;
+}`)
+	for _, op := range []string{"udiv i32 %a, %b", "urem i32 %a, %b", "lshr i32 %a, %.tmp1",
+		"icmp ult i32 %a, %b"} {
+		assert.Contains(asm, " = "+op+"\n")
+	}
+	// An unsigned index is zero-extended, and a conversion to int keeps its
+	// bits.
+	assert.Contains(asm, " = zext i32 %a to i64\n")
+	assert.Contains(asm, " = getelementptr i32, i32* %p, i64 %.tmp")
+	assert.NotContains(asm, "trunc i32")
+
+	asm = generate(t, "unsigned f(double d) { return d + (unsigned)d; }")
+	assert.Contains(asm, "  %.tmp1 = fptosi double %d to i64\n  %.1 = trunc i64 %.tmp1 to i32\n")
+	assert.Contains(asm, " = uitofp i32 %.1 to double\n")
+}
+
+func TestGenerateIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `long f(long a, unsigned short b, short *s) {
+  *s = a;
+  return (a >> b) + (unsigned long)b + (a < 2L);
+}`)
+	assert.Contains(asm, "define i64 @f(i64 %a, i16 %b, i16* %s)")
+	assert.Contains(asm, " = trunc i64 %a to i16\n")
+	assert.Contains(asm, " = zext i16 %b to i32\n")
+	assert.Contains(asm, " = icmp slt i64 %a, 2\n")
+	// The count of a shift is given the type of the value shifted.
+	assert.Contains(asm, " = zext i32 %.4 to i64\n  %.tmp2 = and i64 %.tmp1, 63\n")
+
+	asm = generate(t, "unsigned long x = -1; short y = -2; double f(unsigned long a) { return a; }")
+	assert.Contains(asm, "@x = global i64 -1, align 8\n")
+	assert.Contains(asm, "@y = global i16 -2, align 2\n")
+	assert.Contains(asm, " = uitofp i64 %a to double\n")
+}
+
+func TestGenerateSelect(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { return a ? 3 : 4; }")
+	assert.Contains(asm, "  %.tmp1 = icmp ne i32 %a, 0\n  %.1 = select i1 %.tmp1, i32 3, i32 4\n")
+}
+
+func TestConstant(t *testing.T) {
+	assert := assert.New(t)
+	c, ok := constant(ir.NewInt(-1, types.Int))
+	assert.True(ok)
+	assert.Equal("-1", c)
+	c, _ = constant(ir.NewFloat(1, types.Double))
+	assert.Equal("0x3FF0000000000000", c)
+	c, _ = constant(ir.NewInt(0, types.NewPointer(types.Int)))
+	assert.Equal("null", c)
+	_, ok = constant((&ir.Function{}).NewTemp(types.Int))
+	assert.False(ok)
+}
+
+func TestGenerateUnsupportedInstruction(t *testing.T) {
+	assert := assert.New(t)
+	f := &ir.Function{Name: "main", Result: types.Double}
+	d := f.NewTemp(types.Double)
+	f.Emit(&ir.Unary{Op: ir.Not, Dst: d, Src: d})
+	f.Emit(&ir.Return{Value: d})
+	var b bytes.Buffer
+	err := Generate(&b, &ir.Program{Functions: []*ir.Function{f}})
+	assert.EqualError(err, "unsupported instruction %0:double = not %0")
+}
+
+func TestGenerateMemory(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 1; int *p = &a; *p = 2; return *p; }")
+	assert.Contains(asm, `.entry:
+  %a.addr = alloca i32
+  store i32 1, i32* %a.addr
+  store i32 2, i32* %a.addr
+  %.3 = load i32, i32* %a.addr
+`)
+}
+
+func TestGeneratePointerArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int *p, int *q) { return (p + 1) - q + (p < q) + (p == 0); }")
+	assert.Contains(asm, "define i32 @f(i32* %p, i32* %q) {\n")
+	assert.Contains(asm, `  %.2 = getelementptr i32, i32* %p, i32 1
+  %.tmp1 = ptrtoint i32* %.2 to i64
+  %.tmp2 = ptrtoint i32* %q to i64
+  %.tmp3 = sub i64 %.tmp1, %.tmp2
+  %.tmp4 = sdiv exact i64 %.tmp3, ptrtoint (i32* getelementptr (i32, i32* null, i32 1) to i64)
+  %.3 = trunc i64 %.tmp4 to i32
+  %.tmp5 = icmp ult i32* %p, %q
+`)
+	assert.Contains(asm, "  %.tmp6 = icmp eq i32* %p, null\n")
+}
+
+func TestGenerateArrays(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a[5]; a[1] = 2; return a[1]; }")
+	assert.Contains(asm, "  %a.addr = alloca [5 x i32]\n")
+	assert.Contains(asm, "bitcast [5 x i32]* %a.addr to i32*\n")
+}
+
+func TestGenerateStructs(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `struct n { int v; struct n *next; double d[2]; };
+int main() { struct n a; a.next = &a; return a.next->v; }`)
+	assert.Contains(asm, "%struct.n = type { i32, %struct.n*, [2 x double] }\n\n")
+	assert.Contains(asm, "  %a.addr = alloca %struct.n\n")
+	assert.Contains(asm, " = getelementptr %struct.n, %struct.n* %a.addr, i32 0, i32 1\n")
+}
+
+func TestGenerateGlobals(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int a = 3; double d = 0.5; int b[2]; int main() { b[1] = a; return a; }")
+	assert.Contains(asm, "@a = global i32 3, align 4\n"+
+		"@d = global double 0x3FE0000000000000, align 8\n"+
+		"@b = global [2 x i32] zeroinitializer, align 4\n\n")
+	assert.Contains(asm, " = load i32, i32* @a\n")
+	assert.Contains(asm, "bitcast [2 x i32]* @b to i32*\n")
+}
+
+func TestGenerateLinkage(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `extern int n; static int count = 2;
+static int f(int x) { return x; }
+int main() { return f(count) + n; }`)
+	assert.Contains(asm, "@n = external global i32, align 4\n"+
+		"@count = internal global i32 2, align 4\n")
+	assert.Contains(asm, "define internal i32 @f(i32 %x) {\n")
+	assert.Contains(asm, "define i32 @main() {\n")
+}
+
+func TestGenerateStrings(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int puts(char *s); int main() { puts("hi\n"); return puts("hi\n"); }`)
+	assert.Contains(asm, "@.str.0 = private unnamed_addr constant [4 x i8] c\"hi\\0A\\00\", align 1\n")
+	assert.NotContains(asm, "@.str.1")
+	assert.Contains(asm, " = bitcast [4 x i8]* @.str.0 to i8*\n")
+}
+
+func TestGenerateVariadicCall(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int printf(char *format, ...);
+int main() { char c = 'a'; return printf("%c %f", c, 1.5f); }`)
+	assert.Contains(asm, "declare i32 @printf(i8*, ...)\n")
+	// The variable arguments are promoted.
+	assert.Contains(asm, "  %.4 = sext i8 %.1 to i32\n")
+	assert.Contains(asm, "  %.5 = fpext float 0x3FF8000000000000 to double\n")
+	assert.Contains(asm, "  %.6 = call i32 (i8*, ...) @printf(i8* %.3, i32 %.4, double %.5)\n")
+}
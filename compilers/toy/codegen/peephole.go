@@ -0,0 +1,210 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Peephole is an Option which runs the peephole optimizer over the assembly
+// of the program, removing instructions which the code generator emits
+// because it compiles each IR instruction on its own.
+func Peephole(g *generator) {
+	g.peephole = true
+}
+
+// transparent returns whether a line is a directive which does not separate
+// the instructions either side of it, as it does not emit code or describe
+// the state of the machine between them.
+func transparent(l Line) bool {
+	d, ok := l.(Directive)
+	return ok && strings.HasPrefix(string(d), ".loc ")
+}
+
+// peephole optimizes the lines of the assembly of a program, repeating
+// until none of its rules apply:
+//
+//   - A move which undoes or repeats the move before it, as in "movq %rax,
+//     %rsi; movq %rsi, %rax", is removed. A 32-bit move to a register
+//     writes the whole 64-bit register, clearing its upper half, so it
+//     never undoes another.
+//   - A push of a register followed by a pop of it is removed, and a push
+//     followed by a pop of another register becomes a move.
+//   - A jump to a label which follows it is removed.
+//   - An addition or subtraction of zero is removed, unless the instruction
+//     after it reads the flags which it sets, or it is a 32-bit one of a
+//     register, which clears the upper half of the register.
+func peephole(lines []Line) []Line {
+	lines = append([]Line(nil), lines...)
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(lines); i++ {
+			instr, ok := lines[i].(Instr)
+			if !ok {
+				continue
+			}
+			var replaced []Line
+			n := 0
+			next, j := nextInstruction(lines, i)
+			switch {
+			case isZeroArithmetic(instr) && !readsFlags(next):
+				n = 1
+			case redundantMove(instr, next):
+				// Keep the first move, and the directives between them.
+				replaced, n = lines[i:j], j+1-i
+			case instr.Op == "pushq" && next.Op == "popq":
+				if src, dst := instr.Args[0], next.Args[0]; src != dst {
+					replaced = []Line{Instr{"movq", []Operand{src, dst}}}
+				}
+				n = j + 1 - i
+			case isJump(instr) && jumpsToNext(lines, i):
+				n = 1
+			default:
+				continue
+			}
+			lines = append(lines[:i], append(append([]Line{}, replaced...), lines[i+n:]...)...)
+			changed = true
+			i--
+		}
+	}
+	return lines
+}
+
+// nextInstruction returns the instruction which follows line i, and its
+// index, if only transparent directives are between them. Otherwise, it
+// returns an empty instruction.
+func nextInstruction(lines []Line, i int) (Instr, int) {
+	for j := i + 1; j < len(lines); j++ {
+		if instr, ok := lines[j].(Instr); ok {
+			return instr, j
+		}
+		if !transparent(lines[j]) {
+			return Instr{}, j
+		}
+	}
+	return Instr{}, len(lines)
+}
+
+// The moves which copy a value without changing it.
+var moves = map[string]bool{
+	"movl": true, "movq": true, "movss": true, "movsd": true, "movaps": true,
+}
+
+// redundantMove returns whether the second of two moves copies a value back
+// to where the first copied it from, or copies it again, so it has no effect.
+// This is not so if the first overwrites a register which the address of its
+// source uses, or if the second is a 32-bit move to a register, which
+// zero-extends the value, where the upper half of the register which the
+// first copied from may be set.
+func redundantMove(first, second Instr) bool {
+	if !moves[first.Op] || second.Op != first.Op ||
+		len(first.Args) != 2 || len(second.Args) != 2 {
+		return false
+	}
+	src, dst := first.Args[0], first.Args[1]
+	undoes := second.Args[0] == dst && second.Args[1] == src
+	repeats := second.Args[0] == src && second.Args[1] == dst
+	if _, toReg := second.Args[1].(Reg); undoes && toReg && first.Op == "movl" {
+		return false
+	}
+	if !undoes && !repeats {
+		return false
+	}
+	m, ok := src.(Mem)
+	r, isReg := dst.(Reg)
+	return !ok || !isReg || !sameRegister(m.Base, r) && !sameRegister(m.Index, r)
+}
+
+// sameRegister returns whether two registers are parts of the same register,
+// such as %eax and %rax.
+func sameRegister(a, b Reg) bool {
+	return registerFamily(a) == registerFamily(b)
+}
+
+// registerFamily returns the 64-bit name of a general purpose register, such
+// as %rax for %eax, %ax or %al. Other registers are returned unchanged.
+func registerFamily(r Reg) Reg {
+	if quad, ok := registerFamilies[r]; ok {
+		return quad
+	}
+	return r
+}
+
+// The 64-bit name of each name of a part of a general purpose register.
+var registerFamilies = func() map[Reg]Reg {
+	families := make(map[Reg]Reg)
+	for _, names := range [][]Reg{
+		{"rax", "eax", "ax", "al"}, {"rbx", "ebx", "bx", "bl"},
+		{"rcx", "ecx", "cx", "cl"}, {"rdx", "edx", "dx", "dl"},
+		{"rsi", "esi", "si", "sil"}, {"rdi", "edi", "di", "dil"},
+		{"rbp", "ebp", "bp", "bpl"}, {"rsp", "esp", "sp", "spl"},
+	} {
+		for _, name := range names {
+			families[name] = names[0]
+		}
+	}
+	for n := 8; n <= 15; n++ {
+		quad := Reg(fmt.Sprintf("r%d", n))
+		for _, suffix := range []Reg{"", "d", "w", "b"} {
+			families[quad+suffix] = quad
+		}
+	}
+	return families
+}()
+
+// isZeroArithmetic returns whether an instruction adds or subtracts zero,
+// without changing its destination. One of 32 bits changes a register, since
+// it clears the register's upper half.
+func isZeroArithmetic(i Instr) bool {
+	switch i.Op {
+	case "addl", "subl":
+		_, toReg := i.Args[1].(Reg)
+		return i.Args[0] == Imm(0) && !toReg
+	case "addq", "subq":
+		return i.Args[0] == Imm(0)
+	}
+	return false
+}
+
+// readsFlags returns whether an instruction reads the condition flags: a
+// conditional jump, set or move, or an addition or subtraction with carry.
+func readsFlags(i Instr) bool {
+	m := i.Op
+	switch {
+	case m == "":
+		// The flags may be read after a label or directive.
+		return true
+	case m == "jmp":
+		return false
+	}
+	for _, prefix := range []string{"j", "set", "cmov", "adc", "sbb"} {
+		if strings.HasPrefix(m, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJump returns whether an instruction is a jump to a label.
+func isJump(i Instr) bool {
+	if len(i.Args) != 1 {
+		return false
+	}
+	_, ok := i.Args[0].(Sym)
+	return strings.HasPrefix(i.Op, "j") && ok
+}
+
+// jumpsToNext returns whether the jump at line i is to one of the labels
+// which follow it, before any other instruction.
+func jumpsToNext(lines []Line, i int) bool {
+	target := Label(lines[i].(Instr).Args[0].(Sym))
+	for j := i + 1; j < len(lines); j++ {
+		l, isLabel := lines[j].(Label)
+		switch {
+		case l == target:
+			return true
+		case !isLabel && !transparent(lines[j]):
+			return false
+		}
+	}
+	return false
+}
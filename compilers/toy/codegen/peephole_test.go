@@ -0,0 +1,99 @@
+package codegen
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// instructions returns the number of instructions in a listing.
+func instructions(asm string) int {
+	n := 0
+	for _, line := range strings.Split(asm, "\n") {
+		if strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "\t.") {
+			n++
+		}
+	}
+	return n
+}
+
+// att returns the text of lines in AT&T syntax.
+func att(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(printLine(attPrinter{}, l) + "\n")
+	}
+	return b.String()
+}
+
+func TestPeephole(t *testing.T) {
+	assert := assert.New(t)
+	i := func(op string, args ...Operand) Instr { return Instr{op, args} }
+	loc := Directive(".loc 1 2 3")
+	esi, rsi := Reg("esi"), Reg("rsi")
+	for _, test := range []struct {
+		input []Line
+		want  string
+	}{
+		// A move back or again is removed, unless the first move changed its
+		// address.
+		{[]Line{i("movq", rax, rsi), i("movq", rsi, rax)}, "\tmovq %rax, %rsi\n"},
+		{[]Line{i("movq", rax, memory(-8, rbp)), loc, i("movq", memory(-8, rbp), rax)},
+			"\tmovq %rax, -8(%rbp)\n\t.loc 1 2 3\n"},
+		{[]Line{i("movq", memory(0, rax), rax), i("movq", rax, memory(0, rax))},
+			"\tmovq (%rax), %rax\n\tmovq %rax, (%rax)\n"},
+		{[]Line{i("movl", Mem{Base: rax, Index: rcx, Scale: 4}, ecx), i("movl", ecx, Mem{Base: rax, Index: rcx, Scale: 4})},
+			"\tmovl (%rax,%rcx,4), %ecx\n\tmovl %ecx, (%rax,%rcx,4)\n"},
+		{[]Line{i("movl", eax, esi), i("movq", rsi, rax)}, "\tmovl %eax, %esi\n\tmovq %rsi, %rax\n"},
+		{[]Line{i("movsd", xmm0, memory(-8, rbp)), i("movsd", xmm0, memory(-8, rbp))}, "\tmovsd %xmm0, -8(%rbp)\n"},
+		{[]Line{i("movl", memory(0, rax), eax), i("movl", memory(0, rax), eax)},
+			"\tmovl (%rax), %eax\n\tmovl (%rax), %eax\n"},
+		// A 32-bit move back to a register clears its upper half.
+		{[]Line{i("movl", eax, esi), i("movl", esi, eax)}, "\tmovl %eax, %esi\n\tmovl %esi, %eax\n"},
+		{[]Line{i("movl", eax, memory(-8, rbp)), i("movl", memory(-8, rbp), eax)},
+			"\tmovl %eax, -8(%rbp)\n\tmovl -8(%rbp), %eax\n"},
+		{[]Line{i("movl", eax, esi), i("movl", eax, esi)}, "\tmovl %eax, %esi\n"},
+		// Chains of moves collapse.
+		{[]Line{i("movq", rax, rsi), i("movq", rsi, rax), i("movq", rsi, rax), i("movq", rax, rsi)},
+			"\tmovq %rax, %rsi\n"},
+		// A push and pop.
+		{[]Line{i("pushq", rax), i("popq", rax), i("ret")}, "\tret\n"},
+		{[]Line{i("pushq", rax), i("popq", rcx)}, "\tmovq %rax, %rcx\n"},
+		{[]Line{i("pushq", rbp), Directive(".cfi_def_cfa_offset 16"), i("popq", rbp)},
+			"\tpushq %rbp\n\t.cfi_def_cfa_offset 16\n\tpopq %rbp\n"},
+		// A jump to the next instruction.
+		{[]Line{i("jmp", Sym(".L1")), Label(".L2"), Label(".L1"), i("ret")}, ".L2:\n.L1:\n\tret\n"},
+		{[]Line{i("je", Sym(".L1")), Label(".L1")}, ".L1:\n"},
+		{[]Line{i("jmp", Sym(".L1")), i("ret"), Label(".L1")}, "\tjmp .L1\n\tret\n.L1:\n"},
+		{[]Line{i("jmp", Indirect{rax})}, "\tjmp *%rax\n"},
+		// Arithmetic with zero, unless its flags are used or it clears the upper
+		// half of a register.
+		{[]Line{i("addq", Imm(0), rax), i("subl", Imm(0), memory(-8, rbp)), i("ret")}, "\tret\n"},
+		{[]Line{i("addl", Imm(0), eax), i("ret")}, "\taddl $0, %eax\n\tret\n"},
+		{[]Line{i("addl", Imm(0), eax), i("sete", al)}, "\taddl $0, %eax\n\tsete %al\n"},
+		{[]Line{i("addl", Imm(1), eax)}, "\taddl $1, %eax\n"},
+		// Removing one instruction may expose another.
+		{[]Line{i("movq", rax, rsi), i("addq", Imm(0), rsi), i("movq", rsi, rax), i("jmp", Sym(".L1")), Label(".L1")},
+			"\tmovq %rax, %rsi\n.L1:\n"},
+	} {
+		assert.Equal(test.want, att(peephole(test.input)), "%q", att(test.input))
+	}
+}
+
+func TestGeneratePeephole(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main() {
+  long a = 1;
+  while (a < 10)
+    a = a * 2;
+  return a;
+}`
+	unoptimized := generate(t, input)
+	optimized := generate(t, input, Peephole)
+	assert.True(instructions(optimized) < instructions(unoptimized), optimized)
+	assert.NotContains(optimized, "\tmovq %rax, %rsi\n\tmovq %rsi, %rax\n")
+
+	// Labels and directives are kept.
+	assert.Contains(optimized, "main:\n")
+	assert.Contains(optimized, "\t.section .note.GNU-stack,\"\",@progbits\n")
+}
@@ -0,0 +1,248 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IntelSyntax is an Option which writes the assembly in Intel syntax, as
+// selected by the .intel_syntax noprefix directive, rather than AT&T syntax:
+// the destination of an instruction is its first operand rather than its
+// last, registers and immediates have no prefix, and the size of the
+// operands is given by that of a memory operand, as in "DWORD PTR [rbp-8]",
+// rather than by a suffix of the mnemonic.
+func IntelSyntax(g *generator) {
+	g.printer = intelPrinter{}
+}
+
+// A printer writes instructions in the syntax of an assembler. Labels and
+// directives are the same in every syntax.
+type printer interface {
+	// header returns the lines which precede the program.
+	header() string
+	// instr returns the text of an instruction.
+	instr(i Instr) string
+}
+
+// printLine returns the text of a line, in the syntax of a printer.
+func printLine(p printer, l Line) string {
+	switch l := l.(type) {
+	case Instr:
+		return "\t" + p.instr(l)
+	case Label:
+		return string(l) + ":"
+	case Directive:
+		return "\t" + string(l)
+	}
+	panic(fmt.Sprintf("unknown line %T", l))
+}
+
+// instrText returns the text of an instruction with a mnemonic and operands.
+func instrText(mnemonic string, operands []string) string {
+	if len(operands) == 0 {
+		return mnemonic
+	}
+	return mnemonic + " " + strings.Join(operands, ", ")
+}
+
+// An attPrinter writes instructions in AT&T syntax, as used by GNU as.
+type attPrinter struct{}
+
+func (attPrinter) header() string { return "" }
+
+func (attPrinter) instr(i Instr) string {
+	operands := make([]string, len(i.Args))
+	for j, a := range i.Args {
+		operands[j] = attOperand(a)
+	}
+	return instrText(i.Op, operands)
+}
+
+// attOperand returns the AT&T syntax of an operand.
+func attOperand(o Operand) string {
+	switch o := o.(type) {
+	case Reg:
+		return "%" + string(o)
+	case Imm:
+		return fmt.Sprintf("$%d", int64(o))
+	case Sym:
+		return string(o)
+	case Indirect:
+		return "*" + attOperand(o.Target)
+	case Mem:
+		s := o.Sym
+		if o.Seg != "" {
+			s = "%" + string(o.Seg) + ":" + s
+		}
+		if o.Disp != 0 && o.Sym != "" {
+			s += fmt.Sprintf("%+d", o.Disp)
+		} else if o.Disp != 0 || s == "" && o.Base == "" && o.Index == "" {
+			s += fmt.Sprint(o.Disp)
+		}
+		switch {
+		case o.Index != "":
+			s += fmt.Sprintf("(%s,%s,%d)", attOperand(o.Base), attOperand(o.Index), o.Scale)
+		case o.Base != "":
+			s += "(" + attOperand(o.Base) + ")"
+		}
+		return s
+	}
+	panic(fmt.Sprintf("unknown operand %T", o))
+}
+
+// An intelPrinter writes instructions in Intel syntax.
+type intelPrinter struct{}
+
+func (intelPrinter) header() string { return "\t.intel_syntax noprefix\n" }
+
+func (intelPrinter) instr(i Instr) string {
+	mnemonic, size := intelMnemonic(i)
+	var operands []string
+	for j := len(i.Args) - 1; j >= 0; j-- {
+		operands = append(operands, intelOperand(i.Args[j], size))
+	}
+	return instrText(mnemonic, operands)
+}
+
+// intelReserved matches the names which Intel syntax gives to registers and
+// to the offset and flat operators, in any case. The assembler takes an
+// operand with such a name to be the register or operator, so no symbol can
+// have one.
+var intelReserved = regexp.MustCompile(`(?i)^([re]?(ax|bx|cx|dx|si|di|sp|bp)|[re]ip|` +
+	`[abcd][lh]|(si|di|sp|bp)l|r([89]|1[0-5])[dwb]?|[xyz]mm([0-9]|[12][0-9]|3[01])|` +
+	`mm[0-7]|k[0-7]|tmm[0-7]|bnd[0-3]|[cd]r([0-9]|1[0-5])|st|[cdefgs]s|offset|flat)$`)
+
+// checkSymbol reports a symbol which the syntax of the assembly cannot refer
+// to.
+func (g *generator) checkSymbol(name string) {
+	if _, ok := g.printer.(intelPrinter); ok && intelReserved.MatchString(name) {
+		g.errorf("symbol %s is the name of a register or operator in Intel syntax", name)
+	}
+}
+
+// The Intel mnemonics of AT&T mnemonics which differ other than by a size
+// suffix, and the size of their memory operands.
+var intelMnemonics = map[string]struct{ mnemonic, size string }{
+	"cltd":      {"cdq", ""},
+	"cqto":      {"cqo", ""},
+	"cltq":      {"cdqe", ""},
+	"movslq":    {"movsxd", "DWORD"},
+	"movsbl":    {"movsx", "BYTE"},
+	"movsbq":    {"movsx", "BYTE"},
+	"movzbl":    {"movzx", "BYTE"},
+	"movzbq":    {"movzx", "BYTE"},
+	"movswl":    {"movsx", "WORD"},
+	"movzwl":    {"movzx", "WORD"},
+	"movabsq":   {"movabs", ""},
+	"cvtsi2ssl": {"cvtsi2ss", "DWORD"},
+	"cvtsi2sdl": {"cvtsi2sd", "DWORD"},
+	"cvtsi2ssq": {"cvtsi2ss", "QWORD"},
+	"cvtsi2sdq": {"cvtsi2sd", "QWORD"},
+	"cvtss2sd":  {"cvtss2sd", "DWORD"},
+	"cvtsd2ss":  {"cvtsd2ss", "QWORD"},
+	"cvttss2si": {"cvttss2si", "DWORD"},
+	"cvttsd2si": {"cvttsd2si", "QWORD"},
+	"movaps":    {"movaps", "XMMWORD"},
+	"movd":      {"movd", "DWORD"},
+}
+
+// The Intel sizes of memory operands, by the suffix of an AT&T mnemonic.
+var intelSizes = map[byte]string{'b': "BYTE", 'w': "WORD", 'l': "DWORD", 'q': "QWORD"}
+
+// The integer instructions whose AT&T mnemonics have a size suffix.
+var suffixed = map[string]bool{
+	"mov": true, "add": true, "sub": true, "and": true, "or": true, "xor": true,
+	"cmp": true, "test": true, "neg": true, "not": true, "imul": true, "idiv": true,
+	"div": true, "mul": true, "inc": true, "dec": true, "sal": true, "sar": true,
+	"shl": true, "shr": true, "push": true, "pop": true, "lea": true, "bt": true,
+	"btc": true, "bts": true, "btr": true,
+}
+
+// intelMnemonic returns the Intel mnemonic of an instruction, and the size
+// of its memory operands, or "" if they have none, as an address of lea does
+// not.
+func intelMnemonic(i Instr) (string, string) {
+	m := i.Op
+	if n, ok := intelMnemonics[m]; ok {
+		return n.mnemonic, n.size
+	}
+	switch {
+	case m == "movq" && (isXMM(i.Args[0]) || isXMM(i.Args[1])):
+		// A move between an SSE register and an integer register or memory.
+		return m, "QWORD"
+	// These have no suffix, though some end with one of its letters, as
+	// "setl" does.
+	case strings.HasPrefix(m, "set"):
+		return m, "BYTE"
+	case m == "call" || strings.HasPrefix(m, "j") || strings.HasPrefix(m, "cmov"):
+		return m, ""
+	// The scalar SSE instructions of single and double precision.
+	case strings.HasSuffix(m, "ss"):
+		return m, "DWORD"
+	case strings.HasSuffix(m, "sd"):
+		return m, "QWORD"
+	}
+	if base := m[:len(m)-1]; suffixed[base] {
+		if base == "lea" {
+			return base, ""
+		}
+		return base, intelSizes[m[len(m)-1]]
+	}
+	return m, ""
+}
+
+// isXMM returns whether an operand is an SSE register.
+func isXMM(o Operand) bool {
+	r, ok := o.(Reg)
+	return ok && r.isXMM()
+}
+
+// intelOperand returns the Intel syntax of an operand, with the size of a
+// memory operand.
+func intelOperand(o Operand, size string) string {
+	switch o := o.(type) {
+	case Reg:
+		return string(o)
+	case Imm:
+		return fmt.Sprint(int64(o))
+	case Sym:
+		return string(o)
+	case Indirect:
+		return intelOperand(o.Target, size)
+	case Mem:
+		if o.Seg != "" {
+			return ptr(size, fmt.Sprintf("%s:%d", o.Seg, o.Disp))
+		}
+		var terms []string
+		if o.Base != "" {
+			terms = append(terms, string(o.Base))
+		}
+		if o.Index != "" && o.Scale != 1 {
+			terms = append(terms, fmt.Sprintf("%s*%d", o.Index, o.Scale))
+		} else if o.Index != "" {
+			terms = append(terms, string(o.Index))
+		}
+		if o.Sym != "" {
+			terms = append(terms, o.Sym)
+		}
+		address := strings.Join(terms, "+")
+		switch {
+		case o.Disp == 0 && address != "":
+		case o.Disp < 0 || address == "":
+			address += fmt.Sprint(o.Disp)
+		default:
+			address += fmt.Sprintf("+%d", o.Disp)
+		}
+		return ptr(size, "["+address+"]")
+	}
+	panic(fmt.Sprintf("unknown operand %T", o))
+}
+
+// ptr returns a memory operand with a size, if it has one.
+func ptr(size, op string) string {
+	if size == "" {
+		return op
+	}
+	return size + " PTR " + op
+}
@@ -0,0 +1,90 @@
+package codegen
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrinters(t *testing.T) {
+	assert := assert.New(t)
+	i := func(op string, args ...Operand) Instr { return Instr{op, args} }
+	rdx := Reg("rdx")
+	for _, test := range []struct {
+		line       Line
+		att, intel string
+	}{
+		// Operands are reversed, and lose their prefixes.
+		{i("movl", Imm(2), eax), "\tmovl $2, %eax", "\tmov eax, 2"},
+		{i("pushq", rbp), "\tpushq %rbp", "\tpush rbp"},
+		{i("ret"), "\tret", "\tret"},
+		// Memory operands have the size of the suffix.
+		{i("movl", eax, memory(-8, rbp)), "\tmovl %eax, -8(%rbp)", "\tmov DWORD PTR [rbp-8], eax"},
+		{i("movb", cl, memory(0, rax)), "\tmovb %cl, (%rax)", "\tmov BYTE PTR [rax], cl"},
+		{i("addq", Mem{Disp: 16, Base: rax, Index: rcx, Scale: 8}, rdx),
+			"\taddq 16(%rax,%rcx,8), %rdx", "\tadd rdx, QWORD PTR [rax+rcx*8+16]"},
+		{i("movl", Mem{Base: rax, Index: rcx, Scale: 1}, eax),
+			"\tmovl (%rax,%rcx,1), %eax", "\tmov eax, DWORD PTR [rax+rcx]"},
+		{i("leaq", ripRelative(".LC0"), rax), "\tleaq .LC0(%rip), %rax", "\tlea rax, [rip+.LC0]"},
+		{i("movq", stackGuard, rax), "\tmovq %fs:40, %rax", "\tmov rax, QWORD PTR fs:40"},
+		{i("movq", darwinStackGuard, rax), "\tmovq ___stack_chk_guard@GOTPCREL(%rip), %rax",
+			"\tmov rax, QWORD PTR [rip+___stack_chk_guard@GOTPCREL]"},
+		// Extensions and conversions.
+		{i("cltq"), "\tcltq", "\tcdqe"},
+		{i("cqto"), "\tcqto", "\tcqo"},
+		{i("movslq", ecx, rcx), "\tmovslq %ecx, %rcx", "\tmovsxd rcx, ecx"},
+		{i("movsbl", memory(-1, rbp), eax), "\tmovsbl -1(%rbp), %eax", "\tmovsx eax, BYTE PTR [rbp-1]"},
+		{i("cvtsi2sdl", memory(-4, rbp), xmm0), "\tcvtsi2sdl -4(%rbp), %xmm0", "\tcvtsi2sd xmm0, DWORD PTR [rbp-4]"},
+		{i("cvttsd2si", xmm0, eax), "\tcvttsd2si %xmm0, %eax", "\tcvttsd2si eax, xmm0"},
+		{i("movss", memory(-4, rbp), xmm1), "\tmovss -4(%rbp), %xmm1", "\tmovss xmm1, DWORD PTR [rbp-4]"},
+		{i("movq", xmm0, rax), "\tmovq %xmm0, %rax", "\tmovq rax, xmm0"},
+		// Mnemonics which end in the letter of a suffix.
+		{i("setl", al), "\tsetl %al", "\tsetl al"},
+		{i("jl", Sym(".L1")), "\tjl .L1", "\tjl .L1"},
+		{i("call", Sym("f@PLT")), "\tcall f@PLT", "\tcall f@PLT"},
+		{i("jmp", Indirect{rax}), "\tjmp *%rax", "\tjmp rax"},
+		// Labels and directives are the same.
+		{Label("main"), "main:", "main:"},
+		{Directive(".long 7"), "\t.long 7", "\t.long 7"},
+	} {
+		assert.Equal(test.att, printLine(attPrinter{}, test.line))
+		assert.Equal(test.intel, printLine(intelPrinter{}, test.line))
+	}
+}
+
+func TestGenerateIntelSyntax(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`	.intel_syntax noprefix
+	.text
+	.globl main
+main:
+	push rbp
+	mov rbp, rsp
+	mov eax, 2
+	mov rsp, rbp
+	pop rbp
+	ret
+	.section .note.GNU-stack,"",@progbits
+`, generate(t, "int main() { return 2; }", IntelSyntax, Peephole))
+}
+
+func TestGenerateIntelReservedSymbols(t *testing.T) {
+	assert := assert.New(t)
+	// The error is at the first use of the symbol, or without a position if
+	// it is only defined.
+	for _, test := range []struct{ input, err string }{
+		{"int dx; int main() { return dx; }", "1:22: symbol dx"},
+		{"int cl(int a) { return a; } int main() { return cl(2); }", "1:1: symbol cl"},
+		{"int XMM0(); int main() { return XMM0(); }", "1:26: symbol XMM0"},
+		{"int r8d; int main() { int *p = &r8d; return *p; }", "1:23: symbol r8d"},
+		{"int offset; int main() { return 0; }", "symbol offset"},
+	} {
+		var b bytes.Buffer
+		err := Generate(&b, lower(t, test.input), IntelSyntax)
+		assert.EqualError(err, test.err+" is the name of a register or operator in Intel syntax")
+		assert.NoError(Generate(&b, lower(t, test.input)))
+	}
+	// Names which are not registers, and symbols with a prefix on Darwin.
+	generate(t, "int dxx; int r16; int xmm32; int ip; int main() { return dxx + r16 + xmm32 + ip; }", IntelSyntax)
+	generate(t, "int dx; int main() { return dx; }", IntelSyntax, Darwin)
+}
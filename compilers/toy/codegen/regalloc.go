@@ -0,0 +1,116 @@
+package codegen
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"sort"
+)
+
+// A register which may hold a temporary.
+type register struct {
+	name        Reg  // The name used for a temporary, e.g. %ebx.
+	quad        Reg  // The name of the 64-bit register, e.g. %rbx.
+	calleeSaved bool // Whether its value must be restored on return.
+}
+
+// The registers available for int temporaries, in order of preference. %eax
+// and %ecx are reserved as scratch registers, and %edx is clobbered by
+// division. Caller-saved registers are preferred, since using them costs
+// nothing.
+var intRegisters = []register{
+	{"esi", "rsi", false},
+	{"edi", "rdi", false},
+	{"r8d", "r8", false},
+	{"r9d", "r9", false},
+	{"r10d", "r10", false},
+	{"r11d", "r11", false},
+	{"ebx", "rbx", true},
+	{"r12d", "r12", true},
+	{"r13d", "r13", true},
+	{"r14d", "r14", true},
+	{"r15d", "r15", true},
+}
+
+// The registers available for floating-point temporaries. %xmm0 and %xmm1
+// are reserved as scratch registers. Every SSE register is caller-saved.
+var floatRegisters = []register{
+	{"xmm2", "xmm2", false},
+	{"xmm3", "xmm3", false},
+	{"xmm4", "xmm4", false},
+	{"xmm5", "xmm5", false},
+	{"xmm6", "xmm6", false},
+	{"xmm7", "xmm7", false},
+	{"xmm8", "xmm8", false},
+	{"xmm9", "xmm9", false},
+	{"xmm10", "xmm10", false},
+	{"xmm11", "xmm11", false},
+	{"xmm12", "xmm12", false},
+	{"xmm13", "xmm13", false},
+	{"xmm14", "xmm14", false},
+	{"xmm15", "xmm15", false},
+}
+
+// allocateRegisters assigns registers to the temporaries of a function by
+// linear scan over their live intervals. When there are more live
+// temporaries than registers, the temporary whose interval ends last is
+// spilled, so that the registers go to those which are used soonest.
+// Temporaries without a register are absent from the result.
+func allocateRegisters(f *ir.Function, liveness *ir.Liveness) map[*ir.Temp]register {
+	intervals := liveness.Intervals(f)
+	assigned := make(map[*ir.Temp]register)
+	var ints, floats []*ir.Interval
+	for _, v := range intervals {
+		if types.IsFloating(v.Temp.Type()) {
+			floats = append(floats, v)
+		} else {
+			ints = append(ints, v)
+		}
+	}
+	linearScan(ints, intRegisters, assigned)
+	linearScan(floats, floatRegisters, assigned)
+	return assigned
+}
+
+// linearScan assigns registers from a pool to intervals, which are ordered by
+// start.
+func linearScan(intervals []*ir.Interval, pool []register, assigned map[*ir.Temp]register) {
+	free := append([]register(nil), pool...)
+	// The intervals which hold a register, ordered by end.
+	var active []*ir.Interval
+	for _, v := range intervals {
+		// Release the registers of intervals which have ended.
+		for len(active) > 0 && active[0].End < v.Start {
+			free = append(free, assigned[active[0].Temp])
+			active = active[1:]
+		}
+		// Prefer registers in the order of the pool.
+		sort.SliceStable(free, func(i, j int) bool {
+			return index(pool, free[i]) < index(pool, free[j])
+		})
+
+		if len(free) > 0 {
+			assigned[v.Temp], free = free[0], free[1:]
+		} else if last := active[len(active)-1]; last.End > v.End {
+			assigned[v.Temp] = assigned[last.Temp]
+			delete(assigned, last.Temp)
+			active = active[:len(active)-1]
+		} else {
+			continue
+		}
+		i := sort.Search(len(active), func(i int) bool {
+			return active[i].End > v.End
+		})
+		active = append(active, nil)
+		copy(active[i+1:], active[i:])
+		active[i] = v
+	}
+}
+
+func index(pool []register, r register) int {
+	for i, p := range pool {
+		if p == r {
+			return i
+		}
+	}
+	return -1
+}
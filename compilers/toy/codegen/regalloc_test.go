@@ -0,0 +1,127 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestAllocateRegisters(t *testing.T) {
+	assert := assert.New(t)
+	f := &ir.Function{Name: "f", Result: types.Int}
+	a := f.NewVariable("a", types.Int)
+	b := f.NewVariable("b", types.Int)
+	c := f.NewTemp(types.Int)
+	d := f.NewTemp(types.Double)
+	f.Emit(&ir.Copy{Dst: a, Src: ir.NewInt(1, types.Int)})
+	f.Emit(&ir.Copy{Dst: b, Src: ir.NewInt(2, types.Int)})
+	f.Emit(&ir.Binary{Op: ir.Add, Dst: c, Lhs: a, Rhs: b})
+	f.Emit(&ir.Convert{Dst: d, Src: c})
+	f.Emit(&ir.Return{Value: c})
+
+	registers := allocateRegisters(f, ir.AnalyzeLiveness(f))
+	assert.Equal(Reg("esi"), registers[a].name)
+	assert.Equal(Reg("edi"), registers[b].name)
+	// a and b are dead once c is assigned, so c reuses a's register.
+	assert.Equal(Reg("esi"), registers[c].name)
+	assert.Equal(Reg("xmm2"), registers[d].name)
+}
+
+func TestAllocateRegistersSpillsLongestInterval(t *testing.T) {
+	assert := assert.New(t)
+	f := &ir.Function{Name: "f", Result: types.Int}
+	// Temporaries which are all live at once, each added to sum in turn.
+	var temps []*ir.Temp
+	for i := 0; i <= len(intRegisters); i++ {
+		v := f.NewVariable(fmt.Sprintf("v%d", i), types.Int)
+		f.Emit(&ir.Copy{Dst: v, Src: ir.NewInt(int64(i), types.Int)})
+		temps = append(temps, v)
+	}
+	sum := f.NewVariable("sum", types.Int)
+	f.Emit(&ir.Copy{Dst: sum, Src: ir.NewInt(0, types.Int)})
+	for _, v := range temps {
+		f.Emit(&ir.Binary{Op: ir.Add, Dst: sum, Lhs: sum, Rhs: v})
+	}
+	f.Emit(&ir.Return{Value: sum})
+
+	registers := allocateRegisters(f, ir.AnalyzeLiveness(f))
+	// There is one temporary too many when the last is assigned. It and sum
+	// are live longer than any other, so they are spilled.
+	for _, v := range temps[:len(temps)-1] {
+		_, ok := registers[v]
+		assert.True(ok, v.String())
+	}
+	_, ok := registers[temps[len(temps)-1]]
+	assert.False(ok)
+	_, ok = registers[sum]
+	assert.False(ok)
+}
+
+func TestAllocateRegistersAcrossLoop(t *testing.T) {
+	assert := assert.New(t)
+	f := &ir.Function{Name: "f", Result: types.Int}
+	p := &ir.Program{Functions: []*ir.Function{f}}
+	a := f.NewVariable("a", types.Int)
+	b := f.NewVariable("b", types.Int)
+	loop, end := p.NewLabel(), p.NewLabel()
+	f.Emit(&ir.Copy{Dst: a, Src: ir.NewInt(3, types.Int)})
+	f.Emit(loop)
+	// b is assigned after a's last use in the body, but a is live around the
+	// back edge, so they must not share a register.
+	f.Emit(&ir.Binary{Op: ir.Sub, Dst: a, Lhs: a, Rhs: ir.NewInt(1, types.Int)})
+	f.Emit(&ir.Copy{Dst: b, Src: a})
+	f.Emit(&ir.Branch{Cond: b, True: loop, False: end})
+	f.Emit(end)
+	f.Emit(&ir.Return{Value: ir.NewInt(0, types.Int)})
+
+	registers := allocateRegisters(f, ir.AnalyzeLiveness(f))
+	assert.NotEqual(registers[a], registers[b])
+}
+
+func TestGenerateWithRegisters(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 2; int b = 3; return a * b; }")
+	assert.Contains(asm, `main:
+	pushq %rbp
+	movq %rsp, %rbp
+	movl $2, %eax
+	movl %eax, %esi
+	movl $3, %eax
+	movl %eax, %edi
+	movl %esi, %eax
+	movl %edi, %ecx
+	imull %ecx, %eax
+	movl %eax, %esi
+	movl %esi, %eax
+	movq %rbp, %rsp
+`)
+	assert.NotContains(asm, "(%rbp)")
+}
+
+func TestGenerateFloatRegisters(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "double f() { double a = 1.5; return a + a; }")
+	assert.Contains(asm, `	movsd .LC0(%rip), %xmm0
+	movaps %xmm0, %xmm2
+	movaps %xmm2, %xmm0
+	movaps %xmm2, %xmm1
+	addsd %xmm1, %xmm0
+`)
+}
+
+func TestGenerateSavesCalleeSavedRegisters(t *testing.T) {
+	assert := assert.New(t)
+	// Enough live variables to need a callee-saved register.
+	var decls, sum []string
+	for i := 0; i < 7; i++ {
+		decls = append(decls, fmt.Sprintf("int v%d = %d;", i, i))
+		sum = append(sum, fmt.Sprintf("v%d", i))
+	}
+	asm := generate(t, "int main() { "+strings.Join(decls, " ")+
+		" return "+strings.Join(sum, " + ")+"; }")
+	assert.Contains(asm, "\tsubq $16, %rsp\n\tmovq %rbx, -8(%rbp)\n")
+	assert.Contains(asm, "\tmovq -8(%rbp), %rbx\n\tmovq %rbp, %rsp\n")
+}
@@ -0,0 +1,80 @@
+package codegen
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+)
+
+// A table of the targets of a switch, indexed by case value, in the
+// read-only data section.
+type jumpTable struct {
+	label   string
+	targets []*ir.Label
+}
+
+// switchInstr emits the dispatch of a switch. The instruction which follows
+// it is used to avoid a jump to the next instruction.
+func (g *generator) switchInstr(s *ir.Switch, next ir.Instr) {
+	g.load(s.Value, false)
+	t := s.Value.Type()
+	// The values of a switch of a long are dispatched by comparisons, so
+	// that the range of the case values can't overflow.
+	if low, high, ok := s.JumpTableRange(); ok && !isQuad(t) {
+		g.jumpTable(s, low, high)
+		return
+	}
+	for _, c := range s.Cases {
+		switch {
+		case !isQuad(t):
+			g.emit("cmpl", Imm(int32(c.Value)), eax)
+		case c.Value == int64(int32(c.Value)):
+			g.emit("cmpq", Imm(c.Value), rax)
+		default:
+			// An immediate operand of a comparison has at most 32 bits.
+			g.emit("movq", Imm(c.Value), rcx)
+			g.emit("cmpq", rcx, rax)
+		}
+		g.emit("je", Sym(g.labelName(c.Target)))
+	}
+	if next != ir.Instr(s.Default) {
+		g.emit("jmp", Sym(g.labelName(s.Default)))
+	}
+}
+
+// jumpTable emits a dispatch of the value in %eax by an indirect jump through
+// a table of target offsets, relative to the table so that the code is
+// position-independent. Values outside of the table jump to the default.
+func (g *generator) jumpTable(s *ir.Switch, low, high int64) {
+	table := jumpTable{
+		label:   g.localLabel("JT", len(g.tables)),
+		targets: make([]*ir.Label, high-low+1),
+	}
+	for i := range table.targets {
+		table.targets[i] = s.Default
+	}
+	for _, c := range s.Cases {
+		table.targets[c.Value-low] = c.Target
+	}
+	g.tables = append(g.tables, table)
+
+	if low != 0 {
+		g.emit("subl", Imm(int32(low)), eax)
+	}
+	// An unsigned comparison also rejects values below the lowest case.
+	g.emit("cmpl", Imm(int32(high-low)), eax)
+	g.emit("ja", Sym(g.labelName(s.Default)))
+	g.emit("leaq", ripRelative(table.label), rcx)
+	g.emit("movslq", Mem{Base: rcx, Index: rax, Scale: 4}, rax)
+	g.emit("addq", rcx, rax)
+	g.emit("jmp", Indirect{rax})
+}
+
+// jumpTables emits the jump tables of the program.
+func (g *generator) jumpTables() {
+	for _, t := range g.tables {
+		g.align(4)
+		g.label(t.label)
+		for _, target := range t.targets {
+			g.directive(".long %s-%s", g.labelName(target), t.label)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package codegen
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGenerateJumpTable(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a) {
+  switch (a) { case 1: return 1; case 2: return 2; case 4: return 4; case 5: return 5; }
+  return 0;
+}`, NoRegisterAllocation)
+	assert.Contains(asm, `	movl -8(%rbp), %eax
+	subl $1, %eax
+	cmpl $4, %eax
+	ja .Lf.5
+	leaq .LJT0(%rip), %rcx
+	movslq (%rcx,%rax,4), %rax
+	addq %rcx, %rax
+	jmp *%rax
+`)
+	// Values without a case jump to the default.
+	assert.Contains(asm, `	.section .rodata
+	.align 4
+.LJT0:
+	.long .Lf.1-.LJT0
+	.long .Lf.2-.LJT0
+	.long .Lf.5-.LJT0
+	.long .Lf.3-.LJT0
+	.long .Lf.4-.LJT0
+`)
+}
+
+func TestGenerateJumpTablesAreUnique(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a) {
+  switch (a) { case 0: case 1: case 2: case 3: return 1; }
+  switch (a) { case 0: case 1: case 2: case 3: return 2; }
+  return 0;
+}`)
+	assert.Contains(asm, "leaq .LJT0(%rip), %rcx")
+	assert.Contains(asm, "leaq .LJT1(%rip), %rcx")
+	// The subtraction of a zero lowest value is omitted.
+	assert.NotContains(asm, "subl $0")
+}
+
+func TestGenerateComparisonChain(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a) {
+  switch (a) { case -100: return 1; case 7: return 2; default: return 3; }
+}`, NoRegisterAllocation)
+	assert.Contains(asm, `	movl -8(%rbp), %eax
+	cmpl $-100, %eax
+	je .Lf.1
+	cmpl $7, %eax
+	je .Lf.2
+	jmp .Lf.3
+`)
+	assert.NotContains(asm, ".LJT")
+}
+
+func TestGenerateComparisonChainFallsThroughToDefault(t *testing.T) {
+	assert := assert.New(t)
+	// The default immediately follows the dispatch.
+	asm := generate(t, `int f(int a) {
+  switch (a) { default: return 3; case 7: return 2; }
+}`, NoRegisterAllocation)
+	assert.Contains(asm, `	cmpl $7, %eax
+	je .Lf.2
+.Lf.1:
+`)
+}
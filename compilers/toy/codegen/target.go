@@ -0,0 +1,80 @@
+package codegen
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/target"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+)
+
+// The x86-64 targets, for Linux and macOS.
+type x86_64 struct {
+	os string
+}
+
+func init() {
+	target.Register(x86_64{"linux"})
+	target.Register(x86_64{"darwin"})
+}
+
+func (t x86_64) Name() string          { return "x86_64-" + t.os }
+func (t x86_64) Arch() string          { return "x86-64" }
+func (t x86_64) OS() string            { return t.os }
+func (t x86_64) Layout() types.Layout  { return types.LP64 }
+func (t x86_64) Syntax() target.Syntax { return target.ATT }
+
+func (t x86_64) Registers() target.Registers {
+	return target.Registers{Int: quads(intRegisters), Float: quads(floatRegisters)}
+}
+
+func (t x86_64) CallingConvention() target.CallingConvention {
+	return target.CallingConvention{
+		Name:        "System V AMD64",
+		IntArgs:     quads(intArgRegisters),
+		FloatArgs:   quads(floatArgRegisters),
+		IntResult:   "%rax",
+		FloatResult: "%xmm0",
+		StackAlign:  16,
+	}
+}
+
+func (t x86_64) Generate(w io.Writer, program *ir.Program, options target.Options) error {
+	var opts []Option
+	if t.os == "darwin" {
+		opts = append(opts, Darwin)
+	}
+	if options.NoRegisterAllocation {
+		opts = append(opts, NoRegisterAllocation)
+	}
+	if options.NoTailCalls {
+		opts = append(opts, NoTailCalls)
+	}
+	if options.SanitizeStack {
+		opts = append(opts, SanitizeStack)
+	}
+	if options.TrapOverflow {
+		opts = append(opts, TrapOverflow)
+	}
+	if options.Peephole {
+		opts = append(opts, Peephole)
+	}
+	if options.PIC {
+		opts = append(opts, PIC)
+	}
+	if options.IntelSyntax {
+		opts = append(opts, IntelSyntax)
+	}
+	if options.Debug != nil {
+		opts = append(opts, Debug(Source(*options.Debug)))
+	}
+	return Generate(w, program, opts...)
+}
+
+// quads returns the names of the 64-bit registers of a list.
+func quads(registers []register) []string {
+	var names []string
+	for _, r := range registers {
+		names = append(names, "%"+string(r.quad))
+	}
+	return names
+}
@@ -0,0 +1,27 @@
+package codegen
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/target"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	assert := assert.New(t)
+	linux, err := target.Lookup("x86_64-linux")
+	assert.NoError(err)
+	assert.Equal("x86-64", linux.Arch())
+	assert.Equal(target.ATT, linux.Syntax())
+	c := linux.CallingConvention()
+	assert.Equal([]string{"%rdi", "%rsi", "%rdx", "%rcx", "%r8", "%r9"}, c.IntArgs)
+	assert.Equal("%xmm0", c.FloatResult)
+	assert.Contains(linux.Registers().Int, "%rbx")
+
+	darwin, err := target.Lookup("x86_64-darwin")
+	assert.NoError(err)
+	var b bytes.Buffer
+	program := lower(t, "int main() { return 2; }")
+	assert.NoError(darwin.Generate(&b, program, target.Options{NoRegisterAllocation: true}))
+	assert.Equal(generate(t, "int main() { return 2; }", Darwin, NoRegisterAllocation), b.String())
+}
@@ -0,0 +1,85 @@
+package wasm
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"strings"
+)
+
+// switchInstr emits the dispatch of a switch, either by a jump table or by
+// comparing the value with each case in turn.
+func (g *generator) switchInstr(s *ir.Switch, next ir.Instr) {
+	// The values of a switch of a long are dispatched by comparisons, since
+	// a br_table is indexed by an i32.
+	t := s.Value.Type()
+	if low, high, ok := s.JumpTableRange(); ok && valueType(t) == "i32" {
+		g.jumpTable(s, low, high, next)
+		return
+	}
+	for _, c := range s.Cases {
+		g.emit("i32.const %d", g.blocks[c.Target])
+		g.emit("local.set %s", blockLocal)
+		g.get(s.Value)
+		g.get(ir.NewInt(c.Value, t))
+		g.emit("%s.eq", valueType(t))
+		g.emit("br_if $dispatch")
+	}
+	g.jump(s.Default, next)
+}
+
+// jumpTable emits a dispatch of a switch by a br_table to one of a nest of
+// blocks, one for each target, the code after which jumps to the target.
+// Values outside of the table branch to the outermost block, for the default.
+func (g *generator) jumpTable(s *ir.Switch, low, high int64, next ir.Instr) {
+	prefix := fmt.Sprintf("$switch%d", g.tables)
+	g.tables++
+
+	// The targets other than the default, in order of their first case.
+	index := map[*ir.Label]int{s.Default: -1}
+	var targets []*ir.Label
+	entries := make([]*ir.Label, high-low+1)
+	for i := range entries {
+		entries[i] = s.Default
+	}
+	for _, c := range s.Cases {
+		entries[c.Value-low] = c.Target
+		if _, ok := index[c.Target]; !ok {
+			index[c.Target] = len(targets)
+			targets = append(targets, c.Target)
+		}
+	}
+	name := func(l *ir.Label) string {
+		if l == s.Default {
+			return prefix + ".default"
+		}
+		return fmt.Sprintf("%s.%d", prefix, index[l])
+	}
+
+	g.emit("block %s", name(s.Default))
+	g.indent++
+	for i := len(targets) - 1; i >= 0; i-- {
+		g.emit("block %s", name(targets[i]))
+		g.indent++
+	}
+	g.get(s.Value)
+	if low != 0 {
+		g.emit("i32.const %d", int32(low))
+		g.emit("i32.sub")
+	}
+	names := make([]string, len(entries)+1)
+	for i, l := range entries {
+		names[i] = name(l)
+	}
+	names[len(entries)] = name(s.Default)
+	g.emit("br_table %s", strings.Join(names, " "))
+	for _, l := range targets {
+		g.indent--
+		g.emit("end")
+		g.emit("i32.const %d", g.blocks[l])
+		g.emit("local.set %s", blockLocal)
+		g.emit("br $dispatch")
+	}
+	g.indent--
+	g.emit("end")
+	g.jump(s.Default, next)
+}
@@ -0,0 +1,62 @@
+package wasm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGenerateJumpTable(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a) {
+  switch (a) { case 1: return 1; case 2: return 2; case 4: return 4; case 5: return 5; }
+  return 0;
+}`)
+	assert.Contains(asm, `                block $switch0.default
+                  block $switch0.3
+                    block $switch0.2
+                      block $switch0.1
+                        block $switch0.0
+                          local.get $a
+                          i32.const 1
+                          i32.sub
+                          br_table $switch0.0 $switch0.1 $switch0.default $switch0.2 $switch0.3 $switch0.default
+                        end
+                        i32.const 1
+                        local.set $.block
+                        br $dispatch
+                      end
+`)
+	// Values outside of the table jump to the default.
+	assert.Contains(asm, `                  br $dispatch
+                end
+                i32.const 5
+                local.set $.block
+                br $dispatch
+              end
+`)
+}
+
+func TestGenerateComparisonChain(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int f(int a) {
+  switch (a) { case 1: return 1; case -100: return 2; }
+  return 0;
+}`)
+	assert.Contains(asm, `            i32.const 1
+            local.set $.block
+            local.get $a
+            i32.const 1
+            i32.eq
+            br_if $dispatch
+            i32.const 2
+            local.set $.block
+            local.get $a
+            i32.const -100
+            i32.eq
+            br_if $dispatch
+            i32.const 3
+            local.set $.block
+            br $dispatch
+          end
+`)
+}
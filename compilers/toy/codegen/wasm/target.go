@@ -0,0 +1,33 @@
+package wasm
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/target"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+)
+
+// The wasm32 target. Arguments and results are the parameters and results
+// of wasm functions, and temporaries are their locals, rather than
+// registers.
+type wasm32 struct{}
+
+func init() {
+	target.Register(wasm32{})
+}
+
+func (wasm32) Name() string                { return "wasm32" }
+func (wasm32) Arch() string                { return "wasm32" }
+func (wasm32) OS() string                  { return "" }
+func (wasm32) Layout() types.Layout        { return types.ILP32 }
+func (wasm32) Registers() target.Registers { return target.Registers{} }
+func (wasm32) Syntax() target.Syntax       { return target.WAT }
+
+func (wasm32) CallingConvention() target.CallingConvention {
+	return target.CallingConvention{Name: "wasm", StackAlign: stackAlignment}
+}
+
+// Generate ignores the options, since the generator has none.
+func (wasm32) Generate(w io.Writer, program *ir.Program, options target.Options) error {
+	return Generate(w, program)
+}
@@ -0,0 +1,742 @@
+// Package wasm generates WebAssembly text format from the intermediate
+// representation.
+//
+// Each function of the program is a wasm function, which is exported unless
+// it is static, and each of its temporaries a local. Functions which are
+// called but not defined are imported from the "env" module, with the
+// signature of their first call. Global variables which are extern are not
+// supported, since a module's memory is its own.
+//
+// The slots of a function are in a frame in linear memory, which the
+// function allocates on entry from a stack which grows down from the end of
+// the first page, and frees before it returns. Global variables follow the
+// stack, from the start of the second page, followed by string literals, and
+// those with an initial value are initialized by data segments. Pointers are
+// 32 bits.
+//
+// Since wasm has only structured control flow, the body of a function with
+// labels is a loop around a nest of blocks, one for each basic block, so that
+// the code of a basic block follows the end of its block. A jump stores the
+// index of its target in the $.block local and branches to the head of the
+// loop, which dispatches to the target with a br_table.
+package wasm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type generator struct {
+	w      *bufio.Writer
+	err    error
+	pos    token.Position // The position of the code being compiled, if known.
+	indent int
+	// The index of the basic block which each label of the current function
+	// starts.
+	blocks map[*ir.Label]int
+	names  ir.NameGenerator // The names of the labels of the functions.
+	// The number of jump tables emitted so far in the current function.
+	tables int
+	// The size of the frame of the current function in linear memory, and
+	// the offset of each of its slots in the frame.
+	frameSize   int
+	slotOffsets map[*ir.Slot]int
+	// The address of each global in linear memory.
+	globalAddrs map[*ir.Global]int
+}
+
+// Generate writes the WebAssembly text format module for a program to w.
+func Generate(w io.Writer, program *ir.Program) error {
+	g := &generator{
+		w:     bufio.NewWriter(w),
+		names: ir.NameGenerator{Prefix: "$L", Local: true},
+	}
+	g.program(program)
+	if g.err != nil {
+		return g.err
+	}
+	return g.w.Flush()
+}
+
+// emit writes an instruction at the current indentation.
+func (g *generator) emit(format string, args ...interface{}) {
+	if g.err == nil {
+		_, g.err = fmt.Fprintf(g.w, strings.Repeat("  ", g.indent)+format+"\n", args...)
+	}
+}
+
+// errorf records an error for an instruction which cannot be compiled, at
+// its position.
+func (g *generator) errorf(format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = &ir.Error{Pos: g.pos, Msg: fmt.Sprintf(format, args...)}
+	}
+}
+
+// valueType returns the wasm type of values of type t. Integers narrower
+// than a long, and pointers, are i32s.
+func valueType(t types.Type) string {
+	switch {
+	case t == types.Float:
+		return "f32"
+	case t == types.Double:
+		return "f64"
+	case types.IsInteger(t) && types.Width(t) == 64:
+		return "i64"
+	}
+	return "i32"
+}
+
+// local returns the name of the local of a temporary. Anonymous temporaries
+// are named by number, and variables by name, which cannot begin with a
+// digit.
+func local(t *ir.Temp) string {
+	if t.Name != "" {
+		return "$" + t.Name
+	}
+	return "$" + strconv.Itoa(t.ID)
+}
+
+// The local which holds the index of the next basic block. Its name cannot
+// clash with a variable.
+const blockLocal = "$.block"
+
+// The local which holds the address of the frame of a function with slots.
+const frameLocal = "$.frame"
+
+// The global which holds the address of the top of the stack, and the initial
+// address, at the end of the first page of memory.
+const (
+	stackPointer = "$__stack_pointer"
+	stackBase    = 65536
+)
+
+// The size of a page of linear memory, in bytes.
+const pageSize = 65536
+
+// The required alignment of a frame, in bytes.
+const stackAlignment = 16
+
+// signature returns the params and result of a function type, as in a wasm
+// function or import.
+func signature(params []types.Type, result types.Type) string {
+	var b strings.Builder
+	if len(params) > 0 {
+		b.WriteString(" (param")
+		for _, p := range params {
+			b.WriteString(" " + valueType(p))
+		}
+		b.WriteString(")")
+	}
+	fmt.Fprintf(&b, " (result %s)", valueType(result))
+	return b.String()
+}
+
+func (g *generator) program(program *ir.Program) {
+	g.emit("(module")
+	g.indent++
+	g.imports(program)
+	for _, v := range program.Globals {
+		if v.Extern {
+			g.errorf("extern global variable '%s' is not supported", v.Name)
+		}
+	}
+	globals := append(append([]*ir.Global{}, program.Globals...), program.Strings...)
+	size := g.layoutGlobals(globals)
+	memory := len(globals) > 0
+	for _, f := range program.Functions {
+		memory = memory || len(f.Slots) > 0
+	}
+	if memory {
+		pages := 1 + (size+pageSize-1)/pageSize
+		g.emit("(memory (export \"memory\") %d)", pages)
+		g.emit("(global %s (mut i32) (i32.const %d))", stackPointer, stackBase)
+	}
+	g.data(globals)
+	for _, f := range program.Functions {
+		g.function(f)
+	}
+	g.indent--
+	g.emit(")")
+}
+
+// layoutGlobals assigns an address to each global, after the stack, aligned
+// to its type, and returns their total size.
+func (g *generator) layoutGlobals(globals []*ir.Global) int {
+	g.globalAddrs = make(map[*ir.Global]int)
+	size := 0
+	for _, v := range globals {
+		size = roundUp(size, types.ILP32.Alignof(v.Type))
+		g.globalAddrs[v] = stackBase + size
+		size += types.ILP32.Sizeof(v.Type)
+	}
+	return size
+}
+
+// data emits a data segment which initializes each global with an initial
+// value, and each string literal with its characters. Memory is otherwise
+// zero.
+func (g *generator) data(globals []*ir.Global) {
+	for _, v := range globals {
+		var bits uint64
+		switch init := v.Init.(type) {
+		case nil:
+			if v.Data == "" {
+				continue
+			}
+		case *ir.FloatConst:
+			if v.Type == types.Float {
+				bits = uint64(math.Float32bits(float32(init.Value)))
+			} else {
+				bits = math.Float64bits(init.Value)
+			}
+		case *ir.IntConst:
+			bits = uint64(init.Value)
+		}
+		var b strings.Builder
+		for i := 0; i < types.ILP32.Sizeof(v.Type); i++ {
+			c := byte(bits >> (8 * uint(i)))
+			if v.Data != "" {
+				c = v.Data[i]
+			}
+			fmt.Fprintf(&b, "\\%02x", c)
+		}
+		g.emit("(data (i32.const %d) \"%s\")", g.globalAddrs[v], b.String())
+	}
+}
+
+// imports emits an import of each function which is called but not defined,
+// in order of name.
+func (g *generator) imports(program *ir.Program) {
+	defined := make(map[string]bool)
+	for _, f := range program.Functions {
+		defined[f.Name] = true
+	}
+	calls := make(map[string]*ir.Call)
+	var names []string
+	for _, f := range program.Functions {
+		for _, instr := range f.Instrs {
+			if c, ok := instr.(*ir.Call); ok && !defined[c.Function] && calls[c.Function] == nil {
+				calls[c.Function] = c
+				names = append(names, c.Function)
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := calls[name]
+		params := make([]types.Type, len(c.Args))
+		for i, a := range c.Args {
+			params[i] = a.Type()
+		}
+		g.emit("(import \"env\" %q (func $%s%s))", name, name, signature(params, c.Dst.Type()))
+	}
+}
+
+// basicBlocks returns the labels which start each basic block of a function,
+// after the entry block, and records the index of each.
+func (g *generator) basicBlocks(f *ir.Function) []*ir.Label {
+	g.blocks = make(map[*ir.Label]int)
+	var labels []*ir.Label
+	for _, instr := range f.Instrs {
+		if l, ok := instr.(*ir.Label); ok {
+			labels = append(labels, l)
+			g.blocks[l] = len(labels)
+		}
+	}
+	return labels
+}
+
+// blockName returns the name of the wasm block which ends where a basic
+// block of the current function starts.
+func (g *generator) blockName(l *ir.Label) string {
+	if l == nil {
+		return "$entry"
+	}
+	return g.names.Name(l)
+}
+
+func (g *generator) function(f *ir.Function) {
+	g.pos = f.Pos
+	defer func() { g.pos = token.Position{} }()
+	var b strings.Builder
+	for _, p := range f.Params {
+		fmt.Fprintf(&b, " (param %s %s)", local(p), valueType(p.Type()))
+	}
+	export := fmt.Sprintf(" (export %q)", f.Name)
+	if f.Static {
+		export = ""
+	}
+	g.emit("(func $%s%s%s (result %s)", f.Name, export, b.String(), valueType(f.Result))
+	g.indent++
+	g.tables = 0
+	g.names.Function(f)
+
+	params := make(map[*ir.Temp]bool)
+	for _, p := range f.Params {
+		params[p] = true
+	}
+	for _, t := range f.Temps {
+		if !params[t] {
+			g.emit("(local %s %s)", local(t), valueType(t.Type()))
+		}
+	}
+	g.layoutFrame(f)
+	if g.frameSize > 0 {
+		g.emit("(local %s i32)", frameLocal)
+		g.emit("global.get %s", stackPointer)
+		g.emit("i32.const %d", g.frameSize)
+		g.emit("i32.sub")
+		g.emit("local.tee %s", frameLocal)
+		g.emit("global.set %s", stackPointer)
+	}
+
+	labels := g.basicBlocks(f)
+	if len(labels) == 0 {
+		g.body(f)
+		g.indent--
+		g.emit(")")
+		return
+	}
+
+	g.emit("(local %s i32)", blockLocal)
+	g.emit("loop $dispatch")
+	g.indent++
+	blocks := append([]*ir.Label{nil}, labels...)
+	names := make([]string, len(blocks))
+	for i := len(blocks) - 1; i >= 0; i-- {
+		names[i] = g.blockName(blocks[i])
+		g.emit("block %s", names[i])
+		g.indent++
+	}
+	g.emit("local.get %s", blockLocal)
+	g.emit("br_table %s", strings.Join(names, " "))
+	g.indent--
+	g.emit("end")
+	g.body(f)
+	g.indent--
+	g.emit("end")
+	// Control never leaves the loop by falling through the last basic block,
+	// which ends with a return or jump.
+	g.emit("unreachable")
+	g.indent--
+	g.emit(")")
+}
+
+// layoutFrame assigns an offset in the frame of a function to each of its
+// slots, aligned to the slot's type.
+func (g *generator) layoutFrame(f *ir.Function) {
+	g.slotOffsets = make(map[*ir.Slot]int)
+	size := 0
+	for _, s := range f.Slots {
+		size = roundUp(size, types.ILP32.Alignof(s.Type))
+		g.slotOffsets[s] = size
+		size += types.ILP32.Sizeof(s.Type)
+	}
+	g.frameSize = roundUp(size, stackAlignment)
+}
+
+// roundUp rounds a size up to a multiple of an alignment.
+func roundUp(size, alignment int) int {
+	if r := size % alignment; r != 0 {
+		size += alignment - r
+	}
+	return size
+}
+
+// body emits the instructions of a function. Each label closes the block
+// which its basic block follows.
+func (g *generator) body(f *ir.Function) {
+	for i, instr := range f.Instrs {
+		var next ir.Instr
+		if i+1 < len(f.Instrs) {
+			next = f.Instrs[i+1]
+		}
+		if pos := f.Position(i); pos.IsValid() {
+			g.pos = pos
+		}
+		g.instr(instr, next)
+	}
+}
+
+// get pushes a value onto the stack.
+func (g *generator) get(v ir.Value) {
+	switch v := v.(type) {
+	case *ir.Temp:
+		g.emit("local.get %s", local(v))
+	case *ir.IntConst:
+		if valueType(v.Type()) == "i64" {
+			g.emit("i64.const %d", v.Value)
+		} else {
+			g.emit("i32.const %d", int32(v.Value))
+		}
+	case *ir.FloatConst:
+		bits := 64
+		if v.Type() == types.Float {
+			bits = 32
+		}
+		g.emit("%s.const %s", valueType(v.Type()), formatFloat(v.Value, bits))
+	default:
+		g.errorf("invalid operand %v", v)
+	}
+}
+
+// formatFloat formats a floating-point constant as the shortest decimal
+// which is exact at the given precision, or as inf or nan.
+func formatFloat(value float64, bits int) string {
+	s := strconv.FormatFloat(value, 'g', -1, bits)
+	switch s {
+	case "+Inf":
+		return "inf"
+	case "-Inf":
+		return "-inf"
+	case "NaN":
+		return "nan"
+	}
+	return s
+}
+
+// set pops the value on top of the stack into the local of a temporary.
+func (g *generator) set(t *ir.Temp) {
+	g.emit("local.set %s", local(t))
+}
+
+// jump emits a jump to a label, unless it starts the next basic block.
+func (g *generator) jump(target *ir.Label, next ir.Instr) {
+	if next == ir.Instr(target) {
+		return
+	}
+	g.emit("i32.const %d", g.blocks[target])
+	g.emit("local.set %s", blockLocal)
+	g.emit("br $dispatch")
+}
+
+func (g *generator) instr(instr ir.Instr, next ir.Instr) {
+	switch i := instr.(type) {
+	case *ir.Copy:
+		g.get(i.Src)
+		g.set(i.Dst)
+	case *ir.Unary:
+		g.unary(i)
+	case *ir.Binary:
+		g.binary(i)
+	case *ir.Convert:
+		g.get(i.Src)
+		g.convert(i.Src.Type(), i.Dst.Type())
+		g.set(i.Dst)
+	case *ir.Select:
+		g.get(i.True)
+		g.get(i.False)
+		g.get(i.Cond)
+		g.emit("select")
+		g.set(i.Dst)
+	case *ir.Label:
+		g.indent--
+		g.emit("end")
+	case *ir.Jump:
+		g.jump(i.Target, next)
+	case *ir.Branch:
+		g.branch(i, next)
+	case *ir.Switch:
+		g.switchInstr(i, next)
+	case *ir.Call:
+		if i.Variadic {
+			// The variable arguments would be passed in linear memory, as
+			// in the C ABI, which imports from the host do not follow.
+			g.errorf("call of variadic function '%s' is not supported", i.Function)
+			return
+		}
+		for _, a := range i.Args {
+			g.get(a)
+		}
+		g.emit("call $%s", i.Function)
+		g.set(i.Dst)
+	case *ir.Addr:
+		g.emit("local.get %s", frameLocal)
+		if offset := g.slotOffsets[i.Slot]; offset > 0 {
+			g.emit("i32.const %d", offset)
+			g.emit("i32.add")
+		}
+		g.set(i.Dst)
+	case *ir.GlobalAddr:
+		g.emit("i32.const %d", g.globalAddrs[i.Global])
+		g.set(i.Dst)
+	case *ir.Load:
+		g.get(i.Addr)
+		if op, ok := narrowLoads[i.Dst.Type()]; ok {
+			g.emit(op)
+		} else {
+			g.emit("%s.load", valueType(i.Dst.Type()))
+		}
+		g.set(i.Dst)
+	case *ir.Store:
+		g.get(i.Addr)
+		g.get(i.Src)
+		switch types.ILP32.Sizeof(i.Src.Type()) {
+		case 1:
+			g.emit("i32.store8")
+		case 2:
+			g.emit("i32.store16")
+		default:
+			g.emit("%s.store", valueType(i.Src.Type()))
+		}
+	case *ir.PtrAdd:
+		g.get(i.Ptr)
+		g.get(i.Index)
+		// An address has 32 bits, so only those of a long index matter.
+		if valueType(i.Index.Type()) == "i64" {
+			g.emit("i32.wrap_i64")
+		}
+		if size := types.ILP32.Sizeof(i.Ptr.Type().(*types.Pointer).Elem); size != 1 {
+			g.emit("i32.const %d", size)
+			g.emit("i32.mul")
+		}
+		g.emit("i32.add")
+		g.set(i.Dst)
+	case *ir.FieldAddr:
+		g.get(i.Ptr)
+		s := i.Ptr.Type().(*types.Pointer).Elem.(*types.Struct)
+		if offset := types.ILP32.Offsetof(s, i.Field); offset != 0 {
+			g.emit("i32.const %d", offset)
+			g.emit("i32.add")
+		}
+		g.set(i.Dst)
+	case *ir.PtrDiff:
+		g.get(i.Lhs)
+		g.get(i.Rhs)
+		g.emit("i32.sub")
+		if size := types.ILP32.Sizeof(i.Lhs.Type().(*types.Pointer).Elem); size != 1 {
+			g.emit("i32.const %d", size)
+			g.emit("i32.div_s")
+		}
+		g.set(i.Dst)
+	case *ir.Return:
+		g.get(i.Value)
+		if g.frameSize > 0 {
+			// Free the frame.
+			g.emit("local.get %s", frameLocal)
+			g.emit("i32.const %d", g.frameSize)
+			g.emit("i32.add")
+			g.emit("global.set %s", stackPointer)
+		}
+		g.emit("return")
+	default:
+		g.errorf("unsupported instruction %v", instr)
+	}
+}
+
+// branch emits a conditional branch. The index of the target is stored before
+// the condition is tested, since it is only read if the branch is taken.
+func (g *generator) branch(i *ir.Branch, next ir.Instr) {
+	switch next {
+	case ir.Instr(i.True):
+		g.emit("i32.const %d", g.blocks[i.False])
+		g.emit("local.set %s", blockLocal)
+		g.get(i.Cond)
+		g.emit("i32.eqz")
+		g.emit("br_if $dispatch")
+	case ir.Instr(i.False):
+		g.emit("i32.const %d", g.blocks[i.True])
+		g.emit("local.set %s", blockLocal)
+		g.get(i.Cond)
+		g.emit("br_if $dispatch")
+	default:
+		g.emit("i32.const %d", g.blocks[i.True])
+		g.emit("i32.const %d", g.blocks[i.False])
+		g.get(i.Cond)
+		g.emit("select")
+		g.emit("local.set %s", blockLocal)
+		g.emit("br $dispatch")
+	}
+}
+
+func (g *generator) unary(i *ir.Unary) {
+	t := valueType(i.Src.Type())
+	switch {
+	case i.Op == ir.Neg && types.IsFloating(i.Src.Type()):
+		g.get(i.Src)
+		g.emit("%s.neg", t)
+	case i.Op == ir.Neg && types.IsInteger(i.Src.Type()):
+		g.emit("%s.const 0", t)
+		g.get(i.Src)
+		g.emit("%s.sub", t)
+	case i.Op == ir.Not && types.IsInteger(i.Src.Type()):
+		g.get(i.Src)
+		g.emit("%s.const -1", t)
+		g.emit("%s.xor", t)
+	default:
+		g.errorf("unsupported instruction %v", i)
+		return
+	}
+	g.set(i.Dst)
+}
+
+// The instruction for each integer operator, after the type.
+var intOps = map[ir.Op]string{
+	ir.Add: "add",
+	ir.Sub: "sub",
+	ir.Mul: "mul",
+	ir.Div: "div_s",
+	ir.Rem: "rem_s",
+	ir.And: "and",
+	ir.Or:  "or",
+	ir.Xor: "xor",
+	// Shift counts are taken modulo the width of the type.
+	ir.Shl: "shl",
+	ir.Shr: "shr_s",
+	ir.Eq:  "eq",
+	ir.Ne:  "ne",
+	ir.Lt:  "lt_s",
+	ir.Le:  "le_s",
+	ir.Gt:  "gt_s",
+	ir.Ge:  "ge_s",
+}
+
+// The instruction for each operator on unsigned integers, after the type.
+var unsignedOps = map[ir.Op]string{
+	ir.Add: "add",
+	ir.Sub: "sub",
+	ir.Mul: "mul",
+	ir.Div: "div_u",
+	ir.Rem: "rem_u",
+	ir.And: "and",
+	ir.Or:  "or",
+	ir.Xor: "xor",
+	ir.Shl: "shl",
+	ir.Shr: "shr_u",
+	ir.Eq:  "eq",
+	ir.Ne:  "ne",
+	ir.Lt:  "lt_u",
+	ir.Le:  "le_u",
+	ir.Gt:  "gt_u",
+	ir.Ge:  "ge_u",
+}
+
+// The instruction for each comparison of pointers, which are unsigned, after
+// the type.
+var pointerOps = map[ir.Op]string{
+	ir.Eq: "eq",
+	ir.Ne: "ne",
+	ir.Lt: "lt_u",
+	ir.Le: "le_u",
+	ir.Gt: "gt_u",
+	ir.Ge: "ge_u",
+}
+
+// The instruction for each floating-point operator, after the type.
+// Comparisons of NaN are false, other than ne.
+var floatOps = map[ir.Op]string{
+	ir.Add: "add",
+	ir.Sub: "sub",
+	ir.Mul: "mul",
+	ir.Div: "div",
+	ir.Eq:  "eq",
+	ir.Ne:  "ne",
+	ir.Lt:  "lt",
+	ir.Le:  "le",
+	ir.Gt:  "gt",
+	ir.Ge:  "ge",
+}
+
+func (g *generator) binary(i *ir.Binary) {
+	t := i.Lhs.Type()
+	ops := intOps
+	switch {
+	case types.IsFloating(t):
+		ops = floatOps
+	case types.IsPointer(t):
+		ops = pointerOps
+	case types.IsUnsigned(t):
+		ops = unsignedOps
+	}
+	op, ok := ops[i.Op]
+	if !ok {
+		g.errorf("unsupported instruction %v", i)
+		return
+	}
+	g.get(i.Lhs)
+	g.get(i.Rhs)
+	// The count of a shift, which has its own type, must have that of the
+	// value shifted.
+	if count := valueType(i.Rhs.Type()); count != valueType(t) {
+		if count == "i64" {
+			g.emit("i32.wrap_i64")
+		} else {
+			g.emit("i64.extend_i32_u")
+		}
+	}
+	g.emit("%s.%s", valueType(t), op)
+	g.set(i.Dst)
+}
+
+// The instruction which loads each integer type narrower than an int from
+// memory, extending it to an i32.
+var narrowLoads = map[types.Type]string{
+	types.Char:          "i32.load8_s",
+	types.UnsignedChar:  "i32.load8_u",
+	types.Short:         "i32.load16_s",
+	types.UnsignedShort: "i32.load16_u",
+}
+
+// convert converts the value on top of the stack between arithmetic types,
+// or between an integer and a pointer, which is an i32. Conversions from
+// floating-point to integer types truncate towards zero, and saturate rather
+// than trap on values out of range. Those to unsigned int are through a
+// long, whose low 32 bits are the result, like the x86-64 code. An integer
+// narrower than an int is an i32 which is extended from its low bits, so a
+// conversion to one keeps those bits.
+func (g *generator) convert(from, to types.Type) {
+	if from == to {
+		return
+	}
+	src, dst := valueType(from), valueType(to)
+	switch {
+	case (types.IsInteger(from) || types.IsPointer(from)) && (types.IsInteger(to) || types.IsPointer(to)):
+		switch {
+		case src == "i64" && dst == "i32":
+			g.emit("i32.wrap_i64")
+		case src == "i32" && dst == "i64" && (types.IsUnsigned(from) || types.IsPointer(from)):
+			g.emit("i64.extend_i32_u")
+		case src == "i32" && dst == "i64":
+			g.emit("i64.extend_i32_s")
+		}
+	case types.IsUnsigned(from) && types.IsFloating(to):
+		g.emit("%s.convert_%s_u", dst, src)
+	case types.IsInteger(from) && types.IsFloating(to):
+		g.emit("%s.convert_%s_s", dst, src)
+	case types.IsFloating(from) && to == types.UnsignedLong:
+		g.emit("i64.trunc_sat_%s_u", src)
+	case types.IsFloating(from) && to == types.UnsignedInt:
+		g.emit("i64.trunc_sat_%s_s", src)
+		g.emit("i32.wrap_i64")
+	case types.IsFloating(from) && types.IsInteger(to):
+		g.emit("%s.trunc_sat_%s_s", dst, src)
+	case from == types.Float && to == types.Double:
+		g.emit("f64.promote_f32")
+	case from == types.Double && to == types.Float:
+		g.emit("f32.demote_f64")
+	default:
+		g.errorf("unsupported conversion from %v to %v", from, to)
+		return
+	}
+	switch to {
+	case types.Char:
+		g.emit("i32.extend8_s")
+	case types.UnsignedChar:
+		g.emit("i32.const 0xff")
+		g.emit("i32.and")
+	case types.Short:
+		g.emit("i32.extend16_s")
+	case types.UnsignedShort:
+		g.emit("i32.const 0xffff")
+		g.emit("i32.and")
+	}
+}
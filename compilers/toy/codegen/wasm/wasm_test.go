@@ -0,0 +1,320 @@
+package wasm
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// generate compiles a program to WebAssembly text format.
+func generate(t *testing.T, input string) string {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	lowered, err := ir.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := Generate(&b, lowered); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestGenerateReturn(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`(module
+  (func $main (export "main") (result i32)
+    i32.const 2
+    return
+  )
+)
+`, generate(t, "int main() { return 2; }"))
+}
+
+func TestGenerateLocals(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "double f(int a, float b) { double c = a; { int c = 1; } return c; }")
+	assert.Contains(asm, `  (func $f (export "f") (param $a i32) (param $b f32) (result f64)
+    (local $c f64)
+    (local $3 f64)
+    (local $c.1 i32)
+`)
+}
+
+func TestGenerateArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { return a % 3 >> 1; }")
+	assert.Contains(asm, `    local.get $a
+    i32.const 3
+    i32.rem_s
+    local.set $1
+    local.get $1
+    i32.const 1
+    i32.shr_s
+    local.set $2
+`)
+	asm = generate(t, "int f(double a) { return a <= 2.5; }")
+	assert.Contains(asm, "    local.get $a\n    f64.const 2.5\n    f64.le\n")
+}
+
+func TestGenerateUnaryOps(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { return -~a; }")
+	assert.Contains(asm, "    local.get $a\n    i32.const -1\n    i32.xor\n    local.set $1\n")
+	assert.Contains(asm, "    i32.const 0\n    local.get $1\n    i32.sub\n    local.set $2\n")
+	asm = generate(t, "float f(float a) { return -a; }")
+	assert.Contains(asm, "    local.get $a\n    f32.neg\n")
+}
+
+func TestGenerateConversions(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { double d = 1; float f = d; return f; }")
+	assert.Contains(asm, "    i32.const 1\n    f64.convert_i32_s\n")
+	assert.Contains(asm, "    f32.demote_f64\n")
+	assert.Contains(asm, "    i32.trunc_sat_f32_s\n")
+	asm = generate(t, "double f(float a) { return a; }")
+	assert.Contains(asm, "    f64.promote_f32\n")
+}
+
+func TestGenerateUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(unsigned a, unsigned b) { return a / b + a % b + (a >> b) + (a < b); }")
+	for _, op := range []string{"div_u", "rem_u", "shr_u", "lt_u"} {
+		assert.Contains(asm, "    i32."+op+"\n")
+	}
+	asm = generate(t, "unsigned f(double d) { return d + (unsigned)d; }")
+	assert.Contains(asm, "    i64.trunc_sat_f64_s\n    i32.wrap_i64\n")
+	assert.Contains(asm, "    f64.convert_i32_u\n")
+}
+
+func TestGenerateIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `long f(long a, unsigned long b, short *s, int *p) {
+  *s = a;
+  return a / 2 + b % 3 + *s + (unsigned short)a + p[a];
+}`)
+	assert.Contains(asm, "(param $a i64)")
+	assert.Contains(asm, "    i64.div_s\n")
+	assert.Contains(asm, "    i64.rem_u\n")
+	assert.Contains(asm, "    i32.store16\n")
+	assert.Contains(asm, "    i32.load16_s\n")
+	assert.Contains(asm, "    i64.extend_i32_s\n")
+	assert.Contains(asm, "    i32.wrap_i64\n    i32.const 0xffff\n    i32.and\n")
+
+	asm = generate(t, "unsigned long f(double d, unsigned long a) { return d + a; }")
+	assert.Contains(asm, "    f64.convert_i64_u\n")
+	assert.Contains(asm, "    i64.trunc_sat_f64_u\n")
+}
+
+func TestGenerateCasts(t *testing.T) {
+	assert := assert.New(t)
+	// A pointer is an i32, so only the conversion to char is an instruction.
+	asm := generate(t, "int f(int x, char *p) { int *q = (int *)x; return (char)x + (int)(p == (char *)q); }")
+	assert.Contains(asm, "    local.get $x\n    local.set $3\n")
+	assert.Contains(asm, "    local.get $x\n    i32.extend8_s\n")
+}
+
+func TestGenerateSelect(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { return a ? 3 : 4; }")
+	assert.Contains(asm, "    i32.const 3\n    i32.const 4\n    local.get $a\n    select\n")
+}
+
+func TestGenerateCall(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int putchar(int c);
+double g(int a, double b);
+int main() { putchar(65); g(1, 2); return putchar(66); }`)
+	// Functions which are not defined are imported.
+	assert.Contains(asm, `(module
+  (import "env" "g" (func $g (param i32 f64) (result f64)))
+  (import "env" "putchar" (func $putchar (param i32) (result i32)))
+`)
+	assert.Contains(asm, "    i32.const 65\n    call $putchar\n    local.set $0\n")
+	assert.Contains(asm, "    i32.const 1\n    local.get $1\n    call $g\n")
+}
+
+func TestGenerateLoop(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { while (a) a = a - 1; return a; }")
+	assert.Contains(asm, `    (local $.block i32)
+    loop $dispatch
+      block $L3
+        block $L2
+          block $L1
+            block $entry
+              local.get $.block
+              br_table $entry $L1 $L2 $L3
+            end
+          end
+          i32.const 3
+          local.set $.block
+          local.get $a
+          i32.eqz
+          br_if $dispatch
+        end
+`)
+	assert.Contains(asm, `        i32.const 1
+        local.set $.block
+        br $dispatch
+      end
+      local.get $a
+      return
+    end
+    unreachable
+  )
+`)
+}
+
+func TestGenerateBranch(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int a) { if (a) return 1; return 2; }")
+	assert.Contains(asm, `          i32.const 2
+          local.set $.block
+          local.get $a
+          i32.eqz
+          br_if $dispatch
+`)
+
+	// A branch to the next basic block is not taken if the condition is true.
+	f := &ir.Function{Name: "f", Result: types.Int}
+	a := f.NewVariable("a", types.Int)
+	f.Params = []*ir.Temp{a}
+	then, els := &ir.Label{ID: 1}, &ir.Label{ID: 2}
+	f.Emit(&ir.Branch{Cond: a, True: then, False: els})
+	f.Emit(els)
+	f.Emit(&ir.Return{Value: ir.NewInt(2, types.Int)})
+	f.Emit(then)
+	f.Emit(&ir.Return{Value: ir.NewInt(1, types.Int)})
+	var b bytes.Buffer
+	assert.NoError(Generate(&b, &ir.Program{Functions: []*ir.Function{f}}))
+	assert.Contains(b.String(), `          i32.const 2
+          local.set $.block
+          local.get $a
+          br_if $dispatch
+        end
+`)
+}
+
+func TestFormatFloat(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("0.1", formatFloat(0.1, 64))
+	assert.Equal("0.1", formatFloat(float64(float32(0.1)), 32))
+	assert.Equal("1e+100", formatFloat(1e100, 64))
+	assert.Equal("inf", formatFloat(math.Inf(1), 64))
+	assert.Equal("-inf", formatFloat(math.Inf(-1), 32))
+	assert.Equal("nan", formatFloat(math.NaN(), 64))
+}
+
+func TestGenerateUnsupportedInstruction(t *testing.T) {
+	assert := assert.New(t)
+	f := &ir.Function{Name: "main", Result: types.Double}
+	d := f.NewTemp(types.Double)
+	f.Emit(&ir.Unary{Op: ir.Not, Dst: d, Src: d})
+	f.Emit(&ir.Return{Value: d})
+	var b bytes.Buffer
+	err := Generate(&b, &ir.Program{Functions: []*ir.Function{f}})
+	assert.EqualError(err, "unsupported instruction %0:double = not %0")
+}
+
+func TestGenerateMemory(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int main() { int a = 1; int *p = &a; *p = 2; return *p; }")
+	assert.Contains(asm, `(module
+  (memory (export "memory") 1)
+  (global $__stack_pointer (mut i32) (i32.const 65536))
+`)
+	// The frame is allocated on entry, and freed on return.
+	assert.Contains(asm, `    (local $.frame i32)
+    global.get $__stack_pointer
+    i32.const 16
+    i32.sub
+    local.tee $.frame
+    global.set $__stack_pointer
+    local.get $.frame
+    local.set $0
+    local.get $0
+    i32.const 1
+    i32.store
+`)
+	assert.Contains(asm, `    local.get $p
+    i32.load
+    local.set $3
+    local.get $3
+    local.get $.frame
+    i32.const 16
+    i32.add
+    global.set $__stack_pointer
+    return
+`)
+	// Programs without slots do not use memory.
+	assert.NotContains(generate(t, "int f(int *p) { return *p; }"), "memory")
+}
+
+func TestGeneratePointerArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int f(int *p, int *q) { return (p + 1) - q + (p < q); }")
+	assert.Contains(asm, "    local.get $p\n    i32.const 1\n    i32.const 4\n    i32.mul\n    i32.add\n")
+	assert.Contains(asm, "    local.get $q\n    i32.sub\n    i32.const 4\n    i32.div_s\n")
+	assert.Contains(asm, "    i32.lt_u\n")
+}
+
+func TestGenerateGlobals(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "int a = 3; double d; float f = 1; int main() { return a; }")
+	// Globals follow the stack, at the start of the second page.
+	assert.Contains(asm, "(memory (export \"memory\") 2)\n")
+	assert.Contains(asm, "(data (i32.const 65536) \"\\03\\00\\00\\00\")\n")
+	assert.Contains(asm, "(data (i32.const 65552) \"\\00\\00\\80\\3f\")\n")
+	assert.Contains(asm, "i32.const 65536\n")
+}
+
+func TestGenerateStrings(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, `int main() { char *p = "hi"; char *q = "hi"; p[0] = p[1]; return p == q; }`)
+	assert.Contains(asm, "(data (i32.const 65536) \"\\68\\69\\00\")\n")
+	assert.Contains(asm, "    i32.load8_s\n")
+	assert.Contains(asm, "    i32.store8\n")
+}
+
+func TestGenerateLinkage(t *testing.T) {
+	assert := assert.New(t)
+	asm := generate(t, "static int f(int x) { return x; } int main() { return f(1); }")
+	// A static function is not exported.
+	assert.Contains(asm, "(func $f (param $x i32) (result i32)\n")
+	assert.Contains(asm, "(func $main (export \"main\") (result i32)\n")
+
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		"extern int n; int main() { return n; }")))
+	assert.NoError(err)
+	assert.NoError(sema.Check(program))
+	lowered, err := ir.Lower(program)
+	assert.NoError(err)
+	var b bytes.Buffer
+	assert.EqualError(Generate(&b, lowered), "extern global variable 'n' is not supported")
+}
+
+func TestGenerateVariadicCall(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		`int printf(char *format, ...); int main() { return printf("%d", 1); }`)))
+	assert.NoError(err)
+	assert.NoError(sema.Check(program))
+	lowered, err := ir.Lower(program)
+	assert.NoError(err)
+	var b bytes.Buffer
+	// The error is at the statement of the call.
+	assert.EqualError(Generate(&b, lowered), "1:45: call of variadic function 'printf' is not supported")
+}
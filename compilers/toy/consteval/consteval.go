@@ -0,0 +1,178 @@
+// Package consteval evaluates constant expressions at compile time: the case
+// labels, enumerator values, array sizes and global initializers which
+// semantic analysis checks, the expressions which the optimizer folds, and
+// the conditions of #if directives.
+//
+// Integer arithmetic is done in a width of some number of bits, and is
+// always defined: a result which overflows wraps around in two's complement,
+// as it does at run time, and a shift count uses only the low bits which can
+// shift a value of the width, as the shift instructions do. An operation
+// which would trap at run time, a division by zero or of the least value by
+// -1, is an error. The value of an unsigned integer narrower than 64 bits is
+// never negative, and that of a 64-bit one is its bits, which BinaryUnsigned
+// divides, compares and shifts as unsigned.
+package consteval
+
+import (
+	"errors"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"math/big"
+)
+
+// The widths of the ints of the language and of the integers of the
+// preprocessor, which evaluates the conditions of directives in the widest
+// type.
+const (
+	IntBits          = 32
+	PreprocessorBits = 64
+)
+
+// The errors of operations which are not constant.
+var (
+	ErrDivisionByZero = errors.New("division by zero")
+	ErrOverflow       = errors.New("integer overflow")
+	ErrNotConstant    = errors.New("operator is not constant")
+)
+
+// Wrap returns a value truncated to a signed integer of a width, wrapping
+// around if it is out of range.
+func Wrap(v int64, bits uint) int64 {
+	shift := 64 - bits
+	return v << shift >> shift
+}
+
+// WrapUnsigned returns a value truncated to an unsigned integer of a width,
+// which is never negative unless the width is 64.
+func WrapUnsigned(v int64, bits uint) int64 {
+	return int64(uint64(v) & (1<<bits - 1))
+}
+
+// Unary returns the result of a unary operator on an integer of a width.
+func Unary(op token.TokenType, x int64, bits uint) (int64, error) {
+	switch op {
+	case token.AdditionToken:
+		return x, nil
+	case token.NegationToken:
+		return Wrap(-x, bits), nil
+	case token.BitwiseComplementToken:
+		return Wrap(^x, bits), nil
+	case token.LogicalNegationToken:
+		return boolean(x == 0), nil
+	}
+	return 0, ErrNotConstant
+}
+
+// Binary returns the result of a binary operator on integers of a width.
+// Both operands of a logical operator are given, so a caller which does not
+// evaluate the right one, as at run time, must decide the result without it
+// if the left operand does.
+func Binary(op token.TokenType, x, y int64, bits uint) (int64, error) {
+	switch op {
+	case token.AdditionToken:
+		return Wrap(x+y, bits), nil
+	case token.NegationToken:
+		return Wrap(x-y, bits), nil
+	case token.MultiplicationToken:
+		return Wrap(x*y, bits), nil
+	case token.DivisionToken, token.ModuloToken:
+		if y == 0 {
+			return 0, ErrDivisionByZero
+		}
+		if y == -1 && x == Wrap(1<<(bits-1), bits) {
+			return 0, ErrOverflow
+		}
+		if op == token.DivisionToken {
+			return x / y, nil
+		}
+		return x % y, nil
+	case token.BitwiseAndToken:
+		return x & y, nil
+	case token.BitwiseOrToken:
+		return x | y, nil
+	case token.BitwiseXorToken:
+		return x ^ y, nil
+	case token.ShiftLeftToken:
+		return Wrap(x<<uint(y&int64(bits-1)), bits), nil
+	case token.ShiftRightToken:
+		return x >> uint(y&int64(bits-1)), nil
+	case token.EqualToken:
+		return boolean(x == y), nil
+	case token.NotEqualToken:
+		return boolean(x != y), nil
+	case token.LessThanToken:
+		return boolean(x < y), nil
+	case token.LessThanOrEqualToken:
+		return boolean(x <= y), nil
+	case token.GreaterThanToken:
+		return boolean(x > y), nil
+	case token.GreaterThanOrEqualToken:
+		return boolean(x >= y), nil
+	case token.AndToken:
+		return boolean(x != 0 && y != 0), nil
+	case token.OrToken:
+		return boolean(x != 0 || y != 0), nil
+	}
+	return 0, ErrNotConstant
+}
+
+// BinaryUnsigned returns the result of a binary operator on unsigned
+// integers of a width, or on an unsigned integer and a shift count. Division,
+// remainder, right shift and comparison are unsigned, and the other
+// operators give the results of Binary, truncated to the width.
+func BinaryUnsigned(op token.TokenType, x, y int64, bits uint) (int64, error) {
+	a, b := uint64(WrapUnsigned(x, bits)), uint64(WrapUnsigned(y, bits))
+	switch op {
+	case token.DivisionToken, token.ModuloToken:
+		if b == 0 {
+			return 0, ErrDivisionByZero
+		}
+		if op == token.DivisionToken {
+			return int64(a / b), nil
+		}
+		return int64(a % b), nil
+	case token.ShiftRightToken:
+		return int64(a >> (uint64(y) & uint64(bits-1))), nil
+	case token.LessThanToken:
+		return boolean(a < b), nil
+	case token.LessThanOrEqualToken:
+		return boolean(a <= b), nil
+	case token.GreaterThanToken:
+		return boolean(a > b), nil
+	case token.GreaterThanOrEqualToken:
+		return boolean(a >= b), nil
+	}
+	v, err := Binary(op, x, y, bits)
+	return WrapUnsigned(v, bits), err
+}
+
+// Overflows returns whether the result of an arithmetic operator on signed
+// integers of a width is out of its range, so that Unary or Binary wraps it
+// around: that of an addition, a subtraction, a multiplication or a
+// negation, which is the operator with one operand. This is the overflow
+// which is undefined behavior in C, and which trapping arithmetic detects.
+// A shift does not overflow, as the shift instructions do not detect it,
+// and nor does any other operator.
+func Overflows(op token.TokenType, bits uint, operands ...int64) bool {
+	v := big.NewInt(operands[0])
+	switch {
+	case len(operands) == 1 && op == token.NegationToken:
+		v.Neg(v)
+	case len(operands) == 2 && op == token.AdditionToken:
+		v.Add(v, big.NewInt(operands[1]))
+	case len(operands) == 2 && op == token.NegationToken:
+		v.Sub(v, big.NewInt(operands[1]))
+	case len(operands) == 2 && op == token.MultiplicationToken:
+		v.Mul(v, big.NewInt(operands[1]))
+	default:
+		return false
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+	return v.Cmp(limit) >= 0 || v.Cmp(limit.Neg(limit)) < 0
+}
+
+func boolean(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,141 @@
+package consteval
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(-56), Wrap(200, 8))
+	assert.Equal(int64(math.MinInt32), Wrap(math.MaxInt32+1, 32))
+	assert.Equal(int64(-1), Wrap(math.MaxUint32, 32))
+	assert.Equal(int64(math.MinInt64), Wrap(math.MinInt64, 64))
+}
+
+func TestWrapUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(200), WrapUnsigned(200, 8))
+	assert.Equal(int64(math.MaxUint32), WrapUnsigned(-1, 32))
+	assert.Equal(int64(0), WrapUnsigned(math.MaxUint32+1, 32))
+}
+
+func TestUnary(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		op   token.TokenType
+		x    int64
+		bits uint
+		want int64
+	}{
+		{token.AdditionToken, -3, 32, -3},
+		{token.NegationToken, 5, 32, -5},
+		{token.NegationToken, math.MinInt32, 32, math.MinInt32},
+		{token.NegationToken, -128, 8, -128},
+		{token.BitwiseComplementToken, 5, 32, -6},
+		{token.LogicalNegationToken, 5, 32, 0},
+		{token.LogicalNegationToken, 0, 64, 1},
+	} {
+		v, err := Unary(test.op, test.x, test.bits)
+		assert.NoError(err)
+		assert.Equal(test.want, v, test)
+	}
+	_, err := Unary(token.IncrementToken, 1, 32)
+	assert.Equal(ErrNotConstant, err)
+}
+
+func TestBinary(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		op   token.TokenType
+		x, y int64
+		bits uint
+		want int64
+	}{
+		{token.AdditionToken, math.MaxInt32, 1, 32, math.MinInt32},
+		{token.AdditionToken, math.MaxInt32, 1, 64, math.MaxInt32 + 1},
+		{token.NegationToken, math.MinInt64, 1, 64, math.MaxInt64},
+		{token.MultiplicationToken, 65536, 65536, 32, 0},
+		{token.DivisionToken, -7, 2, 32, -3},
+		{token.ModuloToken, -7, 2, 32, -1},
+		{token.DivisionToken, math.MinInt32, -1, 64, math.MaxInt32 + 1},
+		{token.BitwiseAndToken, 6, 3, 32, 2},
+		{token.BitwiseOrToken, 6, 3, 32, 7},
+		{token.BitwiseXorToken, 6, 3, 32, 5},
+		// A shift count uses only the bits of the width.
+		{token.ShiftLeftToken, 1, 33, 32, 2},
+		{token.ShiftLeftToken, 1, 33, 64, 1 << 33},
+		{token.ShiftLeftToken, 1, 31, 32, math.MinInt32},
+		{token.ShiftRightToken, -8, 1, 32, -4},
+		{token.ShiftRightToken, -8, 65, 64, -4},
+		{token.EqualToken, 2, 2, 32, 1},
+		{token.NotEqualToken, 2, 2, 32, 0},
+		{token.LessThanToken, -1, 0, 32, 1},
+		{token.LessThanOrEqualToken, 1, 0, 32, 0},
+		{token.GreaterThanToken, 1, 0, 32, 1},
+		{token.GreaterThanOrEqualToken, 0, 0, 32, 1},
+		{token.AndToken, 2, 0, 32, 0},
+		{token.OrToken, 0, 3, 32, 1},
+	} {
+		v, err := Binary(test.op, test.x, test.y, test.bits)
+		assert.NoError(err)
+		assert.Equal(test.want, v, test)
+	}
+}
+
+func TestBinaryTraps(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Binary(token.DivisionToken, 1, 0, 32)
+	assert.Equal(ErrDivisionByZero, err)
+	_, err = Binary(token.ModuloToken, 1, 0, 64)
+	assert.Equal(ErrDivisionByZero, err)
+	_, err = Binary(token.DivisionToken, math.MinInt32, -1, 32)
+	assert.Equal(ErrOverflow, err)
+	_, err = Binary(token.ModuloToken, math.MinInt64, -1, 64)
+	assert.Equal(ErrOverflow, err)
+	_, err = Binary(token.AssignmentToken, 1, 2, 32)
+	assert.Equal(ErrNotConstant, err)
+}
+
+func TestOverflows(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(Overflows(token.AdditionToken, 32, math.MaxInt32, 1))
+	assert.False(Overflows(token.AdditionToken, 64, math.MaxInt32, 1))
+	assert.True(Overflows(token.AdditionToken, 64, math.MaxInt64, 1))
+	assert.True(Overflows(token.NegationToken, 32, math.MinInt32, 1))
+	assert.False(Overflows(token.NegationToken, 32, -1, math.MaxInt32))
+	assert.True(Overflows(token.MultiplicationToken, 32, 65536, 32768))
+	assert.False(Overflows(token.MultiplicationToken, 32, -65536, 32768))
+	assert.True(Overflows(token.NegationToken, 32, math.MinInt32))
+	assert.False(Overflows(token.NegationToken, 32, math.MaxInt32))
+	assert.True(Overflows(token.NegationToken, 8, -128))
+	// Shifts and the other operators do not overflow.
+	assert.False(Overflows(token.ShiftLeftToken, 32, 1, 31))
+	assert.False(Overflows(token.BitwiseComplementToken, 32, math.MinInt32))
+}
+
+func TestBinaryUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		op   token.TokenType
+		x, y int64
+		bits uint
+		want int64
+	}{
+		{token.DivisionToken, math.MaxUint32, 2, 32, math.MaxInt32},
+		{token.ModuloToken, -1, 10, 64, 5},
+		{token.ShiftRightToken, -8, 1, 64, math.MaxInt64 - 3},
+		{token.LessThanToken, 1, -1, 64, 1},
+		{token.GreaterThanOrEqualToken, 1, -1, 64, 0},
+		{token.NegationToken, 0, 1, 32, math.MaxUint32},
+		{token.AdditionToken, -1, 1, 64, 0},
+	} {
+		v, err := BinaryUnsigned(test.op, test.x, test.y, test.bits)
+		assert.NoError(err, "%v", test)
+		assert.Equal(test.want, v, "%v", test)
+	}
+	_, err := BinaryUnsigned(token.DivisionToken, 1, 0, 64)
+	assert.Equal(ErrDivisionByZero, err)
+}
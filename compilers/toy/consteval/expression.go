@@ -0,0 +1,224 @@
+package consteval
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"math"
+)
+
+// Int returns the value of an integer constant expression: one built from
+// int literals, enumerators, sizeof expressions, casts and operators, such as
+// the value of a case label. Its subexpressions must have been type checked.
+// An expression which would trap, such as a division by zero, is not
+// constant. Like at run time, the right operand of a logical operator is
+// not evaluated if the left decides the result, nor is the operand of a
+// conditional expression which is not selected.
+func Int(e ast.Expression) (int64, bool) {
+	return evaluate(e, false)
+}
+
+// Exact returns the value of an integer constant expression, like Int, unless
+// arithmetic in it overflows, as Overflows reports, which is then not
+// constant, since it traps at run time if overflow is trapped.
+func Exact(e ast.Expression) (int64, bool) {
+	return evaluate(e, true)
+}
+
+// evaluate returns the value of an integer constant expression, which is not
+// constant if it overflows and must be exact.
+func evaluate(e ast.Expression, exact bool) (int64, bool) {
+	switch n := e.(type) {
+	case *ast.IntLiteral:
+		if !types.IsInteger(n.Type) {
+			return 0, false
+		}
+		return Convert(n.Value, n.Type), true
+	case *ast.UnaryOp:
+		x, ok := evaluate(n.Operand, exact)
+		if !ok {
+			return 0, false
+		}
+		t := ast.TypeOf(n.Operand)
+		if exact && !types.IsUnsigned(t) && Overflows(n.Operator.Type, types.Width(t), x) {
+			return 0, false
+		}
+		v, err := Unary(n.Operator.Type, x, types.Width(t))
+		return Convert(v, n.Type), err == nil
+	case *ast.Identifier:
+		if n.Symbol == nil || n.Symbol.Kind != ast.EnumeratorSymbol {
+			return 0, false
+		}
+		return n.Symbol.Value, true
+	case *ast.Sizeof:
+		return n.Value, n.Type != nil
+	case *ast.Conversion:
+		return conversion(n, exact)
+	case *ast.BinaryOp:
+		x, ok := evaluate(n.Lhs, exact)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case n.Operator.Type == token.AndToken && x == 0:
+			return 0, true
+		case n.Operator.Type == token.OrToken && x != 0:
+			return 1, true
+		}
+		y, ok := evaluate(n.Rhs, exact)
+		if !ok {
+			return 0, false
+		}
+		// The operands have the same type, except those of a shift and a
+		// logical operator, whose result does not depend on it.
+		t := ast.TypeOf(n.Lhs)
+		if types.IsUnsigned(t) {
+			v, err := BinaryUnsigned(n.Operator.Type, x, y, types.Width(t))
+			return Convert(v, n.Type), err == nil
+		}
+		if exact && Overflows(n.Operator.Type, types.Width(t), x, y) {
+			return 0, false
+		}
+		v, err := Binary(n.Operator.Type, x, y, types.Width(t))
+		return Convert(v, n.Type), err == nil
+	case *ast.ConditionalExpression:
+		x, ok := evaluate(n.Cond, exact)
+		if !ok {
+			return 0, false
+		}
+		if x != 0 {
+			return evaluate(n.Then, exact)
+		}
+		return evaluate(n.Else, exact)
+	}
+	return 0, false
+}
+
+// conversion returns the value of a conversion to an integer type of an
+// integer constant expression, or of a cast to one of a floating-point
+// literal which is in range. Conversions to narrower and unsigned types wrap
+// to their range.
+func conversion(c *ast.Conversion, exact bool) (int64, bool) {
+	if !types.IsInteger(c.Type) {
+		return 0, false
+	}
+	v, ok := evaluate(c.Operand, exact)
+	if !ok && !c.Implicit {
+		var f float64
+		if f, ok = Float(c.Operand); ok {
+			v, ok = Truncate(f, c.Type)
+		}
+	}
+	if !ok {
+		return 0, false
+	}
+	return Convert(v, c.Type), true
+}
+
+// Convert returns an integer converted to an integer type, wrapping to its
+// range.
+func Convert(v int64, t types.Type) int64 {
+	if types.IsUnsigned(t) {
+		return WrapUnsigned(v, types.Width(t))
+	}
+	return Wrap(v, types.Width(t))
+}
+
+// Truncate returns a floating-point value truncated towards zero to an
+// integer type, and whether it is in the range of the type.
+func Truncate(f float64, t types.Type) (int64, bool) {
+	f = math.Trunc(f)
+	bits := int(types.Width(t))
+	min, max := -math.Ldexp(1, bits-1), math.Ldexp(1, bits-1)
+	if types.IsUnsigned(t) {
+		min, max = 0, math.Ldexp(1, bits)
+	}
+	if !(f >= min && f < max) {
+		return 0, false
+	}
+	if f >= math.Ldexp(1, 63) {
+		// An unsigned long which is too large for a long is its bits.
+		return int64(uint64(f)), true
+	}
+	return int64(f), true
+}
+
+// FloatToInt returns a floating-point value converted to an integer type as
+// the x86-64 conversion instructions convert it, which is defined for any
+// value. It is truncated to an int, and then to a narrower type, or to a
+// long, and then to an unsigned int, and a value which is out of the range
+// of the int or long becomes its least value. A value too large for a long
+// is converted to an unsigned long by subtracting 2 to the power of 63 and
+// setting the top bit of the result.
+func FloatToInt(f float64, t types.Type) int64 {
+	via := types.Int
+	switch {
+	case t == types.UnsignedLong && f >= math.Ldexp(1, 63):
+		return FloatToInt(f-math.Ldexp(1, 63), types.Long) ^ math.MinInt64
+	case t == types.UnsignedInt || types.Width(t) == 64:
+		via = types.Long
+	}
+	v, ok := Truncate(f, via)
+	if !ok {
+		v = -1 << (types.Width(via) - 1)
+	}
+	return Convert(v, t)
+}
+
+// Float returns the value of a floating-point literal, which may be negated.
+func Float(e ast.Expression) (float64, bool) {
+	switch n := e.(type) {
+	case *ast.FloatLiteral:
+		return n.Value, true
+	case *ast.UnaryOp:
+		if n.Operator.Type == token.NegationToken {
+			if v, ok := Float(n.Operand); ok {
+				return -v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Initializer returns the value of the initializer of a global variable,
+// converted to the type of the variable: an integer constant expression, or
+// a floating-point literal which may be negated. It is the floating-point
+// value f if the type is floating-point, and otherwise the integer i, which
+// is exact. Conversions to integer types are those of FloatToInt and
+// Convert, as at run time, and the only constant pointer is the null
+// pointer.
+func Initializer(e ast.Expression) (f float64, i int64, ok bool) {
+	t := ast.TypeOf(e)
+	if c, ok := e.(*ast.Conversion); ok {
+		e = c.Operand
+	}
+	f, isFloat := Float(e)
+	if !isFloat {
+		if i, ok = Int(e); !ok {
+			return 0, 0, false
+		}
+		f = float64(i)
+	}
+	switch {
+	case types.IsPointer(t):
+		return 0, 0, i == 0 && f == 0
+	case t == types.Float:
+		return float64(float32(f)), 0, true
+	case types.IsFloating(t):
+		if !isFloat && types.IsUnsigned(ast.TypeOf(e)) && i < 0 {
+			// An unsigned long too large for a long.
+			f = float64(uint64(i))
+		}
+		return f, 0, true
+	case isFloat:
+		return 0, FloatToInt(f, t), true
+	}
+	return 0, Convert(i, t), true
+}
+
+// IsNullPointerConstant returns whether an expression is an integer constant
+// expression with the value zero, which converts to a null pointer.
+func IsNullPointerConstant(e ast.Expression) bool {
+	v, ok := Int(e)
+	return ok && v == 0
+}
@@ -0,0 +1,62 @@
+// Package diag implements diagnostics: errors, warnings and notes about a
+// program, at locations in its source text.
+package diag
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// The severity of a diagnostic.
+type Severity uint8
+
+const (
+	Error   Severity = iota // The program is invalid.
+	Warning                 // The program is valid, but probably not what was meant.
+	Note                    // Additional information about another diagnostic.
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	}
+	return fmt.Sprintf("Severity(%d)", s)
+}
+
+// A diagnostic message about a span of the source text.
+type Diagnostic struct {
+	Severity Severity
+	// The start of the span. Its filename is set if it is not in the source
+	// file being compiled, such as in a file which that includes.
+	Pos    token.Position
+	Length int // The length of the span in runes, or 0 if unknown.
+	Msg    string
+	// A short name for the kind of diagnostic, such as "syntax", for tools
+	// which consume diagnostics.
+	Code string
+	// Notes which elaborate on the diagnostic, each of severity Note.
+	Notes []*Diagnostic
+}
+
+// Notef attaches a note to a diagnostic, returning the diagnostic.
+func (d *Diagnostic) Notef(pos token.Position, length int, format string, args ...interface{}) *Diagnostic {
+	d.Notes = append(d.Notes, &Diagnostic{
+		Severity: Note,
+		Pos:      pos,
+		Length:   length,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+	return d
+}
+
+// String returns a "line:column: severity: message" representation of a
+// diagnostic, without its notes. The location is prefixed by the filename of
+// its position, if it has one.
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%v: %v: %s", d.Pos, d.Severity, d.Msg)
+}
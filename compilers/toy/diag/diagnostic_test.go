@@ -0,0 +1,38 @@
+package diag
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSeverityString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("error", Error.String())
+	assert.Equal("warning", Warning.String())
+	assert.Equal("note", Note.String())
+	assert.Equal("Severity(9)", Severity(9).String())
+}
+
+func TestDiagnosticString(t *testing.T) {
+	assert := assert.New(t)
+	d := &Diagnostic{
+		Severity: Warning,
+		Pos:      token.Position{Offset: 4, Line: 2, Column: 3},
+		Msg:      "unreachable code",
+	}
+	assert.Equal("2:3: warning: unreachable code", d.String())
+}
+
+func TestDiagnosticNotef(t *testing.T) {
+	assert := assert.New(t)
+	d := &Diagnostic{Severity: Error, Msg: "redefinition of 'a'"}
+	pos := token.Position{Offset: 4, Line: 1, Column: 5}
+	assert.Equal(d, d.Notef(pos, 1, "previous definition of '%s'", "a"))
+	assert.Equal([]*Diagnostic{{
+		Severity: Note,
+		Pos:      pos,
+		Length:   1,
+		Msg:      "previous definition of 'a'",
+	}}, d.Notes)
+}
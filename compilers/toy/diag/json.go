@@ -0,0 +1,53 @@
+package diag
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// The JSON representation of a diagnostic. Lines and columns are omitted if
+// the position of the diagnostic is unknown.
+type jsonDiagnostic struct {
+	File     string            `json:"file"`
+	Line     int               `json:"line,omitempty"`
+	Column   int               `json:"column,omitempty"`
+	Length   int               `json:"length,omitempty"`
+	Severity string            `json:"severity"`
+	Message  string            `json:"message"`
+	Code     string            `json:"code,omitempty"`
+	Notes    []*jsonDiagnostic `json:"notes,omitempty"`
+}
+
+func newJSONDiagnostic(filename string, d *Diagnostic) *jsonDiagnostic {
+	file := filename
+	if d.Pos.Filename != "" {
+		file = d.Pos.Filename
+	}
+	j := &jsonDiagnostic{
+		File:     file,
+		Severity: d.Severity.String(),
+		Message:  d.Msg,
+		Code:     d.Code,
+	}
+	if d.Pos.IsValid() {
+		j.Line, j.Column, j.Length = d.Pos.Line, d.Pos.Column, d.Length
+	}
+	for _, n := range d.Notes {
+		j.Notes = append(j.Notes, newJSONDiagnostic(filename, n))
+	}
+	return j
+}
+
+// WriteJSON writes the diagnostics of a source file as a JSON array, for
+// consumption by editors and other tools. Each diagnostic is an object such
+// as:
+//
+//	{"file": "a.c", "line": 1, "column": 21, "length": 1, "severity": "error",
+//	 "message": "undefined identifier 'b'", "code": "semantic"}
+func WriteJSON(w io.Writer, filename string, diagnostics []*Diagnostic) error {
+	list := make([]*jsonDiagnostic, len(diagnostics))
+	for i, d := range diagnostics {
+		list[i] = newJSONDiagnostic(filename, d)
+	}
+	return json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,51 @@
+package diag
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	d := (&Diagnostic{
+		Severity: Error,
+		Pos:      token.Position{Offset: 11, Line: 2, Column: 5},
+		Length:   1,
+		Msg:      "redefinition of 'a'",
+		Code:     "semantic",
+	}).Notef(token.Position{Offset: 4, Line: 1, Column: 5}, 1, "previous definition")
+	assert.NoError(WriteJSON(&b, "a.c", []*Diagnostic{
+		d,
+		{Severity: Warning, Msg: "no position"},
+	}))
+	assert.JSONEq(`[
+		{"file": "a.c", "line": 2, "column": 5, "length": 1, "severity": "error",
+		 "message": "redefinition of 'a'", "code": "semantic",
+		 "notes": [{"file": "a.c", "line": 1, "column": 5, "length": 1,
+		            "severity": "note", "message": "previous definition"}]},
+		{"file": "a.c", "severity": "warning", "message": "no position"}
+	]`, b.String())
+}
+
+func TestWriteJSONOtherFile(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	d := (&Diagnostic{Severity: Error, Pos: token.Position{Filename: "a.h", Offset: 10, Line: 1, Column: 11}, Msg: "bad"}).
+		Notef(at(0), 0, "included here")
+	assert.NoError(WriteJSON(&b, "a.c", []*Diagnostic{d}))
+	assert.JSONEq(`[
+		{"file": "a.h", "line": 1, "column": 11, "severity": "error", "message": "bad",
+		 "notes": [{"file": "a.c", "line": 1, "column": 1, "severity": "note",
+		            "message": "included here"}]}
+	]`, b.String())
+}
+
+func TestWriteJSONEmpty(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.NoError(WriteJSON(&b, "a.c", nil))
+	assert.Equal("[]\n", b.String())
+}
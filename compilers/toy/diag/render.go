@@ -0,0 +1,145 @@
+package diag
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Renderer writes the diagnostics of a source file in the style of clang:
+//
+//	file.c:1:21: error: undefined identifier 'b'
+//	int main() { return b; }
+//	                    ^
+type Renderer struct {
+	Filename string
+	Source   []byte
+	// The text of the other files which diagnostics may be in, by name.
+	Files map[string][]byte
+	// Color enables ANSI escape sequences, for output to a terminal.
+	Color bool
+}
+
+// ANSI escape sequences which select the style of text.
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	red    = "\x1b[1;31m"
+	yellow = "\x1b[1;33m"
+	cyan   = "\x1b[1;36m"
+)
+
+// The style of the name of each severity.
+var severityStyles = map[Severity]string{
+	Error:   red,
+	Warning: yellow,
+	Note:    cyan,
+}
+
+// style returns text in the given style, if color is enabled.
+func (r *Renderer) style(text, style string) string {
+	if !r.Color {
+		return text
+	}
+	return style + text + reset
+}
+
+// Render writes a diagnostic followed by its notes. Each is written as a
+// "file:line:column: severity: message" line, then the line of source that it
+// refers to, with its span underlined.
+func (r *Renderer) Render(w io.Writer, d *Diagnostic) {
+	location := r.Filename + ":"
+	if d.Pos.Filename != "" {
+		location = d.Pos.Filename + ":"
+	}
+	if d.Pos.IsValid() {
+		location += fmt.Sprintf("%d:%d:", d.Pos.Line, d.Pos.Column)
+	}
+	fmt.Fprintf(w, "%s %s %s\n", r.style(location, bold),
+		r.style(d.Severity.String()+":", severityStyles[d.Severity]),
+		r.style(d.Msg, bold))
+	if d.Pos.IsValid() {
+		r.snippet(w, d)
+	}
+	for _, n := range d.Notes {
+		r.Render(w, n)
+	}
+}
+
+// RenderAll writes a list of diagnostics.
+func (r *Renderer) RenderAll(w io.Writer, diagnostics []*Diagnostic) {
+	for _, d := range diagnostics {
+		r.Render(w, d)
+	}
+}
+
+// snippet writes the line of source containing the start of a diagnostic, and
+// beneath it a caret at the start of its span, and tildes under the rest. The
+// span is cut off at the end of the line.
+func (r *Renderer) snippet(w io.Writer, d *Diagnostic) {
+	source, offset := r.Source, d.Pos.Offset
+	if name := d.Pos.Filename; name != "" && name != r.Filename {
+		// The offset of a position named by a line directive is not in the
+		// file which it names, so the file is found by line and column.
+		var ok bool
+		if source, ok = r.Files[name]; !ok {
+			return
+		}
+		if offset, ok = lineOffset(source, d.Pos.Line, d.Pos.Column); !ok {
+			return
+		}
+	}
+	if offset < 0 || offset > len(source) {
+		return
+	}
+	start := bytes.LastIndexByte(source[:offset], '\n') + 1
+	end := bytes.IndexByte(source[offset:], '\n')
+	if end < 0 {
+		end = len(source)
+	} else {
+		end += offset
+	}
+	line := strings.TrimSuffix(string(source[start:end]), "\r")
+	if offset-start > len(line) {
+		return
+	}
+
+	// Indent the caret with the whitespace of the line, so that tabs line up.
+	var indent strings.Builder
+	for _, c := range line[:offset-start] {
+		if c == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	length := d.Length
+	if rest := utf8.RuneCountInString(line[offset-start:]); length > rest {
+		length = rest
+	}
+	underline := "^"
+	if length > 1 {
+		underline += strings.Repeat("~", length-1)
+	}
+	fmt.Fprintf(w, "%s\n%s%s\n", line, indent.String(), r.style(underline, bold))
+}
+
+// lineOffset returns the byte offset of a line and column of source, if the
+// line exists.
+func lineOffset(source []byte, line, column int) (int, bool) {
+	offset := 0
+	for ; line > 1; line-- {
+		i := bytes.IndexByte(source[offset:], '\n')
+		if i < 0 {
+			return 0, false
+		}
+		offset += i + 1
+	}
+	for ; column > 1 && offset < len(source) && source[offset] != '\n'; column-- {
+		_, size := utf8.DecodeRune(source[offset:])
+		offset += size
+	}
+	return offset, true
+}
@@ -0,0 +1,183 @@
+package diag
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// render renders a diagnostic for a source file named "a.c".
+func render(source string, d *Diagnostic) string {
+	var b bytes.Buffer
+	r := &Renderer{Filename: "a.c", Source: []byte(source)}
+	r.Render(&b, d)
+	return b.String()
+}
+
+// at returns the position of a byte offset into a single line of source.
+func at(offset int) token.Position {
+	return token.Position{Offset: offset, Line: 1, Column: offset + 1}
+}
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+	d := &Diagnostic{Severity: Error, Pos: at(20), Msg: "undefined identifier 'b'"}
+	assert.Equal(`a.c:1:21: error: undefined identifier 'b'
+int main() { return b; }
+                    ^
+`, render("int main() { return b; }", d))
+}
+
+func TestRenderSpan(t *testing.T) {
+	assert := assert.New(t)
+	d := &Diagnostic{Severity: Warning, Pos: at(4), Length: 4, Msg: "unused"}
+	assert.Equal(`a.c:1:5: warning: unused
+int main() {}
+    ^~~~
+`, render("int main() {}", d))
+
+	// A span is cut off at the end of the line.
+	d = &Diagnostic{Severity: Error, Pos: at(4), Length: 10, Msg: "long"}
+	assert.Equal(`a.c:1:5: error: long
+int abc
+    ^~~
+`, render("int abc\nint d;", d))
+}
+
+func TestRenderLine(t *testing.T) {
+	assert := assert.New(t)
+	source := "int main() {\r\n  return x;\r\n}\r\n"
+	d := &Diagnostic{
+		Severity: Error,
+		Pos:      token.Position{Offset: 23, Line: 2, Column: 10},
+		Length:   1,
+		Msg:      "expected ';'",
+	}
+	assert.Equal(`a.c:2:10: error: expected ';'
+  return x;
+         ^
+`, render(source, d))
+}
+
+func TestRenderAlignsTabs(t *testing.T) {
+	assert := assert.New(t)
+	d := &Diagnostic{
+		Severity: Error,
+		Pos:      token.Position{Offset: 3, Line: 1, Column: 4},
+		Length:   2,
+		Msg:      "bad",
+	}
+	assert.Equal("a.c:1:4: error: bad\n\t\tx=yy;\n\t\t ^~\n", render("\t\tx=yy;", d))
+}
+
+func TestRenderUnicode(t *testing.T) {
+	assert := assert.New(t)
+	// Columns count runes, not bytes.
+	d := &Diagnostic{
+		Severity: Error,
+		Pos:      token.Position{Offset: 6, Line: 1, Column: 6},
+		Length:   3,
+		Msg:      "bad",
+	}
+	assert.Equal("a.c:1:6: error: bad\n/*é*/abc\n     ^~~\n", render("/*é*/abc", d))
+}
+
+func TestRenderEndOfInput(t *testing.T) {
+	assert := assert.New(t)
+	d := &Diagnostic{Severity: Error, Pos: at(11), Msg: "expected '}'"}
+	assert.Equal(`a.c:1:12: error: expected '}'
+int main() 
+           ^
+`, render("int main() ", d))
+}
+
+func TestRenderWithoutPosition(t *testing.T) {
+	assert := assert.New(t)
+	d := &Diagnostic{Severity: Error, Msg: "no main function"}
+	assert.Equal("a.c: error: no main function\n", render("", d))
+
+	// Nor is a snippet rendered if the position is outside of the source.
+	d = &Diagnostic{Severity: Error, Pos: at(100), Msg: "bad"}
+	assert.Equal("a.c:1:101: error: bad\n", render("int", d))
+}
+
+func TestRenderNotes(t *testing.T) {
+	assert := assert.New(t)
+	d := (&Diagnostic{Severity: Error, Pos: at(11), Length: 1, Msg: "redefinition of 'a'"}).
+		Notef(at(4), 1, "previous definition is here")
+	assert.Equal(`a.c:1:12: error: redefinition of 'a'
+int a; int a;
+           ^
+a.c:1:5: note: previous definition is here
+int a; int a;
+    ^
+`, render("int a; int a;", d))
+}
+
+func TestRenderOtherFile(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	r := &Renderer{
+		Filename: "a.c",
+		Source:   []byte("#include \"a.h\"\nint b = A;"),
+		Files:    map[string][]byte{"a.h": []byte("#define A x")},
+	}
+	d := (&Diagnostic{Severity: Error, Pos: token.Position{Filename: "a.h", Offset: 10, Line: 1, Column: 11}, Length: 1, Msg: "undefined identifier 'x'"}).
+		Notef(token.Position{Offset: 23, Line: 2, Column: 9}, 1, "expanded from here")
+	r.Render(&b, d)
+	assert.Equal(`a.h:1:11: error: undefined identifier 'x'
+#define A x
+          ^
+a.c:2:9: note: expanded from here
+int b = A;
+        ^
+`, b.String())
+}
+
+func TestRenderFileNamedByLineDirective(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	r := &Renderer{
+		Filename: "a.i",
+		Source:   []byte("# 1 \"a.c\"\nint x;\n\nint y = z;"),
+		Files:    map[string][]byte{"a.c": []byte("int x;\n\n/* \u00e9 */ int y = z;")},
+	}
+	// The offset is in the lexed file, so the line is found in the named file
+	// by its number.
+	r.Render(&b, &Diagnostic{Severity: Error, Pos: token.Position{Filename: "a.c", Offset: 28, Line: 3, Column: 17},
+		Length: 1, Msg: "undefined identifier 'z'"})
+	r.Render(&b, &Diagnostic{Severity: Error, Pos: token.Position{Filename: "a.c", Line: 4, Column: 1}, Msg: "past the end"})
+	r.Render(&b, &Diagnostic{Severity: Error, Pos: token.Position{Filename: "b.c", Line: 1, Column: 1}, Msg: "unknown file"})
+	assert.Equal(`a.c:3:17: error: undefined identifier 'z'
+/* é */ int y = z;
+                ^
+a.c:4:1: error: past the end
+b.c:1:1: error: unknown file
+`, b.String())
+}
+
+func TestRenderColor(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	r := &Renderer{Filename: "a.c", Source: []byte("int a;"), Color: true}
+	r.Render(&b, (&Diagnostic{Severity: Warning, Pos: at(4), Length: 2, Msg: "unused"}).
+		Notef(token.Position{}, 0, "declared here"))
+	r.Render(&b, &Diagnostic{Severity: Error, Msg: "bad"})
+	assert.Equal("\x1b[1ma.c:1:5:\x1b[0m \x1b[1;33mwarning:\x1b[0m \x1b[1munused\x1b[0m\n"+
+		"int a;\n"+
+		"    \x1b[1m^~\x1b[0m\n"+
+		"\x1b[1ma.c:\x1b[0m \x1b[1;36mnote:\x1b[0m \x1b[1mdeclared here\x1b[0m\n"+
+		"\x1b[1ma.c:\x1b[0m \x1b[1;31merror:\x1b[0m \x1b[1mbad\x1b[0m\n", b.String())
+}
+
+func TestRenderAll(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	r := &Renderer{Filename: "-", Source: []byte("x")}
+	r.RenderAll(&b, []*Diagnostic{
+		{Severity: Warning, Pos: at(0), Msg: "one"},
+		{Severity: Error, Msg: "two"},
+	})
+	assert.Equal("-:1:1: warning: one\nx\n^\n-: error: two\n", b.String())
+}
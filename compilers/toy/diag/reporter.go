@@ -0,0 +1,86 @@
+package diag
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// A Reporter collects the diagnostics of each stage of a compilation, in the
+// order that they are reported. The zero Reporter is ready to use.
+type Reporter struct {
+	// MaxErrors is the number of errors after which the diagnostics reported
+	// are discarded, or 0 for no limit. An error which says so follows the
+	// last, and the stages of the compilation stop once it is reached.
+	MaxErrors int
+	// WarningsAsErrors is whether each warning is reported as an error.
+	WarningsAsErrors bool
+	// Warnings is the set of the warnings which are reported, by the codes
+	// of their diagnostics, or nil to report every warning.
+	Warnings    WarningSet
+	diagnostics []*Diagnostic
+	errors      int
+}
+
+// Report adds a diagnostic, unless the limit of errors has been reached or it
+// is a warning which is not enabled.
+func (r *Reporter) Report(d *Diagnostic) {
+	if r.LimitReached() {
+		return
+	}
+	if d.Severity == Warning && r.Warnings != nil && !r.Warnings.Enabled(d.Code) {
+		return
+	}
+	if r.WarningsAsErrors && d.Severity == Warning {
+		d.Severity = Error
+	}
+	r.diagnostics = append(r.diagnostics, d)
+	if d.Severity == Error {
+		r.errors++
+		if r.LimitReached() {
+			r.diagnostics = append(r.diagnostics, &Diagnostic{
+				Severity: Error,
+				Msg:      fmt.Sprintf("too many errors, stopping after %d", r.MaxErrors),
+				Code:     "max-errors",
+			})
+		}
+	}
+}
+
+// LimitReached returns whether the limit of errors has been reached, so that
+// no more diagnostics are reported.
+func (r *Reporter) LimitReached() bool {
+	return r.MaxErrors > 0 && r.errors >= r.MaxErrors
+}
+
+// Errorf reports an error, returning it so that notes may be attached.
+func (r *Reporter) Errorf(pos token.Position, length int, format string, args ...interface{}) *Diagnostic {
+	return r.report(Error, pos, length, format, args...)
+}
+
+// Warningf reports a warning, returning it so that notes may be attached.
+func (r *Reporter) Warningf(pos token.Position, length int, format string, args ...interface{}) *Diagnostic {
+	return r.report(Warning, pos, length, format, args...)
+}
+
+func (r *Reporter) report(severity Severity, pos token.Position, length int, format string, args ...interface{}) *Diagnostic {
+	d := &Diagnostic{
+		Severity: severity,
+		Pos:      pos,
+		Length:   length,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+	r.Report(d)
+	return d
+}
+
+// Diagnostics returns the diagnostics reported so far.
+func (r *Reporter) Diagnostics() []*Diagnostic {
+	return r.diagnostics
+}
+
+// ErrorCount returns the number of errors reported so far, including warnings
+// reported as errors, but not the error which says that the limit of errors
+// was reached.
+func (r *Reporter) ErrorCount() int {
+	return r.errors
+}
@@ -0,0 +1,77 @@
+package diag
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReporter(t *testing.T) {
+	assert := assert.New(t)
+	var r Reporter
+	assert.Empty(r.Diagnostics())
+	assert.Equal(0, r.ErrorCount())
+
+	pos := token.Position{Offset: 0, Line: 1, Column: 1}
+	w := r.Warningf(pos, 3, "unused variable '%s'", "abc")
+	e := r.Errorf(pos, 0, "expected %d", 1)
+	r.Report(&Diagnostic{Severity: Error, Msg: "another"})
+	assert.Equal(&Diagnostic{
+		Severity: Warning, Pos: pos, Length: 3, Msg: "unused variable 'abc'",
+	}, w)
+	assert.Equal(&Diagnostic{Severity: Error, Pos: pos, Msg: "expected 1"}, e)
+
+	// Diagnostics are kept in the order that they were reported.
+	assert.Len(r.Diagnostics(), 3)
+	assert.Equal(w, r.Diagnostics()[0])
+	assert.Equal(e, r.Diagnostics()[1])
+	assert.Equal(2, r.ErrorCount())
+}
+
+func TestReporterMaxErrors(t *testing.T) {
+	assert := assert.New(t)
+	r := Reporter{MaxErrors: 2}
+	pos := token.Position{Offset: 0, Line: 1, Column: 1}
+	r.Warningf(pos, 0, "a")
+	r.Errorf(pos, 0, "b")
+	assert.False(r.LimitReached())
+	r.Errorf(pos, 0, "c")
+	assert.True(r.LimitReached())
+	// Diagnostics after the limit are discarded.
+	r.Errorf(pos, 0, "d")
+	r.Warningf(pos, 0, "e")
+	var messages []string
+	for _, d := range r.Diagnostics() {
+		messages = append(messages, d.Msg)
+	}
+	assert.Equal([]string{"a", "b", "c", "too many errors, stopping after 2"}, messages)
+	assert.Equal("max-errors", r.Diagnostics()[3].Code)
+	assert.Equal(2, r.ErrorCount())
+}
+
+func TestReporterWarningsAsErrors(t *testing.T) {
+	assert := assert.New(t)
+	r := Reporter{WarningsAsErrors: true}
+	w := r.Warningf(token.Position{Offset: 0, Line: 1, Column: 1}, 0, "unused")
+	assert.Equal(Error, w.Severity)
+	assert.Equal(1, r.ErrorCount())
+	// Notes are not promoted.
+	w.Notef(token.Position{}, 0, "declared here")
+	assert.Equal(Note, w.Notes[0].Severity)
+
+	// A promoted warning counts towards the limit of errors.
+	r = Reporter{WarningsAsErrors: true, MaxErrors: 1}
+	r.Warningf(token.Position{}, 0, "unused")
+	assert.True(r.LimitReached())
+}
+
+func TestReporterWarnings(t *testing.T) {
+	assert := assert.New(t)
+	r := Reporter{Warnings: DefaultWarnings(), WarningsAsErrors: true}
+	r.Report(&Diagnostic{Severity: Warning, Msg: "unreachable", Code: UnreachableCode})
+	r.Report(&Diagnostic{Severity: Warning, Msg: "shadowed", Code: Shadow})
+	r.Report(&Diagnostic{Severity: Error, Msg: "undefined", Code: "semantic"})
+	assert.Equal(2, len(r.Diagnostics()))
+	assert.Equal("unreachable", r.Diagnostics()[0].Msg)
+	assert.Equal("undefined", r.Diagnostics()[1].Msg)
+}
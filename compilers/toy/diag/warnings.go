@@ -0,0 +1,110 @@
+package diag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The names of the warnings, each of which is the code of the diagnostics
+// that it reports, and may be enabled or disabled by name, as by the -W
+// flags of a compiler.
+const (
+	// A statement which can never be executed.
+	UnreachableCode = "unreachable-code"
+	// A local variable whose value is never read.
+	UnusedVariable = "unused-variable"
+	// A parameter of a function whose value is never read.
+	UnusedParameter = "unused-parameter"
+	// A local variable which may be read before it is assigned.
+	MaybeUninitialized = "maybe-uninitialized"
+	// A declaration which hides a variable of an enclosing scope.
+	Shadow = "shadow"
+	// An implicit conversion to a type which cannot represent every value of
+	// the converted type, such as from double to int.
+	Narrowing = "narrowing"
+	// An identifier which mixes the letters of different scripts, or which
+	// looks the same as another but differs in its letters, such as one with
+	// a Cyrillic "а" in place of a Latin "a".
+	Confusable = "confusable"
+	// Constant arithmetic on ints whose result overflows, which is undefined
+	// behavior, such as INT_MAX + 1.
+	Overflow = "overflow"
+)
+
+// Each warning, with whether it is enabled by default, and by "all".
+var warnings = []struct {
+	name         string
+	enabled, all bool
+}{
+	{UnreachableCode, true, true},
+	{UnusedVariable, false, true},
+	{UnusedParameter, false, false},
+	{MaybeUninitialized, false, true},
+	{Shadow, false, false},
+	{Narrowing, false, false},
+	{Confusable, true, true},
+	{Overflow, false, true},
+}
+
+// WarningNames returns the names of the warnings.
+func WarningNames() []string {
+	names := make([]string, len(warnings))
+	for i, w := range warnings {
+		names[i] = w.name
+	}
+	return names
+}
+
+// A WarningSet is the set of warnings which are enabled, by name.
+type WarningSet map[string]bool
+
+// DefaultWarnings returns the set of the warnings which are enabled by
+// default.
+func DefaultWarnings() WarningSet {
+	s := make(WarningSet)
+	for _, w := range warnings {
+		if w.enabled {
+			s[w.name] = true
+		}
+	}
+	return s
+}
+
+// String returns the names of the warnings in the set, separated by commas.
+func (s WarningSet) String() string {
+	var names []string
+	for _, w := range warnings {
+		if s[w.name] {
+			names = append(names, w.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Set enables or disables warnings by the value of a -W flag: the name of a
+// warning enables it, and the name following "no-" disables it. The name
+// "all" stands for the common warnings, which are most often mistakes.
+func (s WarningSet) Set(flag string) error {
+	name := strings.TrimPrefix(flag, "no-")
+	enable := name == flag
+	if name == "all" {
+		for _, w := range warnings {
+			if w.all {
+				s[w.name] = enable
+			}
+		}
+		return nil
+	}
+	for _, w := range warnings {
+		if w.name == name {
+			s[name] = enable
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown warning %q", name)
+}
+
+// Enabled returns whether a warning is enabled.
+func (s WarningSet) Enabled(name string) bool {
+	return s[name]
+}
@@ -0,0 +1,36 @@
+package diag
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWarningSet(t *testing.T) {
+	assert := assert.New(t)
+	s := DefaultWarnings()
+	assert.True(s.Enabled(UnreachableCode))
+	assert.False(s.Enabled(UnusedVariable))
+	assert.False(s.Enabled(Shadow))
+
+	assert.NoError(s.Set("all"))
+	assert.True(s.Enabled(UnusedVariable))
+	assert.False(s.Enabled(Shadow))
+	assert.NoError(s.Set("no-unused-variable"))
+	assert.False(s.Enabled(UnusedVariable))
+	assert.NoError(s.Set("shadow"))
+	assert.True(s.Enabled(Shadow))
+	assert.NoError(s.Set("no-all"))
+	assert.False(s.Enabled(UnreachableCode))
+	assert.True(s.Enabled(Shadow))
+	assert.Equal("shadow", s.String())
+
+	assert.EqualError(s.Set("unused"), `unknown warning "unused"`)
+	assert.EqualError(s.Set("no-unused"), `unknown warning "unused"`)
+}
+
+func TestWarningNames(t *testing.T) {
+	assert.Equal(t, []string{"unreachable-code", "unused-variable", "unused-parameter",
+		"maybe-uninitialized", "shadow", "narrowing",
+		"confusable", "overflow"},
+		WarningNames())
+}
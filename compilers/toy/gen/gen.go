@@ -0,0 +1,433 @@
+// Package gen generates random programs of the toy language, in the manner
+// of Csmith, for fuzzing the parser, differential testing of the interpreter
+// and the backends, and benchmarks.
+//
+// Every program is well typed, and well defined, so that each way of running
+// it must agree: a divisor is never zero or -1, a shift count is masked to
+// the bits of an int, an array is indexed within its bounds, a pointer
+// always points to a global, loops are bounded, functions only call those
+// declared before them, and integer arithmetic wraps in both the interpreter
+// and compiled code. Main prints the values of the globals before it returns,
+// so that a difference in any of them is seen.
+package gen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// A Feature of the language which generated programs may use. Programs
+// always use int globals, locals and parameters, assignments, and
+// arithmetic, bitwise, relational and logical operators.
+type Feature uint
+
+const (
+	Loops        Feature = 1 << iota // For and while loops.
+	Conditionals                     // If statements and conditional expressions.
+	Switches                         // Switch statements, with fallthrough.
+	Calls                            // Functions besides main, and calls to them.
+	Arrays                           // Global arrays of ints.
+	Pointers                         // Pointers to ints, and dereferences of them.
+	Chars                            // Global chars, which truncate the ints assigned to them.
+	Widths                           // Locals and parameters of other integer types, and casts.
+
+	AllFeatures = Loops | Conditionals | Switches | Calls | Arrays | Pointers | Chars | Widths
+)
+
+// An Option configures the programs which are generated.
+type Option func(*generator)
+
+// Depth returns an Option which limits the nesting of statements and of
+// expressions to a depth. The default is 3.
+func Depth(n int) Option {
+	return func(g *generator) {
+		g.maxDepth = n
+	}
+}
+
+// Features returns an Option which selects the features which programs may
+// use. The default is AllFeatures.
+func Features(f Feature) Option {
+	return func(g *generator) {
+		g.features = f
+	}
+}
+
+// Functions returns an Option which sets the number of functions besides
+// main, if programs may use Calls. The default is 2. A large number makes a
+// large program, as for a benchmark.
+func Functions(n int) Option {
+	return func(g *generator) {
+		g.functions = n
+	}
+}
+
+// Statements returns an Option which limits the number of statements of the
+// body of a function to n, and of a nested block to half as many. The
+// default is 6.
+func Statements(n int) Option {
+	return func(g *generator) {
+		g.statements = n
+	}
+}
+
+// The number of globals of each kind, the length of each array, and the
+// number of locals of other integer types in each function.
+const (
+	intGlobals  = 4
+	charGlobals = 2
+	arrays      = 2
+	arrayLength = 4
+	widthLocals = 2
+)
+
+// The integer types besides int which the Widths feature adds: wider,
+// narrower and unsigned ones. A value converted to one wraps to its range.
+var widths = []string{"long", "unsigned", "short", "unsigned long", "unsigned short", "signed char"}
+
+// The printf conversions of the values of the widths, which the narrower
+// ones are promoted to int to be printed with.
+var widthFormats = map[string]string{
+	"long":           "%ld",
+	"unsigned":       "%u",
+	"short":          "%d",
+	"unsigned long":  "%lu",
+	"unsigned short": "%d",
+	"signed char":    "%d",
+}
+
+type generator struct {
+	r          *rand.Rand
+	b          strings.Builder
+	maxDepth   int
+	features   Feature
+	functions  int
+	statements int
+
+	indent  int      // The indentation of the statement being written.
+	globals []string // The globals which main prints, in order.
+	// The variables which may be assigned, and the loop counters, which
+	// may only be read.
+	vars     []string
+	counters []string
+	// The number of functions which the function being written may call,
+	// and whether it has a pointer.
+	callable int
+	pointer  bool
+	locals   int // The number of locals declared, to name the next.
+	// The locals of other integer types, which main prints, and their printf
+	// conversions.
+	printLocals, printFormats []string
+}
+
+// Generate returns a random program, whose choices are made by r, so that
+// the same program is generated from the same seed.
+func Generate(r *rand.Rand, options ...Option) string {
+	g := &generator{
+		r:          r,
+		maxDepth:   3,
+		features:   AllFeatures,
+		functions:  2,
+		statements: 6,
+	}
+	for _, o := range options {
+		o(g)
+	}
+	if !g.has(Calls) {
+		g.functions = 0
+	}
+	g.line("int printf(char *format, ...);")
+	g.declareGlobals()
+	for i := 0; i < g.functions; i++ {
+		g.line("int f%d(%s a, %s b) {", i, g.width(), g.width())
+		g.callable = i
+		g.body(false, "a", "b")
+		g.line("}")
+	}
+	g.line("int main() {")
+	g.callable = g.functions
+	g.body(true)
+	g.line("}")
+	return g.b.String()
+}
+
+func (g *generator) has(f Feature) bool {
+	return g.features&f != 0
+}
+
+// declareGlobals writes the declarations of the globals.
+func (g *generator) declareGlobals() {
+	for i := 0; i < intGlobals; i++ {
+		g.line("int g%d = %s;", i, g.literal())
+		g.globals = append(g.globals, fmt.Sprintf("g%d", i))
+	}
+	if g.has(Chars) {
+		for i := 0; i < charGlobals; i++ {
+			g.line("char c%d = %d;", i, g.r.Intn(256)-128)
+			g.globals = append(g.globals, fmt.Sprintf("c%d", i))
+		}
+	}
+	if g.has(Arrays) {
+		for i := 0; i < arrays; i++ {
+			g.line("int a%d[%d];", i, arrayLength)
+			for j := 0; j < arrayLength; j++ {
+				g.globals = append(g.globals, fmt.Sprintf("a%d[%d]", i, j))
+			}
+		}
+	}
+}
+
+// body writes the body of a function with parameters, which ends by
+// returning, after printing the globals if it is main.
+func (g *generator) body(main bool, params ...string) {
+	g.indent++
+	g.vars = nil
+	for _, v := range g.globals {
+		if !strings.Contains(v, "[") {
+			g.vars = append(g.vars, v)
+		}
+	}
+	g.vars = append(g.vars, params...)
+	g.locals, g.pointer = 0, false
+	g.printLocals, g.printFormats = nil, nil
+	g.line("int x = %s;", g.expression(g.maxDepth))
+	g.vars = append(g.vars, "x")
+	if g.has(Widths) {
+		for i := 0; i < widthLocals; i++ {
+			v, t := g.local("v"), widths[g.r.Intn(len(widths))]
+			g.line("%s %s = %s;", t, v, g.expression(g.maxDepth))
+			g.vars = append(g.vars, v)
+			g.printLocals = append(g.printLocals, v)
+			g.printFormats = append(g.printFormats, widthFormats[t])
+		}
+	}
+	g.pointer = g.has(Pointers)
+	if g.pointer {
+		g.line("int *p = &%s;", g.intGlobal())
+	}
+	for n := 1 + g.r.Intn(g.statements); n > 0; n-- {
+		g.statement(g.maxDepth)
+	}
+	if main {
+		// Its locals of other integer types are printed too, as their values
+		// may differ beyond the bits of an int.
+		formats := append(strings.Fields(strings.Repeat("%d ", len(g.globals))), g.printFormats...)
+		values := append(append([]string(nil), g.globals...), g.printLocals...)
+		g.line(`printf("%s\n", %s);`, strings.Join(formats, " "), strings.Join(values, ", "))
+	}
+	g.line("return %s;", g.expression(g.maxDepth))
+	g.indent--
+}
+
+// line writes a line at the indentation of the current statement.
+func (g *generator) line(format string, args ...interface{}) {
+	g.b.WriteString(strings.Repeat("  ", g.indent))
+	fmt.Fprintf(&g.b, format, args...)
+	g.b.WriteString("\n")
+}
+
+// width returns the type of a parameter or cast: int, or with the Widths
+// feature, more often another integer type.
+func (g *generator) width() string {
+	if !g.has(Widths) || g.r.Intn(3) == 0 {
+		return "int"
+	}
+	return widths[g.r.Intn(len(widths))]
+}
+
+// intGlobal returns the name of an int global.
+func (g *generator) intGlobal() string {
+	return fmt.Sprintf("g%d", g.r.Intn(intGlobals))
+}
+
+// The kinds of statement.
+const (
+	assignStatement = iota
+	compoundStatement
+	arrayStatement
+	pointerStatement
+	ifStatement
+	forStatement
+	whileStatement
+	switchStatement
+)
+
+// statement writes a statement, which contains others only if depth is
+// positive.
+func (g *generator) statement(depth int) {
+	kinds := []int{assignStatement, compoundStatement}
+	if g.has(Arrays) {
+		kinds = append(kinds, arrayStatement)
+	}
+	if g.pointer {
+		kinds = append(kinds, pointerStatement)
+	}
+	if depth > 0 {
+		if g.has(Conditionals) {
+			kinds = append(kinds, ifStatement)
+		}
+		if g.has(Loops) {
+			kinds = append(kinds, forStatement, whileStatement)
+		}
+		if g.has(Switches) {
+			kinds = append(kinds, switchStatement)
+		}
+	}
+	switch kinds[g.r.Intn(len(kinds))] {
+	case assignStatement:
+		g.line("%s = %s;", g.variable(), g.expression(g.maxDepth))
+	case compoundStatement:
+		op := []string{"+=", "-=", "*=", "^=", "|=", "&="}[g.r.Intn(6)]
+		g.line("%s %s %s;", g.variable(), op, g.expression(g.maxDepth-1))
+	case arrayStatement:
+		g.line("%s = %s;", g.element(g.maxDepth-1), g.expression(g.maxDepth))
+	case pointerStatement:
+		if g.r.Intn(3) == 0 {
+			g.line("p = &%s;", g.intGlobal())
+		} else {
+			g.line("*p += %s;", g.expression(g.maxDepth-1))
+		}
+	case ifStatement:
+		g.line("if (%s) {", g.expression(g.maxDepth-1))
+		g.block(depth - 1)
+		g.line("} else {")
+		g.block(depth - 1)
+		g.line("}")
+	case forStatement:
+		i := g.local("i")
+		g.line("for (int %s = 0; %s < %d; %s++) {", i, i, 1+g.r.Intn(5), i)
+		g.counters = append(g.counters, i)
+		g.block(depth - 1)
+		g.counters = g.counters[:len(g.counters)-1]
+		g.line("}")
+	case whileStatement:
+		// The counter is incremented after the body, which has no continue.
+		w := g.local("w")
+		g.line("int %s = 0;", w)
+		g.line("while (%s < %d) {", w, 1+g.r.Intn(5))
+		g.counters = append(g.counters, w)
+		g.block(depth - 1)
+		g.indent++
+		g.line("%s++;", w)
+		g.indent--
+		g.counters = g.counters[:len(g.counters)-1]
+		g.line("}")
+	case switchStatement:
+		// The statements of each case are a block, which may declare locals.
+		g.line("switch (%s & 3) {", g.expression(g.maxDepth-1))
+		for c := 0; c < 3; c++ {
+			g.line("case %d: {", c)
+			g.block(depth - 1)
+			g.line("}")
+			if g.r.Intn(3) > 0 {
+				g.indent++
+				g.line("break;")
+				g.indent--
+			}
+		}
+		g.line("default: {")
+		g.block(depth - 1)
+		g.line("}")
+		g.line("}")
+	}
+}
+
+// block writes the statements of a block.
+func (g *generator) block(depth int) {
+	g.indent++
+	for n := 1 + g.r.Intn((g.statements+1)/2); n > 0; n-- {
+		g.statement(depth)
+	}
+	g.indent--
+}
+
+// local returns the name of a new local with a prefix.
+func (g *generator) local(prefix string) string {
+	g.locals++
+	return fmt.Sprintf("%s%d", prefix, g.locals)
+}
+
+// variable returns a variable which may be assigned.
+func (g *generator) variable() string {
+	return g.vars[g.r.Intn(len(g.vars))]
+}
+
+// element returns an element of an array, whose index is an expression
+// within its bounds.
+func (g *generator) element(depth int) string {
+	return fmt.Sprintf("a%d[%s & %d]", g.r.Intn(arrays), g.expression(depth), arrayLength-1)
+}
+
+// literal returns an int constant, which is more often small.
+func (g *generator) literal() string {
+	if g.r.Intn(4) == 0 {
+		return fmt.Sprint(g.r.Int31() - g.r.Int31())
+	}
+	return fmt.Sprint(g.r.Intn(20) - 5)
+}
+
+// The kinds of expression with operands.
+const (
+	unaryExpression = iota
+	binaryExpression
+	shiftExpression
+	divisionExpression
+	conditionalExpression
+	callExpression
+	castExpression
+)
+
+// expression returns an integer expression, whose operands are expressions only
+// if depth is positive.
+func (g *generator) expression(depth int) string {
+	if depth <= 0 || g.r.Intn(4) == 0 {
+		return g.operand(depth)
+	}
+	kinds := []int{unaryExpression, binaryExpression, binaryExpression, shiftExpression,
+		divisionExpression}
+	if g.has(Conditionals) {
+		kinds = append(kinds, conditionalExpression)
+	}
+	if g.callable > 0 {
+		kinds = append(kinds, callExpression)
+	}
+	if g.has(Widths) {
+		kinds = append(kinds, castExpression)
+	}
+	x, y := g.expression(depth-1), g.expression(depth-1)
+	switch kinds[g.r.Intn(len(kinds))] {
+	case unaryExpression:
+		return fmt.Sprintf("%s(%s)", []string{"-", "~", "!"}[g.r.Intn(3)], x)
+	case shiftExpression:
+		return fmt.Sprintf("(%s %s (%s & 31))", x, []string{"<<", ">>"}[g.r.Intn(2)], y)
+	case divisionExpression:
+		return fmt.Sprintf("(%s %s ((%s & 15) + 1))", x, []string{"/", "%"}[g.r.Intn(2)], y)
+	case conditionalExpression:
+		return fmt.Sprintf("(%s ? %s : %s)", x, y, g.expression(depth-1))
+	case callExpression:
+		return fmt.Sprintf("f%d(%s, %s)", g.r.Intn(g.callable), x, y)
+	case castExpression:
+		return fmt.Sprintf("((%s)%s)", g.width(), x)
+	}
+	ops := []string{"+", "-", "*", "&", "|", "^", "<", "<=", ">", ">=", "==", "!=", "&&", "||"}
+	return fmt.Sprintf("(%s %s %s)", x, ops[g.r.Intn(len(ops))], y)
+}
+
+// operand returns a constant, variable, loop counter, array element or
+// dereference.
+func (g *generator) operand(depth int) string {
+	switch n := g.r.Intn(8); {
+	case n < 3:
+		return g.literal()
+	case n == 3 && len(g.counters) > 0:
+		return g.counters[g.r.Intn(len(g.counters))]
+	case n == 4 && g.has(Arrays) && depth > 0:
+		return g.element(depth - 1)
+	case n == 5 && g.pointer:
+		return "*p"
+	case n == 6 && g.has(Chars):
+		return fmt.Sprintf("c%d", g.r.Intn(charGlobals))
+	}
+	return g.variable()
+}
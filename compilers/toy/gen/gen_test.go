@@ -0,0 +1,73 @@
+package gen
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// generate returns the program generated from a seed.
+func generate(seed int64, options ...Option) string {
+	return Generate(rand.New(rand.NewSource(seed)), options...)
+}
+
+// check parses and checks a program, failing the test if it has errors.
+func check(t *testing.T, input string) {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, input)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatalf("%v:\n%s", err, input)
+	}
+}
+
+func TestGenerateIsValid(t *testing.T) {
+	features := []Feature{AllFeatures, 0}
+	for f := Loops; f&AllFeatures != 0; f <<= 1 {
+		features = append(features, f)
+	}
+	for _, f := range features {
+		for seed := int64(1); seed <= 20; seed++ {
+			check(t, generate(seed, Features(f)))
+		}
+	}
+	check(t, generate(1, Depth(0), Statements(1)))
+	check(t, generate(1, Depth(6), Functions(5)))
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(generate(7), generate(7))
+	assert.NotEqual(generate(7), generate(8))
+}
+
+func TestFeatures(t *testing.T) {
+	assert := assert.New(t)
+	var all, none strings.Builder
+	for seed := int64(1); seed <= 20; seed++ {
+		all.WriteString(generate(seed))
+		none.WriteString(generate(seed, Features(0)))
+	}
+	for _, s := range []string{"for (", "while (", "if (", " ? ", "switch (", "f0(", "a0[", "*p", "char c0",
+		"long", "unsigned", "short"} {
+		assert.Contains(all.String(), s)
+		assert.NotContains(none.String(), s)
+	}
+	assert.Contains(none.String(), "printf(")
+}
+
+func TestFunctions(t *testing.T) {
+	assert := assert.New(t)
+	program := generate(1, Functions(50))
+	assert.Contains(program, "int f49(")
+	assert.True(len(generate(1)) < len(program))
+	// Without calls, there are no functions besides main.
+	assert.NotContains(generate(1, Functions(50), Features(Loops)), "int f0(")
+	// Without widths, the parameters are ints.
+	assert.Contains(generate(1, Functions(50), Features(Calls)), "int f49(int a, int b) {")
+}
@@ -0,0 +1,519 @@
+package interp
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/consteval"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"strconv"
+)
+
+// A value of an integer, a floating-point type, or a pointer type.
+type value struct {
+	typ types.Type
+	i   int64   // Wrapped to the range of typ, or the bits of an unsigned long.
+	f   float64 // Rounded to the precision of a float if typ is Float.
+	p   pointer
+}
+
+// An object in memory: the storage of a variable. An array holds the scalar
+// values of its elements in order, and a struct those of its fields, with
+// those of nested arrays and structs flattened.
+type object struct {
+	name     string // The name of the variable.
+	values   []value
+	dead     bool // Whether the lifetime of the object has ended.
+	readOnly bool // Whether the object is a string literal.
+}
+
+func newObject(name string, v value) *object {
+	return &object{name: name, values: []value{v}}
+}
+
+// newAggregate returns an object which holds an array or struct, each of
+// whose scalar values is zero.
+func newAggregate(name string, t types.Type) *object {
+	return &object{name: name, values: zeros(nil, t)}
+}
+
+// zeros appends the zero scalar values which an object of type t holds.
+func zeros(values []value, t types.Type) []value {
+	switch t := t.(type) {
+	case *types.Array:
+		for i := 0; i < int(t.Len); i++ {
+			values = zeros(values, t.Elem)
+		}
+		return values
+	case *types.Struct:
+		for _, f := range t.Fields {
+			values = zeros(values, f.Type)
+		}
+		return values
+	}
+	return append(values, zero(t))
+}
+
+// cells returns the number of scalar values which an object of type t holds.
+func cells(t types.Type) int {
+	switch t := t.(type) {
+	case *types.Array:
+		return int(t.Len) * cells(t.Elem)
+	case *types.Struct:
+		n := 0
+		for _, f := range t.Fields {
+			n += cells(f.Type)
+		}
+		return n
+	}
+	return 1
+}
+
+// fieldIndex returns the index of the first scalar value of a field of a
+// struct among those of the struct.
+func fieldIndex(s *types.Struct, name string) int {
+	n := 0
+	for _, f := range s.Fields {
+		if f.Name == name {
+			break
+		}
+		n += cells(f.Type)
+	}
+	return n
+}
+
+// A pointer to a value of an object, or past its end. The null pointer has no
+// object. The index counts scalar values, so a pointer to an array is offset
+// by the number of values that the array holds.
+type pointer struct {
+	obj   *object
+	index int
+}
+
+func (p pointer) String() string {
+	switch {
+	case p.obj == nil:
+		return "(nil)"
+	case p.index == 0:
+		return "&" + p.obj.name
+	}
+	return fmt.Sprintf("&%s%+d", p.obj.name, p.index)
+}
+
+func intValue(i int32) value {
+	return value{typ: types.Int, i: int64(i)}
+}
+
+func floatValue(f float64, t types.Type) value {
+	if t == types.Float {
+		f = float64(float32(f))
+	}
+	return value{typ: t, f: f}
+}
+
+func (v value) String() string {
+	switch v.typ {
+	case types.Float:
+		return strconv.FormatFloat(v.f, 'g', -1, 32)
+	case types.Double:
+		return strconv.FormatFloat(v.f, 'g', -1, 64)
+	}
+	if types.IsPointer(v.typ) {
+		return v.p.String()
+	}
+	if v.typ == types.UnsignedLong {
+		return strconv.FormatUint(uint64(v.i), 10)
+	}
+	return strconv.FormatInt(v.i, 10)
+}
+
+func boolean(b bool) value {
+	if b {
+		return intValue(1)
+	}
+	return intValue(0)
+}
+
+// zero returns the zero value of type t, which for a pointer is null.
+func zero(t types.Type) value {
+	if types.IsFloating(t) {
+		return floatValue(0, t)
+	}
+	return value{typ: t}
+}
+
+// isTrue returns whether a value is non-zero, or is a pointer which is not
+// null.
+func (v value) isTrue() bool {
+	switch {
+	case types.IsFloating(v.typ):
+		return v.f != 0
+	case types.IsPointer(v.typ):
+		return v.p.obj != nil
+	}
+	return v.i != 0
+}
+
+// convert returns a value converted to type t. A floating-point value is
+// converted to an integer as the x86-64 conversion instructions convert it,
+// which truncates it, and a conversion between integer types wraps it to the
+// range of t. Only a null pointer constant is converted to a pointer, and
+// only a null pointer to an integer.
+func convert(v value, t types.Type) value {
+	switch {
+	case types.IsPointer(t):
+		return value{typ: t, p: v.p}
+	case types.IsFloating(t) && types.IsFloating(v.typ):
+		return floatValue(v.f, t)
+	case types.IsFloating(t) && v.typ == types.UnsignedLong:
+		return floatValue(float64(uint64(v.i)), t)
+	case types.IsFloating(t):
+		return floatValue(float64(v.i), t)
+	case types.IsFloating(v.typ):
+		return value{typ: t, i: consteval.FloatToInt(v.f, t)}
+	}
+	return value{typ: t, i: consteval.Convert(v.i, t)}
+}
+
+// The operator applied by each compound assignment token.
+var compoundOps = map[token.TokenType]token.TokenType{
+	token.AdditionAssignmentToken:       token.AdditionToken,
+	token.SubtractionAssignmentToken:    token.NegationToken,
+	token.MultiplicationAssignmentToken: token.MultiplicationToken,
+	token.DivisionAssignmentToken:       token.DivisionToken,
+	token.ModuloAssignmentToken:         token.ModuloToken,
+	token.ShiftLeftAssignmentToken:      token.ShiftLeftToken,
+	token.ShiftRightAssignmentToken:     token.ShiftRightToken,
+	token.BitwiseAndAssignmentToken:     token.BitwiseAndToken,
+	token.BitwiseOrAssignmentToken:      token.BitwiseOrToken,
+	token.BitwiseXorAssignmentToken:     token.BitwiseXorToken,
+}
+
+// expression evaluates an expression and returns its value.
+func (in *interpreter) expression(e ast.Expression) value {
+	t := ast.TypeOf(e)
+	if t == nil {
+		errorf(e, "expression %v has no type", e)
+	}
+	switch n := e.(type) {
+	case *ast.IntLiteral:
+		return value{typ: t, i: consteval.Convert(n.Value, t)}
+	case *ast.Sizeof:
+		// The operand is not evaluated.
+		return intValue(int32(n.Value))
+	case *ast.FloatLiteral:
+		return floatValue(n.Value, t)
+	case *ast.Identifier:
+		if n.Symbol.Kind == ast.EnumeratorSymbol {
+			return intValue(int32(n.Symbol.Value))
+		}
+		return in.load(n, in.lvalue(n))
+	case *ast.Subscript, *ast.Member:
+		return in.load(n, in.lvalue(n))
+	case *ast.Assignment:
+		p := in.lvalue(n.Lhs)
+		return in.store(n, p, in.expression(n.Rhs))
+	case *ast.CompoundAssignment:
+		p := in.lvalue(n.Lhs)
+		op, ok := compoundOps[n.Operator.Type]
+		if !ok {
+			errorf(n, "unsupported assignment operator %v", n.Operator)
+		}
+		rhs := in.expression(n.Rhs)
+		// The operator is computed in the operand type, and the result
+		// converted back to the type of the variable.
+		lhs := convert(in.load(n, p), n.OperandType)
+		return in.store(n, p, convert(binary(n, op, lhs, rhs), n.Type))
+	case *ast.IncDecOp:
+		p := in.lvalue(n.Operand)
+		op := token.AdditionToken
+		if n.Operator.Type == token.DecrementToken {
+			op = token.NegationToken
+		}
+		old := in.load(n, p)
+		one := intValue(1)
+		if !types.IsPointer(old.typ) {
+			one = convert(one, old.typ)
+		}
+		// Like any arithmetic, that on a char is computed in int.
+		v := in.store(n, p, convert(binary(n, op, old, one), old.typ))
+		if n.Postfix {
+			return old
+		}
+		return v
+	case *ast.ConditionalExpression:
+		if in.condition(n.Cond) {
+			return in.expression(n.Then)
+		}
+		return in.expression(n.Else)
+	case *ast.Call:
+		// Arguments are evaluated from left to right.
+		args := make([]value, len(n.Args))
+		for i, a := range n.Args {
+			args[i] = in.expression(a)
+		}
+		if f, ok := in.functions[n.Function.Token.Value]; ok {
+			return in.call(f, args)
+		}
+		return in.builtin(n, args)
+	case *ast.Conversion:
+		if types.IsArray(ast.TypeOf(n.Operand)) {
+			// An array converts to a pointer to its first element.
+			return value{typ: t, p: in.lvalue(n.Operand)}
+		}
+		x := in.expression(n.Operand)
+		switch {
+		case types.IsPointer(t) && !types.IsPointer(x.typ) && x.i != 0:
+			errorf(n, "conversion of non-zero int %v to %v", x, t)
+		case types.IsPointer(x.typ) && !types.IsPointer(t) && x.p.obj != nil:
+			// There are no addresses, so only a null pointer is an integer.
+			errorf(n, "conversion of non-null pointer %v to %v", x, t)
+		}
+		return convert(x, t)
+	case *ast.UnaryOp:
+		switch n.Operator.Type {
+		case token.MultiplicationToken:
+			return in.load(n, in.lvalue(n))
+		case token.BitwiseAndToken:
+			return value{typ: t, p: in.lvalue(n.Operand)}
+		}
+		x := in.expression(n.Operand)
+		switch n.Operator.Type {
+		case token.NegationToken:
+			if types.IsFloating(x.typ) {
+				return floatValue(-x.f, x.typ)
+			}
+			return convert(value{typ: x.typ, i: -x.i}, t)
+		case token.BitwiseComplementToken:
+			return convert(value{typ: x.typ, i: ^x.i}, t)
+		case token.LogicalNegationToken:
+			return boolean(!x.isTrue())
+		}
+		errorf(n, "unsupported unary operator %v", n.Operator)
+	case *ast.BinaryOp:
+		// The right operand of a logical operator is only evaluated if the
+		// left operand does not decide the result.
+		switch n.Operator.Type {
+		case token.AndToken:
+			return boolean(in.condition(n.Lhs) && in.condition(n.Rhs))
+		case token.OrToken:
+			return boolean(in.condition(n.Lhs) || in.condition(n.Rhs))
+		}
+		x := in.expression(n.Lhs)
+		y := in.expression(n.Rhs)
+		return binary(n, n.Operator.Type, x, y)
+	}
+	errorf(e, "unsupported expression %v", e)
+	return value{}
+}
+
+// condition evaluates an expression and returns whether it is non-zero.
+func (in *interpreter) condition(e ast.Expression) bool {
+	return in.expression(e).isTrue()
+}
+
+// lvalue returns a pointer to the object that an lvalue designates.
+func (in *interpreter) lvalue(e ast.Expression) pointer {
+	switch n := e.(type) {
+	case *ast.Identifier:
+		o, ok := in.variables[n.Symbol]
+		if !ok {
+			o, ok = in.globals[n.Symbol]
+		}
+		if !ok {
+			// A program is interpreted alone, so an extern variable which it
+			// does not define is not defined at all.
+			if n.Symbol != nil {
+				if d, isDecl := n.Symbol.Decl.(*ast.VariableDeclaration); isDecl && !d.IsDefinition() {
+					errorf(n, "use of undefined variable '%s'", n.Token.Value)
+				}
+			}
+			errorf(n, "unresolved identifier '%s'", n.Token.Value)
+		}
+		return pointer{obj: o}
+	case *ast.StringLiteral:
+		return pointer{obj: in.stringLiteral(n.Value)}
+	case *ast.UnaryOp:
+		if n.Operator.Type == token.MultiplicationToken {
+			return in.expression(n.Operand).p
+		}
+	case *ast.Subscript:
+		// a[i] is *(a + i).
+		x, y := in.expression(n.Array), in.expression(n.Index)
+		return pointerBinary(n, token.AdditionToken, x, y).p
+	case *ast.Member:
+		var p pointer
+		if n.Operator.Type == token.ArrowToken {
+			p = in.expression(n.X).p
+		} else {
+			p = in.lvalue(n.X)
+		}
+		s := ast.TypeOf(n.X)
+		if ptr, ok := s.(*types.Pointer); ok {
+			s = ptr.Elem
+		}
+		p.index += fieldIndex(s.(*types.Struct), n.Name.Value)
+		return p
+	}
+	errorf(e, "cannot assign to %v", e)
+	return pointer{}
+}
+
+// element returns the value of type t in memory which a pointer points to,
+// stopping the program if there is none. Memory holds values rather than
+// bytes, so one cannot be accessed as a value of another type through a cast
+// pointer.
+func element(node ast.Node, p pointer, t types.Type) *value {
+	switch {
+	case p.obj == nil:
+		errorf(node, "null pointer dereference")
+	case p.obj.dead:
+		errorf(node, "use of '%s' after the end of its lifetime", p.obj.name)
+	case p.index < 0 || p.index >= len(p.obj.values):
+		errorf(node, "pointer %v out of bounds", p)
+	case p.obj.values[p.index].typ != t:
+		errorf(node, "access to %v of type %v as %v", p,
+			p.obj.values[p.index].typ, t)
+	}
+	return &p.obj.values[p.index]
+}
+
+// stringLiteral returns the object which holds the characters of a string
+// literal, followed by a NUL. Identical literals share an object, which is
+// read-only.
+func (in *interpreter) stringLiteral(s string) *object {
+	if o, ok := in.strings[s]; ok {
+		return o
+	}
+	o := &object{name: ast.Quote(s, '"'), readOnly: true}
+	for i := 0; i <= len(s); i++ {
+		c := byte(0)
+		if i < len(s) {
+			c = s[i]
+		}
+		o.values = append(o.values, convert(intValue(int32(c)), types.Char))
+	}
+	in.strings[s] = o
+	return o
+}
+
+// load returns the value which a pointer points to, which has the type of the
+// expression which loads it.
+func (in *interpreter) load(e ast.Expression, p pointer) value {
+	return *element(e, p, ast.TypeOf(e))
+}
+
+// store assigns a value to the object which a pointer points to, and
+// returns it.
+func (in *interpreter) store(node ast.Node, p pointer, v value) value {
+	e := element(node, p, v.typ)
+	if p.obj.readOnly {
+		errorf(node, "assignment to string literal %s", p.obj.name)
+	}
+	*e = v
+	return v
+}
+
+// binary applies a binary operator, other than a logical operator, to two
+// values of the same type, or to two integers for a shift. Integer
+// arithmetic wraps, and a division which would trap stops the program.
+// Division, right shift and comparison of unsigned integers are unsigned.
+func binary(node ast.Node, op token.TokenType, x, y value) value {
+	if types.IsPointer(x.typ) || types.IsPointer(y.typ) {
+		return pointerBinary(node, op, x, y)
+	}
+	if types.IsFloating(x.typ) {
+		return floatBinary(node, op, x, y)
+	}
+	evaluate := consteval.Binary
+	if types.IsUnsigned(x.typ) {
+		evaluate = consteval.BinaryUnsigned
+	}
+	v, err := evaluate(op, x.i, y.i, types.Width(x.typ))
+	switch err {
+	case consteval.ErrDivisionByZero:
+		errorf(node, "division by zero")
+	case consteval.ErrOverflow:
+		errorf(node, "integer overflow in division")
+	case consteval.ErrNotConstant:
+		errorf(node, "unsupported operator in %v", node)
+	}
+	switch op {
+	case token.EqualToken, token.NotEqualToken, token.LessThanToken,
+		token.LessThanOrEqualToken, token.GreaterThanToken, token.GreaterThanOrEqualToken:
+		return boolean(v != 0)
+	}
+	return value{typ: x.typ, i: consteval.Convert(v, x.typ)}
+}
+
+// floatBinary applies an arithmetic or comparison operator to two
+// floating-point values of the same type. A comparison with NaN is false,
+// except for !=.
+func floatBinary(node ast.Node, op token.TokenType, x, y value) value {
+	switch op {
+	case token.AdditionToken:
+		return floatValue(x.f+y.f, x.typ)
+	case token.NegationToken:
+		return floatValue(x.f-y.f, x.typ)
+	case token.MultiplicationToken:
+		return floatValue(x.f*y.f, x.typ)
+	case token.DivisionToken:
+		return floatValue(x.f/y.f, x.typ)
+	case token.EqualToken:
+		return boolean(x.f == y.f)
+	case token.NotEqualToken:
+		return boolean(x.f != y.f)
+	case token.LessThanToken:
+		return boolean(x.f < y.f)
+	case token.LessThanOrEqualToken:
+		return boolean(x.f <= y.f)
+	case token.GreaterThanToken:
+		return boolean(x.f > y.f)
+	case token.GreaterThanOrEqualToken:
+		return boolean(x.f >= y.f)
+	}
+	errorf(node, "unsupported operator in %v", node)
+	return value{}
+}
+
+// pointerBinary applies an additive or comparison operator to a pointer and
+// an integer, or to two pointers. Offsets and differences are in units of the
+// type pointed to. Pointers to different objects are only equal or unequal,
+// and the distance between them is undefined.
+func pointerBinary(node ast.Node, op token.TokenType, x, y value) value {
+	switch op {
+	case token.AdditionToken:
+		if !types.IsPointer(x.typ) {
+			x, y = y, x
+		}
+		x.p.index += int(y.i) * cells(x.typ.(*types.Pointer).Elem)
+		return x
+	case token.NegationToken:
+		if !types.IsPointer(y.typ) {
+			x.p.index -= int(y.i) * cells(x.typ.(*types.Pointer).Elem)
+			return x
+		}
+	case token.EqualToken:
+		return boolean(x.p == y.p)
+	case token.NotEqualToken:
+		return boolean(x.p != y.p)
+	}
+	if x.p.obj != y.p.obj {
+		errorf(node, "operands point to different objects")
+	}
+	switch op {
+	case token.NegationToken:
+		size := cells(x.typ.(*types.Pointer).Elem)
+		return intValue(int32((x.p.index - y.p.index) / size))
+	case token.LessThanToken:
+		return boolean(x.p.index < y.p.index)
+	case token.LessThanOrEqualToken:
+		return boolean(x.p.index <= y.p.index)
+	case token.GreaterThanToken:
+		return boolean(x.p.index > y.p.index)
+	case token.GreaterThanOrEqualToken:
+		return boolean(x.p.index >= y.p.index)
+	}
+	errorf(node, "unsupported operator in %v", node)
+	return value{}
+}
@@ -0,0 +1,261 @@
+package interp
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestEvalArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(-8, status(t, "int main() { return !~-(1 + 2 * 3) - 8; }"))
+	assert.Equal(7, status(t, `int main() {
+  int a = -7;
+  return (a / 2 == -3) + (a % 2 == -1) * 2 + (a >> 1 == -4) * 4;
+}`))
+	assert.Equal(12, status(t, `int main() {
+  int a = 1;
+  a += 2; a *= 10; a -= 5; a /= 5; a %= 4; a <<= 3; a |= 5; a ^= 1; a &= 12;
+  return a;
+}`))
+}
+
+func TestEvalWraparound(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(math.MinInt32, status(t, "int main() { int a = 2147483647; return a + 1; }"))
+	// Only the low bits of a shift count are used.
+	assert.Equal(2, status(t, "int main() { int a = 33; return 1 << a; }"))
+}
+
+func TestEvalDivisionErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, _, err := eval(t, "int main() { int a = 0; return 1 % a; }", "")
+	assert.EqualError(err, "1:32: division by zero")
+	_, _, err = eval(t, "int main() { int a = -2147483647 - 1; return a / -1; }", "")
+	assert.EqualError(err, "1:46: integer overflow in division")
+}
+
+func TestEvalIncDec(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(1, status(t, "int main() { int a = 1; return a++; }"))
+	assert.Equal(2, status(t, "int main() { int a = 1; return ++a; }"))
+	assert.Equal(3, status(t, "int main() { int a = 1; a++; ++a; return a; }"))
+	assert.Equal(1, status(t, "int main() { double a = 2.5; a--; return a == 1.5; }"))
+}
+
+func TestEvalLogicalOperators(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, err := eval(t, `int putchar(int c);
+int say(int c) { putchar(c); return c; }
+int main() {
+  int a = 0 && say(120);
+  a = a || say(121);
+  a = a && say(122) > 0;
+  return a + (say(33) == 33);
+}`, "")
+	assert.NoError(err)
+	assert.Equal("yz!", stdout)
+	assert.Equal(1, status(t, "int main() { return 0.5 && 3; }"))
+}
+
+func TestEvalFloatingPoint(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(126, status(t, `double g(double a, float b, int c, double d, double e,
+                      double f, double h, double i, double j, double k) {
+  return a + b + c + d + e + f + h + i + j * k;
+}
+int main() { return g(1, 2, 3, 4, 5, 6, 7, 8, 9, 10); }`))
+	// Arithmetic on floats is rounded to single precision.
+	assert.Equal(1, status(t, "int main() { float a = 16777216; a += 1; return a == 16777216; }"))
+	assert.Equal(0, status(t, "int main() { double a = 16777216; a += 1; return a == 16777216; }"))
+	// Conversions to int truncate towards zero.
+	assert.Equal(-2, status(t, "int main() { double a = -2.75; int b = a; return b; }"))
+}
+
+func TestEvalNaN(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(1, status(t, `int main() {
+  double nan = 0.0 / 0.0;
+  return (nan == nan) + (nan < 1) + (nan >= 1) + (nan != nan);
+}`))
+}
+
+func TestEvalPointers(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(11, status(t, `int set(int *p, int v) { *p = v; return *p; }
+int main() {
+  int a = 1;
+  int *p = &a;
+  *p += 3;
+  (*p)++;
+  int **pp = &p;
+  **pp = **pp + set(&a, 4);
+  return a + (*&p == p) + (p != 0) + !p;
+}`))
+	assert.Equal(3, status(t, `int main() {
+  int a;
+  int *p = &a;
+  int *q = p + 1;
+  return (q - p) + (p < q) + (q - 1 == p) - (p >= q);
+}`))
+}
+
+func TestEvalPointerErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, _, err := eval(t, "int main() { int *p = 0; return *p; }", "")
+	assert.EqualError(err, "1:33: null pointer dereference")
+	_, _, err = eval(t, "int main() { int a; int *p = &a; return *(p + 1); }", "")
+	assert.EqualError(err, "1:41: pointer &a+1 out of bounds")
+	_, _, err = eval(t, "int *f() { int a; return &a; } int main() { return *f(); }", "")
+	assert.EqualError(err, "1:52: use of 'a' after the end of its lifetime")
+	_, _, err = eval(t, "int main() { int a; int b; return &a < &b; }", "")
+	assert.EqualError(err, "1:35: operands point to different objects")
+	assert.Equal(0, status(t, "int main() { int a; int b; return &a == &b; }"))
+}
+
+func TestEvalArrays(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(21, status(t, `int sum(int *p, int n) { int s = 0; for (int i = 0; i < n; i++) s += p[i]; return s; }
+int main() {
+  int a[2][3];
+  for (int i = 0; i < 2; i++)
+    for (int j = 0; j < 3; j++)
+      a[i][j] = i * 3 + j + 1;
+  return sum(a[0], 6);
+}`))
+	assert.Equal(5, status(t, "int main() { int a[4]; int *p = a; 2[a] = 3; return (p + 4 - a) + p[2] - 2; }"))
+	_, _, err := eval(t, "int main() { int a[4]; return a[4]; }", "")
+	assert.EqualError(err, "1:31: pointer &a+4 out of bounds")
+}
+
+func TestEvalStructs(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(17, status(t, `struct point { int x; double y; };
+struct line { struct point a[2]; int n; };
+int len(struct line *l) { return l->a[1].x - l->a[0].x + l->n; }
+int main() {
+  struct line l;
+  l.a[0].x = 1;
+  l.a[1].x = 5;
+  l.a[1].y = 2.5;
+  l.n = 10;
+  struct point *p = &l.a[1];
+  return len(&l) + p->y + (l.a[0].y == 0);
+}`))
+	_, _, err := eval(t, "struct s { int x; }; int main() { struct s *p = 0; return p->x; }", "")
+	assert.EqualError(err, "1:59: null pointer dereference")
+}
+
+func TestEvalSizeof(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(44, status(t, `struct s { char c; double d; };
+int main() {
+  int a[5];
+  struct s *p = 0;
+  return sizeof a / sizeof a[0] + sizeof *p + sizeof(struct s *[2]) + sizeof "hi" + sizeof 'a';
+}`))
+	// The operand is not evaluated.
+	assert.Equal(1, status(t, "int main() { int a = 1; int *p = 0; return sizeof(a++ / 0 + *p) - 3 + a - 1; }"))
+}
+
+func TestEvalEnums(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(17, status(t, `enum color { RED, GREEN = 10, BLUE };
+int a[BLUE];
+enum color next(enum color c) { switch (c) { case RED: return GREEN; case GREEN: return BLUE; } return RED; }
+int main() {
+  enum color c = next(next(RED));
+  a[GREEN] = 6;
+  return c + a[10];
+}`))
+}
+
+func TestEvalCasts(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(50, status(t, `int main() {
+  int x = 300;
+  double d = -2.75;
+  int a[2];
+  char *p = (char *)(int *)0;
+  int *q = (int *)(char *)a;
+  q[1] = 3;
+  return (char)x + (int)-d + a[1] + (p == 0) + (int)(char *)0;
+}`))
+	// Memory holds values, so it has no addresses and cannot be accessed as
+	// another type.
+	_, _, err := eval(t, "int main() { int a; return (int)&a; }", "")
+	assert.EqualError(err, "1:28: conversion of non-null pointer &a to int")
+	_, _, err = eval(t, "int main() { int a = 1; char *p = (char *)&a; return *p; }", "")
+	assert.EqualError(err, "1:54: access to &a of type int as char")
+}
+
+func TestEvalChars(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(-56, status(t, "int main() { char c = 'd'; c += 100; return c; }"))
+	assert.Equal(-128, status(t, "int main() { char c = 127; c++; return c; }"))
+	// Arithmetic on chars is done in int.
+	assert.Equal(200, status(t, "int main() { char c = 100; return c + c; }"))
+}
+
+func TestEvalUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	// Division, right shift and comparison are unsigned.
+	assert.Equal(7, status(t, `int main() {
+  unsigned a = -7;
+  return (a / 2 == 2147483644) + (a % 2 == 1) * 2 + (a >> 1 == 2147483644u) * 4;
+}`))
+	assert.Equal(3, status(t, "int main() { unsigned a = 0; a--; return (a > 1) + (-1 > 1u) * 2; }"))
+	assert.Equal(5, status(t, "int main() { int a[8]; unsigned i = 2; a[i + 3] = 5; return a[5]; }"))
+	_, _, err := eval(t, "int main() { unsigned a = 0; return 1u / a; }", "")
+	assert.EqualError(err, "1:37: division by zero")
+}
+
+func TestEvalIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	// Stores truncate to the width of the type, and loads extend with the
+	// sign of the type.
+	assert.Equal(7, status(t, `int main() {
+  short s = 65535;
+  unsigned short u = -1;
+  unsigned char c = 300;
+  return (s == -1) + (u == 65535) * 2 + (c == 44) * 4;
+}`))
+	assert.Equal(7, status(t, `int main() {
+  long a = 2147483647;
+  unsigned long b = -1;
+  a = a + 1;
+  return (a == 2147483648) + (b / 2 == 9223372036854775807) * 2 + ((int)(a * 4) == 0) * 4;
+}`))
+	assert.Equal(6, status(t, "int main() { int a[8]; long i = 2; a[i * 3] = 6; return a[6]; }"))
+}
+
+func TestEvalStrings(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(7, status(t, `int len(char *s) { int n = 0; while (*s++) n++; return n; }
+int main() { return len("hello") + ("hi"[1] == 'i') + !"ab"[2]; }`))
+	_, _, err := eval(t, `int main() { char *s = "ab"; s[0] = 'x'; return 0; }`, "")
+	assert.EqualError(err, `1:30: assignment to string literal "ab"`)
+	_, _, err = eval(t, `int main() { return "ab"[3]; }`, "")
+	assert.EqualError(err, `1:21: pointer &"ab"+3 out of bounds`)
+}
+
+func TestConvert(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(intValue(3), convert(floatValue(3.9, types.Double), types.Int))
+	assert.Equal(floatValue(2, types.Float), convert(intValue(2), types.Float))
+	assert.Equal(float64(float32(0.1)), convert(floatValue(0.1, types.Double), types.Float).f)
+	// Values out of range of an int become the minimum int.
+	assert.Equal(intValue(math.MinInt32), convert(floatValue(1e10, types.Double), types.Int))
+	assert.Equal(intValue(math.MinInt32), convert(floatValue(math.NaN(), types.Double), types.Int))
+	assert.Equal(value{typ: types.NewPointer(types.Int)},
+		convert(intValue(0), types.NewPointer(types.Int)))
+	// Conversions to unsigned ints wrap, and those of floating-point values
+	// are truncated through a long.
+	assert.Equal(value{typ: types.UnsignedInt, i: 4294967295}, convert(intValue(-1), types.UnsignedInt))
+	assert.Equal(floatValue(4294967295, types.Double),
+		convert(value{typ: types.UnsignedInt, i: 4294967295}, types.Double))
+	assert.Equal(value{typ: types.UnsignedInt, i: 4294967294},
+		convert(floatValue(-2.5, types.Double), types.UnsignedInt))
+	assert.Equal(value{typ: types.UnsignedInt}, convert(floatValue(1e20, types.Double), types.UnsignedInt))
+}
@@ -0,0 +1,230 @@
+// Package interp executes programs by walking their abstract syntax tree,
+// without compiling them. Its results match those of the compiled program, so
+// that it may be used to test the code generators.
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+)
+
+// The maximum depth of nested calls, beyond which the program is stopped
+// rather than exhausting the stack of the interpreter.
+const maxCallDepth = 10000
+
+// A run-time error, such as a division by zero, which stops the program.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
+type interpreter struct {
+	functions map[string]*ast.Function // The definition of each function.
+	globals   map[*ast.Symbol]*object  // The global variables.
+	variables map[*ast.Symbol]*object  // The variables of the current call.
+	strings   map[string]*object       // The object of each string literal.
+	depth     int
+	stdin     *bufio.Reader
+	stdout    *bufio.Writer
+}
+
+// An Interpreter runs the input of an interactive session one function
+// definition or statement at a time, keeping the functions and variables
+// which earlier input defined. The variables declared by statements are
+// globals, which the functions may use. Its input must have been checked by
+// a sema.Session.
+type Interpreter struct {
+	in *interpreter
+}
+
+// New returns an interpreter whose programs read from stdin and write to
+// stdout.
+func New(stdin io.Reader, stdout io.Writer) *Interpreter {
+	return &Interpreter{
+		in: &interpreter{
+			functions: make(map[string]*ast.Function),
+			globals:   make(map[*ast.Symbol]*object),
+			strings:   make(map[string]*object),
+			stdin:     bufio.NewReader(stdin),
+			stdout:    bufio.NewWriter(stdout),
+		},
+	}
+}
+
+// Define adds a function to those which may be called. A prototype has no
+// effect.
+func (i *Interpreter) Define(f *ast.Function) {
+	if !f.Prototype {
+		i.in.functions[f.Name.Value] = f
+	}
+}
+
+// Exec executes a statement.
+func (i *Interpreter) Exec(s ast.Statement) error {
+	return i.run(func() {
+		i.in.statement(s)
+	})
+}
+
+// Evaluate evaluates an expression, and returns its value formatted as a
+// decimal number.
+func (i *Interpreter) Evaluate(e ast.Expression) (string, error) {
+	var v value
+	err := i.run(func() {
+		v = i.in.expression(e)
+	})
+	return v.String(), err
+}
+
+// run calls f, and returns the error which stopped it, if any, once the output
+// written has been flushed.
+func (i *Interpreter) run(f func()) (err error) {
+	i.in.variables = i.in.globals
+	defer func() {
+		if e := i.in.stdout.Flush(); err == nil {
+			err = e
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	f()
+	return nil
+}
+
+// Eval runs the main function of a program, which must have been checked by
+// semantic analysis, and returns the value that it returns. The functions
+// putchar, getchar, puts and printf, if called but not defined, read from
+// stdin and write to stdout.
+func Eval(program *ast.Program, stdin io.Reader, stdout io.Writer) (int, error) {
+	i := New(stdin, stdout)
+	for _, g := range program.Globals {
+		if g.IsDefinition() {
+			i.in.globals[g.Symbol] = newGlobal(g)
+		}
+	}
+	for _, f := range program.Functions {
+		i.Define(f)
+	}
+	main, ok := i.in.functions["main"]
+	if !ok {
+		return 0, &Error{Pos: program.Pos(), Msg: "no main function"}
+	}
+	var status int
+	err := i.run(func() {
+		status = int(i.in.call(main, nil).i)
+	})
+	return status, err
+}
+
+// newGlobal returns the object of a global variable, which holds the value of
+// its initializer computed by semantic analysis, or zero.
+func newGlobal(d *ast.VariableDeclaration) *object {
+	t := d.Symbol.Type
+	switch {
+	case types.IsArray(t) || types.IsStruct(t):
+		return newAggregate(d.Name.Value, t)
+	case types.IsFloating(t):
+		return newObject(d.Name.Value, floatValue(d.Constant, t))
+	case types.IsPointer(t):
+		return newObject(d.Name.Value, zero(t))
+	}
+	return newObject(d.Name.Value, value{typ: t, i: d.IntConstant})
+}
+
+// errorf stops the program with an error at the position of a node.
+func errorf(node ast.Node, format string, args ...interface{}) {
+	panic(&Error{Pos: node.Pos(), Msg: fmt.Sprintf(format, args...)})
+}
+
+// call runs a function with the values of its arguments, which have been
+// converted to the types of its parameters, and returns its result.
+func (in *interpreter) call(f *ast.Function, args []value) value {
+	if in.depth == maxCallDepth {
+		errorf(f, "stack overflow in call of '%s'", f.Name.Value)
+	}
+	in.depth++
+	caller := in.variables
+	in.variables = make(map[*ast.Symbol]*object)
+	defer func() {
+		// Pointers to the variables of the call no longer point to objects.
+		for _, o := range in.variables {
+			o.dead = true
+		}
+		in.variables = caller
+		in.depth--
+	}()
+	for i, p := range f.Params {
+		if p.Symbol == nil {
+			errorf(p, "unresolved parameter '%s'", p.Name.Value)
+		}
+		in.variables[p.Symbol] = newObject(p.Name.Value, args[i])
+	}
+	result := f.Symbol.Type.(*types.Function).Result
+	// A goto may jump to a label in any statement of the body.
+	c := in.block(f.Body, nil)
+	for c.kind == jumped {
+		c = in.block(f.Body, c.label)
+	}
+	if c.kind == returned {
+		return c.value
+	}
+	// Falling off the end of a function returns zero.
+	return zero(result)
+}
+
+// builtin runs a call of a function which is not defined by the program.
+func (in *interpreter) builtin(c *ast.Call, args []value) value {
+	switch c.Function.Token.Value {
+	case "putchar":
+		if len(args) == 1 && args[0].typ == types.Int {
+			// Like the C library, write and return the value as an unsigned
+			// char, or return EOF if it cannot be written.
+			b := byte(args[0].i)
+			if in.stdout.WriteByte(b) != nil {
+				return intValue(-1)
+			}
+			return intValue(int32(b))
+		}
+	case "getchar":
+		if len(args) == 0 {
+			// Any prompt written by the program is shown before the read.
+			in.stdout.Flush()
+			b, err := in.stdin.ReadByte()
+			if err != nil {
+				return intValue(-1)
+			}
+			return intValue(int32(b))
+		}
+	case "puts":
+		if len(args) == 1 && args[0].typ == types.NewPointer(types.Char) {
+			// Write the string and a newline, and return a non-negative
+			// value, or EOF if it cannot be written.
+			in.stdout.WriteString(cString(c.Args[0], args[0].p))
+			if in.stdout.WriteByte('\n') != nil {
+				return intValue(-1)
+			}
+			return intValue(1)
+		}
+	case "printf":
+		if len(args) > 0 && args[0].typ == types.NewPointer(types.Char) {
+			return intValue(int32(in.printf(c, args)))
+		}
+	}
+	errorf(c, "call of undefined function '%s'", c.Function.Token.Value)
+	return value{}
+}
@@ -0,0 +1,229 @@
+package interp
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// eval checks and runs a program with the given input, and returns its status
+// and output.
+func eval(t *testing.T, input, stdin string) (int, string, error) {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	status, err := Eval(program, strings.NewReader(stdin), &stdout)
+	return status, stdout.String(), err
+}
+
+// status runs a program which is expected to succeed, and returns its status.
+func status(t *testing.T, input string) int {
+	status, _, err := eval(t, input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestEvalReturn(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(42, status(t, "int main() { return 42; }"))
+	assert.Equal(-1, status(t, "int main() { return -1; }"))
+	// Falling off the end of a function returns zero.
+	assert.Equal(0, status(t, "int main() { int a = 1; }"))
+}
+
+func TestEvalNoMain(t *testing.T) {
+	assert := assert.New(t)
+	_, _, err := eval(t, "int f() { return 1; }", "")
+	assert.EqualError(err, "1:1: no main function")
+}
+
+func TestEvalCall(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(120, status(t, `int fact(int n) { return n <= 1 ? 1 : n * fact(n - 1); }
+int main() { return fact(5); }`))
+	// Arguments are converted to the types of the parameters.
+	assert.Equal(7, status(t, `int f(float x, int y) { return x * 2 + y; }
+int main() { return f(2.5, 2.9); }`))
+	// Each call has its own variables.
+	assert.Equal(21, status(t, `int f(int n) { int a = n; if (n > 0) f(n - 1); return a; }
+int main() { return f(1) + f(20); }`))
+}
+
+func TestEvalPrototype(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(3, status(t, `int f(int a);
+int main() { return f(2); }
+int f(int a) { return a + 1; }`))
+}
+
+func TestEvalPutchar(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, err := eval(t, `int putchar(int c);
+int main() { putchar(104); putchar(105); return putchar(266); }`, "")
+	assert.NoError(err)
+	assert.Equal("hi\n", stdout)
+	// The value written is returned as an unsigned char.
+	assert.Equal(10, status)
+}
+
+func TestEvalGetchar(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, err := eval(t, `int getchar(); int putchar(int c);
+int main() {
+  int n = 0;
+  for (int c = getchar(); c != -1; c = getchar()) {
+    putchar(c - 32);
+    n++;
+  }
+  return n;
+}`, "abc")
+	assert.NoError(err)
+	assert.Equal("ABC", stdout)
+	assert.Equal(3, status)
+}
+
+func TestEvalUndefinedFunction(t *testing.T) {
+	assert := assert.New(t)
+	_, _, err := eval(t, "int f(int a); int main() { return f(1); }", "")
+	assert.EqualError(err, "1:35: call of undefined function 'f'")
+}
+
+func TestEvalGlobals(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(20, status(t, `int n = 2 * 3;
+double d = -1.5;
+int a[3];
+int *p;
+int count() { return ++n; }
+int main() {
+  count();
+  a[1] = count();
+  p = &a[1];
+  return n + *p + (d == -1.5) + !p + a[0] + a[2] + 3;
+}`))
+}
+
+func TestEvalExternGlobals(t *testing.T) {
+	assert := assert.New(t)
+	// A variable declared before its definition is the same variable.
+	assert.Equal(7, status(t, `extern int n;
+static int twice(int x);
+int main() { n += 2; return n; }
+int n = 5;
+extern int n;
+static int twice(int x) { return 2 * x; }`))
+	_, _, err := eval(t, "extern int n; int main() { return n; }", "")
+	assert.EqualError(err, "1:35: use of undefined variable 'n'")
+}
+
+func TestEvalStackOverflow(t *testing.T) {
+	assert := assert.New(t)
+	_, _, err := eval(t, "int f(int a) { return f(a) + 1; } int main() { return f(1); }", "")
+	assert.EqualError(err, "1:1: stack overflow in call of 'f'")
+}
+
+func TestEvalOutputBeforeError(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, err := eval(t, `int putchar(int c);
+int main() { int a = 0; putchar(33); return 1 / a; }`, "")
+	assert.EqualError(err, "2:45: division by zero")
+	assert.Equal("!", stdout)
+}
+
+func TestInterpreter(t *testing.T) {
+	assert := assert.New(t)
+	var stdout bytes.Buffer
+	s := sema.NewSession()
+	i := New(strings.NewReader(""), &stdout)
+	// run checks and runs a line of input, and returns the value of its final
+	// expression, if it has one.
+	run := func(input string) ([]string, error) {
+		nodes, err := parser.ParseInput(lexer.NewLexerTokenStream(lexer.Lex(input)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var values []string
+		for _, n := range nodes {
+			switch n := n.(type) {
+			case *ast.Function:
+				if err := s.CheckFunction(n); err != nil {
+					t.Fatal(err)
+				}
+				i.Define(n)
+			case ast.Expression:
+				if err := s.CheckExpression(n); err != nil {
+					t.Fatal(err)
+				}
+				v, err := i.Evaluate(n)
+				if err != nil {
+					return values, err
+				}
+				values = append(values, v)
+			case ast.Statement:
+				if err := s.CheckStatement(n); err != nil {
+					t.Fatal(err)
+				}
+				if err := i.Exec(n); err != nil {
+					return values, err
+				}
+			}
+		}
+		return values, nil
+	}
+
+	values, err := run("int a = 2; a * 3")
+	assert.NoError(err)
+	assert.Equal([]string{"6"}, values)
+	values, err = run("for (int i = 0; i < 3; i++) a += i; a")
+	assert.NoError(err)
+	assert.Equal([]string{"5"}, values)
+	values, err = run("int sq(int x) { return x * x; } sq(a)")
+	assert.NoError(err)
+	assert.Equal([]string{"25"}, values)
+	// Functions use the variables declared by statements.
+	values, err = run("int plus(int x) { return x + a; } a = 1; plus(2)")
+	assert.NoError(err)
+	assert.Equal([]string{"3"}, values)
+	values, err = run("a = 5; a")
+	assert.NoError(err)
+	assert.Equal([]string{"5"}, values)
+	values, err = run("double b = a; b / 2")
+	assert.NoError(err)
+	assert.Equal([]string{"2.5"}, values)
+	values, err = run("float c = 0.1; c")
+	assert.NoError(err)
+	assert.Equal([]string{"0.1"}, values)
+	// Output is written by the time each statement returns.
+	values, err = run("int putchar(int c); putchar(104);")
+	assert.NoError(err)
+	assert.Empty(values)
+	assert.Equal("h", stdout.String())
+	// Variables keep the values assigned before an error.
+	_, err = run("a = 0; 1 / a")
+	assert.EqualError(err, "1:8: division by zero")
+	values, err = run("a")
+	assert.NoError(err)
+	assert.Equal([]string{"0"}, values)
+	// Pointers are shown as the variable they point to.
+	values, err = run("int *p = &a; p")
+	assert.NoError(err)
+	assert.Equal([]string{"&a"}, values)
+	values, err = run("p + 2")
+	assert.NoError(err)
+	assert.Equal([]string{"&a+2"}, values)
+	values, err = run("p = 0; p")
+	assert.NoError(err)
+	assert.Equal([]string{"(nil)"}, values)
+}
@@ -0,0 +1,112 @@
+package interp
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"strings"
+)
+
+// cString returns the characters which a pointer points to, up to the first
+// NUL.
+func cString(node ast.Node, p pointer) string {
+	var b strings.Builder
+	for ; ; p.index++ {
+		c := element(node, p, types.Char).i
+		if c == 0 {
+			return b.String()
+		}
+		b.WriteByte(byte(c))
+	}
+}
+
+// printf writes the format string which is the first argument of a call of
+// printf, with each conversion specification replaced by the next of the
+// other arguments, and returns the number of bytes written. A specification
+// may have flags, a width, a precision and an "l" length modifier, which
+// makes an integer conversion one of a long and has no effect on a
+// floating-point one, and one of the conversions d, i, u, o, x, X, c, s, f,
+// e, g or %.
+func (in *interpreter) printf(c *ast.Call, args []value) int {
+	format := cString(c.Args[0], args[0].p)
+	var b strings.Builder
+	next := 1
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		// The flags, width and precision are written as they are in Go.
+		j := i + 1
+		for j < len(format) && strings.IndexByte("-+ #0123456789.", format[j]) >= 0 {
+			j++
+		}
+		spec := format[i:j]
+		long := j < len(format) && format[j] == 'l'
+		if long {
+			j++
+		}
+		if j == len(format) {
+			errorf(c, "incomplete conversion specification in format %q", format)
+		}
+		verb := format[j]
+		i = j
+		if verb == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		if next == len(args) {
+			errorf(c, "too few arguments for format %q", format)
+		}
+		arg, node := args[next], c.Args[next]
+		next++
+		if long && (verb == 'c' || verb == 's') {
+			errorf(c, "unsupported conversion '%%l%c' in format %q", verb, format)
+		}
+		var want types.Type = types.Int
+		signed, unsigned := int64(int32(arg.i)), uint64(uint32(arg.i))
+		if long {
+			want, signed, unsigned = types.Long, arg.i, uint64(arg.i)
+		}
+		switch verb {
+		case 'd', 'i':
+			fmt.Fprintf(&b, spec+"d", signed)
+		case 'u':
+			fmt.Fprintf(&b, spec+"d", unsigned)
+		case 'o', 'x', 'X':
+			fmt.Fprintf(&b, spec+string(verb), unsigned)
+		case 'c':
+			// The int is written as an unsigned char, like putchar.
+			fmt.Fprintf(&b, spec+"s", []byte{byte(arg.i)})
+		case 's':
+			want = types.NewPointer(types.Char)
+			if arg.typ == want {
+				fmt.Fprintf(&b, spec+"s", cString(node, arg.p))
+			}
+		case 'f', 'e', 'g':
+			want = types.Double
+			// Like C, print six significant digits by default.
+			if verb == 'g' && !strings.Contains(spec, ".") {
+				spec += ".6"
+			}
+			fmt.Fprintf(&b, spec+string(verb), arg.f)
+		default:
+			errorf(c, "unsupported conversion '%%%c' in format %q", verb, format)
+		}
+		if (want == types.Int || want == types.Long) && types.IsUnsigned(arg.typ) &&
+			types.Width(arg.typ) == types.Width(want) {
+			// An unsigned int or long may be printed by any conversion of an
+			// int or long.
+			want = arg.typ
+		}
+		if arg.typ != want {
+			if long {
+				spec += "l"
+			}
+			errorf(node, "format '%s%c' expects an argument of type %v, but it has type %v",
+				spec, verb, want, arg.typ)
+		}
+	}
+	n, _ := in.stdout.WriteString(b.String())
+	return n
+}
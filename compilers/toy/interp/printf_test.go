@@ -0,0 +1,61 @@
+package interp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvalPuts(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, err := eval(t, `int puts(char *s);
+int main() { char s[3]; s[0] = 'o'; s[1] = 'k'; s[2] = 0; puts("hello"); return puts(s); }`, "")
+	assert.NoError(err)
+	assert.Equal("hello\nok\n", stdout)
+	assert.Equal(1, status)
+}
+
+func TestEvalPrintf(t *testing.T) {
+	assert := assert.New(t)
+	status, stdout, err := eval(t, `int printf(char *format, ...);
+int main() {
+  char c = 'x';
+  return printf("%s %d%% %c|%5d|%-3x|%05.1f|%e|%g|%u\n", "hi", 42, c, -7, 255, 3.14159, 0.5, 1.0 / 3, -1);
+}`, "")
+	assert.NoError(err)
+	want := "hi 42% x|   -7|ff |003.1|5.000000e-01|0.333333|4294967295\n"
+	assert.Equal(want, stdout)
+	assert.Equal(len(want), status)
+}
+
+func TestEvalPrintfUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, err := eval(t, `int printf(char *format, ...);
+int main() { unsigned a = -2; return printf("%u %x %d", a, a, a); }`, "")
+	assert.NoError(err)
+	assert.Equal("4294967294 fffffffe -2", stdout)
+}
+
+func TestEvalPrintfLong(t *testing.T) {
+	assert := assert.New(t)
+	_, stdout, err := eval(t, `int printf(char *format, ...);
+int main() { long a = -4294967296; return printf("%ld %lu %lx %d", a, -1UL, 1L << 40, (short)a); }`, "")
+	assert.NoError(err)
+	assert.Equal("-4294967296 18446744073709551615 10000000000 0", stdout)
+	_, _, err = eval(t, `int printf(char *format, ...);
+int main() { return printf("%d", 1L); }`, "")
+	assert.EqualError(err, "2:34: format '%d' expects an argument of type int, but it has type long")
+}
+
+func TestEvalPrintfErrors(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct{ call, err string }{
+		{`printf("%d %d", 1)`, `2:14: too few arguments for format "%d %d"`},
+		{`printf("%5.2f", 1)`, "2:30: format '%5.2f' expects an argument of type double, but it has type int"},
+		{`printf("%s", 1.5)`, "2:27: format '%s' expects an argument of type char *, but it has type double"},
+		{`printf("%n", 0)`, `2:14: unsupported conversion '%n' in format "%n"`},
+		{`printf("%-")`, `2:14: incomplete conversion specification in format "%-"`},
+	} {
+		_, _, err := eval(t, "int printf(char *format, ...);\nint main() { "+test.call+"; return 0; }", "")
+		assert.EqualError(err, test.err, "%s", test.call)
+	}
+}
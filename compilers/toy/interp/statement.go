@@ -0,0 +1,217 @@
+package interp
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// How control leaves a statement.
+type controlKind int
+
+const (
+	normal    controlKind = iota // Control reaches the next statement.
+	broke                        // A break statement was executed.
+	continued                    // A continue statement was executed.
+	returned                     // A return statement was executed.
+	jumped                       // A goto statement was executed.
+)
+
+// The outcome of executing a statement.
+type control struct {
+	kind  controlKind
+	value value                 // The returned value.
+	label *ast.LabeledStatement // The statement jumped to.
+}
+
+// statement executes a statement from its start.
+func (in *interpreter) statement(s ast.Statement) control {
+	return in.enter(s, nil)
+}
+
+// enter executes a statement from its start or, if c is not nil, from the case
+// label or labelled statement c within it, which a switch or goto has jumped
+// to. A goto within the statement to a label within it enters it again, from
+// that label.
+func (in *interpreter) enter(s ast.Statement, c ast.Statement) control {
+	ctl := in.execute(s, c)
+	for ctl.kind == jumped && contains(s, ctl.label) {
+		ctl = in.execute(s, ctl.label)
+	}
+	return ctl
+}
+
+// execute executes a statement like enter, returning on a goto.
+func (in *interpreter) execute(s ast.Statement, c ast.Statement) control {
+	switch n := s.(type) {
+	case *ast.ReturnStatement:
+		return control{kind: returned, value: in.expression(n.Value)}
+	case *ast.ExpressionStatement:
+		in.expression(n.Expression)
+	case *ast.VariableDeclaration:
+		in.declare(n, true)
+	case *ast.Block:
+		return in.block(n.Statements, c)
+	case *ast.IfStatement:
+		switch {
+		case c != nil && contains(n.Then, c):
+			return in.enter(n.Then, c)
+		case c != nil:
+			return in.enter(n.Else, c)
+		case in.condition(n.Cond):
+			return in.statement(n.Then)
+		case n.Else != nil:
+			return in.statement(n.Else)
+		}
+	case *ast.WhileStatement:
+		return in.loop(n.Cond, nil, n.Body, c == nil, c)
+	case *ast.DoWhileStatement:
+		return in.loop(n.Cond, nil, n.Body, false, c)
+	case *ast.ForStatement:
+		if d, ok := n.Init.(*ast.VariableDeclaration); ok && c != nil && in.variables[d.Symbol] == nil {
+			in.declare(d, false)
+		} else if n.Init != nil && c == nil {
+			in.statement(n.Init)
+		}
+		return in.loop(n.Cond, n.Post, n.Body, c == nil, c)
+	case *ast.SwitchStatement:
+		return in.switchStatement(n, c)
+	case *ast.CaseStatement:
+		if c == n {
+			c = nil
+		}
+		return in.enter(n.Body, c)
+	case *ast.LabeledStatement:
+		if c == n {
+			c = nil
+		}
+		return in.enter(n.Body, c)
+	case *ast.GotoStatement:
+		if n.Target == nil {
+			errorf(n, "unresolved label '%s'", n.Label.Value)
+		}
+		return control{kind: jumped, label: n.Target}
+	case *ast.BreakStatement:
+		return control{kind: broke}
+	case *ast.ContinueStatement:
+		return control{kind: continued}
+	default:
+		errorf(s, "unsupported statement %v", s)
+	}
+	return control{}
+}
+
+// declare creates a local variable, which is initialized if initialize is
+// true. An uninitialized variable has an unspecified value, which is zero.
+func (in *interpreter) declare(d *ast.VariableDeclaration, initialize bool) {
+	if d.Symbol == nil {
+		errorf(d, "unresolved declaration of '%s'", d.Name.Value)
+	}
+	if types.IsArray(d.Symbol.Type) || types.IsStruct(d.Symbol.Type) {
+		in.variables[d.Symbol] = newAggregate(d.Name.Value, d.Symbol.Type)
+		return
+	}
+	v := zero(d.Symbol.Type)
+	if initialize && d.Init != nil {
+		v = in.expression(d.Init)
+	}
+	in.variables[d.Symbol] = newObject(d.Name.Value, v)
+}
+
+// block executes a list of statements, from the one containing the label c
+// if it is not nil. A variable whose declaration is jumped over exists, but
+// is not initialized.
+func (in *interpreter) block(statements []ast.Statement, c ast.Statement) control {
+	for _, s := range statements {
+		if c != nil && !contains(s, c) {
+			if d, ok := s.(*ast.VariableDeclaration); ok && in.variables[d.Symbol] == nil {
+				in.declare(d, false)
+			}
+			continue
+		}
+		if ctl := in.enter(s, c); ctl.kind != normal {
+			return ctl
+		}
+		c = nil
+	}
+	return control{}
+}
+
+// loop executes a loop which tests its condition, if it has one, before each
+// iteration but the first if test is false, and evaluates post after each.
+// If c is not nil, the first iteration starts from that label.
+func (in *interpreter) loop(cond, post ast.Expression, body ast.Statement, test bool, c ast.Statement) control {
+	for {
+		if test && cond != nil && !in.condition(cond) {
+			return control{}
+		}
+		test = true
+		ctl := in.enter(body, c)
+		c = nil
+		switch ctl.kind {
+		case broke:
+			return control{}
+		case returned, jumped:
+			return ctl
+		}
+		if post != nil {
+			in.expression(post)
+		}
+	}
+}
+
+// switchStatement executes the body of a switch from the case label matching
+// its value, or the default label, or skips it if neither exists. If label is
+// not nil, the body is instead executed from that label, which a goto has
+// jumped to, without evaluating the value.
+func (in *interpreter) switchStatement(s *ast.SwitchStatement, label ast.Statement) control {
+	target := label
+	if target == nil {
+		v := in.expression(s.Value)
+		for _, c := range s.Cases {
+			if c.Value == nil {
+				if target == nil {
+					target = c
+				}
+			} else if c.Constant == v.i {
+				target = c
+				break
+			}
+		}
+	}
+	if target == nil {
+		return control{}
+	}
+	ctl := in.enter(s.Body, target)
+	if ctl.kind == broke {
+		return control{}
+	}
+	return ctl
+}
+
+// contains returns whether a statement is, or contains, a case label or
+// labelled statement.
+func contains(s ast.Statement, c ast.Statement) bool {
+	switch n := s.(type) {
+	case *ast.CaseStatement:
+		return n == c || contains(n.Body, c)
+	case *ast.LabeledStatement:
+		return n == c || contains(n.Body, c)
+	case *ast.Block:
+		for _, s := range n.Statements {
+			if contains(s, c) {
+				return true
+			}
+		}
+	case *ast.IfStatement:
+		return contains(n.Then, c) || (n.Else != nil && contains(n.Else, c))
+	case *ast.WhileStatement:
+		return contains(n.Body, c)
+	case *ast.DoWhileStatement:
+		return contains(n.Body, c)
+	case *ast.ForStatement:
+		return contains(n.Body, c)
+	case *ast.SwitchStatement:
+		return contains(n.Body, c)
+	}
+	return false
+}
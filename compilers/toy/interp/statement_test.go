@@ -0,0 +1,164 @@
+package interp
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvalIf(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(1, status(t, "int main() { int a = 3; if (a > 2) return 1; return 2; }"))
+	assert.Equal(2, status(t, "int main() { int a = 3; if (a > 4) return 1; else return 2; }"))
+	assert.Equal(3, status(t, "int main() { double a = 0.5; if (a) return 3; return 4; }"))
+}
+
+func TestEvalLoops(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(45, status(t, `int main() {
+  int n = 0;
+  int i = 0;
+  while (i < 10) { n += i; i++; }
+  return n;
+}`))
+	// The body of a do-while loop is executed before the condition is tested.
+	assert.Equal(1, status(t, "int main() { int n = 0; do n++; while (0); return n; }"))
+	assert.Equal(55, status(t, `int main() {
+  int n = 0;
+  for (int i = 0; i < 10; i++)
+    for (int j = 0; j < 10; j++) {
+      if (j > i)
+        break;
+      n++;
+    }
+  return n;
+}`))
+	// Continue evaluates the post expression of a for loop.
+	assert.Equal(25, status(t, `int main() {
+  int n = 0;
+  for (int i = 0; i < 10; i++) {
+    if (i % 2 == 0)
+      continue;
+    n += i;
+  }
+  return n;
+}`))
+	assert.Equal(10, status(t, "int main() { int i = 0; for (;;) if (++i == 10) break; return i; }"))
+}
+
+func TestEvalDeclarationInLoop(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(3, status(t, `int main() {
+  int n = 0;
+  for (int i = 0; i < 3; i++) { int a = 1; n += a; a = 5; }
+  return n;
+}`))
+}
+
+func TestEvalSwitch(t *testing.T) {
+	assert := assert.New(t)
+	program := `int f(int a) {
+  int n = 0;
+  switch (a) {
+  case 1:
+    n += 1;
+  case 2:
+    n += 2;
+    break;
+  default:
+    n += 10;
+  case 3:
+    n += 3;
+  }
+  return n;
+}
+int main() { return f(%d); }`
+	for _, test := range []struct{ value, status int }{
+		{1, 3}, {2, 2}, {3, 3}, {4, 13},
+	} {
+		assert.Equal(test.status, status(t, fmt.Sprintf(program, test.value)), "value: %d", test.value)
+	}
+	// Without a default, a switch with no matching case does nothing.
+	assert.Equal(7, status(t, "int main() { switch (2) { case 1: return 1; } return 7; }"))
+}
+
+func TestEvalSwitchContinue(t *testing.T) {
+	assert := assert.New(t)
+	// Continue in a switch continues the enclosing loop.
+	assert.Equal(10, status(t, `int main() {
+  int n = 0;
+  for (int i = 0; i < 4; i++) {
+    switch (i) {
+    case 1:
+      continue;
+    }
+    n += i * 2;
+  }
+  return n;
+}`))
+}
+
+func TestEvalNestedCase(t *testing.T) {
+	assert := assert.New(t)
+	// A case label within a loop in the body of the switch jumps into the
+	// loop, as in Duff's device.
+	assert.Equal(7, status(t, `int main() {
+  int count = 7;
+  int n = 0;
+  int i = (count + 3) / 4;
+  switch (count % 4) {
+  case 0: do { n++;
+  case 3: n++;
+  case 2: n++;
+  case 1: n++;
+    } while (--i > 0);
+  }
+  return n;
+}`))
+	assert.Equal(5, status(t, `int main() {
+  switch (1) {
+    if (0) {
+    case 1:
+      return 5;
+    }
+  }
+  return 6;
+}`))
+}
+
+func TestEvalGoto(t *testing.T) {
+	assert := assert.New(t)
+	// A goto may jump backwards, out of a loop, and into a block.
+	assert.Equal(12, status(t, `int main() {
+  int n = 0;
+again:
+  for (int i = 0; i < 10; i++) {
+    n++;
+    if (n % 4 == 0)
+      goto out;
+  }
+out:
+  if (n < 10)
+    goto again;
+  return n;
+}`))
+	assert.Equal(3, status(t, `int main() {
+  int n = 1;
+  goto inside;
+  while (n < 100) {
+    n = n * 10;
+  inside:
+    n = n + 2;
+    break;
+  }
+  return n;
+}`))
+	// Jumping over a declaration leaves the variable uninitialized.
+	assert.Equal(2, status(t, `int main() {
+  goto skip;
+  int a = 5;
+skip:
+  a = 2;
+  return a;
+}`))
+}
@@ -0,0 +1,148 @@
+package ir
+
+import (
+	"fmt"
+)
+
+// A basic block of a function: a sequence of instructions which is only
+// entered at its first instruction, and only left after its last. A block
+// starts at a label, or after a jump, branch, switch or return, which ends
+// a block.
+type Block struct {
+	Index  int // The index of the block in its graph.
+	Start  int // The index in the function of the first instruction.
+	Instrs []Instr
+	// The blocks which may execute before and after the block. The
+	// successors are in the order of the targets of the last instruction,
+	// without repeats, and the predecessors in the order of the blocks.
+	Preds []*Block
+	Succs []*Block
+}
+
+// Label returns the label which starts a block, or nil.
+func (b *Block) Label() *Label {
+	if len(b.Instrs) > 0 {
+		if l, ok := b.Instrs[0].(*Label); ok {
+			return l
+		}
+	}
+	return nil
+}
+
+// Name returns the name of a block: that of its label, or "entry" for the
+// first block of a function, or else its index.
+func (b *Block) Name() string {
+	switch l := b.Label(); {
+	case l != nil:
+		return l.String()
+	case b.Index == 0:
+		return "entry"
+	}
+	return fmt.Sprintf("b%d", b.Index)
+}
+
+// Terminator returns the jump, branch, switch or return which ends a block,
+// or nil if it falls through to the next block.
+func (b *Block) Terminator() Instr {
+	if len(b.Instrs) == 0 {
+		return nil
+	}
+	switch i := b.Instrs[len(b.Instrs)-1].(type) {
+	case *Jump, *Branch, *Switch, *Return:
+		return i
+	}
+	return nil
+}
+
+// The control-flow graph of a function, whose nodes are its basic blocks.
+type CFG struct {
+	Function *Function
+	// The blocks, in the order of their instructions. The first is the entry
+	// of the function. Unreachable blocks are included.
+	Blocks []*Block
+	blocks []*Block // The block of each instruction.
+}
+
+// NewCFG builds the control-flow graph of a function.
+func NewCFG(f *Function) *CFG {
+	g := &CFG{Function: f, blocks: make([]*Block, len(f.Instrs))}
+	var b *Block
+	for i, instr := range f.Instrs {
+		if _, ok := instr.(*Label); ok || b == nil {
+			b = &Block{Index: len(g.Blocks), Start: i}
+			g.Blocks = append(g.Blocks, b)
+		}
+		b.Instrs = f.Instrs[b.Start : i+1]
+		g.blocks[i] = b
+		switch instr.(type) {
+		case *Jump, *Branch, *Switch, *Return:
+			b = nil
+		}
+	}
+	labels := make(map[*Label]*Block)
+	for _, b := range g.Blocks {
+		if l := b.Label(); l != nil {
+			labels[l] = b
+		}
+	}
+	for _, b := range g.Blocks {
+		var targets []*Label
+		switch t := b.Terminator().(type) {
+		case *Jump:
+			targets = []*Label{t.Target}
+		case *Branch:
+			targets = []*Label{t.True, t.False}
+		case *Switch:
+			targets = []*Label{t.Default}
+			for _, c := range t.Cases {
+				targets = append(targets, c.Target)
+			}
+		case *Return:
+		case nil:
+			if b.Index+1 < len(g.Blocks) {
+				g.addEdge(b, g.Blocks[b.Index+1])
+			}
+		}
+		for _, l := range targets {
+			g.addEdge(b, labels[l])
+		}
+	}
+	return g
+}
+
+// addEdge adds an edge between two blocks, if there is not one already.
+func (g *CFG) addEdge(from, to *Block) {
+	for _, s := range from.Succs {
+		if s == to {
+			return
+		}
+	}
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// Block returns the block which contains an instruction, by its index in the
+// function.
+func (g *CFG) Block(i int) *Block {
+	return g.blocks[i]
+}
+
+// Reachable returns whether each block may be executed, by its index: that
+// is, whether there is a path to it from the entry.
+func (g *CFG) Reachable() []bool {
+	reachable := make([]bool, len(g.Blocks))
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		if reachable[b.Index] {
+			return
+		}
+		reachable[b.Index] = true
+		for _, s := range b.Succs {
+			visit(s)
+		}
+	}
+	if len(g.Blocks) > 0 {
+		visit(g.Blocks[0])
+	}
+	return reachable
+}
@@ -0,0 +1,95 @@
+package ir
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// names returns the names of blocks.
+func names(blocks []*Block) []string {
+	names := make([]string, len(blocks))
+	for i, b := range blocks {
+		names[i] = b.Name()
+	}
+	return names
+}
+
+func TestCFG(t *testing.T) {
+	assert := assert.New(t)
+	program := lowerProgram(t, `int f(int n) {
+  int s = 0;
+  while (n > 0) {
+    s = s + n;
+    n = n - 1;
+  }
+  return s;
+  s = 1;
+}`)
+	g := NewCFG(program.Functions[0])
+	assert.Equal([]string{"entry", "L1", "L2", "L3", "b4"}, names(g.Blocks))
+	entry, cond, body, exit, after := g.Blocks[0], g.Blocks[1], g.Blocks[2], g.Blocks[3], g.Blocks[4]
+	assert.Equal([]string{"L1"}, names(entry.Succs))
+	assert.Equal([]string{"entry", "L2"}, names(cond.Preds))
+	assert.Equal([]string{"L2", "L3"}, names(cond.Succs))
+	assert.Equal([]string{"L1"}, names(body.Succs))
+	assert.Equal([]string{"L1"}, names(exit.Preds))
+	assert.Empty(exit.Succs)
+	// The block after the return is unreachable.
+	assert.Empty(after.Preds)
+	assert.Equal([]bool{true, true, true, true, false}, g.Reachable())
+
+	assert.Equal(4, body.Start)
+	assert.Len(body.Instrs, 6)
+	assert.IsType(&Jump{}, body.Terminator())
+	assert.Equal(body, g.Block(4))
+	assert.Equal(body, g.Block(9))
+	assert.Equal(body.Label(), cond.Terminator().(*Branch).True)
+}
+
+func TestCFGEdges(t *testing.T) {
+	assert := assert.New(t)
+	program := lowerProgram(t, `int f(int n) {
+  switch (n) {
+  case 1:
+  case 2:
+    n = 3;
+  case 4:
+    return 4;
+  }
+  return n ? 1 : 2;
+}`)
+	g := NewCFG(program.Functions[0])
+	// A block without a jump falls through to the next.
+	for _, b := range g.Blocks {
+		if _, ok := b.Terminator().(*Switch); ok {
+			assert.Equal([]string{"L1", "L2", "L3", "L4"}, names(b.Succs))
+		}
+		if b.Terminator() == nil && b.Index+1 < len(g.Blocks) {
+			assert.Equal([]*Block{g.Blocks[b.Index+1]}, b.Succs)
+		}
+		for _, s := range b.Succs {
+			assert.Contains(s.Preds, b)
+		}
+	}
+}
+
+func TestCFGRepeatedTarget(t *testing.T) {
+	assert := assert.New(t)
+	// A branch whose targets are the same has one edge.
+	l := &Label{ID: 1}
+	g := NewCFG(&Function{Name: "f", Instrs: []Instr{
+		&Branch{Cond: NewInt(1, types.Int), True: l, False: l},
+		l,
+		&Return{},
+	}})
+	assert.Equal([]string{"L1"}, names(g.Blocks[0].Succs))
+	assert.Equal([]string{"entry"}, names(g.Blocks[1].Preds))
+}
+
+func TestCFGEmptyFunction(t *testing.T) {
+	assert := assert.New(t)
+	g := NewCFG(&Function{Name: "f"})
+	assert.Empty(g.Blocks)
+	assert.Empty(g.Reachable())
+}
@@ -0,0 +1,166 @@
+package ir
+
+// Postorder returns the blocks which are reachable from the entry of a
+// control-flow graph, each after its successors, except where they are in a
+// loop.
+func (g *CFG) Postorder() []*Block {
+	var order []*Block
+	visited := make([]bool, len(g.Blocks))
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		visited[b.Index] = true
+		for _, s := range b.Succs {
+			if !visited[s.Index] {
+				visit(s)
+			}
+		}
+		order = append(order, b)
+	}
+	if len(g.Blocks) > 0 {
+		visit(g.Blocks[0])
+	}
+	return order
+}
+
+// The dominator tree of a control-flow graph. A block dominates another if
+// every path from the entry to the other passes through it. Its immediate
+// dominator is the one of its strict dominators which is dominated by all
+// the others, and is its parent in the tree.
+type DomTree struct {
+	cfg      *CFG
+	idom     []*Block // The immediate dominator of each block, by index.
+	children [][]*Block
+	// The position of each block in a preorder and a postorder walk of the
+	// tree, which are nested for a block and those which it dominates.
+	pre, post []int
+}
+
+// Dominators computes the dominator tree of a control-flow graph, using the
+// iterative algorithm of Cooper, Harvey and Kennedy ("A Simple, Fast
+// Dominance Algorithm", 2001). Unreachable blocks are not in the tree.
+func (g *CFG) Dominators() *DomTree {
+	n := len(g.Blocks)
+	d := &DomTree{cfg: g, idom: make([]*Block, n), children: make([][]*Block, n),
+		pre: make([]int, n), post: make([]int, n)}
+	postorder := g.Postorder()
+	if len(postorder) == 0 {
+		return d
+	}
+	number := make([]int, n)
+	for i, b := range postorder {
+		number[b.Index] = i
+	}
+	entry := g.Blocks[0]
+	d.idom[entry.Index] = entry
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for number[a.Index] < number[b.Index] {
+				a = d.idom[a.Index]
+			}
+			for number[b.Index] < number[a.Index] {
+				b = d.idom[b.Index]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		// Visit the blocks in reverse postorder, so that the predecessors of a
+		// block are visited before it, except along back edges.
+		for i := len(postorder) - 2; i >= 0; i-- {
+			b := postorder[i]
+			var idom *Block
+			for _, p := range b.Preds {
+				if d.idom[p.Index] == nil {
+					continue
+				} else if idom == nil {
+					idom = p
+				} else {
+					idom = intersect(p, idom)
+				}
+			}
+			if d.idom[b.Index] != idom {
+				d.idom[b.Index], changed = idom, true
+			}
+		}
+	}
+	d.idom[entry.Index] = nil
+	for _, b := range g.Blocks {
+		if idom := d.idom[b.Index]; idom != nil {
+			d.children[idom.Index] = append(d.children[idom.Index], b)
+		}
+	}
+	clock := 0
+	var walk func(b *Block)
+	walk = func(b *Block) {
+		d.pre[b.Index] = clock
+		clock++
+		for _, c := range d.children[b.Index] {
+			walk(c)
+		}
+		d.post[b.Index] = clock
+		clock++
+	}
+	walk(entry)
+	return d
+}
+
+// Idom returns the immediate dominator of a block, or nil for the entry and
+// unreachable blocks.
+func (d *DomTree) Idom(b *Block) *Block {
+	return d.idom[b.Index]
+}
+
+// Children returns the blocks whose immediate dominator is a block, in order.
+func (d *DomTree) Children(b *Block) []*Block {
+	return d.children[b.Index]
+}
+
+// Dominates returns whether one reachable block dominates another. A block
+// dominates itself.
+func (d *DomTree) Dominates(a, b *Block) bool {
+	return d.pre[a.Index] <= d.pre[b.Index] && d.post[b.Index] <= d.post[a.Index]
+}
+
+// Frontiers returns the dominance frontier of each block, by index: the
+// blocks which are not strictly dominated by it, but have a predecessor
+// which is dominated by it, in the order of the blocks. These are where
+// the paths from the block meet others.
+func (d *DomTree) Frontiers() [][]*Block {
+	frontiers := make([][]*Block, len(d.cfg.Blocks))
+	if len(d.cfg.Blocks) == 0 {
+		return frontiers
+	}
+	seen := make([]map[*Block]bool, len(d.cfg.Blocks))
+	entry := d.cfg.Blocks[0]
+	for _, b := range d.cfg.Blocks {
+		// The paths from blocks meet at a block with more than one
+		// predecessor, or at the entry, which is entered from the caller.
+		if !d.reachable(b) || len(b.Preds) < 2 && b != entry {
+			continue
+		}
+		idom := d.idom[b.Index]
+		for _, p := range b.Preds {
+			if !d.reachable(p) {
+				continue
+			}
+			// Walk up from each predecessor to the immediate dominator of the
+			// block, which dominates it strictly, or past the entry.
+			for runner := p; runner != idom; runner = d.idom[runner.Index] {
+				if seen[runner.Index] == nil {
+					seen[runner.Index] = make(map[*Block]bool)
+				}
+				if !seen[runner.Index][b] {
+					seen[runner.Index][b] = true
+					frontiers[runner.Index] = append(frontiers[runner.Index], b)
+				}
+			}
+		}
+	}
+	return frontiers
+}
+
+// reachable returns whether a block is in the tree.
+func (d *DomTree) reachable(b *Block) bool {
+	return b == d.cfg.Blocks[0] || d.idom[b.Index] != nil
+}
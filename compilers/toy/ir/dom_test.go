@@ -0,0 +1,79 @@
+package ir
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// The CFG of a function with a loop containing an if statement, and a block
+// after the return which is unreachable.
+const loopWithIf = `int f(int n) {
+  int s = 0;
+  while (n > 0) {
+    if (n > 5)
+      s = s + 2;
+    else
+      s = s + 1;
+    n = n - 1;
+  }
+  return s;
+  n = 1;
+}`
+
+func TestDominators(t *testing.T) {
+	assert := assert.New(t)
+	g := NewCFG(lowerProgram(t, loopWithIf).Functions[0])
+	assert.Equal([]string{"entry", "L1", "L2", "L4", "L6", "L5", "L3", "b7"}, names(g.Blocks))
+	d := g.Dominators()
+	idoms := make([]string, len(g.Blocks))
+	for i, b := range g.Blocks {
+		if idom := d.Idom(b); idom != nil {
+			idoms[i] = idom.Name()
+		}
+	}
+	assert.Equal([]string{"", "entry", "L1", "L2", "L2", "L2", "L1", ""}, idoms)
+	assert.Equal([]string{"L4", "L6", "L5"}, names(d.Children(g.Blocks[2])))
+
+	entry, cond, body, then, join, exit := g.Blocks[0], g.Blocks[1], g.Blocks[2], g.Blocks[3], g.Blocks[5], g.Blocks[6]
+	assert.True(d.Dominates(entry, exit))
+	assert.True(d.Dominates(cond, cond))
+	assert.True(d.Dominates(body, join))
+	assert.False(d.Dominates(then, join))
+	assert.False(d.Dominates(body, exit))
+	assert.False(d.Dominates(exit, cond))
+}
+
+func TestFrontiers(t *testing.T) {
+	assert := assert.New(t)
+	g := NewCFG(lowerProgram(t, loopWithIf).Functions[0])
+	frontiers := g.Dominators().Frontiers()
+	var got [][]string
+	for _, f := range frontiers {
+		got = append(got, names(f))
+	}
+	assert.Equal([][]string{{}, {"L1"}, {"L1"}, {"L5"}, {"L5"}, {"L1"}, {}, {}}, got)
+}
+
+func TestFrontierOfLoopAtEntry(t *testing.T) {
+	assert := assert.New(t)
+	// The entry is in the frontier of the blocks of a loop which includes it.
+	loop, exit := &Label{ID: 1}, &Label{ID: 2}
+	f := &Function{Name: "f", Instrs: []Instr{
+		loop,
+		&Branch{Cond: NewInt(1, types.Int), True: loop, False: exit},
+		exit,
+		&Return{},
+	}}
+	g := NewCFG(f)
+	frontiers := g.Dominators().Frontiers()
+	assert.Equal([]string{"L1"}, names(frontiers[0]))
+	assert.Empty(frontiers[1])
+}
+
+func TestPostorder(t *testing.T) {
+	assert := assert.New(t)
+	g := NewCFG(lowerProgram(t, loopWithIf).Functions[0])
+	// The unreachable block is not visited.
+	assert.Equal([]string{"L5", "L4", "L6", "L2", "L3", "L1", "entry"}, names(g.Postorder()))
+}
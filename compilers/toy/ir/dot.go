@@ -0,0 +1,90 @@
+package ir
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PrintDot writes the control-flow graph of each function of a program to w,
+// as a Graphviz digraph per function.
+func PrintDot(w io.Writer, program *Program) error {
+	for _, f := range program.Functions {
+		if err := PrintFunctionDot(w, NewCFG(f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintFunctionDot writes a control-flow graph to w as a Graphviz digraph
+// named after its function. Each block is a node listing its instructions,
+// and the edges out of a branch or switch are labelled with the conditions
+// under which they are taken.
+func PrintFunctionDot(w io.Writer, g *CFG) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(g.Function.Name))
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	for _, block := range g.Blocks {
+		// Each line is left-justified.
+		var label strings.Builder
+		label.WriteString(block.Name() + ":\\l")
+		for _, instr := range block.Instrs {
+			if _, ok := instr.(*Label); !ok {
+				label.WriteString("  " + dotEscape(instr.String()) + "\\l")
+			}
+		}
+		fmt.Fprintf(&b, "\tb%d [label=\"%s\"];\n", block.Index, label.String())
+	}
+	for _, block := range g.Blocks {
+		for _, s := range block.Succs {
+			fmt.Fprintf(&b, "\tb%d -> b%d", block.Index, s.Index)
+			if l := edgeLabel(block, s); l != "" {
+				fmt.Fprintf(&b, " [label=%s]", dotQuote(l))
+			}
+			b.WriteString(";\n")
+		}
+	}
+	b.WriteString("}\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// edgeLabel returns the condition under which the edge between two blocks is
+// taken, if the first ends with a branch or switch which may go elsewhere.
+func edgeLabel(from, to *Block) string {
+	target := to.Label()
+	switch t := from.Terminator().(type) {
+	case *Branch:
+		if t.True == t.False {
+			return ""
+		} else if t.True == target {
+			return "true"
+		}
+		return "false"
+	case *Switch:
+		var values []string
+		for _, c := range t.Cases {
+			if c.Target == target {
+				values = append(values, fmt.Sprint(c.Value))
+			}
+		}
+		if t.Default == target {
+			values = append(values, "default")
+		}
+		return strings.Join(values, ", ")
+	}
+	return ""
+}
+
+// dotQuote returns a string as a quoted Graphviz ID.
+func dotQuote(s string) string {
+	return "\"" + dotEscape(s) + "\""
+}
+
+// dotEscape escapes the quotes and backslashes of a string, for a quoted
+// Graphviz ID.
+func dotEscape(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(s)
+}
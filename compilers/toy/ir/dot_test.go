@@ -0,0 +1,47 @@
+package ir
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrintDot(t *testing.T) {
+	assert := assert.New(t)
+	program := lowerProgram(t, `int f(int n) {
+  if (n)
+    return 1;
+  return 2;
+}
+int g(int n) {
+  switch (n) { case 1: case 2: return 3; }
+  return 4;
+}`)
+	var b bytes.Buffer
+	assert.NoError(PrintDot(&b, program))
+	assert.Equal(`digraph "f" {
+	node [shape=box, fontname="monospace"];
+	b0 [label="entry:\l  branch %n, L1, L2\l"];
+	b1 [label="L1:\l  return 1\l"];
+	b2 [label="L2:\l  return 2\l"];
+	b0 -> b1 [label="true"];
+	b0 -> b2 [label="false"];
+}
+digraph "g" {
+	node [shape=box, fontname="monospace"];
+	b0 [label="entry:\l  switch %n, L3 [1: L4, 2: L5]\l"];
+	b1 [label="L4:\l"];
+	b2 [label="L5:\l  return 3\l"];
+	b3 [label="L3:\l  return 4\l"];
+	b0 -> b3 [label="default"];
+	b0 -> b1 [label="1"];
+	b0 -> b2 [label="2"];
+	b1 -> b2;
+}
+`, b.String())
+}
+
+func TestDotEscape(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`"a\"b\\c"`, dotQuote(`a"b\c`))
+}
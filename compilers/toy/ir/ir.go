@@ -0,0 +1,631 @@
+// Package ir defines a three-address code intermediate representation.
+//
+// A function is a list of instructions, each of which applies at most one
+// operator to constant or temporary operands and assigns the result to a
+// temporary. Control flow is explicit, using labels, jumps and branches.
+// Temporaries are typed, and their number is unbounded: local variables are
+// temporaries too, so it is up to a backend to decide which live in registers
+// and which on the stack. A variable whose address is taken is instead kept
+// in a slot, in the stack frame, which is accessed by loads and stores, as
+// are arrays and structs. Global variables are likewise in memory, in the
+// data of the program.
+//
+// For optimization, a function may be converted to SSA form, in which each
+// temporary is assigned once, and phis choose between the values which
+// reach a block. It is converted back before code generation.
+package ir
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"strings"
+)
+
+// A program in the intermediate representation.
+type Program struct {
+	Globals []*Global
+	// The string literals of the program, which are read-only arrays of
+	// chars. Identical literals share a global.
+	Strings   []*Global
+	Functions []*Function
+	labels    int // The number of labels created so far.
+}
+
+// A global variable, which is stored in the data of the program, or a string
+// literal.
+type Global struct {
+	Name string
+	Type types.Type
+	// The initial value, an IntConst or FloatConst of the type of the
+	// variable, or nil if it is initially zero.
+	Init Value
+	// The characters of a string literal, including its terminating NUL, or
+	// empty if the global is a variable.
+	Data string
+	// Whether the variable is only declared, and defined by another program
+	// which is linked with this one.
+	Extern bool
+	// Whether the variable is static, so is not visible to other programs.
+	Static bool
+}
+
+func (g *Global) String() string {
+	return "@" + g.Name
+}
+
+// NewLabel creates a label which is unique within the program.
+func (p *Program) NewLabel() *Label {
+	p.labels++
+	return &Label{ID: p.labels}
+}
+
+// A function.
+type Function struct {
+	Name   string
+	Pos    token.Position // The position of the definition, if known.
+	Params []*Temp        // The temporaries which hold the arguments on entry.
+	Result types.Type
+	Static bool // Whether the function is not visible to other programs.
+	Instrs []Instr
+	// The position of the statement which each instruction was lowered from,
+	// for debug information. It is invalid if unknown, and may be shorter
+	// than the instructions if none are known.
+	Positions []token.Position
+	Temps     []*Temp // Every temporary of the function, in order of creation.
+	Slots     []*Slot // Every stack slot of the function, in order of creation.
+	// The number of variables created with each name, used to give shadowed
+	// variables unique names.
+	names map[string]int
+}
+
+// NewTemp creates an anonymous temporary.
+func (f *Function) NewTemp(t types.Type) *Temp {
+	temp := &Temp{ID: len(f.Temps), typ: t}
+	f.Temps = append(f.Temps, temp)
+	return temp
+}
+
+// NewVariable creates a temporary for a named variable. The name is made
+// unique within the function by adding a suffix, if required.
+func (f *Function) NewVariable(name string, t types.Type) *Temp {
+	temp := f.NewTemp(t)
+	temp.Name = f.uniqueName(name)
+	return temp
+}
+
+// NewSlot creates a stack slot for a named variable of type t, whose name is
+// made unique within the function like that of a temporary.
+func (f *Function) NewSlot(name string, t types.Type) *Slot {
+	slot := &Slot{ID: len(f.Slots), Name: f.uniqueName(name), Type: t}
+	f.Slots = append(f.Slots, slot)
+	return slot
+}
+
+// uniqueName returns a name for a variable which is distinct from those of
+// the other variables of the function.
+func (f *Function) uniqueName(name string) string {
+	if f.names == nil {
+		f.names = make(map[string]int)
+	}
+	n := f.names[name]
+	f.names[name]++
+	if n > 0 {
+		return fmt.Sprintf("%s.%d", name, n)
+	}
+	return name
+}
+
+// Emit appends an instruction to the function, at an unknown position.
+func (f *Function) Emit(instr Instr) {
+	f.EmitAt(instr, token.Position{})
+}
+
+// EmitAt appends an instruction to the function, lowered from a position.
+func (f *Function) EmitAt(instr Instr, pos token.Position) {
+	for len(f.Positions) < len(f.Instrs) {
+		f.Positions = append(f.Positions, token.Position{})
+	}
+	f.Instrs = append(f.Instrs, instr)
+	f.Positions = append(f.Positions, pos)
+}
+
+// Position returns the position of the ith instruction, which is invalid if
+// unknown.
+func (f *Function) Position(i int) token.Position {
+	if i < len(f.Positions) {
+		return f.Positions[i]
+	}
+	return token.Position{}
+}
+
+// An Error is an error of lowering a node, or of compiling an instruction
+// which a backend does not support, at the position of the node or of the
+// statement which the instruction was lowered from, if known.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
+// An operand of an instruction.
+type Value interface {
+	Type() types.Type
+	String() string
+	value()
+}
+
+// A temporary, which is assigned by instructions.
+type Temp struct {
+	ID   int    // Unique within the function.
+	Name string // The name of the variable, or "" for anonymous temporaries.
+	typ  types.Type
+}
+
+func (*Temp) value() {}
+
+func (t *Temp) Type() types.Type {
+	return t.typ
+}
+
+func (t *Temp) String() string {
+	if t.Name != "" {
+		return "%" + t.Name
+	}
+	return fmt.Sprintf("%%%d", t.ID)
+}
+
+// A slot in the stack frame of a function, which holds a variable in memory:
+// an array, a struct, or a variable whose address is taken.
+type Slot struct {
+	ID   int    // Unique within the function.
+	Name string // The name of the variable which the slot holds.
+	Type types.Type
+	// The parameter which is copied to the slot on entry, if the variable is
+	// a parameter.
+	Param *Temp
+}
+
+func (s *Slot) String() string {
+	return "$" + s.Name
+}
+
+// An integer constant, or for a pointer type, the null pointer.
+type IntConst struct {
+	Value int64
+	typ   types.Type
+}
+
+// NewInt returns an integer constant of type t.
+func NewInt(value int64, t types.Type) *IntConst {
+	return &IntConst{Value: value, typ: t}
+}
+
+func (*IntConst) value() {}
+
+func (c *IntConst) Type() types.Type {
+	return c.typ
+}
+
+func (c *IntConst) String() string {
+	return fmt.Sprintf("%d", c.Value)
+}
+
+// A floating-point constant.
+type FloatConst struct {
+	Value float64
+	typ   types.Type
+}
+
+// NewFloat returns a floating-point constant of type t.
+func NewFloat(value float64, t types.Type) *FloatConst {
+	return &FloatConst{Value: value, typ: t}
+}
+
+func (*FloatConst) value() {}
+
+func (c *FloatConst) Type() types.Type {
+	return c.typ
+}
+
+func (c *FloatConst) String() string {
+	s := fmt.Sprintf("%g", c.Value)
+	if c.typ == types.Float {
+		s += "f"
+	}
+	return s
+}
+
+// One returns the constant one of an arithmetic type.
+func One(t types.Type) Value {
+	if types.IsFloating(t) {
+		return NewFloat(1, t)
+	}
+	return NewInt(1, t)
+}
+
+// Zero returns the zero constant of an arithmetic type, or the null pointer.
+func Zero(t types.Type) Value {
+	if types.IsFloating(t) {
+		return NewFloat(0, t)
+	}
+	return NewInt(0, t)
+}
+
+// An operator of a Unary or Binary instruction. Division, remainder, right
+// shift and comparison of unsigned ints are unsigned.
+type Op int
+
+const (
+	Add Op = iota
+	Sub
+	Mul
+	Div
+	Rem
+	// Bitwise operators, on integers. The count of a shift is taken modulo the
+	// width of the operand.
+	And
+	Or
+	Xor
+	Shl
+	Shr // Arithmetic shift right, or logical of an unsigned int.
+	// Comparisons, which produce an int of 0 or 1.
+	Eq
+	Ne
+	Lt
+	Le
+	Gt
+	Ge
+	// Unary operators.
+	Neg
+	Not // Bitwise complement.
+)
+
+var opNames = [...]string{
+	Add: "add",
+	Sub: "sub",
+	Mul: "mul",
+	Div: "div",
+	Rem: "rem",
+	And: "and",
+	Or:  "or",
+	Xor: "xor",
+	Shl: "shl",
+	Shr: "shr",
+	Eq:  "eq",
+	Ne:  "ne",
+	Lt:  "lt",
+	Le:  "le",
+	Gt:  "gt",
+	Ge:  "ge",
+	Neg: "neg",
+	Not: "not",
+}
+
+func (op Op) String() string {
+	return opNames[op]
+}
+
+// IsComparison returns whether the operator is a comparison.
+func (op Op) IsComparison() bool {
+	return op >= Eq && op <= Ge
+}
+
+// An instruction.
+type Instr interface {
+	String() string
+	instr()
+}
+
+// Dst = Src
+type Copy struct {
+	Dst *Temp
+	Src Value
+}
+
+// Dst = Op Src
+type Unary struct {
+	Op  Op
+	Dst *Temp
+	Src Value
+}
+
+// Dst = Lhs Op Rhs. The operands have the same type. For comparisons, the
+// result is an int.
+type Binary struct {
+	Op  Op
+	Dst *Temp
+	Lhs Value
+	Rhs Value
+}
+
+// Dst = (type of Dst) Src, converting between arithmetic types, between an
+// int and a pointer, or between pointer types, which have the same
+// representation.
+type Convert struct {
+	Dst *Temp
+	Src Value
+}
+
+// Dst = Cond ? True : False, for an int Cond, which evaluates both operands
+// without branching. The operands are integers or pointers of the type of
+// Dst.
+type Select struct {
+	Dst   *Temp
+	Cond  Value
+	True  Value
+	False Value
+}
+
+// Dst = &Slot, the address of a stack slot.
+type Addr struct {
+	Dst  *Temp
+	Slot *Slot
+}
+
+// Dst = &Global, the address of a global variable.
+type GlobalAddr struct {
+	Dst    *Temp
+	Global *Global
+}
+
+// Dst = *Addr, loading a value of the type of Dst from memory.
+type Load struct {
+	Dst  *Temp
+	Addr Value
+}
+
+// *Addr = Src, storing a value to memory.
+type Store struct {
+	Addr Value
+	Src  Value
+}
+
+// Dst = Ptr + Index, for a pointer Ptr and an integer Index, which is
+// scaled by the size of the type pointed to. Dst has the type of Ptr.
+type PtrAdd struct {
+	Dst   *Temp
+	Ptr   Value
+	Index Value
+}
+
+// Dst = &Ptr->Field, the address of a field of the struct which Ptr points
+// to. Field is the index of the field, and Dst a pointer to its type.
+type FieldAddr struct {
+	Dst   *Temp
+	Ptr   Value
+	Field int
+}
+
+// Dst = Lhs - Rhs, the int number of elements between two pointers of the
+// same type.
+type PtrDiff struct {
+	Dst *Temp
+	Lhs Value
+	Rhs Value
+}
+
+// A jump target.
+type Label struct {
+	ID int // Unique within the program.
+}
+
+// An unconditional jump.
+type Jump struct {
+	Target *Label
+}
+
+// A jump to True if the int Cond is non-zero, else to False.
+type Branch struct {
+	Cond  Value
+	True  *Label
+	False *Label
+}
+
+// A jump to the target of the case whose value equals the int Value, or to
+// Default if there is none. The values of the cases are distinct.
+type Switch struct {
+	Value   Value
+	Cases   []SwitchCase
+	Default *Label
+}
+
+// A case of a Switch instruction.
+type SwitchCase struct {
+	Value  int64
+	Target *Label
+}
+
+// The fewest cases for which a backend dispatches a switch by a jump table.
+// Fewer cases are dispatched as quickly by a chain of comparisons.
+const minJumpTableCases = 4
+
+// The largest ratio of the range of case values to the number of cases for
+// which a backend dispatches a switch by a jump table, which bounds the
+// number of entries in the table which jump to the default.
+const maxJumpTableSparsity = 3
+
+// JumpTableRange returns the smallest and largest case values of a switch,
+// and whether the values are dense enough for the backends to dispatch it by
+// a jump table.
+func (s *Switch) JumpTableRange() (int64, int64, bool) {
+	if len(s.Cases) < minJumpTableCases {
+		return 0, 0, false
+	}
+	low, high := s.Cases[0].Value, s.Cases[0].Value
+	for _, c := range s.Cases {
+		if c.Value < low {
+			low = c.Value
+		}
+		if c.Value > high {
+			high = c.Value
+		}
+	}
+	return low, high, high-low+1 <= maxJumpTableSparsity*int64(len(s.Cases))
+}
+
+// Dst = Function(Args...), a call of a named function. The arguments of a
+// variadic function which follow its Fixed parameters are passed as the
+// variable arguments, whose types are not declared.
+type Call struct {
+	Dst      *Temp
+	Function string
+	Args     []Value
+	Variadic bool
+	Fixed    int // The number of parameters of a variadic function.
+}
+
+// A return from the function.
+type Return struct {
+	Value Value
+}
+
+// Dst = phi [Pred: Value]..., which is the value of the argument for the
+// block from which control entered the block of the phi. Phis are only in
+// SSA form, at the start of a block, before every other instruction but its
+// label. There is an argument for each predecessor of the block.
+type Phi struct {
+	Dst  *Temp
+	Args []PhiArg
+}
+
+// An argument of a Phi instruction.
+type PhiArg struct {
+	// The label which starts the predecessor, or nil for the entry block,
+	// which is the only reachable block which may have no label.
+	Pred  *Label
+	Value Value
+}
+
+func (*Copy) instr()       {}
+func (*Unary) instr()      {}
+func (*Binary) instr()     {}
+func (*Convert) instr()    {}
+func (*Select) instr()     {}
+func (*Addr) instr()       {}
+func (*GlobalAddr) instr() {}
+func (*Load) instr()       {}
+func (*Store) instr()      {}
+func (*PtrAdd) instr()     {}
+func (*FieldAddr) instr()  {}
+func (*PtrDiff) instr()    {}
+func (*Label) instr()      {}
+func (*Jump) instr()       {}
+func (*Branch) instr()     {}
+func (*Switch) instr()     {}
+func (*Call) instr()       {}
+func (*Return) instr()     {}
+func (*Phi) instr()        {}
+
+// def formats the destination of an instruction, with its type.
+func def(t *Temp) string {
+	return fmt.Sprintf("%v:%v", t, t.Type())
+}
+
+func (i *Copy) String() string {
+	return fmt.Sprintf("%s = %v", def(i.Dst), i.Src)
+}
+
+func (i *Unary) String() string {
+	return fmt.Sprintf("%s = %v %v", def(i.Dst), i.Op, i.Src)
+}
+
+func (i *Binary) String() string {
+	return fmt.Sprintf("%s = %v %v, %v", def(i.Dst), i.Op, i.Lhs, i.Rhs)
+}
+
+func (i *Convert) String() string {
+	return fmt.Sprintf("%s = convert %v", def(i.Dst), i.Src)
+}
+
+func (i *Select) String() string {
+	return fmt.Sprintf("%s = select %v, %v, %v", def(i.Dst), i.Cond, i.True,
+		i.False)
+}
+
+func (i *Addr) String() string {
+	return fmt.Sprintf("%s = addr %v", def(i.Dst), i.Slot)
+}
+
+func (i *GlobalAddr) String() string {
+	return fmt.Sprintf("%s = addr %v", def(i.Dst), i.Global)
+}
+
+func (i *Load) String() string {
+	return fmt.Sprintf("%s = load %v", def(i.Dst), i.Addr)
+}
+
+func (i *Store) String() string {
+	return fmt.Sprintf("store %v, %v", i.Addr, i.Src)
+}
+
+func (i *PtrAdd) String() string {
+	return fmt.Sprintf("%s = ptradd %v, %v", def(i.Dst), i.Ptr, i.Index)
+}
+
+func (i *FieldAddr) String() string {
+	s := i.Ptr.Type().(*types.Pointer).Elem.(*types.Struct)
+	return fmt.Sprintf("%s = fieldaddr %v, %s", def(i.Dst), i.Ptr,
+		s.Fields[i.Field].Name)
+}
+
+func (i *PtrDiff) String() string {
+	return fmt.Sprintf("%s = ptrdiff %v, %v", def(i.Dst), i.Lhs, i.Rhs)
+}
+
+func (l *Label) String() string {
+	return fmt.Sprintf("L%d", l.ID)
+}
+
+func (i *Jump) String() string {
+	return fmt.Sprintf("jump %v", i.Target)
+}
+
+func (i *Branch) String() string {
+	return fmt.Sprintf("branch %v, %v, %v", i.Cond, i.True, i.False)
+}
+
+func (i *Switch) String() string {
+	cases := make([]string, len(i.Cases))
+	for j, c := range i.Cases {
+		cases[j] = fmt.Sprintf("%d: %v", c.Value, c.Target)
+	}
+	return fmt.Sprintf("switch %v, %v [%s]", i.Value, i.Default,
+		strings.Join(cases, ", "))
+}
+
+// The variable arguments of a variadic call follow "...", as in
+// "call printf(@str.0, ..., 1)".
+func (i *Call) String() string {
+	var args []string
+	for j, a := range i.Args {
+		if i.Variadic && j == i.Fixed {
+			args = append(args, "...")
+		}
+		args = append(args, a.String())
+	}
+	return fmt.Sprintf("%s = call %s(%s)", def(i.Dst), i.Function,
+		strings.Join(args, ", "))
+}
+
+func (i *Return) String() string {
+	return fmt.Sprintf("return %v", i.Value)
+}
+
+func (i *Phi) String() string {
+	args := make([]string, len(i.Args))
+	for j, a := range i.Args {
+		pred := "entry"
+		if a.Pred != nil {
+			pred = a.Pred.String()
+		}
+		args[j] = fmt.Sprintf("[%s: %v]", pred, a.Value)
+	}
+	return fmt.Sprintf("%s = phi %s", def(i.Dst), strings.Join(args, ", "))
+}
@@ -0,0 +1,142 @@
+package ir
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewTemp(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{}
+	a := f.NewTemp(types.Int)
+	b := f.NewTemp(types.Double)
+	assert.Equal("%0", a.String())
+	assert.Equal("%1", b.String())
+	assert.Equal(types.Double, b.Type())
+	assert.Equal([]*Temp{a, b}, f.Temps)
+}
+
+func TestNewVariableUniquifiesNames(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{}
+	assert.Equal("%a", f.NewVariable("a", types.Int).String())
+	assert.Equal("%b", f.NewVariable("b", types.Int).String())
+	assert.Equal("%a.1", f.NewVariable("a", types.Int).String())
+	assert.Equal("%a.2", f.NewVariable("a", types.Float).String())
+	assert.Equal(4, len(f.Temps))
+}
+
+func TestNewLabel(t *testing.T) {
+	assert := assert.New(t)
+	p := &Program{}
+	assert.Equal("L1", p.NewLabel().String())
+	assert.Equal("L2", p.NewLabel().String())
+}
+
+func TestConstString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("-3", NewInt(-3, types.Int).String())
+	assert.Equal("2.5", NewFloat(2.5, types.Double).String())
+	assert.Equal("2.5f", NewFloat(2.5, types.Float).String())
+	assert.Equal("1e+100", NewFloat(1e100, types.Double).String())
+}
+
+func TestOne(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(NewInt(1, types.Int), One(types.Int))
+	assert.Equal(NewFloat(1, types.Double), One(types.Double))
+}
+
+func TestZero(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(NewInt(0, types.Int), Zero(types.Int))
+	assert.Equal(NewFloat(0, types.Float), Zero(types.Float))
+	assert.Equal(NewFloat(0, types.Double), Zero(types.Double))
+}
+
+func TestOpIsComparison(t *testing.T) {
+	assert := assert.New(t)
+	for _, op := range []Op{Eq, Ne, Lt, Le, Gt, Ge} {
+		assert.True(op.IsComparison(), op.String())
+	}
+	for _, op := range []Op{Add, Sub, Mul, Div, Neg, Not} {
+		assert.False(op.IsComparison(), op.String())
+	}
+}
+
+func TestInstrString(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{}
+	a := f.NewVariable("a", types.Int)
+	d := f.NewTemp(types.Double)
+	l1, l2 := &Label{ID: 1}, &Label{ID: 2}
+	assert.Equal("%a:int = 2", (&Copy{Dst: a, Src: NewInt(2, types.Int)}).String())
+	assert.Equal("%a:int = neg %a", (&Unary{Op: Neg, Dst: a, Src: a}).String())
+	assert.Equal("%a:int = shr %a, 2",
+		(&Binary{Op: Shr, Dst: a, Lhs: a, Rhs: NewInt(2, types.Int)}).String())
+	assert.Equal("%a:int = add %a, 2",
+		(&Binary{Op: Add, Dst: a, Lhs: a, Rhs: NewInt(2, types.Int)}).String())
+	assert.Equal("%1:double = convert %a", (&Convert{Dst: d, Src: a}).String())
+	assert.Equal("jump L1", (&Jump{Target: l1}).String())
+	assert.Equal("branch %a, L1, L2",
+		(&Branch{Cond: a, True: l1, False: l2}).String())
+	assert.Equal("%1:double = call f(%a, 2)", (&Call{Dst: d, Function: "f",
+		Args: []Value{a, NewInt(2, types.Int)}}).String())
+	assert.Equal("%1:double = call g()", (&Call{Dst: d, Function: "g"}).String())
+	assert.Equal("return %1", (&Return{Value: d}).String())
+	assert.Equal("%a:int = select %a, 1, 2", (&Select{Dst: a, Cond: a,
+		True: NewInt(1, types.Int), False: NewInt(2, types.Int)}).String())
+	assert.Equal("switch %a, L2 [1: L1, -3: L2]", (&Switch{Value: a,
+		Cases: []SwitchCase{{1, l1}, {-3, l2}}, Default: l2}).String())
+	slot := f.NewSlot("b", types.Int)
+	p := f.NewVariable("p", types.NewPointer(types.Int))
+	assert.Equal("%p:int * = addr $b", (&Addr{Dst: p, Slot: slot}).String())
+	assert.Equal("%a:int = load %p", (&Load{Dst: a, Addr: p}).String())
+	assert.Equal("store %p, 2",
+		(&Store{Addr: p, Src: NewInt(2, types.Int)}).String())
+	assert.Equal("%p:int * = ptradd %p, %a",
+		(&PtrAdd{Dst: p, Ptr: p, Index: a}).String())
+	assert.Equal("%a:int = ptrdiff %p, %p",
+		(&PtrDiff{Dst: a, Lhs: p, Rhs: p}).String())
+}
+
+// switchOf returns a switch with cases of the given values.
+func switchOf(values ...int64) *Switch {
+	s := &Switch{}
+	for i, v := range values {
+		s.Cases = append(s.Cases, SwitchCase{Value: v, Target: &Label{ID: i + 1}})
+	}
+	return s
+}
+
+func TestSwitchJumpTableRange(t *testing.T) {
+	assert := assert.New(t)
+	low, high, ok := switchOf(3, 1, 2, 4).JumpTableRange()
+	assert.True(ok)
+	assert.Equal(int64(1), low)
+	assert.Equal(int64(4), high)
+	// At most three entries per case.
+	_, _, ok = switchOf(-5, 0, 1, 6).JumpTableRange()
+	assert.True(ok)
+	_, _, ok = switchOf(-5, 0, 1, 7).JumpTableRange()
+	assert.False(ok)
+	// Too few cases.
+	_, _, ok = switchOf(1, 2, 3).JumpTableRange()
+	assert.False(ok)
+}
+
+func TestNewSlot(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{}
+	a := f.NewVariable("a", types.Int)
+	s := f.NewSlot("a", types.Double)
+	b := f.NewSlot("b", types.Int)
+	assert.Equal("a", a.Name)
+	assert.Equal("$a.1", s.String())
+	assert.Equal(0, s.ID)
+	assert.Equal(types.Double, s.Type)
+	assert.Equal("$b", b.String())
+	assert.Equal(1, b.ID)
+	assert.Equal([]*Slot{s, b}, f.Slots)
+}
@@ -0,0 +1,220 @@
+package ir
+
+// Def returns the temporary assigned by an instruction, or nil.
+func Def(instr Instr) *Temp {
+	if d := dst(instr); d != nil {
+		return *d
+	}
+	return nil
+}
+
+// dst returns the destination of an instruction which assigns a temporary,
+// or nil.
+func dst(instr Instr) **Temp {
+	switch i := instr.(type) {
+	case *Copy:
+		return &i.Dst
+	case *Unary:
+		return &i.Dst
+	case *Binary:
+		return &i.Dst
+	case *Convert:
+		return &i.Dst
+	case *Select:
+		return &i.Dst
+	case *Addr:
+		return &i.Dst
+	case *GlobalAddr:
+		return &i.Dst
+	case *Load:
+		return &i.Dst
+	case *PtrAdd:
+		return &i.Dst
+	case *FieldAddr:
+		return &i.Dst
+	case *PtrDiff:
+		return &i.Dst
+	case *Call:
+		return &i.Dst
+	case *Phi:
+		return &i.Dst
+	}
+	return nil
+}
+
+// Uses returns the temporaries read by an instruction.
+func Uses(instr Instr) []*Temp {
+	var temps []*Temp
+	for _, v := range Operands(instr) {
+		if t, ok := (*v).(*Temp); ok {
+			temps = append(temps, t)
+		}
+	}
+	return temps
+}
+
+// Operands returns the operands of an instruction, so that they may be
+// replaced.
+func Operands(instr Instr) []*Value {
+	switch i := instr.(type) {
+	case *Copy:
+		return []*Value{&i.Src}
+	case *Unary:
+		return []*Value{&i.Src}
+	case *Binary:
+		return []*Value{&i.Lhs, &i.Rhs}
+	case *Convert:
+		return []*Value{&i.Src}
+	case *Select:
+		return []*Value{&i.Cond, &i.True, &i.False}
+	case *Load:
+		return []*Value{&i.Addr}
+	case *Store:
+		return []*Value{&i.Addr, &i.Src}
+	case *PtrAdd:
+		return []*Value{&i.Ptr, &i.Index}
+	case *FieldAddr:
+		return []*Value{&i.Ptr}
+	case *PtrDiff:
+		return []*Value{&i.Lhs, &i.Rhs}
+	case *Branch:
+		return []*Value{&i.Cond}
+	case *Switch:
+		return []*Value{&i.Value}
+	case *Call:
+		values := make([]*Value, len(i.Args))
+		for j := range i.Args {
+			values[j] = &i.Args[j]
+		}
+		return values
+	case *Return:
+		return []*Value{&i.Value}
+	case *Phi:
+		values := make([]*Value, len(i.Args))
+		for j := range i.Args {
+			values[j] = &i.Args[j].Value
+		}
+		return values
+	}
+	return nil
+}
+
+// Successors returns the indices of the instructions which may execute after
+// each instruction of a function.
+func Successors(f *Function) [][]int {
+	labels := make(map[*Label]int)
+	for i, instr := range f.Instrs {
+		if l, ok := instr.(*Label); ok {
+			labels[l] = i
+		}
+	}
+	successors := make([][]int, len(f.Instrs))
+	for i, instr := range f.Instrs {
+		switch n := instr.(type) {
+		case *Jump:
+			successors[i] = []int{labels[n.Target]}
+		case *Branch:
+			successors[i] = []int{labels[n.True], labels[n.False]}
+		case *Switch:
+			successors[i] = []int{labels[n.Default]}
+			for _, c := range n.Cases {
+				successors[i] = append(successors[i], labels[c.Target])
+			}
+		case *Return:
+		default:
+			if i+1 < len(f.Instrs) {
+				successors[i] = []int{i + 1}
+			}
+		}
+	}
+	return successors
+}
+
+// A set of temporaries.
+type TempSet map[*Temp]bool
+
+// The temporaries which are live before and after each instruction of a
+// function. A temporary is live if its current value may be used later.
+type Liveness struct {
+	In  []TempSet
+	Out []TempSet
+}
+
+// AnalyzeLiveness computes the live temporaries of a function.
+func AnalyzeLiveness(f *Function) *Liveness {
+	n := len(f.Instrs)
+	l := &Liveness{In: make([]TempSet, n), Out: make([]TempSet, n)}
+	for i := range f.Instrs {
+		l.In[i], l.Out[i] = TempSet{}, TempSet{}
+	}
+	successors := Successors(f)
+
+	// Iterate to a fixed point. Visiting the instructions in reverse order
+	// propagates uses backwards quickly.
+	for changed := true; changed; {
+		changed = false
+		for i := n - 1; i >= 0; i-- {
+			out := l.Out[i]
+			for _, s := range successors[i] {
+				for t := range l.In[s] {
+					if !out[t] {
+						out[t], changed = true, true
+					}
+				}
+			}
+			in := l.In[i]
+			def := Def(f.Instrs[i])
+			for t := range out {
+				if t != def && !in[t] {
+					in[t], changed = true, true
+				}
+			}
+			for _, t := range Uses(f.Instrs[i]) {
+				if !in[t] {
+					in[t], changed = true, true
+				}
+			}
+		}
+	}
+	return l
+}
+
+// The range of instructions over which a temporary must be preserved, in
+// positions: each instruction i reads its operands at position 2i, and writes
+// its result at position 2i+1. Two temporaries may share a location if their
+// intervals do not overlap.
+type Interval struct {
+	Temp       *Temp
+	Start, End int // Positions, inclusive.
+}
+
+// Intervals returns the live interval of each temporary which is assigned or
+// used by a function, ordered by start. A temporary's interval covers every
+// instruction which assigns it, and every instruction before which it is
+// live.
+func (l *Liveness) Intervals(f *Function) []*Interval {
+	intervals := make(map[*Temp]*Interval)
+	var ordered []*Interval
+	extend := func(t *Temp, position int) {
+		if v, ok := intervals[t]; ok {
+			v.End = position
+			return
+		}
+		v := &Interval{Temp: t, Start: position, End: position}
+		intervals[t] = v
+		ordered = append(ordered, v)
+	}
+	for i, instr := range f.Instrs {
+		// Visit temporaries in order of creation, so that the result is
+		// deterministic.
+		for _, t := range f.Temps {
+			if l.In[i][t] {
+				extend(t, 2*i)
+			}
+		}
+		if t := Def(instr); t != nil {
+			extend(t, 2*i+1)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,118 @@
+package ir
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefAndUses(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{}
+	a, b := f.NewTemp(types.Int), f.NewTemp(types.Int)
+	one := NewInt(1, types.Int)
+	assert.Equal(a, Def(&Binary{Op: Add, Dst: a, Lhs: b, Rhs: one}))
+	assert.Equal([]*Temp{b}, Uses(&Binary{Op: Add, Dst: a, Lhs: b, Rhs: one}))
+	assert.Equal([]*Temp{b, b}, Uses(&Binary{Op: Add, Dst: a, Lhs: b, Rhs: b}))
+	assert.Nil(Def(&Return{Value: a}))
+	assert.Equal([]*Temp{a}, Uses(&Return{Value: a}))
+	assert.Nil(Uses(&Return{Value: one}))
+	assert.Nil(Def(&Label{ID: 1}))
+	assert.Nil(Uses(&Jump{Target: &Label{ID: 1}}))
+	call := &Call{Dst: a, Function: "f", Args: []Value{b, one, a}}
+	assert.Equal(a, Def(call))
+	assert.Equal([]*Temp{b, a}, Uses(call))
+	sel := &Select{Dst: a, Cond: b, True: one, False: a}
+	assert.Equal(a, Def(sel))
+	assert.Equal([]*Temp{b, a}, Uses(sel))
+	s := &Switch{Value: b, Default: &Label{ID: 1}}
+	assert.Nil(Def(s))
+	assert.Equal([]*Temp{b}, Uses(s))
+	p, q := f.NewTemp(types.NewPointer(types.Int)), f.NewTemp(types.NewPointer(types.Int))
+	assert.Equal(p, Def(&Addr{Dst: p, Slot: f.NewSlot("x", types.Int)}))
+	assert.Nil(Uses(&Addr{Dst: p, Slot: f.NewSlot("y", types.Int)}))
+	assert.Equal(p, Def(&GlobalAddr{Dst: p, Global: &Global{Name: "g", Type: types.Int}}))
+	assert.Equal(a, Def(&Load{Dst: a, Addr: p}))
+	assert.Equal([]*Temp{p}, Uses(&Load{Dst: a, Addr: p}))
+	assert.Nil(Def(&Store{Addr: p, Src: b}))
+	assert.Equal([]*Temp{p, b}, Uses(&Store{Addr: p, Src: b}))
+	assert.Equal(q, Def(&PtrAdd{Dst: q, Ptr: p, Index: one}))
+	assert.Equal([]*Temp{p}, Uses(&PtrAdd{Dst: q, Ptr: p, Index: one}))
+	assert.Equal(a, Def(&PtrDiff{Dst: a, Lhs: p, Rhs: q}))
+	assert.Equal([]*Temp{p, q}, Uses(&PtrDiff{Dst: a, Lhs: p, Rhs: q}))
+	assert.Equal(q, Def(&FieldAddr{Dst: q, Ptr: p, Field: 1}))
+	assert.Equal([]*Temp{p}, Uses(&FieldAddr{Dst: q, Ptr: p, Field: 1}))
+}
+
+// loop returns a function which counts a down to zero.
+//
+//	0: %a = 3
+//	1: L1:
+//	2: %a = sub %a, 1
+//	3: branch %a, L1, L2
+//	4: L2:
+//	5: return 0
+func loop() (*Function, *Temp) {
+	f := &Function{Name: "f", Result: types.Int}
+	a := f.NewVariable("a", types.Int)
+	l1, l2 := &Label{ID: 1}, &Label{ID: 2}
+	f.Emit(&Copy{Dst: a, Src: NewInt(3, types.Int)})
+	f.Emit(l1)
+	f.Emit(&Binary{Op: Sub, Dst: a, Lhs: a, Rhs: NewInt(1, types.Int)})
+	f.Emit(&Branch{Cond: a, True: l1, False: l2})
+	f.Emit(l2)
+	f.Emit(&Return{Value: NewInt(0, types.Int)})
+	return f, a
+}
+
+func TestSuccessors(t *testing.T) {
+	assert := assert.New(t)
+	f, _ := loop()
+	assert.Equal([][]int{{1}, {2}, {3}, {1, 4}, {5}, nil}, Successors(f))
+}
+
+func TestSuccessorsOfSwitch(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{Name: "f", Result: types.Int}
+	a := f.NewVariable("a", types.Int)
+	l1, l2 := &Label{ID: 1}, &Label{ID: 2}
+	f.Emit(&Switch{Value: a, Cases: []SwitchCase{{1, l1}, {2, l2}}, Default: l2})
+	f.Emit(l1)
+	f.Emit(l2)
+	f.Emit(&Return{Value: a})
+	assert.Equal([][]int{{2, 1, 2}, {2}, {3}, nil}, Successors(f))
+}
+
+func TestAnalyzeLiveness(t *testing.T) {
+	assert := assert.New(t)
+	f, a := loop()
+	l := AnalyzeLiveness(f)
+	for i, want := range []bool{false, true, true, true, false, false} {
+		assert.Equal(want, l.In[i][a], "in %d", i)
+	}
+	for i, want := range []bool{true, true, true, true, false, false} {
+		assert.Equal(want, l.Out[i][a], "out %d", i)
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{}
+	a, b, c := f.NewTemp(types.Int), f.NewTemp(types.Int), f.NewTemp(types.Int)
+	f.Emit(&Copy{Dst: a, Src: NewInt(1, types.Int)})
+	f.Emit(&Copy{Dst: b, Src: a})
+	f.Emit(&Copy{Dst: c, Src: NewInt(2, types.Int)}) // c is never used.
+	f.Emit(&Return{Value: b})
+	assert.Equal([]*Interval{
+		{Temp: a, Start: 1, End: 2},
+		{Temp: b, Start: 3, End: 6},
+		{Temp: c, Start: 5, End: 5},
+	}, AnalyzeLiveness(f).Intervals(f))
+}
+
+func TestIntervalsCoverLoops(t *testing.T) {
+	assert := assert.New(t)
+	f, a := loop()
+	assert.Equal([]*Interval{{Temp: a, Start: 1, End: 6}},
+		AnalyzeLiveness(f).Intervals(f))
+}
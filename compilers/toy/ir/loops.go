@@ -0,0 +1,71 @@
+package ir
+
+import (
+	"sort"
+)
+
+// A natural loop of a control-flow graph: a header, which dominates the
+// loop, and the blocks from which the header may be reached again without
+// leaving through it, along back edges from its latches.
+type Loop struct {
+	Header *Block
+	// The blocks of the loop, including the header, in the order of the
+	// graph.
+	Blocks  []*Block
+	Latches []*Block // The blocks of the loop which jump to the header.
+	blocks  map[*Block]bool
+}
+
+// Contains returns whether a block is in a loop.
+func (l *Loop) Contains(b *Block) bool {
+	return l.blocks[b]
+}
+
+// Loops returns the natural loops of the graph of a dominator tree: one for
+// each block which is the target of a back edge, from a block which it
+// dominates, whose blocks are those of the back edges to it. Each loop comes
+// before the loops which contain it.
+func (d *DomTree) Loops() []*Loop {
+	var loops []*Loop
+	for _, h := range d.cfg.Blocks {
+		if !d.reachable(h) {
+			continue
+		}
+		l := &Loop{Header: h, blocks: map[*Block]bool{h: true}}
+		var work []*Block
+		for _, p := range h.Preds {
+			if d.reachable(p) && d.Dominates(h, p) {
+				l.Latches = append(l.Latches, p)
+				if !l.blocks[p] {
+					l.blocks[p] = true
+					work = append(work, p)
+				}
+			}
+		}
+		if len(l.Latches) == 0 {
+			continue
+		}
+		// Walk back from the latches to the header.
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, p := range b.Preds {
+				if d.reachable(p) && !l.blocks[p] {
+					l.blocks[p] = true
+					work = append(work, p)
+				}
+			}
+		}
+		for _, b := range d.cfg.Blocks {
+			if l.blocks[b] {
+				l.Blocks = append(l.Blocks, b)
+			}
+		}
+		loops = append(loops, l)
+	}
+	// A loop which contains another has more blocks than it.
+	sort.SliceStable(loops, func(i, j int) bool {
+		return len(loops[i].Blocks) < len(loops[j].Blocks)
+	})
+	return loops
+}
@@ -0,0 +1,47 @@
+package ir
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoops(t *testing.T) {
+	assert := assert.New(t)
+	g := NewCFG(lowerProgram(t, loopWithIf).Functions[0])
+	loops := g.Dominators().Loops()
+	if assert.Equal(1, len(loops)) {
+		l := loops[0]
+		assert.Equal("L1", l.Header.Name())
+		assert.Equal([]string{"L1", "L2", "L4", "L6", "L5"}, names(l.Blocks))
+		assert.Equal([]string{"L5"}, names(l.Latches))
+		assert.True(l.Contains(g.Blocks[3]))
+		assert.False(l.Contains(g.Blocks[0]))
+		assert.False(l.Contains(g.Blocks[6]))
+	}
+}
+
+func TestNestedLoops(t *testing.T) {
+	assert := assert.New(t)
+	g := NewCFG(lowerProgram(t, `int f(int n) {
+  int s = 0;
+  for (int i = 0; i < n; i = i + 1) {
+    for (int j = 0; j < i; j = j + 1)
+      s = s + j;
+    do
+      s = s - 1;
+    while (s > 100);
+  }
+  return s;
+}`).Functions[0])
+	loops := g.Dominators().Loops()
+	if assert.Equal(3, len(loops)) {
+		// The inner loops come first.
+		assert.Equal([]string{"L9", "L10"}, names(loops[0].Blocks))
+		assert.Equal([]string{"L5", "L6", "L7"}, names(loops[1].Blocks))
+		outer := loops[2]
+		for _, b := range append(loops[0].Blocks, loops[1].Blocks...) {
+			assert.True(outer.Contains(b), b.Name())
+		}
+		assert.False(loops[0].Contains(loops[1].Header))
+	}
+}
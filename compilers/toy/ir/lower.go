@@ -0,0 +1,791 @@
+package ir
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"math"
+)
+
+type lowerer struct {
+	program   *Program
+	function  *Function
+	globals   map[*ast.Symbol]*Global // The global variables of the program.
+	strings   map[string]*Global      // The global of each string literal.
+	variables map[*ast.Symbol]*Temp   // The temporary of each local variable.
+	// The slot of each local variable which must be in memory, because it is
+	// an array or struct, or its address is taken. These are not in variables.
+	slots map[*ast.Symbol]*Slot
+	// The labels which the break and continue statements of each loop and
+	// switch jump to.
+	targets map[ast.Statement]jumpTargets
+	cases   map[*ast.CaseStatement]*Label // The label of each case.
+	// The label of each labelled statement, created when it or a goto which
+	// jumps to it is first reached.
+	labels map[*ast.LabeledStatement]*Label
+	// The position of the statement being lowered, at which instructions are
+	// emitted.
+	pos token.Position
+	err error
+}
+
+// The labels which break and continue statements jump to.
+type jumpTargets struct {
+	breakTo, continueTo *Label
+}
+
+// Lower translates a program to the intermediate representation. The program
+// must have been checked by semantic analysis. Prototypes are omitted, since
+// calls refer to functions by name, and a global variable which is declared
+// more than once is lowered from its definition.
+func Lower(program *ast.Program) (*Program, error) {
+	l := &lowerer{program: &Program{}, globals: make(map[*ast.Symbol]*Global),
+		strings: make(map[string]*Global)}
+	for _, g := range program.Globals {
+		l.lowerGlobal(g)
+	}
+	for _, f := range program.Functions {
+		if !f.Prototype {
+			l.lowerFunction(f)
+		}
+	}
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.program, nil
+}
+
+// errorf records an error for a node which cannot be lowered.
+func (l *lowerer) errorf(node ast.Node, format string, args ...interface{}) {
+	if l.err == nil {
+		l.err = &Error{Pos: node.Pos(), Msg: fmt.Sprintf(format, args...)}
+	}
+}
+
+func (l *lowerer) emit(instr Instr) {
+	l.function.EmitAt(instr, l.pos)
+}
+
+// lowerGlobal translates a global variable, whose initializer is the constant
+// computed by semantic analysis. A variable which is not defined by the
+// program is extern.
+func (l *lowerer) lowerGlobal(d *ast.VariableDeclaration) {
+	if d.Symbol == nil {
+		l.errorf(d, "unresolved declaration of '%s'", d.Name.Value)
+		return
+	}
+	// Only the symbol's declaration is lowered, which is its definition if
+	// it has one.
+	if d.Symbol.Decl != d {
+		return
+	}
+	g := &Global{Name: d.Name.Value, Type: d.Symbol.Type,
+		Extern: !d.IsDefinition(), Static: d.Symbol.Static}
+	// -0.0 is not zero-initialized, since its sign bit is set.
+	switch {
+	case d.Init == nil:
+	case types.IsFloating(g.Type) && (d.Constant != 0 || math.Signbit(d.Constant)):
+		g.Init = NewFloat(d.Constant, g.Type)
+	case !types.IsFloating(g.Type) && d.IntConstant != 0:
+		g.Init = NewInt(d.IntConstant, g.Type)
+	}
+	l.globals[d.Symbol] = g
+	l.program.Globals = append(l.program.Globals, g)
+}
+
+// stringLiteral returns the global which holds the characters of a string
+// literal, creating it on first use. Identical literals share a global, which
+// is read-only.
+func (l *lowerer) stringLiteral(s *ast.StringLiteral) *Global {
+	if g, ok := l.strings[s.Value]; ok {
+		return g
+	}
+	g := &Global{Name: fmt.Sprintf("str.%d", len(l.program.Strings)),
+		Type: s.Type, Data: s.Value + "\x00"}
+	l.strings[s.Value] = g
+	l.program.Strings = append(l.program.Strings, g)
+	return g
+}
+
+func (l *lowerer) lowerFunction(f *ast.Function) {
+	if f.Symbol == nil {
+		l.errorf(f, "unresolved function '%s'", f.Name.Value)
+		return
+	}
+	l.function = &Function{
+		Name:   f.Name.Value,
+		Pos:    f.Pos(),
+		Result: f.Symbol.Type.(*types.Function).Result,
+		Static: f.Symbol.Static,
+	}
+	l.pos = f.Pos()
+	l.variables = make(map[*ast.Symbol]*Temp)
+	l.slots = make(map[*ast.Symbol]*Slot)
+	l.targets = make(map[ast.Statement]jumpTargets)
+	l.cases = make(map[*ast.CaseStatement]*Label)
+	l.labels = make(map[*ast.LabeledStatement]*Label)
+	for _, p := range f.Params {
+		if p.Symbol == nil {
+			l.errorf(p, "unresolved parameter '%s'", p.Name.Value)
+			continue
+		}
+		v := l.function.NewVariable(p.Name.Value, p.Symbol.Type)
+		l.function.Params = append(l.function.Params, v)
+		if !p.Symbol.AddressTaken {
+			l.variables[p.Symbol] = v
+			continue
+		}
+		// A parameter whose address is taken is copied to memory on entry.
+		l.slots[p.Symbol] = l.function.NewSlot(p.Name.Value, p.Symbol.Type)
+		l.slots[p.Symbol].Param = v
+		l.store(l.symbolLocation(p.Symbol), v)
+	}
+	for _, s := range f.Body {
+		l.statement(s)
+	}
+	// Falling off the end of a function returns zero.
+	if !terminated(l.function) {
+		l.emit(&Return{Value: Zero(l.function.Result)})
+	}
+	l.program.Functions = append(l.program.Functions, l.function)
+}
+
+// terminated returns whether the last instruction of a function is a return
+// or a jump, which control cannot fall through.
+func terminated(f *Function) bool {
+	if len(f.Instrs) == 0 {
+		return false
+	}
+	switch f.Instrs[len(f.Instrs)-1].(type) {
+	case *Return, *Jump:
+		return true
+	}
+	return false
+}
+
+func (l *lowerer) statement(s ast.Statement) {
+	// The instructions of a statement are at its position, except for those
+	// of the statements within it, after which its position is restored.
+	defer func(pos token.Position) { l.pos = pos }(l.pos)
+	if _, ok := s.(*ast.Block); !ok {
+		l.pos = s.Pos()
+	}
+	switch n := s.(type) {
+	case *ast.ReturnStatement:
+		l.emit(&Return{Value: l.expression(n.Value)})
+	case *ast.ExpressionStatement:
+		l.expression(n.Expression)
+	case *ast.VariableDeclaration:
+		if n.Symbol == nil {
+			l.errorf(n, "unresolved declaration of '%s'", n.Name.Value)
+			return
+		}
+		if n.Symbol.AddressTaken || types.IsArray(n.Symbol.Type) ||
+			types.IsStruct(n.Symbol.Type) {
+			l.slots[n.Symbol] = l.function.NewSlot(n.Name.Value, n.Symbol.Type)
+		} else {
+			l.variables[n.Symbol] = l.function.NewVariable(n.Name.Value, n.Symbol.Type)
+		}
+		if n.Init != nil {
+			loc := l.symbolLocation(n.Symbol)
+			l.store(loc, l.expression(n.Init))
+		}
+	case *ast.Block:
+		for _, s := range n.Statements {
+			l.statement(s)
+		}
+	case *ast.IfStatement:
+		l.ifStatement(n)
+	case *ast.WhileStatement:
+		cond, body, end := l.program.NewLabel(), l.program.NewLabel(), l.program.NewLabel()
+		l.emit(cond)
+		l.branch(n.Cond, body, end)
+		l.emit(body)
+		l.loopBody(n, n.Body, end, cond)
+		l.jump(cond)
+		l.emit(end)
+	case *ast.DoWhileStatement:
+		body, cond, end := l.program.NewLabel(), l.program.NewLabel(), l.program.NewLabel()
+		l.emit(body)
+		l.loopBody(n, n.Body, end, cond)
+		l.emit(cond)
+		l.branch(n.Cond, body, end)
+		l.emit(end)
+	case *ast.ForStatement:
+		if n.Init != nil {
+			l.statement(n.Init)
+		}
+		cond, body := l.program.NewLabel(), l.program.NewLabel()
+		post, end := l.program.NewLabel(), l.program.NewLabel()
+		l.emit(cond)
+		if n.Cond != nil {
+			l.branch(n.Cond, body, end)
+		}
+		l.emit(body)
+		l.loopBody(n, n.Body, end, post)
+		l.emit(post)
+		if n.Post != nil {
+			l.expression(n.Post)
+		}
+		l.jump(cond)
+		l.emit(end)
+	case *ast.SwitchStatement:
+		l.switchStatement(n)
+	case *ast.CaseStatement:
+		l.emit(l.cases[n])
+		l.statement(n.Body)
+	case *ast.LabeledStatement:
+		l.emit(l.label(n))
+		l.statement(n.Body)
+	case *ast.GotoStatement:
+		if n.Target == nil {
+			l.errorf(n, "unresolved label '%s'", n.Label.Value)
+			return
+		}
+		l.emit(&Jump{Target: l.label(n.Target)})
+	case *ast.BreakStatement:
+		l.emit(&Jump{Target: l.targets[n.Target].breakTo})
+	case *ast.ContinueStatement:
+		l.emit(&Jump{Target: l.targets[n.Target].continueTo})
+	default:
+		l.errorf(s, "unsupported statement %v", s)
+	}
+}
+
+// label returns the label of a labelled statement.
+func (l *lowerer) label(s *ast.LabeledStatement) *Label {
+	label := l.labels[s]
+	if label == nil {
+		label = l.program.NewLabel()
+		l.labels[s] = label
+	}
+	return label
+}
+
+// ifStatement lowers an if statement to a branch over its then branch, and
+// its else branch, if it has one.
+func (l *lowerer) ifStatement(s *ast.IfStatement) {
+	then, end := l.program.NewLabel(), l.program.NewLabel()
+	if s.Else == nil {
+		l.branch(s.Cond, then, end)
+		l.emit(then)
+		l.statement(s.Then)
+		l.emit(end)
+		return
+	}
+	els := l.program.NewLabel()
+	l.branch(s.Cond, then, els)
+	l.emit(then)
+	l.statement(s.Then)
+	l.jump(end)
+	l.emit(els)
+	l.statement(s.Else)
+	l.emit(end)
+}
+
+// loopBody lowers the body of a loop, whose break and continue statements
+// jump to the given labels.
+func (l *lowerer) loopBody(loop, body ast.Statement, breakTo, continueTo *Label) {
+	l.targets[loop] = jumpTargets{breakTo: breakTo, continueTo: continueTo}
+	l.statement(body)
+}
+
+// switchStatement lowers a switch to a Switch instruction, which jumps to the
+// label of one of the cases in its body, or past the body if no case matches
+// and there is no default.
+func (l *lowerer) switchStatement(s *ast.SwitchStatement) {
+	value := l.expression(s.Value)
+	end := l.program.NewLabel()
+	dispatch := &Switch{Value: value, Default: end}
+	for _, c := range s.Cases {
+		label := l.program.NewLabel()
+		l.cases[c] = label
+		if c.Value == nil {
+			dispatch.Default = label
+		} else {
+			dispatch.Cases = append(dispatch.Cases,
+				SwitchCase{Value: c.Constant, Target: label})
+		}
+	}
+	l.emit(dispatch)
+	l.targets[s] = jumpTargets{breakTo: end}
+	l.statement(s.Body)
+	l.emit(end)
+}
+
+// jump emits a jump to a label, unless control cannot reach it.
+func (l *lowerer) jump(target *Label) {
+	if !terminated(l.function) {
+		l.emit(&Jump{Target: target})
+	}
+}
+
+// The operator of each binary operator token, other than the logical
+// operators, which are lowered to branches.
+var binaryOps = map[token.TokenType]Op{
+	token.AdditionToken:           Add,
+	token.NegationToken:           Sub,
+	token.MultiplicationToken:     Mul,
+	token.DivisionToken:           Div,
+	token.ModuloToken:             Rem,
+	token.BitwiseAndToken:         And,
+	token.BitwiseOrToken:          Or,
+	token.BitwiseXorToken:         Xor,
+	token.ShiftLeftToken:          Shl,
+	token.ShiftRightToken:         Shr,
+	token.EqualToken:              Eq,
+	token.NotEqualToken:           Ne,
+	token.LessThanToken:           Lt,
+	token.LessThanOrEqualToken:    Le,
+	token.GreaterThanToken:        Gt,
+	token.GreaterThanOrEqualToken: Ge,
+}
+
+// The operator of each compound assignment token.
+var compoundOps = map[token.TokenType]Op{
+	token.AdditionAssignmentToken:       Add,
+	token.SubtractionAssignmentToken:    Sub,
+	token.MultiplicationAssignmentToken: Mul,
+	token.DivisionAssignmentToken:       Div,
+	token.ModuloAssignmentToken:         Rem,
+	token.ShiftLeftAssignmentToken:      Shl,
+	token.ShiftRightAssignmentToken:     Shr,
+	token.BitwiseAndAssignmentToken:     And,
+	token.BitwiseOrAssignmentToken:      Or,
+	token.BitwiseXorAssignmentToken:     Xor,
+}
+
+// expression emits the instructions which evaluate an expression, and returns
+// the value of the result.
+func (l *lowerer) expression(e ast.Expression) Value {
+	t := ast.TypeOf(e)
+	if t == nil {
+		l.errorf(e, "expression %v has no type", e)
+		return NewInt(0, types.Int)
+	}
+	switch n := e.(type) {
+	case *ast.IntLiteral:
+		return NewInt(n.Value, t)
+	case *ast.Sizeof:
+		// The size is known, so the operand is not evaluated.
+		return NewInt(n.Value, t)
+	case *ast.FloatLiteral:
+		return NewFloat(n.Value, t)
+	case *ast.Identifier:
+		if n.Symbol.Kind == ast.EnumeratorSymbol {
+			return NewInt(n.Symbol.Value, t)
+		}
+		return l.load(l.location(n))
+	case *ast.Subscript, *ast.Member:
+		return l.load(l.location(n))
+	case *ast.Assignment:
+		loc := l.location(n.Lhs)
+		v := l.expression(n.Rhs)
+		l.store(loc, v)
+		if loc.temp != nil {
+			return loc.temp
+		}
+		return v
+	case *ast.CompoundAssignment:
+		return l.compoundAssignment(n)
+	case *ast.IncDecOp:
+		return l.incDecOp(n)
+	case *ast.ConditionalExpression:
+		return l.conditional(n)
+	case *ast.Call:
+		// Arguments are evaluated from left to right.
+		args := make([]Value, len(n.Args))
+		for i, a := range n.Args {
+			args[i] = l.expression(a)
+		}
+		dst := l.function.NewTemp(t)
+		f := n.Function.Type.(*types.Function)
+		l.emit(&Call{Dst: dst, Function: n.Function.Token.Value, Args: args,
+			Variadic: f.Variadic, Fixed: len(f.Params)})
+		return dst
+	case *ast.Conversion:
+		if types.IsArray(ast.TypeOf(n.Operand)) {
+			return l.decay(n.Operand, t)
+		}
+		src := l.expression(n.Operand)
+		if src.Type() == t {
+			// A cast may convert a value to its own type.
+			return src
+		}
+		if c, ok := src.(*IntConst); ok && c.Value == 0 && types.IsPointer(t) {
+			// The int constant zero converted to a pointer is the null
+			// pointer.
+			return NewInt(0, t)
+		}
+		dst := l.function.NewTemp(t)
+		l.emit(&Convert{Dst: dst, Src: src})
+		return dst
+	case *ast.UnaryOp:
+		switch n.Operator.Type {
+		case token.MultiplicationToken:
+			return l.load(l.location(n))
+		case token.BitwiseAndToken:
+			loc := l.location(n.Operand)
+			if loc.addr == nil {
+				l.errorf(n, "cannot take the address of %v", n.Operand)
+				return Zero(t)
+			}
+			return loc.addr
+		}
+		src := l.expression(n.Operand)
+		dst := l.function.NewTemp(t)
+		switch n.Operator.Type {
+		case token.NegationToken:
+			l.emit(&Unary{Op: Neg, Dst: dst, Src: src})
+		case token.BitwiseComplementToken:
+			l.emit(&Unary{Op: Not, Dst: dst, Src: src})
+		case token.LogicalNegationToken:
+			l.emit(&Binary{Op: Eq, Dst: dst, Lhs: src, Rhs: Zero(src.Type())})
+		default:
+			l.errorf(n, "unsupported unary operator %v", n.Operator)
+		}
+		return dst
+	case *ast.BinaryOp:
+		switch n.Operator.Type {
+		case token.AndToken, token.OrToken:
+			return l.logicalOp(n)
+		}
+		op, ok := binaryOps[n.Operator.Type]
+		if !ok {
+			l.errorf(n, "unsupported binary operator %v", n.Operator)
+			return Zero(t)
+		}
+		lhs := l.expression(n.Lhs)
+		rhs := l.expression(n.Rhs)
+		dst := l.function.NewTemp(t)
+		switch {
+		case op.IsComparison():
+		case types.IsPointer(lhs.Type()) && types.IsPointer(rhs.Type()):
+			l.emit(&PtrDiff{Dst: dst, Lhs: lhs, Rhs: rhs})
+			return dst
+		case types.IsPointer(lhs.Type()):
+			l.offset(dst, lhs, rhs, op == Sub)
+			return dst
+		case types.IsPointer(rhs.Type()):
+			l.offset(dst, rhs, lhs, false)
+			return dst
+		}
+		l.emit(&Binary{Op: op, Dst: dst, Lhs: lhs, Rhs: rhs})
+		return dst
+	}
+	l.errorf(e, "unsupported expression %v", e)
+	return Zero(t)
+}
+
+// compoundAssignment lowers a compound assignment, computing the operator in
+// the type of its operands, and returns the new value of the variable.
+func (l *lowerer) compoundAssignment(a *ast.CompoundAssignment) Value {
+	op, ok := compoundOps[a.Operator.Type]
+	if !ok {
+		l.errorf(a, "unsupported assignment operator %v", a.Operator)
+		return Zero(a.Type)
+	}
+	loc := l.location(a.Lhs)
+	rhs := l.expression(a.Rhs)
+	v := l.load(loc)
+	dst := l.target(loc)
+	switch {
+	case types.IsPointer(v.Type()):
+		l.offset(dst, v, rhs, op == Sub)
+	case a.OperandType == v.Type():
+		l.emit(&Binary{Op: op, Dst: dst, Lhs: v, Rhs: rhs})
+	default:
+		lhs := l.function.NewTemp(a.OperandType)
+		l.emit(&Convert{Dst: lhs, Src: v})
+		result := l.function.NewTemp(a.OperandType)
+		l.emit(&Binary{Op: op, Dst: result, Lhs: lhs, Rhs: rhs})
+		l.emit(&Convert{Dst: dst, Src: result})
+	}
+	l.store(loc, dst)
+	return dst
+}
+
+// incDecOp lowers an increment or decrement, and returns the new value of the
+// variable for a prefix operator, or a copy of its old value for a postfix
+// operator.
+func (l *lowerer) incDecOp(e *ast.IncDecOp) Value {
+	op := Add
+	if e.Operator.Type == token.DecrementToken {
+		op = Sub
+	}
+	loc := l.location(e.Operand)
+	v := l.load(loc)
+	old := v
+	if e.Postfix && loc.temp != nil {
+		// The variable's temporary is updated in place, so keep a copy.
+		c := l.function.NewTemp(v.Type())
+		l.emit(&Copy{Dst: c, Src: v})
+		old = c
+	}
+	dst := l.target(loc)
+	switch {
+	case types.IsPointer(v.Type()):
+		l.offset(dst, v, NewInt(1, types.Int), op == Sub)
+	case types.IsInteger(v.Type()) && types.Width(v.Type()) < 32:
+		// Like the operands of other arithmetic, a char or short is promoted
+		// to int.
+		wide := l.function.NewTemp(types.Int)
+		l.emit(&Convert{Dst: wide, Src: v})
+		result := l.function.NewTemp(types.Int)
+		l.emit(&Binary{Op: op, Dst: result, Lhs: wide, Rhs: One(types.Int)})
+		l.emit(&Convert{Dst: dst, Src: result})
+	default:
+		l.emit(&Binary{Op: op, Dst: dst, Lhs: v, Rhs: One(v.Type())})
+	}
+	l.store(loc, dst)
+	if e.Postfix {
+		return old
+	}
+	return dst
+}
+
+// offset emits the addition of an int index to a pointer, or its subtraction.
+func (l *lowerer) offset(dst *Temp, ptr, index Value, subtract bool) {
+	if subtract {
+		if c, ok := index.(*IntConst); ok {
+			index = NewInt(-c.Value, c.Type())
+		} else {
+			neg := l.function.NewTemp(index.Type())
+			l.emit(&Unary{Op: Neg, Dst: neg, Src: index})
+			index = neg
+		}
+	}
+	l.emit(&PtrAdd{Dst: dst, Ptr: ptr, Index: index})
+}
+
+// The location of an lvalue: the temporary of a variable, or else an address
+// in memory.
+type location struct {
+	temp *Temp
+	addr Value
+	typ  types.Type
+}
+
+// location emits the instructions which compute the location of an lvalue.
+func (l *lowerer) location(e ast.Expression) location {
+	t := ast.TypeOf(e)
+	switch n := e.(type) {
+	case *ast.Identifier:
+		_, inTemp := l.variables[n.Symbol]
+		_, inSlot := l.slots[n.Symbol]
+		_, global := l.globals[n.Symbol]
+		if !inTemp && !inSlot && !global {
+			l.errorf(n, "unresolved identifier '%s'", n.Token.Value)
+			break
+		}
+		return l.symbolLocation(n.Symbol)
+	case *ast.StringLiteral:
+		addr := l.function.NewTemp(types.NewPointer(t))
+		l.emit(&GlobalAddr{Dst: addr, Global: l.stringLiteral(n)})
+		return location{addr: addr, typ: t}
+	case *ast.UnaryOp:
+		if n.Operator.Type == token.MultiplicationToken {
+			return location{addr: l.expression(n.Operand), typ: t}
+		}
+	case *ast.Subscript:
+		// a[i] is *(a + i), where either operand may be the pointer.
+		ptr, index := l.expression(n.Array), l.expression(n.Index)
+		if !types.IsPointer(ptr.Type()) {
+			ptr, index = index, ptr
+		}
+		addr := l.function.NewTemp(ptr.Type())
+		l.offset(addr, ptr, index, false)
+		return location{addr: addr, typ: t}
+	case *ast.Member:
+		// s.f is (&s)->f.
+		var ptr Value
+		if n.Operator.Type == token.ArrowToken {
+			ptr = l.expression(n.X)
+		} else if ptr = l.location(n.X).addr; ptr == nil {
+			l.errorf(n.X, "struct %v is not in memory", n.X)
+			break
+		}
+		s := ptr.Type().(*types.Pointer).Elem.(*types.Struct)
+		i, _ := s.Field(n.Name.Value)
+		addr := l.function.NewTemp(types.NewPointer(t))
+		l.emit(&FieldAddr{Dst: addr, Ptr: ptr, Field: i})
+		return location{addr: addr, typ: t}
+	}
+	if t == nil {
+		t = types.Int
+	}
+	l.errorf(e, "cannot assign to %v", e)
+	return location{temp: l.function.NewTemp(t), typ: t}
+}
+
+// symbolLocation returns the location of a variable, emitting the
+// instruction which computes its address if it is in a slot or is global.
+func (l *lowerer) symbolLocation(s *ast.Symbol) location {
+	if v, ok := l.variables[s]; ok {
+		return location{temp: v, typ: v.Type()}
+	}
+	if g, ok := l.globals[s]; ok {
+		addr := l.function.NewTemp(types.NewPointer(g.Type))
+		l.emit(&GlobalAddr{Dst: addr, Global: g})
+		return location{addr: addr, typ: g.Type}
+	}
+	slot := l.slots[s]
+	addr := l.function.NewTemp(types.NewPointer(slot.Type))
+	l.emit(&Addr{Dst: addr, Slot: slot})
+	return location{addr: addr, typ: slot.Type}
+}
+
+// decay returns the address of the first element of an array, which is the
+// address of the array converted to a pointer of type t.
+func (l *lowerer) decay(array ast.Expression, t types.Type) Value {
+	loc := l.location(array)
+	if loc.addr == nil {
+		l.errorf(array, "array %v is not in memory", array)
+		return Zero(t)
+	}
+	dst := l.function.NewTemp(t)
+	l.emit(&Convert{Dst: dst, Src: loc.addr})
+	return dst
+}
+
+// load returns the value at a location.
+func (l *lowerer) load(loc location) Value {
+	if loc.temp != nil {
+		return loc.temp
+	}
+	dst := l.function.NewTemp(loc.typ)
+	l.emit(&Load{Dst: dst, Addr: loc.addr})
+	return dst
+}
+
+// target returns the temporary in which to compute a new value for a
+// location, which is the variable's own temporary if it has one.
+func (l *lowerer) target(loc location) *Temp {
+	if loc.temp != nil {
+		return loc.temp
+	}
+	return l.function.NewTemp(loc.typ)
+}
+
+// store assigns a value to a location.
+func (l *lowerer) store(loc location, v Value) {
+	switch {
+	case loc.temp == nil:
+		l.emit(&Store{Addr: loc.addr, Src: v})
+	case loc.temp != v:
+		l.emit(&Copy{Dst: loc.temp, Src: v})
+	}
+}
+
+// condition evaluates an expression to an int which is non-zero if the
+// expression is, for use as the condition of a branch.
+func (l *lowerer) condition(e ast.Expression) Value {
+	v := l.expression(e)
+	if v.Type() == types.Int {
+		return v
+	}
+	dst := l.function.NewTemp(types.Int)
+	l.emit(&Binary{Op: Ne, Dst: dst, Lhs: v, Rhs: Zero(v.Type())})
+	return dst
+}
+
+// branch emits a jump to ifTrue if an expression is non-zero, else to
+// ifFalse. Logical operators are lowered directly to jumps, so that their
+// operands short-circuit without computing the value of the operator.
+func (l *lowerer) branch(e ast.Expression, ifTrue, ifFalse *Label) {
+	switch n := e.(type) {
+	case *ast.BinaryOp:
+		switch n.Operator.Type {
+		case token.AndToken:
+			rhs := l.program.NewLabel()
+			l.branch(n.Lhs, rhs, ifFalse)
+			l.emit(rhs)
+			l.branch(n.Rhs, ifTrue, ifFalse)
+			return
+		case token.OrToken:
+			rhs := l.program.NewLabel()
+			l.branch(n.Lhs, ifTrue, rhs)
+			l.emit(rhs)
+			l.branch(n.Rhs, ifTrue, ifFalse)
+			return
+		}
+	case *ast.UnaryOp:
+		if n.Operator.Type == token.LogicalNegationToken {
+			l.branch(n.Operand, ifFalse, ifTrue)
+			return
+		}
+	}
+	l.emit(&Branch{Cond: l.condition(e), True: ifTrue, False: ifFalse})
+}
+
+// logicalOp lowers a short-circuiting && or || to branches. The result is 0
+// or 1.
+func (l *lowerer) logicalOp(b *ast.BinaryOp) Value {
+	lhs := l.condition(b.Lhs)
+	result := l.function.NewTemp(types.Int)
+	rhs, end := l.program.NewLabel(), l.program.NewLabel()
+	if b.Operator.Type == token.AndToken {
+		// If the left operand is false, so is the result.
+		l.emit(&Copy{Dst: result, Src: NewInt(0, types.Int)})
+		l.emit(&Branch{Cond: lhs, True: rhs, False: end})
+	} else {
+		// If the left operand is true, so is the result.
+		l.emit(&Copy{Dst: result, Src: NewInt(1, types.Int)})
+		l.emit(&Branch{Cond: lhs, True: end, False: rhs})
+	}
+	l.emit(rhs)
+	v := l.expression(b.Rhs)
+	l.emit(&Binary{Op: Ne, Dst: result, Lhs: v, Rhs: Zero(v.Type())})
+	l.emit(end)
+	return result
+}
+
+// conditional lowers a conditional expression. If both operands can safely be
+// evaluated regardless of the condition, they are, and the result is selected
+// without branching. Otherwise, the condition branches to the evaluation of
+// one operand.
+func (l *lowerer) conditional(c *ast.ConditionalExpression) Value {
+	t := ast.TypeOf(c)
+	if !types.IsFloating(t) && isPure(c.Then) && isPure(c.Else) {
+		cond := l.condition(c.Cond)
+		then := l.expression(c.Then)
+		els := l.expression(c.Else)
+		dst := l.function.NewTemp(t)
+		l.emit(&Select{Dst: dst, Cond: cond, True: then, False: els})
+		return dst
+	}
+	result := l.function.NewTemp(t)
+	then, els, end := l.program.NewLabel(), l.program.NewLabel(), l.program.NewLabel()
+	l.branch(c.Cond, then, els)
+	l.emit(then)
+	l.emit(&Copy{Dst: result, Src: l.expression(c.Then)})
+	l.emit(&Jump{Target: end})
+	l.emit(els)
+	l.emit(&Copy{Dst: result, Src: l.expression(c.Else)})
+	l.emit(end)
+	return result
+}
+
+// isPure returns whether evaluating an expression has no side effects and
+// cannot trap, so that it may be evaluated even if its value is not needed.
+func isPure(e ast.Expression) bool {
+	switch n := e.(type) {
+	case *ast.IntLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Identifier,
+		*ast.Sizeof:
+		return true
+	case *ast.UnaryOp:
+		// Dereferencing an invalid pointer traps.
+		return n.Operator.Type != token.MultiplicationToken && isPure(n.Operand)
+	case *ast.BinaryOp:
+		// Division traps on a zero divisor.
+		return n.Operator.Type != token.DivisionToken &&
+			n.Operator.Type != token.ModuloToken &&
+			isPure(n.Lhs) && isPure(n.Rhs)
+	case *ast.Conversion:
+		return isPure(n.Operand)
+	case *ast.ConditionalExpression:
+		return isPure(n.Cond) && isPure(n.Then) && isPure(n.Else)
+	}
+	return false
+}
@@ -0,0 +1,767 @@
+package ir
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// lower checks a program and returns the textual form of its intermediate
+// representation.
+func lower(t *testing.T, input string) string {
+	return Format(lowerProgram(t, input))
+}
+
+// lowerProgram checks a program and lowers it to the intermediate
+// representation.
+func lowerProgram(t *testing.T, input string) *Program {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	lowered, err := Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lowered
+}
+
+func TestLowerReturn(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	return 2
+}
+`, lower(t, "int main() { return 2; }"))
+}
+
+func TestLowerExpression(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	%0:int = mul 2, 3
+	%1:int = add 1, %0
+	%2:int = neg %1
+	%3:int = not %2
+	%4:int = eq %3, 0
+	return %4
+}
+`, lower(t, "int main() { return !~-(1 + 2 * 3); }"))
+}
+
+func TestLowerVariables(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	%a:int = 1
+	%a.1:int = 2
+	%a.1:int = 3
+	%b:int = %a
+	return %b
+}
+`, lower(t, "int main() { int a = 1; { int a = 2; a = 3; } int b; b = a; return b; }"))
+}
+
+func TestLowerAssignmentValue(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	%a:int = 1
+	%b:int = %a
+	return %b
+}
+`, lower(t, "int main() { int a; int b = a = 1; return b; }"))
+}
+
+func TestLowerLogicalAnd(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	%0:int = 0
+	branch 1, L1, L2
+L1:
+	%0:int = ne 2, 0
+L2:
+	return %0
+}
+`, lower(t, "int main() { return 1 && 2; }"))
+}
+
+func TestLowerLogicalOr(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	%0:int = 1
+	branch 1, L2, L1
+L1:
+	%0:int = ne 2, 0
+L2:
+	return %0
+}
+`, lower(t, "int main() { return 1 || 2; }"))
+}
+
+func TestLowerLogicalSideEffects(t *testing.T) {
+	assert := assert.New(t)
+	// The side effects of a right operand follow the branch which skips it.
+	assert.Equal(`func f(%a:int) int {
+	%2:int = 1
+	branch %a, L2, L1
+L1:
+	%3:int = call g()
+	%2:int = ne %3, 0
+L2:
+	%b:int = %2
+	branch %a, L5, L4
+L5:
+	%4:int = %a
+	%a:int = add %a, 1
+	branch %4, L3, L4
+L3:
+	%b:int = 2
+L4:
+	%5:int = 0
+	branch %b, L6, L7
+L6:
+	%a:int = 3
+	%5:int = ne %a, 0
+L7:
+	return %5
+}
+`, lower(t, "int g(); int f(int a) { int b = a || g(); if (a && a++) b = 2; return b && (a = 3); }"))
+}
+
+func TestLowerFloatingCondition(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	%0:int = ne 0.5f, 0f
+	%1:int = 0
+	branch %0, L1, L2
+L1:
+	%1:int = ne 2.5, 0
+L2:
+	return %1
+}
+`, lower(t, "int main() { return 0.5f && 2.5; }"))
+}
+
+func TestLowerIf(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f(%a:int) int {
+	branch %a, L1, L2
+L1:
+	%a:int = 2
+L2:
+	return %a
+}
+`, lower(t, "int f(int a) { if (a) a = 2; return a; }"))
+}
+
+func TestLowerIfElse(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f(%a:int) int {
+	branch %a, L1, L3
+L1:
+	%a:int = 2
+	jump L2
+L3:
+	%a:int = 3
+L2:
+	return %a
+}
+`, lower(t, "int f(int a) { if (a) a = 2; else a = 3; return a; }"))
+}
+
+func TestLowerIfElseReturns(t *testing.T) {
+	assert := assert.New(t)
+	// No jump follows a return.
+	assert.Equal(`func f(%a:int) int {
+	branch %a, L1, L3
+L1:
+	return 1
+L3:
+	return 2
+L2:
+	return 0
+}
+`, lower(t, "int f(int a) { if (a) return 1; else return 2; }"))
+}
+
+func TestLowerShortCircuitCondition(t *testing.T) {
+	assert := assert.New(t)
+	// Logical operators in a condition jump directly to the branches, without
+	// computing their value.
+	assert.Equal(`func f(%a:int, %b:double) int {
+	branch %a, L3, L2
+L3:
+	%2:int = ne %b, 0
+	branch %2, L1, L4
+L4:
+	%3:int = lt %a, 0
+	branch %3, L2, L1
+L1:
+	return 1
+L2:
+	return 0
+}
+`, lower(t, "int f(int a, double b) { if (a && (b || !(a < 0))) return 1; return 0; }"))
+}
+
+func TestLowerWhile(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f(%a:int) int {
+L1:
+	branch %a, L2, L3
+L2:
+	%1:int = sub %a, 1
+	%a:int = %1
+	jump L1
+L3:
+	return %a
+}
+`, lower(t, "int f(int a) { while (a) a = a - 1; return a; }"))
+}
+
+func TestLowerDoWhile(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f(%a:int) int {
+L1:
+	%1:int = sub %a, 1
+	%a:int = %1
+L2:
+	%2:int = gt %a, 0
+	branch %2, L1, L3
+L3:
+	return %a
+}
+`, lower(t, "int f(int a) { do a = a - 1; while (a > 0); return a; }"))
+}
+
+func TestLowerFor(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	%s:int = 0
+	%i:int = 0
+L1:
+	%2:int = lt %i, 3
+	branch %2, L2, L4
+L2:
+	%3:int = add %s, %i
+	%s:int = %3
+L3:
+	%4:int = add %i, 1
+	%i:int = %4
+	jump L1
+L4:
+	return %s
+}
+`, lower(t, "int main() { int s = 0; for (int i = 0; i < 3; i = i + 1) s = s + i; return s; }"))
+}
+
+func TestLowerBreakAndContinue(t *testing.T) {
+	assert := assert.New(t)
+	// Continue jumps to the condition of a while loop, and to the post
+	// expression of a for loop.
+	assert.Equal(`func f(%a:int) int {
+L1:
+L2:
+	branch %a, L5, L6
+L5:
+	jump L3
+L6:
+	jump L4
+L3:
+	%1:int = sub %a, 1
+	%a:int = %1
+	jump L1
+L4:
+L7:
+	branch %a, L8, L9
+L8:
+	branch %a, L10, L11
+L10:
+	jump L9
+L11:
+	jump L7
+L9:
+	return %a
+}
+`, lower(t, `int f(int a) {
+  for (;; a = a - 1) { if (a) continue; break; }
+  while (a) { if (a) break; }
+  return a;
+}`))
+}
+
+func TestLowerGoto(t *testing.T) {
+	assert := assert.New(t)
+	// A goto jumps to the label of its target, which may come before or
+	// after it.
+	assert.Equal(`func f(%a:int) int {
+	jump L1
+L2:
+	%a:int = 1
+L1:
+	branch %a, L4, L3
+L3:
+	jump L2
+L4:
+	return %a
+}
+`, lower(t, `int f(int a) {
+  goto test;
+again:
+  a = 1;
+test:
+  if (!a) goto again;
+  return a;
+}`))
+}
+
+func TestLowerSwitch(t *testing.T) {
+	assert := assert.New(t)
+	// Cases fall through to the next, and break jumps to the end.
+	assert.Equal(`func f(%a:int) int {
+	switch %a, L4 [1: L2, 3: L3]
+L2:
+	%a:int = 2
+L3:
+	jump L1
+L4:
+	return 0
+L1:
+	return %a
+}
+`, lower(t, `int f(int a) {
+  switch (a) { case 1: a = 2; case 1 + 2: break; default: return 0; }
+  return a;
+}`))
+}
+
+func TestLowerSwitchWithoutDefault(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f(%a:int) int {
+	switch %a, L1 [2: L2]
+L2:
+	return 1
+L1:
+	return %a
+}
+`, lower(t, "int f(int a) { switch (a) case 2: return 1; return a; }"))
+}
+
+func TestLowerBitwiseOps(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f(%a:int, %b:int) int {
+	%2:int = shl %a, 2
+	%3:int = shr %b, %a
+	%4:int = and %2, %3
+	%5:int = xor %4, 1
+	%6:int = or %a, %5
+	return %6
+}
+`, lower(t, "int f(int a, int b) { return a | a << 2 & b >> a ^ 1; }"))
+}
+
+func TestLowerConditionalSelect(t *testing.T) {
+	assert := assert.New(t)
+	// Both operands are evaluated, and the result selected without branching.
+	assert.Equal(`func f(%a:int, %b:int) int {
+	%2:int = lt %a, %b
+	%3:int = neg %a
+	%4:int = select %2, %3, %b
+	return %4
+}
+`, lower(t, "int f(int a, int b) { return a < b ? -a : b; }"))
+}
+
+func TestLowerConditionalBranch(t *testing.T) {
+	assert := assert.New(t)
+	// An operand which may trap or have side effects is only evaluated if
+	// selected, as is any floating-point operand.
+	assert.Equal(`func f(%a:int, %d:double) double {
+	branch %a, L1, L2
+L1:
+	%3:int = div 1, %a
+	%2:int = %3
+	jump L3
+L2:
+	%2:int = 0
+L3:
+	%4:double = convert %2
+	branch %a, L4, L5
+L4:
+	%5:double = %d
+	jump L6
+L5:
+	%5:double = 0.5
+L6:
+	%6:double = add %4, %5
+	return %6
+}
+`, lower(t, "double f(int a, double d) { return (a ? 1 / a : 0) + (a ? d : 0.5); }"))
+}
+
+func TestLowerCompoundAssignment(t *testing.T) {
+	assert := assert.New(t)
+	// An operator computed in a wider type is converted back to the type of
+	// the variable.
+	assert.Equal(`func f(%a:int, %d:double) int {
+	%a:int = shl %a, 2
+	%2:double = convert %a
+	%3:double = mul %2, %d
+	%a:int = convert %3
+	%4:int = add 1, 2
+	%a:int = rem %a, %4
+	return %a
+}
+`, lower(t, "int f(int a, double d) { a <<= 2; a *= d; return a %= 1 + 2; }"))
+}
+
+func TestLowerIncDecOp(t *testing.T) {
+	assert := assert.New(t)
+	// A postfix operator evaluates to a copy of the old value.
+	assert.Equal(`func f(%a:int, %d:double) int {
+	%2:int = %a
+	%a:int = add %a, 1
+	%3:double = convert %2
+	%d:double = sub %d, 1
+	%4:double = add %3, %d
+	%5:int = convert %4
+	return %5
+}
+`, lower(t, "int f(int a, double d) { return a++ + --d; }"))
+}
+
+func TestLowerConversions(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f() float {
+	%0:double = convert 2
+	%1:double = add 1.5, %0
+	%2:float = convert %1
+	return %2
+}
+`, lower(t, "float f() { return 1.5 + 2; }"))
+}
+
+func TestLowerCalls(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f(%a:int, %b:double) double {
+	%2:double = convert %a
+	%3:double = add %2, %b
+	return %3
+}
+
+func main() int {
+	%0:double = convert 2
+	%1:double = call f(1, %0)
+	%2:int = call g()
+	%3:double = call f(%2, 0.5)
+	%4:double = add %1, %3
+	%5:int = convert %4
+	return %5
+}
+`, lower(t, `double f(int a, double b) { return a + b; }
+int g();
+int main() { return f(1, 2) + f(g(), 0.5); }`))
+}
+
+func TestLowerImplicitReturn(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f() double {
+	return 0
+}
+
+func main() int {
+	%a:int = 1
+	return 0
+}
+`, lower(t, "double f() { } int main() { int a = 1; }"))
+}
+
+func TestLowerUnresolvedIdentifier(t *testing.T) {
+	assert := assert.New(t)
+	// Without semantic analysis, functions have no symbols.
+	program, err := parser.Parse(lexer.NewLexerTokenStream(
+		lexer.Lex("int main() { return a; }")))
+	assert.Nil(err)
+	_, err = Lower(program)
+	assert.EqualError(err, "1:1: unresolved function 'main'")
+}
+
+func TestLowerAddressTaken(t *testing.T) {
+	assert := assert.New(t)
+	// A variable whose address is taken is kept in a slot, as is a parameter,
+	// which is stored on entry.
+	assert.Equal(`func f(%a:int) int {
+	slot $a.1:int
+	slot $b:int
+	%1:int * = addr $a.1
+	store %1, %a
+	%2:int * = addr $b
+	store %2, 1
+	%4:int * = addr $b
+	%p:int * = %4
+	%5:int * = addr $a.1
+	%6:int * = addr $a.1
+	%7:int = load %6
+	%8:int * = addr $b
+	%9:int = load %8
+	%10:int = add %7, %9
+	store %5, %10
+	%11:int * = addr $a.1
+	%12:int = load %11
+	return %12
+}
+`, lower(t, "int f(int a) { int b = 1; int *p = &b; a = *&a + b; return a; }"))
+}
+
+func TestLowerDereference(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func f(%p:int *) int {
+	store %p, 1
+	%1:int = load %p
+	%2:int = add %1, 2
+	store %p, %2
+	%3:int = load %p
+	%4:int = add %3, 1
+	store %p, %4
+	%5:int = load %p
+	return %5
+}
+`, lower(t, "int f(int *p) { *p = 1; *p += 2; (*p)++; return *p; }"))
+}
+
+func TestLowerPointerArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	// Subtracting an int adds its negation, and pointers are compared, and
+	// tested as conditions, like ints.
+	assert.Equal(`func f(%p:int *, %i:int) int {
+	%3:int * = ptradd %p, %i
+	%q:int * = %3
+	%4:int * = ptradd %q, 1
+	%5:int * = ptradd %4, -2
+	%q:int * = %5
+	%6:int = neg %i
+	%q:int * = ptradd %q, %6
+	%7:int * = %q
+	%q:int * = ptradd %q, 1
+	%8:int = ptrdiff %q, %p
+	%9:int = eq %q, %p
+	%10:int = add %8, %9
+	%11:int = lt %q, %p
+	%12:int = add %10, %11
+	%13:int = eq %q, 0
+	%14:int = add %12, %13
+	%15:int = ne %p, 0
+	%16:int = select %15, 1, 0
+	%17:int = add %14, %16
+	%18:int = ne %p, 0
+	%19:int = add %17, %18
+	return %19
+}
+`, lower(t, `int f(int *p, int i) {
+	int *q = p + i;
+	q = 1 + q - 2;
+	q -= i;
+	q++;
+	return q - p + (q == p) + (q < p) + !q + (p ? 1 : 0) + (p != 0);
+}`))
+}
+
+func TestLowerArrays(t *testing.T) {
+	assert := assert.New(t)
+	// An array is in a slot, and decays to the address of its first element.
+	// A subscript is the address of an element, offset from a pointer in
+	// either operand.
+	assert.Equal(`func f(%i:int) int {
+	slot $a:int [2][3]
+	%1:int (*)[2][3] = addr $a
+	%2:int (*)[3] = convert %1
+	%3:int (*)[3] = ptradd %2, %i
+	%4:int * = convert %3
+	%5:int * = ptradd %4, 2
+	store %5, 1
+	%6:int (*)[2][3] = addr $a
+	%7:int (*)[3] = convert %6
+	%8:int (*)[3] = ptradd %7, 1
+	%9:int * = convert %8
+	%10:int * = ptradd %9, %i
+	%11:int = load %10
+	return %11
+}
+`, lower(t, `int f(int i) {
+	int a[2][3];
+	a[i][2] = 1;
+	return i[a[1]];
+}`))
+}
+
+func TestLowerStructs(t *testing.T) {
+	assert := assert.New(t)
+	// A struct is in a slot, and a member access is the address of a field,
+	// offset from a pointer to the struct.
+	assert.Equal(`func f(%p:struct s *) int {
+	slot $a:struct s
+	%1:struct s * = addr $a
+	%2:int * = fieldaddr %1, y
+	store %2, 2
+	%3:struct s ** = fieldaddr %p, next
+	%4:struct s * = load %3
+	%5:int * = fieldaddr %4, x
+	%6:int = load %5
+	return %6
+}
+`, lower(t, `struct s { int x; int y; struct s *next; };
+int f(struct s *p) {
+	struct s a;
+	a.y = 2;
+	return p->next->x;
+}`))
+}
+
+func TestLowerGlobals(t *testing.T) {
+	assert := assert.New(t)
+	// A global is accessed through its address, and only has an initial value
+	// if it is not zero.
+	assert.Equal(`global @a:int = 3
+global @b:double
+global @c:int [2]
+global @d:float = -1.5f
+
+func f() int {
+	%0:int * = addr @a
+	%1:int = load %0
+	%2:int = add %1, 1
+	store %0, %2
+	%3:int (*)[2] = addr @c
+	%4:int * = convert %3
+	%5:int * = ptradd %4, 1
+	%6:int = load %5
+	return %6
+}
+`, lower(t, `int a = 3; double b = 0; int c[2]; float d = -1.5;
+int f() {
+	a++;
+	return c[1];
+}`))
+}
+
+func TestLowerLinkage(t *testing.T) {
+	assert := assert.New(t)
+	// A global which is declared more than once is lowered from its
+	// definition, if it has one, and is otherwise extern.
+	assert.Equal(`extern global @a:int
+static global @b:int = 2
+
+static func f() int {
+	%0:int * = addr @a
+	%1:int = load %0
+	%2:int * = addr @b
+	%3:int = load %2
+	%4:int = add %1, %3
+	return %4
+}
+`, lower(t, `extern int a; static int f(); static int b = 2; extern int b; extern int a;
+static int f() {
+	return a + b;
+}`))
+}
+
+func TestLowerStrings(t *testing.T) {
+	assert := assert.New(t)
+	// Identical string literals share a global, whose address is converted
+	// to a pointer to its first character.
+	assert.Equal(`string @str.0:char [3] = "hi"
+string @str.1:char [4] = "%c\n"
+
+func main() int {
+	%1:char (*)[3] = addr @str.0
+	%2:char * = convert %1
+	%3:char * = ptradd %2, 1
+	%4:char = load %3
+	%c:char = %4
+	%5:char (*)[4] = addr @str.1
+	%6:char * = convert %5
+	%7:int = convert %c
+	%8:int = call printf(%6, ..., %7)
+	%9:char (*)[3] = addr @str.0
+	%10:char * = convert %9
+	%11:int = call puts(%10)
+	return 0
+}
+`, lower(t, `int printf(char *format, ...);
+int puts(char *s);
+int main() {
+	char c = "hi"[1];
+	printf("%c\n", c);
+	puts("hi");
+	return 0;
+}`))
+}
+
+func TestLowerSizeof(t *testing.T) {
+	assert := assert.New(t)
+	// The operand is not evaluated.
+	assert.Equal(`func f(%a:int) int {
+	%1:int = add 4, %a
+	return %1
+}
+`, lower(t, "int f(int a) { return sizeof(a++) + a; }"))
+}
+
+func TestLowerEnumerators(t *testing.T) {
+	assert := assert.New(t)
+	// An enumerator is a constant.
+	assert.Equal(`func f(%a:int) int {
+	%1:int = add %a, 3
+	return %1
+}
+`, lower(t, "enum { A = 2, B }; int f(int a) { return a + B; }"))
+}
+
+func TestLowerCasts(t *testing.T) {
+	assert := assert.New(t)
+	// A cast to the type of its operand is not a conversion, and a cast of
+	// zero to a pointer is the null pointer.
+	assert.Equal(`func f(%x:int, %p:char *) int {
+	%2:char = convert %x
+	%3:int = convert %2
+	%4:int = add %3, %x
+	%5:int * = convert %p
+	%6:int = convert %5
+	%7:int = add %4, %6
+	%8:char * = convert 1
+	%9:int = eq %p, %8
+	%10:int = add %7, %9
+	%11:int = eq %p, 0
+	%12:int = add %10, %11
+	return %12
+}
+`, lower(t, "int f(int x, char *p) { return (char)x + (int)x + (int)(int *)p + (p == (char *)1) + (p == (char *)0); }"))
+}
+
+func TestLowerCharIncDecOp(t *testing.T) {
+	assert := assert.New(t)
+	// A char is promoted to int, and the result converted back.
+	assert.Equal(`func f(%c:char) char {
+	%1:int = convert %c
+	%2:int = add %1, 1
+	%c:char = convert %2
+	return %c
+}
+`, lower(t, "char f(char c) { return ++c; }"))
+}
+
+func TestLowerPositions(t *testing.T) {
+	assert := assert.New(t)
+	lowered := lowerProgram(t, "int main() {\n  int a = 2;\n  return a;\n}")
+	// Each instruction is at the statement which it was lowered from.
+	f := lowered.Functions[0]
+	assert.Equal(1, f.Pos.Line)
+	lines := []int{}
+	for i := range f.Instrs {
+		lines = append(lines, f.Position(i).Line)
+	}
+	assert.Equal([]int{2, 3}, lines)
+	assert.False(f.Position(len(f.Instrs)).IsValid())
+}
@@ -0,0 +1,51 @@
+package ir
+
+import (
+	"fmt"
+)
+
+// A NameGenerator names the labels of a program for a backend, numbering
+// those of each function in the order in which they are defined, so that the
+// names of the labels of one function do not depend on the others: a change
+// to a function renames only its own labels, and the output for the rest is
+// the same.
+type NameGenerator struct {
+	// Prefix precedes each name, such as ".L" for the labels which the
+	// assembler keeps out of the symbol table.
+	Prefix string
+	// Seed precedes the number of the first label of each function, which
+	// are numbered from one by default.
+	Seed int
+	// Local is whether the names need only be unique within a function, as
+	// in LLVM IR. Otherwise they include the name of the function, which is
+	// separated from the number by a dot, since that is not in identifiers.
+	Local bool
+	names map[*Label]string
+}
+
+// Function names the labels which a function defines.
+func (n *NameGenerator) Function(f *Function) {
+	if n.names == nil {
+		n.names = make(map[*Label]string)
+	}
+	next := n.Seed + 1
+	for _, instr := range f.Instrs {
+		if l, ok := instr.(*Label); ok {
+			if n.Local {
+				n.names[l] = fmt.Sprintf("%s%d", n.Prefix, next)
+			} else {
+				n.names[l] = fmt.Sprintf("%s%s.%d", n.Prefix, f.Name, next)
+			}
+			next++
+		}
+	}
+}
+
+// Name returns the name of a label of a function which has been named.
+func (n *NameGenerator) Name(l *Label) string {
+	name, ok := n.names[l]
+	if !ok {
+		panic(fmt.Sprintf("label %v is not defined by a named function", l))
+	}
+	return name
+}
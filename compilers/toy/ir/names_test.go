@@ -0,0 +1,36 @@
+package ir
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// labelNames returns the names which a generator gives the labels of the
+// functions of a program, in order.
+func labelNames(program *Program, n *NameGenerator) []string {
+	var names []string
+	for _, f := range program.Functions {
+		n.Function(f)
+		for _, instr := range f.Instrs {
+			if l, ok := instr.(*Label); ok {
+				names = append(names, n.Name(l))
+			}
+		}
+	}
+	return names
+}
+
+func TestNameGenerator(t *testing.T) {
+	assert := assert.New(t)
+	const g = "int g(int a) { while (a) a = a - 1; return a; }"
+	program := lowerProgram(t, "int f(int a) { if (a) return 1; return 2; } "+g)
+	assert.Equal([]string{".Lf.1", ".Lf.2", ".Lg.1", ".Lg.2", ".Lg.3"},
+		labelNames(program, &NameGenerator{Prefix: ".L"}))
+	assert.Equal([]string{"$L11", "$L12", "$L11", "$L12", "$L13"},
+		labelNames(program, &NameGenerator{Prefix: "$L", Seed: 10, Local: true}))
+
+	// The names of the labels of a function do not depend on the others.
+	program = lowerProgram(t, "int f(int a) { return a; } "+g)
+	assert.Equal([]string{".Lg.1", ".Lg.2", ".Lg.3"},
+		labelNames(program, &NameGenerator{Prefix: ".L"}))
+}
@@ -0,0 +1,88 @@
+package ir
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"io"
+	"strings"
+)
+
+// Print writes the textual form of a program to w. Its globals and strings
+// are listed before its functions. A global or function is preceded by
+// "extern" or "static" if it is either.
+func Print(w io.Writer, program *Program) error {
+	for _, g := range program.Globals {
+		init := ""
+		if g.Init != nil {
+			init = fmt.Sprintf(" = %v", g.Init)
+		}
+		if _, err := fmt.Fprintf(w, "%sglobal %v:%v%s\n", linkage(g.Extern, g.Static),
+			g, g.Type, init); err != nil {
+			return err
+		}
+	}
+	for _, s := range program.Strings {
+		// The terminating NUL is implied.
+		value := ast.Quote(strings.TrimSuffix(s.Data, "\x00"), '"')
+		if _, err := fmt.Fprintf(w, "string %v:%v = %s\n", s, s.Type, value); err != nil {
+			return err
+		}
+	}
+	for i, f := range program.Functions {
+		if i > 0 || len(program.Globals) > 0 || len(program.Strings) > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if err := PrintFunction(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintFunction writes the textual form of a function to w. Its stack slots
+// are listed before its instructions, which are indented, and labels are
+// not.
+func PrintFunction(w io.Writer, f *Function) error {
+	var b bytes.Buffer
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = def(p)
+	}
+	fmt.Fprintf(&b, "%sfunc %s(%s) %v {\n", linkage(false, f.Static), f.Name,
+		strings.Join(params, ", "), f.Result)
+	for _, s := range f.Slots {
+		fmt.Fprintf(&b, "\tslot %v:%v\n", s, s.Type)
+	}
+	for _, instr := range f.Instrs {
+		if l, ok := instr.(*Label); ok {
+			fmt.Fprintf(&b, "%v:\n", l)
+		} else {
+			fmt.Fprintf(&b, "\t%v\n", instr)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// linkage returns the prefix of a global or function which is extern or
+// static.
+func linkage(extern, static bool) string {
+	switch {
+	case extern:
+		return "extern "
+	case static:
+		return "static "
+	}
+	return ""
+}
+
+// Format returns the textual form of a program.
+func Format(program *Program) string {
+	var b bytes.Buffer
+	Print(&b, program)
+	return b.String()
+}
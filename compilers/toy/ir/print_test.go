@@ -0,0 +1,49 @@
+package ir
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+	p := &Program{}
+	f := &Function{Name: "f", Result: types.Int}
+	l := p.NewLabel()
+	f.Emit(&Jump{Target: l})
+	f.Emit(l)
+	f.Emit(&Return{Value: NewInt(0, types.Int)})
+	g := &Function{Name: "g", Result: types.Float}
+	g.Emit(&Return{Value: NewFloat(1, types.Float)})
+	p.Functions = []*Function{f, g}
+
+	assert.Equal(`func f() int {
+	jump L1
+L1:
+	return 0
+}
+
+func g() float {
+	return 1f
+}
+`, Format(p))
+}
+
+func TestFormatParameters(t *testing.T) {
+	assert := assert.New(t)
+	f := &Function{Name: "f", Result: types.Int}
+	a := f.NewVariable("a", types.Int)
+	b := f.NewVariable("b", types.Double)
+	f.Params = []*Temp{a, b}
+	f.Emit(&Return{Value: a})
+	assert.Equal(`func f(%a:int, %b:double) int {
+	return %a
+}
+`, Format(&Program{Functions: []*Function{f}}))
+}
+
+func TestFormatEmptyProgram(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", Format(&Program{}))
+}
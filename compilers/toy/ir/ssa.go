@@ -0,0 +1,409 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ToSSA converts a function to static single assignment form, in which each
+// temporary is assigned by one instruction, which dominates its uses. It uses
+// the algorithm of Cytron et al. ("Efficiently Computing Static Single
+// Assignment Form and the Control Dependence Graph", 1991): phis are inserted
+// at the iterated dominance frontiers of the blocks which assign each
+// temporary, and the temporaries are renamed in a walk of the dominator tree.
+//
+// The first assignment of a temporary in the walk keeps it, and the others
+// assign new versions of it. Only temporaries which are used in a block
+// before it assigns them are given phis, and phis whose results are unused
+// are removed. A use which no assignment reaches, of an uninitialized
+// variable, is of zero. Unreachable blocks are removed first, and if the
+// entry block is the target of jumps, a jump to it is added before it, so
+// that the entry has no predecessors.
+func ToSSA(f *Function) {
+	removeUnreachable(f)
+	if len(f.Instrs) == 0 {
+		return
+	}
+	if l, ok := f.Instrs[0].(*Label); ok && len(NewCFG(f).Blocks[0].Preds) > 0 {
+		out := &Function{}
+		out.EmitAt(&Jump{Target: l}, f.Position(0))
+		for i, instr := range f.Instrs {
+			out.EmitAt(instr, f.Position(i))
+		}
+		f.Instrs, f.Positions = out.Instrs, out.Positions
+	}
+	g := NewCFG(f)
+	dom := g.Dominators()
+	frontiers := dom.Frontiers()
+
+	// Find the blocks which assign each temporary, and the temporaries which
+	// are used in a block before it assigns them.
+	defs := make(map[*Temp][]*Block)
+	for _, p := range f.Params {
+		defs[p] = []*Block{g.Blocks[0]}
+	}
+	global := make(map[*Temp]bool)
+	for _, b := range g.Blocks {
+		assigned := make(map[*Temp]bool)
+		for _, instr := range b.Instrs {
+			for _, t := range Uses(instr) {
+				if !assigned[t] {
+					global[t] = true
+				}
+			}
+			if t := Def(instr); t != nil {
+				assigned[t] = true
+				if n := len(defs[t]); n == 0 || defs[t][n-1] != b {
+					defs[t] = append(defs[t], b)
+				}
+			}
+		}
+	}
+
+	phis := make([][]*Phi, len(g.Blocks))
+	variables := make(map[*Phi]*Temp)
+	for _, t := range f.Temps {
+		if !global[t] {
+			continue
+		}
+		work := append([]*Block{}, defs[t]...)
+		queued := make(map[*Block]bool)
+		for _, b := range work {
+			queued[b] = true
+		}
+		placed := make(map[*Block]bool)
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, y := range frontiers[b.Index] {
+				if placed[y] {
+					continue
+				}
+				placed[y] = true
+				phi := &Phi{Dst: t, Args: make([]PhiArg, len(y.Preds))}
+				for i, p := range y.Preds {
+					phi.Args[i].Pred = p.Label()
+				}
+				phis[y.Index] = append(phis[y.Index], phi)
+				variables[phi] = t
+				if !queued[y] {
+					queued[y] = true
+					work = append(work, y)
+				}
+			}
+		}
+	}
+
+	r := &renamer{f: f, stacks: make(map[*Temp][]Value), assigned: make(map[*Temp]bool)}
+	for _, p := range f.Params {
+		r.assigned[p] = true
+		r.stacks[p] = []Value{p}
+	}
+	var rename func(b *Block)
+	rename = func(b *Block) {
+		var defined []*Temp
+		for _, phi := range phis[b.Index] {
+			phi.Dst = r.define(variables[phi])
+			defined = append(defined, variables[phi])
+		}
+		for _, instr := range b.Instrs {
+			for _, v := range Operands(instr) {
+				if t, ok := (*v).(*Temp); ok {
+					*v = r.current(t)
+				}
+			}
+			if d := dst(instr); d != nil && *d != nil {
+				t := *d
+				*d = r.define(t)
+				defined = append(defined, t)
+			}
+		}
+		for _, s := range b.Succs {
+			for _, phi := range phis[s.Index] {
+				for i, p := range s.Preds {
+					if p == b {
+						phi.Args[i].Value = r.current(variables[phi])
+					}
+				}
+			}
+		}
+		for _, c := range dom.Children(b) {
+			rename(c)
+		}
+		for _, t := range defined {
+			r.stacks[t] = r.stacks[t][:len(r.stacks[t])-1]
+		}
+	}
+	rename(g.Blocks[0])
+
+	out := &Function{}
+	for _, b := range g.Blocks {
+		for i, instr := range b.Instrs {
+			if i == 0 {
+				if _, ok := instr.(*Label); ok {
+					out.EmitAt(instr, f.Position(b.Start))
+				}
+				for _, phi := range phis[b.Index] {
+					out.EmitAt(phi, f.Position(b.Start))
+				}
+				if _, ok := instr.(*Label); ok {
+					continue
+				}
+			}
+			out.EmitAt(instr, f.Position(b.Start+i))
+		}
+	}
+	f.Instrs, f.Positions = out.Instrs, out.Positions
+	removeDeadPhis(f)
+}
+
+// A renamer gives each assignment of a temporary its own version, and tracks
+// the version which reaches each use.
+type renamer struct {
+	f *Function
+	// The versions of each temporary which are assigned in the blocks which
+	// dominate the current one, innermost last.
+	stacks map[*Temp][]Value
+	// The temporaries which have been assigned, so that later assignments of
+	// them are new versions.
+	assigned map[*Temp]bool
+}
+
+// define returns the version of a temporary for a new assignment of it, and
+// makes it the current version.
+func (r *renamer) define(t *Temp) *Temp {
+	version := t
+	if r.assigned[t] {
+		if t.Name != "" {
+			version = r.f.NewVariable(BaseName(t.Name), t.Type())
+		} else {
+			version = r.f.NewTemp(t.Type())
+		}
+	}
+	r.assigned[t] = true
+	r.stacks[t] = append(r.stacks[t], version)
+	return version
+}
+
+// current returns the version of a temporary which reaches the current
+// instruction, or zero if none does.
+func (r *renamer) current(t *Temp) Value {
+	if s := r.stacks[t]; len(s) > 0 {
+		return s[len(s)-1]
+	}
+	return Zero(t.Type())
+}
+
+// BaseName returns the name of a variable without the suffix which makes it
+// unique, if any.
+func BaseName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		if _, err := strconv.Atoi(name[i+1:]); err == nil {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// removeUnreachable removes the blocks of a function which cannot be
+// executed.
+func removeUnreachable(f *Function) {
+	g := NewCFG(f)
+	reachable := g.Reachable()
+	out := &Function{}
+	for _, b := range g.Blocks {
+		if reachable[b.Index] {
+			for i, instr := range b.Instrs {
+				out.EmitAt(instr, f.Position(b.Start+i))
+			}
+		}
+	}
+	f.Instrs, f.Positions = out.Instrs, out.Positions
+}
+
+// removeDeadPhis removes the phis whose results are not used, except by
+// other such phis.
+func removeDeadPhis(f *Function) {
+	live := make(map[*Temp]bool)
+	phis := make(map[*Temp]*Phi)
+	var work []*Temp
+	for _, instr := range f.Instrs {
+		if phi, ok := instr.(*Phi); ok {
+			phis[phi.Dst] = phi
+			continue
+		}
+		for _, t := range Uses(instr) {
+			if !live[t] {
+				live[t] = true
+				work = append(work, t)
+			}
+		}
+	}
+	for len(work) > 0 {
+		t := work[len(work)-1]
+		work = work[:len(work)-1]
+		if phi, ok := phis[t]; ok {
+			for _, u := range Uses(phi) {
+				if !live[u] {
+					live[u] = true
+					work = append(work, u)
+				}
+			}
+		}
+	}
+	out := &Function{}
+	for i, instr := range f.Instrs {
+		if phi, ok := instr.(*Phi); !ok || live[phi.Dst] {
+			out.EmitAt(instr, f.Position(i))
+		}
+	}
+	f.Instrs, f.Positions = out.Instrs, out.Positions
+}
+
+// VerifySSA checks that a function is in SSA form: that every temporary is
+// assigned once, and only if it is not a parameter, by an instruction which
+// dominates each of its uses, that the phis of each block are at its start,
+// with an argument for each predecessor, and that every block is reachable
+// from the entry, which has no predecessors. The argument of a phi for a
+// predecessor is used at the end of the predecessor.
+func VerifySSA(f *Function) error {
+	g := NewCFG(f)
+	dom := g.Dominators()
+	reachable := g.Reachable()
+	// The index of each assignment, or -1 for a parameter.
+	defs := make(map[*Temp]int)
+	for _, p := range f.Params {
+		defs[p] = -1
+	}
+	for i, instr := range f.Instrs {
+		if t := Def(instr); t != nil {
+			if _, ok := defs[t]; ok {
+				return fmt.Errorf("%s: %v is assigned more than once", f.Name, t)
+			}
+			defs[t] = i
+		}
+	}
+	if len(g.Blocks) > 0 && len(g.Blocks[0].Preds) > 0 {
+		return fmt.Errorf("%s: the entry block has predecessors", f.Name)
+	}
+	// dominates returns whether the assignment of a temporary dominates an
+	// instruction of a block, or its end if the index is past its last.
+	dominates := func(t *Temp, b *Block, i int) bool {
+		def := defs[t]
+		if def < 0 {
+			return true
+		} else if block := g.Block(def); block != b {
+			return dom.Dominates(block, b)
+		}
+		return def < i
+	}
+	for _, b := range g.Blocks {
+		if !reachable[b.Index] {
+			return fmt.Errorf("%s: %s is unreachable", f.Name, b.Name())
+		}
+		start := true
+		for k, instr := range b.Instrs {
+			if _, ok := instr.(*Label); ok {
+				continue
+			}
+			phi, ok := instr.(*Phi)
+			if !ok {
+				start = false
+				for _, t := range Uses(instr) {
+					if _, ok := defs[t]; !ok {
+						return fmt.Errorf("%s: %v is used but never assigned", f.Name, t)
+					} else if !dominates(t, b, b.Start+k) {
+						return fmt.Errorf("%s: the assignment of %v does not dominate its use in %v", f.Name, t, instr)
+					}
+				}
+				continue
+			}
+			if !start {
+				return fmt.Errorf("%s: %v is not at the start of %s", f.Name, phi, b.Name())
+			}
+			if len(phi.Args) != len(b.Preds) {
+				return fmt.Errorf("%s: %v has %d arguments, but %s has %d predecessors",
+					f.Name, phi, len(phi.Args), b.Name(), len(b.Preds))
+			}
+			for _, p := range b.Preds {
+				var arg *PhiArg
+				for j := range phi.Args {
+					if phi.Args[j].Pred == p.Label() {
+						arg = &phi.Args[j]
+					}
+				}
+				if arg == nil {
+					return fmt.Errorf("%s: %v has no argument for %s", f.Name, phi, p.Name())
+				}
+				if t, ok := arg.Value.(*Temp); ok {
+					if _, ok := defs[t]; !ok {
+						return fmt.Errorf("%s: %v is used but never assigned", f.Name, t)
+					} else if !dominates(t, p, p.Start+len(p.Instrs)) {
+						return fmt.Errorf("%s: the assignment of %v does not dominate the end of %s, for %v",
+							f.Name, t, p.Name(), phi)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// DestroySSA converts a function from SSA form, replacing the phis with
+// copies. The argument of each phi for a predecessor is copied to a new
+// temporary at the end of the predecessor, before its jump, and the phi
+// becomes a copy of the temporary. So the phis of a block are in effect
+// assigned in parallel, and a copy for a phi does not change the result of
+// the phi where it is used after other successors of the predecessor.
+func DestroySSA(f *Function) {
+	g := NewCFG(f)
+	labels := make(map[*Label]*Block)
+	for _, b := range g.Blocks {
+		if l := b.Label(); l != nil {
+			labels[l] = b
+		}
+	}
+	copies := make([][]Instr, len(g.Blocks))
+	replaced := make(map[*Phi]Instr)
+	for _, instr := range f.Instrs {
+		phi, ok := instr.(*Phi)
+		if !ok {
+			continue
+		}
+		t := f.NewTemp(phi.Dst.Type())
+		for _, a := range phi.Args {
+			pred := g.Blocks[0]
+			if a.Pred != nil {
+				pred = labels[a.Pred]
+			}
+			copies[pred.Index] = append(copies[pred.Index], &Copy{Dst: t, Src: a.Value})
+		}
+		replaced[phi] = &Copy{Dst: phi.Dst, Src: t}
+	}
+	out := &Function{}
+	for _, b := range g.Blocks {
+		end := len(b.Instrs)
+		if b.Terminator() != nil {
+			end--
+		}
+		for i, instr := range b.Instrs {
+			pos := f.Position(b.Start + i)
+			if i == end {
+				for _, c := range copies[b.Index] {
+					out.EmitAt(c, pos)
+				}
+			}
+			if phi, ok := instr.(*Phi); ok {
+				instr = replaced[phi]
+			}
+			out.EmitAt(instr, pos)
+		}
+		if end == len(b.Instrs) {
+			for _, c := range copies[b.Index] {
+				out.EmitAt(c, f.Position(b.Start+end-1))
+			}
+		}
+	}
+	f.Instrs, f.Positions = out.Instrs, out.Positions
+}
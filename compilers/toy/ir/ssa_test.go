@@ -0,0 +1,224 @@
+package ir
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// ssa lowers a program and converts its functions to SSA form, checking that
+// they are valid, and returns its textual form.
+func ssa(t *testing.T, input string) *Program {
+	program := lowerProgram(t, input)
+	for _, f := range program.Functions {
+		ToSSA(f)
+		if err := VerifySSA(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return program
+}
+
+func TestToSSA(t *testing.T) {
+	assert := assert.New(t)
+	// Phis are placed where the assignments of the loop and the if statement
+	// meet, and the unreachable block is removed.
+	assert.Equal(`func f(%n:int) int {
+	%s:int = 0
+L1:
+	%n.1:int = phi [entry: %n], [L5: %n.2]
+	%s.1:int = phi [entry: %s], [L5: %s.4]
+	%2:int = gt %n.1, 0
+	branch %2, L2, L3
+L2:
+	%3:int = gt %n.1, 5
+	branch %3, L4, L6
+L4:
+	%4:int = add %s.1, 2
+	%s.2:int = %4
+	jump L5
+L6:
+	%5:int = add %s.1, 1
+	%s.3:int = %5
+L5:
+	%s.4:int = phi [L4: %s.2], [L6: %s.3]
+	%6:int = sub %n.1, 1
+	%n.2:int = %6
+	jump L1
+L3:
+	return %s.1
+}
+`, Format(ssa(t, loopWithIf)))
+}
+
+func TestToSSAUninitialized(t *testing.T) {
+	assert := assert.New(t)
+	// A use which no assignment reaches is of zero.
+	assert.Equal(`func f(%c:int) int {
+	branch %c, L1, L2
+L1:
+	%x:int = 1
+L2:
+	%x.1:int = phi [entry: 0], [L1: %x]
+	return %x.1
+}
+`, Format(ssa(t, "int f(int c) { int x; if (c) x = 1; return x; }")))
+}
+
+func TestToSSADeadPhis(t *testing.T) {
+	assert := assert.New(t)
+	// A variable which is not used after the if statement needs no phi.
+	assert.Equal(`func f(%c:int) int {
+	branch %c, L1, L2
+L1:
+	%x:int = 1
+	%2:int = add %x, 1
+	%x.1:int = %2
+L2:
+	return 0
+}
+`, Format(ssa(t, "int f(int c) { int x; if (c) { x = 1; x = x + 1; } return 0; }")))
+}
+
+func TestToSSALoopAtEntry(t *testing.T) {
+	assert := assert.New(t)
+	// A loop which starts the function is entered by a jump.
+	program := ssa(t, "int f(int n) { l: n = n - 1; if (n) goto l; return n; }")
+	assert.Equal(`func f(%n:int) int {
+	jump L1
+L1:
+	%n.1:int = phi [entry: %n], [L2: %n.2]
+	%1:int = sub %n.1, 1
+	%n.2:int = %1
+	branch %n.2, L2, L3
+L2:
+	jump L1
+L3:
+	return %n.2
+}
+`, Format(program))
+}
+
+func TestDestroySSA(t *testing.T) {
+	assert := assert.New(t)
+	program := ssa(t, loopWithIf)
+	f := program.Functions[0]
+	DestroySSA(f)
+	assert.Equal(`func f(%n:int) int {
+	%s:int = 0
+	%13:int = %n
+	%14:int = %s
+L1:
+	%n.1:int = %13
+	%s.1:int = %14
+	%2:int = gt %n.1, 0
+	branch %2, L2, L3
+L2:
+	%3:int = gt %n.1, 5
+	branch %3, L4, L6
+L4:
+	%4:int = add %s.1, 2
+	%s.2:int = %4
+	%15:int = %s.2
+	jump L5
+L6:
+	%5:int = add %s.1, 1
+	%s.3:int = %5
+	%15:int = %s.3
+L5:
+	%s.4:int = %15
+	%6:int = sub %n.1, 1
+	%n.2:int = %6
+	%13:int = %n.2
+	%14:int = %s.4
+	jump L1
+L3:
+	return %s.1
+}
+`, Format(program))
+	assert.Len(f.Positions, len(f.Instrs))
+}
+
+func TestDestroySSASwap(t *testing.T) {
+	assert := assert.New(t)
+	// Phis which use each other are assigned in parallel.
+	f := &Function{Name: "f", Result: types.Int}
+	a, b, n := f.NewVariable("a", types.Int), f.NewVariable("b", types.Int), f.NewVariable("n", types.Int)
+	a1, b1 := f.NewVariable("a", types.Int), f.NewVariable("b", types.Int)
+	f.Params = []*Temp{a, b, n}
+	loop, body, exit := &Label{ID: 1}, &Label{ID: 2}, &Label{ID: 3}
+	for _, instr := range []Instr{
+		&Jump{Target: loop},
+		loop,
+		&Phi{Dst: a1, Args: []PhiArg{{nil, a}, {body, b1}}},
+		&Phi{Dst: b1, Args: []PhiArg{{nil, b}, {body, a1}}},
+		&Branch{Cond: n, True: body, False: exit},
+		body,
+		&Jump{Target: loop},
+		exit,
+		&Return{Value: a1},
+	} {
+		f.Emit(instr)
+	}
+	assert.NoError(VerifySSA(f))
+	DestroySSA(f)
+	assert.Equal(`func f(%a:int, %b:int, %n:int) int {
+	%5:int = %a
+	%6:int = %b
+	jump L1
+L1:
+	%a.1:int = %5
+	%b.1:int = %6
+	branch %n, L2, L3
+L2:
+	%5:int = %b.1
+	%6:int = %a.1
+	jump L1
+L3:
+	return %a.1
+}
+`, Format(&Program{Functions: []*Function{f}}))
+}
+
+func TestVerifySSA(t *testing.T) {
+	assert := assert.New(t)
+	x := &Temp{ID: 0, Name: "x", typ: types.Int}
+	y := &Temp{ID: 1, Name: "y", typ: types.Int}
+	z := &Temp{ID: 2, Name: "z", typ: types.Int}
+	l1, l2 := &Label{ID: 1}, &Label{ID: 2}
+	for _, test := range []struct {
+		params []*Temp
+		instrs []Instr
+		want   string
+	}{
+		{[]*Temp{x}, []Instr{&Copy{Dst: x, Src: NewInt(1, types.Int)}, &Return{Value: x}},
+			"f: %x is assigned more than once"},
+		{nil, []Instr{&Return{Value: x}}, "f: %x is used but never assigned"},
+		{nil, []Instr{&Copy{Dst: y, Src: x}, &Copy{Dst: x, Src: y}, &Return{}},
+			"f: the assignment of %x does not dominate its use in %y:int = %x"},
+		{nil, []Instr{l1, &Jump{Target: l1}}, "f: the entry block has predecessors"},
+		{nil, []Instr{&Return{}, l1, &Return{}}, "f: L1 is unreachable"},
+		{[]*Temp{y}, []Instr{&Branch{Cond: y, True: l1, False: l2}, l1, l2,
+			&Copy{Dst: x, Src: y}, &Phi{Dst: z, Args: []PhiArg{{nil, y}, {l1, y}}}, &Return{}},
+			"f: %z:int = phi [entry: %y], [L1: %y] is not at the start of L2"},
+		{[]*Temp{y}, []Instr{&Branch{Cond: y, True: l1, False: l2}, l1, l2,
+			&Phi{Dst: x, Args: []PhiArg{{nil, y}}}, &Return{}},
+			"f: %x:int = phi [entry: %y] has 1 arguments, but L2 has 2 predecessors"},
+		{[]*Temp{y}, []Instr{&Branch{Cond: y, True: l1, False: l2}, l1, l2,
+			&Phi{Dst: x, Args: []PhiArg{{nil, y}, {l2, y}}}, &Return{}},
+			"f: %x:int = phi [entry: %y], [L2: %y] has no argument for L1"},
+		{[]*Temp{y}, []Instr{&Branch{Cond: y, True: l1, False: l2}, l1, l2,
+			&Phi{Dst: x, Args: []PhiArg{{nil, y}, {l1, x}}}, &Return{}},
+			"f: the assignment of %x does not dominate the end of L1, for %x:int = phi [entry: %y], [L1: %x]"},
+	} {
+		err := VerifySSA(&Function{Name: "f", Params: test.params, Instrs: test.instrs})
+		assert.EqualError(err, test.want)
+	}
+}
+
+func TestBaseName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("x", BaseName("x"))
+	assert.Equal("x", BaseName("x.12"))
+	assert.Equal("x.y", BaseName("x.y"))
+}
@@ -0,0 +1,60 @@
+package ir
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// TailCalls returns the calls of a function which are in tail position: those
+// whose result, of the type of the function's, is returned by the function,
+// and after which only copies, labels and jumps are executed before the
+// return. The callee of such a call may return to the caller's caller in
+// place of the function. A function with stack slots has none, since the
+// callee may be passed the address of one, and a backend which reuses the
+// frame of the function for the callee would then free it.
+func TailCalls(f *Function) map[*Call]bool {
+	tail := make(map[*Call]bool)
+	if len(f.Slots) > 0 {
+		return tail
+	}
+	labels := make(map[*Label]int)
+	for i, instr := range f.Instrs {
+		if l, ok := instr.(*Label); ok {
+			labels[l] = i
+		}
+	}
+	for i, instr := range f.Instrs {
+		c, ok := instr.(*Call)
+		if !ok || !types.Identical(c.Dst.Type(), f.Result) {
+			continue
+		}
+		// The temporaries which hold the result as control follows the call,
+		// until it reaches a return, or another instruction.
+		holders := map[*Temp]bool{c.Dst: true}
+		visited := make(map[int]bool)
+	follow:
+		for j := i + 1; j < len(f.Instrs) && !visited[j]; {
+			visited[j] = true
+			switch n := f.Instrs[j].(type) {
+			case *Label:
+				j++
+			case *Jump:
+				j = labels[n.Target]
+			case *Copy:
+				if t, ok := n.Src.(*Temp); ok && holders[t] {
+					holders[n.Dst] = true
+				} else {
+					delete(holders, n.Dst)
+				}
+				j++
+			case *Return:
+				if t, ok := n.Value.(*Temp); ok && holders[t] {
+					tail[c] = true
+				}
+				break follow
+			default:
+				break follow
+			}
+		}
+	}
+	return tail
+}
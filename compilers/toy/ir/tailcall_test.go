@@ -0,0 +1,48 @@
+package ir
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// tailCallees returns the names of the functions called in tail position by
+// the function of a program with a name.
+func tailCallees(t *testing.T, input, name string) []string {
+	var callees []string
+	for _, f := range lowerProgram(t, input).Functions {
+		if f.Name != name {
+			continue
+		}
+		tail := TailCalls(f)
+		for _, instr := range f.Instrs {
+			if c, ok := instr.(*Call); ok && tail[c] {
+				callees = append(callees, c.Function)
+			}
+		}
+	}
+	return callees
+}
+
+func TestTailCalls(t *testing.T) {
+	assert := assert.New(t)
+	const functions = "int g(int x) { return x; } int h(int x) { return x; } "
+	assert.Equal([]string{"g"}, tailCallees(t, functions+"int f(int x) { return g(x); }", "f"))
+	assert.Equal([]string{"g", "h"}, tailCallees(t, functions+`int f(int x) {
+  if (x)
+    return g(x - 1);
+  return h(x + 1);
+}`, "f"))
+	// A result assigned to a variable is returned through copies.
+	assert.Equal([]string{"h"}, tailCallees(t, functions+"int f(int x) { int y = h(g(x)); return y; }", "f"))
+}
+
+func TestTailCallsNotInTailPosition(t *testing.T) {
+	assert := assert.New(t)
+	const functions = "int g(int x) { return x; } double d(int x) { return x; } "
+	assert.Empty(tailCallees(t, functions+"int f(int x) { return g(x) + 1; }", "f"))
+	assert.Empty(tailCallees(t, functions+"int f(int x) { g(x); return x; }", "f"))
+	// The result is converted.
+	assert.Empty(tailCallees(t, functions+"int f(int x) { return d(x); }", "f"))
+	// The callee may be passed the address of a local.
+	assert.Empty(tailCallees(t, functions+"int f(int x) { int *p = &x; return g(*p); }", "f"))
+}
@@ -0,0 +1,76 @@
+package lexer
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+	"testing"
+)
+
+// largeProgram returns a program of at least size bytes, made of copies of a
+// function which uses most kinds of token.
+func largeProgram(size int) string {
+	var b strings.Builder
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, `// Function %d.
+int f%d(int a, int b) {
+    int x = 0x1F + a * 0755; /* A block comment. */
+    double y = 1.5e3;
+    char *s = "a string\n";
+    for (int i = 0; i < b; ++i) {
+        if (x >= i && s[i] != '\0') x += i << 2;
+        else x -= y / 2;
+    }
+    return x ? a : b;
+}
+`, i, i)
+	}
+	return b.String()
+}
+
+// benchmarkLex lexes a 1MB program to its end. Compare the results of two
+// versions of the lexer with benchstat:
+//
+//	go test -run=NONE -bench=Lex -count=10 > old.txt
+//	go test -run=NONE -bench=Lex -count=10 > new.txt
+//	benchstat old.txt new.txt
+func benchmarkLex(b *testing.B, lex func(input string) *Lexer) {
+	input := largeProgram(1 << 20)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lexer := lex(input)
+		for t := lexer.NextToken(); t.Type != token.EofToken; t = lexer.NextToken() {
+			if t.Type == token.ErrorToken {
+				b.Fatal(t.Value)
+			}
+		}
+	}
+}
+
+func BenchmarkLex(b *testing.B) {
+	benchmarkLex(b, func(input string) *Lexer { return Lex(input) })
+}
+
+func BenchmarkLexReader(b *testing.B) {
+	benchmarkLex(b, func(input string) *Lexer {
+		return LexReader(strings.NewReader(input))
+	})
+}
+
+func BenchmarkLexPreserveTrivia(b *testing.B) {
+	benchmarkLex(b, func(input string) *Lexer { return Lex(input, PreserveTrivia) })
+}
+
+func BenchmarkLexerTokenStream(b *testing.B) {
+	input := largeProgram(1 << 20)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ts := NewLexerTokenStream(Lex(input))
+		for ts.Next() {
+		}
+	}
+}
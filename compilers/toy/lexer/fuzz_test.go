@@ -0,0 +1,104 @@
+//go:build go1.18
+// +build go1.18
+
+package lexer
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// Inputs for the fuzzer to mutate, covering each kind of token.
+var fuzzSeeds = []string{
+	"",
+	"int main() {\n  return 100;\n}",
+	"int main() { return @; }",
+	"float f = 1.5e10f; double d = .5; int h = 0x1F + 017 + 0b101;",
+	"a+++b---c<=d<<<e&&&f>>=g",
+	"if (a) b; else while (c) do break; while (d); for (;;) continue;",
+	"switch (a) { case 1: default: }",
+	"a ? b : c, d %= e ^= f |= g",
+	"/* block */ // line\n/* unterminated",
+	`"string\n\t\"" 'c' '\0' '\x41' "unterminated`,
+	"return été;\r\n\xff\xfe",
+	"#line 10 \"a.c\"\nint a;\n  # 1 \"b.c\" 2\nb #line 3\n#00",
+}
+
+// lexAll returns the tokens of an input, up to and including the first error
+// or end of file token. It fails the test if the lexer returns more tokens
+// than there are bytes in its input, as it must then be stuck.
+func lexAll(t *testing.T, lexer *Lexer, input string) []token.Token {
+	var tokens []token.Token
+	for {
+		tok := lexer.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EofToken || (tok.Type == token.ErrorToken && !lexer.recoverErrors) {
+			return tokens
+		}
+		if len(tokens) > len(input)+1 {
+			t.Fatalf("lexer did not terminate on %q", input)
+		}
+	}
+}
+
+// checkPositions checks that the tokens of an input start in order, and that
+// the column of each matches its offset. So does its line, counted from the
+// start of the input, or from the first token after a line directive, which
+// numbers the lines after it.
+func checkPositions(t *testing.T, tokens []token.Token, input string) {
+	from, fromLine := 0, 1
+	for i, tok := range tokens {
+		if tok.Offset < 0 || tok.Offset > len(input) {
+			t.Fatalf("token %v of %q starts at offset %d, outside of the input",
+				tok, input, tok.Offset)
+		}
+		if i > 0 && tok.Offset <= tokens[i-1].Offset && tok.Type != token.EofToken {
+			t.Fatalf("token %v of %q at offset %d does not follow token %v at offset %d",
+				tok, input, tok.Offset, tokens[i-1], tokens[i-1].Offset)
+		}
+		previous := 0
+		if i > 0 {
+			previous = tokens[i-1].Offset
+		}
+		if mayHaveLineDirective(input[previous:tok.Offset]) {
+			from, fromLine = tok.Offset, tok.Line
+		}
+		before := input[:tok.Offset]
+		line := fromLine + strings.Count(input[from:tok.Offset], "\n")
+		column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+		if tok.Line != line || tok.Column != column {
+			t.Fatalf("token %v of %q at offset %d is at %d:%d, expected %d:%d",
+				tok, input, tok.Offset, tok.Line, tok.Column, line, column)
+		}
+	}
+	if last := tokens[len(tokens)-1]; last.Type == token.EofToken && last.Offset != len(input) {
+		t.Fatalf("end of file of %q at offset %d, expected %d", input, last.Offset, len(input))
+	}
+}
+
+// FuzzLex checks that the lexer terminates without panicking on any input,
+// that the positions of its tokens are consistent, and that lexing from a
+// reader produces the same tokens as lexing a string.
+func FuzzLex(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		tokens := lexAll(t, Lex(input), input)
+		checkPositions(t, tokens, input)
+		recovered := lexAll(t, Lex(input, RecoverFromErrors), input)
+		checkPositions(t, recovered, input)
+
+		read := lexAll(t, LexReader(strings.NewReader(input)), input)
+		if len(read) != len(tokens) {
+			t.Fatalf("reader lexed %d tokens of %q, expected %d", len(read), input, len(tokens))
+		}
+		for i := range tokens {
+			if read[i] != tokens[i] {
+				t.Fatalf("reader lexed %v of %q, expected %v", read[i], input, tokens[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package lexer
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The class of a span of source text, for syntax highlighting.
+type Class uint8
+
+const (
+	WhitespaceClass Class = iota
+	CommentClass
+	KeywordClass
+	IdentifierClass
+	LiteralClass   // A number, character or string literal.
+	OperatorClass  // An operator or punctuation.
+	DirectiveClass // A line directive.
+	InvalidClass   // Input which is not part of any token.
+)
+
+var classNames = [...]string{
+	WhitespaceClass: "whitespace",
+	CommentClass:    "comment",
+	KeywordClass:    "keyword",
+	IdentifierClass: "identifier",
+	LiteralClass:    "literal",
+	OperatorClass:   "operator",
+	DirectiveClass:  "directive",
+	InvalidClass:    "invalid",
+}
+
+// String returns the name of a class, which is a lower case word such as
+// "keyword", suitable for the name of a style.
+func (c Class) String() string {
+	if int(c) < len(classNames) {
+		return classNames[c]
+	}
+	return fmt.Sprintf("Class(%d)", c)
+}
+
+// A span of source text of a single class.
+type Span struct {
+	Offset int // Byte offset of the start of the span.
+	Length int // Length of the span in bytes.
+	Class  Class
+}
+
+// Text returns the text of the input which a span covers.
+func (s Span) Text(input string) string {
+	return input[s.Offset : s.Offset+s.Length]
+}
+
+// Highlight classifies every byte of an input, returning the spans of the
+// tokens, comments and line directives, and of the whitespace and invalid
+// input between them. The spans are in order and contiguous, and together
+// cover the input exactly. Each token is a span of its own, as is each run
+// of whitespace. Lexical errors are not reported: the input which is skipped
+// after an error is invalid, and lexing resumes after it.
+func Highlight(input string) []Span {
+	h := &highlighter{}
+	lexer := Lex(input, PreserveTrivia, PreserveComments, RecoverFromErrors)
+	for {
+		t := lexer.NextToken()
+		h.trivia(t.Trivia.Leading, false)
+		h.add(len(t.Trivia.Text), classOf(t.Type))
+		// The input skipped after an error is the start of its trivia.
+		h.trivia(t.Trivia.Trailing, t.Type == token.ErrorToken)
+		if t.Type == token.EofToken {
+			return h.spans
+		}
+	}
+}
+
+type highlighter struct {
+	spans  []Span
+	offset int // The end of the last span.
+}
+
+// add appends a span of a class which starts at the end of the last, unless
+// it is empty.
+func (h *highlighter) add(length int, class Class) {
+	if length > 0 {
+		h.spans = append(h.spans, Span{Offset: h.offset, Length: length, Class: class})
+		h.offset += length
+	}
+}
+
+// trivia adds the spans of trivia: whitespace, and line directives, which
+// run to the end of their lines. If invalid, the trivia starts with the
+// input skipped after an error, up to the next whitespace.
+func (h *highlighter) trivia(text string, invalid bool) {
+	for text != "" {
+		space := strings.IndexFunc(text, func(r rune) bool { return !unicode.IsSpace(r) })
+		if space < 0 {
+			space = len(text)
+		}
+		h.add(space, WhitespaceClass)
+		text = text[space:]
+		if text == "" {
+			return
+		}
+		var end int
+		if invalid {
+			end = strings.IndexFunc(text, unicode.IsSpace)
+			if end < 0 {
+				end = len(text)
+			}
+			h.add(end, InvalidClass)
+			invalid = false
+		} else {
+			end = strings.IndexByte(text, '\n')
+			if end < 0 {
+				end = len(text)
+			}
+			// The whitespace which ends the line is not part of the directive.
+			for end > 0 {
+				r, width := utf8.DecodeLastRuneInString(text[:end])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				end -= width
+			}
+			h.add(end, DirectiveClass)
+		}
+		text = text[end:]
+	}
+}
+
+// classOf returns the class of a type of token.
+func classOf(t token.TokenType) Class {
+	switch {
+	case t == token.CommentToken:
+		return CommentClass
+	case t == token.ErrorToken:
+		return InvalidClass
+	}
+	switch t.Category() {
+	case token.IdentifierCategory:
+		return IdentifierClass
+	case token.LiteralCategory:
+		return LiteralClass
+	case token.KeywordCategory:
+		return KeywordClass
+	}
+	return OperatorClass
+}
@@ -0,0 +1,105 @@
+package lexer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// classes returns the text and class of each span of the highlighted input.
+func classes(input string) [][2]string {
+	var result [][2]string
+	for _, s := range Highlight(input) {
+		result = append(result, [2]string{s.Text(input), s.Class.String()})
+	}
+	return result
+}
+
+func TestHighlight(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([][2]string{
+		{"int", "keyword"},
+		{" ", "whitespace"},
+		{"main", "identifier"},
+		{"(", "operator"},
+		{")", "operator"},
+		{" ", "whitespace"},
+		{"{", "operator"},
+		{" ", "whitespace"},
+		{"// One.", "comment"},
+		{"\n  ", "whitespace"},
+		{"return", "keyword"},
+		{" ", "whitespace"},
+		{"'a'", "literal"},
+		{" ", "whitespace"},
+		{"+=", "operator"},
+		{" ", "whitespace"},
+		{"1.5e3", "literal"},
+		{";", "operator"},
+		{" ", "whitespace"},
+		{"/* Two\n */", "comment"},
+		{"\n", "whitespace"},
+		{"}", "operator"},
+		{"\n", "whitespace"},
+	}, classes("int main() { // One.\n  return 'a' += 1.5e3; /* Two\n */\n}\n"))
+	assert.Nil(Highlight(""))
+}
+
+func TestHighlightLineDirectives(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([][2]string{
+		{"# 3 \"a.c\"", "directive"},
+		{" \n", "whitespace"},
+		{"x", "identifier"},
+		{"\n  ", "whitespace"},
+		{"#line 7", "directive"},
+		{"\n", "whitespace"},
+		{"\"s\\n\"", "literal"},
+	}, classes("# 3 \"a.c\" \nx\n  #line 7\n\"s\\n\""))
+}
+
+func TestHighlightInvalidInput(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([][2]string{
+		{"a", "identifier"},
+		{" ", "whitespace"},
+		{"@b", "invalid"},
+		{" ", "whitespace"},
+		{"c", "identifier"},
+		{" ", "whitespace"},
+		{"#", "invalid"},
+		{"\n", "whitespace"},
+		{"$", "invalid"},
+	}, classes("a @b c #\n$"))
+}
+
+func TestHighlightCoversInput(t *testing.T) {
+	inputs := []string{
+		"int main() {\n  return 0;\n}\n",
+		"\t\r\n  x\v\f y",
+		"/* unterminated",
+		"\"unterminated\nint x;",
+		"'ab' 0x 1e+ 09 \"\\q\"",
+		"# 1 \"a.c\"\n#line\n#line x\n# 2 \"b.c\" 1 2",
+		"int é = 1; // ünïcode\n",
+		"a<<=b>>=c...d->e",
+	}
+	for _, input := range inputs {
+		offset := 0
+		var text strings.Builder
+		for _, s := range Highlight(input) {
+			assert.Equal(t, offset, s.Offset, "%q", input)
+			assert.True(t, s.Length > 0, "%q", input)
+			offset += s.Length
+			text.WriteString(s.Text(input))
+		}
+		assert.Equal(t, input, text.String())
+	}
+}
+
+func TestClassString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("keyword", KeywordClass.String())
+	assert.Equal("invalid", InvalidClass.String())
+	assert.Equal("Class(100)", Class(100).String())
+}
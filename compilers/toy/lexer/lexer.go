@@ -1,58 +1,318 @@
 package lexer
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"io"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
+// The number of bytes read from the reader at a time in LexReader mode.
+const readChunkSize = 4096
+
 type Lexer struct {
 	input         string
-	startPosition int              // Start of current rune.
-	position      int              // Current position in the input.
-	width         int              // Width of the last rune read.
-	tokens        chan token.Token // Channel of scanned tokens.
-	state         stateFunction
+	startPosition int // Start of current rune.
+	position      int // Current position in the input.
+	width         int // Width of the last rune read.
+	line          int // Line number of startPosition.
+	column        int // Column number of startPosition.
+	// The lexer is a state machine which NextToken runs, a state at a time,
+	// until a token is scanned, and then returns it. Each state scans at most
+	// one token, which is written to where token points, so that a
+	// LexerTokenStream has it written straight into its buffer. Otherwise,
+	// it is written to scanned.
+	state   stateFunction
+	token   *token.Token
+	scanned token.Token
+	ready   bool // Whether a token has been scanned but not returned.
+	// In LexReader mode, the input is a window over the reader which is filled
+	// on demand, and base is the offset of the start of the window. Reads are
+	// made into buffer.
+	reader  *bufio.Reader
+	base    int
+	buffer  []byte
+	readErr error // The first non-EOF error returned by the reader.
+	// If set, lexing continues after an error rather than terminating.
+	recoverErrors bool
+	// If set, comments are emitted as tokens rather than skipped.
+	preserveComments bool
+	// If set, each token carries its trivia. The trivia scanned since the
+	// last token is held, with that token, until the next token ends it.
+	preserveTrivia bool
+	trivia         string
+	held           token.Token
+	holding        bool // Whether a token is held.
+	flushed        bool // Whether the end of file token has been sent.
+	// The file named by the last line directive, if any, and whether only
+	// whitespace precedes the start position on its line, where a line
+	// directive may begin.
+	filename  string
+	lineStart bool
+}
+
+// An Option configures the behaviour of a Lexer.
+type Option func(*Lexer)
+
+// RecoverFromErrors is an Option which makes the lexer resume after invalid
+// input. An ErrorToken is emitted for the invalid input, which is then skipped
+// up to the next whitespace or delimiter. By default, lexing terminates at the
+// first error.
+func RecoverFromErrors(lexer *Lexer) {
+	lexer.recoverErrors = true
+}
+
+// PreserveComments is an Option which makes the lexer emit a CommentToken for
+// each comment, for tools which need to reproduce the source. By default,
+// comments are skipped like whitespace.
+func PreserveComments(lexer *Lexer) {
+	lexer.preserveComments = true
+}
+
+// PreserveTrivia is an Option which attaches to each token its trivia: the
+// whitespace, comments and line directives around it, and its source text,
+// so that tools such as formatters can reproduce the source exactly. A
+// token's trailing trivia runs to the end of its line, and the rest before
+// the next token is the leading trivia of that token. By default, trivia is
+// discarded.
+func PreserveTrivia(lexer *Lexer) {
+	lexer.preserveTrivia = true
 }
 
 // Emit a token back to the client.
 func (lexer *Lexer) emit(t token.TokenType) {
-	lexer.tokens <- token.Token{t, lexer.input[lexer.startPosition:lexer.position]}
-	lexer.startPosition = lexer.position
+	text := lexer.input[lexer.startPosition:lexer.position]
+	if lexer.preserveTrivia {
+		lexer.send(lexer.makeToken(t, text), text)
+	} else {
+		// The common case, which is not worth the call to send. The fields
+		// are set in place, rather than copied from a new token.
+		tok := lexer.token
+		tok.Type = t
+		tok.Value = text
+		tok.Offset = lexer.base + lexer.startPosition
+		tok.Line = lexer.line
+		tok.Column = lexer.column
+		tok.Filename = lexer.filename
+		tok.Trivia = nil
+		lexer.ready = true
+	}
+	lexer.advance()
 }
 
-// Report an error and exit.
+// Emit a token whose value differs from its source text, such as a string
+// literal with its escape sequences decoded.
+func (lexer *Lexer) emitValue(t token.TokenType, value string) {
+	lexer.send(lexer.makeToken(t, value), lexer.input[lexer.startPosition:lexer.position])
+	lexer.advance()
+}
+
+// send delivers a token to the client, with the given source text. If trivia
+// is preserved, the token is held until the next one is sent, or the end of
+// the input, which ends its trailing trivia.
+func (lexer *Lexer) send(t token.Token, text string) {
+	if !lexer.preserveTrivia {
+		*lexer.token, lexer.ready = t, true
+		return
+	}
+	t.Trivia = &token.Trivia{Text: text, Leading: lexer.trivia}
+	lexer.trivia = ""
+	if lexer.holding {
+		// The trivia up to the first newline trails the held token.
+		i := strings.IndexByte(t.Trivia.Leading, '\n')
+		if i < 0 {
+			i = len(t.Trivia.Leading)
+		}
+		lexer.held.Trivia.Trailing = t.Trivia.Leading[:i]
+		t.Trivia.Leading = t.Trivia.Leading[i:]
+		*lexer.token, lexer.ready = lexer.held, true
+	}
+	lexer.held, lexer.holding = t, true
+}
+
+// Report an error and exit, or skip the invalid input if recovering from
+// errors.
 func (lexer *Lexer) errorf(format string, args ...interface{}) stateFunction {
-	// Set the text to the error message.
-	lexer.tokens <- token.Token{
-		token.ErrorToken,
-		fmt.Sprintf(format, args...),
+	// Set the text to the error message. The invalid input is skipped, so it
+	// is trivia.
+	lexer.send(lexer.makeToken(
+		token.ErrorToken, fmt.Sprintf(format, args...)), "")
+	if lexer.recoverErrors {
+		return lexSkipInvalid
 	}
 	return nil // End the lexing loop.
 }
 
-func (lexer *Lexer) run() {
-	for state := lexStartState; state != nil; {
-		state = state(lexer)
+// makeToken creates a token which begins at the start position.
+func (lexer *Lexer) makeToken(t token.TokenType, value string) token.Token {
+	return token.Token{
+		Type:     t,
+		Value:    value,
+		Offset:   lexer.base + lexer.startPosition,
+		Line:     lexer.line,
+		Column:   lexer.column,
+		Filename: lexer.filename,
+	}
+}
+
+// Position returns the source location of the start of the next token.
+func (lexer *Lexer) Position() token.Position {
+	return token.Position{
+		Filename: lexer.filename,
+		Offset:   lexer.base + lexer.startPosition,
+		Line:     lexer.line,
+		Column:   lexer.column,
+	}
+}
+
+// advance moves the start position up to the current position, keeping track
+// of any newlines that were consumed.
+func (lexer *Lexer) advance() {
+	text := lexer.input[lexer.startPosition:lexer.position]
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\n':
+			lexer.line++
+			lexer.column = 1
+			lexer.lineStart = true
+		case c < utf8.RuneSelf:
+			lexer.column++
+			lexer.lineStart = lexer.lineStart && isASCIISpace(c)
+		default:
+			r, width := utf8.DecodeRuneInString(text[i:])
+			i += width - 1
+			lexer.column++
+			lexer.lineStart = lexer.lineStart && unicode.IsSpace(r)
+		}
 	}
-	// No more tokens will be delivered.
-	close(lexer.tokens)
+	lexer.start()
+}
+
+// start moves the start position up to the current position.
+func (lexer *Lexer) start() {
+	lexer.startPosition = lexer.position
+
+	// Discard the consumed input so that the window over a reader does not
+	// grow without bound.
+	if lexer.reader != nil && lexer.startPosition >= readChunkSize {
+		lexer.input = lexer.input[lexer.startPosition:]
+		lexer.base += lexer.startPosition
+		lexer.position -= lexer.startPosition
+		lexer.startPosition = 0
+	}
+}
+
+// fill ensures that at least n bytes of input are available after the current
+// position, unless the end of the input is reached first.
+func (lexer *Lexer) fill(n int) {
+	if lexer.reader != nil && len(lexer.input)-lexer.position < n {
+		lexer.read(n)
+	}
+}
+
+// read reads from the reader until at least n bytes of input are available
+// after the current position, or the end of the input is reached.
+func (lexer *Lexer) read(n int) {
+	for len(lexer.input)-lexer.position < n {
+		if lexer.buffer == nil {
+			lexer.buffer = make([]byte, readChunkSize)
+		}
+		read, err := lexer.reader.Read(lexer.buffer)
+		lexer.input += string(lexer.buffer[:read])
+		if err != nil {
+			if err != io.EOF {
+				lexer.readErr = err
+			}
+			lexer.reader = nil
+			return
+		}
+	}
+}
+
+// lookahead returns up to the next n bytes of input, without consuming them.
+func (lexer *Lexer) lookahead(n int) string {
+	lexer.fill(n)
+	end := lexer.position + n
+	if end > len(lexer.input) {
+		end = len(lexer.input)
+	}
+	return lexer.input[lexer.position:end]
 }
 
 func (lexer *Lexer) next() rune {
+	lexer.fill(utf8.UTFMax)
 	if lexer.position >= len(lexer.input) {
 		lexer.width = 0
 		return eofRune
 	}
+	if c := lexer.input[lexer.position]; c < utf8.RuneSelf {
+		lexer.width = 1
+		lexer.position++
+		return rune(c)
+	}
 	r, width := utf8.DecodeRuneInString(lexer.input[lexer.position:])
 	lexer.width = width
 	lexer.position += lexer.width
 	return r
 }
 
+// isASCIISpace returns whether a byte is ASCII whitespace.
+func isASCIISpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// skipSpace skips a run of ASCII whitespace, which is trivia, at once rather
+// than a rune at a time, keeping track of its newlines as it goes.
+func (lexer *Lexer) skipSpace() {
+loop:
+	for lexer.fill(1); lexer.position < len(lexer.input); lexer.fill(1) {
+		switch lexer.input[lexer.position] {
+		case '\n':
+			lexer.line++
+			lexer.column = 1
+			lexer.lineStart = true
+		case ' ', '\t', '\v', '\f', '\r':
+			lexer.column++
+		default:
+			break loop
+		}
+		lexer.position++
+	}
+	if lexer.preserveTrivia {
+		lexer.trivia += lexer.input[lexer.startPosition:lexer.position]
+	}
+	lexer.start()
+}
+
+// skipTo consumes the input up to the next occurrence of an ASCII character,
+// or the end of the input, at once rather than a rune at a time.
+func (lexer *Lexer) skipTo(c byte) {
+	for {
+		i := strings.IndexByte(lexer.input[lexer.position:], c)
+		if i >= 0 {
+			lexer.position += i
+			return
+		}
+		lexer.position = len(lexer.input)
+		if lexer.fill(1); lexer.position == len(lexer.input) {
+			return
+		}
+	}
+}
+
+// ignore skips the input scanned since the start position, which is trivia.
 func (lexer *Lexer) ignore() {
-	lexer.startPosition = lexer.position
+	if lexer.preserveTrivia {
+		lexer.trivia += lexer.input[lexer.startPosition:lexer.position]
+	}
+	lexer.advance()
 }
 
 func (lexer *Lexer) Backup() {
@@ -82,25 +342,70 @@ func (lexer *Lexer) acceptRun(valid string) {
 	lexer.Backup()
 }
 
+// NextToken scans and returns the next token of the input. At the end of the
+// input, or after an error which ends lexing, it returns an EofToken.
 func (lexer *Lexer) NextToken() token.Token {
-	for {
-		select {
-		case t := <-lexer.tokens:
-			return t
-		default:
-			if lexer.state == nil {
-				return token.Token{token.EofToken, ""}
-			}
+	lexer.scan(&lexer.scanned)
+	return lexer.scanned
+}
+
+// scan scans the next token, like NextToken, and writes it to t, so that
+// it need not be copied through a return value.
+func (lexer *Lexer) scan(t *token.Token) {
+	lexer.token = t
+	for !lexer.ready {
+		switch {
+		case lexer.state != nil:
 			lexer.state = lexer.state(lexer)
+		case lexer.preserveTrivia && !lexer.flushed:
+			// The end of file token leads with the trivia after the last
+			// token, which it ends.
+			lexer.flushed = true
+			lexer.send(lexer.makeToken(token.EofToken, ""), "")
+		case lexer.holding:
+			// Return the held end of file token.
+			*t, lexer.ready, lexer.holding = lexer.held, true, false
+		default:
+			*t = lexer.makeToken(token.EofToken, "")
+			lexer.token = nil
+			return
 		}
 	}
-	panic("unreachable!")
+	lexer.ready = false
+	lexer.token = nil
 }
 
-func Lex(input string) *Lexer {
-	return &Lexer{
-		input:  input,
-		state:  lexStartState,
-		tokens: make(chan token.Token, 2), // Two items sufficient.
+func Lex(input string, options ...Option) *Lexer {
+	lexer := &Lexer{
+		input:     input,
+		line:      1,
+		column:    1,
+		state:     lexStartState,
+		lineStart: true,
+	}
+	for _, option := range options {
+		option(lexer)
+	}
+	return lexer
+}
+
+// LexReader creates a lexer which reads its input incrementally from r,
+// rather than requiring the entire input up front.
+func LexReader(r io.Reader, options ...Option) *Lexer {
+	lexer := Lex("", options...)
+	lexer.reader = bufio.NewReader(r)
+	return lexer
+}
+
+// FindComment returns the position of the first comment of an input, and
+// whether it has one, for tools which rewrite the input from its syntax tree,
+// which has no comments.
+func FindComment(input string) (token.Position, bool) {
+	lexer := Lex(input, PreserveComments, RecoverFromErrors)
+	for t := lexer.NextToken(); t.Type != token.EofToken; t = lexer.NextToken() {
+		if t.Type == token.CommentToken {
+			return t.Position(), true
+		}
 	}
+	return token.Position{}, false
 }
@@ -1,11 +1,931 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
 	"github.com/ChrisCummins/phd/compilers/toy/token"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
+// stripPositions wraps a token generator to clear the source location of
+// tokens, so that tests can compare only token types and values.
+func stripPositions(next func() token.Token) func() token.Token {
+	return func() token.Token {
+		t := next()
+		return token.Token{Type: t.Type, Value: t.Value}
+	}
+}
+
+func TestLexPositions(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main() {
+    return 100;
+}`
+	next := Lex(input).NextToken
+	assert.Equal(token.Position{Offset: 0, Line: 1, Column: 1}, next().Position())
+	assert.Equal(token.Position{Offset: 4, Line: 1, Column: 5}, next().Position())
+	assert.Equal(token.Position{Offset: 8, Line: 1, Column: 9}, next().Position())
+	assert.Equal(token.Position{Offset: 9, Line: 1, Column: 10}, next().Position())
+	assert.Equal(token.Position{Offset: 11, Line: 1, Column: 12}, next().Position())
+	assert.Equal(token.Position{Offset: 17, Line: 2, Column: 5}, next().Position())
+	assert.Equal(token.Position{Offset: 24, Line: 2, Column: 12}, next().Position())
+	assert.Equal(token.Position{Offset: 27, Line: 2, Column: 15}, next().Position())
+	assert.Equal(token.Position{Offset: 29, Line: 3, Column: 1}, next().Position())
+	eof := next()
+	assert.Equal(token.EofToken, eof.Type)
+	assert.Equal(token.Position{Offset: 30, Line: 3, Column: 2}, eof.Position())
+}
+
+func TestLexPositionColumnsCountRunes(t *testing.T) {
+	assert := assert.New(t)
+	input := "return \u00e9t\u00e9;"
+	lexer := Lex(input)
+	next := lexer.NextToken
+	assert.Equal(token.Position{Offset: 0, Line: 1, Column: 1}, next().Position())
+	assert.Equal(token.Position{Offset: 7, Line: 1, Column: 8}, next().Position())
+	assert.Equal(token.Position{Offset: 12, Line: 1, Column: 11}, next().Position())
+	assert.Equal(token.Position{Offset: 13, Line: 1, Column: 12},
+		lexer.Position())
+}
+
+func TestLexErrorPosition(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main() {
+  return @;
+}`
+	next := Lex(input).NextToken
+	var tok token.Token
+	for tok = next(); tok.Type != token.ErrorToken; tok = next() {
+	}
+	assert.Equal(token.Position{Offset: 22, Line: 2, Column: 10}, tok.Position())
+}
+
+func TestLexReader(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main() {
+    return 100;
+}`
+	next := stripPositions(LexReader(strings.NewReader(input)).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "100"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexReaderOneByteAtATime(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main(){return returned <= 2;}`
+	next := LexReader(iotest.OneByteReader(strings.NewReader(input))).NextToken
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int",
+		Offset: 0, Line: 1, Column: 1}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main",
+		Offset: 4, Line: 1, Column: 5}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "(",
+		Offset: 8, Line: 1, Column: 9}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")",
+		Offset: 9, Line: 1, Column: 10}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{",
+		Offset: 10, Line: 1, Column: 11}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return",
+		Offset: 11, Line: 1, Column: 12}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "returned",
+		Offset: 18, Line: 1, Column: 19}, next())
+	assert.Equal(token.Token{Type: token.LessThanOrEqualToken, Value: "<=",
+		Offset: 27, Line: 1, Column: 28}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "2",
+		Offset: 30, Line: 1, Column: 31}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";",
+		Offset: 31, Line: 1, Column: 32}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}",
+		Offset: 32, Line: 1, Column: 33}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+// A countingReader counts the bytes read from a reader.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestLexReaderScansOnDemand(t *testing.T) {
+	assert := assert.New(t)
+	const source = "int x; int y;"
+	input := &countingReader{r: iotest.OneByteReader(strings.NewReader(source))}
+	lexer := LexReader(input)
+	// Each token is scanned when it is asked for, reading no further into the
+	// input than the lookahead it needs.
+	assert.Equal(token.IntKeywordToken, lexer.NextToken().Type)
+	assert.True(input.read < len(source))
+	assert.Equal(token.IdentifierToken, lexer.NextToken().Type)
+	assert.True(input.read < len(source))
+	for lexer.NextToken().Type != token.EofToken {
+	}
+	assert.Equal(len(source), input.read)
+}
+
+func TestLexReaderLargeInput(t *testing.T) {
+	assert := assert.New(t)
+	// Large enough to require several reads and discards of consumed input.
+	n := 5000
+	input := strings.Repeat("return 1;\n", n)
+	lexer := LexReader(strings.NewReader(input))
+	for i := 0; i < n; i++ {
+		tok := lexer.NextToken()
+		assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return",
+			Offset: i * 10, Line: i + 1, Column: 1}, tok)
+		assert.Equal(token.NumberToken, lexer.NextToken().Type)
+		assert.Equal(token.SemicolonToken, lexer.NextToken().Type)
+	}
+	assert.Equal(token.EofToken, lexer.NextToken().Type)
+}
+
+func TestLexReaderError(t *testing.T) {
+	assert := assert.New(t)
+	next := LexReader(iotest.ErrReader(errors.New("broken pipe"))).NextToken
+	tok := next()
+	assert.Equal(token.ErrorToken, tok.Type)
+	assert.Equal("read error: broken pipe", tok.Value)
+}
+
+func TestLexStopsAtFirstError(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("return @ 1 $;").NextToken)
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.ErrorToken, Value: "illegal character: `@`"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexNulIsNotEndOfInput(t *testing.T) {
+	assert := assert.New(t)
+	next := Lex("return\x00 1;").NextToken
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return",
+		Offset: 0, Line: 1, Column: 1}, next())
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "illegal character: `\x00`", Offset: 6, Line: 1, Column: 7}, next())
+}
+
+func TestLexNonASCIIDigit(t *testing.T) {
+	assert := assert.New(t)
+	// A digit of another script does not begin a number.
+	next := stripPositions(Lex("\u0663").NextToken)
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "illegal character: `\u0663`"}, next())
+	// But may continue an identifier.
+	next = stripPositions(Lex("a\u0663").NextToken)
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "a\u0663"}, next())
+}
+
+func TestLexNonASCIIIdentifier(t *testing.T) {
+	assert := assert.New(t)
+	// Letters of any script begin an identifier.
+	next := stripPositions(Lex("int π = 3; int переменная;").NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "π"}, next())
+	next()
+	next()
+	next()
+	next()
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "переменная"}, next())
+	// But symbols do not.
+	next = stripPositions(Lex("µ∃").NextToken)
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "µ"}, next())
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "illegal character: `∃`"}, next())
+}
+
+func TestLexIdentifierIsNormalized(t *testing.T) {
+	assert := assert.New(t)
+	// A decomposed accent is composed, so that both spellings are the same
+	// name, though the position of the token is that of its source.
+	lexer := Lex("café cafe\u0301")
+	assert.Equal("café", lexer.NextToken().Value)
+	next := lexer.NextToken()
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "café",
+		Offset: 6, Line: 1, Column: 6}, next)
+}
+
+func TestLexInvisibleCharacter(t *testing.T) {
+	assert := assert.New(t)
+	// A zero width space, a right-to-left override and a byte order mark.
+	for _, r := range []rune{'\u200b', '\u202e', '\ufeff'} {
+		next := stripPositions(Lex("int a" + string(r) + "b;").NextToken)
+		next()
+		assert.Equal(token.Token{Type: token.IdentifierToken, Value: "a"}, next())
+		assert.Equal(token.Token{Type: token.ErrorToken,
+			Value: fmt.Sprintf("illegal invisible character %U", r)}, next())
+	}
+}
+
+func TestLexRecoverFromErrors(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main() {
+  return @@@ 1 $;
+}`
+	next := Lex(input, RecoverFromErrors).NextToken
+	assert.Equal(token.IntKeywordToken, next().Type)
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.OpenParenthesisToken, next().Type)
+	assert.Equal(token.CloseParenthesisToken, next().Type)
+	assert.Equal(token.OpenBraceToken, next().Type)
+	assert.Equal(token.ReturnKeywordToken, next().Type)
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "illegal character: `@`", Offset: 22, Line: 2, Column: 10}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "1", Offset: 26,
+		Line: 2, Column: 14}, next())
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "illegal character: `$`", Offset: 28, Line: 2, Column: 16}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";", Offset: 29,
+		Line: 2, Column: 17}, next())
+	assert.Equal(token.CloseBraceToken, next().Type)
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexRecoverFromBadNumber(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("return 12ab3 + 4;", RecoverFromErrors).NextToken)
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.ErrorToken, Value: `Bad number syntax: "12a"`}, next())
+	assert.Equal(token.Token{Type: token.AdditionToken, Value: "+"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "4"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexIntegerBases(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("0x1F 0755 0b1010 0 0XaB 0B1").NextToken)
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0x1F"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0755"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0b1010"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0XaB"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0B1"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("unsigned signed 10u 0xFFU 0b1u 0u").NextToken)
+	assert.Equal(token.Token{Type: token.UnsignedKeywordToken, Value: "unsigned"}, next())
+	assert.Equal(token.Token{Type: token.SignedKeywordToken, Value: "signed"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "10u"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0xFFU"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0b1u"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0u"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("short long 10l 0x1FL 7ul 7LU 0b1uL").NextToken)
+	assert.Equal(token.Token{Type: token.ShortKeywordToken, Value: "short"}, next())
+	assert.Equal(token.Token{Type: token.LongKeywordToken, Value: "long"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "10l"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0x1FL"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "7ul"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "7LU"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0b1uL"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexBadIntegerBases(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]string{
+		"0x;":   `Bad number syntax: "0x"`,
+		"0xg":   `Bad number syntax: "0xg"`,
+		"0b":    `Bad number syntax: "0b"`,
+		"0b12":  `Bad number syntax: "0b12"`,
+		"0x1fg": `Bad number syntax: "0x1fg"`,
+		"08":    `Bad number syntax: "08"`,
+		"10uu":  `Bad number syntax: "10uu"`,
+		"1.5u":  `Bad number syntax: "1.5u"`,
+		"10ll":  `Bad number syntax: "10ll"`,
+		"10lul": `Bad number syntax: "10lul"`,
+	}
+	for input, want := range tests {
+		tok := Lex(input).NextToken()
+		assert.Equal(token.Token{Type: token.ErrorToken, Value: want},
+			token.Token{Type: tok.Type, Value: tok.Value}, input)
+	}
+}
+
+func TestLexFloats(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("1.5 1e10 .5 1.5f 1. 2.5E-3F 0.5 09.5 1e+2").NextToken)
+	for _, want := range []string{
+		"1.5", "1e10", ".5", "1.5f", "1.", "2.5E-3F", "0.5", "09.5", "1e+2",
+	} {
+		assert.Equal(token.Token{Type: token.FloatLiteralToken, Value: want},
+			next())
+	}
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexBadFloats(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]string{
+		"1e":    `Bad number syntax: "1e"`,
+		"1e+;":  `Bad number syntax: "1e+"`,
+		"1.5ff": `Bad number syntax: "1.5ff"`,
+		"1.5x":  `Bad number syntax: "1.5x"`,
+		"1f":    `Bad number syntax: "1f"`,
+	}
+	for input, want := range tests {
+		tok := Lex(input).NextToken()
+		assert.Equal(token.Token{Type: token.ErrorToken, Value: want},
+			token.Token{Type: tok.Type, Value: tok.Value}, input)
+	}
+}
+
+func TestLexTypeKeywords(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("int float double doubles floaty").NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.FloatKeywordToken, Value: "float"}, next())
+	assert.Equal(token.Token{Type: token.DoubleKeywordToken, Value: "double"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "doubles"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "floaty"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexComma(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("f(a,b)").NextToken)
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.OpenParenthesisToken, next().Type)
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.Token{Type: token.CommaToken, Value: ","}, next())
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.CloseParenthesisToken, next().Type)
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexBrackets(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("a[10]").NextToken)
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.Token{Type: token.OpenBracketToken, Value: "["}, next())
+	assert.Equal(token.NumberToken, next().Type)
+	assert.Equal(token.Token{Type: token.CloseBracketToken, Value: "]"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexIfElse(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("if else elseif iff").NextToken)
+	assert.Equal(token.Token{Type: token.IfKeywordToken, Value: "if"}, next())
+	assert.Equal(token.Token{Type: token.ElseKeywordToken, Value: "else"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "elseif"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "iff"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexLoopKeywords(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("while do for break continue done").NextToken)
+	assert.Equal(token.Token{Type: token.WhileKeywordToken, Value: "while"}, next())
+	assert.Equal(token.Token{Type: token.DoKeywordToken, Value: "do"}, next())
+	assert.Equal(token.Token{Type: token.ForKeywordToken, Value: "for"}, next())
+	assert.Equal(token.Token{Type: token.BreakKeywordToken, Value: "break"}, next())
+	assert.Equal(token.Token{Type: token.ContinueKeywordToken,
+		Value: "continue"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "done"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexSwitch(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("switch case 1: default:").NextToken)
+	assert.Equal(token.Token{Type: token.SwitchKeywordToken, Value: "switch"}, next())
+	assert.Equal(token.Token{Type: token.CaseKeywordToken, Value: "case"}, next())
+	assert.Equal(token.NumberToken, next().Type)
+	assert.Equal(token.Token{Type: token.ColonToken, Value: ":"}, next())
+	assert.Equal(token.Token{Type: token.DefaultKeywordToken, Value: "default"}, next())
+	assert.Equal(token.Token{Type: token.ColonToken, Value: ":"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexConditional(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("a?b:c").NextToken)
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.Token{Type: token.QuestionToken, Value: "?"}, next())
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.Token{Type: token.ColonToken, Value: ":"}, next())
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexAssignmentOperators(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("= += -= *= /= %= <<= >>= &= |= ^= ++ -- %").NextToken)
+	for _, want := range []token.Token{
+		{Type: token.AssignmentToken, Value: "="},
+		{Type: token.AdditionAssignmentToken, Value: "+="},
+		{Type: token.SubtractionAssignmentToken, Value: "-="},
+		{Type: token.MultiplicationAssignmentToken, Value: "*="},
+		{Type: token.DivisionAssignmentToken, Value: "/="},
+		{Type: token.ModuloAssignmentToken, Value: "%="},
+		{Type: token.ShiftLeftAssignmentToken, Value: "<<="},
+		{Type: token.ShiftRightAssignmentToken, Value: ">>="},
+		{Type: token.BitwiseAndAssignmentToken, Value: "&="},
+		{Type: token.BitwiseOrAssignmentToken, Value: "|="},
+		{Type: token.BitwiseXorAssignmentToken, Value: "^="},
+		{Type: token.IncrementToken, Value: "++"},
+		{Type: token.DecrementToken, Value: "--"},
+		{Type: token.ModuloToken, Value: "%"},
+		{Type: token.EofToken},
+	} {
+		assert.Equal(want, next())
+	}
+}
+
+func TestLexBitwiseOperators(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("& | ^ ~ << >> && || <= >= < > <<= >>=").NextToken)
+	for _, want := range []token.Token{
+		{Type: token.BitwiseAndToken, Value: "&"},
+		{Type: token.BitwiseOrToken, Value: "|"},
+		{Type: token.BitwiseXorToken, Value: "^"},
+		{Type: token.BitwiseComplementToken, Value: "~"},
+		{Type: token.ShiftLeftToken, Value: "<<"},
+		{Type: token.ShiftRightToken, Value: ">>"},
+		{Type: token.AndToken, Value: "&&"},
+		{Type: token.OrToken, Value: "||"},
+		{Type: token.LessThanOrEqualToken, Value: "<="},
+		{Type: token.GreaterThanOrEqualToken, Value: ">="},
+		{Type: token.LessThanToken, Value: "<"},
+		{Type: token.GreaterThanToken, Value: ">"},
+		{Type: token.ShiftLeftAssignmentToken, Value: "<<="},
+		{Type: token.ShiftRightAssignmentToken, Value: ">>="},
+		{Type: token.EofToken},
+	} {
+		assert.Equal(want, next())
+	}
+}
+
+func TestLexLongestOperator(t *testing.T) {
+	assert := assert.New(t)
+	// The longest operator is taken first.
+	next := stripPositions(Lex("a+++b---c<=d<<<e&&&f").NextToken)
+	for _, want := range []token.TokenType{
+		token.IdentifierToken, token.IncrementToken, token.AdditionToken,
+		token.IdentifierToken, token.DecrementToken, token.NegationToken,
+		token.IdentifierToken, token.LessThanOrEqualToken,
+		token.IdentifierToken, token.ShiftLeftToken, token.LessThanToken,
+		token.IdentifierToken, token.AndToken, token.BitwiseAndToken,
+		token.IdentifierToken, token.EofToken,
+	} {
+		assert.Equal(want, next().Type)
+	}
+}
+
+func TestLexMemberAccess(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("struct s.x->y. 5 .5").NextToken)
+	assert.Equal(token.Token{Type: token.StructKeywordToken, Value: "struct"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "s"}, next())
+	assert.Equal(token.Token{Type: token.DotToken, Value: "."}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "x"}, next())
+	assert.Equal(token.Token{Type: token.ArrowToken, Value: "->"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "y"}, next())
+	// A dot followed by a digit begins a floating-point constant.
+	assert.Equal(token.Token{Type: token.DotToken, Value: "."}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "5"}, next())
+	assert.Equal(token.Token{Type: token.FloatLiteralToken, Value: ".5"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexEllipsis(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("char *, ...) ..").NextToken)
+	assert.Equal(token.Token{Type: token.CharKeywordToken, Value: "char"}, next())
+	assert.Equal(token.MultiplicationToken, next().Type)
+	assert.Equal(token.CommaToken, next().Type)
+	assert.Equal(token.Token{Type: token.EllipsisToken, Value: "..."}, next())
+	assert.Equal(token.CloseParenthesisToken, next().Type)
+	// Fewer than three dots are member access operators.
+	assert.Equal(token.DotToken, next().Type)
+	assert.Equal(token.DotToken, next().Type)
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexSizeof(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("sizeof(int) sizeofx").NextToken)
+	assert.Equal(token.Token{Type: token.SizeofKeywordToken, Value: "sizeof"}, next())
+	assert.Equal(token.OpenParenthesisToken, next().Type)
+	assert.Equal(token.IntKeywordToken, next().Type)
+	assert.Equal(token.CloseParenthesisToken, next().Type)
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "sizeofx"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexEnum(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("enum e enums").NextToken)
+	assert.Equal(token.Token{Type: token.EnumKeywordToken, Value: "enum"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "e"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "enums"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexTypedef(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("typedef int T;").NextToken)
+	assert.Equal(token.Token{Type: token.TypedefKeywordToken, Value: "typedef"}, next())
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "T"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexGoto(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("goto end; end:").NextToken)
+	assert.Equal(token.Token{Type: token.GotoKeywordToken, Value: "goto"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "end"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "end"}, next())
+	assert.Equal(token.Token{Type: token.ColonToken, Value: ":"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexReaderRecoverFromReadError(t *testing.T) {
+	assert := assert.New(t)
+	r := iotest.TimeoutReader(strings.NewReader(strings.Repeat(" ", 5000)))
+	next := LexReader(r, RecoverFromErrors).NextToken
+	tok := next()
+	assert.Equal(token.ErrorToken, tok.Type)
+	assert.Equal("read error: timeout", tok.Value)
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexComments(t *testing.T) {
+	assert := assert.New(t)
+	input := `// A line comment.
+int main() { /* A block
+comment. */ return 1 / 2; // Trailing.
+}`
+	next := Lex(input).NextToken
+	assert.Equal(token.IntKeywordToken, next().Type)
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.OpenParenthesisToken, next().Type)
+	assert.Equal(token.CloseParenthesisToken, next().Type)
+	assert.Equal(token.OpenBraceToken, next().Type)
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return",
+		Offset: 55, Line: 3, Column: 13}, next())
+	assert.Equal(token.NumberToken, next().Type)
+	assert.Equal(token.DivisionToken, next().Type)
+	assert.Equal(token.NumberToken, next().Type)
+	assert.Equal(token.SemicolonToken, next().Type)
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}",
+		Offset: 82, Line: 4, Column: 1}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexPreserveComments(t *testing.T) {
+	assert := assert.New(t)
+	input := "// a\nreturn /* b */ 1; /**/"
+	next := Lex(input, PreserveComments).NextToken
+	assert.Equal(token.Token{Type: token.CommentToken, Value: "// a",
+		Offset: 0, Line: 1, Column: 1}, next())
+	assert.Equal(token.ReturnKeywordToken, next().Type)
+	assert.Equal(token.Token{Type: token.CommentToken, Value: "/* b */",
+		Offset: 12, Line: 2, Column: 8}, next())
+	assert.Equal(token.NumberToken, next().Type)
+	assert.Equal(token.SemicolonToken, next().Type)
+	assert.Equal(token.Token{Type: token.CommentToken, Value: "/**/",
+		Offset: 23, Line: 2, Column: 19}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestFindComment(t *testing.T) {
+	assert := assert.New(t)
+	pos, ok := FindComment("int x; @ \"//\" '/'\n  x /* a */ // b")
+	assert.True(ok)
+	assert.Equal(token.Position{Offset: 22, Line: 2, Column: 5}, pos)
+	_, ok = FindComment("int x = 4 / 2; char *s = \"/* a */\";")
+	assert.False(ok)
+}
+
+func TestLexPreserveTrivia(t *testing.T) {
+	assert := assert.New(t)
+	input := "// a\nint x = 'a'; /* b */\n\n  return \"\\n\"; // c\n"
+	next := Lex(input, PreserveTrivia).NextToken
+	tok := next()
+	assert.Equal(token.IntKeywordToken, tok.Type)
+	assert.Equal(&token.Trivia{Leading: "// a\n", Text: "int", Trailing: " "}, tok.Trivia)
+	assert.Equal(&token.Trivia{Text: "x", Trailing: " "}, next().Trivia)
+	assert.Equal(&token.Trivia{Text: "=", Trailing: " "}, next().Trivia)
+	tok = next()
+	assert.Equal(token.CharLiteralToken, tok.Type)
+	assert.Equal("a", tok.Value)
+	assert.Equal(&token.Trivia{Text: "'a'"}, tok.Trivia)
+	assert.Equal(&token.Trivia{Text: ";", Trailing: " /* b */"}, next().Trivia)
+	assert.Equal(&token.Trivia{Leading: "\n\n  ", Text: "return", Trailing: " "}, next().Trivia)
+	tok = next()
+	assert.Equal("\n", tok.Value)
+	assert.Equal(`"\n"`, tok.Trivia.Text)
+	assert.Equal(&token.Trivia{Text: ";", Trailing: " // c"}, next().Trivia)
+	tok = next()
+	assert.Equal(token.EofToken, tok.Type)
+	assert.Equal(&token.Trivia{Leading: "\n"}, tok.Trivia)
+	assert.Equal(token.EofToken, next().Type)
+}
+
+// source returns the sources of the tokens of an input, with their trivia.
+func source(lexer *Lexer) string {
+	var b strings.Builder
+	for {
+		t := lexer.NextToken()
+		b.WriteString(t.Source())
+		if t.Type == token.EofToken {
+			return b.String()
+		}
+	}
+}
+
+func TestLexPreserveTriviaReproducesInput(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"  \n\t",
+		"int main() {\n\treturn 0;\n}\n",
+		"/* a */ int /* b\n */ x; // c",
+		"# 1 \"a.c\"\nint x;\n#line 10\nint y;",
+		"char *s = \"\\x41\\t\"; float f = 1.5e3f; x->y ... <<= ",
+		"int 1x = @ y; \"a\n",
+	} {
+		assert.Equal(t, input, source(Lex(input, PreserveTrivia, RecoverFromErrors)), input)
+		assert.Equal(t, input, source(LexReader(strings.NewReader(input), PreserveTrivia,
+			RecoverFromErrors)), input)
+	}
+	// Comments which are preserved as tokens are not trivia.
+	assert.Equal(t, "a /* b */ c", source(Lex("a /* b */ c", PreserveTrivia, PreserveComments)))
+}
+
+func TestLexPreserveTriviaErrors(t *testing.T) {
+	assert := assert.New(t)
+	next := Lex("a @ b", PreserveTrivia, RecoverFromErrors).NextToken
+	assert.Equal(&token.Trivia{Text: "a", Trailing: " "}, next().Trivia)
+	tok := next()
+	assert.Equal(token.ErrorToken, tok.Type)
+	assert.Equal(&token.Trivia{Trailing: "@ "}, tok.Trivia)
+	assert.Equal(&token.Trivia{Text: "b"}, next().Trivia)
+
+	// Without recovery, the error is the last token before the end.
+	next = Lex("a @ b", PreserveTrivia).NextToken
+	assert.Equal(token.IdentifierToken, next().Type)
+	assert.Equal(token.ErrorToken, next().Type)
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexUnterminatedBlockComment(t *testing.T) {
+	assert := assert.New(t)
+	next := Lex("return 1; /* a\n * b *").NextToken
+	assert.Equal(token.ReturnKeywordToken, next().Type)
+	assert.Equal(token.NumberToken, next().Type)
+	assert.Equal(token.SemicolonToken, next().Type)
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "unterminated block comment", Offset: 10, Line: 1, Column: 11},
+		next())
+	assert.Equal(token.EofToken, next().Type)
+
+	tok := Lex("/* a *", RecoverFromErrors).NextToken()
+	assert.Equal(token.ErrorToken, tok.Type)
+}
+
+func TestLexReaderComments(t *testing.T) {
+	assert := assert.New(t)
+	input := "/* " + strings.Repeat("x", 10000) + " */ return;"
+	next := LexReader(iotest.OneByteReader(strings.NewReader(input))).NextToken
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return",
+		Offset: 10007, Line: 1, Column: 10008}, next())
+}
+
+func TestLexLineDirectives(t *testing.T) {
+	assert := assert.New(t)
+	input := "# 0 \"a.c\"\n# 1 \"a.c\"\nint x;\n  #line 10\n  y\n# 3 \"sys/b.h\" 1 3 4\nz"
+	for _, lexer := range []*Lexer{Lex(input), LexReader(iotest.OneByteReader(strings.NewReader(input)))} {
+		next := lexer.NextToken
+		assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int",
+			Offset: 20, Line: 1, Column: 1, Filename: "a.c"}, next())
+		assert.Equal(token.Position{Filename: "a.c", Offset: 24, Line: 1, Column: 5}, next().Position())
+		assert.Equal(token.SemicolonToken, next().Type)
+		assert.Equal(token.Token{Type: token.IdentifierToken, Value: "y",
+			Offset: 40, Line: 10, Column: 3, Filename: "a.c"}, next())
+		assert.Equal(token.Token{Type: token.IdentifierToken, Value: "z",
+			Offset: 62, Line: 3, Column: 1, Filename: "sys/b.h"}, next())
+		assert.Equal(token.EofToken, next().Type)
+	}
+
+	// Without a filename, only the line changes.
+	next := Lex("#line 5\nx\n# 2 \"\\\\b\\\"c\"\r\ny").NextToken
+	assert.Equal(token.Position{Offset: 8, Line: 5, Column: 1}, next().Position())
+	assert.Equal(token.Position{Filename: "\\b\"c", Offset: 24, Line: 2, Column: 1}, next().Position())
+}
+
+func TestLexBadLineDirectives(t *testing.T) {
+	assert := assert.New(t)
+	for input, want := range map[string]string{
+		"#line":                "#line directive requires a simple digit sequence",
+		"#line x":              "#line directive requires a simple digit sequence",
+		"#line 0\n":            "#line directive requires a positive integer argument",
+		"# 1x":                 "line marker directive requires a simple digit sequence",
+		"#line 1x":             "#line directive requires a simple digit sequence",
+		"#line 1 a.c":          "invalid filename for #line directive",
+		"#line 1 \"\"":         "invalid filename for #line directive",
+		"#line 1 \"a.c":        "invalid filename for #line directive",
+		"#line 1 \"a.c\" 2":    "extra tokens at end of #line directive",
+		"# 1 \"\\q\"":          "invalid filename for line marker directive",
+		"#define A 1":          "illegal character: `#`",
+		"#linex":               "illegal character: `#`",
+		"int x; # 1 \"a.c\"\n": "illegal character: `#`",
+	} {
+		lexer := Lex(input)
+		var tok token.Token
+		for tok = lexer.NextToken(); tok.Type != token.ErrorToken && tok.Type != token.EofToken; tok = lexer.NextToken() {
+		}
+		assert.Equal(token.ErrorToken, tok.Type, input)
+		assert.Equal(want, tok.Value, input)
+	}
+}
+
+func TestLexString(t *testing.T) {
+	assert := assert.New(t)
+	next := Lex(`return "hello, world";`).NextToken
+	assert.Equal(token.ReturnKeywordToken, next().Type)
+	assert.Equal(token.Token{Type: token.StringLiteralToken,
+		Value: "hello, world", Offset: 7, Line: 1, Column: 8}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";",
+		Offset: 21, Line: 1, Column: 22}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexStringEscapes(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]string{
+		`""`:            "",
+		`"a\nb\tc"`:     "a\nb\tc",
+		`"\\ \" \' \?"`: `\ " ' ?`,
+		`"\a\b\f\r\v"`:  "\a\b\f\r\v",
+		`"\x41\x7a\xf"`: "Az\x0f",
+		`"\x414"`:       "A4",
+		`"\101\0\1234"`: "A\x00S4",
+		`"\08"`:         "\x008",
+		"\"caf\u00e9\"": "caf\u00e9",
+	}
+	for input, want := range tests {
+		tok := Lex(input).NextToken()
+		assert.Equal(token.StringLiteralToken, tok.Type, input)
+		assert.Equal(want, tok.Value, input)
+	}
+}
+
+func TestLexUnterminatedString(t *testing.T) {
+	assert := assert.New(t)
+	next := Lex("int main() {\n  return \"abc\n}").NextToken
+	var tok token.Token
+	for tok = next(); tok.Type != token.ErrorToken; tok = next() {
+	}
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "unterminated string literal", Offset: 22, Line: 2, Column: 10},
+		tok)
+	assert.Equal(token.EofToken, next().Type)
+
+	tok = Lex(`"abc\`).NextToken()
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "unterminated string literal", Offset: 0, Line: 1, Column: 1},
+		tok)
+}
+
+func TestLexInvalidEscape(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]string{
+		`"a\qb"`: `invalid escape sequence in string literal: "\\q"`,
+		`"\xg"`:  `invalid escape sequence in string literal: "\\x"`,
+		`"\777"`: `invalid escape sequence in string literal: "\\777"`,
+	}
+	for input, want := range tests {
+		tok := Lex(input).NextToken()
+		assert.Equal(token.ErrorToken, tok.Type, input)
+		assert.Equal(want, tok.Value, input)
+	}
+}
+
+func TestLexRecoverFromBadString(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(
+		Lex("\"\\q\" 1; \"abc\n2;", RecoverFromErrors).NextToken)
+	assert.Equal(token.ErrorToken, next().Type)
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "1"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "unterminated string literal"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "2"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexChar(t *testing.T) {
+	assert := assert.New(t)
+	next := Lex(`return 'a' + '\n';`).NextToken
+	assert.Equal(token.ReturnKeywordToken, next().Type)
+	assert.Equal(token.Token{Type: token.CharLiteralToken, Value: "a",
+		Offset: 7, Line: 1, Column: 8}, next())
+	assert.Equal(token.AdditionToken, next().Type)
+	assert.Equal(token.Token{Type: token.CharLiteralToken, Value: "\n",
+		Offset: 13, Line: 1, Column: 14}, next())
+	assert.Equal(token.SemicolonToken, next().Type)
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexCharEscapes(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]string{
+		`'\0'`:   "\x00",
+		`'\''`:   "'",
+		`'"'`:    `"`,
+		`'\\'`:   `\`,
+		`'\x41'`: "A",
+		`'\177'`: "\x7f",
+		"'é'":    "é",
+		`'\xff'`: "ÿ",
+	}
+	for input, want := range tests {
+		tok := Lex(input).NextToken()
+		assert.Equal(token.CharLiteralToken, tok.Type, input)
+		assert.Equal(want, tok.Value, input)
+	}
+}
+
+func TestLexInvalidChar(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]string{
+		`''`:     "empty character constant",
+		`'ab'`:   `multi-character character constant: "'ab'"`,
+		`'\n\t'`: `multi-character character constant: "'\\n\\t'"`,
+		`'\q'`:   `invalid escape sequence in character constant: "\\q"`,
+		`'a`:     "unterminated character constant",
+		"'a\n'":  "unterminated character constant",
+		`'\`:     "unterminated character constant",
+	}
+	for input, want := range tests {
+		tok := Lex(input).NextToken()
+		assert.Equal(token.ErrorToken, tok.Type, input)
+		assert.Equal(want, tok.Value, input)
+		assert.Equal(token.Position{Offset: 0, Line: 1, Column: 1},
+			tok.Position(), input)
+	}
+}
+
+func TestLexReaderString(t *testing.T) {
+	assert := assert.New(t)
+	input := `return "a\x42c";`
+	next := stripPositions(
+		LexReader(iotest.OneByteReader(strings.NewReader(input))).NextToken)
+	assert.Equal(token.ReturnKeywordToken, next().Type)
+	assert.Equal(token.Token{Type: token.StringLiteralToken, Value: "aBc"}, next())
+	assert.Equal(token.SemicolonToken, next().Type)
+}
+
+// Comments and identifiers, which are scanned in runs of bytes, are split
+// between reads from a reader.
+func TestLexReaderRuns(t *testing.T) {
+	assert := assert.New(t)
+	input := largeProgram(1000)
+	lexer := Lex(input)
+	reader := LexReader(iotest.OneByteReader(strings.NewReader(input)), PreserveComments)
+	for tok := lexer.NextToken(); ; tok = lexer.NextToken() {
+		read := reader.NextToken()
+		for read.Type == token.CommentToken {
+			assert.True(read.Value == "/* A block comment. */" ||
+				strings.HasPrefix(read.Value, "// Function ") && strings.HasSuffix(read.Value, "."), read.Value)
+			read = reader.NextToken()
+		}
+		assert.Equal(tok, read)
+		if tok.Type == token.EofToken {
+			break
+		}
+	}
+}
+
 // Test inputs from github.com/nlsandler/write_a_c_compiler/stage_1/valid
 
 func TestLexMultiDigit(t *testing.T) {
@@ -13,16 +933,16 @@ func TestLexMultiDigit(t *testing.T) {
 	input := `int main() {
     return 100;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "100"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "100"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -38,32 +958,32 @@ return
 0
 ;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
 func TestLexNoNewlines(t *testing.T) {
 	assert := assert.New(t)
 	input := `int main(){return 0;}`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -72,16 +992,16 @@ func TestLexReturn0(t *testing.T) {
 	input := `int main() {
     return 0;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -90,32 +1010,32 @@ func TestLexReturn2(t *testing.T) {
 	input := `int main() {
     return 2;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "2"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "2"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
 func TestLexSpaces(t *testing.T) {
 	assert := assert.New(t)
 	input := `   int   main    (  )  {   return  0 ; }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -126,15 +1046,15 @@ func TestLexMissingParen(t *testing.T) {
 	input := `int main( {
     return 0;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -143,15 +1063,15 @@ func TestLexMissingRetval(t *testing.T) {
 	input := `int main() {
     return;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -160,13 +1080,13 @@ func TestLexNoBrace(t *testing.T) {
 	input := `int main {
     return 0;
 `
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -175,13 +1095,13 @@ func TestLexNoSemicolon(t *testing.T) {
 	input := `int main {
     return 0
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -190,15 +1110,15 @@ func TestLexNoSpace(t *testing.T) {
 	input := `int main() {
     return0;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "return0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "return0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -207,16 +1127,16 @@ func TestLexWrongCase(t *testing.T) {
 	input := `int main() {
     RETURN 0;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "RETURN"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "RETURN"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -227,17 +1147,17 @@ func TestLexBitwise(t *testing.T) {
 	input := `int main() {
     return !12;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.LogicalNegationToken, "!"}, next())
-	assert.Equal(token.Token{token.NumberToken, "12"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.LogicalNegationToken, Value: "!"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "12"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -246,17 +1166,17 @@ func TestLexBitwiseZero(t *testing.T) {
 	input := `int main() {
     return ~0;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.BitwiseComplementToken, "~"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.BitwiseComplementToken, Value: "~"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -265,17 +1185,17 @@ func TestLexNeg(t *testing.T) {
 	input := `int main() {
     return -5;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NegationToken, "-"}, next())
-	assert.Equal(token.Token{token.NumberToken, "5"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NegationToken, Value: "-"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "5"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -284,18 +1204,18 @@ func TestLexNestedOps(t *testing.T) {
 	input := `int main() {
     return !-3;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.LogicalNegationToken, "!"}, next())
-	assert.Equal(token.Token{token.NegationToken, "-"}, next())
-	assert.Equal(token.Token{token.NumberToken, "3"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.LogicalNegationToken, Value: "!"}, next())
+	assert.Equal(token.Token{Type: token.NegationToken, Value: "-"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "3"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -304,18 +1224,18 @@ func TestLexNestedOps2(t *testing.T) {
 	input := `int main() {
     return -~0;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NegationToken, "-"}, next())
-	assert.Equal(token.Token{token.BitwiseComplementToken, "~"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NegationToken, Value: "-"}, next())
+	assert.Equal(token.Token{Type: token.BitwiseComplementToken, Value: "~"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -324,17 +1244,17 @@ func TestLexNotFive(t *testing.T) {
 	input := `int main() {
     return !5;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.LogicalNegationToken, "!"}, next())
-	assert.Equal(token.Token{token.NumberToken, "5"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.LogicalNegationToken, Value: "!"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "5"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -343,17 +1263,17 @@ func TestLexNotZero(t *testing.T) {
 	input := `int main() {
     return !0;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.LogicalNegationToken, "!"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.LogicalNegationToken, Value: "!"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -364,16 +1284,16 @@ func TestLexMissingConst(t *testing.T) {
 	input := `int main() {
     return !;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.LogicalNegationToken, "!"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.LogicalNegationToken, Value: "!"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -382,16 +1302,16 @@ func TestLexMissingSemicolon(t *testing.T) {
 	input := `int main() {
     return !5
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.LogicalNegationToken, "!"}, next())
-	assert.Equal(token.Token{token.NumberToken, "5"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.LogicalNegationToken, Value: "!"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "5"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -400,17 +1320,17 @@ func TestLexNestedMissingConst(t *testing.T) {
 	input := `int main() {
     return !~;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.LogicalNegationToken, "!"}, next())
-	assert.Equal(token.Token{token.BitwiseComplementToken, "~"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.LogicalNegationToken, Value: "!"}, next())
+	assert.Equal(token.Token{Type: token.BitwiseComplementToken, Value: "~"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -419,17 +1339,17 @@ func TestLexWrongOrder(t *testing.T) {
 	input := `int main() {
     return 4-;
 }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "4"}, next())
-	assert.Equal(token.Token{token.NegationToken, "-"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "4"}, next())
+	assert.Equal(token.Token{Type: token.NegationToken, Value: "-"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -438,20 +1358,20 @@ func TestLexWrongOrder(t *testing.T) {
 func TestLexAssociativity(t *testing.T) {
 	assert := assert.New(t)
 	input := `int main() { return 1 - 2 - 3; }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "1"}, next())
-	assert.Equal(token.Token{token.NegationToken, "-"}, next())
-	assert.Equal(token.Token{token.NumberToken, "2"}, next())
-	assert.Equal(token.Token{token.NegationToken, "-"}, next())
-	assert.Equal(token.Token{token.NumberToken, "3"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "1"}, next())
+	assert.Equal(token.Token{Type: token.NegationToken, Value: "-"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "2"}, next())
+	assert.Equal(token.Token{Type: token.NegationToken, Value: "-"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "3"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
@@ -460,56 +1380,65 @@ func TestLexAssociativity(t *testing.T) {
 func TestLexAndFalse(t *testing.T) {
 	assert := assert.New(t)
 	input := `int main() { return 1 && 0; }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "1"}, next())
-	assert.Equal(token.Token{token.AndToken, "&&"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "1"}, next())
+	assert.Equal(token.Token{Type: token.AndToken, Value: "&&"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
 func TestLexAndTrue(t *testing.T) {
 	assert := assert.New(t)
 	input := `int main() { return 1 && -1; }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "1"}, next())
-	assert.Equal(token.Token{token.AndToken, "&&"}, next())
-	assert.Equal(token.Token{token.NegationToken, "-"}, next())
-	assert.Equal(token.Token{token.NumberToken, "1"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "1"}, next())
+	assert.Equal(token.Token{Type: token.AndToken, Value: "&&"}, next())
+	assert.Equal(token.Token{Type: token.NegationToken, Value: "-"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "1"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
 
 func TestLexPrecedence(t *testing.T) {
 	assert := assert.New(t)
 	input := `int main() { return 1 || 0 && 2; }`
-	next := Lex(input).NextToken
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, next())
-	assert.Equal(token.Token{token.NumberToken, "1"}, next())
-	assert.Equal(token.Token{token.OrToken, "||"}, next())
-	assert.Equal(token.Token{token.NumberToken, "0"}, next())
-	assert.Equal(token.Token{token.AndToken, "&&"}, next())
-	assert.Equal(token.Token{token.NumberToken, "2"}, next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, next())
+	next := stripPositions(Lex(input).NextToken)
+	assert.Equal(token.Token{Type: token.IntKeywordToken, Value: "int"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "main"}, next())
+	assert.Equal(token.Token{Type: token.OpenParenthesisToken, Value: "("}, next())
+	assert.Equal(token.Token{Type: token.CloseParenthesisToken, Value: ")"}, next())
+	assert.Equal(token.Token{Type: token.OpenBraceToken, Value: "{"}, next())
+	assert.Equal(token.Token{Type: token.ReturnKeywordToken, Value: "return"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "1"}, next())
+	assert.Equal(token.Token{Type: token.OrToken, Value: "||"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "0"}, next())
+	assert.Equal(token.Token{Type: token.AndToken, Value: "&&"}, next())
+	assert.Equal(token.Token{Type: token.NumberToken, Value: "2"}, next())
+	assert.Equal(token.Token{Type: token.SemicolonToken, Value: ";"}, next())
+	assert.Equal(token.Token{Type: token.CloseBraceToken, Value: "}"}, next())
+	assert.Equal(token.EofToken, next().Type)
+}
+
+func TestLexStorageClasses(t *testing.T) {
+	assert := assert.New(t)
+	next := stripPositions(Lex("extern static externs").NextToken)
+	assert.Equal(token.Token{Type: token.ExternKeywordToken, Value: "extern"}, next())
+	assert.Equal(token.Token{Type: token.StaticKeywordToken, Value: "static"}, next())
+	assert.Equal(token.Token{Type: token.IdentifierToken, Value: "externs"}, next())
 	assert.Equal(token.EofToken, next().Type)
 }
@@ -0,0 +1,128 @@
+package lexer
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An Edit of an input, as made by an editor: the Deleted bytes from Offset
+// are replaced by the Inserted text.
+type Edit struct {
+	Offset   int
+	Deleted  int
+	Inserted string
+}
+
+// Apply returns an input after the edit.
+func (e Edit) Apply(input string) string {
+	return input[:e.Offset] + e.Inserted + input[e.Offset+e.Deleted:]
+}
+
+// Relex returns the tokens of an input after an edit, given the input and its
+// tokens before it, up to and including the end of file token, as lexed with
+// the same options. Only the tokens from the one before the edit, up to the
+// first which the edit does not change, are lexed again, and the rest are
+// moved by the edit. The input after a line directive is numbered from the
+// directive, rather than moved, so if one may follow the edit, the rest of
+// the input is lexed again.
+func Relex(input string, tokens []token.Token, edit Edit, options ...Option) []token.Token {
+	relexed, _ := relex(input, tokens, edit, options)
+	return relexed
+}
+
+// relex returns the tokens of an input after an edit, and the number which
+// were lexed again.
+func relex(input string, tokens []token.Token, edit Edit, options []Option) ([]token.Token, int) {
+	output := edit.Apply(input)
+	end := edit.Offset + edit.Deleted // The end of the edit, before it.
+
+	// The lexer is in its start state at the start of each token but an
+	// error, which may be in the middle of the invalid input, or the end of
+	// file token after an error which stopped it. Lexing resumes at the last
+	// token to start before the edit, which it may extend.
+	restart := -1
+	for i, t := range tokens {
+		if t.Offset >= edit.Offset {
+			break
+		}
+		if t.Type != token.ErrorToken && t.Type != token.EofToken {
+			restart = i
+		}
+	}
+	lexer := Lex(output, options...)
+	var relexed []token.Token
+	if restart >= 0 {
+		t := tokens[restart]
+		relexed = append(relexed, tokens[:restart]...)
+		lexer.input = output[t.Offset:]
+		lexer.base = t.Offset
+		lexer.line, lexer.column, lexer.filename = t.Line, t.Column, t.Filename
+		lexer.lineStart = strings.TrimFunc(
+			input[strings.LastIndexByte(input[:t.Offset], '\n')+1:t.Offset], unicode.IsSpace) == ""
+		if t.Trivia != nil {
+			lexer.trivia = t.Trivia.Leading
+		}
+	}
+
+	// The tokens after the edit move by the change in the length of the
+	// input, and in its number of lines. Those on the line on which the edit
+	// ends move by the change in the length of the line before them.
+	offsets := len(edit.Inserted) - edit.Deleted
+	lines := strings.Count(edit.Inserted, "\n") - strings.Count(input[edit.Offset:end], "\n")
+	columns := lineLength(output[:edit.Offset+len(edit.Inserted)]) - lineLength(input[:end])
+	move := func(t token.Token) token.Token {
+		if !strings.Contains(input[end:t.Offset], "\n") {
+			t.Column += columns
+		}
+		t.Offset += offsets
+		t.Line += lines
+		return t
+	}
+	directive := mayHaveLineDirective(input[end:])
+
+	next := len(relexed) // The next old token which may follow the edit.
+	for n := 1; ; n++ {
+		t := lexer.NextToken()
+		relexed = append(relexed, t)
+		if t.Type == token.EofToken {
+			return relexed, n
+		}
+		if directive {
+			continue
+		}
+		for next < len(tokens) && (tokens[next].Offset < end || tokens[next].Offset+offsets < t.Offset) {
+			next++
+		}
+		// The rest of the input is unchanged after a token which is.
+		if next < len(tokens) && sameToken(move(tokens[next]), t) {
+			for _, t := range tokens[next+1:] {
+				relexed = append(relexed, move(t))
+			}
+			return relexed, n
+		}
+	}
+}
+
+// sameToken returns whether two tokens are the same but for their trivia.
+func sameToken(a, b token.Token) bool {
+	a.Trivia, b.Trivia = nil, nil
+	return a == b
+}
+
+// lineLength returns the number of runes of the last line of a text.
+func lineLength(text string) int {
+	return utf8.RuneCountInString(text[strings.LastIndexByte(text, '\n')+1:])
+}
+
+// mayHaveLineDirective returns whether a line of a text starts with "#",
+// after any whitespace, as does a line directive.
+func mayHaveLineDirective(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimLeftFunc(line, unicode.IsSpace), "#") {
+			return true
+		}
+	}
+	return false
+}
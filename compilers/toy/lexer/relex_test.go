@@ -0,0 +1,100 @@
+package lexer
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// tokensOf returns the tokens of an input, up to and including the end of
+// file token.
+func tokensOf(input string, options ...Option) []token.Token {
+	lexer := Lex(input, options...)
+	var tokens []token.Token
+	for {
+		t := lexer.NextToken()
+		tokens = append(tokens, t)
+		if t.Type == token.EofToken {
+			return tokens
+		}
+	}
+}
+
+func TestEditApply(t *testing.T) {
+	assert.Equal(t, "int y = 20;", Edit{Offset: 4, Deleted: 1, Inserted: "y"}.Apply("int x = 20;"))
+	assert.Equal(t, "ab", Edit{Offset: 2}.Apply("ab"))
+}
+
+func TestRelex(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main() {\n  int x = 1;\n  return x + 2;\n}\n"
+	tokens := tokensOf(input)
+
+	// Renaming a variable lexes the token before it, itself, and the first
+	// which is unchanged again.
+	edit := Edit{Offset: 19, Deleted: 1, Inserted: "count"}
+	relexed, n := relex(input, tokens, edit, nil)
+	assert.Equal(tokensOf(edit.Apply(input)), relexed)
+	assert.Equal(3, n)
+
+	// An edit which adds a line moves the tokens after it down.
+	edit = Edit{Offset: 26, Inserted: "\n  x = x * 3;"}
+	relexed, n = relex(input, tokens, edit, nil)
+	assert.Equal(tokensOf(edit.Apply(input)), relexed)
+	assert.Equal(8, n)
+
+	// Opening a comment changes every token after it, which are lost to the
+	// error of the unterminated comment.
+	edit = Edit{Offset: 26, Inserted: "/*"}
+	relexed, n = relex(input, tokens, edit, nil)
+	assert.Equal(tokensOf(edit.Apply(input)), relexed)
+	assert.Equal(3, n)
+	assert.Equal(token.ErrorToken, relexed[len(relexed)-2].Type)
+}
+
+func TestRelexLineDirectives(t *testing.T) {
+	assert := assert.New(t)
+	input := "int x;\n#line 10\nint y;\n"
+	tokens := tokensOf(input)
+	edit := Edit{Offset: 0, Inserted: "int w;\n"}
+	relexed, n := relex(input, tokens, edit, nil)
+	assert.Equal(tokensOf(edit.Apply(input)), relexed)
+	assert.Equal(10, n)
+	// The line after the directive is not moved.
+	assert.Equal(10, relexed[len(relexed)-2].Line)
+}
+
+func TestRelexMatchesLex(t *testing.T) {
+	inputs := []string{
+		"int main() {\n  return 100;\n}",
+		"float f = 1.5e10f; /* a\n b */ char *s = \"a\\tb\"; // c\nint é = '\\n';",
+		"a+++b---c<=d<<<e&&&f>>=g\n\tx->y ... z.w",
+		"# 1 \"a.c\"\nint x;\n  # 5\nint y;",
+		"int @ x = 08; \"unterminated\n'a' 1.e",
+	}
+	optionSets := [][]Option{
+		nil,
+		{RecoverFromErrors},
+		{RecoverFromErrors, PreserveTrivia},
+		{PreserveComments, PreserveTrivia},
+	}
+	texts := []string{"", "x", " ", "\n", "/*", "*/", "\"", "//", "#", "1.", "é"}
+	for _, input := range inputs {
+		for _, options := range optionSets {
+			tokens := tokensOf(input, options...)
+			// Every edit of up to two bytes, at each rune boundary.
+			for offset := range input + " " {
+				for deleted := 0; deleted <= 2 && offset+deleted <= len(input); deleted++ {
+					for _, text := range texts {
+						edit := Edit{Offset: offset, Deleted: deleted, Inserted: text}
+						output := edit.Apply(input)
+						if !assert.Equal(t, tokensOf(output, options...),
+							Relex(input, tokens, edit, options...), "%q to %q", input, output) {
+							return
+						}
+					}
+				}
+			}
+		}
+	}
+}
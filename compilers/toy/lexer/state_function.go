@@ -1,7 +1,10 @@
 package lexer
 
 import (
+	"fmt"
 	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"golang.org/x/text/unicode/norm"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -9,167 +12,539 @@ import (
 
 type stateFunction func(*Lexer) stateFunction
 
-const eofRune = rune(0)
+// The rune returned at the end of the input. It is not a valid rune, so that a
+// NUL in the input is not mistaken for the end.
+const eofRune = rune(-1)
 
-func isIdentifierRune(r rune) bool {
-	return unicode.IsDigit(r) || unicode.IsLetter(r) || r == '_'
-}
+// The length of the longest operator matched by prefix in lexStartState.
+const maxPrefixLength = len("<<=")
 
-func identifierLookAhead(lexer *Lexer, prefix string) bool {
-	// No room to look-ahead.
-	if len(lexer.input) <= lexer.position+len(prefix) {
-		return false
+// isIdentifierStart returns whether a rune may begin an identifier: an
+// underscore, or an ID_Start character of Unicode Standard Annex #31, which
+// is a letter of any script.
+func isIdentifierStart(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_'
 	}
+	return (unicode.IsLetter(r) || unicode.In(r, unicode.Nl, unicode.Other_ID_Start)) &&
+		!unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
 
-	// Check if next character is part of an identifier.
-	r, _ := utf8.DecodeRuneInString(
-		lexer.input[lexer.position+len(prefix):])
-	if isIdentifierRune(r) {
-		return true
+// isIdentifierRune returns whether a rune may continue an identifier: an
+// underscore, or an ID_Continue character of Unicode Standard Annex #31,
+// which adds digits, combining marks and connectors to the ID_Start
+// characters.
+func isIdentifierRune(r rune) bool {
+	if r < utf8.RuneSelf {
+		return isIdentifierStart(r) || isDecimalDigit(r)
 	}
+	return isIdentifierStart(r) ||
+		unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+			!unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+// isInvisible returns whether a rune is a format character, which is not
+// displayed, such as a zero width space or a control of the direction of
+// text, and so may hide the meaning of the source from its reader.
+func isInvisible(r rune) bool {
+	return unicode.Is(unicode.Cf, r)
+}
 
-	return false
+// An operator or punctuator, which is matched by its text.
+type operator struct {
+	text string
+	t    token.TokenType
+}
+
+// The operators and punctuators matched by prefix in lexStartState, by their
+// first byte. Longer operators come first, so that the longest which is a
+// prefix of the input is matched.
+var operators [256][]operator
+
+func init() {
+	for _, o := range []operator{
+		{"<<=", token.ShiftLeftAssignmentToken},
+		{">>=", token.ShiftRightAssignmentToken},
+		{"...", token.EllipsisToken},
+		{"++", token.IncrementToken},
+		{"--", token.DecrementToken},
+		{"->", token.ArrowToken},
+		{"+=", token.AdditionAssignmentToken},
+		{"-=", token.SubtractionAssignmentToken},
+		{"*=", token.MultiplicationAssignmentToken},
+		{"/=", token.DivisionAssignmentToken},
+		{"%=", token.ModuloAssignmentToken},
+		{"&=", token.BitwiseAndAssignmentToken},
+		{"|=", token.BitwiseOrAssignmentToken},
+		{"^=", token.BitwiseXorAssignmentToken},
+		{"<<", token.ShiftLeftToken},
+		{">>", token.ShiftRightToken},
+		{"&&", token.AndToken},
+		{"||", token.OrToken},
+		{"!=", token.NotEqualToken},
+		{"<=", token.LessThanOrEqualToken},
+		{">=", token.GreaterThanOrEqualToken},
+		{"==", token.EqualToken},
+		{"{", token.OpenBraceToken},
+		{"}", token.CloseBraceToken},
+		{"(", token.OpenParenthesisToken},
+		{")", token.CloseParenthesisToken},
+		{"[", token.OpenBracketToken},
+		{"]", token.CloseBracketToken},
+		{";", token.SemicolonToken},
+		{",", token.CommaToken},
+		{":", token.ColonToken},
+		{"?", token.QuestionToken},
+		{"!", token.LogicalNegationToken},
+		{"~", token.BitwiseComplementToken},
+		{"-", token.NegationToken},
+		{"+", token.AdditionToken},
+		{"*", token.MultiplicationToken},
+		{"/", token.DivisionToken},
+		{"%", token.ModuloToken},
+		{"&", token.BitwiseAndToken},
+		{"|", token.BitwiseOrToken},
+		{"^", token.BitwiseXorToken},
+		{"<", token.LessThanToken},
+		{">", token.GreaterThanToken},
+		{"=", token.AssignmentToken},
+	} {
+		operators[o.text[0]] = append(operators[o.text[0]], o)
+	}
 }
 
 // The initial state function.
 func lexStartState(lexer *Lexer) stateFunction {
 	for {
-		candidateToken := lexer.input[lexer.position:]
+		lexer.skipSpace()
+		// Identifiers are the most common tokens, so are looked for first.
+		if lexer.position < len(lexer.input) && isASCIIIdentifierStart(lexer.input[lexer.position]) {
+			return lexIdentifier(lexer)
+		}
+		candidateToken := lexer.lookahead(maxPrefixLength)
 
-		// FIXME: This lookahead logic for int and return is overly convoluted.
-		if strings.HasPrefix(candidateToken, "int") {
-			if identifierLookAhead(lexer, "int") {
-				return lexIdentifier
-			}
-			return emit(3, token.IntKeywordToken, lexStartState, lexer)
-		} else if strings.HasPrefix(candidateToken, "return") {
-			if identifierLookAhead(lexer, "return") {
-				return lexIdentifier
+		if candidateToken == "" {
+			if err := lexer.readErr; err != nil {
+				// Report the error only once.
+				lexer.readErr = nil
+				return lexer.errorf("read error: %v", err)
 			}
-			return emit(len("return"), token.ReturnKeywordToken, lexStartState, lexer)
-		} else if strings.HasPrefix(candidateToken, "&&") {
-			return emit(2, token.AndToken, lexStartState, lexer)
-		} else if strings.HasPrefix(candidateToken, "||") {
-			return emit(2, token.OrToken, lexStartState, lexer)
-		} else if strings.HasPrefix(candidateToken, "!=") {
-			return emit(2, token.NotEqualToken, lexStartState, lexer)
-		} else if strings.HasPrefix(candidateToken, "<=") {
-			return emit(2, token.LessThanOrEqualToken, lexStartState, lexer)
-		} else if strings.HasPrefix(candidateToken, ">=") {
-			return emit(2, token.GreaterThanOrEqualToken, lexStartState, lexer)
-		} else if strings.HasPrefix(candidateToken, "==") {
-			return emit(2, token.EqualToken, lexStartState, lexer)
-		} else if strings.HasPrefix(candidateToken, "!=") {
-			return emit(2, token.NotEqualToken, lexStartState, lexer)
-		}
-
-		if lexer.peek() == eofRune {
 			return nil
 		}
 
-		// TODO: There's some confusion here. One of the switches looks at the
-		// current character, the other looks at next(). Remove one of these.
-		switch r, _ := utf8.DecodeRuneInString(lexer.input[lexer.position:]); {
-		case r == '{':
-			return emit(1, token.OpenBraceToken, lexStartState, lexer)
-		case r == '}':
-			return emit(1, token.CloseBraceToken, lexStartState, lexer)
-		case r == '(':
-			return emit(1, token.OpenParenthesisToken, lexStartState, lexer)
-		case r == ')':
-			return emit(1, token.CloseParenthesisToken, lexStartState, lexer)
-		case r == ';':
-			return emit(1, token.SemicolonToken, lexStartState, lexer)
-		case r == '!':
-			return emit(1, token.LogicalNegationToken, lexStartState, lexer)
-		case r == '~':
-			return emit(1, token.BitwiseComplementToken, lexStartState, lexer)
-		case r == '-':
-			return emit(1, token.NegationToken, lexStartState, lexer)
-		case r == '+':
-			return emit(1, token.AdditionToken, lexStartState, lexer)
-		case r == '*':
-			return emit(1, token.MultiplicationToken, lexStartState, lexer)
-		case r == '/':
-			return emit(1, token.DivisionToken, lexStartState, lexer)
-		case r == '<':
-			return emit(1, token.LessThanToken, lexStartState, lexer)
-		case r == '>':
-			return emit(1, token.GreaterThanToken, lexStartState, lexer)
+		// The states which scan tokens are called directly, rather than
+		// returned, to save a round trip through NextToken.
+		if strings.HasPrefix(candidateToken, "//") {
+			return lexLineComment(lexer)
+		} else if strings.HasPrefix(candidateToken, "/*") {
+			return lexBlockComment(lexer)
+		}
+		for _, o := range operators[candidateToken[0]] {
+			if strings.HasPrefix(candidateToken, o.text) {
+				lexer.position += len(o.text)
+				lexer.emit(o.t)
+				return lexStartState
+			}
 		}
 
 		switch r := lexer.next(); {
 		case unicode.IsSpace(r) || r == '\n':
 			lexer.ignore()
-		case unicode.IsDigit(r):
+		case isDecimalDigit(r):
 			lexer.Backup()
-			return lexNumber
-		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return lexNumber(lexer)
+		case r == '.' && isDecimalDigit(lexer.peek()):
 			lexer.Backup()
-			return lexIdentifier
+			return lexNumber(lexer)
+		case r == '.':
+			lexer.emit(token.DotToken)
+			return lexStartState
+		case r == '"':
+			return lexString(lexer)
+		case r == '\'':
+			return lexChar(lexer)
+		case r == '#' && lexer.lineStart:
+			return lexLineDirective(lexer)
+		case isIdentifierStart(r):
+			lexer.Backup()
+			return lexIdentifier(lexer)
+		case isInvisible(r):
+			return lexer.errorf("illegal invisible character %U", r)
 		default:
 			return lexer.errorf("illegal character: `%v`", string(r))
 		}
 	}
-	panic("unreachable!")
 }
 
+// The digits of each integer base.
+const (
+	decimalDigits     = "0123456789"
+	octalDigits       = "01234567"
+	hexadecimalDigits = "0123456789abcdefABCDEF"
+)
+
+// lexNumber scans a decimal, octal ("0755"), hexadecimal ("0x1F") or binary
+// ("0b1010") integer, which may have a suffix ("10u", "10l", "10ul"), or a
+// decimal floating-point constant ("1.5", ".5", "1e10", "1.5f"). The value
+// of the literal is left to the parser.
 func lexNumber(lexer *Lexer) stateFunction {
-	digits := "0123456789"
-	// Is it hex or octal?
-	if lexer.accept("0") && lexer.accept("xX") {
-		digits = "0123456789abcdefABCDEF"
-	} else if lexer.accept("0") {
-		digits = "01234567"
+	if lexer.accept("0") {
+		if lexer.accept("xX") {
+			return lexPrefixedNumber(lexer, hexadecimalDigits)
+		} else if lexer.accept("bB") {
+			return lexPrefixedNumber(lexer, "01")
+		}
 	}
-	lexer.acceptRun(digits)
+	lexer.acceptRun(decimalDigits)
+
+	float := false
 	if lexer.accept(".") {
-		lexer.acceptRun(digits)
+		float = true
+		lexer.acceptRun(decimalDigits)
 	}
 	if lexer.accept("eE") {
+		float = true
 		lexer.accept("+-")
-		lexer.acceptRun("0123456789")
+		if !lexer.accept(decimalDigits) {
+			return lexBadNumber(lexer)
+		}
+		lexer.acceptRun(decimalDigits)
+	}
+	if float {
+		lexer.accept("fF")
+		return lexNumberEnd(lexer, token.FloatLiteralToken)
+	}
+
+	// An integer with a leading zero is octal.
+	text := lexer.input[lexer.startPosition:lexer.position]
+	if text[0] == '0' && strings.Trim(text, octalDigits) != "" {
+		return lexBadNumber(lexer)
+	}
+	return lexIntegerSuffix(lexer)
+}
+
+// lexPrefixedNumber scans the digits of a hexadecimal or binary integer, after
+// its prefix.
+func lexPrefixedNumber(lexer *Lexer, digits string) stateFunction {
+	if !lexer.accept(digits) {
+		return lexBadNumber(lexer)
 	}
+	lexer.acceptRun(digits)
+	return lexIntegerSuffix(lexer)
+}
+
+// lexIntegerSuffix scans the suffix of an integer, if it has one: "u" for
+// unsigned, "l" for long, or both, in either order and either case.
+func lexIntegerSuffix(lexer *Lexer) stateFunction {
+	if lexer.accept("uU") {
+		lexer.accept("lL")
+	} else if lexer.accept("lL") {
+		lexer.accept("uU")
+	}
+	return lexNumberEnd(lexer, token.NumberToken)
+}
 
-	if unicode.IsDigit(lexer.peek()) || unicode.IsLetter(lexer.peek()) {
+// lexNumberEnd emits a number, which must not run into an identifier.
+func lexNumberEnd(lexer *Lexer, t token.TokenType) stateFunction {
+	if isIdentifierRune(lexer.peek()) {
+		return lexBadNumber(lexer)
+	}
+	lexer.emit(t)
+	return lexStartState
+}
+
+// lexBadNumber reports a malformed number, including the rune which follows
+// it if that is part of the same word.
+func lexBadNumber(lexer *Lexer) stateFunction {
+	if isIdentifierRune(lexer.peek()) {
 		lexer.next()
-		return lexer.errorf("Bad number syntax: %q",
-			lexer.input[lexer.startPosition:lexer.position])
 	}
+	return lexer.errorf("Bad number syntax: %q",
+		lexer.input[lexer.startPosition:lexer.position])
+}
+
+// lexLineComment scans a comment from "//" up to the end of the line.
+func lexLineComment(lexer *Lexer) stateFunction {
+	lexer.skipTo('\n')
+	return lexComment(lexer)
+}
+
+// lexBlockComment scans a comment from "/*" up to the next "*/".
+func lexBlockComment(lexer *Lexer) stateFunction {
+	lexer.position += len("/*")
+	for lexer.skipTo('*'); !strings.HasPrefix(lexer.lookahead(2), "*/"); lexer.skipTo('*') {
+		if lexer.next() == eofRune {
+			return lexer.errorf("unterminated block comment")
+		}
+	}
+	lexer.position += len("*/")
+	return lexComment(lexer)
+}
 
-	lexer.emit(token.NumberToken)
+// lexComment emits or skips a scanned comment.
+func lexComment(lexer *Lexer) stateFunction {
+	if lexer.preserveComments {
+		lexer.emit(token.CommentToken)
+	} else {
+		lexer.ignore()
+	}
 	return lexStartState
 }
 
-func lexIdentifier(lexer *Lexer) stateFunction {
+// lexLineDirective scans a line directive, after the "#" which starts its
+// line. This is "#line 10" or `#line 10 "a.c"`, or a line marker such as
+// `# 10 "a.c" 2`, as written by preprocessors to give the source locations of
+// their output. The directive is skipped, and the lines after it are numbered
+// from the given line, in the given file. There are no other directives after
+// preprocessing.
+func lexLineDirective(lexer *Lexer) stateFunction {
+	lexer.acceptRun(" \t")
+	directive := "line marker directive"
+	if rest := lexer.lookahead(len("line ")); strings.HasPrefix(rest, "line") &&
+		(len(rest) == len("line") || strings.ContainsAny(rest[len("line"):], " \t\r\n")) {
+		lexer.position += len("line")
+		lexer.acceptRun(" \t")
+		directive = "#line directive"
+	} else if !isDecimalDigit(lexer.peek()) {
+		lexer.position = lexer.startPosition + 1
+		return lexer.errorf("illegal character: `#`")
+	}
+
+	// Preprocessors write line markers for line 0, before the first line.
+	start := lexer.position
+	lexer.acceptRun(decimalDigits)
+	line, err := strconv.Atoi(lexer.input[start:lexer.position])
+	if err != nil || !strings.ContainsRune(" \t\r\n", lexer.peek()) && lexer.peek() != eofRune {
+		return lexer.errorf("%s requires a simple digit sequence", directive)
+	} else if line == 0 && directive == "#line directive" {
+		return lexer.errorf("%s requires a positive integer argument", directive)
+	}
+	lexer.acceptRun(" \t")
+	filename := ""
+	if lexer.accept(`"`) {
+		var value []byte
+		for r := lexer.next(); r != '"'; r = lexer.next() {
+			switch r {
+			case '\n', eofRune:
+				return lexer.errorf("invalid filename for %s", directive)
+			case '\\':
+				c, ok := lexEscape(lexer)
+				if !ok {
+					return lexer.errorf("invalid filename for %s", directive)
+				}
+				value = append(value, c)
+			default:
+				value = append(value, string(r)...)
+			}
+		}
+		filename = string(value)
+		if filename == "" {
+			return lexer.errorf("invalid filename for %s", directive)
+		}
+	}
+	lexer.acceptRun(" \t\r")
+
+	// A line marker may be followed by flags, which are ignored.
+	if r := lexer.peek(); r != '\n' && r != eofRune {
+		if directive == "#line directive" && filename != "" {
+			return lexer.errorf("extra tokens at end of %s", directive)
+		} else if filename == "" {
+			return lexer.errorf("invalid filename for %s", directive)
+		}
+		for r := lexer.peek(); r != '\n' && r != eofRune; r = lexer.peek() {
+			lexer.next()
+		}
+	}
+	lexer.accept("\n")
+	lexer.ignore()
+	lexer.line = line
+	if filename != "" {
+		lexer.filename = filename
+	}
+	return lexStartState
+}
+
+// The values of single character escape sequences.
+var simpleEscapes = map[rune]byte{
+	'a':  '\a',
+	'b':  '\b',
+	'f':  '\f',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'v':  '\v',
+	'\\': '\\',
+	'\'': '\'',
+	'"':  '"',
+	'?':  '?',
+}
+
+// lexString scans a string literal, after the opening quote. The emitted token
+// carries the decoded value of the string.
+func lexString(lexer *Lexer) stateFunction {
+	var value []byte
+	var err string // The first invalid escape sequence, if any.
 	for {
-		r := lexer.peek()
-		if r == eofRune {
-			return lexer.errorf("Unterminated identifier")
+		switch r := lexer.next(); r {
+		case '"':
+			if err != "" {
+				return lexer.errorf("%s", err)
+			}
+			lexer.emitValue(token.StringLiteralToken, string(value))
+			return lexStartState
+		case '\n', eofRune:
+			lexer.Backup()
+			return lexer.errorf("unterminated string literal")
+		case '\\':
+			start := lexer.position - 1
+			c, ok := lexEscape(lexer)
+			if !ok && err == "" {
+				err = fmt.Sprintf("invalid escape sequence in string literal: %q",
+					lexer.input[start:lexer.position])
+			}
+			value = append(value, c)
+		default:
+			value = append(value, string(r)...)
 		}
-		if !(unicode.IsDigit(r) || unicode.IsLetter(r) || r == '_') {
-			break
+	}
+}
+
+// lexChar scans a character constant, after the opening quote. The emitted
+// token carries the decoded rune.
+func lexChar(lexer *Lexer) stateFunction {
+	var value []rune
+	var err string // The first invalid escape sequence, if any.
+	for {
+		switch r := lexer.next(); r {
+		case '\'':
+			switch {
+			case err != "":
+				return lexer.errorf("%s", err)
+			case len(value) == 0:
+				return lexer.errorf("empty character constant")
+			case len(value) > 1:
+				return lexer.errorf("multi-character character constant: %q",
+					lexer.input[lexer.startPosition:lexer.position])
+			}
+			lexer.emitValue(token.CharLiteralToken, string(value))
+			return lexStartState
+		case '\n', eofRune:
+			lexer.Backup()
+			return lexer.errorf("unterminated character constant")
+		case '\\':
+			start := lexer.position - 1
+			c, ok := lexEscape(lexer)
+			if !ok && err == "" {
+				err = fmt.Sprintf(
+					"invalid escape sequence in character constant: %q",
+					lexer.input[start:lexer.position])
+			}
+			value = append(value, rune(c))
+		default:
+			value = append(value, r)
 		}
-		lexer.next()
 	}
+}
 
-	r := lexer.peek()
-	if !(unicode.IsSpace(r) || r == '\n' || r == '(' || r == ')' ||
-		r == ';') {
-		lexer.next()
-		return lexer.errorf("Bad identifier: %v",
-			lexer.input[lexer.startPosition:lexer.position])
+// lexEscape decodes an escape sequence, after the backslash.
+func lexEscape(lexer *Lexer) (byte, bool) {
+	r := lexer.next()
+	if c, ok := simpleEscapes[r]; ok {
+		return c, true
 	}
+	switch {
+	case r == 'x':
+		// One or two hexadecimal digits.
+		value, n := 0, 0
+		for ; n < 2 && isHexDigit(lexer.peek()); n++ {
+			value = value*16 + hexValue(lexer.next())
+		}
+		return byte(value), n > 0
+	case r >= '0' && r <= '7':
+		// Up to three octal digits.
+		value := int(r - '0')
+		for n := 1; n < 3 && isOctalDigit(lexer.peek()); n++ {
+			value = value*8 + int(lexer.next()-'0')
+		}
+		return byte(value), value <= 0xff
+	case r == '\n' || r == eofRune:
+		// Leave the string unterminated.
+		lexer.Backup()
+	}
+	return 0, false
+}
+
+// isDecimalDigit returns whether a rune is an ASCII digit. Unlike
+// unicode.IsDigit, it excludes the digits of other scripts, which cannot
+// begin a number.
+func isDecimalDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isOctalDigit(r rune) bool {
+	return r >= '0' && r <= '7'
+}
+
+func isHexDigit(r rune) bool {
+	return isDecimalDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func hexValue(r rune) int {
+	switch {
+	case r >= 'a':
+		return int(r-'a') + 10
+	case r >= 'A':
+		return int(r-'A') + 10
+	}
+	return int(r - '0')
+}
 
-	lexer.emit(token.IdentifierToken)
+// lexIdentifier scans an identifier, which is a keyword if it is a reserved
+// word. The value of an identifier with non-ASCII characters is normalized
+// to NFC, so that the symbol table sees one spelling of each name, however
+// its accents were composed in the source.
+func lexIdentifier(lexer *Lexer) stateFunction {
+	// Scan the ASCII characters of the identifier a byte at a time, and the
+	// rest, if it has any other characters, a rune at a time.
+	for lexer.fill(1); lexer.position < len(lexer.input) &&
+		isASCIIIdentifierByte(lexer.input[lexer.position]); lexer.fill(1) {
+		lexer.position++
+	}
+	ascii := true
+	if lexer.position < len(lexer.input) && lexer.input[lexer.position] >= utf8.RuneSelf {
+		for isIdentifierRune(lexer.peek()) {
+			ascii = lexer.next() < utf8.RuneSelf && ascii
+		}
+	}
+	text := lexer.input[lexer.startPosition:lexer.position]
+	if ascii {
+		lexer.emit(token.Lookup(text))
+	} else {
+		value := norm.NFC.String(text)
+		lexer.emitValue(token.Lookup(value), value)
+	}
 	return lexStartState
 }
 
-func emit(len int, t token.TokenType, nextState stateFunction,
-	lexer *Lexer) func(lexer *Lexer) stateFunction {
-	return func(lexer *Lexer) stateFunction {
-		lexer.position += len
-		lexer.emit(t)
-		return nextState
+func isASCIIIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isASCIIIdentifierByte(c byte) bool {
+	return isASCIIIdentifierStart(c) || isDecimalDigit(rune(c))
+}
+
+// isDelimiter returns whether a rune separates tokens.
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("{}();=", r)
+}
+
+// lexSkipInvalid discards input up to the next whitespace or delimiter, so
+// that lexing can resume after an error.
+func lexSkipInvalid(lexer *Lexer) stateFunction {
+	for r := lexer.peek(); r != eofRune && !isDelimiter(r); r = lexer.peek() {
+		lexer.next()
 	}
+	lexer.ignore()
+	return lexStartState
 }
@@ -4,43 +4,120 @@ import (
 	"github.com/ChrisCummins/phd/compilers/toy/token"
 )
 
+// LexerTokenStream adapts a Lexer to the token.TokenStream interface, so that
+// the parser can consume tokens as they are lexed. Lookahead tokens are
+// buffered to implement Peek and PeekN, as are the tokens consumed since the
+// oldest checkpoint, to implement Rewind. The stream ends at the first
+// EofToken or ErrorToken, which remains available from Value and Peek.
 type LexerTokenStream struct {
-	lex     *Lexer
-	prev    token.Token
-	current token.Token
-	next    token.Token
+	lex *Lexer
+	// The tokens which have been lexed, from the one at the index base of
+	// the stream, and the index in the buffer of the next token. Those
+	// before the next token, the current one and the oldest checkpoint are
+	// discarded as the stream advances.
+	buffer []token.Token
+	base   int
+	next   int
+	// The checkpoints which have not been rewound to or released, oldest
+	// first.
+	checkpoints []token.Checkpoint
+	done        bool // Whether the lexer has produced its final token.
 }
 
+var _ token.TokenStream = (*LexerTokenStream)(nil)
+
 func NewLexerTokenStream(lex *Lexer) *LexerTokenStream {
-	ts := &LexerTokenStream{lex: lex, current: token.Token{Type: token.EofToken}}
-	ts.next = ts.lex.NextToken()
+	ts := &LexerTokenStream{lex: lex, buffer: make([]token.Token, 0, 64)}
+	ts.fill(1)
 	return ts
 }
 
-func (ts *LexerTokenStream) Next() bool {
-	ts.prev = ts.current
-	ts.current = ts.next
-
-	switch ts.current.Type {
-	case token.ErrorToken:
-		return false
-	case token.EofToken:
-		return false
+// isFinal returns whether a token ends the stream.
+func isFinal(t *token.Token) bool {
+	return t.Type == token.EofToken || t.Type == token.ErrorToken
+}
+
+// fill ensures that at least n lookahead tokens are buffered. Once the lexer
+// has produced its final token, the buffer is padded with copies of it.
+func (ts *LexerTokenStream) fill(n int) {
+	for len(ts.buffer)-ts.next < n {
+		if ts.done {
+			ts.buffer = append(ts.buffer, ts.buffer[len(ts.buffer)-1])
+		} else {
+			ts.buffer = append(ts.buffer, token.Token{})
+			t := &ts.buffer[len(ts.buffer)-1]
+			ts.lex.scan(t)
+			ts.done = isFinal(t)
+		}
 	}
+}
 
-	ts.next = ts.lex.NextToken()
-	return true
+// discard drops the buffered tokens which can no longer be read, once the
+// buffer is full and they make up half of it, so that the buffer does not
+// grow without bound, and tokens are moved in batches rather than one at a
+// time.
+func (ts *LexerTokenStream) discard() {
+	if len(ts.buffer) < cap(ts.buffer) {
+		return
+	}
+	keep := ts.base + ts.next - 1 // The current token.
+	if len(ts.checkpoints) > 0 {
+		keep = int(ts.checkpoints[0]) - 1
+	}
+	n := keep - ts.base
+	if n <= 0 || 2*n < len(ts.buffer) {
+		return
+	}
+	ts.buffer = ts.buffer[:copy(ts.buffer, ts.buffer[n:])]
+	ts.base += n
+	ts.next -= n
 }
 
-func (ts *LexerTokenStream) Value() token.Token {
-	return ts.current
+func (ts *LexerTokenStream) Next() bool {
+	// Consuming the final token leaves the stream on a copy of it.
+	ts.fill(1)
+	final := isFinal(&ts.buffer[ts.next])
+	ts.next++
+	ts.discard()
+	return !final
 }
 
-func (ts *LexerTokenStream) backup() {
-	ts.next = ts.current
-	ts.current = ts.prev
+func (ts *LexerTokenStream) Value() token.Token {
+	if ts.next == 0 {
+		return token.Token{Type: token.EofToken}
+	}
+	return ts.buffer[ts.next-1]
 }
 
 func (ts *LexerTokenStream) Peek() token.Token {
-	return ts.next
+	return ts.PeekN(1)
+}
+
+func (ts *LexerTokenStream) PeekN(n int) token.Token {
+	if n < 1 {
+		panic("PeekN requires n >= 1")
+	}
+	ts.fill(n)
+	return ts.buffer[ts.next+n-1]
+}
+
+func (ts *LexerTokenStream) Checkpoint() token.Checkpoint {
+	c := token.Checkpoint(ts.base + ts.next)
+	ts.checkpoints = append(ts.checkpoints, c)
+	return c
+}
+
+func (ts *LexerTokenStream) Rewind(c token.Checkpoint) {
+	ts.Release(c)
+	ts.next = int(c) - ts.base
+}
+
+func (ts *LexerTokenStream) Release(c token.Checkpoint) {
+	for i := len(ts.checkpoints) - 1; i >= 0; i-- {
+		if ts.checkpoints[i] == c {
+			ts.checkpoints = ts.checkpoints[:i]
+			return
+		}
+	}
+	panic("checkpoint has been released")
 }
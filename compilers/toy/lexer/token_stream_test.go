@@ -1,8 +1,10 @@
 package lexer
 
 import (
+	"fmt"
 	"github.com/ChrisCummins/phd/compilers/toy/token"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -13,22 +15,174 @@ func TestLexTokenStreamMultiDigit(t *testing.T) {
 }`
 	ts := NewLexerTokenStream(Lex(input))
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.IntKeywordToken, "int"}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.IntKeywordToken, Value: "int", Offset: 0, Line: 1, Column: 1,
+	}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.IdentifierToken, "main"}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.IdentifierToken, Value: "main", Offset: 4, Line: 1, Column: 5,
+	}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.OpenParenthesisToken, "("}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.OpenParenthesisToken, Value: "(", Offset: 8, Line: 1, Column: 9,
+	}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.CloseParenthesisToken, ")"}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.CloseParenthesisToken, Value: ")", Offset: 9, Line: 1, Column: 10,
+	}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.OpenBraceToken, "{"}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.OpenBraceToken, Value: "{", Offset: 11, Line: 1, Column: 12,
+	}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.ReturnKeywordToken, "return"}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.ReturnKeywordToken, Value: "return", Offset: 17, Line: 2, Column: 5,
+	}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.NumberToken, "100"}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.NumberToken, Value: "100", Offset: 24, Line: 2, Column: 12,
+	}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.SemicolonToken, ";"}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.SemicolonToken, Value: ";", Offset: 27, Line: 2, Column: 15,
+	}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(token.Token{token.CloseBraceToken, "}"}, ts.Value())
+	assert.Equal(token.Token{
+		Type: token.CloseBraceToken, Value: "}", Offset: 29, Line: 3, Column: 1,
+	}, ts.Value())
 	assert.False(ts.Next())
 }
+
+func TestLexTokenStreamPeek(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewLexerTokenStream(Lex("return 1;"))
+	// Peek does not consume tokens.
+	assert.Equal(token.ReturnKeywordToken, ts.Peek().Type)
+	assert.Equal(token.ReturnKeywordToken, ts.Peek().Type)
+	assert.True(ts.Next())
+	assert.Equal(token.ReturnKeywordToken, ts.Value().Type)
+	assert.Equal(token.NumberToken, ts.Peek().Type)
+	assert.True(ts.Next())
+	assert.True(ts.Next())
+	assert.Equal(token.SemicolonToken, ts.Value().Type)
+	assert.Equal(token.EofToken, ts.Peek().Type)
+	assert.False(ts.Next())
+	assert.Equal(token.EofToken, ts.Value().Type)
+	// The stream remains at the end.
+	assert.False(ts.Next())
+	assert.Equal(token.EofToken, ts.Peek().Type)
+}
+
+func TestLexTokenStreamError(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewLexerTokenStream(Lex("return @;"))
+	assert.True(ts.Next())
+	assert.Equal(token.ErrorToken, ts.Peek().Type)
+	assert.False(ts.Next())
+	assert.Equal(token.Token{Type: token.ErrorToken,
+		Value: "illegal character: `@`", Offset: 7, Line: 1, Column: 8},
+		ts.Value())
+	assert.Equal(token.ErrorToken, ts.Peek().Type)
+}
+
+func TestLexTokenStreamPeekN(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewLexerTokenStream(Lex("( int ) x ;"))
+	assert.Equal(token.OpenParenthesisToken, ts.PeekN(1).Type)
+	assert.Equal(token.IntKeywordToken, ts.PeekN(2).Type)
+	assert.Equal(token.CloseParenthesisToken, ts.PeekN(3).Type)
+	assert.Equal(token.IdentifierToken, ts.PeekN(4).Type)
+	assert.Equal(token.SemicolonToken, ts.PeekN(5).Type)
+	assert.Equal(token.EofToken, ts.PeekN(6).Type)
+	// Past the end of the stream, the final token is repeated.
+	assert.Equal(token.EofToken, ts.PeekN(9).Type)
+
+	// Consuming tokens shifts the lookahead.
+	assert.True(ts.Next())
+	assert.Equal(token.OpenParenthesisToken, ts.Value().Type)
+	assert.Equal(token.IntKeywordToken, ts.Peek().Type)
+	assert.Equal(token.IdentifierToken, ts.PeekN(3).Type)
+	assert.Panics(func() { ts.PeekN(0) })
+}
+
+func TestLexTokenStreamPeekNDiscardsConsumedTokens(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewLexerTokenStream(Lex("1 2 3 4 5 6 7 8 9 10 11 12"))
+	// Interleave consuming and peeking so that consumed tokens are discarded
+	// as the lookahead moves.
+	for i := 1; i <= 10; i++ {
+		assert.Equal(fmt.Sprint(i+2), ts.PeekN(3).Value)
+		assert.True(ts.Next())
+		assert.Equal(fmt.Sprint(i), ts.Value().Value)
+	}
+	assert.Equal("12", ts.PeekN(2).Value)
+	assert.Equal(token.EofToken, ts.PeekN(3).Type)
+}
+
+func TestLexTokenStreamPeekNError(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewLexerTokenStream(Lex("1 @ 2"))
+	assert.Equal(token.ErrorToken, ts.PeekN(2).Type)
+	assert.Equal(token.ErrorToken, ts.PeekN(3).Type)
+	assert.True(ts.Next())
+	assert.False(ts.Next())
+	assert.Equal(token.ErrorToken, ts.Value().Type)
+}
+
+func TestLexTokenStreamRewind(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewLexerTokenStream(Lex("1 2 3 4 5"))
+	assert.True(ts.Next())
+	outer := ts.Checkpoint()
+	assert.True(ts.Next())
+	inner := ts.Checkpoint()
+	assert.True(ts.Next())
+	assert.Equal("3", ts.Value().Value)
+	ts.Rewind(inner)
+	assert.Equal("2", ts.Value().Value)
+	assert.Equal("3", ts.Peek().Value)
+	assert.True(ts.Next())
+	assert.True(ts.Next())
+	assert.True(ts.Next())
+	assert.False(ts.Next())
+	assert.Equal(token.EofToken, ts.Value().Type)
+	// Rewinding past the end of the stream reads its tokens again.
+	ts.Rewind(outer)
+	assert.Equal("1", ts.Value().Value)
+	assert.Equal("2", ts.Peek().Value)
+	assert.Equal("4", ts.PeekN(3).Value)
+	// The checkpoints are released.
+	assert.Panics(func() { ts.Rewind(inner) })
+}
+
+func TestLexTokenStreamRewindToStart(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewLexerTokenStream(Lex("x;"))
+	c := ts.Checkpoint()
+	for ts.Next() {
+	}
+	ts.Rewind(c)
+	assert.Equal(token.EofToken, ts.Value().Type)
+	assert.True(ts.Next())
+	assert.Equal("x", ts.Value().Value)
+}
+
+func TestLexTokenStreamKeepsTokensSinceCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewLexerTokenStream(Lex(strings.Repeat("x ", 1000)))
+	assert.True(ts.Next())
+	c := ts.Checkpoint()
+	for i := 0; i < 50; i++ {
+		assert.True(ts.Next())
+	}
+	ts.Rewind(c)
+	assert.True(ts.Next())
+	assert.Equal(1, ts.Value().Offset/2)
+
+	// Without a checkpoint, consumed tokens are discarded.
+	c = ts.Checkpoint()
+	ts.Release(c)
+	for ts.Next() {
+	}
+	assert.True(len(ts.buffer) < 100)
+}
@@ -0,0 +1,182 @@
+package opt
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// A warning about a program which is valid, but probably not what was meant.
+type Warning struct {
+	Pos token.Position
+	Msg string
+	// The name of the check which found it, such as diag.UnreachableCode.
+	Name string
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%v: warning: %s", w.Pos, w.Msg)
+}
+
+// Diagnostic returns the warning as a diagnostic, whose code is the name of
+// its check.
+func (w *Warning) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{
+		Severity: diag.Warning,
+		Pos:      w.Pos,
+		Msg:      w.Msg,
+		Code:     w.Name,
+	}
+}
+
+// EliminateDeadCode removes the statements of each block which follow an
+// unconditional jump out of it, such as a return, break or goto, or an
+// infinite loop, since they can never be executed, unless they are labelled.
+// A warning is returned for each statement removed, in source order.
+func EliminateDeadCode(program *ast.Program) []*Warning {
+	var warnings []*Warning
+	for _, f := range program.Functions {
+		f.Body, _ = eliminateDeadCode(f.Body, &warnings)
+	}
+	return warnings
+}
+
+// eliminateDeadCode removes the unreachable statements from a list, and
+// returns whether control can reach the end of the list. A statement which
+// contains a case label is reachable by a jump from its switch, and one which
+// contains a label by a goto.
+func eliminateDeadCode(statements []ast.Statement, warnings *[]*Warning) ([]ast.Statement, bool) {
+	live := statements[:0]
+	reachable := true
+	for _, s := range statements {
+		if !reachable && !hasLabel(s, true) {
+			*warnings = append(*warnings, &Warning{
+				Pos:  s.Pos(),
+				Msg:  "unreachable code",
+				Name: diag.UnreachableCode,
+			})
+			continue
+		}
+		live = append(live, s)
+		reachable = reachesEnd(s, warnings)
+	}
+	return live, reachable
+}
+
+// reachesEnd removes the unreachable statements nested in a statement, and
+// returns whether control can flow from the statement to the next one.
+func reachesEnd(s ast.Statement, warnings *[]*Warning) bool {
+	switch n := s.(type) {
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement,
+		*ast.GotoStatement:
+		return false
+	case *ast.Block:
+		var ok bool
+		n.Statements, ok = eliminateDeadCode(n.Statements, warnings)
+		return ok
+	case *ast.IfStatement:
+		// Both branches are visited, so that each reports its own dead code.
+		then := reachesEnd(n.Then, warnings)
+		if n.Else == nil {
+			return true
+		}
+		return reachesEnd(n.Else, warnings) || then
+	case *ast.WhileStatement:
+		reachesEnd(n.Body, warnings)
+		return !isTrue(n.Cond) || jumpsTo(n.Body, n, true)
+	case *ast.ForStatement:
+		reachesEnd(n.Body, warnings)
+		return (n.Cond != nil && !isTrue(n.Cond)) || jumpsTo(n.Body, n, true)
+	case *ast.DoWhileStatement:
+		// The condition is only reached if the body can complete.
+		body := reachesEnd(n.Body, warnings) || jumpsTo(n.Body, n, false)
+		return (body && !isTrue(n.Cond)) || jumpsTo(n.Body, n, true)
+	case *ast.SwitchStatement:
+		// Without a default label, a switch may jump over its body.
+		body := reachesEnd(n.Body, warnings)
+		return body || !hasDefault(n) || jumpsTo(n.Body, n, true)
+	case *ast.CaseStatement:
+		return reachesEnd(n.Body, warnings)
+	case *ast.LabeledStatement:
+		return reachesEnd(n.Body, warnings)
+	}
+	return true
+}
+
+func hasDefault(s *ast.SwitchStatement) bool {
+	for _, c := range s.Cases {
+		if c.Value == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLabel returns whether a statement contains a label, or if cases is
+// true, a case label of an enclosing switch.
+func hasLabel(s ast.Statement, cases bool) bool {
+	switch n := s.(type) {
+	case *ast.LabeledStatement:
+		return true
+	case *ast.CaseStatement:
+		return cases || hasLabel(n.Body, cases)
+	case *ast.Block:
+		for _, s := range n.Statements {
+			if hasLabel(s, cases) {
+				return true
+			}
+		}
+	case *ast.IfStatement:
+		return hasLabel(n.Then, cases) || (n.Else != nil && hasLabel(n.Else, cases))
+	case *ast.WhileStatement:
+		return hasLabel(n.Body, cases)
+	case *ast.DoWhileStatement:
+		return hasLabel(n.Body, cases)
+	case *ast.ForStatement:
+		return hasLabel(n.Body, cases)
+	case *ast.SwitchStatement:
+		// The case labels of a nested switch belong to it.
+		return hasLabel(n.Body, false)
+	}
+	return false
+}
+
+// isTrue returns whether a condition is a non-zero integer constant.
+func isTrue(cond ast.Expression) bool {
+	l, ok := cond.(*ast.IntLiteral)
+	return ok && l.Value != 0
+}
+
+// jumpsTo returns whether a statement contains a break from the given loop or
+// switch, or if breaks is false, a continue of it.
+func jumpsTo(s ast.Statement, loop ast.Statement, breaks bool) bool {
+	switch n := s.(type) {
+	case *ast.BreakStatement:
+		return breaks && n.Target == loop
+	case *ast.ContinueStatement:
+		return !breaks && n.Target == loop
+	case *ast.Block:
+		for _, s := range n.Statements {
+			if jumpsTo(s, loop, breaks) {
+				return true
+			}
+		}
+	case *ast.IfStatement:
+		return jumpsTo(n.Then, loop, breaks) ||
+			(n.Else != nil && jumpsTo(n.Else, loop, breaks))
+	case *ast.WhileStatement:
+		return jumpsTo(n.Body, loop, breaks)
+	case *ast.DoWhileStatement:
+		return jumpsTo(n.Body, loop, breaks)
+	case *ast.ForStatement:
+		return jumpsTo(n.Body, loop, breaks)
+	case *ast.SwitchStatement:
+		return jumpsTo(n.Body, loop, breaks)
+	case *ast.CaseStatement:
+		return jumpsTo(n.Body, loop, breaks)
+	case *ast.LabeledStatement:
+		return jumpsTo(n.Body, loop, breaks)
+	}
+	return false
+}
@@ -0,0 +1,388 @@
+package opt
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// eliminate removes the dead code from a program, returning the formatted
+// result and the warnings.
+func eliminate(t *testing.T, input string) (string, []string) {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	for _, w := range EliminateDeadCode(program) {
+		warnings = append(warnings, w.String())
+	}
+	return ast.Format(program), warnings
+}
+
+func TestEliminateDeadCodeAfterReturn(t *testing.T) {
+	assert := assert.New(t)
+	program, warnings := eliminate(t, `int main() {
+    int a = 1;
+    return a;
+    a = 2;
+    return 3;
+}`)
+	assert.Equal(`int main() {
+    int a = 1;
+    return a;
+}
+`, program)
+	assert.Equal([]string{
+		"4:5: warning: unreachable code",
+		"5:5: warning: unreachable code",
+	}, warnings)
+}
+
+func TestWarningDiagnostic(t *testing.T) {
+	assert := assert.New(t)
+	w := &Warning{Pos: token.Position{Offset: 3, Line: 1, Column: 4}, Msg: "unreachable code",
+		Name: diag.UnreachableCode}
+	assert.Equal(&diag.Diagnostic{
+		Severity: diag.Warning,
+		Pos:      w.Pos,
+		Msg:      "unreachable code",
+		Code:     "unreachable-code",
+	}, w.Diagnostic())
+}
+
+func TestEliminateDeadCodeInBlock(t *testing.T) {
+	assert := assert.New(t)
+	program, warnings := eliminate(t, `int main() {
+    {
+        return 1;
+        2;
+    }
+    {
+        3;
+    }
+}`)
+	// A block which returns makes the statements after it unreachable too.
+	assert.Equal(`int main() {
+    {
+        return 1;
+    }
+}
+`, program)
+	assert.Equal([]string{
+		"4:9: warning: unreachable code",
+		"6:5: warning: unreachable code",
+	}, warnings)
+}
+
+func TestEliminateDeadCodeAfterIf(t *testing.T) {
+	assert := assert.New(t)
+	program, warnings := eliminate(t, `int main() {
+    if (1) {
+        return 1;
+        1;
+    } else
+        return 2;
+    return 3;
+}`)
+	// Both branches return, so the statement after the if is unreachable.
+	assert.Equal(`int main() {
+    if (1) {
+        return 1;
+    } else
+        return 2;
+}
+`, program)
+	assert.Equal([]string{
+		"4:9: warning: unreachable code",
+		"7:5: warning: unreachable code",
+	}, warnings)
+}
+
+func TestEliminateDeadCodeAfterIfWithoutDeadCode(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main() {
+    if (1)
+        return 1;
+    if (2)
+        return 2;
+    else {
+    }
+    return 3;
+}
+`
+	program, warnings := eliminate(t, input)
+	assert.Equal(input, program)
+	assert.Empty(warnings)
+}
+
+func TestEliminateDeadCodeAfterJump(t *testing.T) {
+	assert := assert.New(t)
+	program, warnings := eliminate(t, `int main() {
+    while (1) {
+        if (2) {
+            continue;
+            3;
+        }
+        break;
+        4;
+    }
+    return 5;
+}`)
+	assert.Equal(`int main() {
+    while (1) {
+        if (2) {
+            continue;
+        }
+        break;
+    }
+    return 5;
+}
+`, program)
+	assert.Equal([]string{
+		"5:13: warning: unreachable code",
+		"8:9: warning: unreachable code",
+	}, warnings)
+}
+
+func TestEliminateDeadCodeAfterGoto(t *testing.T) {
+	assert := assert.New(t)
+	// A labelled statement after a goto is reachable by a jump.
+	program, warnings := eliminate(t, `int main() {
+    goto a;
+    1;
+    {
+        2;
+    a:
+        3;
+    }
+    while (1) {
+        goto b;
+        4;
+    }
+    5;
+b:
+    return 6;
+}`)
+	assert.Equal(`int main() {
+    goto a;
+    {
+        2;
+    a:
+        3;
+    }
+    while (1) {
+        goto b;
+    }
+b:
+    return 6;
+}
+`, program)
+	assert.Equal([]string{
+		"3:5: warning: unreachable code",
+		"11:9: warning: unreachable code",
+		"13:5: warning: unreachable code",
+	}, warnings)
+}
+
+func TestEliminateDeadCodeAfterInfiniteLoop(t *testing.T) {
+	assert := assert.New(t)
+	program, warnings := eliminate(t, `int main() {
+    while (1) {
+        for (;;) {
+            break;
+        }
+    }
+    return 1;
+}
+
+int f() {
+    for (;;) {
+    }
+    return 2;
+}
+
+int g() {
+    do {
+        return 3;
+    } while (0);
+    return 4;
+}
+`)
+	// The break exits the inner loop, but not the outer one.
+	assert.Equal(`int main() {
+    while (1) {
+        for (;;) {
+            break;
+        }
+    }
+}
+
+int f() {
+    for (;;) {
+    }
+}
+
+int g() {
+    do {
+        return 3;
+    } while (0);
+}
+`, program)
+	assert.Equal([]string{
+		"7:5: warning: unreachable code",
+		"13:5: warning: unreachable code",
+		"20:5: warning: unreachable code",
+	}, warnings)
+}
+
+func TestEliminateDeadCodeAfterLoopWithoutDeadCode(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main() {
+    int a = 1;
+    while (1) {
+        if (a)
+            break;
+    }
+    for (;;) {
+        while (a) {
+        }
+        break;
+    }
+    do {
+        if (a)
+            continue;
+        return 1;
+    } while (a);
+    while (a)
+        return 2;
+    return 3;
+}
+`
+	program, warnings := eliminate(t, input)
+	assert.Equal(input, program)
+	assert.Empty(warnings)
+}
+
+func TestEliminateDeadCodeAfterSwitch(t *testing.T) {
+	assert := assert.New(t)
+	program, warnings := eliminate(t, `int f(int a) {
+    switch (a) {
+    case 1:
+        return 1;
+        a = 2;
+    case 2:
+        {
+            return 2;
+            a = 3;
+        case 3:
+            return 3;
+        }
+    default:
+        return 4;
+    }
+    return 5;
+}`)
+	// Statements containing a case label are reachable from the switch.
+	assert.Equal(`int f(int a) {
+    switch (a) {
+    case 1:
+        return 1;
+    case 2:
+        {
+            return 2;
+        case 3:
+            return 3;
+        }
+    default:
+        return 4;
+    }
+}
+`, program)
+	assert.Equal([]string{
+		"5:9: warning: unreachable code",
+		"9:13: warning: unreachable code",
+		"16:5: warning: unreachable code",
+	}, warnings)
+}
+
+func TestEliminateDeadCodeAfterSwitchWithoutDeadCode(t *testing.T) {
+	assert := assert.New(t)
+	// Control reaches the end of a switch without a default, or which is
+	// broken out of, or whose last case completes.
+	input := `int f(int a) {
+    switch (a) {
+    case 1:
+        return 1;
+    }
+    switch (a) {
+    case 1:
+        if (a)
+            break;
+        return 1;
+    default:
+        return 2;
+    }
+    switch (a) {
+    default:
+        return 1;
+    case 2:
+        a = 3;
+    }
+    return 2;
+}
+`
+	program, warnings := eliminate(t, input)
+	assert.Equal(input, program)
+	assert.Empty(warnings)
+}
+
+func TestEliminateDeadCodeAfterLoopWithSwitch(t *testing.T) {
+	assert := assert.New(t)
+	// A break in a switch does not exit the enclosing loop.
+	program, warnings := eliminate(t, `int f(int a) {
+    while (1) {
+        switch (a) {
+        default:
+            break;
+        }
+    }
+    return 1;
+}`)
+	assert.Equal(`int f(int a) {
+    while (1) {
+        switch (a) {
+        default:
+            break;
+        }
+    }
+}
+`, program)
+	assert.Equal([]string{"8:5: warning: unreachable code"}, warnings)
+}
+
+func TestEliminateDeadCodeWithoutDeadCode(t *testing.T) {
+	assert := assert.New(t)
+	input := `int main() {
+    int a = 1;
+    {
+        a = 2;
+    }
+    return a;
+}
+
+int f() {
+}
+`
+	program, warnings := eliminate(t, input)
+	assert.Equal(input, program)
+	assert.Empty(warnings)
+}
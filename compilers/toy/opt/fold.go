@@ -0,0 +1,75 @@
+package opt
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/consteval"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// FoldConstants replaces int and long expressions, signed or unsigned, whose
+// operands are constants with their value, as are sizeof expressions and
+// enumerators.
+// Arithmetic wraps as it does at run time, and expressions which would trap,
+// such as division by zero, are left to run time.
+func FoldConstants(program *ast.Program) {
+	foldConstants(program, false)
+}
+
+// foldConstants folds the constant expressions of a program, except those
+// whose int arithmetic overflows if overflow is trapped, which are left to
+// trap at run time.
+func foldConstants(program *ast.Program, trapOverflow bool) {
+	evaluate := consteval.Int
+	if trapOverflow {
+		evaluate = consteval.Exact
+	}
+	for _, f := range program.Functions {
+		ast.Rewrite(f, func(n ast.Node) ast.Node {
+			if e, ok := n.(ast.Expression); ok {
+				return fold(e, evaluate)
+			}
+			return n
+		})
+	}
+}
+
+// literal returns an integer literal with the position and type of the
+// expression it replaces.
+func literal(e ast.Expression, value int64) *ast.IntLiteral {
+	pos := e.Pos()
+	return &ast.IntLiteral{
+		Token: token.Token{
+			Type:   token.NumberToken,
+			Offset: pos.Offset,
+			Line:   pos.Line,
+			Column: pos.Column,
+		},
+		Value: value,
+		Type:  ast.TypeOf(e),
+	}
+}
+
+// fold returns the value of an expression whose operands have been folded,
+// if evaluate finds it constant, and otherwise the expression.
+func fold(e ast.Expression, evaluate func(ast.Expression) (int64, bool)) ast.Expression {
+	switch n := e.(type) {
+	case *ast.UnaryOp, *ast.BinaryOp, *ast.Sizeof, *ast.Identifier:
+		if t := ast.TypeOf(n); !types.IsInteger(t) || types.Width(t) < 32 {
+			break
+		}
+		if v, ok := evaluate(n); ok {
+			return literal(n, v)
+		}
+	case *ast.ConditionalExpression:
+		// Only the operand which is selected by a constant condition is
+		// evaluated, so the other may be dropped.
+		if x, ok := evaluate(n.Cond); ok {
+			if x != 0 {
+				return n.Then
+			}
+			return n.Else
+		}
+	}
+	return e
+}
@@ -0,0 +1,306 @@
+package opt
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// foldReturn folds the program "int main() { <body> return <e>; }" and
+// returns the value of its final return statement.
+func foldReturn(t *testing.T, body, e string) ast.Expression {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(
+		lexer.Lex("int main() { " + body + " return " + e + "; }")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	FoldConstants(program)
+	statements := program.Functions[0].Body
+	return statements[len(statements)-1].(*ast.ReturnStatement).Value
+}
+
+// folded returns the value that an expression folds to.
+func folded(t *testing.T, e string) int64 {
+	l, ok := foldReturn(t, "", e).(*ast.IntLiteral)
+	if !ok {
+		t.Fatalf("%s was not folded", e)
+	}
+	assert.Equal(t, types.Int, l.Type)
+	return l.Value
+}
+
+func TestFoldArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(7), folded(t, "1 + 2 * 3"))
+	assert.Equal(int64(-1), folded(t, "2 - 3"))
+	assert.Equal(int64(-3), folded(t, "-7 / 2"))
+	assert.Equal(int64(3), folded(t, "(1 + 2) * (6 / 3) / 2"))
+	assert.Equal(int64(-1), folded(t, "-7 % 2"))
+	assert.Equal(int64(1), folded(t, "7 % -3"))
+}
+
+func TestFoldWrapsAround(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(-2147483648), folded(t, "2147483647 + 1"))
+	assert.Equal(int64(-2147483648), folded(t, "-(-2147483647 - 1)"))
+	assert.Equal(int64(0), folded(t, "65536 * 65536"))
+}
+
+func TestFoldUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	// The value returned is converted to an int, which is not folded.
+	l, ok := foldReturn(t, "", "0u - 1 >> 1").(*ast.Conversion).Operand.(*ast.IntLiteral)
+	if assert.True(ok) {
+		assert.Equal(types.UnsignedInt, l.Type)
+		assert.Equal(int64(2147483647), l.Value)
+	}
+	assert.Equal(int64(1), folded(t, "-1 > 1u"))
+}
+
+func TestFoldLong(t *testing.T) {
+	assert := assert.New(t)
+	l, ok := foldReturn(t, "", "65536L * 65536 + 1").(*ast.Conversion).Operand.(*ast.IntLiteral)
+	if assert.True(ok) {
+		assert.Equal(types.Long, l.Type)
+		assert.Equal(int64(4294967297), l.Value)
+	}
+	assert.Equal(int64(1), folded(t, "-1UL >> 63 == 1"))
+}
+
+func TestFoldTrapsOverflow(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		"int main() { return (2147483647 + 1) * 2 + -(-2147483647 - 1) + 2 * 3; }")))
+	assert.Nil(err)
+	assert.Nil(sema.Check(program))
+	// Arithmetic which overflows, and which uses its result, is not folded.
+	foldConstants(program, true)
+	assert.Equal("int main() {\n    return (2147483647 + 1) * 2 + -(-2147483648) + 6;\n}\n",
+		ast.Format(program))
+}
+
+func TestFoldUnaryOps(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(-5), folded(t, "-5"))
+	assert.Equal(int64(-6), folded(t, "~5"))
+	assert.Equal(int64(0), folded(t, "!5"))
+	assert.Equal(int64(1), folded(t, "!0"))
+	assert.Equal(int64(5), folded(t, "-~!0 + 3"))
+}
+
+func TestFoldBitwiseOps(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(2), folded(t, "6 & 3"))
+	assert.Equal(int64(7), folded(t, "6 | 3"))
+	assert.Equal(int64(5), folded(t, "6 ^ 3"))
+	assert.Equal(int64(6), folded(t, "~1 & 6 | 1 ^ 1"))
+	assert.Equal(int64(-4), folded(t, "-1 << 2"))
+	assert.Equal(int64(-1), folded(t, "-7 >> 3"))
+	assert.Equal(int64(-2147483648), folded(t, "1 << 31"))
+	// The count of a shift is taken modulo 32, as it is at run time.
+	assert.Equal(int64(2), folded(t, "1 << 33"))
+	assert.Equal(int64(-2147483648), folded(t, "1 << -1"))
+}
+
+func TestFoldComparisons(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(1), folded(t, "1 < 2"))
+	assert.Equal(int64(0), folded(t, "2 <= 1"))
+	assert.Equal(int64(1), folded(t, "2 > -1"))
+	assert.Equal(int64(1), folded(t, "2 >= 2"))
+	assert.Equal(int64(1), folded(t, "3 == 3"))
+	assert.Equal(int64(0), folded(t, "3 != 3"))
+}
+
+func TestFoldLogicalOps(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(1), folded(t, "1 && 2"))
+	assert.Equal(int64(0), folded(t, "1 && 0"))
+	assert.Equal(int64(1), folded(t, "0 || 2"))
+	assert.Equal(int64(0), folded(t, "0 || 0"))
+}
+
+func TestFoldShortCircuitsLogicalOps(t *testing.T) {
+	assert := assert.New(t)
+	// The right operand is never evaluated, so need not be constant.
+	l, ok := foldReturn(t, "int a;", "0 && (a = 1)").(*ast.IntLiteral)
+	assert.True(ok)
+	assert.Equal(int64(0), l.Value)
+	l, ok = foldReturn(t, "int a;", "2 || (a = 1)").(*ast.IntLiteral)
+	assert.True(ok)
+	assert.Equal(int64(1), l.Value)
+
+	// Otherwise, it must be evaluated.
+	_, ok = foldReturn(t, "int a;", "1 && (a = 1)").(*ast.BinaryOp)
+	assert.True(ok)
+	// As must a left operand, even if the right operand decides the result.
+	_, ok = foldReturn(t, "int a;", "(a = 1) && 0").(*ast.BinaryOp)
+	assert.True(ok)
+}
+
+func TestFoldConditional(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(3), folded(t, "1 + 1 ? 3 : 4"))
+	assert.Equal(int64(5), folded(t, "0 ? 4 : 2 < 1 ? 4 : 5"))
+	// The operand which is not selected is never evaluated, so need not be
+	// constant.
+	e := foldReturn(t, "int a;", "1 ? a + 2 * 3 : (a = 1)")
+	assert.Equal("(a + 6)", e.String())
+	e = foldReturn(t, "int a;", "1 - 1 ? 1 / 0 : a")
+	assert.Equal("a", e.String())
+	// Otherwise, the operands are folded.
+	e = foldReturn(t, "int a;", "a ? 2 * 3 : 4 - 5")
+	assert.Equal("(a ? 6 : -1)", e.String())
+}
+
+func TestFoldSizeof(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(16), folded(t, "sizeof(double [2])"))
+	assert.Equal(int64(10), folded(t, "sizeof(int) * 2 + sizeof(char [2])"))
+	// The operand is dropped, even if it has side effects.
+	e := foldReturn(t, "int a;", "sizeof a++ + a")
+	assert.Equal("4 + a", ast.Format(e))
+}
+
+func TestFoldEnumerators(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(
+		lexer.Lex("enum { A = 2, B }; int main() { int a; return A * B + a; }")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	FoldConstants(program)
+	assert.Equal("6 + a", ast.Format(program.Functions[0].Body[1].(*ast.ReturnStatement).Value))
+}
+
+func TestFoldLeavesTrapsToRunTime(t *testing.T) {
+	assert := assert.New(t)
+	_, ok := foldReturn(t, "", "1 / 0").(*ast.BinaryOp)
+	assert.True(ok)
+	_, ok = foldReturn(t, "", "(-2147483647 - 1) / -1").(*ast.BinaryOp)
+	assert.True(ok)
+	_, ok = foldReturn(t, "", "1 % 0").(*ast.BinaryOp)
+	assert.True(ok)
+	_, ok = foldReturn(t, "", "(-2147483647 - 1) % -1").(*ast.BinaryOp)
+	assert.True(ok)
+}
+
+func TestFoldSubexpressions(t *testing.T) {
+	assert := assert.New(t)
+	e := foldReturn(t, "int a;", "a + 2 * 3")
+	assert.Equal("(a + 6)", e.(*ast.BinaryOp).String())
+	e = foldReturn(t, "int a;", "a *= 2 - 3")
+	assert.Equal("(a *= -1)", e.String())
+	assert.Equal(types.Int, ast.TypeOf(e))
+
+	// Integer operands of floating-point expressions are folded, but the
+	// conversion is not. The result is converted back to int on return.
+	e = foldReturn(t, "double d;", "d + (1 + 2)")
+	c := e.(*ast.Conversion).Operand.(*ast.BinaryOp).Rhs.(*ast.Conversion)
+	assert.Equal(int64(3), c.Operand.(*ast.IntLiteral).Value)
+
+	e = foldReturn(t, "int a[4][4];", "a[1 + 1][3 - 1]")
+	assert.Equal("a[2][2]", ast.Format(e))
+}
+
+func TestFoldCallArguments(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		"int f(int a, int b); int main() { return f(1 + 2, f(3 * 4, 5)); }")))
+	assert.Nil(err)
+	assert.Nil(sema.Check(program))
+	FoldConstants(program)
+	assert.Equal("int main() { return f(3, f(12, 5)); }",
+		program.Functions[1].String())
+}
+
+func TestFoldStatements(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		"int main() { int a = 1 + 1; { a = 2 * 2; } 3 - 3; return a; }")))
+	assert.Nil(err)
+	assert.Nil(sema.Check(program))
+	FoldConstants(program)
+	assert.Equal(`int main() {
+    int a = 2;
+    {
+        a = 4;
+    }
+    0;
+    return a;
+}
+`, ast.Format(program))
+}
+
+func TestFoldIfStatement(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		"int main() { if (1 < 2) return 3 * 4; else { return 5 - 6; } }")))
+	assert.Nil(err)
+	assert.Nil(sema.Check(program))
+	FoldConstants(program)
+	assert.Equal("int main() { if (1) return 12; else { return -1; } }",
+		program.Functions[0].String())
+}
+
+func TestFoldLoops(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(`int main() {
+  int a;
+  while (1 + 1) a = 2 * 3;
+  do a = 4 - 5; while (0 && a);
+  for (a = 1 + 2; a < 2 * 5; a = a + 3 * 1) { }
+}`)))
+	assert.Nil(err)
+	assert.Nil(sema.Check(program))
+	FoldConstants(program)
+	assert.Equal(`int main() {
+    int a;
+    while (2)
+        a = 6;
+    do
+        a = -1;
+    while (0);
+    for (a = 3; a < 10; a = a + 3) {
+    }
+}
+`, ast.Format(program))
+}
+
+func TestFoldSwitch(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		"int main() { switch (2 * 3) { case 1 + 2: return 4 - 5; default: return 6 / 2; } }")))
+	assert.Nil(err)
+	assert.Nil(sema.Check(program))
+	FoldConstants(program)
+	assert.Equal("int main() { switch (6) { case 3: return -1; default: return 3; } }",
+		program.Functions[0].String())
+}
+
+func TestFoldKeepsPosition(t *testing.T) {
+	assert := assert.New(t)
+	e := foldReturn(t, "", "1 + 2")
+	assert.Equal("1:22", e.Pos().String())
+}
+
+func TestFoldIgnoresFloatingPoint(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(
+		lexer.Lex("double main() { return 1.5 * 2.0; }")))
+	assert.Nil(err)
+	assert.Nil(sema.Check(program))
+	FoldConstants(program)
+	_, ok := program.Functions[0].Body[0].(*ast.ReturnStatement).Value.(*ast.BinaryOp)
+	assert.True(ok)
+}
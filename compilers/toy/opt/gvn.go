@@ -0,0 +1,234 @@
+package opt
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"math"
+)
+
+// NumberValues removes the instructions of each function of a lowered
+// program which compute a value that has already been computed, using
+// dominator-based value numbering (Briggs, Cooper and Simpson, "Value
+// Numbering", 1997). Each function is converted to SSA form and back for the
+// analysis. An instruction is redundant if one which dominates it applies the
+// same operator to operands of the same values, so that its result may be
+// used instead. Only instructions without side effects which do not read
+// memory are numbered, and copies are propagated.
+func NumberValues(program *ir.Program) {
+	for _, f := range program.Functions {
+		ir.ToSSA(f)
+		numberValues(f)
+		ir.DestroySSA(f)
+	}
+}
+
+// An expression computed by an instruction, which is equal to any other of
+// the same key. The operands are the keys of their values.
+type expression struct {
+	kind     string
+	op       ir.Op
+	typ      types.Type
+	operands [3]interface{}
+	// The field of a FieldAddr, the slot of an Addr, or the global of a
+	// GlobalAddr.
+	field  int
+	object interface{}
+}
+
+// A constant operand, whose key is its type and value, as any constant with
+// them is equal.
+type constantKey struct {
+	typ   types.Type
+	value uint64 // The bits of a float.
+}
+
+// A numbering is the state of the walk of the dominator tree of a function,
+// which maps the expressions computed by the instructions which dominate the
+// current one to the temporaries which hold them.
+type numbering struct {
+	values map[expression]*ir.Temp
+	// The value of each temporary whose assignment was removed, which is its
+	// source if it was a copy, and otherwise the temporary which holds the
+	// same expression.
+	replaced map[*ir.Temp]ir.Value
+	removed  map[ir.Instr]bool
+}
+
+// numberValues numbers the values of a function in SSA form.
+func numberValues(f *ir.Function) {
+	g := ir.NewCFG(f)
+	if len(g.Blocks) == 0 {
+		return
+	}
+	dom := g.Dominators()
+	n := &numbering{
+		values:   make(map[expression]*ir.Temp),
+		replaced: make(map[*ir.Temp]ir.Value),
+		removed:  make(map[ir.Instr]bool),
+	}
+	var walk func(b *ir.Block)
+	walk = func(b *ir.Block) {
+		var scope []expression
+		for _, instr := range b.Instrs {
+			n.replaceOperands(instr)
+			t := ir.Def(instr)
+			if t == nil {
+				continue
+			}
+			if v := n.copied(instr, t); v != nil {
+				n.replaced[t] = v
+				n.removed[instr] = true
+				continue
+			}
+			e, ok := n.expression(instr)
+			if !ok {
+				continue
+			}
+			if u, ok := n.lookup(e); ok {
+				n.replaced[t] = u
+				n.removed[instr] = true
+				continue
+			}
+			n.values[e] = t
+			scope = append(scope, e)
+		}
+		for _, c := range dom.Children(b) {
+			walk(c)
+		}
+		// The expressions of a block are only available in the blocks which
+		// it dominates.
+		for _, e := range scope {
+			delete(n.values, e)
+		}
+	}
+	walk(g.Blocks[0])
+
+	// The arguments of phis for back edges are replaced after the blocks
+	// which assign them are visited.
+	out := &ir.Function{}
+	for i, instr := range f.Instrs {
+		if n.removed[instr] {
+			continue
+		}
+		n.replaceOperands(instr)
+		out.EmitAt(instr, f.Position(i))
+	}
+	f.Instrs, f.Positions = out.Instrs, out.Positions
+}
+
+// replaceOperands replaces the operands of an instruction whose assignments
+// were removed by their values.
+func (n *numbering) replaceOperands(instr ir.Instr) {
+	for _, v := range ir.Operands(instr) {
+		*v = n.value(*v)
+	}
+}
+
+// value returns the value of an operand.
+func (n *numbering) value(v ir.Value) ir.Value {
+	for {
+		t, ok := v.(*ir.Temp)
+		if !ok {
+			return v
+		}
+		r, ok := n.replaced[t]
+		if !ok {
+			return v
+		}
+		v = r
+	}
+}
+
+// copied returns the value which an instruction copies to a temporary, or
+// nil: the source of a copy, or the argument of a phi whose arguments are the
+// same, but for the temporary itself. Constants are only propagated if they
+// are arithmetic, rather than null pointers.
+func (n *numbering) copied(instr ir.Instr, t *ir.Temp) ir.Value {
+	var v ir.Value
+	switch i := instr.(type) {
+	case *ir.Copy:
+		v = i.Src
+	case *ir.Phi:
+		for _, a := range i.Args {
+			switch arg := n.value(a.Value); {
+			case arg == t:
+			case v == nil:
+				v = arg
+			case n.key(arg) != n.key(v):
+				return nil
+			}
+		}
+	default:
+		return nil
+	}
+	if _, ok := v.(*ir.Temp); !ok && v != nil && !types.IsArithmetic(v.Type()) {
+		return nil
+	}
+	return v
+}
+
+// expression returns the expression which an instruction computes, if it
+// has no side effects and does not read memory.
+func (n *numbering) expression(instr ir.Instr) (expression, bool) {
+	var e expression
+	switch i := instr.(type) {
+	case *ir.Unary:
+		e = expression{kind: "unary", op: i.Op, operands: [3]interface{}{n.key(i.Src)}}
+	case *ir.Binary:
+		e = expression{kind: "binary", op: i.Op, operands: [3]interface{}{n.key(i.Lhs), n.key(i.Rhs)}}
+	case *ir.Convert:
+		e = expression{kind: "convert", operands: [3]interface{}{n.key(i.Src)}}
+	case *ir.Select:
+		e = expression{kind: "select", operands: [3]interface{}{n.key(i.Cond), n.key(i.True), n.key(i.False)}}
+	case *ir.Addr:
+		e = expression{kind: "addr", object: i.Slot}
+	case *ir.GlobalAddr:
+		e = expression{kind: "addr", object: i.Global}
+	case *ir.PtrAdd:
+		e = expression{kind: "ptradd", operands: [3]interface{}{n.key(i.Ptr), n.key(i.Index)}}
+	case *ir.FieldAddr:
+		e = expression{kind: "fieldaddr", operands: [3]interface{}{n.key(i.Ptr)}, field: i.Field}
+	case *ir.PtrDiff:
+		e = expression{kind: "ptrdiff", operands: [3]interface{}{n.key(i.Lhs), n.key(i.Rhs)}}
+	default:
+		return e, false
+	}
+	e.typ = ir.Def(instr).Type()
+	return e, true
+}
+
+// lookup returns the temporary which holds an expression, if it has been
+// computed, with the operands of a commutative operator in either order.
+func (n *numbering) lookup(e expression) (*ir.Temp, bool) {
+	if t, ok := n.values[e]; ok {
+		return t, true
+	}
+	if e.kind == "binary" && commutative(e.op) {
+		e.operands[0], e.operands[1] = e.operands[1], e.operands[0]
+		t, ok := n.values[e]
+		return t, ok
+	}
+	return nil, false
+}
+
+// key returns the key of an operand: the temporary, or for a constant, its
+// type and value.
+func (n *numbering) key(v ir.Value) interface{} {
+	switch v := v.(type) {
+	case *ir.IntConst:
+		return constantKey{v.Type(), uint64(v.Value)}
+	case *ir.FloatConst:
+		return constantKey{v.Type(), math.Float64bits(v.Value)}
+	}
+	return v
+}
+
+// commutative returns whether the operands of a binary operator may be
+// swapped.
+func commutative(op ir.Op) bool {
+	switch op {
+	case ir.Add, ir.Mul, ir.And, ir.Or, ir.Xor, ir.Eq, ir.Ne:
+		return true
+	}
+	return false
+}
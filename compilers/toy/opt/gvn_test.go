@@ -0,0 +1,68 @@
+package opt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// number returns the IR of a program after its values are numbered.
+func number(t *testing.T, input string) string {
+	return optimizeIR(t, input, NumberValues)
+}
+
+func TestNumberValues(t *testing.T) {
+	assert := assert.New(t)
+	// Commutative operands may be in either order.
+	out := number(t, `int f(int x, int y) {
+  int p = x * y + 1;
+  int q = y * x + 1;
+  return p + q + x * y;
+}`)
+	assert.Equal(1, strings.Count(out, "mul"), out)
+	assert.Equal(3, strings.Count(out, "add"), out)
+
+	// But not others.
+	out = number(t, "int f(int x, int y) { return (x - y) * (y - x); }")
+	assert.Equal(2, strings.Count(out, "sub"), out)
+}
+
+func TestNumberValuesDominance(t *testing.T) {
+	assert := assert.New(t)
+	// An expression computed in a branch is not available after it.
+	out := number(t, `int f(int x, int y) {
+  int a = 0;
+  if (x)
+    a = x + y;
+  return a + (x + y);
+}`)
+	assert.Equal(3, strings.Count(out, "add"), out)
+
+	// But one computed before it is, in the branch.
+	out = number(t, `int f(int x, int y) {
+  int a = x + y;
+  if (x)
+    a = a * (x + y);
+  return a;
+}`)
+	assert.Equal(1, strings.Count(out, "add"), out)
+}
+
+func TestNumberValuesMemory(t *testing.T) {
+	assert := assert.New(t)
+	// Addresses are numbered, but loads are not, since the memory may be
+	// stored to between them.
+	out := number(t, `int a[10];
+int f(int i) {
+  a[i] = 1;
+  a[i] = a[i] + 1;
+  return a[i];
+}`)
+	assert.Equal(1, strings.Count(out, "ptradd"), out)
+	assert.Equal(2, strings.Count(out, "load"), out)
+
+	// Calls are not numbered.
+	out = number(t, `int g();
+int f() { return g() + g(); }`)
+	assert.Equal(2, strings.Count(out, "call"), out)
+}
@@ -0,0 +1,221 @@
+package opt
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+)
+
+// DefaultInlineThreshold is the size of the largest function which is
+// inlined by default.
+const DefaultInlineThreshold = 20
+
+// Inline replaces the calls of a lowered program to its functions of at most
+// threshold instructions, not counting labels, with copies of their bodies.
+// Functions which may call themselves, directly or through others, and
+// variadic calls are not inlined. The callees are inlined into first, so a
+// function which is inlined includes those it calls which were inlined into
+// it, and is measured with them.
+func Inline(program *ir.Program, threshold int) {
+	functions := make(map[string]*ir.Function)
+	for _, f := range program.Functions {
+		functions[f.Name] = f
+	}
+	recursive := recursiveFunctions(program, functions)
+	// Visit the callees of each function before it.
+	visited := make(map[*ir.Function]bool)
+	var visit func(f *ir.Function)
+	visit = func(f *ir.Function) {
+		visited[f] = true
+		for _, instr := range f.Instrs {
+			if c, ok := instr.(*ir.Call); ok {
+				if g := functions[c.Function]; g != nil && !visited[g] {
+					visit(g)
+				}
+			}
+		}
+		inlineCalls(program, f, func(c *ir.Call) *ir.Function {
+			g := functions[c.Function]
+			if g == nil || recursive[g] || c.Variadic || size(g) > threshold {
+				return nil
+			}
+			return g
+		})
+	}
+	for _, f := range program.Functions {
+		if !visited[f] {
+			visit(f)
+		}
+	}
+}
+
+// size returns the number of instructions of a function, but for labels.
+func size(f *ir.Function) int {
+	n := 0
+	for _, instr := range f.Instrs {
+		if _, ok := instr.(*ir.Label); !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// recursiveFunctions returns the functions of a program which are on a cycle
+// of calls.
+func recursiveFunctions(program *ir.Program, functions map[string]*ir.Function) map[*ir.Function]bool {
+	callees := make(map[*ir.Function][]*ir.Function)
+	for _, f := range program.Functions {
+		for _, instr := range f.Instrs {
+			if c, ok := instr.(*ir.Call); ok && functions[c.Function] != nil {
+				callees[f] = append(callees[f], functions[c.Function])
+			}
+		}
+	}
+	recursive := make(map[*ir.Function]bool)
+	for _, f := range program.Functions {
+		// Search for a path of calls from the function back to itself.
+		reached := make(map[*ir.Function]bool)
+		work := append([]*ir.Function{}, callees[f]...)
+		for len(work) > 0 && !reached[f] {
+			g := work[len(work)-1]
+			work = work[:len(work)-1]
+			if !reached[g] {
+				reached[g] = true
+				work = append(work, callees[g]...)
+			}
+		}
+		recursive[f] = reached[f]
+	}
+	return recursive
+}
+
+// inlineCalls replaces the calls of a function for which callee returns a
+// function with the body of that function.
+func inlineCalls(program *ir.Program, f *ir.Function, callee func(*ir.Call) *ir.Function) {
+	out := &ir.Function{}
+	for i, instr := range f.Instrs {
+		c, ok := instr.(*ir.Call)
+		if !ok || callee(c) == nil {
+			out.EmitAt(instr, f.Position(i))
+			continue
+		}
+		// Every instruction of the body is at the call, to a debugger.
+		pos := f.Position(i)
+		for _, instr := range inlineBody(program, f, callee(c), c) {
+			out.EmitAt(instr, pos)
+		}
+	}
+	f.Instrs, f.Positions = out.Instrs, out.Positions
+}
+
+// An inliner copies the body of a function into another, giving its
+// temporaries, slots and labels new ones in the caller.
+type inliner struct {
+	temps  map[*ir.Temp]*ir.Temp
+	slots  map[*ir.Slot]*ir.Slot
+	labels map[*ir.Label]*ir.Label
+}
+
+// inlineBody returns the instructions of a call to a function, inlined into
+// the caller: copies of the arguments to the parameters, then the body, in
+// which a return is a copy to the destination of the call and a jump past
+// the end.
+func inlineBody(program *ir.Program, caller, callee *ir.Function, c *ir.Call) []ir.Instr {
+	in := &inliner{
+		temps:  make(map[*ir.Temp]*ir.Temp),
+		slots:  make(map[*ir.Slot]*ir.Slot),
+		labels: make(map[*ir.Label]*ir.Label),
+	}
+	for _, t := range callee.Temps {
+		if t.Name != "" {
+			in.temps[t] = caller.NewVariable(ir.BaseName(t.Name), t.Type())
+		} else {
+			in.temps[t] = caller.NewTemp(t.Type())
+		}
+	}
+	for _, s := range callee.Slots {
+		in.slots[s] = caller.NewSlot(ir.BaseName(s.Name), s.Type)
+	}
+	for _, instr := range callee.Instrs {
+		if l, ok := instr.(*ir.Label); ok {
+			in.labels[l] = program.NewLabel()
+		}
+	}
+	end := program.NewLabel()
+
+	var body []ir.Instr
+	for i, p := range callee.Params {
+		body = append(body, &ir.Copy{Dst: in.temps[p], Src: c.Args[i]})
+	}
+	for _, instr := range callee.Instrs {
+		if r, ok := instr.(*ir.Return); ok {
+			body = append(body, &ir.Copy{Dst: c.Dst, Src: in.value(r.Value)},
+				&ir.Jump{Target: end})
+			continue
+		}
+		body = append(body, in.clone(instr))
+	}
+	// The last return falls through to the end.
+	if j, ok := body[len(body)-1].(*ir.Jump); ok && j.Target == end {
+		body = body[:len(body)-1]
+	}
+	return append(body, end)
+}
+
+// value returns the operand of the caller for one of the callee.
+func (in *inliner) value(v ir.Value) ir.Value {
+	if t, ok := v.(*ir.Temp); ok {
+		return in.temps[t]
+	}
+	return v
+}
+
+// clone returns a copy of an instruction of the callee for the caller, which
+// is not in SSA form.
+func (in *inliner) clone(instr ir.Instr) ir.Instr {
+	t, v, l := in.temps, in.value, in.labels
+	switch i := instr.(type) {
+	case *ir.Copy:
+		return &ir.Copy{Dst: t[i.Dst], Src: v(i.Src)}
+	case *ir.Unary:
+		return &ir.Unary{Op: i.Op, Dst: t[i.Dst], Src: v(i.Src)}
+	case *ir.Binary:
+		return &ir.Binary{Op: i.Op, Dst: t[i.Dst], Lhs: v(i.Lhs), Rhs: v(i.Rhs)}
+	case *ir.Convert:
+		return &ir.Convert{Dst: t[i.Dst], Src: v(i.Src)}
+	case *ir.Select:
+		return &ir.Select{Dst: t[i.Dst], Cond: v(i.Cond), True: v(i.True), False: v(i.False)}
+	case *ir.Addr:
+		return &ir.Addr{Dst: t[i.Dst], Slot: in.slots[i.Slot]}
+	case *ir.GlobalAddr:
+		return &ir.GlobalAddr{Dst: t[i.Dst], Global: i.Global}
+	case *ir.Load:
+		return &ir.Load{Dst: t[i.Dst], Addr: v(i.Addr)}
+	case *ir.Store:
+		return &ir.Store{Addr: v(i.Addr), Src: v(i.Src)}
+	case *ir.PtrAdd:
+		return &ir.PtrAdd{Dst: t[i.Dst], Ptr: v(i.Ptr), Index: v(i.Index)}
+	case *ir.FieldAddr:
+		return &ir.FieldAddr{Dst: t[i.Dst], Ptr: v(i.Ptr), Field: i.Field}
+	case *ir.PtrDiff:
+		return &ir.PtrDiff{Dst: t[i.Dst], Lhs: v(i.Lhs), Rhs: v(i.Rhs)}
+	case *ir.Label:
+		return l[i]
+	case *ir.Jump:
+		return &ir.Jump{Target: l[i.Target]}
+	case *ir.Branch:
+		return &ir.Branch{Cond: v(i.Cond), True: l[i.True], False: l[i.False]}
+	case *ir.Switch:
+		s := &ir.Switch{Value: v(i.Value), Default: l[i.Default]}
+		for _, c := range i.Cases {
+			s.Cases = append(s.Cases, ir.SwitchCase{Value: c.Value, Target: l[c.Target]})
+		}
+		return s
+	case *ir.Call:
+		c := &ir.Call{Dst: t[i.Dst], Function: i.Function, Variadic: i.Variadic, Fixed: i.Fixed}
+		for _, a := range i.Args {
+			c.Args = append(c.Args, v(a))
+		}
+		return c
+	}
+	panic(fmt.Sprintf("unsupported instruction %v", instr))
+}
@@ -0,0 +1,101 @@
+package opt
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// inline returns the IR of a program after its functions of at most
+// threshold instructions are inlined.
+func inline(t *testing.T, input string, threshold int) string {
+	return optimizeIR(t, input, func(program *ir.Program) {
+		Inline(program, threshold)
+	})
+}
+
+// function returns the printed IR of a function.
+func function(ir, name string) string {
+	start := strings.Index(ir, "func "+name+"(")
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(ir[start:], "\n}\n")
+	return ir[start : start+end+3]
+}
+
+func TestInline(t *testing.T) {
+	assert := assert.New(t)
+	out := inline(t, `int square(int x) { return x * x; }
+int main() { return square(3) + square(4); }`, DefaultInlineThreshold)
+	assert.Equal(`func main() int {
+	%x:int = 3
+	%4:int = mul %x, %x
+	%0:int = %4
+L1:
+	%x.1:int = 4
+	%6:int = mul %x.1, %x.1
+	%1:int = %6
+L2:
+	%2:int = add %0, %1
+	return %2
+}
+`, function(out, "main"))
+
+	// The callee is kept.
+	assert.Contains(out, "func square(%x:int) int {\n\t%1:int = mul %x, %x\n")
+
+	// Constants are propagated through the inlined body.
+	out = optimizeIR(t, `int square(int x) { return x * x; }
+int main() { return square(3) + square(4); }`, func(program *ir.Program) {
+		Inline(program, DefaultInlineThreshold)
+		PropagateConstants(program)
+	})
+	assert.Equal("func main() int {\n\tjump L1\nL1:\nL2:\n\treturn 25\n}\n", function(out, "main"))
+}
+
+func TestInlineThreshold(t *testing.T) {
+	assert := assert.New(t)
+	input := `int add(int a, int b) { int c = a + b; return c; }
+int main() { return add(1, 2); }`
+	assert.NotContains(function(inline(t, input, 3), "main"), "call")
+	assert.Contains(function(inline(t, input, 2), "main"), "call add(1, 2)")
+	assert.Contains(function(inline(t, input, 0), "main"), "call add(1, 2)")
+}
+
+func TestInlineRecursive(t *testing.T) {
+	assert := assert.New(t)
+	out := inline(t, `int odd(int n);
+int even(int n) { if (n == 0) return 1; return odd(n - 1); }
+int odd(int n) { if (n == 0) return 0; return even(n - 1); }
+int fact(int n) { if (n < 2) return 1; return n * fact(n - 1); }
+int main() { return even(4) + fact(3); }`, DefaultInlineThreshold)
+	assert.Contains(function(out, "main"), "call even(4)")
+	assert.Contains(function(out, "main"), "call fact(3)")
+	assert.Contains(function(out, "even"), "call odd(")
+	assert.Contains(function(out, "fact"), "call fact(")
+}
+
+func TestInlineNested(t *testing.T) {
+	assert := assert.New(t)
+	// A callee is inlined into its callers after those it calls are inlined
+	// into it, and the labels and slots of each copy are distinct.
+	out := inline(t, `int inc(int *p) { *p = *p + 1; return *p; }
+int twice(int x) {
+  while (inc(&x) < 10) {
+  }
+  return x;
+}
+int main() { return twice(1) + twice(2); }`, DefaultInlineThreshold)
+	main := function(out, "main")
+	assert.NotContains(main, "call")
+	labels := make(map[string]bool)
+	for _, line := range strings.Split(main, "\n") {
+		if strings.HasPrefix(line, "L") {
+			assert.False(labels[line], "%s is defined twice", line)
+			labels[line] = true
+		}
+	}
+	assert.Contains(main, "\tslot $x.1:int\n\tslot $x.3:int\n")
+}
@@ -0,0 +1,246 @@
+package opt
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// HoistInvariants moves the instructions of the loops of each function of a
+// lowered program which compute the same value on every iteration out of
+// them, to a preheader: a block which is entered before the header of a
+// loop, and only then. A block is added for it if the loop has none. Each
+// function is converted to SSA form and back for the analysis.
+//
+// An instruction is invariant if each of its operands is assigned outside
+// the loop, or by another invariant instruction. Since a hoisted instruction
+// is executed even if the body of the loop is not, only instructions which
+// have no side effects, do not read memory, which may be stored to in the
+// loop, and cannot trap are hoisted.
+func HoistInvariants(program *ir.Program) {
+	for _, f := range program.Functions {
+		ir.ToSSA(f)
+		hoistInvariants(program, f)
+		ir.DestroySSA(f)
+	}
+}
+
+// hoistInvariants hoists the invariants of each loop of a function in SSA
+// form, inner loops first, so that an instruction may be hoisted out of
+// each loop in turn. The graph is analysed again for each loop, as it
+// changes, so the loops are found by their headers.
+func hoistInvariants(program *ir.Program, f *ir.Function) {
+	var headers []*ir.Label
+	for _, l := range ir.NewCFG(f).Dominators().Loops() {
+		headers = append(headers, l.Header.Label())
+	}
+	for _, h := range headers {
+		g := ir.NewCFG(f)
+		for _, l := range g.Dominators().Loops() {
+			if l.Header.Label() == h {
+				hoistLoop(program, f, g, l)
+				break
+			}
+		}
+	}
+}
+
+// hoistLoop hoists the invariants of a loop of the graph of a function in
+// SSA form. The hoisted instructions keep their positions.
+func hoistLoop(program *ir.Program, f *ir.Function, g *ir.CFG, l *ir.Loop) {
+	invariants := loopInvariants(l)
+	if len(invariants) == 0 {
+		return
+	}
+	// The position of each hoisted instruction.
+	hoisted := make(map[ir.Instr]token.Position)
+	for _, instr := range invariants {
+		hoisted[instr] = token.Position{}
+	}
+	for _, b := range l.Blocks {
+		for i, instr := range b.Instrs {
+			if _, ok := hoisted[instr]; ok {
+				hoisted[instr] = f.Position(b.Start + i)
+			}
+		}
+	}
+	var outside []*ir.Block
+	for _, p := range l.Header.Preds {
+		if !l.Contains(p) {
+			outside = append(outside, p)
+		}
+	}
+	// A single block which is only followed by the header is already a
+	// preheader, and otherwise one is added before the header, which the
+	// blocks outside the loop jump to instead.
+	var preheader *ir.Block
+	var label *ir.Label
+	if len(outside) == 1 && len(outside[0].Succs) == 1 {
+		preheader = outside[0]
+	} else {
+		label = program.NewLabel()
+	}
+	header := l.Header.Label()
+
+	out := &ir.Function{}
+	for _, b := range g.Blocks {
+		if b == l.Header && preheader == nil {
+			pos := f.Position(b.Start)
+			out.EmitAt(label, pos)
+			// The values of the phis of the header from outside the loop are
+			// merged in the preheader.
+			for _, instr := range b.Instrs {
+				phi, ok := instr.(*ir.Phi)
+				if !ok {
+					continue
+				}
+				merged := &ir.Phi{Dst: f.NewTemp(phi.Dst.Type())}
+				var args []ir.PhiArg
+				for _, a := range phi.Args {
+					if isOutside(g, a.Pred, outside) {
+						merged.Args = append(merged.Args, a)
+					} else {
+						args = append(args, a)
+					}
+				}
+				if len(merged.Args) == 1 {
+					args = append(args, ir.PhiArg{Pred: label, Value: merged.Args[0].Value})
+				} else {
+					out.EmitAt(merged, pos)
+					args = append(args, ir.PhiArg{Pred: label, Value: merged.Dst})
+				}
+				phi.Args = args
+			}
+			for _, instr := range invariants {
+				out.EmitAt(instr, hoisted[instr])
+			}
+			out.EmitAt(&ir.Jump{Target: header}, pos)
+		}
+		end := len(b.Instrs)
+		if b.Terminator() != nil {
+			end--
+		}
+		for i, instr := range b.Instrs {
+			pos := f.Position(b.Start + i)
+			if i == end && b == preheader {
+				for _, instr := range invariants {
+					out.EmitAt(instr, hoisted[instr])
+				}
+			}
+			if _, ok := hoisted[instr]; ok {
+				continue
+			}
+			if preheader == nil && !l.Contains(b) && i == len(b.Instrs)-1 {
+				retarget(instr, header, label)
+			}
+			out.EmitAt(instr, pos)
+		}
+		pos := f.Position(b.Start + len(b.Instrs) - 1)
+		if end == len(b.Instrs) && b == preheader {
+			for _, instr := range invariants {
+				out.EmitAt(instr, hoisted[instr])
+			}
+		}
+		// A latch which falls through to the header must jump over the
+		// preheader instead.
+		if preheader == nil && end == len(b.Instrs) && l.Contains(b) &&
+			b.Index+1 < len(g.Blocks) && g.Blocks[b.Index+1] == l.Header {
+			out.EmitAt(&ir.Jump{Target: header}, pos)
+		}
+	}
+	f.Instrs, f.Positions = out.Instrs, out.Positions
+}
+
+// isOutside returns whether the predecessor which starts with a label, or
+// the entry block for nil, is one of the blocks outside a loop.
+func isOutside(g *ir.CFG, pred *ir.Label, outside []*ir.Block) bool {
+	for _, b := range outside {
+		if b.Label() == pred && (pred != nil || b == g.Blocks[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// retarget replaces the target of a jump, branch or switch.
+func retarget(instr ir.Instr, from, to *ir.Label) {
+	switch i := instr.(type) {
+	case *ir.Jump:
+		if i.Target == from {
+			i.Target = to
+		}
+	case *ir.Branch:
+		if i.True == from {
+			i.True = to
+		}
+		if i.False == from {
+			i.False = to
+		}
+	case *ir.Switch:
+		if i.Default == from {
+			i.Default = to
+		}
+		for j := range i.Cases {
+			if i.Cases[j].Target == from {
+				i.Cases[j].Target = to
+			}
+		}
+	}
+}
+
+// loopInvariants returns the instructions of a loop which may be hoisted
+// out of it, each after those whose results it uses.
+func loopInvariants(l *ir.Loop) []ir.Instr {
+	defined := make(map[*ir.Temp]bool)
+	for _, b := range l.Blocks {
+		for _, instr := range b.Instrs {
+			if t := ir.Def(instr); t != nil {
+				defined[t] = true
+			}
+		}
+	}
+	var invariants []ir.Instr
+	found := make(map[ir.Instr]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, b := range l.Blocks {
+			for _, instr := range b.Instrs {
+				if found[instr] || !hoistable(instr) {
+					continue
+				}
+				invariant := true
+				for _, t := range ir.Uses(instr) {
+					if defined[t] {
+						invariant = false
+					}
+				}
+				if invariant {
+					invariants = append(invariants, instr)
+					found[instr] = true
+					delete(defined, ir.Def(instr))
+					changed = true
+				}
+			}
+		}
+	}
+	return invariants
+}
+
+// hoistable returns whether an instruction may be executed where it would
+// not have been: whether it has no side effects, does not read memory, and
+// cannot trap. Integer division may trap, unless by a constant other than
+// zero and -1.
+func hoistable(instr ir.Instr) bool {
+	switch i := instr.(type) {
+	case *ir.Binary:
+		if (i.Op == ir.Div || i.Op == ir.Rem) && !types.IsFloating(i.Rhs.Type()) {
+			c, ok := i.Rhs.(*ir.IntConst)
+			return ok && c.Value != 0 && c.Value != -1
+		}
+		return true
+	case *ir.Copy, *ir.Unary, *ir.Convert, *ir.Select, *ir.Addr, *ir.GlobalAddr,
+		*ir.PtrAdd, *ir.FieldAddr, *ir.PtrDiff:
+		return true
+	}
+	return false
+}
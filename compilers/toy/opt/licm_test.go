@@ -0,0 +1,93 @@
+package opt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// hoist returns the IR of a program after the invariants of its loops are
+// hoisted.
+func hoist(t *testing.T, input string) string {
+	return optimizeIR(t, input, HoistInvariants)
+}
+
+// before returns whether the first occurrence of one string is before that
+// of another in the IR.
+func before(ir, a, b string) bool {
+	i, j := strings.Index(ir, a), strings.Index(ir, b)
+	return i >= 0 && j >= 0 && i < j
+}
+
+func TestHoistInvariants(t *testing.T) {
+	assert := assert.New(t)
+	out := hoist(t, `int f(int n, int k) {
+  int s = 0;
+  while (n > 0) {
+    s = s + k * 3;
+    n = n - 1;
+  }
+  return s;
+}`)
+	assert.True(before(out, "mul %k, 3", "L1:"), out)
+	assert.Equal(1, strings.Count(out, "mul"), out)
+
+	// An invariant which uses another is hoisted after it, out of each loop
+	// which it is invariant in.
+	out = hoist(t, `int f(int n, int k) {
+  int s = 0;
+  for (int i = 0; i < n; i = i + 1)
+    for (int j = 0; j < n; j = j + 1)
+      s = s + (k * 3 + 1) * i;
+  return s;
+}`)
+	assert.True(before(out, "mul %k, 3", "L1:"), out)
+	assert.True(before(out, "mul %k, 3", "add"), out)
+	// The multiplication by i is hoisted out of the inner loop only.
+	mul := strings.LastIndex(out, "mul")
+	assert.True(strings.Index(out, "L1:") < mul && mul < strings.Index(out, "L5:"), out)
+}
+
+func TestHoistInvariantsSafety(t *testing.T) {
+	assert := assert.New(t)
+	// Loads, calls and divisions which may trap are not hoisted, but a
+	// division by a constant is.
+	out := hoist(t, `int a[10];
+int g();
+int f(int n, int k) {
+  int s = 0;
+  while (n > 0) {
+    s = s + a[k] + g() + n / k + k / 2;
+    n = n - 1;
+  }
+  return s;
+}`)
+	header := strings.Index(out, "L1:")
+	assert.True(strings.Index(out, "load") > header, out)
+	assert.True(strings.Index(out, "call g()") > header, out)
+	assert.True(strings.Index(out, "div %n") > header, out)
+	assert.True(before(out, "div %k, 2", "L1:"), out)
+	// The address of the element is invariant.
+	assert.True(before(out, "ptradd", "L1:"), out)
+}
+
+func TestHoistInvariantsPreheader(t *testing.T) {
+	assert := assert.New(t)
+	// The loop is entered from two blocks, so a preheader is added, where
+	// the values of s from each are merged.
+	out := hoist(t, `int f(int n, int k) {
+  int s = 0;
+  if (n > 5)
+    goto loop;
+  s = 1;
+loop:
+  s = s + k * 2;
+  n = n - 1;
+  if (n > 0)
+    goto loop;
+  return s;
+}`)
+	assert.Equal(1, strings.Count(out, "mul"), out)
+	assert.True(before(out, "mul %k, 2", "L3:"), out)
+	assert.NotContains(out, "jump L3\nL1:", out)
+}
@@ -0,0 +1,184 @@
+// Package opt implements optimizations and other transformations of checked
+// programs.
+package opt
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"io"
+)
+
+// An optimization pass, which transforms a program in place: either its
+// syntax tree, with Run, or its IR, with RunIR. Passes of the syntax tree run
+// after semantic analysis, so every expression is typed, and must preserve
+// that. Passes of the IR run after it is lowered.
+type Pass struct {
+	Name  string
+	Run   func(program *ast.Program)
+	RunIR func(program *ir.Program)
+}
+
+// A Manager runs a sequence of passes, those of the syntax tree before those
+// of the IR.
+type Manager struct {
+	passes          []Pass
+	inlineThreshold int
+	trapOverflow    bool
+	// The names of the passes after which the program is printed, and where
+	// to.
+	printAfter map[string]bool
+	w          io.Writer
+}
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// InlineThreshold is an Option which sets the size of the largest function
+// which the inline pass inlines, rather than DefaultInlineThreshold.
+func InlineThreshold(threshold int) Option {
+	return func(m *Manager) {
+		m.inlineThreshold = threshold
+	}
+}
+
+// TrapOverflow is an Option which leaves int arithmetic on constants which
+// overflows to run time, where it traps, rather than folding it to the value
+// which wraps around.
+func TrapOverflow(m *Manager) {
+	m.trapOverflow = true
+}
+
+// PrintAfter is an Option which writes the program to w after each of the
+// named passes is run: as source text after a pass of the syntax tree, and as
+// IR after a pass of the IR. Each is preceded by a comment naming the pass.
+func PrintAfter(w io.Writer, names ...string) Option {
+	return func(m *Manager) {
+		for _, name := range names {
+			m.printAfter[name] = true
+		}
+		m.w = w
+	}
+}
+
+// The passes which may be named in a pipeline, in the order in which they
+// run at level 2. The inline pass uses the threshold of the manager, and the
+// fold and sccp passes whether it traps overflow.
+func (m *Manager) registered() []Pass {
+	return []Pass{
+		{Name: "fold", Run: func(program *ast.Program) { foldConstants(program, m.trapOverflow) }},
+		{Name: "inline", RunIR: func(program *ir.Program) { Inline(program, m.inlineThreshold) }},
+		{Name: "sccp", RunIR: func(program *ir.Program) { propagateProgram(program, m.trapOverflow) }},
+		{Name: "gvn", RunIR: NumberValues},
+		{Name: "licm", RunIR: HoistInvariants},
+	}
+}
+
+// The names of the passes of each optimization level. Higher levels run
+// those of the highest.
+var pipelines = [][]string{
+	{},
+	{"fold"},
+	{"fold", "inline", "sccp", "gvn", "licm"},
+}
+
+// PassNames returns the names of the passes which may be run by a pipeline.
+func PassNames() []string {
+	var names []string
+	for _, p := range (&Manager{}).registered() {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func newManager(options []Option) *Manager {
+	m := &Manager{
+		inlineThreshold: DefaultInlineThreshold,
+		printAfter:      make(map[string]bool),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// NewManager returns a manager with the passes for an optimization level.
+// Level 0 runs no passes.
+func NewManager(level int, options ...Option) *Manager {
+	if level >= len(pipelines) {
+		level = len(pipelines) - 1
+	}
+	m, err := NewPipeline(pipelines[level], options...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// NewPipeline returns a manager which runs the named passes, in order. It is
+// an error to name an unknown pass, or a pass of the syntax tree after one of
+// the IR, since the IR is lowered from the tree once.
+func NewPipeline(names []string, options ...Option) (*Manager, error) {
+	m := newManager(options)
+	passes := make(map[string]Pass)
+	for _, p := range m.registered() {
+		passes[p.Name] = p
+	}
+	var lowered string // The name of the first pass of the IR.
+	for _, name := range names {
+		p, ok := passes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown pass %q", name)
+		}
+		if p.Run != nil && lowered != "" {
+			return nil, fmt.Errorf("pass %q of the syntax tree cannot run after pass %q of the IR", name, lowered)
+		}
+		if p.RunIR != nil && lowered == "" {
+			lowered = name
+		}
+		m.Add(p)
+	}
+	return m, nil
+}
+
+// Add appends a pass to the sequence.
+func (m *Manager) Add(p Pass) {
+	m.passes = append(m.passes, p)
+}
+
+// Passes returns the names of the passes, in the order they are run.
+func (m *Manager) Passes() []string {
+	names := make([]string, len(m.passes))
+	for i, p := range m.passes {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// Run applies each pass of the syntax tree to a program in turn.
+func (m *Manager) Run(program *ast.Program) {
+	for _, p := range m.passes {
+		if p.Run == nil {
+			continue
+		}
+		p.Run(program)
+		if m.printAfter[p.Name] {
+			fmt.Fprintf(m.w, "// After %s.\n", p.Name)
+			ast.Print(m.w, program)
+		}
+	}
+}
+
+// RunIR applies each pass of the IR to a lowered program in turn.
+func (m *Manager) RunIR(program *ir.Program) {
+	for _, p := range m.passes {
+		if p.RunIR == nil {
+			continue
+		}
+		p.RunIR(program)
+		if m.printAfter[p.Name] {
+			fmt.Fprintf(m.w, "// After %s.\n", p.Name)
+			ir.Print(m.w, program)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package opt
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewManager(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{}, NewManager(0).Passes())
+	assert.Equal([]string{"fold"}, NewManager(1).Passes())
+	assert.Equal([]string{"fold", "inline", "sccp", "gvn", "licm"}, NewManager(2).Passes())
+	assert.Equal(NewManager(2).Passes(), NewManager(3).Passes())
+}
+
+func TestNewPipeline(t *testing.T) {
+	assert := assert.New(t)
+	m, err := NewPipeline([]string{"fold", "licm", "sccp"})
+	assert.Nil(err)
+	assert.Equal([]string{"fold", "licm", "sccp"}, m.Passes())
+
+	_, err = NewPipeline([]string{"fold", "unroll"})
+	assert.Equal(`unknown pass "unroll"`, err.Error())
+	_, err = NewPipeline([]string{"sccp", "fold"})
+	assert.Equal(`pass "fold" of the syntax tree cannot run after pass "sccp" of the IR`, err.Error())
+}
+
+func TestManagerPrintAfter(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	m := NewManager(2, PrintAfter(&b, "fold", "sccp"), InlineThreshold(0))
+	out := optimizeIR(t, "int f() { return 2; } int main() { return f() * (1 + 2); }", func(program *ir.Program) {
+		m.RunIR(program)
+	})
+	// Nothing is inlined, and the AST passes are not run.
+	assert.Equal("// After sccp.\n"+out, b.String())
+	assert.Contains(out, "call f()")
+}
+
+func TestManagerRunsPassesInOrder(t *testing.T) {
+	assert := assert.New(t)
+	var ran []string
+	m := NewManager(0)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		m.Add(Pass{Name: name, Run: func(*ast.Program) { ran = append(ran, name) }})
+	}
+	m.Run(&ast.Program{})
+	assert.Equal([]string{"a", "b"}, ran)
+	assert.Equal([]string{"a", "b"}, m.Passes())
+}
+
+func TestManagerTrapOverflow(t *testing.T) {
+	assert := assert.New(t)
+	input := "int main() { int a = 2147483647; return a + 1 + (2 * 3 + -(-2147483647 - 1)); }"
+	out := optimizeIR(t, input, func(program *ir.Program) {
+		NewManager(2).RunIR(program)
+	})
+	assert.NotContains(out, "add")
+	out = optimizeIR(t, input, func(program *ir.Program) {
+		NewManager(2, TrapOverflow).RunIR(program)
+	})
+	// Only the arithmetic which overflows is left to trap at run time.
+	assert.Contains(out, "neg")
+	assert.Contains(out, "add 2147483647, 1")
+	assert.NotContains(out, "mul")
+}
@@ -0,0 +1,577 @@
+package opt
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/consteval"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"math"
+)
+
+// PropagateConstants finds the temporaries of each function of a lowered
+// program which have a constant value, and the branches which are always
+// taken the same way, using sparse conditional constant propagation. Each
+// function is converted to SSA form and back for the analysis. Temporaries
+// which are constant are replaced by their values, branches on constants
+// become jumps, and the blocks which are never executed are removed.
+func PropagateConstants(program *ir.Program) {
+	propagateProgram(program, false)
+}
+
+// propagateProgram propagates the constants of a program, except the results
+// of int arithmetic which overflows if overflow is trapped, which are left to
+// trap at run time.
+func propagateProgram(program *ir.Program, trapOverflow bool) {
+	for _, f := range program.Functions {
+		ir.ToSSA(f)
+		propagateConstants(f, trapOverflow)
+		ir.DestroySSA(f)
+	}
+}
+
+// The state of a temporary in the analysis. A temporary is unknown until an
+// executed assignment of it is found, known once a constant is found to reach
+// it, and varying once two values or a value which is not constant are.
+type state int
+
+const (
+	unknown state = iota
+	known
+	varying
+)
+
+// The value of a temporary in the analysis, for an IntConst or FloatConst of
+// an arithmetic type. Pointers are never constant.
+type cell struct {
+	state state
+	value ir.Value
+}
+
+// An edge of a control-flow graph. The edge into the entry block, from the
+// caller, is from nil.
+type edge struct {
+	from, to *ir.Block
+}
+
+// A use of a temporary by an instruction of a block.
+type use struct {
+	block *ir.Block
+	instr ir.Instr
+}
+
+// An sccp is the state of the algorithm of Wegman and Zadeck ("Constant
+// Propagation with Conditional Branches", 1991), which evaluates only the
+// instructions of blocks which may be executed, and only the branches which
+// may be taken when an instruction is known to be constant.
+type sccp struct {
+	g      *ir.CFG
+	labels map[*ir.Label]*ir.Block
+	cells  map[*ir.Temp]cell
+	uses   map[*ir.Temp][]use
+	// The blocks and edges which may be executed.
+	executable []bool
+	edges      map[edge]bool
+	// The edges which have been found to be executable, and the temporaries
+	// whose values have changed, but which are not yet propagated.
+	flowWork []edge
+	ssaWork  []*ir.Temp
+	// Whether int arithmetic which overflows is left to trap at run time.
+	trapOverflow bool
+}
+
+// propagateConstants propagates the constants of a function in SSA form.
+func propagateConstants(f *ir.Function, trapOverflow bool) {
+	g := ir.NewCFG(f)
+	if len(g.Blocks) == 0 {
+		return
+	}
+	s := &sccp{
+		g:            g,
+		labels:       make(map[*ir.Label]*ir.Block),
+		cells:        make(map[*ir.Temp]cell),
+		uses:         make(map[*ir.Temp][]use),
+		executable:   make([]bool, len(g.Blocks)),
+		edges:        make(map[edge]bool),
+		trapOverflow: trapOverflow,
+	}
+	for _, b := range g.Blocks {
+		if l := b.Label(); l != nil {
+			s.labels[l] = b
+		}
+		for _, instr := range b.Instrs {
+			for _, t := range ir.Uses(instr) {
+				s.uses[t] = append(s.uses[t], use{b, instr})
+			}
+		}
+	}
+	for _, p := range f.Params {
+		s.cells[p] = cell{state: varying}
+	}
+	s.flowWork = []edge{{nil, g.Blocks[0]}}
+	for len(s.flowWork) > 0 || len(s.ssaWork) > 0 {
+		if n := len(s.flowWork); n > 0 {
+			e := s.flowWork[n-1]
+			s.flowWork = s.flowWork[:n-1]
+			s.visitEdge(e)
+			continue
+		}
+		t := s.ssaWork[len(s.ssaWork)-1]
+		s.ssaWork = s.ssaWork[:len(s.ssaWork)-1]
+		for _, u := range s.uses[t] {
+			if s.executable[u.block.Index] {
+				s.visit(u.block, u.instr)
+			}
+		}
+	}
+	s.rewrite(f)
+}
+
+// visitEdge evaluates the phis of the block which an edge enters, whose
+// arguments for the edge may now be used, and the rest of the block if it
+// was not executable before.
+func (s *sccp) visitEdge(e edge) {
+	if s.edges[e] {
+		return
+	}
+	s.edges[e] = true
+	b := e.to
+	if s.executable[b.Index] {
+		for _, instr := range b.Instrs {
+			if phi, ok := instr.(*ir.Phi); ok {
+				s.visit(b, phi)
+			}
+		}
+		return
+	}
+	s.executable[b.Index] = true
+	for _, instr := range b.Instrs {
+		s.visit(b, instr)
+	}
+	switch b.Terminator().(type) {
+	case *ir.Jump, nil:
+		for _, succ := range b.Succs {
+			s.flowWork = append(s.flowWork, edge{b, succ})
+		}
+	}
+}
+
+// visit evaluates an instruction of an executable block.
+func (s *sccp) visit(b *ir.Block, instr ir.Instr) {
+	switch i := instr.(type) {
+	case *ir.Branch:
+		switch c := s.value(i.Cond); c.state {
+		case known:
+			target := i.False
+			if c.value.(*ir.IntConst).Value != 0 {
+				target = i.True
+			}
+			s.flowWork = append(s.flowWork, edge{b, s.labels[target]})
+		case varying:
+			s.addSuccessors(b)
+		}
+		return
+	case *ir.Switch:
+		switch c := s.value(i.Value); c.state {
+		case known:
+			s.flowWork = append(s.flowWork, edge{b, s.labels[switchTarget(i, c.value)]})
+		case varying:
+			s.addSuccessors(b)
+		}
+		return
+	}
+	t := ir.Def(instr)
+	if t == nil {
+		return
+	}
+	c := s.evaluate(b, instr)
+	if !types.IsArithmetic(t.Type()) {
+		c = cell{state: varying}
+	}
+	if old := s.cells[t]; old.state != c.state {
+		s.cells[t] = c
+		s.ssaWork = append(s.ssaWork, t)
+	}
+}
+
+// addSuccessors marks the edges out of a block as executable.
+func (s *sccp) addSuccessors(b *ir.Block) {
+	for _, succ := range b.Succs {
+		s.flowWork = append(s.flowWork, edge{b, succ})
+	}
+}
+
+// value returns the state of an operand.
+func (s *sccp) value(v ir.Value) cell {
+	switch v := v.(type) {
+	case *ir.Temp:
+		return s.cells[v]
+	case *ir.IntConst, *ir.FloatConst:
+		if types.IsArithmetic(v.Type()) {
+			return cell{state: known, value: v}
+		}
+	}
+	return cell{state: varying}
+}
+
+// evaluate returns the state of the result of an instruction.
+func (s *sccp) evaluate(b *ir.Block, instr ir.Instr) cell {
+	switch i := instr.(type) {
+	case *ir.Copy:
+		return s.value(i.Src)
+	case *ir.Phi:
+		c := cell{state: unknown}
+		for _, a := range i.Args {
+			pred := s.g.Blocks[0]
+			if a.Pred != nil {
+				pred = s.labels[a.Pred]
+			}
+			if s.edges[edge{pred, b}] {
+				c = meet(c, s.value(a.Value))
+			}
+		}
+		return c
+	case *ir.Select:
+		switch c := s.value(i.Cond); c.state {
+		case known:
+			if c.value.(*ir.IntConst).Value != 0 {
+				return s.value(i.True)
+			}
+			return s.value(i.False)
+		case varying:
+			return meet(s.value(i.True), s.value(i.False))
+		}
+		return cell{state: unknown}
+	case *ir.Unary:
+		return foldCells(func(x []ir.Value) ir.Value {
+			if s.trapOverflow && overflows(i.Op, x...) {
+				return nil
+			}
+			return foldUnary(i.Op, x[0])
+		}, s.value(i.Src))
+	case *ir.Binary:
+		return foldCells(func(x []ir.Value) ir.Value {
+			if s.trapOverflow && overflows(i.Op, x...) {
+				return nil
+			}
+			return foldBinary(i.Op, x[0], x[1])
+		}, s.value(i.Lhs), s.value(i.Rhs))
+	case *ir.Convert:
+		return foldCells(func(x []ir.Value) ir.Value {
+			return foldConvert(x[0], i.Dst.Type())
+		}, s.value(i.Src))
+	}
+	// Loads, calls and addresses are not known at compile time.
+	return cell{state: varying}
+}
+
+// meet returns the state of a temporary which one of two values reaches.
+func meet(x, y cell) cell {
+	switch {
+	case x.state == unknown:
+		return y
+	case y.state == unknown:
+		return x
+	case x.state == known && y.state == known && equal(x.value, y.value):
+		return x
+	}
+	return cell{state: varying}
+}
+
+// equal returns whether two constants are of the same type and value.
+func equal(x, y ir.Value) bool {
+	if x.Type() != y.Type() {
+		return false
+	}
+	switch x := x.(type) {
+	case *ir.IntConst:
+		return x.Value == y.(*ir.IntConst).Value
+	case *ir.FloatConst:
+		y := y.(*ir.FloatConst).Value
+		// Distinguish zero from negative zero, and let NaN equal itself.
+		return math.Float64bits(x.Value) == math.Float64bits(y)
+	}
+	return false
+}
+
+// foldCells returns the state of the result of an operation: unknown if any of
+// its operands is, constant if each of them is and the operation gives a
+// value, such as for division by a non-zero divisor, or else varying.
+func foldCells(op func([]ir.Value) ir.Value, operands ...cell) cell {
+	values := make([]ir.Value, len(operands))
+	for i, c := range operands {
+		if c.state == unknown {
+			return c
+		}
+		values[i] = c.value
+	}
+	for _, c := range operands {
+		if c.state == varying {
+			return c
+		}
+	}
+	if v := op(values); v != nil {
+		return cell{state: known, value: v}
+	}
+	return cell{state: varying}
+}
+
+// foldUnary returns the result of a unary operator on a constant, or nil.
+func foldUnary(op ir.Op, x ir.Value) ir.Value {
+	switch x := x.(type) {
+	case *ir.IntConst:
+		switch op {
+		case ir.Neg:
+			return intConst(-x.Value, x.Type())
+		case ir.Not:
+			return intConst(^x.Value, x.Type())
+		}
+	case *ir.FloatConst:
+		if op == ir.Neg {
+			return floatConst(-x.Value, x.Type())
+		}
+	}
+	return nil
+}
+
+// foldBinary returns the result of a binary operator on constants of the
+// same type, or nil if it is not defined.
+func foldBinary(op ir.Op, x, y ir.Value) ir.Value {
+	t := x.Type()
+	if f, ok := x.(*ir.FloatConst); ok {
+		a, b := f.Value, y.(*ir.FloatConst).Value
+		switch op {
+		case ir.Add:
+			return floatConst(a+b, t)
+		case ir.Sub:
+			return floatConst(a-b, t)
+		case ir.Mul:
+			return floatConst(a*b, t)
+		case ir.Div:
+			return floatConst(a/b, t)
+		case ir.Eq:
+			return boolConst(a == b)
+		case ir.Ne:
+			return boolConst(a != b)
+		case ir.Lt:
+			return boolConst(a < b)
+		case ir.Le:
+			return boolConst(a <= b)
+		case ir.Gt:
+			return boolConst(a > b)
+		case ir.Ge:
+			return boolConst(a >= b)
+		}
+		return nil
+	}
+	a, b := x.(*ir.IntConst).Value, y.(*ir.IntConst).Value
+	if types.IsUnsigned(t) {
+		if v := foldUnsigned(op, uint64(a), uint64(b), t); v != nil {
+			return v
+		}
+	}
+	switch op {
+	case ir.Add:
+		return intConst(a+b, t)
+	case ir.Sub:
+		return intConst(a-b, t)
+	case ir.Mul:
+		return intConst(a*b, t)
+	case ir.Div, ir.Rem:
+		// Division by zero, and of the least value by -1, which overflows,
+		// trap at run time.
+		if b == 0 || b == -1 && a == minInt(t) {
+			return nil
+		} else if op == ir.Div {
+			return intConst(a/b, t)
+		}
+		return intConst(a%b, t)
+	case ir.And:
+		return intConst(a&b, t)
+	case ir.Or:
+		return intConst(a|b, t)
+	case ir.Xor:
+		return intConst(a^b, t)
+	case ir.Shl:
+		return intConst(a<<uint(b&int64(types.Width(t)-1)), t)
+	case ir.Shr:
+		return intConst(a>>uint(b&int64(types.Width(t)-1)), t)
+	case ir.Eq:
+		return boolConst(a == b)
+	case ir.Ne:
+		return boolConst(a != b)
+	case ir.Lt:
+		return boolConst(a < b)
+	case ir.Le:
+		return boolConst(a <= b)
+	case ir.Gt:
+		return boolConst(a > b)
+	case ir.Ge:
+		return boolConst(a >= b)
+	}
+	return nil
+}
+
+// foldUnsigned returns the result of a binary operator on unsigned constants
+// which differs from that on signed ones, or nil if it does not, or is not
+// defined.
+func foldUnsigned(op ir.Op, a, b uint64, t types.Type) ir.Value {
+	switch op {
+	case ir.Div, ir.Rem:
+		if b == 0 {
+			return nil
+		} else if op == ir.Div {
+			return intConst(int64(a/b), t)
+		}
+		return intConst(int64(a%b), t)
+	case ir.Shr:
+		return intConst(int64(a>>(b&uint64(types.Width(t)-1))), t)
+	case ir.Lt:
+		return boolConst(a < b)
+	case ir.Le:
+		return boolConst(a <= b)
+	case ir.Gt:
+		return boolConst(a > b)
+	case ir.Ge:
+		return boolConst(a >= b)
+	}
+	return nil
+}
+
+// The operators of the IR whose signed arithmetic may overflow, and those of
+// the language which they implement.
+var overflowOperators = map[ir.Op]token.TokenType{
+	ir.Add: token.AdditionToken,
+	ir.Sub: token.NegationToken,
+	ir.Mul: token.MultiplicationToken,
+	ir.Neg: token.NegationToken,
+}
+
+// overflows returns whether an operator on int or long constants overflows.
+func overflows(op ir.Op, operands ...ir.Value) bool {
+	tokenType, ok := overflowOperators[op]
+	if t := operands[0].Type(); !ok || t != types.Int && t != types.Long {
+		return false
+	}
+	values := make([]int64, len(operands))
+	for i, v := range operands {
+		values[i] = v.(*ir.IntConst).Value
+	}
+	return consteval.Overflows(tokenType, types.Width(operands[0].Type()), values...)
+}
+
+// foldConvert returns a constant converted to an arithmetic type, or nil if
+// the value is out of the range of an integer type.
+func foldConvert(x ir.Value, t types.Type) ir.Value {
+	if !types.IsArithmetic(t) {
+		return nil
+	}
+	switch x := x.(type) {
+	case *ir.IntConst:
+		if types.IsFloating(t) {
+			return floatConst(float64(x.Value), t)
+		}
+		return intConst(x.Value, t)
+	case *ir.FloatConst:
+		if types.IsFloating(t) {
+			return floatConst(x.Value, t)
+		}
+		if v, ok := consteval.Truncate(x.Value, t); ok {
+			return intConst(v, t)
+		}
+	}
+	return nil
+}
+
+// switchTarget returns the label which a switch jumps to for a constant.
+func switchTarget(s *ir.Switch, v ir.Value) *ir.Label {
+	for _, c := range s.Cases {
+		if c.Value == v.(*ir.IntConst).Value {
+			return c.Target
+		}
+	}
+	return s.Default
+}
+
+// intConst returns an integer constant of type t, wrapping a value which is
+// out of its range.
+func intConst(v int64, t types.Type) ir.Value {
+	return ir.NewInt(consteval.Convert(v, t), t)
+}
+
+// floatConst returns a floating-point constant of type t, rounding a value
+// which is not representable as a float.
+func floatConst(v float64, t types.Type) ir.Value {
+	if t == types.Float {
+		v = float64(float32(v))
+	}
+	return ir.NewFloat(v, t)
+}
+
+func boolConst(b bool) ir.Value {
+	if b {
+		return ir.NewInt(1, types.Int)
+	}
+	return ir.NewInt(0, types.Int)
+}
+
+// minInt returns the least value of a signed integer type.
+func minInt(t types.Type) int64 {
+	return -1 << (types.Width(t) - 1)
+}
+
+// rewrite replaces the temporaries of a function which are constant by their
+// values, removing their assignments, replaces the branches and switches
+// which are always taken the same way by jumps, and removes the blocks which
+// are never executed, and the arguments of phis for them.
+func (s *sccp) rewrite(f *ir.Function) {
+	out := &ir.Function{}
+	for _, b := range s.g.Blocks {
+		if !s.executable[b.Index] {
+			continue
+		}
+		for k, instr := range b.Instrs {
+			pos := f.Position(b.Start + k)
+			if t := ir.Def(instr); t != nil && s.cells[t].state == known {
+				continue
+			}
+			for _, v := range ir.Operands(instr) {
+				if t, ok := (*v).(*ir.Temp); ok && s.cells[t].state == known {
+					*v = s.cells[t].value
+				}
+			}
+			switch i := instr.(type) {
+			case *ir.Branch:
+				if c, ok := i.Cond.(*ir.IntConst); ok {
+					target := i.False
+					if c.Value != 0 {
+						target = i.True
+					}
+					instr = &ir.Jump{Target: target}
+				}
+			case *ir.Switch:
+				if c, ok := i.Value.(*ir.IntConst); ok {
+					instr = &ir.Jump{Target: switchTarget(i, c)}
+				}
+			case *ir.Phi:
+				var args []ir.PhiArg
+				for _, a := range i.Args {
+					pred := s.g.Blocks[0]
+					if a.Pred != nil {
+						pred = s.labels[a.Pred]
+					}
+					if s.edges[edge{pred, b}] {
+						args = append(args, a)
+					}
+				}
+				i.Args = args
+			}
+			out.EmitAt(instr, pos)
+		}
+		// The arguments of phis for the entry block are copied at its end, so
+		// it is kept, even if each of its assignments was removed.
+		if b.Index == 0 && len(out.Instrs) == 0 && len(b.Succs) == 1 {
+			out.EmitAt(&ir.Jump{Target: b.Succs[0].Label()}, f.Position(b.Start))
+		}
+	}
+	f.Instrs, f.Positions = out.Instrs, out.Positions
+}
@@ -0,0 +1,210 @@
+package opt
+
+import (
+	"bytes"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// optimizeIR lowers a program, runs a pass over its IR, and returns the
+// printed result.
+func optimizeIR(t *testing.T, input string, pass func(*ir.Program)) string {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	lowered, err := ir.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass(lowered)
+	var b bytes.Buffer
+	ir.Print(&b, lowered)
+	return b.String()
+}
+
+// propagate returns the IR of a program after its constants are propagated.
+func propagate(t *testing.T, input string) string {
+	return optimizeIR(t, input, PropagateConstants)
+}
+
+func TestPropagateConstants(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`func main() int {
+	return 7
+}
+`, propagate(t, "int main() { int a = 3; int b = a * 2; return b + 1; }"))
+
+	// Arithmetic wraps.
+	assert.Equal(`func main() int {
+	return -2147483648
+}
+`, propagate(t, "int main() { int a = 2147483647; return a + 1; }"))
+}
+
+func TestPropagateConstantsBranches(t *testing.T) {
+	assert := assert.New(t)
+	out := propagate(t, `int main() {
+  int debug = 0;
+  int a = 4;
+  if (debug)
+    a = a * 10;
+  return a;
+}`)
+	assert.NotContains(out, "branch")
+	assert.NotContains(out, "mul")
+	assert.Contains(out, "return 4\n")
+
+	// Constants are propagated through the phis of a loop, so the branch on
+	// one in the loop is eliminated, but not the branch of the loop.
+	out = propagate(t, `int f(int n) {
+  int x = 1;
+  int y = 0;
+  while (n > 0) {
+    if (x == 1)
+      y = y + 2;
+    else
+      y = y * 3;
+    n = n - 1;
+  }
+  return y;
+}`)
+	assert.Equal(1, bytes.Count([]byte(out), []byte("branch")), out)
+	assert.NotContains(out, "mul")
+	assert.NotContains(out, "eq")
+}
+
+func TestPropagateConstantsSwitch(t *testing.T) {
+	assert := assert.New(t)
+	out := propagate(t, `int main() {
+  int a = 2;
+  switch (a) {
+  case 1:
+    return 10;
+  case 2:
+    return 20;
+  default:
+    return 30;
+  }
+}`)
+	assert.NotContains(out, "switch")
+	assert.Contains(out, "return 20\n")
+	assert.NotContains(out, "return 10\n")
+	assert.NotContains(out, "return 30\n")
+}
+
+func TestPropagateConstantsVarying(t *testing.T) {
+	assert := assert.New(t)
+	// A parameter, or a variable assigned different values on different
+	// paths, is not constant.
+	out := propagate(t, `int f(int n) {
+  int a = 1;
+  if (n)
+    a = 2;
+  return a + 1;
+}`)
+	assert.Contains(out, "branch %n")
+	assert.Contains(out, "add")
+
+	// Division by zero is left to run time.
+	out = propagate(t, "int main() { int a = 0; return 1 / a; }")
+	assert.Contains(out, "div 1, 0")
+}
+
+func TestPropagateConstantsFloat(t *testing.T) {
+	assert := assert.New(t)
+	out := propagate(t, "int main() { double d = 1.5; float f = 0.1f; return d * 2 + f; }")
+	assert.NotContains(out, "mul")
+	assert.Contains(out, "return 3\n")
+}
+
+func TestFoldBinary(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		op   ir.Op
+		x, y int64
+		want int64
+		ok   bool // Whether the result is defined.
+	}{
+		{ir.Add, 1, 2, 3, true},
+		{ir.Sub, -2147483648, 1, 2147483647, true},
+		{ir.Mul, 65536, 65536, 0, true},
+		{ir.Div, -7, 2, -3, true},
+		{ir.Rem, -7, 2, -1, true},
+		{ir.Div, 1, 0, 0, false},
+		{ir.Rem, -2147483648, -1, 0, false},
+		{ir.Shl, 1, 33, 2, true},
+		{ir.Shr, -8, 1, -4, true},
+		{ir.Lt, -1, 0, 1, true},
+		{ir.Ge, -1, 0, 0, true},
+	} {
+		v := foldBinary(test.op, ir.NewInt(test.x, types.Int), ir.NewInt(test.y, types.Int))
+		assert.Equal(test.ok, v != nil, "%v %d, %d", test.op, test.x, test.y)
+		if v != nil {
+			assert.Equal(test.want, v.(*ir.IntConst).Value, "%v %d, %d", test.op, test.x, test.y)
+		}
+	}
+}
+
+func TestFoldBinaryUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		op   ir.Op
+		x, y int64
+		want int64
+	}{
+		{ir.Sub, 0, 1, 4294967295},
+		{ir.Div, 4294967295, 2, 2147483647},
+		{ir.Rem, 4294967295, 10, 5},
+		{ir.Shr, 4294967288, 1, 2147483644},
+		{ir.Lt, 1, 4294967295, 1},
+		{ir.Ge, 1, 4294967295, 0},
+	} {
+		v := foldBinary(test.op, ir.NewInt(test.x, types.UnsignedInt),
+			ir.NewInt(test.y, types.UnsignedInt))
+		assert.Equal(test.want, v.(*ir.IntConst).Value, "%v %d, %d", test.op, test.x, test.y)
+	}
+	// A double out of the range of an unsigned int is not folded.
+	assert.Nil(foldConvert(ir.NewFloat(-1, types.Double), types.UnsignedInt))
+	assert.Equal(int64(4294967295),
+		foldConvert(ir.NewInt(-1, types.Int), types.UnsignedInt).(*ir.IntConst).Value)
+}
+
+func TestFoldBinaryLong(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		op   ir.Op
+		typ  types.Type
+		x, y int64
+		want int64
+	}{
+		{ir.Mul, types.Long, 65536, 65536, 4294967296},
+		{ir.Shl, types.Long, 1, 40, 1 << 40},
+		{ir.Shr, types.Long, -8, 1, -4},
+		{ir.Shr, types.UnsignedLong, -8, 1, 1<<63 - 4},
+		{ir.Div, types.UnsignedLong, -1, 2, 1<<63 - 1},
+		{ir.Lt, types.UnsignedLong, 1, -1, 1},
+	} {
+		v := foldBinary(test.op, ir.NewInt(test.x, test.typ), ir.NewInt(test.y, test.typ))
+		assert.Equal(test.want, v.(*ir.IntConst).Value, "%v %v %d, %d", test.op, test.typ,
+			test.x, test.y)
+	}
+	// A conversion to a narrower type keeps the low bits, which are
+	// extended with the sign of a short.
+	assert.Equal(int64(3),
+		foldConvert(ir.NewInt(1<<32+3, types.Long), types.Int).(*ir.IntConst).Value)
+	assert.Equal(int64(-1),
+		foldConvert(ir.NewInt(65535, types.Int), types.Short).(*ir.IntConst).Value)
+	// An unsigned long is folded to its bits, and one out of range is not.
+	assert.Equal(int64(-2048),
+		foldConvert(ir.NewFloat(18446744073709549568, types.Double), types.UnsignedLong).(*ir.IntConst).Value)
+	assert.Nil(foldConvert(ir.NewFloat(18446744073709551616, types.Double), types.UnsignedLong))
+}
@@ -0,0 +1,96 @@
+package opt
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+)
+
+// CheckUninitialized returns a warning for each local variable of a lowered
+// program which may be read before it is assigned, on some path through the
+// control-flow graph of its function from the entry, at the first
+// instruction which may read it, in order of the functions. Variables which
+// are kept in memory, because their addresses are taken, are not checked,
+// and neither are the blocks which are never executed.
+func CheckUninitialized(program *ir.Program) []*Warning {
+	var warnings []*Warning
+	for _, f := range program.Functions {
+		warnings = append(warnings, checkUninitialized(f)...)
+	}
+	return warnings
+}
+
+func checkUninitialized(f *ir.Function) []*Warning {
+	params := make(map[*ir.Temp]bool)
+	for _, p := range f.Params {
+		params[p] = true
+	}
+	// The variables which are unassigned on entry.
+	entry := ir.TempSet{}
+	for _, t := range f.Temps {
+		if t.Name != "" && !params[t] {
+			entry[t] = true
+		}
+	}
+	if len(entry) == 0 {
+		return nil
+	}
+
+	// The variables which may be unassigned before each block: those which
+	// are unassigned after some predecessor, or on entry to the function.
+	// This is the least fixed point, so blocks which are never reached have
+	// none.
+	g := ir.NewCFG(f)
+	in := make([]ir.TempSet, len(g.Blocks))
+	out := make([]ir.TempSet, len(g.Blocks))
+	for i := range g.Blocks {
+		in[i], out[i] = ir.TempSet{}, ir.TempSet{}
+	}
+	in[0] = entry
+	for changed := true; changed; {
+		changed = false
+		for _, b := range g.Blocks {
+			for _, p := range b.Preds {
+				for t := range out[p.Index] {
+					if !in[b.Index][t] {
+						in[b.Index][t], changed = true, true
+					}
+				}
+			}
+			assigned := make(map[*ir.Temp]bool)
+			for _, instr := range b.Instrs {
+				if t := ir.Def(instr); t != nil {
+					assigned[t] = true
+				}
+			}
+			for t := range in[b.Index] {
+				if !assigned[t] && !out[b.Index][t] {
+					out[b.Index][t], changed = true, true
+				}
+			}
+		}
+	}
+
+	var warnings []*Warning
+	warned := make(map[*ir.Temp]bool)
+	for _, b := range g.Blocks {
+		unassigned := ir.TempSet{}
+		for t := range in[b.Index] {
+			unassigned[t] = true
+		}
+		for i, instr := range b.Instrs {
+			for _, t := range ir.Uses(instr) {
+				if unassigned[t] && !warned[t] {
+					warned[t] = true
+					warnings = append(warnings, &Warning{
+						Pos:  f.Position(b.Start + i),
+						Msg:  fmt.Sprintf("'%s' may be used uninitialized", ir.BaseName(t.Name)),
+						Name: diag.MaybeUninitialized,
+					})
+				}
+			}
+			delete(unassigned, ir.Def(instr))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,120 @@
+package opt
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// uninitialized lowers a program, returning the warnings about its variables
+// which may be used uninitialized.
+func uninitialized(t *testing.T, input string) []string {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	lowered, err := ir.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	for _, w := range CheckUninitialized(lowered) {
+		warnings = append(warnings, w.String())
+	}
+	return warnings
+}
+
+func TestCheckUninitialized(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"3:3: warning: 'a' may be used uninitialized"},
+		uninitialized(t, `int f(int p) {
+  int a;
+  int b = a + p;
+  return b;
+}`))
+	assert.Equal([]string{"3:3: warning: 'a' may be used uninitialized"},
+		uninitialized(t, `int f(int p) {
+  int a;
+  return a + p;
+}`))
+	// Parameters are assigned on entry.
+	assert.Empty(uninitialized(t, "int f(int p) { int a = p; return a; }"))
+}
+
+func TestCheckUninitializedBranches(t *testing.T) {
+	assert := assert.New(t)
+	// A variable assigned on only one branch may be unassigned after it.
+	assert.Equal([]string{"5:3: warning: 'x' may be used uninitialized"},
+		uninitialized(t, `int f(int c) {
+  int x;
+  if (c)
+    x = 1;
+  return x;
+}`))
+	assert.Empty(uninitialized(t, `int f(int c) {
+  int x;
+  if (c)
+    x = 1;
+  else
+    x = 2;
+  return x;
+}`))
+	// Each variable is reported once, at its first use.
+	assert.Equal([]string{
+		"5:3: warning: 'x' may be used uninitialized",
+		"6:3: warning: 'y' may be used uninitialized",
+	}, uninitialized(t, `int f(int c) {
+  int x;
+  int y;
+  switch (c) { case 1: x = 1; y = 2; }
+  c = x + x;
+  return y + x;
+}`))
+}
+
+func TestCheckUninitializedLoops(t *testing.T) {
+	assert := assert.New(t)
+	// The first iteration reads the variable before it is assigned.
+	assert.Equal([]string{"4:5: warning: 's' may be used uninitialized"},
+		uninitialized(t, `int f(int n) {
+  int s;
+  for (int i = 0; i < n; i = i + 1)
+    s = s + i;
+  return 0;
+}`))
+	// A variable assigned before a loop, or on each iteration before it is
+	// read, is initialized.
+	assert.Empty(uninitialized(t, `int f(int n) {
+  int s = 0;
+  int t;
+  while (n > 0) {
+    t = n * 2;
+    s = s + t;
+    n = n - 1;
+  }
+  return s;
+}`))
+	// A loop which may not execute leaves it unassigned.
+	assert.Equal([]string{"6:3: warning: 't' may be used uninitialized"},
+		uninitialized(t, `int f(int n) {
+  int t;
+  while (n > 0) {
+    t = n--;
+  }
+  return t;
+}`))
+}
+
+func TestCheckUninitializedSkipsMemoryAndDeadBlocks(t *testing.T) {
+	assert := assert.New(t)
+	// A variable whose address is taken may be assigned through a pointer.
+	assert.Empty(uninitialized(t, "int g(int *p); int f() { int a; g(&a); return a; }"))
+	// Code which is never executed reads nothing.
+	assert.Empty(uninitialized(t, "int f() { int a; for (;;) {} return a; }"))
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/gen"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// largeProgram returns a program of at least size bytes, made of copies of a
+// function which uses most kinds of statement and expression.
+func largeProgram(size int) string {
+	var b strings.Builder
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, `int f%d(int a, int b) {
+    int x = 0x1F + a * 0755;
+    double y = 1.5e3;
+    char *s = "a string\n";
+    for (int i = 0; i < b; ++i) {
+        if (x >= i && s[i] != '\0') x += i << 2;
+        else x -= y / 2;
+    }
+    while (x > 100) x = x / 2 - 1;
+    return x ? a : b;
+}
+`, i)
+	}
+	return b.String()
+}
+
+// BenchmarkParse lexes and parses a 1MB program.
+func BenchmarkParse(b *testing.B) {
+	input := largeProgram(1 << 20)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseTokens parses the tokens of a 1MB program, which are lexed
+// up front, to measure the parser alone.
+func BenchmarkParseTokens(b *testing.B) {
+	input := largeProgram(1 << 20)
+	var tokens []token.Token
+	lex := lexer.Lex(input)
+	for t := lex.NextToken(); t.Type != token.EofToken; t = lex.NextToken() {
+		tokens = append(tokens, t)
+	}
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(token.NewSliceTokenStream(tokens)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseGenerated lexes and parses a random program of 1000
+// functions, whose expressions are more deeply nested than those of
+// largeProgram.
+func BenchmarkParseGenerated(b *testing.B) {
+	input := gen.Generate(rand.New(rand.NewSource(1)), gen.Functions(1000))
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
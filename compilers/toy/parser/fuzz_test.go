@@ -0,0 +1,44 @@
+//go:build go1.18
+// +build go1.18
+
+package parser
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"testing"
+)
+
+// FuzzParse checks that the parser does not panic on any input, that it
+// reports errors at a position within the input, and that the formatted form
+// of a valid program parses to the same program.
+func FuzzParse(f *testing.F) {
+	for _, test := range validPrograms {
+		f.Add(test.input)
+	}
+	for _, test := range invalidPrograms {
+		f.Add(test.input)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		program, err := parse(input)
+		if err != nil {
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("parsing %q returned %T, expected *Error", input, err)
+			}
+			if !e.Pos.IsValid() || e.Pos.Offset > len(input) {
+				t.Fatalf("error %v of %q is outside of the input", e, input)
+			}
+			return
+		}
+		formatted := ast.Format(program)
+		reparsed, err := parse(formatted)
+		if err != nil {
+			t.Fatalf("formatting %q produced %q, which does not parse: %v",
+				input, formatted, err)
+		}
+		if again := ast.Format(reparsed); again != formatted {
+			t.Fatalf("formatting %q produced %q, which formats as %q",
+				input, formatted, again)
+		}
+	})
+}
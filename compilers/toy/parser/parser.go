@@ -0,0 +1,1112 @@
+// Package parser implements a recursive-descent parser for the toy language.
+package parser
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A syntax error at a location in the input.
+type Error struct {
+	Pos   token.Position
+	Msg   string
+	Token token.Token // The offending token.
+}
+
+// IsLexical returns whether the error was produced by the lexer, rather than
+// by the parser rejecting a valid token.
+func (e *Error) IsLexical() bool {
+	return e.Token.Type == token.ErrorToken
+}
+
+// IsIncomplete returns whether the error is at the end of the input, so that
+// more input might make it valid.
+func (e *Error) IsIncomplete() bool {
+	return e.Token.Type == token.EofToken
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
+// An ErrorList is the syntax errors of an input, in order, which a parser
+// which recovers from errors returns.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, e := range l {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// IsLexical returns whether the last error was produced by the lexer, which
+// stops at its first error, so that no error can follow it.
+func (l ErrorList) IsLexical() bool {
+	return len(l) > 0 && l[len(l)-1].IsLexical()
+}
+
+// Diagnostic returns the error as a diagnostic which spans the offending
+// token.
+func (e *Error) Diagnostic() *diag.Diagnostic {
+	length := 0
+	switch e.Token.Type {
+	case token.ErrorToken, token.EofToken, token.StringLiteralToken, token.CharLiteralToken:
+		// The value of the token is not its source text.
+	default:
+		length = utf8.RuneCountInString(e.Token.Value)
+	}
+	code := "syntax"
+	if e.IsLexical() {
+		code = "lexical"
+	}
+	return &diag.Diagnostic{
+		Severity: diag.Error,
+		Pos:      e.Pos,
+		Length:   length,
+		Msg:      e.Msg,
+		Code:     code,
+	}
+}
+
+// The compound assignment operators.
+var compoundAssignments = map[token.TokenType]bool{
+	token.AdditionAssignmentToken:       true,
+	token.SubtractionAssignmentToken:    true,
+	token.MultiplicationAssignmentToken: true,
+	token.DivisionAssignmentToken:       true,
+	token.ModuloAssignmentToken:         true,
+	token.ShiftLeftAssignmentToken:      true,
+	token.ShiftRightAssignmentToken:     true,
+	token.BitwiseAndAssignmentToken:     true,
+	token.BitwiseOrAssignmentToken:      true,
+	token.BitwiseXorAssignmentToken:     true,
+}
+
+type parser struct {
+	ts token.TokenStream
+	// The names declared in each enclosing scope, innermost last, each mapped
+	// to whether it is a typedef name rather than an ordinary identifier.
+	// An identifier which is a typedef name begins a declaration, so that
+	// "T * x;" declares x if T is a typedef name, and is otherwise an
+	// expression.
+	scopes []map[string]bool
+	// Whether a name which is not declared in any scope is a typedef name,
+	// or nil if none is.
+	typedefs func(name string) bool
+	// Whether to resume after a syntax error, and the errors so far.
+	recoverErrors bool
+	errors        ErrorList
+	depth         int // The number of braces open.
+}
+
+// An Option configures a parser.
+type Option func(*parser)
+
+// Typedefs returns an Option which classifies an identifier which is not
+// declared by the input as a typedef name if isTypedef reports that it is,
+// such as a name declared by earlier input to an interactive interpreter.
+func Typedefs(isTypedef func(name string) bool) Option {
+	return func(p *parser) {
+		p.typedefs = isTypedef
+	}
+}
+
+// RecoverFromErrors is an Option which makes Parse resume after a syntax
+// error, so that every error of the input is reported, rather than only the
+// first. The tokens are skipped up to the end of the statement or the
+// declaration which has the error, and parsing continues after it. The
+// program is returned without the statements and declarations which have
+// errors, with an ErrorList.
+func RecoverFromErrors(p *parser) {
+	p.recoverErrors = true
+}
+
+// newParser returns a parser of a stream of tokens, at file scope.
+func newParser(ts token.TokenStream, options []Option) *parser {
+	p := &parser{ts: ts}
+	for _, o := range options {
+		o(p)
+	}
+	p.pushScope()
+	return p
+}
+
+// Parse consumes a stream of tokens and returns the program's abstract
+// syntax tree, or the first syntax error encountered. The nodes of the
+// program are numbered.
+func Parse(ts token.TokenStream, options ...Option) (program *ast.Program, err error) {
+	p := newParser(ts, options)
+	defer recoverError(&err)
+	program = p.parseProgram()
+	program.Number()
+	if len(p.errors) > 0 {
+		return program, p.errors
+	}
+	return program, nil
+}
+
+// ParseInput consumes the tokens of a line of input to an interactive
+// interpreter, and returns its enum, typedef and struct declarations,
+// function definitions and statements, each an *ast.EnumDeclaration, an
+// *ast.TypedefDeclaration, an *ast.StructDeclaration, an *ast.Function or an
+// ast.Statement. The input may end with an expression which has no
+// semicolon, which is returned as an ast.Expression.
+func ParseInput(ts token.TokenStream, options ...Option) (nodes []ast.Node, err error) {
+	p := newParser(ts, options)
+	defer recoverError(&err)
+	return p.parseInput(), nil
+}
+
+// recoverError recovers from a syntax error, storing it in *err.
+//
+// Errors are propagated by panicking with an *Error, which is recovered at the
+// entry points of the parser. This keeps the recursive descent functions free
+// of error plumbing.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		*err = e
+	}
+}
+
+// errorf aborts parsing with a syntax error at the given token.
+func (p *parser) errorf(t token.Token, format string, args ...interface{}) {
+	panic(&Error{
+		Pos:   t.Position(),
+		Msg:   fmt.Sprintf(format, args...),
+		Token: t,
+	})
+}
+
+// try runs a function which parses a statement or declaration. If the parser
+// recovers from errors, a syntax error in it is recorded, and skip is called
+// with the number of braces open before it, to skip the rest of its tokens;
+// it returns whether there was none. An error at the same token as the last,
+// which often follows from it, is not recorded. Otherwise, the error aborts
+// parsing.
+func (p *parser) try(parse func(), skip func(depth int)) (ok bool) {
+	if !p.recoverErrors {
+		parse()
+		return true
+	}
+	depth := p.depth
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		e, isError := r.(*Error)
+		if !isError {
+			panic(r)
+		}
+		if n := len(p.errors); n == 0 || p.errors[n-1].Pos != e.Pos {
+			p.errors = append(p.errors, e)
+		}
+		skip(depth)
+		ok = false
+	}()
+	parse()
+	return true
+}
+
+// skipStatement skips the tokens up to the end of a statement which began
+// with depth braces open: a semicolon, or the closing brace of a block which
+// it opened. The closing brace of the enclosing block is not consumed.
+func (p *parser) skipStatement(depth int) {
+	for {
+		switch t := p.ts.Peek(); {
+		case t.Type == token.EofToken, t.Type == token.ErrorToken:
+			return
+		case t.Type == token.CloseBraceToken && p.depth <= depth:
+			return
+		}
+		t := p.advance()
+		if p.depth == depth && (t.Type == token.SemicolonToken || t.Type == token.CloseBraceToken) {
+			return
+		}
+	}
+}
+
+// skipDeclaration skips the tokens up to the end of a declaration at file
+// scope: a semicolon outside any braces, or the brace which closes them, as
+// at the end of a function body, and the semicolon which follows it at the
+// end of a struct or enum. It consumes at least one token, unless at the end
+// of the input.
+func (p *parser) skipDeclaration(depth int) {
+	for {
+		if t := p.ts.Peek(); t.Type == token.EofToken || t.Type == token.ErrorToken {
+			return
+		}
+		t := p.advance()
+		if p.depth == depth && (t.Type == token.SemicolonToken || t.Type == token.CloseBraceToken) {
+			if t.Type == token.CloseBraceToken && p.ts.Peek().Type == token.SemicolonToken {
+				p.advance()
+			}
+			return
+		}
+	}
+}
+
+// advance consumes the next token, which may be an error, counting the
+// braces which are open. A closing brace which matches none is ignored.
+func (p *parser) advance() token.Token {
+	t := p.ts.Peek()
+	p.ts.Next()
+	switch {
+	case t.Type == token.OpenBraceToken:
+		p.depth++
+	case t.Type == token.CloseBraceToken && p.depth > 0:
+		p.depth--
+	}
+	return t
+}
+
+// peek returns the next token without consuming it.
+func (p *parser) peek() token.Token {
+	t := p.ts.Peek()
+	if t.Type == token.ErrorToken {
+		p.errorf(t, "%s", t.Value)
+	}
+	return t
+}
+
+// next consumes and returns the next token.
+func (p *parser) next() token.Token {
+	t := p.peek()
+	if t.Type != token.EofToken {
+		p.advance()
+	}
+	return t
+}
+
+// expect consumes the next token, which must be of the given type. Another
+// token is not consumed, so that a parser which recovers from the error may
+// resume at it, such as at a closing brace.
+func (p *parser) expect(tokenType token.TokenType, what string) token.Token {
+	t := p.peek()
+	if t.Type != tokenType {
+		p.errorf(t, "expected %s, found %v", what, t)
+	}
+	return p.next()
+}
+
+// pushScope enters a new scope, in which no names are yet declared.
+func (p *parser) pushScope() {
+	p.scopes = append(p.scopes, make(map[string]bool))
+}
+
+func (p *parser) popScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+// declare declares a name in the current scope, which hides any declaration
+// of it in an enclosing scope.
+func (p *parser) declare(name token.Token, typedef bool) {
+	p.scopes[len(p.scopes)-1][name.Value] = typedef
+}
+
+// isTypedefName returns whether the innermost declaration of a name declares
+// it as a typedef name.
+func (p *parser) isTypedefName(name string) bool {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if typedef, ok := p.scopes[i][name]; ok {
+			return typedef
+		}
+	}
+	return p.typedefs != nil && p.typedefs(name)
+}
+
+// program = { enum | typedef | struct | declaration | function } EOF
+func (p *parser) parseProgram() *ast.Program {
+	program := &ast.Program{}
+	// The lexer stops at its first error, so parsing does too.
+	for !p.errors.IsLexical() && p.ts.Peek().Type != token.EofToken {
+		p.try(func() {
+			switch t := p.peek(); {
+			case p.startsEnum():
+				program.Enums = append(program.Enums, p.parseEnum())
+			case t.Type == token.TypedefKeywordToken:
+				program.Typedefs = append(program.Typedefs, p.parseTypedef())
+			case p.startsStruct():
+				program.Structs = append(program.Structs, p.parseStruct())
+			case (p.isTypeSpecifier(t) || isStorageClass(t.Type)) && !p.startsFunction():
+				program.Globals = append(program.Globals, p.parseDeclaration())
+			default:
+				program.Functions = append(program.Functions, p.parseFunction())
+			}
+		}, p.skipDeclaration)
+	}
+	return program
+}
+
+// input = { enum | typedef | struct | function | statement } [ expression ] EOF
+func (p *parser) parseInput() []ast.Node {
+	var nodes []ast.Node
+	for t := p.peek(); t.Type != token.EofToken; t = p.peek() {
+		switch {
+		case p.startsEnum():
+			nodes = append(nodes, p.parseEnum())
+		case t.Type == token.TypedefKeywordToken:
+			nodes = append(nodes, p.parseTypedef())
+		case p.startsStruct():
+			nodes = append(nodes, p.parseStruct())
+		case p.startsFunction():
+			nodes = append(nodes, p.parseFunction())
+		case startsExpression(t) && !p.isTypeSpecifier(t) && !p.startsLabel():
+			e := p.parseExpression()
+			if p.peek().Type == token.EofToken {
+				nodes = append(nodes, e)
+				break
+			}
+			p.expect(token.SemicolonToken, "';'")
+			nodes = append(nodes, &ast.ExpressionStatement{Expression: e})
+		default:
+			nodes = append(nodes, p.parseStatement())
+		}
+	}
+	return nodes
+}
+
+// startsStruct returns whether the next tokens are "struct", a name and "{",
+// which begin a struct declaration rather than the type of a declaration.
+func (p *parser) startsStruct() bool {
+	return p.peek().Type == token.StructKeywordToken &&
+		p.ts.PeekN(2).Type == token.IdentifierToken &&
+		p.ts.PeekN(3).Type == token.OpenBraceToken
+}
+
+// startsEnum returns whether the next tokens are "enum", an optional name and
+// "{", which begin an enum declaration rather than the type of a declaration.
+func (p *parser) startsEnum() bool {
+	if p.peek().Type != token.EnumKeywordToken {
+		return false
+	}
+	n := 2
+	if p.ts.PeekN(n).Type == token.IdentifierToken {
+		n++
+	}
+	return p.ts.PeekN(n).Type == token.OpenBraceToken
+}
+
+// startsFunction returns whether the next tokens are an optional storage
+// class, a type, any number of '*', a name and "(", which begin a function
+// rather than a declaration.
+func (p *parser) startsFunction() bool {
+	// Read ahead over the type, and then return to it.
+	checkpoint := p.ts.Checkpoint()
+	defer p.ts.Rewind(checkpoint)
+	if isStorageClass(p.ts.Peek().Type) {
+		p.ts.Next()
+	}
+	if !p.isTypeSpecifier(p.ts.Peek()) {
+		return false
+	}
+	p.ts.Next()
+	switch t := p.ts.Value().Type; {
+	case t == token.StructKeywordToken || t == token.EnumKeywordToken:
+		p.ts.Next()
+	case isIntegerKeyword(t):
+		for isIntegerKeyword(p.ts.Peek().Type) {
+			p.ts.Next()
+		}
+	}
+	for p.ts.Peek().Type == token.MultiplicationToken {
+		p.ts.Next()
+	}
+	return p.ts.Peek().Type == token.IdentifierToken &&
+		p.ts.PeekN(2).Type == token.OpenParenthesisToken
+}
+
+// isTypeSpecifier returns whether a token names a type: a type keyword, or an
+// identifier which is declared as a typedef name.
+func (p *parser) isTypeSpecifier(t token.Token) bool {
+	switch t.Type {
+	case token.IntKeywordToken, token.FloatKeywordToken,
+		token.DoubleKeywordToken, token.CharKeywordToken,
+		token.StructKeywordToken, token.EnumKeywordToken,
+		token.UnsignedKeywordToken, token.SignedKeywordToken,
+		token.ShortKeywordToken, token.LongKeywordToken:
+		return true
+	case token.IdentifierToken:
+		return p.isTypedefName(t.Value)
+	}
+	return false
+}
+
+// isIntegerKeyword returns whether a token type is one of the keywords which
+// together name an integer type.
+func isIntegerKeyword(t token.TokenType) bool {
+	switch t {
+	case token.UnsignedKeywordToken, token.SignedKeywordToken, token.CharKeywordToken,
+		token.ShortKeywordToken, token.IntKeywordToken, token.LongKeywordToken:
+		return true
+	}
+	return false
+}
+
+// type = "float" | "double" | integer-type | "struct" identifier | "enum" identifier | typedef-name
+// integer-type = [ "unsigned" | "signed" ] ( "char" | "short" [ "int" ] | "int" | "long" [ "int" ] ) | "unsigned" | "signed"
+//
+// parseType returns the type keyword or typedef name, and the name of the
+// struct or enum, or the keywords which follow the first of an integer type,
+// as in "long int" after "unsigned", which is the zero Token for other types.
+func (p *parser) parseType() (typ, tag token.Token) {
+	typ = p.peek()
+	if !p.isTypeSpecifier(typ) {
+		p.errorf(typ, "expected type, found %v", typ)
+	}
+	p.next()
+	switch typ.Type {
+	case token.StructKeywordToken:
+		tag = p.expect(token.IdentifierToken, "struct name")
+	case token.EnumKeywordToken:
+		tag = p.expect(token.IdentifierToken, "enum name")
+	case token.UnsignedKeywordToken, token.SignedKeywordToken:
+		switch p.peek().Type {
+		case token.CharKeywordToken, token.IntKeywordToken:
+			tag = p.next()
+		case token.ShortKeywordToken, token.LongKeywordToken:
+			tag = p.next()
+			if p.peek().Type == token.IntKeywordToken {
+				tag.Value += " " + p.next().Value
+			}
+		}
+	case token.ShortKeywordToken, token.LongKeywordToken:
+		if p.peek().Type == token.IntKeywordToken {
+			tag = p.next()
+		}
+	}
+	return typ, tag
+}
+
+// enum = "enum" [ identifier ] "{" enumerator { "," enumerator } [ "," ] "}" ";"
+// enumerator = identifier [ "=" conditional ]
+func (p *parser) parseEnum() *ast.EnumDeclaration {
+	d := &ast.EnumDeclaration{
+		Enum: p.expect(token.EnumKeywordToken, "'enum'").Position(),
+	}
+	if p.peek().Type == token.IdentifierToken {
+		d.Name = p.next()
+	}
+	p.expect(token.OpenBraceToken, "'{'")
+	for {
+		e := &ast.Enumerator{Name: p.expect(token.IdentifierToken, "enumerator")}
+		p.declare(e.Name, false)
+		if p.peek().Type == token.AssignmentToken {
+			p.next()
+			e.Value = p.parseConditional()
+		}
+		d.Enumerators = append(d.Enumerators, e)
+		if p.peek().Type != token.CommaToken {
+			break
+		}
+		p.next()
+		if p.peek().Type == token.CloseBraceToken {
+			break
+		}
+	}
+	p.expect(token.CloseBraceToken, "'}'")
+	p.expect(token.SemicolonToken, "';'")
+	return d
+}
+
+// typedef = "typedef" type pointers identifier lengths ";"
+func (p *parser) parseTypedef() *ast.TypedefDeclaration {
+	d := &ast.TypedefDeclaration{
+		Typedef: p.expect(token.TypedefKeywordToken, "'typedef'").Position(),
+	}
+	d.Type, d.Tag = p.parseType()
+	d.Pointers = p.parsePointers()
+	d.Name = p.expect(token.IdentifierToken, "typedef name")
+	d.Lengths = p.parseLengths()
+	p.expect(token.SemicolonToken, "';'")
+	p.declare(d.Name, true)
+	return d
+}
+
+// struct = "struct" identifier "{" field { field } "}" ";"
+// field = type pointers identifier lengths ";"
+func (p *parser) parseStruct() *ast.StructDeclaration {
+	d := &ast.StructDeclaration{
+		Struct: p.expect(token.StructKeywordToken, "'struct'").Position(),
+	}
+	d.Name = p.expect(token.IdentifierToken, "struct name")
+	p.expect(token.OpenBraceToken, "'{'")
+	for {
+		f := &ast.Field{}
+		f.Type, f.Tag = p.parseType()
+		f.Pointers = p.parsePointers()
+		f.Name = p.expect(token.IdentifierToken, "field name")
+		f.Lengths = p.parseLengths()
+		p.expect(token.SemicolonToken, "';'")
+		d.Fields = append(d.Fields, f)
+		if p.peek().Type == token.CloseBraceToken {
+			break
+		}
+	}
+	p.next()
+	p.expect(token.SemicolonToken, "';'")
+	return d
+}
+
+// pointers = { "*" }
+//
+// parsePointers returns the number of '*' which follow a type.
+func (p *parser) parsePointers() int {
+	n := 0
+	for p.peek().Type == token.MultiplicationToken {
+		p.next()
+		n++
+	}
+	return n
+}
+
+// function = [ storage ] type pointers identifier "(" [ parameters ] ")" ( "{" statement* "}" | ";" )
+// parameters = parameter { "," parameter } [ "," "..." ]
+func (p *parser) parseFunction() *ast.Function {
+	f := &ast.Function{Storage: p.parseStorage()}
+	f.Type, f.Tag = p.parseType()
+	f.Pointers = p.parsePointers()
+	f.Name = p.expect(token.IdentifierToken, "function name")
+	p.declare(f.Name, false)
+	// The scope of the parameters extends to the end of the body.
+	p.pushScope()
+	defer p.popScope()
+	p.expect(token.OpenParenthesisToken, "'('")
+	if p.isTypeSpecifier(p.peek()) {
+		f.Params = append(f.Params, p.parseParameter())
+		for p.peek().Type == token.CommaToken {
+			p.next()
+			if p.peek().Type == token.EllipsisToken {
+				p.next()
+				f.Variadic = true
+				break
+			}
+			f.Params = append(f.Params, p.parseParameter())
+		}
+	}
+	p.expect(token.CloseParenthesisToken, "')'")
+	if p.peek().Type == token.SemicolonToken {
+		p.next()
+		f.Prototype = true
+		return f
+	}
+	p.expect(token.OpenBraceToken, "'{'")
+	f.Body = p.parseStatements()
+	return f
+}
+
+// parameter = type pointers [ identifier ] lengths
+//
+// Any parameter may be unnamed. Checking that the parameters of function
+// definitions are named is left to semantic analysis.
+func (p *parser) parseParameter() *ast.Parameter {
+	param := &ast.Parameter{}
+	param.Type, param.Tag = p.parseType()
+	param.Pointers = p.parsePointers()
+	if p.peek().Type == token.IdentifierToken {
+		param.Name = p.next()
+		p.declare(param.Name, false)
+	}
+	param.Lengths = p.parseLengths()
+	return param
+}
+
+// lengths = { "[" [ conditional ] "]" }
+//
+// parseLengths returns the lengths of the dimensions of an array declarator,
+// each of which is nil if omitted. Checking that the lengths are constants,
+// and that only the length of an array parameter may be omitted, is left to
+// semantic analysis.
+func (p *parser) parseLengths() []ast.Expression {
+	var lengths []ast.Expression
+	for p.peek().Type == token.OpenBracketToken {
+		p.next()
+		var length ast.Expression
+		if p.peek().Type != token.CloseBracketToken {
+			length = p.parseConditional()
+		}
+		p.expect(token.CloseBracketToken, "']'")
+		lengths = append(lengths, length)
+	}
+	return lengths
+}
+
+// statement = declaration | substatement
+func (p *parser) parseStatement() ast.Statement {
+	t := p.peek()
+	if (p.isTypeSpecifier(t) || isStorageClass(t.Type)) && !p.startsLabel() {
+		return p.parseDeclaration()
+	}
+	return p.parseSubstatement()
+}
+
+// substatement = "return" expression ";" | if | while | do | for | switch | case | label | "goto" identifier ";" | "break" ";" | "continue" ";" | block | expression ";"
+//
+// A substatement is any statement other than a declaration, which may not be
+// the body of an if statement or a loop.
+func (p *parser) parseSubstatement() ast.Statement {
+	t := p.peek()
+	switch t.Type {
+	case token.ReturnKeywordToken:
+		p.next()
+		s := &ast.ReturnStatement{Return: t.Position()}
+		s.Value = p.parseExpression()
+		p.expect(token.SemicolonToken, "';'")
+		return s
+	case token.IfKeywordToken:
+		return p.parseIf()
+	case token.WhileKeywordToken:
+		return p.parseWhile()
+	case token.DoKeywordToken:
+		return p.parseDoWhile()
+	case token.ForKeywordToken:
+		return p.parseFor()
+	case token.SwitchKeywordToken:
+		return p.parseSwitch()
+	case token.CaseKeywordToken, token.DefaultKeywordToken:
+		return p.parseCase()
+	case token.GotoKeywordToken:
+		p.next()
+		s := &ast.GotoStatement{Goto: t.Position(),
+			Label: p.expect(token.IdentifierToken, "label")}
+		p.expect(token.SemicolonToken, "';'")
+		return s
+	case token.BreakKeywordToken:
+		p.next()
+		p.expect(token.SemicolonToken, "';'")
+		return &ast.BreakStatement{Break: t.Position()}
+	case token.ContinueKeywordToken:
+		p.next()
+		p.expect(token.SemicolonToken, "';'")
+		return &ast.ContinueStatement{Continue: t.Position()}
+	case token.OpenBraceToken:
+		return p.parseBlock()
+	}
+
+	if p.startsLabel() {
+		return p.parseLabel()
+	}
+	if !startsExpression(t) {
+		p.errorf(t, "expected statement, found %v", t)
+	}
+	s := &ast.ExpressionStatement{Expression: p.parseExpression()}
+	p.expect(token.SemicolonToken, "';'")
+	return s
+}
+
+// if = "if" "(" expression ")" substatement [ "else" substatement ]
+//
+// An else belongs to the innermost if which does not yet have one, so that
+// "if (a) if (b) x; else y;" is parsed as "if (a) { if (b) x; else y; }".
+func (p *parser) parseIf() *ast.IfStatement {
+	s := &ast.IfStatement{If: p.expect(token.IfKeywordToken, "'if'").Position()}
+	p.expect(token.OpenParenthesisToken, "'('")
+	s.Cond = p.parseExpression()
+	p.expect(token.CloseParenthesisToken, "')'")
+	s.Then = p.parseSubstatement()
+	if p.peek().Type == token.ElseKeywordToken {
+		p.next()
+		s.Else = p.parseSubstatement()
+	}
+	return s
+}
+
+// while = "while" "(" expression ")" substatement
+func (p *parser) parseWhile() *ast.WhileStatement {
+	s := &ast.WhileStatement{
+		While: p.expect(token.WhileKeywordToken, "'while'").Position(),
+	}
+	p.expect(token.OpenParenthesisToken, "'('")
+	s.Cond = p.parseExpression()
+	p.expect(token.CloseParenthesisToken, "')'")
+	s.Body = p.parseSubstatement()
+	return s
+}
+
+// do = "do" substatement "while" "(" expression ")" ";"
+func (p *parser) parseDoWhile() *ast.DoWhileStatement {
+	s := &ast.DoWhileStatement{
+		Do: p.expect(token.DoKeywordToken, "'do'").Position(),
+	}
+	s.Body = p.parseSubstatement()
+	p.expect(token.WhileKeywordToken, "'while'")
+	p.expect(token.OpenParenthesisToken, "'('")
+	s.Cond = p.parseExpression()
+	p.expect(token.CloseParenthesisToken, "')'")
+	p.expect(token.SemicolonToken, "';'")
+	return s
+}
+
+// for = "for" "(" ( declaration | [ expression ] ";" ) [ expression ] ";" [ expression ] ")" substatement
+func (p *parser) parseFor() *ast.ForStatement {
+	s := &ast.ForStatement{
+		For: p.expect(token.ForKeywordToken, "'for'").Position(),
+	}
+	p.expect(token.OpenParenthesisToken, "'('")
+	p.pushScope()
+	defer p.popScope()
+	switch t := p.peek(); {
+	case p.isTypeSpecifier(t):
+		s.Init = p.parseDeclaration()
+	case t.Type == token.SemicolonToken:
+		p.next()
+	default:
+		s.Init = &ast.ExpressionStatement{Expression: p.parseExpression()}
+		p.expect(token.SemicolonToken, "';'")
+	}
+	if p.peek().Type != token.SemicolonToken {
+		s.Cond = p.parseExpression()
+	}
+	p.expect(token.SemicolonToken, "';'")
+	if p.peek().Type != token.CloseParenthesisToken {
+		s.Post = p.parseExpression()
+	}
+	p.expect(token.CloseParenthesisToken, "')'")
+	s.Body = p.parseSubstatement()
+	return s
+}
+
+// switch = "switch" "(" expression ")" substatement
+func (p *parser) parseSwitch() *ast.SwitchStatement {
+	s := &ast.SwitchStatement{
+		Switch: p.expect(token.SwitchKeywordToken, "'switch'").Position(),
+	}
+	p.expect(token.OpenParenthesisToken, "'('")
+	s.Value = p.parseExpression()
+	p.expect(token.CloseParenthesisToken, "')'")
+	s.Body = p.parseSubstatement()
+	return s
+}
+
+// case = ( "case" expression | "default" ) ":" substatement
+//
+// Checking that case labels are constant and within a switch is left to
+// semantic analysis.
+func (p *parser) parseCase() *ast.CaseStatement {
+	t := p.next()
+	s := &ast.CaseStatement{Case: t.Position()}
+	if t.Type == token.CaseKeywordToken {
+		s.Value = p.parseExpression()
+	}
+	p.expect(token.ColonToken, "':'")
+	s.Body = p.parseSubstatement()
+	return s
+}
+
+// startsLabel returns whether the next tokens are an identifier and ":",
+// which begin a labelled statement. Labels are in their own namespace, so
+// the identifier may also be a typedef name.
+func (p *parser) startsLabel() bool {
+	return p.peek().Type == token.IdentifierToken &&
+		p.ts.PeekN(2).Type == token.ColonToken
+}
+
+// label = identifier ":" substatement
+//
+// Checking that labels are unique within a function, and that the label of
+// every goto exists, is left to semantic analysis.
+func (p *parser) parseLabel() *ast.LabeledStatement {
+	s := &ast.LabeledStatement{Label: p.next()}
+	p.expect(token.ColonToken, "':'")
+	s.Body = p.parseSubstatement()
+	return s
+}
+
+// declaration = [ storage ] type pointers identifier lengths [ "=" expression ] ";"
+//
+// A declaration in a block may have a storage class, which is left to
+// semantic analysis to reject.
+func (p *parser) parseDeclaration() *ast.VariableDeclaration {
+	d := &ast.VariableDeclaration{Storage: p.parseStorage()}
+	d.Type, d.Tag = p.parseType()
+	d.Pointers = p.parsePointers()
+	d.Name = p.expect(token.IdentifierToken, "variable name")
+	// The name hides any typedef name from here on, including in the
+	// initializer.
+	p.declare(d.Name, false)
+	d.Lengths = p.parseLengths()
+	if p.peek().Type == token.AssignmentToken {
+		p.next()
+		d.Init = p.parseExpression()
+	}
+	p.expect(token.SemicolonToken, "';'")
+	return d
+}
+
+// storage = "extern" | "static"
+//
+// parseStorage returns the storage class which begins a declaration, or the
+// zero Token if it has none.
+func (p *parser) parseStorage() token.Token {
+	if isStorageClass(p.peek().Type) {
+		return p.next()
+	}
+	return token.Token{}
+}
+
+// isStorageClass returns whether a token is a storage class keyword.
+func isStorageClass(t token.TokenType) bool {
+	return t == token.ExternKeywordToken || t == token.StaticKeywordToken
+}
+
+// block = "{" statement* "}"
+func (p *parser) parseBlock() *ast.Block {
+	b := &ast.Block{Open: p.expect(token.OpenBraceToken, "'{'").Position()}
+	p.pushScope()
+	defer p.popScope()
+	b.Statements = p.parseStatements()
+	return b
+}
+
+// parseStatements parses the statements of a block, up to and including its
+// closing brace. If the parser recovers from errors, the statements with
+// errors are omitted.
+func (p *parser) parseStatements() []ast.Statement {
+	var statements []ast.Statement
+	for t := p.peek(); t.Type != token.CloseBraceToken; t = p.peek() {
+		if t.Type == token.EofToken {
+			p.errorf(t, "expected '}', found %v", t)
+		}
+		p.try(func() {
+			statements = append(statements, p.parseStatement())
+		}, p.skipStatement)
+	}
+	p.next()
+	return statements
+}
+
+// startsExpression returns whether a token may begin an expression.
+func startsExpression(t token.Token) bool {
+	switch t.Type {
+	case token.NumberToken, token.FloatLiteralToken, token.IdentifierToken,
+		token.StringLiteralToken, token.CharLiteralToken,
+		token.OpenParenthesisToken,
+		token.LogicalNegationToken, token.BitwiseComplementToken,
+		token.NegationToken, token.MultiplicationToken, token.BitwiseAndToken,
+		token.IncrementToken, token.DecrementToken, token.SizeofKeywordToken:
+		return true
+	}
+	return false
+}
+
+// expression = conditional [ ("=" | "+=" | "-=" | ...) expression ]
+//
+// Any expression is accepted as the target of an assignment. Checking that it
+// is an lvalue is left to semantic analysis.
+func (p *parser) parseExpression() ast.Expression {
+	lhs := p.parseConditional()
+	t := p.peek()
+	if t.Type == token.AssignmentToken {
+		p.next()
+		return &ast.Assignment{Operator: t, Lhs: lhs, Rhs: p.parseExpression()}
+	}
+	if compoundAssignments[t.Type] {
+		p.next()
+		return &ast.CompoundAssignment{Operator: t, Lhs: lhs,
+			Rhs: p.parseExpression()}
+	}
+	return lhs
+}
+
+// conditional = binary [ "?" expression ":" conditional ]
+func (p *parser) parseConditional() ast.Expression {
+	cond := p.parseBinary(1)
+	if p.peek().Type != token.QuestionToken {
+		return cond
+	}
+	p.next()
+	c := &ast.ConditionalExpression{Cond: cond, Then: p.parseExpression()}
+	p.expect(token.ColonToken, "':'")
+	c.Else = p.parseConditional()
+	return c
+}
+
+// parseBinary parses a sequence of binary operators with a precedence of at
+// least minPrecedence, using precedence climbing.
+func (p *parser) parseBinary(minPrecedence int) ast.Expression {
+	lhs := p.parseUnary()
+	for {
+		operator := p.peek()
+		precedence := operator.Type.Precedence()
+		if precedence == 0 || precedence < minPrecedence {
+			return lhs
+		}
+		p.next()
+		// The right operand of a left-associative operator binds tighter.
+		next := precedence + 1
+		if operator.Type.Associativity() == token.RightAssociative {
+			next = precedence
+		}
+		rhs := p.parseBinary(next)
+		lhs = &ast.BinaryOp{Operator: operator, Lhs: lhs, Rhs: rhs}
+	}
+}
+
+// unary = ("!" | "~" | "-" | "*" | "&") unary | ("++" | "--") unary | sizeof | cast | postfix
+//
+// Checking that the operand of "&" is an lvalue is left to semantic analysis.
+func (p *parser) parseUnary() ast.Expression {
+	t := p.peek()
+	switch t.Type {
+	case token.SizeofKeywordToken:
+		return p.parseSizeof()
+	case token.OpenParenthesisToken:
+		if p.isTypeSpecifier(p.ts.PeekN(2)) {
+			return p.parseCast()
+		}
+	case token.LogicalNegationToken, token.BitwiseComplementToken,
+		token.NegationToken, token.MultiplicationToken, token.BitwiseAndToken:
+		p.next()
+		return &ast.UnaryOp{Operator: t, Operand: p.parseUnary()}
+	case token.IncrementToken, token.DecrementToken:
+		p.next()
+		return &ast.IncDecOp{Operator: t, Operand: p.parseUnary()}
+	}
+	return p.parsePostfix()
+}
+
+// sizeof = "sizeof" unary | "sizeof" "(" typename ")"
+//
+// A parenthesized operand is a type name if it begins with a type specifier,
+// and otherwise an expression, as in "sizeof(x) * 2".
+func (p *parser) parseSizeof() *ast.Sizeof {
+	s := &ast.Sizeof{Sizeof: p.next()}
+	if p.peek().Type == token.OpenParenthesisToken && p.isTypeSpecifier(p.ts.PeekN(2)) {
+		p.next()
+		s.TypeName = p.parseTypeName()
+		p.expect(token.CloseParenthesisToken, "')'")
+		return s
+	}
+	s.Operand = p.parseUnary()
+	return s
+}
+
+// cast = "(" typename ")" unary
+//
+// Like the operand of sizeof, a parenthesized type name is told apart from a
+// parenthesized expression by the type specifier which begins it, so "(int)x"
+// is a cast and "(x)" an expression.
+func (p *parser) parseCast() *ast.Conversion {
+	c := &ast.Conversion{Lparen: p.next()}
+	c.TypeName = p.parseTypeName()
+	p.expect(token.CloseParenthesisToken, "')'")
+	c.Operand = p.parseUnary()
+	return c
+}
+
+// typename = type pointers lengths
+func (p *parser) parseTypeName() *ast.TypeName {
+	n := &ast.TypeName{}
+	n.Type, n.Tag = p.parseType()
+	n.Pointers = p.parsePointers()
+	n.Lengths = p.parseLengths()
+	return n
+}
+
+// postfix = primary { "++" | "--" | "[" expression "]" | ( "." | "->" ) identifier }
+func (p *parser) parsePostfix() ast.Expression {
+	e := p.parsePrimary()
+	for {
+		t := p.peek()
+		switch t.Type {
+		case token.IncrementToken, token.DecrementToken:
+			p.next()
+			e = &ast.IncDecOp{Operator: t, Operand: e, Postfix: true}
+		case token.OpenBracketToken:
+			p.next()
+			e = &ast.Subscript{Array: e, Index: p.parseExpression()}
+			p.expect(token.CloseBracketToken, "']'")
+		case token.DotToken, token.ArrowToken:
+			p.next()
+			e = &ast.Member{X: e, Operator: t,
+				Name: p.expect(token.IdentifierToken, "field name")}
+		default:
+			return e
+		}
+	}
+}
+
+// primary = number | float | string { string } | char | identifier | call
+//
+//	| "(" expression ")"
+//
+// Adjacent string literals are concatenated, as in "ab" "c".
+func (p *parser) parsePrimary() ast.Expression {
+	t := p.peek()
+	switch t.Type {
+	case token.IdentifierToken, token.NumberToken, token.FloatLiteralToken,
+		token.StringLiteralToken, token.CharLiteralToken, token.OpenParenthesisToken:
+		p.next()
+	default:
+		// As in expect, the token is not consumed.
+		p.errorf(t, "expected expression, found %v", t)
+	}
+	switch t.Type {
+	case token.IdentifierToken:
+		if p.peek().Type == token.OpenParenthesisToken {
+			return p.parseCall(&ast.Identifier{Token: t})
+		}
+		return &ast.Identifier{Token: t}
+	case token.NumberToken:
+		// The base is given by the prefix of the literal: "0x" for hexadecimal,
+		// "0b" for binary, or "0" for octal. The suffix is left to type
+		// checking, and the value of an unsigned long may exceed that of a
+		// long, so it is parsed as unsigned and kept as its bits.
+		value, err := strconv.ParseUint(strings.TrimRight(t.Value, "uUlL"), 0, 64)
+		if err != nil {
+			p.errorf(t, "invalid integer literal %v", t)
+		}
+		return &ast.IntLiteral{Token: t, Value: int64(value)}
+	case token.FloatLiteralToken:
+		text, bits := t.Value, 64
+		if strings.ContainsAny(text, "fF") {
+			text, bits = text[:len(text)-1], 32
+		}
+		value, err := strconv.ParseFloat(text, bits)
+		if err != nil {
+			p.errorf(t, "invalid floating-point literal %v", t)
+		}
+		return &ast.FloatLiteral{Token: t, Value: value}
+	case token.StringLiteralToken:
+		s := &ast.StringLiteral{Token: t, Value: t.Value}
+		for p.peek().Type == token.StringLiteralToken {
+			s.Value += p.next().Value
+		}
+		return s
+	case token.CharLiteralToken:
+		// A character constant has the value of the character as a char,
+		// which is signed.
+		return &ast.IntLiteral{Token: t, Value: int64(int8([]rune(t.Value)[0]))}
+	case token.OpenParenthesisToken:
+		e := p.parseExpression()
+		p.expect(token.CloseParenthesisToken, "')'")
+		return e
+	}
+	panic("unreachable")
+}
+
+// call = identifier "(" [ expression { "," expression } ] ")"
+func (p *parser) parseCall(function *ast.Identifier) *ast.Call {
+	c := &ast.Call{Function: function}
+	p.expect(token.OpenParenthesisToken, "'('")
+	if p.peek().Type != token.CloseParenthesisToken {
+		c.Args = append(c.Args, p.parseExpression())
+		for p.peek().Type == token.CommaToken {
+			p.next()
+			c.Args = append(c.Args, p.parseExpression())
+		}
+	}
+	p.expect(token.CloseParenthesisToken, "')'")
+	return c
+}
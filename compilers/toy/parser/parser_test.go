@@ -0,0 +1,705 @@
+package parser
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/gen"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func parse(input string) (*ast.Program, error) {
+	return Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+}
+
+// Test inputs from github.com/nlsandler/write_a_c_compiler/stage_{1..4}/valid,
+// and the AST that they are expected to produce.
+var validPrograms = []struct {
+	input string
+	ast   string
+}{
+	{"int main() {\n    return 100;\n}", "int main() { return 100; }"},
+	{"\nint \nmain\n(   \n)\n{\nreturn\n0\n;\n}", "int main() { return 0; }"},
+	{"int main(){return 0;}", "int main() { return 0; }"},
+	{"   int   main    (  )  {   return  0 ; }", "int main() { return 0; }"},
+	{"int main() {\n    return !5;\n}", "int main() { return (!5); }"},
+	{"int main() {\n    return ~12;\n}", "int main() { return (~12); }"},
+	{"int main() {\n    return -~0;\n}", "int main() { return (-(~0)); }"},
+	{"int main() {\n    return !-3;\n}", "int main() { return (!(-3)); }"},
+	{"int main() { return 1 + 2; }", "int main() { return (1 + 2); }"},
+	{"int main() { return 1 - 2 - 3; }", "int main() { return ((1 - 2) - 3); }"},
+	{"int main() { return 6 / 3 / 2; }", "int main() { return ((6 / 3) / 2); }"},
+	{"int main() { return 2 + 3 * 4; }", "int main() { return (2 + (3 * 4)); }"},
+	{"int main() { return 2 * (3 + 4); }", "int main() { return (2 * (3 + 4)); }"},
+	{"int main() { return ~2 + 3; }", "int main() { return ((~2) + 3); }"},
+	{"int main() { return -(-1 * 2); }", "int main() { return (-((-1) * 2)); }"},
+	{"int main() { return 1 || 0 && 2; }", "int main() { return (1 || (0 && 2)); }"},
+	{"int main() { return 7 % 3 * 2 / 1; }", "int main() { return (((7 % 3) * 2) / 1); }"},
+	// Bitwise and shift operators, at the precedence levels of C.
+	{"int main() { return 1 || 2 && 3 | 4 ^ 5 & 6 == 7; }",
+		"int main() { return (1 || (2 && (3 | (4 ^ (5 & (6 == 7)))))); }"},
+	{"int main() { return 1 == 2 & 3 != 4 ^ 5 < 6 | 7; }",
+		"int main() { return ((((1 == 2) & (3 != 4)) ^ (5 < 6)) | 7); }"},
+	{"int main() { return 1 < 2 << 3 + 4 >> 5 * 6; }",
+		"int main() { return (1 < ((2 << (3 + 4)) >> (5 * 6))); }"},
+	{"int main() { return ~1 & ~2 | 3 ^ 4; }",
+		"int main() { return (((~1) & (~2)) | (3 ^ 4)); }"},
+	{"int main() { return 1 & 2 & 3 << 4 << 5; }",
+		"int main() { return ((1 & 2) & ((3 << 4) << 5)); }"},
+	// Compound assignment and increment operators.
+	{"int main() { int a; a += 1; a -= 2; a *= 3; a /= 4; a %= 5; return a; }",
+		"int main() { int a; (a += 1); (a -= 2); (a *= 3); (a /= 4); (a %= 5); return a; }"},
+	{"int main() { int a; a <<= 1; a >>= 2; a &= 3; a |= 4; a ^= 5; return a; }",
+		"int main() { int a; (a <<= 1); (a >>= 2); (a &= 3); (a |= 4); (a ^= 5); return a; }"},
+	{"int main() { int a; int b; a = b += 1 + 2; return a; }",
+		"int main() { int a; int b; (a = (b += (1 + 2))); return a; }"},
+	{"int main() { int a; a++; ++a; a--; --a; return -a++ + !--a; }",
+		"int main() { int a; (a++); (++a); (a--); (--a); return ((-(a++)) + (!(--a))); }"},
+	{"int main() { int a; return a+++a; }", "int main() { int a; return ((a++) + a); }"},
+	{"int main() { int a; return a---a; }", "int main() { int a; return ((a--) - a); }"},
+	{"int main() { int a; return ++a++; }", "int main() { int a; return (++(a++)); }"},
+	{"int main() { int a; return (++a)--; }", "int main() { int a; return ((++a)--); }"},
+	{"int main() { int a; return 1 ? a : a += 1; }",
+		"int main() { int a; return ((1 ? a : a) += 1); }"},
+	{"int main() { int i; for (i = 0; i < 3; i++) { } return i; }",
+		"int main() { int i; for ((i = 0); (i < 3); (i++)) { } return i; }"},
+	// The conditional operator binds looser than any binary operator, and is
+	// right-associative.
+	{"int main() { return 1 || 2 ? 3 + 4 : 5 && 6; }",
+		"int main() { return ((1 || 2) ? (3 + 4) : (5 && 6)); }"},
+	{"int main() { return 1 ? 2 : 3 ? 4 : 5; }",
+		"int main() { return (1 ? 2 : (3 ? 4 : 5)); }"},
+	{"int main() { return 1 ? 2 ? 3 : 4 : 5; }",
+		"int main() { return (1 ? (2 ? 3 : 4) : 5); }"},
+	{"int main() { return (1 ? 2 : 3) ? 4 : 5; }",
+		"int main() { return ((1 ? 2 : 3) ? 4 : 5); }"},
+	{"int main() { int a; a = 1 ? a = 2 : 3; return a; }",
+		"int main() { int a; (a = (1 ? (a = 2) : 3)); return a; }"},
+	{"int main() { int a; return 1 ? 2 : a = 3; }",
+		"int main() { int a; return ((1 ? 2 : a) = 3); }"},
+	{"int main() { return -(1 ? 2 : 3) * 4; }",
+		"int main() { return ((-(1 ? 2 : 3)) * 4); }"},
+	{"int main() { return 1 && -1; }", "int main() { return (1 && (-1)); }"},
+	{"int main() { return 2 == 2 != 0; }", "int main() { return ((2 == 2) != 0); }"},
+	{"int main() { return 1 < 2 == 3 >= 4; }",
+		"int main() { return ((1 < 2) == (3 >= 4)); }"},
+	{"int main() { return 1 + 2 <= 3 > 4 - 5; }",
+		"int main() { return (((1 + 2) <= 3) > (4 - 5)); }"},
+	{"int foo() { return 1; } int main() { return 2; }",
+		"int foo() { return 1; } int main() { return 2; }"},
+	{"", ""},
+	// Local variables.
+	{"int main() { int a; a = 2; return a; }",
+		"int main() { int a; (a = 2); return a; }"},
+	{"int main() { int a; int b = a = 0; return b; }",
+		"int main() { int a; int b = (a = 0); return b; }"},
+	{"int main() { int a; int b; a = b = 4; return a - b; }",
+		"int main() { int a; int b; (a = (b = 4)); return (a - b); }"},
+	{"int main() { int a = 1; int b = 2; return a + b; }",
+		"int main() { int a = 1; int b = 2; return (a + b); }"},
+	{"int main() { 2 + 2; return 0; }", "int main() { (2 + 2); return 0; }"},
+	{"int main() { int a=1; a=a*2+-a; return a; }",
+		"int main() { int a = 1; (a = ((a * 2) + (-a))); return a; }"},
+	{"int main() { { int a = 1; { } } return 0; }",
+		"int main() { { int a = 1; { } } return 0; }"},
+	// Assignment of non-lvalues is checked by semantic analysis.
+	{"int main() { int a = 2; a + 3 = 4; }",
+		"int main() { int a = 2; ((a + 3) = 4); }"},
+	{"int main() { int a = 2; !a = 3; }",
+		"int main() { int a = 2; ((!a) = 3); }"},
+	// Floating-point types.
+	{"double f() { double x = 1.5; float y = .5f; return x * 2e3; }",
+		"double f() { double x = 1.5; float y = 0.5; return (x * 2000); }"},
+	{"float main() { return 2.5e-1F; }", "float main() { return 0.25; }"},
+	// Functions with parameters, prototypes and calls.
+	{"int f(int a, double b) { return a; }",
+		"int f(int a, double b) { return a; }"},
+	{"int putchar(int); int main() { putchar(65); return 0; }",
+		"int putchar(int); int main() { putchar(65); return 0; }"},
+	{"int f(); int main() { return f() + f(); }",
+		"int f(); int main() { return (f() + f()); }"},
+	{"int f(int a,int b); int main() { return -f(1+2, f(3, 4)) * 5; }",
+		"int f(int a, int b); int main() { return ((-f((1 + 2), f(3, 4))) * 5); }"},
+	{"int main() { int a; a = f(a = 1); }",
+		"int main() { int a; (a = f((a = 1))); }"},
+	// If statements.
+	{"int main() { if (1) return 2; return 3; }",
+		"int main() { if (1) return 2; return 3; }"},
+	{"int main() { int a; if (a = 1) { a = 2; } else a = 3; }",
+		"int main() { int a; if ((a = 1)) { (a = 2); } else (a = 3); }"},
+	{"int main() { if (1) if (2) return 3; else return 4; }",
+		"int main() { if (1) if (2) return 3; else return 4; }"},
+	{"int main() { if (1) { if (2) return 3; } else return 4; }",
+		"int main() { if (1) { if (2) return 3; } else return 4; }"},
+	{"int main() { if (1 && !2) return 1; else if (3) return 2; else { } }",
+		"int main() { if ((1 && (!2))) return 1; else if (3) return 2; else { } }"},
+	// Loops.
+	{"int main() { int i = 0; while (i < 3) i = i + 1; return i; }",
+		"int main() { int i = 0; while ((i < 3)) (i = (i + 1)); return i; }"},
+	{"int main() { do { break; } while (1); }",
+		"int main() { do { break; } while (1); }"},
+	{"int main() { for (int i = 0; i < 3; i = i + 1) continue; }",
+		"int main() { for (int i = 0; (i < 3); (i = (i + 1))) continue; }"},
+	{"int main() { int i; for (i = 0;;) { } for (; i;) { } }",
+		"int main() { int i; for ((i = 0);;) { } for (; i;) { } }"},
+	{"int main() { while (1) if (2) break; else continue; }",
+		"int main() { while (1) if (2) break; else continue; }"},
+	{"int main() { do do break; while (1); while (2); }",
+		"int main() { do do break; while (1); while (2); }"},
+	// Switches.
+	{"int main() { switch (1) { case 1: return 2; case 3 + 4: case 5: break; default: { } } }",
+		"int main() { switch (1) { case 1: return 2; case (3 + 4): case 5: break; default: { } } }"},
+	{"int main() { int a; switch (a = 2) case 1: while (a) { case 2: a = 0; } }",
+		"int main() { int a; switch ((a = 2)) case 1: while (a) { case 2: (a = 0); } }"},
+	{"int main() { switch (1) { } }", "int main() { switch (1) { } }"},
+	// Jumps outside of loops are checked by semantic analysis.
+	{"int main() { break; continue; }", "int main() { break; continue; }"},
+	{"int main() { case 1: default: return 0; }",
+		"int main() { case 1: default: return 0; }"},
+	// Pointers. A "*" after a type is part of the declarator, and before an
+	// operand is a dereference.
+	{"int *f(int **p, double *) { int *q = *p; *q = 1; return &*q; }",
+		"int *f(int **p, double *) { int *q = (*p); ((*q) = 1); return (&(*q)); }"},
+	{"int main() { int a; int *p = &a; return a * *p - **&p; }",
+		"int main() { int a; int *p = (&a); return ((a * (*p)) - (*(*(&p)))); }"},
+	{"int main() { int *p; for (int **q = &p; *q; q++) { } }",
+		"int main() { int *p; for (int **q = (&p); (*q); (q++)) { } }"},
+	{"int main() { int *p; *p++ = 1; return &p != 0; }",
+		"int main() { int *p; ((*(p++)) = 1); return ((&p) != 0); }"},
+	// Arrays. Subscripts bind tighter than prefix operators, and lengths
+	// are checked by semantic analysis.
+	{"int f(int a[], int *b[2 * 3]) { int c[2][3]; c[1][a[0]] = *b[1]; return &c[1] - c; }",
+		"int f(int a[], int *b[(2 * 3)]) { int c[2][3]; (c[1][a[0]] = (*b[1])); return ((&c[1]) - c); }"},
+	{"int main() { int *p; return p[1]++ + (p + 1)[-1] + -p[0]; }",
+		"int main() { int *p; return (((p[1]++) + (p + 1)[(-1)]) + (-p[0])); }"},
+	// Structs. Member access binds as tightly as a subscript.
+	{"struct point { int x; struct point *next; int a[2]; }; int f(struct point *p) { struct point q; q.x = p->next->x; return (&q)->a[1] + -p->x; }",
+		"struct point { int x; struct point *next; int a[2]; }; int f(struct point *p) { struct point q; (q.x = p->next->x); return ((&q)->a[1] + (-p->x)); }"},
+	{"struct s *f(struct s *); struct s { double d; };",
+		"struct s { double d; }; struct s *f(struct s *);"},
+	{"int g = 1 + 2; int main() { return g; } double *p; int a[2];",
+		"int g = (1 + 2); double *p; int a[2]; int main() { return g; }"},
+	// Strings and characters. Adjacent string literals are concatenated.
+	{`int printf(char *, ...); int main() { char c = 'a'; printf("%c\n" "!", c); return "hi"[1]; }`,
+		`int printf(char *, ...); int main() { char c = 97; printf("%c\n!", c); return "hi"[1]; }`},
+	// Sizeof. A parenthesized type name is the size of the type, and
+	// otherwise sizeof binds like a prefix operator.
+	{"struct s { int a[2]; }; int f(int *p) { struct s x; return sizeof x.a + sizeof(int *) * 2 - sizeof *p + sizeof(p[0]++) / sizeof(struct s [2][3]); }",
+		"struct s { int a[2]; }; int f(int *p) { struct s x; return ((((sizeof x.a) + (sizeof(int *) * 2)) - (sizeof (*p))) + ((sizeof (p[0]++)) / sizeof(struct s [2][3]))); }"},
+	{"int main() { int a; return sizeof (a) + 1 + sizeof -a + -sizeof(char); }",
+		"int main() { int a; return ((((sizeof a) + 1) + (sizeof (-a))) + (-sizeof(char))); }"},
+	// Enums, which may be unnamed, and whose last enumerator may be followed
+	// by a comma. Enums are declared before structs.
+	{"struct s { int a[N]; }; enum color { RED, GREEN = 2 * N, BLUE, }; enum { N = 3 }; enum color f(enum color c) { enum color d = RED; return c + d; }",
+		"enum color { RED, GREEN = (2 * N), BLUE }; enum { N = 3 }; struct s { int a[N]; }; enum color f(enum color c) { enum color d = RED; return (c + d); }"},
+	// Casts. A parenthesized type name is a cast, which binds like a prefix
+	// operator, and otherwise the parentheses group an expression.
+	{"int f(int x, char *p) { return (char)x + (int)(x + 1) * (x) + *(int *)p; }",
+		"int f(int x, char *p) { return ((((char)x) + (((int)(x + 1)) * x)) + (*((int *)p))); }"},
+	{"struct s { int a; }; int f(int *p) { return ((struct s *)p == 0) + (double)(char)-p[0]++ + sizeof((int)1.5); }",
+		"struct s { int a; }; int f(int *p) { return (((((struct s *)p) == 0) + ((double)((char)(-(p[0]++))))) + (sizeof ((int)1.5))); }"},
+	// Labels and gotos. A label may have the name of a variable or a
+	// typedef, and labels a substatement.
+	{"typedef int T; int main() { int a; goto a; a: T: a = 1; if (a) goto T; { b: return a ? a : 0; } }",
+		"typedef int T; int main() { int a; goto a; a: T: (a = 1); if (a) goto T; { b: return (a ? a : 0); } }"},
+	// Typedefs. A typedef name begins a declaration, so "T * x;" declares x,
+	// unless it is hidden by a variable, when "T * 2;" is an expression.
+	{"typedef int T; typedef struct s *P; int f(T t, P) { T * x; return (T)t + sizeof(T); } int g(int T) { T * 2; }",
+		"typedef int T; typedef struct s *P; int f(T t, P) { T *x; return (((T)t) + sizeof(T)); } int g(int T) { (T * 2); }"},
+	{"typedef int T; int main() { { int T; T * 2; } T * x; for (int T = 0; T * 2;) { } T y; }",
+		"typedef int T; int main() { { int T; (T * 2); } T *x; for (int T = 0; (T * 2);) { } T y; }"},
+	{"typedef int T; struct s { T x; }; typedef T A[3]; T g; enum e { T2 }; typedef enum e E;",
+		"enum e { T2 }; typedef int T; typedef T A[3]; typedef enum e E; struct s { T x; }; T g;"},
+	// Unsigned and signed types, with or without "int".
+	{"unsigned a; signed int b; unsigned int *f(unsigned x, signed) { return (unsigned)x + sizeof(unsigned int) + 1u; }",
+		"unsigned a; signed int b; unsigned int *f(unsigned x, signed) { return ((((unsigned)x) + sizeof(unsigned int)) + 1u); }"},
+	// Storage classes, which begin declarations and functions. Checking that
+	// a local variable has none is left to semantic analysis.
+	{"extern int n; static int f(); static int *p = 0; extern long g(int x) { static int y; return x; }",
+		"extern int n; static int *p = 0; static int f(); extern long g(int x) { static int y; return x; }"},
+}
+
+func TestParseValidPrograms(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range validPrograms {
+		program, err := parse(test.input)
+		if assert.NoError(err, test.input) {
+			assert.Equal(test.ast, program.String(), test.input)
+		}
+	}
+}
+
+// Test inputs from
+// github.com/nlsandler/write_a_c_compiler/stage_{1..4}/invalid, and the error
+// that they are expected to produce.
+var invalidPrograms = []struct {
+	input string
+	err   string
+}{
+	{"int main( {\n    return 0;\n}", "1:11: expected ')', found \"{\""},
+	{"int main() {\n    return;\n}", "2:11: expected expression, found \";\""},
+	{"int main {\n    return 0;\n", "1:10: expected ';', found \"{\""},
+	{"int main() {\n    return 0\n}", "3:1: expected ';', found \"}\""},
+	{"int main() {\n    RETURN 0;\n}", "2:12: expected ';', found \"0\""},
+	{"int main() {\n    return 0;\n", "3:1: expected '}', found EOF"},
+	{"int main() {\n    return !;\n}", "2:13: expected expression, found \";\""},
+	{"int main() {\n    return !5\n}", "3:1: expected ';', found \"}\""},
+	{"int main() {\n    return !~;\n}", "2:14: expected expression, found \";\""},
+	{"int main() {\n    return 4-;\n}", "2:14: expected expression, found \";\""},
+	{"int main() {\n    return 2*2\n}", "3:1: expected ';', found \"}\""},
+	{"int main() {\n    return /3;\n}", "2:12: expected expression, found \"/\""},
+	{"int main() { return <= 2; }", "1:21: expected expression, found \"<=\""},
+	{"int main() { return (1 + 2; }", "1:27: expected ')', found \";\""},
+	{"int main() { return 1 @ 2; }", "1:23: illegal character: `@`"},
+	{"return 0;", "1:1: expected type, found \"return\""},
+	{"int main() { return 1e999; }",
+		"1:21: invalid floating-point literal \"1e999\""},
+	{"int main() { ints a = 1; }", "1:19: expected ';', found \"a\""},
+	{"int main() { int foo bar = 3; }", "1:22: expected ';', found \"bar\""},
+	{"int main() { int a = 2 a = a + 4; }", "1:24: expected ';', found \"a\""},
+	{"int main() { int = 2; }", "1:18: expected variable name, found \"=\""},
+	{"int main() { { return 0; }", "1:27: expected '}', found EOF"},
+	{"int main() { return 0x; }", "1:21: Bad number syntax: \"0x\""},
+	{"int main() { return 0b102; }", "1:21: Bad number syntax: \"0b102\""},
+	{"int main() { return 0789; }", "1:21: Bad number syntax: \"0789\""},
+	{"int f(int a b) { }", "1:13: expected ')', found \"b\""},
+	{"int f(int a,) { }", "1:13: expected type, found \")\""},
+	{"int f(a) { }", "1:7: expected ')', found \"a\""},
+	{"int f() return 1;", "1:9: expected '{', found \"return\""},
+	{"int main() { return f(1; }", "1:24: expected ')', found \";\""},
+	{"int main() { return f(1,); }", "1:25: expected expression, found \")\""},
+	{"int main() { if 1 return 2; }", "1:17: expected '(', found \"1\""},
+	{"int main() { if (1) }", "1:21: expected statement, found \"}\""},
+	{"int main() { if (1) int a; }", "1:21: expected statement, found \"int\""},
+	{"int main() { if (1) ; }", "1:21: expected statement, found \";\""},
+	{"int main() { else return 1; }", "1:14: expected statement, found \"else\""},
+	{"int main() { if () return 1; }", "1:18: expected expression, found \")\""},
+	{"int main() { while 1; }", "1:20: expected '(', found \"1\""},
+	{"int main() { while (1) int a; }", "1:24: expected statement, found \"int\""},
+	{"int main() { do return 1; }", "1:27: expected 'while', found \"}\""},
+	{"int main() { do ; while (1) }", "1:17: expected statement, found \";\""},
+	{"int main() { do { } while (1) }", "1:31: expected ';', found \"}\""},
+	{"int main() { for (int i = 0, i < 3;) { } }", "1:28: expected ';', found \",\""},
+	{"int main() { for (;) { } }", "1:20: expected expression, found \")\""},
+	{"int main() { for (;;;) { } }", "1:21: expected expression, found \";\""},
+	{"int main() { for (;;) int i; }", "1:23: expected statement, found \"int\""},
+	{"int main() { break }", "1:20: expected ';', found \"}\""},
+	{"int main() { switch 1 { } }", "1:21: expected '(', found \"1\""},
+	{"int main() { switch (1) { case 1 return 1; } }", "1:34: expected ':', found \"return\""},
+	{"int main() { switch (1) { case: return 1; } }", "1:31: expected expression, found \":\""},
+	{"int main() { switch (1) { default; } }", "1:34: expected ':', found \";\""},
+	{"int main() { switch (1) { case 1: } }", "1:35: expected statement, found \"}\""},
+	{"int main() { switch (1) { case 1: int a; } }", "1:35: expected statement, found \"int\""},
+	{"int main() { int a; a += ; }", "1:26: expected expression, found \";\""},
+	{"int main() { int * = 0; }", "1:20: expected variable name, found \"=\""},
+	{"int main() { return *; }", "1:22: expected expression, found \";\""},
+	{"int main() { int a; return a &; }", "1:31: expected expression, found \";\""},
+	{"int main() { int a; a++ b; }", "1:25: expected ';', found \"b\""},
+	{"int main() { int a; ++; }", "1:23: expected expression, found \";\""},
+	{"int main() { return 1 ? 2; }", "1:26: expected ':', found \";\""},
+	{"int main() { return 1 ? : 2; }", "1:25: expected expression, found \":\""},
+	{"int main() { return 1 : 2; }", "1:23: expected ';', found \":\""},
+	{"int main() { int a[2; }", "1:21: expected ']', found \";\""},
+	{"int main() { int a; return a[1; }", "1:31: expected ']', found \";\""},
+	{"int main() { int a; return a[]; }", "1:30: expected expression, found \"]\""},
+	{"struct s { };", "1:12: expected type, found \"}\""},
+	{"struct s { int x };", "1:18: expected ';', found \"}\""},
+	{"struct s { int x; }", "1:20: expected ';', found EOF"},
+	{"struct s { int; };", "1:15: expected field name, found \";\""},
+	{"int main() { struct s; }", "1:22: expected variable name, found \";\""},
+	{"int main() { struct { int x; } a; }", "1:21: expected struct name, found \"{\""},
+	{"int main() { int a; return a.; }", "1:30: expected field name, found \";\""},
+	{"int main() { int a; return a->1; }", "1:31: expected field name, found \"1\""},
+	{"int g = 1", "1:10: expected ';', found EOF"},
+	{"int g; return 0;", "1:8: expected type, found \"return\""},
+	{"int f(...);", "1:7: expected ')', found \"...\""},
+	{"int f(int, ..., int);", "1:15: expected ')', found \",\""},
+	{"int main() { return \"a\" 1; }", "1:25: expected ';', found \"1\""},
+	{"int main() { return sizeof(int; }", "1:31: expected ')', found \";\""},
+	{"int main() { return sizeof(int a); }", "1:32: expected ')', found \"a\""},
+	{"int main() { return sizeof; }", "1:27: expected expression, found \";\""},
+	{"int main() { return (int; }", "1:25: expected ')', found \";\""},
+	{"int main() { return (int *)); }", "1:28: expected expression, found \")\""},
+	{"int main() { return (struct)0; }", "1:28: expected struct name, found \")\""},
+	{"enum e { };", "1:10: expected enumerator, found \"}\""},
+	{"enum e { A B };", "1:12: expected '}', found \"B\""},
+	{"enum e { A, , B };", "1:13: expected enumerator, found \",\""},
+	{"enum e { A = };", "1:14: expected expression, found \"}\""},
+	{"enum e { A }", "1:13: expected ';', found EOF"},
+	{"enum { A } x;", "1:12: expected ';', found \"x\""},
+	{"int main() { enum { A } x; }", "1:19: expected enum name, found \"{\""},
+	{"int main() { goto; }", "1:18: expected label, found \";\""},
+	{"int main() { goto a }", "1:21: expected ';', found \"}\""},
+	{"int main() { a: }", "1:17: expected statement, found \"}\""},
+	{"int main() { a: int b; }", "1:17: expected statement, found \"int\""},
+	{"typedef int;", "1:12: expected typedef name, found \";\""},
+	{"typedef int T", "1:14: expected ';', found EOF"},
+	{"typedef T;", "1:9: expected type, found \"T\""},
+	{"int main() { typedef int T; }", "1:14: expected statement, found \"typedef\""},
+	{"typedef int T; int main() { int T; T x; }", "1:38: expected ';', found \"x\""},
+	{"extern static int x;", "1:8: expected type, found \"static\""},
+	{"static f();", "1:8: expected type, found \"f\""},
+	{"int main() { return 99999999999999999999; }",
+		"1:21: invalid integer literal \"9999999999\"..."},
+}
+
+func TestParseInvalidPrograms(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range invalidPrograms {
+		program, err := parse(test.input)
+		assert.Nil(program, test.input)
+		if assert.Error(err, test.input) {
+			assert.Equal(test.err, err.Error(), test.input)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	assert := assert.New(t)
+	_, err := parse("int main() {\n  return 1 +;\n}")
+	if assert.IsType(&Error{}, err) {
+		assert.Equal(token.Position{Offset: 25, Line: 2, Column: 13},
+			err.(*Error).Pos)
+	}
+}
+
+func TestParseErrorIsLexical(t *testing.T) {
+	assert := assert.New(t)
+	_, err := parse("int main() { return 1 @ 2; }")
+	if assert.IsType(&Error{}, err) {
+		assert.True(err.(*Error).IsLexical())
+	}
+	_, err = parse("int main() { return 1 2; }")
+	if assert.IsType(&Error{}, err) {
+		assert.False(err.(*Error).IsLexical())
+		assert.Equal(token.NumberToken, err.(*Error).Token.Type)
+	}
+}
+
+func TestParseErrorDiagnostic(t *testing.T) {
+	assert := assert.New(t)
+	// The diagnostic spans the offending token.
+	_, err := parse("int main() { return 1 abc; }")
+	if assert.IsType(&Error{}, err) {
+		assert.Equal(&diag.Diagnostic{
+			Severity: diag.Error,
+			Pos:      token.Position{Offset: 22, Line: 1, Column: 23},
+			Length:   3,
+			Msg:      `expected ';', found "abc"`,
+			Code:     "syntax",
+		}, err.(*Error).Diagnostic())
+	}
+	// Unless the value of the token is not its source text.
+	_, err = parse("int main() { return 1 @; }")
+	if assert.IsType(&Error{}, err) {
+		assert.Equal(0, err.(*Error).Diagnostic().Length)
+		assert.Equal("lexical", err.(*Error).Diagnostic().Code)
+	}
+	_, err = parse("int main() { return 1")
+	if assert.IsType(&Error{}, err) {
+		assert.Equal(0, err.(*Error).Diagnostic().Length)
+	}
+}
+
+func TestParseErrorIsIncomplete(t *testing.T) {
+	assert := assert.New(t)
+	_, err := parse("int main() { return 1")
+	if assert.IsType(&Error{}, err) {
+		assert.True(err.(*Error).IsIncomplete())
+	}
+	_, err = parse("int main() { return 1 2; }")
+	if assert.IsType(&Error{}, err) {
+		assert.False(err.(*Error).IsIncomplete())
+	}
+}
+
+// parseRecovering parses a program, recovering from syntax errors, and
+// returns its string and the message of each error.
+func parseRecovering(input string) (string, []string) {
+	program, err := Parse(lexer.NewLexerTokenStream(lexer.Lex(input)), RecoverFromErrors)
+	var messages []string
+	if err != nil {
+		for _, e := range err.(ErrorList) {
+			messages = append(messages, e.Error())
+		}
+	}
+	return program.String(), messages
+}
+
+func TestParseRecoverFromErrors(t *testing.T) {
+	assert := assert.New(t)
+	// Each statement with an error is skipped, up to its semicolon or the end
+	// of the block which it opens.
+	program, errors := parseRecovering(`int f() {
+  int x = ;
+  return 1
+}
+int g(int a) {
+  if (a { return 1; }
+  return 2 +;
+  return 3;
+}
+int main() { return 0; }`)
+	assert.Equal("int f() {  } int g(int a) { return 3; } int main() { return 0; }", program)
+	assert.Equal([]string{
+		`2:11: expected expression, found ";"`,
+		`4:1: expected ';', found "}"`,
+		`6:9: expected ')', found "{"`,
+		`7:13: expected expression, found ";"`,
+	}, errors)
+
+	// A declaration at file scope with an error is skipped, up to its
+	// semicolon or the end of its braces.
+	program, errors = parseRecovering(`struct s { int a; int; };
+int x = 1 int y;
+int h( { return 1; }
+enum e { A = , B };
+int z;`)
+	assert.Equal("int z;", program)
+	assert.Equal([]string{
+		`1:22: expected field name, found ";"`,
+		`2:11: expected ';', found "int"`,
+		`3:8: expected ')', found "{"`,
+		`4:14: expected expression, found ","`,
+	}, errors)
+
+	// The lexer stops at its first error, as does the parser.
+	program, errors = parseRecovering("int f() { return 1 +; } int g() { return @; } int h() { return; }")
+	assert.Equal("int f() {  }", program)
+	assert.Equal([]string{
+		`1:21: expected expression, found ";"`,
+		"1:42: illegal character: `@`",
+	}, errors)
+
+	// A valid program has no errors.
+	program, errors = parseRecovering("int main() { return 0; }")
+	assert.Equal("int main() { return 0; }", program)
+	assert.Empty(errors)
+}
+
+func TestErrorListIsLexical(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Parse(lexer.NewLexerTokenStream(lexer.Lex("int f() { return 1 +; } int @")), RecoverFromErrors)
+	assert.True(err.(ErrorList).IsLexical())
+	_, err = Parse(lexer.NewLexerTokenStream(lexer.Lex("int f() { return 1 +; }")), RecoverFromErrors)
+	assert.False(err.(ErrorList).IsLexical())
+}
+
+// parseInput parses a line of interactive input and returns the string of
+// each node.
+func parseInput(input string) ([]string, error) {
+	nodes, err := ParseInput(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	var strings []string
+	for _, n := range nodes {
+		strings = append(strings, n.String())
+	}
+	return strings, err
+}
+
+func TestParseInput(t *testing.T) {
+	assert := assert.New(t)
+	nodes, err := parseInput("int a = 1; int f(int x) { return x; } f(a);")
+	assert.NoError(err)
+	assert.Equal([]string{"int a = 1;", "int f(int x) { return x; }", "f(a);"}, nodes)
+	// The input may end with an expression.
+	nodes, err = parseInput("a = 2; a + 1")
+	assert.NoError(err)
+	assert.Equal([]string{"(a = 2);", "(a + 1)"}, nodes)
+	nodes, err = parseInput("if (a) a = 1;")
+	assert.NoError(err)
+	assert.Equal([]string{"if (a) (a = 1);"}, nodes)
+	nodes, err = parseInput("int *g(); int *p = g(); *p")
+	assert.NoError(err)
+	assert.Equal([]string{"int *g();", "int *p = g();", "(*p)"}, nodes)
+	nodes, err = parseInput("struct s { int x; }; struct s v; struct s *h(); v.x")
+	assert.NoError(err)
+	assert.Equal([]string{"struct s { int x; };", "struct s v;", "struct s *h();", "v.x"},
+		nodes)
+	nodes, err = parseInput("enum e { A }; enum e f(); A")
+	assert.NoError(err)
+	assert.Equal([]string{"enum e { A };", "enum e f();", "A"}, nodes)
+	nodes, err = parseInput("")
+	assert.NoError(err)
+	assert.Empty(nodes)
+	_, err = parseInput("a + 1 b")
+	assert.EqualError(err, `1:7: expected ';', found "b"`)
+	_, err = parseInput("int f() {")
+	if assert.IsType(&Error{}, err) {
+		assert.True(err.(*Error).IsIncomplete())
+	}
+}
+
+func TestParseInputTypedefs(t *testing.T) {
+	assert := assert.New(t)
+	// A typedef name may be declared by earlier input, unless the input
+	// hides it.
+	isTypedef := func(name string) bool { return name == "T" }
+	nodes, err := ParseInput(lexer.NewLexerTokenStream(lexer.Lex("T * x; (T)1; int T; T * 2")),
+		Typedefs(isTypedef))
+	var strings []string
+	for _, n := range nodes {
+		strings = append(strings, n.String())
+	}
+	assert.NoError(err)
+	assert.Equal([]string{"T *x;", "((T)1);", "int T;", "(T * 2)"}, strings)
+	// Or by the input itself.
+	strings, err = parseInput("typedef int U; U * y; sizeof(U)")
+	assert.NoError(err)
+	assert.Equal([]string{"typedef int U;", "U *y;", "sizeof(U)"}, strings)
+}
+
+func TestParseSliceTokenStream(t *testing.T) {
+	assert := assert.New(t)
+	ts := token.NewSliceTokenStream([]token.Token{
+		{Type: token.IntKeywordToken, Value: "int"},
+		{Type: token.IdentifierToken, Value: "main"},
+		{Type: token.OpenParenthesisToken, Value: "("},
+		{Type: token.CloseParenthesisToken, Value: ")"},
+		{Type: token.OpenBraceToken, Value: "{"},
+		{Type: token.ReturnKeywordToken, Value: "return"},
+		{Type: token.NumberToken, Value: "2"},
+		{Type: token.SemicolonToken, Value: ";"},
+		{Type: token.CloseBraceToken, Value: "}"},
+	})
+	program, err := Parse(ts)
+	if assert.NoError(err) {
+		assert.Equal("int main() { return 2; }", program.String())
+	}
+}
+
+func TestParseIntegerLiterals(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]int64{
+		"0":          0,
+		"42":         42,
+		"0x1F":       31,
+		"0XfF":       255,
+		"0755":       493,
+		"00":         0,
+		"0b1010":     10,
+		"0B1":        1,
+		"0x7fffffff": 2147483647,
+		"0xffffffff": 4294967295,
+		"10u":        10,
+		"0b11U":      3,
+		// Character constants are signed chars.
+		"'a'":    97,
+		`'\n'`:   10,
+		`'\377'`: -1,
+	}
+	for input, want := range tests {
+		program, err := parse("int main() { return " + input + "; }")
+		if !assert.NoError(err, input) {
+			continue
+		}
+		literal := program.Functions[0].Body[0].(*ast.ReturnStatement).Value
+		if assert.IsType(&ast.IntLiteral{}, literal, input) {
+			assert.Equal(want, literal.(*ast.IntLiteral).Value, input)
+		}
+	}
+}
+
+func TestParseFloatLiterals(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]float64{
+		"1.5":    1.5,
+		".5":     0.5,
+		"1.":     1,
+		"1e10":   1e10,
+		"2.5E-1": 0.25,
+		"1.5f":   1.5,
+		"0.1f":   float64(float32(0.1)),
+		"00.5":   0.5,
+		"1e+2F":  100,
+	}
+	for input, want := range tests {
+		program, err := parse("double main() { return " + input + "; }")
+		if !assert.NoError(err, input) {
+			continue
+		}
+		literal := program.Functions[0].Body[0].(*ast.ReturnStatement).Value
+		if assert.IsType(&ast.FloatLiteral{}, literal, input) {
+			assert.Equal(want, literal.(*ast.FloatLiteral).Value, input)
+		}
+	}
+}
+
+func TestParseDanglingElse(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parse("int main() { if (1) if (2) return 3; else return 4; }")
+	if !assert.NoError(err) {
+		return
+	}
+	// The else belongs to the innermost if.
+	outer := program.Functions[0].Body[0].(*ast.IfStatement)
+	assert.Nil(outer.Else)
+	inner := outer.Then.(*ast.IfStatement)
+	assert.Equal("return 4;", inner.Else.String())
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range validPrograms {
+		program, err := parse(test.input)
+		if !assert.NoError(err, test.input) {
+			continue
+		}
+		formatted := ast.Format(program)
+		reparsed, err := parse(formatted)
+		if assert.NoError(err, formatted) {
+			assert.Equal(program.String(), reparsed.String(), formatted)
+			// Formatting is idempotent.
+			assert.Equal(formatted, ast.Format(reparsed))
+		}
+	}
+}
+
+// TestFormatRoundTripGenerated checks that random programs, which use most
+// kinds of statement and expression, parse, and that formatting them is
+// idempotent.
+func TestFormatRoundTripGenerated(t *testing.T) {
+	assert := assert.New(t)
+	for seed := int64(1); seed <= 50; seed++ {
+		input := gen.Generate(rand.New(rand.NewSource(seed)), gen.Depth(4))
+		program, err := parse(input)
+		if !assert.NoError(err, input) {
+			continue
+		}
+		formatted := ast.Format(program)
+		reparsed, err := parse(formatted)
+		if assert.NoError(err, formatted) {
+			assert.Equal(program.String(), reparsed.String(), formatted)
+			assert.Equal(formatted, ast.Format(reparsed))
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parse("int main(){return -(1+2)*3-(4-5);}")
+	if assert.NoError(err) {
+		assert.Equal(`int main() {
+    return -(1 + 2) * 3 - (4 - 5);
+}
+`, ast.Format(program))
+	}
+}
+
+func TestParseNumbersNodes(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parse("int f(int a) { return a + 1; } int main() { return f(2); }")
+	assert.NoError(err)
+	seen := make(map[ast.NodeID]bool)
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			assert.NotEqual(ast.NodeID(0), n.ID(), "%v", n)
+			assert.False(seen[n.ID()], "%v", n)
+			seen[n.ID()] = true
+		}
+		return n != nil
+	})
+	assert.Equal(12, len(seen))
+}
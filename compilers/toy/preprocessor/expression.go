@@ -0,0 +1,221 @@
+package preprocessor
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/consteval"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strconv"
+	"strings"
+)
+
+// condition returns whether the group of an #if, #elif, #ifdef or #ifndef
+// directive is kept.
+func (p *preprocessor) condition(directive *ppToken, args []*ppToken) bool {
+	if directive.text == "ifdef" || directive.text == "ifndef" {
+		name := p.macroName(directive, args)
+		p.noArgs(directive, args[1:])
+		return (p.macros[name.text] != nil) == (directive.text == "ifdef")
+	}
+	if len(args) == 0 {
+		p.errorf(directive, "#%s with no expression", directive.text)
+	}
+	e := &expression{p: p, directive: directive, tokens: p.expandAll(p.replaceDefined(args), args[len(args)-1])}
+	value := e.conditional(true)
+	if t := e.peek(); t != nil {
+		e.errorf(t, "token is not a valid binary operator in a preprocessor subexpression")
+	}
+	return value != 0
+}
+
+// replaceDefined replaces each "defined X" or "defined(X)" in the
+// expression of a directive with 1 if X is a macro, and otherwise 0. This is
+// done before the macros of the expression are expanded.
+func (p *preprocessor) replaceDefined(args []*ppToken) []*ppToken {
+	var tokens []*ppToken
+	for i := 0; i < len(args); i++ {
+		t := args[i]
+		if t.kind != identifier || t.text != "defined" {
+			tokens = append(tokens, t)
+			continue
+		}
+		parenthesized := i+1 < len(args) && args[i+1].is("(")
+		if parenthesized {
+			i++
+		}
+		if i+1 == len(args) || args[i+1].kind != identifier {
+			p.errorf(t, "macro name missing")
+		}
+		i++
+		defined := p.macros[args[i].text] != nil
+		if parenthesized {
+			if i+1 == len(args) || !args[i+1].is(")") {
+				p.errorf(t, "missing ')' after 'defined'")
+			}
+			i++
+		}
+		value := &ppToken{kind: number, text: "0", file: t.file, pos: t.pos, space: t.space}
+		if defined {
+			value.text = "1"
+		}
+		tokens = append(tokens, value)
+	}
+	return tokens
+}
+
+// The binary operators of the expressions of directives, and their binding
+// power. Higher binds tighter.
+var binaryOperators = map[string]struct {
+	op         token.TokenType
+	precedence int
+}{
+	"||": {token.OrToken, 1},
+	"&&": {token.AndToken, 2},
+	"|":  {token.BitwiseOrToken, 3},
+	"^":  {token.BitwiseXorToken, 4},
+	"&":  {token.BitwiseAndToken, 5},
+	"==": {token.EqualToken, 6},
+	"!=": {token.NotEqualToken, 6},
+	"<":  {token.LessThanToken, 7},
+	"<=": {token.LessThanOrEqualToken, 7},
+	">":  {token.GreaterThanToken, 7},
+	">=": {token.GreaterThanOrEqualToken, 7},
+	"<<": {token.ShiftLeftToken, 8},
+	">>": {token.ShiftRightToken, 8},
+	"+":  {token.AdditionToken, 9},
+	"-":  {token.NegationToken, 9},
+	"*":  {token.MultiplicationToken, 10},
+	"/":  {token.DivisionToken, 10},
+	"%":  {token.ModuloToken, 10},
+}
+
+// The unary operators of the expressions of directives, besides "+".
+var unaryOperators = map[string]token.TokenType{
+	"-": token.NegationToken,
+	"~": token.BitwiseComplementToken,
+	"!": token.LogicalNegationToken,
+}
+
+// An expression of an #if or #elif directive, after macro expansion. Its
+// value is computed as it is parsed, in 64-bit integers which wrap around, by
+// package consteval. An identifier which is not a macro has the value 0.
+type expression struct {
+	p         *preprocessor
+	directive *ppToken
+	tokens    []*ppToken
+}
+
+// peek returns the next token, or nil at the end of the expression.
+func (e *expression) peek() *ppToken {
+	if len(e.tokens) == 0 {
+		return nil
+	}
+	return e.tokens[0]
+}
+
+// next returns the next token, which must exist.
+func (e *expression) next() *ppToken {
+	t := e.peek()
+	if t == nil {
+		e.errorf(nil, "expected value in expression")
+	}
+	e.tokens = e.tokens[1:]
+	return t
+}
+
+// conditional parses a conditional expression. Its operands which are not
+// evaluated, such as the right of "0 && x", may not divide by zero.
+func (e *expression) conditional(evaluate bool) int64 {
+	condition := e.binary(1, evaluate)
+	t := e.peek()
+	if t == nil || !t.is("?") {
+		return condition
+	}
+	e.next()
+	then := e.conditional(evaluate && condition != 0)
+	if t := e.next(); !t.is(":") {
+		e.errorf(t, "expected ':' in conditional expression")
+	}
+	otherwise := e.conditional(evaluate && condition == 0)
+	if condition != 0 {
+		return then
+	}
+	return otherwise
+}
+
+// binary parses and evaluates binary operators of at least a precedence.
+func (e *expression) binary(precedence int, evaluate bool) int64 {
+	lhs := e.unary(evaluate)
+	for {
+		t := e.peek()
+		if t == nil || t.kind != punctuator || binaryOperators[t.text].precedence < precedence {
+			return lhs
+		}
+		e.next()
+		op := binaryOperators[t.text]
+		rhsEvaluate := evaluate
+		if op.op == token.AndToken {
+			rhsEvaluate = evaluate && lhs != 0
+		} else if op.op == token.OrToken {
+			rhsEvaluate = evaluate && lhs == 0
+		}
+		rhs := e.binary(op.precedence+1, rhsEvaluate)
+		value, err := consteval.Binary(op.op, lhs, rhs, consteval.PreprocessorBits)
+		if err != nil && rhsEvaluate {
+			e.errorf(t, "%v in preprocessor expression", err)
+		}
+		lhs = value
+	}
+}
+
+// unary parses and evaluates a unary operator or a primary expression.
+func (e *expression) unary(evaluate bool) int64 {
+	t := e.next()
+	switch {
+	case t.is("+"):
+		return e.unary(evaluate)
+	case t.kind == punctuator && unaryOperators[t.text] != 0:
+		value, _ := consteval.Unary(unaryOperators[t.text], e.unary(evaluate),
+			consteval.PreprocessorBits)
+		return value
+	case t.is("("):
+		value := e.conditional(evaluate)
+		if t := e.peek(); t == nil || !t.is(")") {
+			e.errorf(t, "missing ')' in expression")
+		}
+		e.next()
+		return value
+	case t.kind == identifier:
+		return 0
+	case t.kind == number:
+		return e.number(t)
+	case t.kind == literal && t.text[0] == '\'':
+		c := lexer.Lex(t.text).NextToken()
+		if c.Type != token.CharLiteralToken {
+			e.errorf(t, "%s", c.Value)
+		}
+		return int64([]rune(c.Value)[0])
+	}
+	e.errorf(t, "invalid token at start of a preprocessor expression")
+	return 0
+}
+
+// number returns the value of an integer constant, in decimal, octal or
+// hexadecimal, which may have a suffix of u or l.
+func (e *expression) number(t *ppToken) int64 {
+	text := strings.TrimRight(t.text, "uUlL")
+	value, err := strconv.ParseUint(text, 0, 64)
+	// Go, but not C, allows underscores and the prefixes 0b and 0o.
+	if err != nil || strings.Contains(text, "_") || len(text) > 1 && strings.ContainsAny(text[1:2], "bBoO") {
+		e.errorf(t, "invalid integer constant '%s' in preprocessor expression", t.text)
+	}
+	return int64(value)
+}
+
+// errorf stops preprocessing with an error at a token of the expression, or
+// at its directive if the token is nil, at the end of the expression.
+func (e *expression) errorf(t *ppToken, format string, args ...interface{}) {
+	if t == nil {
+		t = e.directive
+	}
+	e.p.errorf(t, format, args...)
+}
@@ -0,0 +1,78 @@
+package preprocessor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// evaluate returns whether the group of an #if directive with an expression
+// is kept.
+func evaluate(defines, expression string) (bool, error) {
+	text, err := preprocess(defines + "\n#if " + expression + "\nyes\n#endif")
+	return text != "" && text[len(text)-5:] == "\nyes\n", err
+}
+
+func TestCondition(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		expression string
+		want       bool
+	}{
+		{"1", true},
+		{"0", false},
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"10 - 2 - 3 == 5", true},
+		{"-1 < 0 && ~0 == -1 && !0", true},
+		{"7 / 2 == 3 && 7 % 2 == 1", true},
+		{"1 << 4 == 16 && 256 >> 4 == 16", true},
+		{"(6 & 3) == 2 && (6 | 3) == 7 && (6 ^ 3) == 5", true},
+		{"1 ? 0 : 1", false},
+		{"0 ? 0 : 2 > 1", true},
+		{"0x10 == 16 && 010 == 8 && 10u == 10L", true},
+		{"'a' == 97 && '\\n' == 10", true},
+		// Arithmetic is in 64 bits, which wrap around.
+		{"9223372036854775807 + 1 < 0 && 1 << 64 == 1", true},
+		// Division by zero is allowed where it is not evaluated.
+		{"0 && 1 / 0", false},
+		{"1 || 1 % 0", true},
+		{"1 ? 1 : 1 / 0", true},
+		{"A == 2 && B == 2", true},
+		{"F(3) == 4", true},
+		{"defined A && defined(F) && !defined C", true},
+		// Identifiers which are not macros are 0.
+		{"C == 0 && (D + 1)", true},
+	} {
+		kept, err := evaluate("#define A 2\n#define B A\n#define F(x) x + 1\n", test.expression)
+		if assert.NoError(err, test.expression) {
+			assert.Equal(test.want, kept, test.expression)
+		}
+	}
+}
+
+func TestConditionError(t *testing.T) {
+	assert := assert.New(t)
+	for expression, want := range map[string]string{
+		"":          "2:2: #if with no expression",
+		"1 +":       "2:2: expected value in expression",
+		"(1":        "2:2: missing ')' in expression",
+		"1 2":       "2:7: token is not a valid binary operator in a preprocessor subexpression",
+		")":         "2:5: invalid token at start of a preprocessor expression",
+		"1 ? 2":     "2:2: expected value in expression",
+		"1 ? 2 3":   "2:11: expected ':' in conditional expression",
+		"1 / 0":     "2:7: division by zero in preprocessor expression",
+		"1.5":       "2:5: invalid integer constant '1.5' in preprocessor expression",
+		"0b1":       "2:5: invalid integer constant '0b1' in preprocessor expression",
+		"1_0":       "2:5: invalid integer constant '1_0' in preprocessor expression",
+		"''":        "2:5: empty character constant",
+		"defined":   "2:5: macro name missing",
+		"defined(A": "2:5: missing ')' after 'defined'",
+		"\"s\"":     "2:5: invalid token at start of a preprocessor expression",
+	} {
+		_, err := evaluate("", expression)
+		assert.EqualError(err, "a.c:"+want, expression)
+	}
+	// A division which overflows is an error too, as it would trap at run time.
+	_, err := evaluate("#define MIN (-9223372036854775807 - 1)", "MIN / -1")
+	assert.EqualError(err, "a.c:2:9: integer overflow in preprocessor expression")
+}
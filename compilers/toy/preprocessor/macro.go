@@ -0,0 +1,328 @@
+package preprocessor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A set of macro names. A token may not invoke a macro in its hide set, so
+// that a macro which names itself, directly or through others, is expanded
+// only once.
+type hideSet map[string]bool
+
+// with returns the set with a name added.
+func (h hideSet) with(name string) hideSet {
+	s := hideSet{name: true}
+	for n := range h {
+		s[n] = true
+	}
+	return s
+}
+
+// union returns the names which are in either set.
+func (h hideSet) union(other hideSet) hideSet {
+	s := hideSet{}
+	for n := range h {
+		s[n] = true
+	}
+	for n := range other {
+		s[n] = true
+	}
+	return s
+}
+
+// intersect returns the names which are in both sets.
+func (h hideSet) intersect(other hideSet) hideSet {
+	s := hideSet{}
+	for n := range h {
+		if other[n] {
+			s[n] = true
+		}
+	}
+	return s
+}
+
+// A macro, defined by a #define directive.
+type macro struct {
+	name     string
+	function bool     // Whether the macro takes arguments.
+	params   []string // The names of the parameters of a function-like macro.
+	variadic bool     // Whether the last parameter is "...", named __VA_ARGS__.
+	body     []*ppToken
+	// A macro which is defined by the preprocessor, such as __LINE__, whose
+	// expansion depends on where it is invoked.
+	builtin func(p *preprocessor, invocation *ppToken) *ppToken
+}
+
+// param returns the index of the parameter named by a token of the body of a
+// function-like macro, or -1 if it is not a parameter.
+func (m *macro) param(t *ppToken) int {
+	if !m.function || t.kind != identifier {
+		return -1
+	}
+	for i, p := range m.params {
+		if p == t.text {
+			return i
+		}
+	}
+	return -1
+}
+
+// The macros which the preprocessor defines.
+var builtins = map[string]func(p *preprocessor, invocation *ppToken) *ppToken{
+	"__FILE__": func(p *preprocessor, t *ppToken) *ppToken {
+		return &ppToken{kind: literal, text: strconv.Quote(t.file.presume(t.pos).Filename)}
+	},
+	"__LINE__": func(p *preprocessor, t *ppToken) *ppToken {
+		return &ppToken{kind: number, text: strconv.Itoa(t.file.presume(t.pos).Line)}
+	},
+}
+
+// A reader is a stream of tokens to be macro expanded. Tokens which are
+// unread, such as the expansion of a macro, are read again before the rest.
+type reader struct {
+	pending []*ppToken // Unread tokens, in reverse order.
+	tokens  []*ppToken // The tokens which follow, ending with an eof token.
+	// Whether the arguments of a macro invocation may continue on the
+	// following lines.
+	multiline bool
+}
+
+// newReader returns a reader of a list of tokens on a single line.
+func newReader(tokens []*ppToken, end *ppToken) *reader {
+	eofToken := &ppToken{kind: eof, file: end.file, pos: end.pos}
+	return &reader{tokens: append(append([]*ppToken{}, tokens...), eofToken)}
+}
+
+// next returns the next token, without moving past an eof token.
+func (r *reader) next() *ppToken {
+	if n := len(r.pending); n > 0 {
+		t := r.pending[n-1]
+		r.pending = r.pending[:n-1]
+		return t
+	}
+	t := r.tokens[0]
+	if t.kind != eof {
+		r.tokens = r.tokens[1:]
+	}
+	return t
+}
+
+// unread pushes tokens to be read next.
+func (r *reader) unread(tokens []*ppToken) {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		r.pending = append(r.pending, tokens[i])
+	}
+}
+
+// peekOpenParenthesis returns whether the next token is "(", which makes the
+// name of a function-like macro before it an invocation. Reading ahead stops
+// at a directive.
+func (r *reader) peekOpenParenthesis() bool {
+	if n := len(r.pending); n > 0 {
+		return r.pending[n-1].is("(")
+	}
+	for _, t := range r.tokens {
+		if t.kind != newline || !r.multiline {
+			return t.is("(")
+		}
+	}
+	return false
+}
+
+// expand returns the next token of a reader which is not the name of a macro,
+// expanding the macros which come before it.
+func (p *preprocessor) expand(r *reader) *ppToken {
+	for {
+		t := r.next()
+		if t.kind != identifier || t.hide[t.text] {
+			return t
+		}
+		m := p.macros[t.text]
+		switch {
+		case m == nil:
+			return t
+		case m.builtin != nil:
+			result := m.builtin(p, t)
+			result.file, result.pos, result.space = t.file, t.pos, t.space
+			result.expanded = true
+			return result
+		case !m.function:
+			r.unread(p.substitute(m, nil, t, t.hide.with(m.name)))
+		case r.peekOpenParenthesis():
+			args, closing := p.readArgs(r, m, t)
+			r.unread(p.substitute(m, args, t, t.hide.intersect(closing.hide).with(m.name)))
+		default:
+			return t
+		}
+	}
+}
+
+// expandAll returns a list of tokens with their macros expanded.
+func (p *preprocessor) expandAll(tokens []*ppToken, end *ppToken) []*ppToken {
+	r := newReader(tokens, end)
+	var expanded []*ppToken
+	for t := p.expand(r); t.kind != eof; t = p.expand(r) {
+		expanded = append(expanded, t)
+	}
+	return expanded
+}
+
+// readArgs reads the arguments of an invocation of a function-like macro,
+// from its "(" to its ")", which it returns. Arguments are separated by
+// commas which are not within parentheses. On the lines of a file, the
+// arguments may span lines, but not a directive.
+func (p *preprocessor) readArgs(r *reader, m *macro, invocation *ppToken) ([][]*ppToken, *ppToken) {
+	for t := r.next(); !t.is("("); t = r.next() {
+	}
+	var args [][]*ppToken
+	var arg []*ppToken
+	depth, space := 0, false
+	for {
+		t := r.next()
+		switch {
+		case t.kind == eof || t.bol && t.is("#"):
+			p.errorf(invocation, "unterminated function-like macro invocation")
+		case t.kind == newline:
+			space = true
+			continue
+		case t.is("(") || t.is("["):
+			depth++
+		case (t.is(")") || t.is("]")) && depth > 0:
+			depth--
+		case t.is(")"):
+			args = append(args, arg)
+			return p.checkArgs(m, args, invocation), t
+		case t.is(",") && depth == 0 && !(m.variadic && len(args) == len(m.params)-1):
+			args = append(args, arg)
+			arg, space = nil, false
+			continue
+		}
+		if space {
+			t = t.copy()
+			t.space, space = true, false
+		}
+		arg = append(arg, t)
+	}
+}
+
+// checkArgs checks the number of arguments of an invocation of a macro,
+// returning them. A macro without parameters is invoked with one empty
+// argument, and the variable arguments may be omitted.
+func (p *preprocessor) checkArgs(m *macro, args [][]*ppToken, invocation *ppToken) [][]*ppToken {
+	if len(m.params) == 0 && len(args) == 1 && len(args[0]) == 0 {
+		return nil
+	}
+	if m.variadic && len(args) == len(m.params)-1 {
+		args = append(args, nil)
+	}
+	if len(args) < len(m.params) {
+		p.errorf(invocation, "too few arguments provided to function-like macro invocation")
+	}
+	if len(args) > len(m.params) {
+		p.errorf(invocation, "too many arguments provided to function-like macro invocation")
+	}
+	return args
+}
+
+// substitute returns the replacement list of a macro at an invocation, with
+// its parameters replaced by its arguments. An argument is macro expanded,
+// unless it is an operand of "#", which makes it a string literal, or of
+// "##", which pastes the tokens on either side together. Each token is
+// hidden from the given macros.
+func (p *preprocessor) substitute(m *macro, args [][]*ppToken, invocation *ppToken, hide hideSet) []*ppToken {
+	var result []*ppToken
+	// add appends tokens to the result, from the replacement list if they are
+	// not arguments.
+	add := func(expanded bool, tokens ...*ppToken) {
+		for _, t := range tokens {
+			t = t.copy()
+			t.hide = t.hide.union(hide)
+			if expanded {
+				t.file, t.pos, t.expanded = invocation.file, invocation.pos, true
+			}
+			result = append(result, t)
+		}
+	}
+	// Whether the last token added was an empty argument, before "##".
+	placemarker := false
+	for i := 0; i < len(m.body); i++ {
+		t := m.body[i]
+		pasted := i+1 < len(m.body) && m.body[i+1].is("##")
+		empty := placemarker
+		placemarker = false
+		switch {
+		case t.is("#") && m.function:
+			// The body was checked to have a parameter after each "#".
+			i++
+			add(true, p.stringize(args[m.param(m.body[i])], m.body[i]))
+		case t.is("##"):
+			i++
+			rhs, fromArg := []*ppToken{m.body[i]}, false
+			if j := m.param(m.body[i]); j >= 0 {
+				rhs, fromArg = args[j], true
+			}
+			if len(rhs) == 0 {
+				continue
+			}
+			if empty || len(result) == 0 {
+				add(!fromArg, rhs...)
+				continue
+			}
+			lhs := result[len(result)-1]
+			result = result[:len(result)-1]
+			add(true, p.paste(lhs, rhs[0], invocation))
+			add(false, rhs[1:]...)
+		case m.param(t) >= 0:
+			arg := args[m.param(t)]
+			if pasted {
+				placemarker = len(arg) == 0
+			} else {
+				arg = p.expandAll(arg, invocation)
+			}
+			if len(arg) > 0 && t.space != arg[0].space {
+				arg = append([]*ppToken{arg[0].copy()}, arg[1:]...)
+				arg[0].space = t.space
+			}
+			add(false, arg...)
+		default:
+			add(true, t)
+		}
+	}
+	if len(result) > 0 {
+		result[0].space = invocation.space
+	}
+	return result
+}
+
+// stringize returns a string literal of the source text of an argument. The
+// quotes and backslashes of its literals are escaped.
+func (p *preprocessor) stringize(arg []*ppToken, at *ppToken) *ppToken {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, t := range arg {
+		if i > 0 && t.space {
+			b.WriteByte(' ')
+		}
+		if t.kind == literal {
+			b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(t.text))
+		} else {
+			b.WriteString(t.text)
+		}
+	}
+	b.WriteByte('"')
+	return &ppToken{kind: literal, text: b.String(), file: at.file, pos: at.pos, space: at.space}
+}
+
+// paste returns the token whose text is that of two tokens together, which
+// must be a single preprocessing token.
+func (p *preprocessor) paste(lhs, rhs, invocation *ppToken) *ppToken {
+	text := lhs.text + rhs.text
+	tokens := scanText(text)
+	if len(tokens) != 1 || tokens[0].kind == other {
+		p.errorf(invocation, "pasting formed '%s', an invalid preprocessing token", text)
+	}
+	t := tokens[0]
+	t.space, t.hide = lhs.space, lhs.hide
+	return t
+}
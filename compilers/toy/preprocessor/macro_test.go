@@ -0,0 +1,67 @@
+package preprocessor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExpandMacros(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		source, want string
+	}{
+		{"#define N 42\nN", "\n42"},
+		{"#define A B\n#define B 1\nA + B", "\n\n1 + 1"},
+		{"#define A\n[A]", "\n[ ]"},
+		// A function-like macro has no space before its parameter list.
+		{"#define F (x) x\nF(1)", "\n(x) x(1)"},
+		{"#define MAX(a, b) ((a) > (b) ? (a) : (b))\nMAX(x, y + 1)",
+			"\n((x) > (y + 1) ? (x) : (y + 1))"},
+		{"#define F() 1\nF() F", "\n1   F"},
+		{"#define F(x) [x]\nF() F(())", "\n[]  [()]"},
+		{"#define F(x, y) x y\nF((a, b), [c, d])", "\n(a, b) [c, d]"},
+		// Invocations may span lines, and their arguments are expanded.
+		{"#define F(x, y) x + y\nF(1,\n  F(2, 3))\n4", "\n1 +\n2 + 3\n4"},
+		{"#define F(x) x\nF\n(1)", "\n\n1"},
+		// Stringizing and pasting.
+		{"#define S(x) #x\nS(a  +\n\"\\n\")", "\n\"a + \\\"\\\\n\\\"\"\n"},
+		{"#define CAT(a, b) a ## b\nCAT(x, 1) CAT(, y) CAT(z,) CAT(+, =)", "\nx1 y z                     +="},
+		{"#define CAT(a, b) a ## b ## c\nCAT(,)", "\nc"},
+		{"#define CAT(a, b) a ## b\n#define x1 2\nCAT(x, 1)", "\n\n2"},
+		{"#define F(x, ...) x(__VA_ARGS__)\nF(f) F(g, 1, 2)", "\nf() g(1, 2)"},
+		// A macro which names itself is only expanded once.
+		{"#define f f + 1\nf", "\nf + 1"},
+		{"#define x x[y]\n#define y x\nx y", "\n\nx[x] x[y]"},
+		{"#define f(x) f(x + 1)\nf(f(0))", "\nf(f(0 + 1) + 1)"},
+		{"#define a a b\n#define b a\n#define f(x) x\nf(a)", "\n\n\n  a a"},
+		// Defining a macro again replaces it, and it can be undefined.
+		{"#define A 1\n#define A 2\nA\n#undef A\nA", "\n\n2\n\nA"},
+		// Macros are not expanded in literals.
+		{"#define A 1\n\"A\" 'A' A1 1A", "\n\"A\" 'A' A1 1A"},
+		{"__LINE__ __FILE__\n#define L __LINE__\n\nF(L)", "1        \"a.c\"\n\n\nF(4)"},
+		// Tokens of an expansion are separated so that they are lexed apart.
+		{"#define M -\n-M M-1 M=", "\n- - - -1 - ="},
+		{"#define F(x) x/x\nF(/)", "\n/ / /"},
+	} {
+		text, err := preprocess(test.source)
+		if assert.NoError(err, test.source) {
+			assert.Equal(test.want, text, test.source)
+		}
+	}
+}
+
+func TestExpandMacrosError(t *testing.T) {
+	assert := assert.New(t)
+	for source, want := range map[string]string{
+		"#define F(x) x\nF(1":                 "2:1: unterminated function-like macro invocation",
+		"#define F(x) x\nF(1\n#endif":         "2:1: unterminated function-like macro invocation",
+		"#define F(x) x\n  F(1, 2)":           "2:3: too many arguments provided to function-like macro invocation",
+		"#define F(x, y) x\nF(1)":             "2:1: too few arguments provided to function-like macro invocation",
+		"#define F() 1\nF(1)":                 "2:1: too many arguments provided to function-like macro invocation",
+		"#define F(x, y, ...) x\nF()":         "2:1: too few arguments provided to function-like macro invocation",
+		"#define CAT(a, b) a ## b\nCAT(., +)": "2:1: pasting formed '.+', an invalid preprocessing token",
+	} {
+		_, err := preprocess(source)
+		assert.EqualError(err, "a.c:"+want, source)
+	}
+}
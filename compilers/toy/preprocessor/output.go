@@ -0,0 +1,173 @@
+package preprocessor
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The result of preprocessing a source file.
+type Output struct {
+	// The preprocessed text, which is input to the lexer. Tokens which are not
+	// from macro expansions and included files are at the lines and columns
+	// that they are in the source file, where possible.
+	Text string
+	// The name of the source file, and the contents of it and the files which
+	// it includes, by name.
+	Filename string
+	Files    map[string][]byte
+	// Where each token of the text came from, in order.
+	segments []segment
+}
+
+// A token of the preprocessed text, and where it came from.
+type segment struct {
+	offset   int            // The offset of the token in the text.
+	pos      token.Position // The presumed position, with its filename.
+	expanded bool           // Whether the token came from a macro expansion.
+}
+
+// Position returns the position which a position of the text came from, with
+// the filename of its file. A position in a macro expansion is that of the
+// invocation. The file and line are those presumed by #line directives, but
+// the offset is in the file which was read.
+func (o *Output) Position(pos token.Position) token.Position {
+	i := sort.Search(len(o.segments), func(i int) bool {
+		return o.segments[i].offset > pos.Offset
+	}) - 1
+	if !pos.IsValid() || i < 0 || pos.Offset > len(o.Text) {
+		pos.Filename = o.Filename
+		return pos
+	}
+	s := o.segments[i]
+	if s.expanded {
+		return s.pos
+	}
+	// Move from the start of the token by the text between, which is as it is
+	// in the source unless the token was split by a line splice.
+	result := s.pos
+	text := o.Text[s.offset:pos.Offset]
+	result.Offset += len(text)
+	if n := strings.Count(text, "\n"); n > 0 {
+		result.Line += n
+		result.Column = 1
+		text = text[strings.LastIndexByte(text, '\n')+1:]
+	}
+	result.Column += utf8.RuneCountInString(text)
+	return result
+}
+
+// Translate moves a diagnostic about the preprocessed text, and its notes,
+// to the source files which its positions came from. A diagnostic in a file
+// other than the source file is given the name of that file, in its position.
+// One which already has a filename is not in the preprocessed text.
+func (o *Output) Translate(d *diag.Diagnostic) {
+	if d.Pos.Filename == "" {
+		d.Pos = o.Position(d.Pos)
+		if d.Pos.Filename == o.Filename {
+			d.Pos.Filename = ""
+		}
+	}
+	for _, n := range d.Notes {
+		o.Translate(n)
+	}
+}
+
+// An emitter writes the preprocessed text, recording where each token came
+// from. Each token is written at the line and column which it has in its
+// file, if the text so far is not longer, so that the layout of the source is
+// kept.
+type emitter struct {
+	text     strings.Builder
+	segments []segment
+	file     *file
+	line     int // The line of the file which the last line of the text is.
+	column   int // The column of the end of the text.
+	// The text of the last token, and whether it was from the source rather
+	// than a macro expansion.
+	last   string
+	source bool
+}
+
+// startFile starts writing the tokens of a file, on a new line.
+func (e *emitter) startFile(f *file) {
+	e.newline()
+	e.file, e.line = f, 1
+}
+
+// endFile finishes writing the tokens of a file at its eof token. The text
+// ends on the line of the eof token, but need not be padded to its column, as
+// its position is recorded.
+func (e *emitter) endFile(eof *ppToken) {
+	if eof.pos.Line > e.line {
+		e.text.WriteString(strings.Repeat("\n", eof.pos.Line-e.line))
+		e.line, e.column = eof.pos.Line, 1
+	}
+	e.record(eof)
+}
+
+// resume continues writing the tokens of a file after an #include directive
+// in it, from the line after the directive.
+func (e *emitter) resume(directive *ppToken) {
+	e.file, e.line = directive.file, directive.pos.Line
+}
+
+// newline ends the last line of the text, unless it is empty.
+func (e *emitter) newline() {
+	if e.column > 1 {
+		e.text.WriteByte('\n')
+		e.line++
+	}
+	e.column = 1
+}
+
+// emit writes a token.
+func (e *emitter) emit(t *ppToken) {
+	e.space(t)
+	e.record(t)
+	e.text.WriteString(t.text)
+	if n := strings.Count(t.text, "\n"); n > 0 {
+		e.line += n
+		e.column = 1 + utf8.RuneCountInString(t.text[strings.LastIndexByte(t.text, '\n')+1:])
+	} else {
+		e.column += utf8.RuneCountInString(t.text)
+	}
+	e.last, e.source = t.text, len(t.hide) == 0 && !t.expanded
+}
+
+// space writes the whitespace before a token. A token of the file which is
+// being written is moved to its line, and to its column if it is not from
+// the argument of a macro, so that the expansion of a macro starts at the
+// column of its invocation. Otherwise, it is separated from the token before
+// it if they were not adjacent in the source, or would be lexed as one.
+func (e *emitter) space(t *ppToken) {
+	sameFile := t.file == e.file
+	if sameFile && t.pos.Line > e.line {
+		e.text.WriteString(strings.Repeat("\n", t.pos.Line-e.line))
+		e.line, e.column = t.pos.Line, 1
+	}
+	source := len(t.hide) == 0 && !t.expanded
+	padded := sameFile && t.pos.Line == e.line && (source || t.expanded)
+	switch {
+	case padded && t.pos.Column > e.column:
+		e.text.WriteString(strings.Repeat(" ", t.pos.Column-e.column))
+		e.column = t.pos.Column
+	case e.column == 1:
+	case padded && source && e.source && t.pos.Column == e.column:
+	case t.space || len(scanText(e.last+t.text)) != 2:
+		e.text.WriteByte(' ')
+		e.column++
+	}
+}
+
+// record records where the token at the end of the text came from.
+func (e *emitter) record(t *ppToken) {
+	e.segments = append(e.segments, segment{e.text.Len(), t.file.presume(t.pos), t.expanded})
+}
+
+// output returns the written text.
+func (e *emitter) output(filename string, files map[string][]byte) *Output {
+	return &Output{Text: e.text.String(), Filename: filename, Files: files, segments: e.segments}
+}
@@ -0,0 +1,68 @@
+package preprocessor
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// positions returns the position which each token of the lexed output came
+// from.
+func positions(output *Output) []string {
+	var result []string
+	lex := lexer.Lex(output.Text)
+	for t := lex.NextToken(); ; t = lex.NextToken() {
+		result = append(result, output.Position(t.Position()).String())
+		if t.Type == token.EofToken || t.Type == token.ErrorToken {
+			return result
+		}
+	}
+}
+
+func TestOutputPosition(t *testing.T) {
+	assert := assert.New(t)
+	output, err := Preprocess("a.c", []byte("#define N 4\n/* a\nb */ int x =\n N;"))
+	assert.NoError(err)
+	assert.Equal([]string{"a.c:3:6", "a.c:3:10", "a.c:3:12", "a.c:4:2", "a.c:4:3", "a.c:4:4"},
+		positions(output))
+
+	// A token from a macro is at its invocation, unless it is from an
+	// argument.
+	output, err = Preprocess("a.c", []byte("#include \"a.h\"\nint y = F(\n  x);"),
+		files(map[string]string{"a.h": "#define F(a) (a + 1)\nint x;\n"}))
+	assert.NoError(err)
+	assert.Equal([]string{
+		"a.h:2:1", "a.h:2:5", "a.h:2:6",
+		"a.c:2:1", "a.c:2:5", "a.c:2:7", "a.c:2:9", "a.c:3:3", "a.c:2:9", "a.c:2:9", "a.c:2:9",
+		"a.c:3:5", "a.c:3:6",
+	}, positions(output))
+
+	// A position within or after a token is moved by the same distance in
+	// the source.
+	output, err = Preprocess("a.c", []byte("int\nmain() { return 2 @ 3; }\n"))
+	assert.NoError(err)
+	assert.Equal(token.Position{Filename: "a.c", Offset: 14, Line: 2, Column: 11},
+		output.Position(token.Position{Offset: 14, Line: 2, Column: 11}))
+	assert.Equal([]string{"a.c:1:1", "a.c:2:1", "a.c:2:5", "a.c:2:6", "a.c:2:8",
+		"a.c:2:10", "a.c:2:17", "a.c:2:19"}, positions(output))
+}
+
+func TestOutputTranslate(t *testing.T) {
+	assert := assert.New(t)
+	output, err := Preprocess("a.c", []byte("#include \"a.h\"\nint b = A;"),
+		files(map[string]string{"a.h": "#define A x\nint a;\n"}))
+	assert.NoError(err)
+	assert.Equal("\nint a;\n\nint b = x;", output.Text)
+	d := (&diag.Diagnostic{Pos: token.Position{Offset: 17, Line: 4, Column: 9}, Msg: "undefined"}).
+		Notef(token.Position{Offset: 5, Line: 2, Column: 5}, 1, "declared here")
+	output.Translate(d)
+	assert.Equal(token.Position{Offset: 23, Line: 2, Column: 9}, d.Pos)
+	assert.Equal(token.Position{Filename: "a.h", Offset: 16, Line: 2, Column: 5}, d.Notes[0].Pos)
+
+	// A diagnostic without a position is in the source file.
+	d = &diag.Diagnostic{Msg: "no main function"}
+	output.Translate(d)
+	assert.Equal(token.Position{}, d.Pos)
+}
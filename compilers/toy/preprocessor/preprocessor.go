@@ -0,0 +1,455 @@
+// Package preprocessor implements the C preprocessor, which runs before the
+// lexer. It expands object-like and function-like macros, selects the groups
+// of conditional directives, and includes files, producing the text which is
+// lexed and a map from the positions of that text to those of the source
+// files, for diagnostics.
+package preprocessor
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A preprocessing error at a location in a source file, which is named by the
+// filename of the position.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
+// Diagnostic returns the error as a diagnostic.
+func (e *Error) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{
+		Severity: diag.Error,
+		Pos:      e.Pos,
+		Msg:      e.Msg,
+		Code:     "preprocessor",
+	}
+}
+
+// The maximum depth of nested #include directives, which stops a file which
+// includes itself.
+const maxIncludeDepth = 200
+
+// An Option configures the preprocessor.
+type Option func(*preprocessor)
+
+// IncludePath adds a directory to the list which is searched for included
+// files, in the order they are added. A file included with quotes, as in
+// #include "a.h", is first searched for in the directory of the file which
+// includes it, and one included with angle brackets, as in #include <a.h>,
+// only in the include path.
+func IncludePath(dir string) Option {
+	return func(p *preprocessor) {
+		p.includePath = append(p.includePath, dir)
+	}
+}
+
+// ReadFile sets the function which reads included files, which is
+// ioutil.ReadFile by default. It reports a file which does not exist with an
+// error for which os.IsNotExist is true.
+func ReadFile(read func(name string) ([]byte, error)) Option {
+	return func(p *preprocessor) {
+		p.readFile = read
+	}
+}
+
+// A source file.
+type file struct {
+	name   string
+	source []byte
+	// The changes to the presumed file and line numbers of the lines which
+	// follow #line directives, in order.
+	lines []lineChange
+}
+
+// A #line directive, which presumes that the lines after it are in a file and
+// numbered from a line.
+type lineChange struct {
+	line     int // The line after the directive.
+	filename string
+	presumed int // The presumed number of that line.
+}
+
+// presume returns the presumed position of a position in a file, with the
+// filename set, after the #line directives before it.
+func (f *file) presume(pos token.Position) token.Position {
+	pos.Filename = f.name
+	for i := len(f.lines) - 1; i >= 0; i-- {
+		if c := f.lines[i]; c.line <= pos.Line {
+			pos.Filename = c.filename
+			pos.Line += c.presumed - c.line
+			break
+		}
+	}
+	return pos
+}
+
+// The state of a conditional directive, from its #if to its #endif.
+type conditional struct {
+	directive *ppToken // The name of the #if, #ifdef or #ifndef.
+	active    bool     // Whether the lines of the current group are kept.
+	// Whether a group has been kept, or the directive is within a skipped
+	// group, so that the groups which follow are skipped.
+	done    bool
+	sawElse bool
+}
+
+type preprocessor struct {
+	includePath []string
+	readFile    func(name string) ([]byte, error)
+	macros      map[string]*macro
+	files       map[string][]byte
+	depth       int // The depth of nested #include directives.
+	out         emitter
+}
+
+// Preprocess preprocesses a source file. Errors are of type *Error, and stop
+// preprocessing. The output is returned with an error, so that the files
+// which were read are known, but its text is incomplete.
+func Preprocess(filename string, source []byte, options ...Option) (output *Output, err error) {
+	p := &preprocessor{
+		readFile: ioutil.ReadFile,
+		macros:   map[string]*macro{},
+		files:    map[string][]byte{},
+	}
+	for name, expand := range builtins {
+		p.macros[name] = &macro{name: name, builtin: expand}
+	}
+	for _, option := range options {
+		option(p)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			output, err = p.out.output(filename, p.files), e
+		}
+	}()
+	p.include(&file{name: filename, source: source})
+	return p.out.output(filename, p.files), nil
+}
+
+// errorf stops preprocessing with an error at a token.
+func (p *preprocessor) errorf(t *ppToken, format string, args ...interface{}) {
+	panic(&Error{Pos: t.file.presume(t.pos), Msg: fmt.Sprintf(format, args...)})
+}
+
+// include preprocesses the lines of a file, writing them to the output.
+func (p *preprocessor) include(f *file) {
+	p.files[f.name] = f.source
+	p.out.startFile(f)
+	r := &reader{tokens: scan(f), multiline: true}
+	var conditionals []*conditional
+	for {
+		t := r.next()
+		switch {
+		case t.kind == eof:
+			if n := len(conditionals); n > 0 {
+				p.errorf(conditionals[n-1].directive, "unterminated conditional directive")
+			}
+			p.out.endFile(t)
+			return
+		case t.kind == newline:
+		case t.bol && t.is("#"):
+			line := readLine(r)
+			conditionals = p.directive(t, line, conditionals)
+		case len(conditionals) > 0 && !conditionals[len(conditionals)-1].active:
+			readLine(r)
+		default:
+			r.unread([]*ppToken{t})
+			for t := p.expand(r); t.kind != newline && t.kind != eof; t = p.expand(r) {
+				p.out.emit(t)
+			}
+		}
+	}
+}
+
+// readLine returns the tokens of a reader up to the end of the line, moving
+// past the newline.
+func readLine(r *reader) []*ppToken {
+	var line []*ppToken
+	for t := r.next(); t.kind != newline; t = r.next() {
+		if t.kind == eof {
+			r.unread([]*ppToken{t})
+			break
+		}
+		line = append(line, t)
+	}
+	return line
+}
+
+// directive runs the directive on a line, after its "#", returning the
+// conditional directives which contain the next line. In a skipped group,
+// only conditional directives are run.
+func (p *preprocessor) directive(hash *ppToken, line []*ppToken, conditionals []*conditional) []*conditional {
+	if len(line) == 0 {
+		// The null directive.
+		return conditionals
+	}
+	name, args := line[0], line[1:]
+	active := len(conditionals) == 0 || conditionals[len(conditionals)-1].active
+	var current *conditional
+	if len(conditionals) > 0 {
+		current = conditionals[len(conditionals)-1]
+	}
+	switch name.text {
+	case "if", "ifdef", "ifndef":
+		c := &conditional{directive: name, done: !active}
+		if active {
+			c.active = p.condition(name, args)
+			c.done = c.active
+		}
+		return append(conditionals, c)
+	case "elif":
+		if current == nil {
+			p.errorf(name, "#elif without #if")
+		}
+		if current.sawElse {
+			p.errorf(name, "#elif after #else")
+		}
+		current.active = !current.done && p.condition(name, args)
+		current.done = current.done || current.active
+		return conditionals
+	case "else":
+		if current == nil {
+			p.errorf(name, "#else without #if")
+		}
+		if current.sawElse {
+			p.errorf(name, "#else after #else")
+		}
+		p.noArgs(name, args)
+		current.sawElse = true
+		current.active = !current.done
+		current.done = true
+		return conditionals
+	case "endif":
+		if current == nil {
+			p.errorf(name, "#endif without #if")
+		}
+		p.noArgs(name, args)
+		return conditionals[:len(conditionals)-1]
+	}
+	if !active {
+		return conditionals
+	}
+	if name.kind == number {
+		// A line marker, as in the output of other preprocessors, which is a
+		// #line directive followed by flags.
+		p.line(hash, line, "line marker directive")
+		return conditionals
+	}
+	switch name.text {
+	case "define":
+		p.define(name, args)
+	case "undef":
+		m := p.macroName(name, args)
+		p.noArgs(name, args[1:])
+		delete(p.macros, m.text)
+	case "include":
+		p.includeFile(name, args)
+	case "line":
+		if len(args) > 0 {
+			args = p.expandAll(args, args[len(args)-1])
+		}
+		p.noArgs(name, p.line(name, args, "#line directive"))
+	case "error":
+		msg := "#error"
+		if len(args) > 0 {
+			msg += " " + lineText(args)
+		}
+		p.errorf(hash, "%s", msg)
+	default:
+		p.errorf(name, "invalid preprocessing directive #%s", name.text)
+	}
+	return conditionals
+}
+
+// noArgs checks that nothing follows the name of a directive which takes no
+// arguments.
+func (p *preprocessor) noArgs(name *ppToken, args []*ppToken) {
+	if len(args) > 0 {
+		p.errorf(args[0], "extra tokens at end of #%s directive", name.text)
+	}
+}
+
+// macroName returns the name of a macro which is the first argument of a
+// directive.
+func (p *preprocessor) macroName(directive *ppToken, args []*ppToken) *ppToken {
+	if len(args) == 0 {
+		p.errorf(directive, "macro name missing")
+	}
+	if args[0].kind != identifier {
+		p.errorf(args[0], "macro names must be identifiers")
+	}
+	if args[0].text == "defined" {
+		p.errorf(args[0], "'defined' cannot be used as a macro name")
+	}
+	return args[0]
+}
+
+// define runs a #define directive. A function-like macro has a "(" directly
+// after its name, followed by its parameter list.
+func (p *preprocessor) define(directive *ppToken, args []*ppToken) {
+	name := p.macroName(directive, args)
+	m := &macro{name: name.text, body: args[1:]}
+	if len(args) > 1 && args[1].is("(") && !args[1].space {
+		m.function = true
+		m.body = p.params(m, args[1], args[2:])
+		for i, t := range m.body {
+			if t.is("#") && (i+1 == len(m.body) || m.param(m.body[i+1]) < 0) {
+				p.errorf(t, "'#' is not followed by a macro parameter")
+			}
+		}
+	}
+	if n := len(m.body); n > 0 && (m.body[0].is("##") || m.body[n-1].is("##")) {
+		p.errorf(m.body[0], "'##' cannot appear at either end of a macro expansion")
+	}
+	p.macros[m.name] = m
+}
+
+// params reads the parameter list of a function-like macro, after its "(",
+// returning the tokens of its body.
+func (p *preprocessor) params(m *macro, open *ppToken, tokens []*ppToken) []*ppToken {
+	if len(tokens) > 0 && tokens[0].is(")") {
+		return tokens[1:]
+	}
+	for i := 0; i < len(tokens); i += 2 {
+		t := tokens[i]
+		switch {
+		case t.is("..."):
+			m.params = append(m.params, "__VA_ARGS__")
+			m.variadic = true
+		case t.kind == identifier:
+			if m.param(t) >= 0 {
+				p.errorf(t, "duplicate macro parameter name '%s'", t.text)
+			}
+			m.params = append(m.params, t.text)
+		default:
+			p.errorf(t, "invalid token in macro parameter list")
+		}
+		if i+1 == len(tokens) {
+			break
+		}
+		if next := tokens[i+1]; next.is(")") {
+			return tokens[i+2:]
+		} else if !next.is(",") || m.variadic {
+			p.errorf(next, "expected ',' or ')' in macro parameter list")
+		}
+	}
+	p.errorf(open, "missing ')' in macro parameter list")
+	return nil
+}
+
+// includeFile runs an #include directive, whose argument is a file name in
+// quotes or angle brackets, or macros which expand to one.
+func (p *preprocessor) includeFile(directive *ppToken, args []*ppToken) {
+	if len(args) > 0 && args[0].kind == identifier {
+		args = p.expandAll(args, args[len(args)-1])
+	}
+	var name string
+	var rest []*ppToken
+	switch {
+	case len(args) > 0 && args[0].kind == literal && args[0].text[0] == '"':
+		name, rest = args[0].text[1:len(args[0].text)-1], args[1:]
+	case len(args) > 0 && args[0].is("<"):
+		i := 1
+		for i < len(args) && !args[i].is(">") {
+			i++
+		}
+		if i == len(args) {
+			p.errorf(directive, "#include expects \"FILENAME\" or <FILENAME>")
+		}
+		name = lineText(args[1:i])
+		rest = args[i+1:]
+	default:
+		p.errorf(directive, "#include expects \"FILENAME\" or <FILENAME>")
+	}
+	p.noArgs(directive, rest)
+	if name == "" {
+		p.errorf(args[0], "empty filename in #include")
+	}
+	if p.depth == maxIncludeDepth {
+		p.errorf(directive, "#include nested too deeply")
+	}
+
+	var dirs []string
+	if args[0].kind == literal {
+		dirs = append(dirs, filepath.Dir(directive.file.name))
+	}
+	dirs = append(dirs, p.includePath...)
+	if filepath.IsAbs(name) {
+		dirs = []string{""}
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		source, err := p.readFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			p.errorf(args[0], "%v", err)
+		}
+		p.depth++
+		p.include(&file{name: path, source: source})
+		p.depth--
+		p.out.resume(directive)
+		return
+	}
+	p.errorf(args[0], "'%s' file not found", name)
+}
+
+// line runs a #line directive, whose arguments are a line number and
+// optionally a file name, returning the tokens after them. The line after the
+// directive is presumed to have that number, and to be in that file.
+func (p *preprocessor) line(directive *ppToken, args []*ppToken, kind string) []*ppToken {
+	if len(args) == 0 {
+		p.errorf(directive, "%s requires a simple digit sequence", kind)
+	}
+	// Other preprocessors write line markers for line 0, before the first
+	// line.
+	presumed, err := strconv.Atoi(args[0].text)
+	if err != nil || strings.Trim(args[0].text, "0123456789") != "" {
+		p.errorf(args[0], "%s requires a simple digit sequence", kind)
+	} else if presumed == 0 && directive.text == "line" {
+		p.errorf(args[0], "%s requires a positive integer argument", kind)
+	}
+	last := args[len(args)-1]
+	c := lineChange{line: last.pos.Line + 1, filename: directive.file.presume(directive.pos).Filename, presumed: presumed}
+	args = args[1:]
+	if len(args) > 0 {
+		name := lexer.Lex(args[0].text).NextToken()
+		if args[0].kind != literal || name.Type != token.StringLiteralToken {
+			p.errorf(args[0], "invalid filename for %s", kind)
+		}
+		c.filename = name.Value
+		args = args[1:]
+	}
+	directive.file.lines = append(directive.file.lines, c)
+	return args
+}
+
+// lineText returns the text of a list of tokens on a line, with a space
+// between those which are separated by whitespace.
+func lineText(tokens []*ppToken) string {
+	text := ""
+	for i, t := range tokens {
+		if i > 0 && t.space {
+			text += " "
+		}
+		text += t.text
+	}
+	return text
+}
@@ -0,0 +1,192 @@
+package preprocessor
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// files returns an option which reads included files from a map.
+func files(contents map[string]string) Option {
+	return ReadFile(func(name string) ([]byte, error) {
+		text, ok := contents[name]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return []byte(text), nil
+	})
+}
+
+// preprocess returns the preprocessed text of a source file named "a.c", or
+// the error.
+func preprocess(source string, options ...Option) (string, error) {
+	output, err := Preprocess("a.c", []byte(source), options...)
+	if err != nil {
+		return "", err
+	}
+	return output.Text, nil
+}
+
+func TestPreprocessKeepsLayout(t *testing.T) {
+	assert := assert.New(t)
+	text, err := preprocess("int main() {\n  return 2; // Two.\n}\n")
+	assert.NoError(err)
+	assert.Equal("int main() {\n  return 2;\n}\n", text)
+
+	// Comments become whitespace, and line splices join lines.
+	text, err = preprocess("int /* a\nb */ x = 1 + \\\n2;")
+	assert.NoError(err)
+	assert.Equal("int\n     x = 1 +\n2;", text)
+}
+
+func TestPreprocessDirectivesBecomeBlankLines(t *testing.T) {
+	assert := assert.New(t)
+	text, err := preprocess("#define A 1\n#\nint x = A;\n")
+	assert.NoError(err)
+	assert.Equal("\n\nint x = 1;\n", text)
+}
+
+func TestPreprocessConditionals(t *testing.T) {
+	assert := assert.New(t)
+	for source, want := range map[string]string{
+		"#ifdef A\na\n#endif\nb":                                         "\n\n\nb",
+		"#ifndef A\na\n#endif\nb":                                        "\na\n\nb",
+		"#define A\n#ifdef A\na\n#else\nb\n#endif":                       "\n\na\n\n\n",
+		"#if 0\na\n#elif 1\nb\n#elif 1\nc\n#else\nd\n#endif":             "\n\n\nb\n\n\n\n\n",
+		"#if 0\n#if 1\na\n#else\nb\n#endif\n#else\nc\n#endif":            "\n\n\n\n\n\n\nc\n",
+		"#if 0\n#bogus\n'unterminated\n#endif\nx":                        "\n\n\n\nx",
+		"#define A 2\n#if A == 2 && defined(A) && !defined B\nx\n#endif": "\n\nx\n",
+	} {
+		text, err := preprocess(source)
+		if assert.NoError(err, source) {
+			assert.Equal(want, text, source)
+		}
+	}
+}
+
+func TestPreprocessInclude(t *testing.T) {
+	assert := assert.New(t)
+	options := []Option{
+		files(map[string]string{
+			"a.h":           "int a;\n#include \"sys/b.h\"\n",
+			"sys/b.h":       "#include \"c.h\"\n",
+			"sys/c.h":       "int c;",
+			"include/d.h":   "#ifndef D_H\n#define D_H\nint d;\n#endif\n",
+			"include/sys/b": "wrong",
+		}),
+		IncludePath("include"),
+	}
+	output, err := Preprocess("a.c", []byte("#include \"a.h\"\n#include <d.h>\n#include <d.h>\nint main;"), options...)
+	assert.NoError(err)
+	assert.Equal("int a;\nint c;\n\n\n\nint d;\n\n\n\n\n\n\nint main;", output.Text)
+	assert.Equal(map[string][]byte{
+		"a.c":         []byte("#include \"a.h\"\n#include <d.h>\n#include <d.h>\nint main;"),
+		"a.h":         []byte("int a;\n#include \"sys/b.h\"\n"),
+		"sys/b.h":     []byte("#include \"c.h\"\n"),
+		"sys/c.h":     []byte("int c;"),
+		"include/d.h": []byte("#ifndef D_H\n#define D_H\nint d;\n#endif\n"),
+	}, output.Files)
+
+	// A file in angle brackets is only searched for in the include path.
+	_, err = Preprocess("a.c", []byte("#include <a.h>"), options...)
+	assert.EqualError(err, "a.c:1:10: 'a.h' file not found")
+
+	// The file name may be a macro.
+	text, err := preprocess("#define H \"sys/c.h\"\n#include H\n", options...)
+	assert.NoError(err)
+	assert.Equal("int c;\n", text)
+}
+
+func TestPreprocessErrorInIncludedFile(t *testing.T) {
+	assert := assert.New(t)
+	output, err := Preprocess("a.c", []byte("#include \"a.h\""), files(map[string]string{"a.h": "#if"}))
+	assert.EqualError(err, "a.h:1:2: #if with no expression")
+	// The files which were read are known, for diagnostics.
+	assert.Equal(map[string][]byte{"a.c": []byte("#include \"a.h\""), "a.h": []byte("#if")}, output.Files)
+}
+
+func TestPreprocessIncludeFromFileSystem(t *testing.T) {
+	assert := assert.New(t)
+	_, err := preprocess("#include \"testdata/missing.h\"")
+	assert.EqualError(err, "a.c:1:10: 'testdata/missing.h' file not found")
+}
+
+func TestPreprocessIncludeNestedTooDeeply(t *testing.T) {
+	assert := assert.New(t)
+	_, err := preprocess("#include \"a.c\"", files(map[string]string{"a.c": "#include \"a.c\"\n"}))
+	assert.EqualError(err, "a.c:1:2: #include nested too deeply")
+}
+
+func TestPreprocessError(t *testing.T) {
+	assert := assert.New(t)
+	for source, want := range map[string]string{
+		"#foo":                       "1:2: invalid preprocessing directive #foo",
+		"#define":                    "1:2: macro name missing",
+		"#define 1":                  "1:9: macro names must be identifiers",
+		"#define defined":            "1:9: 'defined' cannot be used as a macro name",
+		"#define f(a, a) a":          "1:14: duplicate macro parameter name 'a'",
+		"#define f(a b) a":           "1:13: expected ',' or ')' in macro parameter list",
+		"#define f(1) a":             "1:11: invalid token in macro parameter list",
+		"#define f(a":                "1:10: missing ')' in macro parameter list",
+		"#define f(a) #b":            "1:14: '#' is not followed by a macro parameter",
+		"#define f(a) ## a":          "1:14: '##' cannot appear at either end of a macro expansion",
+		"#define A a ##":             "1:11: '##' cannot appear at either end of a macro expansion",
+		"#undef A B":                 "1:10: extra tokens at end of #undef directive",
+		"#include":                   "1:2: #include expects \"FILENAME\" or <FILENAME>",
+		"#include <a.h":              "1:2: #include expects \"FILENAME\" or <FILENAME>",
+		"#include \"\"":              "1:10: empty filename in #include",
+		"#include \"a.h\" x":         "1:16: extra tokens at end of #include directive",
+		"#error":                     "1:1: #error",
+		"#error Not  \"supported\".": "1:1: #error Not \"supported\".",
+		"#if 1\n#error no\n#endif":   "2:1: #error no",
+		"#if 1\n#else\n#else":        "3:2: #else after #else",
+		"#if 1\n#else\n#elif 1":      "3:2: #elif after #else",
+		"#else":                      "1:2: #else without #if",
+		"#elif 1":                    "1:2: #elif without #if",
+		"#endif":                     "1:2: #endif without #if",
+		"#ifdef A\n#endif A":         "2:8: extra tokens at end of #endif directive",
+		"#if 1\n#if 0\n#endif":       "1:2: unterminated conditional directive",
+		"#ifdef":                     "1:2: macro name missing",
+		"#line":                      "1:2: #line directive requires a simple digit sequence",
+		"#line 0":                    "1:7: #line directive requires a positive integer argument",
+		"#line 0x1":                  "1:7: #line directive requires a simple digit sequence",
+		"#line 1 x":                  "1:9: invalid filename for #line directive",
+		"#line 1 \"b.c\" x":          "1:15: extra tokens at end of #line directive",
+		"# 1 <b.c>":                  "1:5: invalid filename for line marker directive",
+	} {
+		_, err := preprocess(source)
+		assert.EqualError(err, "a.c:"+want, source)
+	}
+}
+
+func TestPreprocessLine(t *testing.T) {
+	assert := assert.New(t)
+	output, err := Preprocess("a.c", []byte("#line 10\n__LINE__\n#define F \"b.c\"\n#line 20 F\n__FILE__ x\n# 5 \"c.h\" 1 3\n__LINE__ __FILE__"))
+	assert.NoError(err)
+	assert.Equal("\n10\n\n\n\"b.c\"    x\n\n5        \"c.h\"", output.Text)
+	assert.Equal([]string{"a.c:10:1", "b.c:20:1", "b.c:20:10", "c.h:5:1", "c.h:5:10", "c.h:5:18"},
+		positions(output))
+
+	// Other preprocessors number the lines before the first from 0.
+	text, err := preprocess("# 0 \"b.c\"\n# 0 \"<built-in>\"\n# 1 \"b.c\"\n__FILE__ __LINE__")
+	assert.NoError(err)
+	assert.Equal("\n\n\n\"b.c\"    1", text)
+
+	// Errors are at presumed positions, which last to the end of the file.
+	_, err = Preprocess("a.c", []byte("#include \"a.h\"\n#foo"),
+		files(map[string]string{"a.h": "#line 7 \"b.h\"\n\n"}))
+	assert.EqualError(err, "a.c:2:2: invalid preprocessing directive #foo")
+	_, err = Preprocess("a.c", []byte("#include \"a.h\""),
+		files(map[string]string{"a.h": "#line 7 \"b.h\"\n\n#foo"}))
+	assert.EqualError(err, "b.h:8:2: invalid preprocessing directive #foo")
+}
+
+func TestErrorDiagnostic(t *testing.T) {
+	assert := assert.New(t)
+	_, err := preprocess("#foo")
+	d := err.(*Error).Diagnostic()
+	assert.Equal(token.Position{Filename: "a.c", Offset: 1, Line: 1, Column: 2}, d.Pos)
+	assert.Equal("a.c:1:2: error: invalid preprocessing directive #foo", d.String())
+	assert.Equal("preprocessor", d.Code)
+}
@@ -0,0 +1,263 @@
+package preprocessor
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// The kind of a preprocessing token.
+type kind uint8
+
+const (
+	identifier kind = iota
+	number          // A preprocessing number, such as 42, 0x1f or 1.5e10f.
+	literal         // A string literal or character constant.
+	punctuator
+	// Any other character, or an unterminated comment or literal, which is
+	// left for the lexer to reject.
+	other
+	newline
+	eof
+)
+
+// A preprocessing token: a piece of source text, such as an identifier or a
+// punctuator, which the preprocessor treats as a unit.
+type ppToken struct {
+	kind kind
+	text string
+	file *file
+	pos  token.Position
+	// Whether whitespace precedes the token, and whether it is the first
+	// token of its line.
+	space bool
+	bol   bool
+	// The names of the macros which the token may not invoke, as it came
+	// from their expansion.
+	hide hideSet
+	// Whether the token was produced by a macro expansion, rather than copied
+	// from an argument or the source, so that its position is that of the
+	// invocation.
+	expanded bool
+}
+
+// is returns whether the token is a punctuator with the given text.
+func (t *ppToken) is(text string) bool {
+	return t.kind == punctuator && t.text == text
+}
+
+// copy returns a copy of the token, for a macro expansion. The copy is never
+// the first token of a line, so it cannot start a directive.
+func (t *ppToken) copy() *ppToken {
+	c := *t
+	c.bol = false
+	return &c
+}
+
+// The punctuators of more than one character, longest first.
+var punctuators = []string{
+	"<<=", ">>=", "...",
+	"->", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"*=", "/=", "%=", "+=", "-=", "&=", "^=", "|=", "##",
+}
+
+// A scanner splits a source file into preprocessing tokens. Comments become
+// whitespace, and a backslash at the end of a line joins it to the next.
+type scanner struct {
+	file   *file
+	source string
+	pos    token.Position
+}
+
+// scan returns the preprocessing tokens of a file, with a newline token at the
+// end of each line, and ending with an eof token.
+func scan(f *file) []*ppToken {
+	s := &scanner{file: f, source: string(f.source), pos: token.Position{Line: 1, Column: 1}}
+	var tokens []*ppToken
+	space, bol := false, true
+	for {
+		s.skipSplices()
+		if s.done() {
+			break
+		}
+		start := s.pos
+		switch c := s.source[s.pos.Offset]; {
+		case c == '\n':
+			s.advance()
+			tokens = append(tokens, &ppToken{kind: newline, text: "\n", file: f, pos: start})
+			space, bol = false, true
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			s.advance()
+			space = true
+			continue
+		case s.lookingAt("//"):
+			for !s.done() && s.source[s.pos.Offset] != '\n' {
+				s.advance()
+			}
+			space = true
+			continue
+		case s.lookingAt("/*"):
+			s.advance()
+			s.advance()
+			if s.skipComment() {
+				space = true
+				continue
+			}
+		}
+		t := s.token(start)
+		t.space, t.bol = space, bol
+		tokens = append(tokens, t)
+		space, bol = false, false
+	}
+	return append(tokens, &ppToken{kind: eof, file: f, pos: s.pos, bol: true})
+}
+
+// scanText splits text which is not in a file, such as the result of pasting
+// tokens, into preprocessing tokens.
+func scanText(text string) []*ppToken {
+	tokens := scan(&file{source: []byte(text)})
+	return tokens[:len(tokens)-1]
+}
+
+// done returns whether the scanner is at the end of the source.
+func (s *scanner) done() bool {
+	return s.pos.Offset >= len(s.source)
+}
+
+// lookingAt returns whether the source continues with the given text.
+func (s *scanner) lookingAt(text string) bool {
+	return strings.HasPrefix(s.source[s.pos.Offset:], text)
+}
+
+// advance moves past the next rune, and any line splices which follow it.
+func (s *scanner) advance() {
+	r, size := utf8.DecodeRuneInString(s.source[s.pos.Offset:])
+	s.pos.Offset += size
+	if r == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
+	s.skipSplices()
+}
+
+// skipSplices moves past backslashes which end a line.
+func (s *scanner) skipSplices() {
+	for s.lookingAt("\\\n") || s.lookingAt("\\\r\n") {
+		s.pos.Offset += strings.IndexByte(s.source[s.pos.Offset:], '\n') + 1
+		s.pos.Line++
+		s.pos.Column = 1
+	}
+}
+
+// skipComment moves past the end of a block comment, returning false if the
+// comment is unterminated.
+func (s *scanner) skipComment() bool {
+	for !s.done() {
+		if s.lookingAt("*/") {
+			s.advance()
+			s.advance()
+			return true
+		}
+		s.advance()
+	}
+	return false
+}
+
+// token scans the token which starts at a position. The text of the token is
+// that of the source between its start and end, without line splices.
+func (s *scanner) token(start token.Position) *ppToken {
+	if start.Offset != s.pos.Offset {
+		// An unterminated block comment.
+		return s.makeToken(other, start)
+	}
+	var k kind
+	c := s.source[s.pos.Offset]
+	next := byte(0)
+	if s.pos.Offset+1 < len(s.source) {
+		next = s.source[s.pos.Offset+1]
+	}
+	switch {
+	case isIdentifierStart(c):
+		k = identifier
+		for !s.done() && isIdentifierPart(s.source[s.pos.Offset]) {
+			s.advance()
+		}
+	case isDigit(c) || c == '.' && isDigit(next):
+		k = number
+		for !s.done() {
+			c := s.source[s.pos.Offset]
+			if (c == '+' || c == '-') && strings.IndexByte("eEpP", s.previous()) >= 0 {
+				s.advance()
+			} else if isIdentifierPart(c) || c == '.' {
+				s.advance()
+			} else {
+				break
+			}
+		}
+	case c == '"' || c == '\'':
+		k = literal
+		s.advance()
+		for !s.done() && s.source[s.pos.Offset] != c {
+			if s.source[s.pos.Offset] == '\n' {
+				k = other
+				break
+			}
+			if s.source[s.pos.Offset] == '\\' {
+				s.advance()
+				if s.done() {
+					break
+				}
+			}
+			s.advance()
+		}
+		if s.done() {
+			k = other
+		} else if k == literal {
+			s.advance()
+		}
+	default:
+		k = other
+		for _, p := range punctuators {
+			if s.lookingAt(p) {
+				for range p {
+					s.advance()
+				}
+				return s.makeToken(punctuator, start)
+			}
+		}
+		if strings.IndexByte("{}()[];,:?.~!+-*/%<>=&|^#", c) >= 0 {
+			k = punctuator
+		}
+		s.advance()
+	}
+	return s.makeToken(k, start)
+}
+
+// previous returns the last byte of the source before the scanner.
+func (s *scanner) previous() byte {
+	return s.source[s.pos.Offset-1]
+}
+
+// makeToken returns a token of the source from a position to the scanner.
+func (s *scanner) makeToken(k kind, start token.Position) *ppToken {
+	text := s.source[start.Offset:s.pos.Offset]
+	if strings.Contains(text, "\\\n") || strings.Contains(text, "\\\r\n") {
+		text = strings.NewReplacer("\\\r\n", "", "\\\n", "").Replace(text)
+	}
+	return &ppToken{kind: k, text: text, file: s.file, pos: start}
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,63 @@
+package preprocessor
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// texts returns the kinds and texts of the tokens of a source file.
+func texts(source string) []string {
+	names := map[kind]string{
+		identifier: "identifier",
+		number:     "number",
+		literal:    "literal",
+		punctuator: "punctuator",
+		other:      "other",
+		newline:    "newline",
+		eof:        "eof",
+	}
+	var result []string
+	for _, t := range scan(&file{name: "a.c", source: []byte(source)}) {
+		result = append(result, names[t.kind]+" "+t.text)
+	}
+	return result
+}
+
+func TestScan(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"identifier int", "identifier x_1", "punctuator =", "number 0x1f",
+		"punctuator +", "number 1.5e+10f", "punctuator <<=", "literal \"a\\\"b\"",
+		"punctuator ;", "newline \n",
+		"punctuator #", "identifier define", "identifier F", "punctuator (",
+		"punctuator ...", "punctuator )", "punctuator #", "identifier x",
+		"punctuator ##", "literal '\\''", "other @", "newline \n",
+		"number .5", "punctuator .", "identifier a", "eof ",
+	}, texts("int x_1 = 0x1f + 1.5e+10f <<= \"a\\\"b\";\n"+
+		"#define F(...) #x##'\\''@\n"+
+		".5 .a"))
+}
+
+func TestScanCommentsAndSplices(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"identifier a", "identifier b", "newline \n", "identifier cd",
+		"punctuator +", "punctuator =", "newline \n", "eof ",
+	}, texts("a/* x\ny */b // z \\\nstill a comment\nc\\\nd +/**/= \n"))
+
+	tokens := scan(&file{source: []byte("a /* x\n*/ b\n  c")})
+	assert.Equal(token.Position{Offset: 0, Line: 1, Column: 1}, tokens[0].pos)
+	assert.Equal(token.Position{Offset: 10, Line: 2, Column: 4}, tokens[1].pos)
+	assert.Equal(token.Position{Offset: 14, Line: 3, Column: 3}, tokens[3].pos)
+	assert.True(tokens[1].space)
+	assert.False(tokens[1].bol)
+	assert.True(tokens[3].bol)
+}
+
+func TestScanUnterminated(t *testing.T) {
+	assert := assert.New(t)
+	// Unterminated comments and literals are left for the lexer to reject.
+	assert.Equal([]string{"identifier a", "other /* b\nc", "eof "}, texts("a /* b\nc"))
+	assert.Equal([]string{"other \"b", "newline \n", "other 'c", "eof "}, texts("\"b\n'c"))
+}
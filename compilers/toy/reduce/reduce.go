@@ -0,0 +1,273 @@
+// Package reduce reduces a program which is interesting, such as one which
+// crashes the compiler or which the interpreter and compiled code disagree
+// on, to a small program which is still interesting, in the manner of
+// C-Reduce.
+//
+// Reduction transforms the syntax tree of the program: it removes
+// declarations and statements, runs of them at once before single ones, and
+// initializers, replaces a statement with a statement which it contains, and
+// an expression with one of its operands or with 0. Each candidate which is
+// shorter is printed in canonical form and kept if it is still interesting,
+// until no candidate is.
+package reduce
+
+import (
+	"errors"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+)
+
+// ErrNotInteresting is returned by Reduce if the program which it is given
+// is not interesting to begin with.
+var ErrNotInteresting = errors.New("the program is not interesting")
+
+// An Option configures a reduction.
+type Option func(*reducer)
+
+// Valid is an Option which keeps only candidates which pass semantic
+// analysis, for reducing a miscompilation rather than a crash, which any
+// program might reproduce once it is invalid.
+func Valid(r *reducer) {
+	r.valid = true
+}
+
+// Progress returns an Option which calls report with each smaller program
+// which is kept.
+func Progress(report func(source string)) Option {
+	return func(r *reducer) {
+		r.report = report
+	}
+}
+
+type reducer struct {
+	interesting func(source string) bool
+	valid       bool
+	report      func(source string)
+}
+
+// Reduce returns the smallest program which it finds that is interesting,
+// starting from source, which must parse and be interesting itself. The
+// result is in canonical form, as toyfmt prints it, unless only the source
+// as it is written is interesting.
+func Reduce(source string, interesting func(source string) bool, options ...Option) (string, error) {
+	r := &reducer{interesting: interesting, report: func(string) {}}
+	for _, o := range options {
+		o(r)
+	}
+	program, err := parse(source)
+	if err != nil {
+		return "", err
+	}
+	if !interesting(source) {
+		return "", ErrNotInteresting
+	}
+	if canonical := ast.Format(program); r.interesting(canonical) {
+		source = canonical
+	}
+	// Each pass tries the candidates from the last to the first, which is
+	// the program itself and then its last function, so that the largest
+	// parts are removed first. A pass which keeps a candidate is followed by
+	// another, since a candidate which was not interesting before may be now.
+	for reduced := true; reduced; {
+		reduced = false
+		for k := candidates(source) - 1; k >= 0; k-- {
+			if candidate, ok := r.try(source, k); ok {
+				source, reduced = candidate, true
+				r.report(source)
+				if n := candidates(source); k > n {
+					k = n
+				}
+			}
+		}
+	}
+	return source, nil
+}
+
+// try returns the k-th candidate of a program, and whether it is shorter,
+// parses, is valid if it must be, and is interesting.
+func (r *reducer) try(source string, k int) (string, bool) {
+	program, err := parse(source)
+	if err != nil {
+		return "", false
+	}
+	candidate := ast.Format(apply(program, k))
+	if len(candidate) >= len(source) {
+		return "", false
+	}
+	program, err = parse(candidate)
+	if err != nil {
+		return "", false
+	}
+	if r.valid && sema.Check(program) != nil {
+		return "", false
+	}
+	return candidate, r.interesting(candidate)
+}
+
+func parse(source string) (*ast.Program, error) {
+	return parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(source)))
+}
+
+// candidates returns the number of candidates of a program.
+func candidates(source string) int {
+	program, err := parse(source)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	ast.Rewrite(program, func(node ast.Node) ast.Node {
+		n += len(variants(node))
+		return node
+	})
+	return n
+}
+
+// apply returns a program transformed by its k-th candidate, numbering the
+// variants of the nodes in the order in which Rewrite visits them.
+func apply(program *ast.Program, k int) ast.Node {
+	return ast.Rewrite(program, func(node ast.Node) ast.Node {
+		if k < 0 {
+			return node
+		}
+		v := variants(node)
+		if k < len(v) {
+			node = v[k]()
+		}
+		k -= len(v)
+		return node
+	})
+}
+
+// A variant transforms a node, returning the node which replaces it, which
+// is the node itself if it removes some of its children.
+type variant func() ast.Node
+
+// variants returns the ways in which a node may be made smaller.
+func variants(node ast.Node) []variant {
+	var v []variant
+	replace := func(n ast.Node) {
+		v = append(v, func() ast.Node { return n })
+	}
+	switch n := node.(type) {
+	case *ast.Program:
+		v = append(v, removals(n, len(n.Enums), func(i, j int) {
+			n.Enums = append(n.Enums[:i], n.Enums[j:]...)
+		})...)
+		v = append(v, removals(n, len(n.Typedefs), func(i, j int) {
+			n.Typedefs = append(n.Typedefs[:i], n.Typedefs[j:]...)
+		})...)
+		v = append(v, removals(n, len(n.Structs), func(i, j int) {
+			n.Structs = append(n.Structs[:i], n.Structs[j:]...)
+		})...)
+		v = append(v, removals(n, len(n.Globals), func(i, j int) {
+			n.Globals = append(n.Globals[:i], n.Globals[j:]...)
+		})...)
+		v = append(v, removals(n, len(n.Functions), func(i, j int) {
+			n.Functions = append(n.Functions[:i], n.Functions[j:]...)
+		})...)
+	case *ast.EnumDeclaration:
+		v = removals(n, len(n.Enumerators), func(i, j int) {
+			n.Enumerators = append(n.Enumerators[:i], n.Enumerators[j:]...)
+		})
+	case *ast.StructDeclaration:
+		v = removals(n, len(n.Fields), func(i, j int) {
+			n.Fields = append(n.Fields[:i], n.Fields[j:]...)
+		})
+	case *ast.VariableDeclaration:
+		if n.Init != nil {
+			v = append(v, func() ast.Node {
+				n.Init = nil
+				return n
+			})
+		}
+	case *ast.Function:
+		v = removals(n, len(n.Body), func(i, j int) {
+			n.Body = append(n.Body[:i], n.Body[j:]...)
+		})
+
+	// Statements.
+	case *ast.Block:
+		v = removals(n, len(n.Statements), func(i, j int) {
+			n.Statements = append(n.Statements[:i], n.Statements[j:]...)
+		})
+		if len(n.Statements) == 1 {
+			replace(n.Statements[0])
+		}
+	case *ast.IfStatement:
+		replace(n.Then)
+		if n.Else != nil {
+			replace(n.Else)
+			v = append(v, func() ast.Node {
+				n.Else = nil
+				return n
+			})
+		}
+	case *ast.WhileStatement:
+		replace(n.Body)
+	case *ast.DoWhileStatement:
+		replace(n.Body)
+	case *ast.ForStatement:
+		replace(n.Body)
+	case *ast.SwitchStatement:
+		replace(n.Body)
+	case *ast.CaseStatement:
+		replace(n.Body)
+	case *ast.LabeledStatement:
+		replace(n.Body)
+
+	// Expressions.
+	case *ast.UnaryOp:
+		replace(n.Operand)
+	case *ast.BinaryOp:
+		replace(n.Lhs)
+		replace(n.Rhs)
+	case *ast.Assignment:
+		replace(n.Rhs)
+	case *ast.CompoundAssignment:
+		replace(n.Rhs)
+	case *ast.IncDecOp:
+		replace(n.Operand)
+	case *ast.ConditionalExpression:
+		replace(n.Then)
+		replace(n.Else)
+	case *ast.Conversion:
+		replace(n.Operand)
+	}
+	// Any statement may be emptied, and any expression may be zero, except a
+	// declaration, which may be a global, and an identifier, which may be
+	// the name of a function which is called.
+	switch node.(type) {
+	case *ast.Block, *ast.VariableDeclaration, *ast.Identifier:
+	case ast.Statement:
+		v = append(v, func() ast.Node { return &ast.Block{} })
+	case ast.Expression:
+		v = append(v, func() ast.Node {
+			return &ast.IntLiteral{Token: token.Token{Type: token.NumberToken, Value: "0"}}
+		})
+	}
+	return v
+}
+
+// removals returns the variants of a node which remove runs of the elements
+// of one of its lists, of length n, by calling remove(i, j) to remove those
+// from i up to j: the whole list, then each half, and so on down to each
+// element, as delta debugging does.
+func removals(node ast.Node, n int, remove func(i, j int)) []variant {
+	var v []variant
+	for size := n; size > 0; size /= 2 {
+		for i := 0; i < n; i += size {
+			i, j := i, i+size
+			if j > n {
+				j = n
+			}
+			v = append(v, func() ast.Node {
+				remove(i, j)
+				return node
+			})
+		}
+	}
+	return v
+}
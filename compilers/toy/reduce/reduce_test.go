@@ -0,0 +1,91 @@
+package reduce
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/gen"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// contains returns a predicate which is true of programs containing s.
+func contains(s string) func(string) bool {
+	return func(source string) bool {
+		return strings.Contains(source, s)
+	}
+}
+
+const program = `int g = 1;
+int h = 2;
+int f(int a) {
+  int x = a * 3;
+  if (x > 2) {
+    x = x + 1;
+  } else {
+    x = 0;
+  }
+  return x;
+}
+int main() {
+  int y = 0;
+  for (int i = 0; i < 3; i++) {
+    y += f(i) * 1234;
+  }
+  return y + g + h;
+}
+`
+
+func TestReduce(t *testing.T) {
+	assert := assert.New(t)
+	reduced, err := Reduce(program, contains("1234"))
+	assert.NoError(err)
+	assert.Equal("int main() {\n    1234;\n}\n", reduced)
+}
+
+func TestReduceValid(t *testing.T) {
+	assert := assert.New(t)
+	reduced, err := Reduce(program, contains("* 3"), Valid)
+	assert.NoError(err)
+	assert.Equal("int f(int a) {\n    int x = a * 3;\n}\n", reduced)
+
+	// A global which is used is kept, but not its initializer.
+	reduced, err = Reduce("int g = 1; int main() { return g + 2; }", contains("g +"), Valid)
+	assert.NoError(err)
+	assert.Equal("int g;\n\nint main() {\n    return g + 2;\n}\n", reduced)
+	reduced, err = Reduce("int g = 1; int main() { return g + 2; }", contains("g +"))
+	assert.NoError(err)
+	assert.Equal("int main() {\n    return g + 2;\n}\n", reduced)
+}
+
+func TestReduceProgress(t *testing.T) {
+	assert := assert.New(t)
+	var sizes []int
+	reduced, err := Reduce(program, contains("1234"), Progress(func(source string) {
+		sizes = append(sizes, len(source))
+	}))
+	assert.NoError(err)
+	assert.True(len(sizes) > 1)
+	for i := 1; i < len(sizes); i++ {
+		assert.True(sizes[i] < sizes[i-1])
+	}
+	assert.Equal(len(reduced), sizes[len(sizes)-1])
+}
+
+func TestReduceNotInteresting(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Reduce(program, contains("5678"))
+	assert.Equal(ErrNotInteresting, err)
+	_, err = Reduce("int main() {", contains("main"))
+	assert.Error(err)
+}
+
+func TestReduceGenerated(t *testing.T) {
+	assert := assert.New(t)
+	for seed := int64(1); seed <= 3; seed++ {
+		source := gen.Generate(rand.New(rand.NewSource(seed)))
+		reduced, err := Reduce(source, contains(" / "), Valid)
+		assert.NoError(err)
+		assert.Contains(reduced, " / ")
+		assert.True(len(reduced) < 200, reduced)
+	}
+}
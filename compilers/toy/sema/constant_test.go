@@ -0,0 +1,203 @@
+package sema
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/consteval"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// evaluateReturn checks the program
+// "int f(); int main() { <body> return <e>; }" and evaluates the value of its
+// final return statement. The evaluator of package consteval is tested here,
+// since its expressions must be checked.
+func evaluateReturn(t *testing.T, body, e string) (int64, bool) {
+	program, err := check(t, "int f(); int main() { "+body+" return "+e+"; }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := program.Functions[1].Body
+	return consteval.Int(statements[len(statements)-1].(*ast.ReturnStatement).Value)
+}
+
+func TestEvaluate(t *testing.T) {
+	assert := assert.New(t)
+	for e, want := range map[string]int64{
+		"1 + 2 * 3":         7,
+		"-7 / 2":            -3,
+		"-7 % 2":            -1,
+		"6 & 3 | 8 ^ 1":     11,
+		"-8 >> 1 << 2":      -16,
+		"1 << 33":           2,
+		"~5":                -6,
+		"!5 + !0":           1,
+		"2 < 3 == (1 > 0)":  1,
+		"3 != 3 || 2 >= 3":  0,
+		"0 && 2":            0,
+		"2147483647 + 1":    -2147483648,
+		"65536 * 65536":     0,
+		"1 ? 2 : 3":         2,
+		"0 ? 2 : 0 ? 3 : 4": 4,
+	} {
+		v, ok := evaluateReturn(t, "", e)
+		assert.True(ok, e)
+		assert.Equal(want, v, e)
+	}
+}
+
+func TestEvaluateSizeof(t *testing.T) {
+	assert := assert.New(t)
+	v, ok := evaluateReturn(t, "", "sizeof(double) + sizeof 'a'")
+	assert.True(ok)
+	assert.Equal(int64(12), v)
+	v, ok = evaluateReturn(t, "int a[2][3];", "sizeof a - sizeof(int *[2][3])")
+	assert.True(ok)
+	assert.Equal(int64(-24), v)
+}
+
+func TestEvaluateCasts(t *testing.T) {
+	assert := assert.New(t)
+	// A cast to char wraps, and one of a floating-point literal truncates.
+	v, ok := evaluateReturn(t, "", "(char)200 + (int)-2.5 + (int)(char)(int)1e2")
+	assert.True(ok)
+	assert.Equal(int64(42), v)
+	_, ok = evaluateReturn(t, "", "(int)(double)1")
+	assert.False(ok)
+	_, ok = evaluateReturn(t, "", "(int)1e10")
+	assert.False(ok)
+}
+
+func TestEvaluateUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	// Unsigned arithmetic wraps to a value which is never negative, which
+	// the return statement converts back to an int.
+	for e, want := range map[string]int64{
+		"-1 > 0u":               1,
+		"0xffffffff / 2":        2147483647,
+		"(unsigned)-8 >> 1":     2147483644,
+		"-1u % 10":              5,
+		"(unsigned)3e9 > 1u":    1,
+		"0u - 1 == 4294967295u": 1,
+	} {
+		v, ok := evaluateReturn(t, "", e)
+		assert.True(ok, e)
+		assert.Equal(want, v, e)
+	}
+	_, ok := evaluateReturn(t, "", "(unsigned)-2.5")
+	assert.False(ok)
+}
+
+func TestEvaluateIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	for e, want := range map[string]int64{
+		"2147483647L + 1 == 2147483648":            1,
+		"65536L * 65536 == 4294967296":             1,
+		"(short)65535 + (unsigned short)65535":     65534,
+		"(unsigned char)-1 + (signed char)255":     254,
+		"-1UL / 2 == 9223372036854775807":          1,
+		"0xffffffffffffffff > 0":                   1,
+		"(int)(4294967296L + 3)":                   3,
+		"sizeof(short) + sizeof(long) + sizeof 1L": 18,
+		"(unsigned long)-1 >> 63":                  1,
+		"9223372036854775807 + 1 < 0":              1,
+	} {
+		v, ok := evaluateReturn(t, "", e)
+		assert.True(ok, e)
+		assert.Equal(want, v, e)
+	}
+}
+
+func TestEvaluateEnumerators(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "enum { A = 3, B }; int main() { int C = 1; return A * B + C; }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := program.Functions[0].Body[1].(*ast.ReturnStatement).Value.(*ast.BinaryOp)
+	v, ok := consteval.Int(ret.Lhs)
+	assert.True(ok)
+	assert.Equal(int64(12), v)
+	// A variable is not a constant.
+	_, ok = consteval.Int(ret)
+	assert.False(ok)
+}
+
+func TestEvaluateShortCircuits(t *testing.T) {
+	assert := assert.New(t)
+	// Like at run time, the right operand is not evaluated.
+	v, ok := evaluateReturn(t, "int a;", "0 && a")
+	assert.True(ok)
+	assert.Equal(int64(0), v)
+	v, ok = evaluateReturn(t, "int a;", "2 || 1 / 0")
+	assert.True(ok)
+	assert.Equal(int64(1), v)
+	// Nor is the operand of a conditional expression which is not selected.
+	v, ok = evaluateReturn(t, "int a;", "1 ? 2 : a")
+	assert.True(ok)
+	assert.Equal(int64(2), v)
+}
+
+func TestEvaluateExact(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "int main() { return (char)(2147483647 + 2) + 2 * -(-2147483647 - 1); }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := program.Functions[0].Body[0].(*ast.ReturnStatement).Value.(*ast.BinaryOp)
+	// Arithmetic which overflows is not exact, even if it is converted.
+	_, ok := consteval.Exact(ret.Lhs)
+	assert.False(ok)
+	_, ok = consteval.Exact(ret.Rhs)
+	assert.False(ok)
+	v, ok := consteval.Exact(ret.Rhs.(*ast.BinaryOp).Lhs)
+	assert.True(ok)
+	assert.Equal(int64(2), v)
+	v, ok = consteval.Int(ret)
+	assert.True(ok)
+	assert.Equal(int64(1), v)
+}
+
+func TestEvaluateNotConstant(t *testing.T) {
+	assert := assert.New(t)
+	for _, e := range []string{
+		"a",
+		"1 + a",
+		"1 && a",
+		"a = 1",
+		"f()",
+		"1 / 0",
+		"1 % 0",
+		"(-2147483647 - 1) % -1",
+		"a++",
+		"a += 1",
+		"(-2147483647 - 1) / -1",
+		"1.5",
+		"-1.5f < 2",
+		"a ? 1 : 2",
+		"0 ? 1 : 2.5",
+	} {
+		_, ok := evaluateReturn(t, "int a;", e)
+		assert.False(ok, e)
+	}
+}
+
+func TestEvaluateInitializer(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int a = 2.9; int b = -2.9; double c = 1 + 2; float d = 0.1;
+double e = -1.5; int *p = 0; int f = 1e10; char g = 'a' + 200;`)
+	if !assert.Nil(err) {
+		return
+	}
+	var values []float64
+	for _, g := range program.Globals {
+		if types.IsFloating(g.Symbol.Type) {
+			values = append(values, g.Constant)
+		} else {
+			values = append(values, float64(g.IntConstant))
+		}
+	}
+	assert.Equal([]float64{2, -2, 3, float64(float32(0.1)), -1.5, 0, math.MinInt32,
+		41}, values)
+}
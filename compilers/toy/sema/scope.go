@@ -0,0 +1,66 @@
+package sema
+
+import "github.com/ChrisCummins/phd/compilers/toy/ast"
+
+// A lexical scope, which maps names to the symbols declared in it.
+type Scope struct {
+	Outer   *Scope // The enclosing scope, or nil for the global scope.
+	symbols map[string]*ast.Symbol
+	// Declarations in this scope which have not yet been reached, used to
+	// diagnose uses of a name before its declaration.
+	later map[string]ast.Node
+}
+
+// NewScope creates a new scope nested within outer.
+func NewScope(outer *Scope) *Scope {
+	return &Scope{
+		Outer:   outer,
+		symbols: make(map[string]*ast.Symbol),
+		later:   make(map[string]ast.Node),
+	}
+}
+
+// LookupLocal returns the symbol with the given name declared in this scope,
+// or nil.
+func (s *Scope) LookupLocal(name string) *ast.Symbol {
+	return s.symbols[name]
+}
+
+// Lookup returns the symbol with the given name declared in this scope or
+// the nearest enclosing scope, or nil.
+func (s *Scope) Lookup(name string) *ast.Symbol {
+	for ; s != nil; s = s.Outer {
+		if symbol := s.symbols[name]; symbol != nil {
+			return symbol
+		}
+	}
+	return nil
+}
+
+// Insert declares a symbol in this scope. If a symbol with the same name is
+// already declared in this scope, the scope is unchanged and the existing
+// symbol is returned. Otherwise the result is nil.
+func (s *Scope) Insert(symbol *ast.Symbol) *ast.Symbol {
+	if existing := s.symbols[symbol.Name]; existing != nil {
+		return existing
+	}
+	s.symbols[symbol.Name] = symbol
+	delete(s.later, symbol.Name)
+	return nil
+}
+
+// Len returns the number of symbols declared in this scope.
+func (s *Scope) Len() int {
+	return len(s.symbols)
+}
+
+// declaredLater returns the declaration of a name in this scope or an
+// enclosing scope which has not yet been reached, or nil.
+func (s *Scope) declaredLater(name string) ast.Node {
+	for ; s != nil; s = s.Outer {
+		if decl := s.later[name]; decl != nil {
+			return decl
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package sema
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestScopeLookup(t *testing.T) {
+	assert := assert.New(t)
+	outer := NewScope(nil)
+	a := &ast.Symbol{Kind: ast.VariableSymbol, Name: "a"}
+	assert.Nil(outer.Insert(a))
+
+	inner := NewScope(outer)
+	assert.Nil(inner.LookupLocal("a"))
+	assert.Equal(a, inner.Lookup("a"))
+	assert.Nil(inner.Lookup("b"))
+	assert.Equal(0, inner.Len())
+	assert.Equal(1, outer.Len())
+}
+
+func TestScopeShadowing(t *testing.T) {
+	assert := assert.New(t)
+	outer := NewScope(nil)
+	a1 := &ast.Symbol{Kind: ast.VariableSymbol, Name: "a"}
+	a2 := &ast.Symbol{Kind: ast.VariableSymbol, Name: "a"}
+	outer.Insert(a1)
+	inner := NewScope(outer)
+	assert.Nil(inner.Insert(a2))
+	assert.Equal(a2, inner.Lookup("a"))
+	assert.Equal(a1, outer.Lookup("a"))
+}
+
+func TestScopeInsertConflict(t *testing.T) {
+	assert := assert.New(t)
+	s := NewScope(nil)
+	a1 := &ast.Symbol{Kind: ast.VariableSymbol, Name: "a"}
+	a2 := &ast.Symbol{Kind: ast.VariableSymbol, Name: "a"}
+	assert.Nil(s.Insert(a1))
+	assert.Equal(a1, s.Insert(a2))
+	assert.Equal(a1, s.Lookup("a"))
+	assert.Equal(1, s.Len())
+}
@@ -0,0 +1,841 @@
+// Package sema implements semantic analysis of the abstract syntax tree.
+//
+// Semantic analysis resolves every identifier to the symbol that it names and
+// computes the type of every expression, annotating the tree with the
+// results. It reports programs which are syntactically valid but meaningless,
+// such as those which use undeclared variables or mix types.
+package sema
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/consteval"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// A semantic error at a location in the input.
+type Error struct {
+	Pos    token.Position
+	Length int // The length of the offending source text in runes, if known.
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
+// Diagnostic returns the error as a diagnostic.
+func (e *Error) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{
+		Severity: diag.Error,
+		Pos:      e.Pos,
+		Length:   e.Length,
+		Msg:      e.Msg,
+		Code:     "semantic",
+	}
+}
+
+// A list of semantic errors, in the order that they were found.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, e := range l {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// The types named by the type keywords which are not integer types.
+var typeSpecifiers = map[token.TokenType]types.Type{
+	token.FloatKeywordToken:  types.Float,
+	token.DoubleKeywordToken: types.Double,
+}
+
+// The integer types named by each combination of type keywords which the
+// parser accepts. A char is signed.
+var integerSpecifiers = map[string]types.Type{
+	"char":               types.Char,
+	"signed char":        types.Char,
+	"unsigned char":      types.UnsignedChar,
+	"short":              types.Short,
+	"short int":          types.Short,
+	"signed short":       types.Short,
+	"signed short int":   types.Short,
+	"unsigned short":     types.UnsignedShort,
+	"unsigned short int": types.UnsignedShort,
+	"int":                types.Int,
+	"signed":             types.Int,
+	"signed int":         types.Int,
+	"unsigned":           types.UnsignedInt,
+	"unsigned int":       types.UnsignedInt,
+	"long":               types.Long,
+	"long int":           types.Long,
+	"signed long":        types.Long,
+	"signed long int":    types.Long,
+	"unsigned long":      types.UnsignedLong,
+	"unsigned long int":  types.UnsignedLong,
+}
+
+// specifiedType returns the type named by a type keyword, and by the name of
+// a struct or enum if the keyword is "struct" or "enum", or by a typedef name.
+// An enum type is int. It returns nil if the struct, enum or typedef name has
+// not been declared.
+func (c *checker) specifiedType(decl ast.Node, typ, tag token.Token) types.Type {
+	switch typ.Type {
+	case token.StructKeywordToken, token.EnumKeywordToken:
+		s := c.scope.Lookup(typ.Value + " " + tag.Value)
+		if s == nil {
+			c.errorf(decl, "undefined %s '%s'", typ.Value, tag.Value)
+			return nil
+		}
+		return s.Type
+	case token.IdentifierToken:
+		s := c.scope.Lookup(typ.Value)
+		if s == nil || s.Kind != ast.TypedefSymbol {
+			c.errorf(decl, "unknown type name '%s'", typ.Value)
+			return nil
+		}
+		return s.Type
+	}
+	if t, ok := typeSpecifiers[typ.Type]; ok {
+		return t
+	}
+	return integerSpecifiers[strings.TrimSpace(typ.Value+" "+tag.Value)]
+}
+
+// declaredType returns the type of a declarator of the named thing: the type
+// t named by its type specifier, followed by the given number of '*', and by
+// the given array lengths, which must be positive integer constants. A
+// parameter declared as an array is adjusted to be a pointer to its first
+// element, so the length of its outermost dimension may be omitted. It
+// returns nil if t is nil or a length is invalid.
+func (c *checker) declaredType(decl ast.Node, t types.Type, pointers int,
+	name string, lengths []ast.Expression, parameter bool) types.Type {
+	if t == nil {
+		return nil
+	}
+	for i := 0; i < pointers; i++ {
+		t = types.NewPointer(t)
+	}
+	if len(lengths) == 0 {
+		// A parameter may be declared as an array by a typedef name.
+		if parameter && types.IsArray(t) {
+			return types.NewPointer(t.(*types.Array).Elem)
+		}
+		return t
+	}
+	// The array of a type name, as in "sizeof(int [2])", is unnamed.
+	in, array := "'"+name+"'", "array '"+name+"'"
+	if name == "" {
+		in, array = "type name", "unnamed array"
+	}
+	n := make([]int64, len(lengths))
+	ok := true
+	for i, l := range lengths {
+		if l == nil {
+			if !parameter || i > 0 {
+				c.errorf(decl, "array size missing in %s", in)
+				ok = false
+			}
+			continue
+		}
+		c.resolveExpression(l)
+		c.checkExpression(l)
+		v, constant := consteval.Int(l)
+		switch {
+		case !constant:
+			if ast.TypeOf(l) != nil {
+				c.errorf(l, "size of %s is not an integer constant", array)
+			}
+			ok = false
+		case v <= 0:
+			c.errorf(l, "size of %s is not positive", array)
+			ok = false
+		}
+		n[i] = v
+	}
+	if !ok {
+		return nil
+	}
+	inner := 0
+	if parameter {
+		inner = 1
+	}
+	for i := len(lengths) - 1; i >= inner; i-- {
+		t = types.NewArray(t, n[i])
+	}
+	if parameter {
+		t = types.NewPointer(t)
+	}
+	return t
+}
+
+type checker struct {
+	scope    *Scope
+	layout   types.Layout // The layout of types, which gives their sizes.
+	errors   ErrorList
+	function *ast.Function // The function being type checked, if any.
+	// The loops and switches enclosing the statement being resolved,
+	// innermost last.
+	enclosing []ast.Statement
+	// The labels declared so far in the function being resolved, by name,
+	// and its goto statements. Labels is nil outside of a function.
+	labels map[string]*ast.LabeledStatement
+	gotos  []*ast.GotoStatement
+	// The warnings found so far, and the function which reports them.
+	warnings      []*Warning
+	reportWarning func(*Warning)
+	// The symbols whose values have been read so far, and the parameters
+	// and local variables of the function being resolved.
+	read   map[*ast.Symbol]bool
+	locals []*ast.Symbol
+	// The first symbol declared with each skeleton, to find names which
+	// look the same.
+	skeletons map[string]*ast.Symbol
+	// The tables which record the types and symbols of nodes, if any.
+	types   ast.TypeTable
+	symbols ast.SymbolTable
+}
+
+// Check performs semantic analysis of a program. Identifiers and declarations
+// are annotated with their symbols, then expressions are annotated with their
+// types, and implicit conversions are made explicit. If the program is
+// invalid, the returned error is an ErrorList of every problem found.
+func Check(program *ast.Program, options ...Option) error {
+	c := &checker{scope: NewScope(nil), layout: types.LP64}
+	for _, o := range options {
+		o(c)
+	}
+	c.program(program)
+	c.reportWarnings()
+	// The conversions which were inserted are numbered.
+	program.Number()
+	c.record(program)
+	return c.err()
+}
+
+// An Option configures semantic analysis.
+type Option func(*checker)
+
+// Layout returns an Option which gives the sizes of types, which are the
+// values of sizeof expressions, by the layout of a target. The default is
+// types.LP64.
+func Layout(l types.Layout) Option {
+	return func(c *checker) {
+		c.layout = l
+	}
+}
+
+// RecordTypes returns an Option which records the type of each expression of
+// the program in a table, by its ID. The nodes are annotated all the same,
+// since lowering reads them; the table is a copy made once the program has
+// been checked, for analyses which should not depend on the nodes.
+func RecordTypes(t ast.TypeTable) Option {
+	return func(c *checker) {
+		c.types = t
+	}
+}
+
+// RecordSymbols returns an Option which records in a table the symbol which
+// each identifier of the program resolves to, and the symbol which each
+// declaration declares, by their IDs. As with RecordTypes, the nodes are
+// annotated too. Package xref finds the names of a program in this table.
+func RecordSymbols(t ast.SymbolTable) Option {
+	return func(c *checker) {
+		c.symbols = t
+	}
+}
+
+// record records the types and symbols of the nodes of a tree in the tables
+// of the options, if any. Nodes which have not been resolved are not
+// recorded.
+func (c *checker) record(node ast.Node) {
+	if c.types == nil && c.symbols == nil {
+		return
+	}
+	ast.Inspect(node, func(node ast.Node) bool {
+		if e, ok := node.(ast.Expression); ok && c.types != nil {
+			if t := ast.TypeOf(e); t != nil {
+				c.types[e.ID()] = t
+			}
+		}
+		if s := symbolOf(node); s != nil && c.symbols != nil {
+			c.symbols[node.ID()] = s
+		}
+		return true
+	})
+}
+
+// symbolOf returns the symbol of an identifier or a declaration, or nil.
+func symbolOf(node ast.Node) *ast.Symbol {
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return n.Symbol
+	case *ast.VariableDeclaration:
+		return n.Symbol
+	case *ast.Parameter:
+		return n.Symbol
+	case *ast.Function:
+		return n.Symbol
+	case *ast.Enumerator:
+		return n.Symbol
+	case *ast.EnumDeclaration:
+		return n.Symbol
+	case *ast.StructDeclaration:
+		return n.Symbol
+	case *ast.TypedefDeclaration:
+		return n.Symbol
+	}
+	return nil
+}
+
+// err returns the errors found, or nil if there are none.
+func (c *checker) err() error {
+	if len(c.errors) == 0 {
+		return nil
+	}
+	// Name resolution and type checking are separate passes, so report their
+	// errors in source order.
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].Pos.Offset < c.errors[j].Pos.Offset
+	})
+	return c.errors
+}
+
+func (c *checker) errorf(node ast.Node, format string, args ...interface{}) {
+	e := &Error{
+		Pos: node.Pos(),
+		Msg: fmt.Sprintf(format, args...),
+	}
+	// Only the extent of an identifier is known.
+	if i, ok := node.(*ast.Identifier); ok {
+		e.Length = utf8.RuneCountInString(i.Token.Value)
+	}
+	c.errors = append(c.errors, e)
+}
+
+// pushScope enters a new scope for a list of statements.
+func (c *checker) pushScope(statements []ast.Statement) {
+	c.scope = NewScope(c.scope)
+	for _, s := range statements {
+		if d, ok := s.(*ast.VariableDeclaration); ok {
+			if _, seen := c.scope.later[d.Name.Value]; !seen {
+				c.scope.later[d.Name.Value] = d
+			}
+		}
+	}
+}
+
+func (c *checker) popScope() {
+	c.scope = c.scope.Outer
+}
+
+// declare inserts a symbol into the current scope, reporting redeclarations.
+func (c *checker) declare(symbol *ast.Symbol) {
+	if existing := c.scope.Insert(symbol); existing != nil {
+		c.errorf(symbol.Decl, "redefinition of '%s' (previously declared at %v)",
+			symbol.Name, existing.Decl.Pos())
+	}
+	c.checkConfusable(symbol)
+}
+
+func (c *checker) program(program *ast.Program) {
+	// Every struct is declared before the fields of any are resolved, so that
+	// a struct may contain pointers to itself, or to a struct declared later.
+	for _, s := range program.Structs {
+		c.declareStruct(s)
+	}
+	// Enumerators are declared before the fields of structs are resolved, so
+	// that they may be used as the lengths of arrays.
+	for _, e := range program.Enums {
+		c.declareEnum(e)
+	}
+	// A typedef may name a struct, which need not yet be complete, and may be
+	// used by the fields of structs.
+	for _, t := range program.Typedefs {
+		c.declareTypedef(t)
+	}
+	for _, s := range program.Structs {
+		c.defineStruct(s)
+	}
+	// A global is visible from its own initializer, from the globals which
+	// follow it, and from every function.
+	for _, g := range program.Globals {
+		c.declareGlobal(g)
+		c.checkGlobal(g)
+	}
+	// Functions are declared before any function bodies are checked.
+	for _, f := range program.Functions {
+		c.declareFunction(f)
+	}
+	for _, f := range program.Functions {
+		if f.Prototype {
+			continue
+		}
+		// Parameters are in the same scope as the outermost declarations of
+		// the body, so may not be redeclared by them.
+		c.pushScope(f.Body)
+		c.labels = make(map[string]*ast.LabeledStatement)
+		params := f.Symbol.Type.(*types.Function).Params
+		for i, p := range f.Params {
+			c.declareParameter(p, params[i])
+		}
+		c.resolveStatements(f.Body)
+		c.resolveGotos()
+		c.popScope()
+		c.checkUnused()
+	}
+	for _, f := range program.Functions {
+		c.checkFunction(f)
+	}
+}
+
+// declareEnum declares the symbol of an enum, if it is named, and of each of
+// its enumerators. The value of an enumerator must be an integer constant,
+// which may use the enumerators before it.
+func (c *checker) declareEnum(d *ast.EnumDeclaration) {
+	if d.Name.Value != "" {
+		d.Symbol = &ast.Symbol{Kind: ast.EnumSymbol, Name: "enum " + d.Name.Value,
+			Type: types.Int, Decl: d}
+		c.declare(d.Symbol)
+	}
+	var next int64
+	for _, e := range d.Enumerators {
+		v := next
+		if e.Value != nil {
+			c.resolveExpression(e.Value)
+			c.checkExpression(e.Value)
+			if x, ok := consteval.Int(e.Value); ok {
+				v = x
+			} else if ast.TypeOf(e.Value) != nil {
+				c.errorf(e.Value, "enumerator value for '%s' is not an integer constant",
+					e.Name.Value)
+			}
+		} else if v > math.MaxInt32 {
+			c.errorf(e, "overflow in enumeration values")
+			v = math.MinInt32
+		}
+		e.Symbol = &ast.Symbol{Kind: ast.EnumeratorSymbol, Name: e.Name.Value,
+			Type: types.Int, Decl: e, Value: v}
+		c.declare(e.Symbol)
+		next = v + 1
+	}
+}
+
+// declareTypedef declares the symbol of a typedef name, whose type is that of
+// its declarator.
+func (c *checker) declareTypedef(d *ast.TypedefDeclaration) {
+	d.Symbol = &ast.Symbol{Kind: ast.TypedefSymbol, Name: d.Name.Value,
+		Type: c.declaredType(d, c.specifiedType(d, d.Type, d.Tag), d.Pointers,
+			d.Name.Value, d.Lengths, false),
+		Decl: d}
+	c.declare(d.Symbol)
+}
+
+// declareStruct declares the symbol of a struct, whose type is incomplete
+// until it is defined.
+func (c *checker) declareStruct(s *ast.StructDeclaration) {
+	s.Symbol = &ast.Symbol{Kind: ast.StructSymbol, Name: "struct " + s.Name.Value,
+		Type: &types.Struct{Tag: s.Name.Value}, Decl: s}
+	c.declare(s.Symbol)
+}
+
+// defineStruct resolves the types of the fields of a struct, which completes
+// it. A field may not have the type of a struct which is incomplete, such as
+// the struct itself, since its size is not known.
+func (c *checker) defineStruct(s *ast.StructDeclaration) {
+	st := s.Symbol.Type.(*types.Struct)
+	for _, f := range s.Fields {
+		t := c.declaredType(f, c.specifiedType(f, f.Type, f.Tag), f.Pointers,
+			f.Name.Value, f.Lengths, false)
+		if t == nil {
+			continue
+		}
+		if _, prior := st.Field(f.Name.Value); prior != nil {
+			c.errorf(f, "duplicate member '%s'", f.Name.Value)
+			continue
+		}
+		if elem := elementType(t); types.IsStruct(elem) && !elem.(*types.Struct).Complete {
+			c.errorf(f, "field '%s' has incomplete type %v", f.Name.Value, elem)
+			continue
+		}
+		st.Fields = append(st.Fields, &types.Field{Name: f.Name.Value, Type: t})
+	}
+	st.Complete = true
+}
+
+// elementType returns the innermost element type of an array of arrays, or t
+// if it is not an array.
+func elementType(t types.Type) types.Type {
+	for types.IsArray(t) {
+		t = t.(*types.Array).Elem
+	}
+	return t
+}
+
+// declareFunction declares the symbol of a function. A function may be
+// declared any number of times, but defined at most once, and every
+// declaration must have the same type. The symbol's declaration is the
+// function's definition, if it has been reached, or else its first prototype.
+func (c *checker) declareFunction(f *ast.Function) {
+	t := &types.Function{Result: c.declaredType(f,
+		c.specifiedType(f, f.Type, f.Tag), f.Pointers, f.Name.Value, nil, false),
+		Variadic: f.Variadic}
+	if types.IsStruct(t.Result) {
+		c.errorf(f, "returning %v by value is not supported", t.Result)
+	}
+	// A variadic function may be declared, to call a library function such as
+	// printf, but not defined, since its arguments cannot be accessed.
+	if f.Variadic && !f.Prototype {
+		c.errorf(f, "definition of variadic function '%s' is not supported",
+			f.Name.Value)
+	}
+	for _, p := range f.Params {
+		pt := c.declaredType(p, c.specifiedType(p, p.Type, p.Tag), p.Pointers,
+			p.Name.Value, p.Lengths, true)
+		if types.IsStruct(pt) {
+			c.errorf(p, "passing %v by value is not supported", pt)
+		}
+		t.Params = append(t.Params, pt)
+	}
+	f.Symbol = &ast.Symbol{Kind: ast.FunctionSymbol, Name: f.Name.Value,
+		Type: t, Decl: f, Static: f.Storage.Type == token.StaticKeywordToken}
+	existing := c.scope.LookupLocal(f.Name.Value)
+	if existing == nil {
+		c.declare(f.Symbol)
+		return
+	}
+	prior, ok := existing.Decl.(*ast.Function)
+	switch {
+	case !ok:
+		c.declare(f.Symbol)
+	case !types.Identical(existing.Type, t):
+		c.errorf(f, "conflicting types for '%s' (previously declared at %v)",
+			f.Name.Value, existing.Decl.Pos())
+	case !f.Prototype && !prior.Prototype:
+		c.declare(f.Symbol)
+	default:
+		c.checkLinkage(f, f.Symbol, existing)
+		f.Symbol = existing
+		if !f.Prototype {
+			existing.Decl = f
+		}
+	}
+}
+
+// declareGlobal declares the symbol of a global variable. Like a function, a
+// global may be declared any number of times, but defined at most once, and
+// every declaration must have the same type. An extern declaration without an
+// initializer only declares a variable which is defined elsewhere, possibly
+// in another file.
+func (c *checker) declareGlobal(d *ast.VariableDeclaration) {
+	d.Symbol = &ast.Symbol{Kind: ast.VariableSymbol, Name: d.Name.Value,
+		Type: c.declaredType(d, c.specifiedType(d, d.Type, d.Tag), d.Pointers,
+			d.Name.Value, d.Lengths, false),
+		Decl: d, Static: d.Storage.Type == token.StaticKeywordToken}
+	existing := c.scope.LookupLocal(d.Name.Value)
+	var prior *ast.VariableDeclaration
+	if existing != nil {
+		prior, _ = existing.Decl.(*ast.VariableDeclaration)
+	}
+	switch {
+	case prior == nil || d.IsDefinition() && prior.IsDefinition():
+		c.declare(d.Symbol)
+	case d.Symbol.Type != nil && existing.Type != nil &&
+		!types.Identical(existing.Type, d.Symbol.Type):
+		c.errorf(d, "conflicting types for '%s' (previously declared at %v)",
+			d.Name.Value, existing.Decl.Pos())
+	default:
+		c.checkLinkage(d, d.Symbol, existing)
+		d.Symbol = existing
+		if d.IsDefinition() {
+			existing.Decl = d
+		}
+	}
+	// A global is visible from its own initializer.
+	if d.Init != nil {
+		c.resolveExpression(d.Init)
+	}
+}
+
+// checkLinkage checks that the redeclaration of a function or global
+// variable, whose symbol would be redeclared, does not give it internal
+// linkage when the existing declaration gave it external linkage. A
+// redeclaration which is not static has the linkage of the existing one.
+func (c *checker) checkLinkage(decl ast.Node, redeclared, existing *ast.Symbol) {
+	if redeclared.Static && !existing.Static {
+		c.errorf(decl, "static declaration of '%s' follows non-static declaration (previously declared at %v)",
+			redeclared.Name, existing.Decl.Pos())
+	}
+}
+
+// declareParameter declares a parameter of a function definition, of type t.
+func (c *checker) declareParameter(p *ast.Parameter, t types.Type) {
+	if p.Name.Value == "" {
+		c.errorf(p, "parameter name omitted")
+		return
+	}
+	p.Symbol = &ast.Symbol{Kind: ast.VariableSymbol, Name: p.Name.Value,
+		Type: t, Decl: p}
+	c.declare(p.Symbol)
+	c.locals = append(c.locals, p.Symbol)
+}
+
+func (c *checker) resolveStatements(statements []ast.Statement) {
+	for _, s := range statements {
+		c.resolveStatement(s)
+	}
+}
+
+// resolveStatement declares the variables in a statement and resolves the
+// identifiers which it uses.
+func (c *checker) resolveStatement(s ast.Statement) {
+	switch n := s.(type) {
+	case *ast.ReturnStatement:
+		c.resolveExpression(n.Value)
+	case *ast.ExpressionStatement:
+		c.resolveEffect(n.Expression)
+	case *ast.VariableDeclaration:
+		if n.Storage.Value != "" {
+			c.errorf(n, "storage class '%s' of local variable '%s' is not supported",
+				n.Storage.Value, n.Name.Value)
+		}
+		n.Symbol = &ast.Symbol{Kind: ast.VariableSymbol, Name: n.Name.Value,
+			Type: c.declaredType(n, c.specifiedType(n, n.Type, n.Tag), n.Pointers,
+				n.Name.Value, n.Lengths, false),
+			Decl: n}
+		if c.labels != nil {
+			c.checkShadow(n)
+			c.locals = append(c.locals, n.Symbol)
+		}
+		// The scope of a variable begins at its declarator, so it is visible
+		// within its own initializer.
+		c.declare(n.Symbol)
+		if n.Init != nil {
+			c.resolveExpression(n.Init)
+		}
+	case *ast.Block:
+		c.pushScope(n.Statements)
+		c.resolveStatements(n.Statements)
+		c.popScope()
+	case *ast.IfStatement:
+		c.resolveExpression(n.Cond)
+		c.resolveStatement(n.Then)
+		if n.Else != nil {
+			c.resolveStatement(n.Else)
+		}
+	case *ast.WhileStatement:
+		c.resolveExpression(n.Cond)
+		c.resolveBody(n, n.Body)
+	case *ast.DoWhileStatement:
+		c.resolveBody(n, n.Body)
+		c.resolveExpression(n.Cond)
+	case *ast.ForStatement:
+		// A variable declared by the first clause is in scope until the end
+		// of the loop.
+		c.pushScope(nil)
+		if n.Init != nil {
+			c.resolveStatement(n.Init)
+		}
+		if n.Cond != nil {
+			c.resolveExpression(n.Cond)
+		}
+		if n.Post != nil {
+			c.resolveEffect(n.Post)
+		}
+		c.resolveBody(n, n.Body)
+		c.popScope()
+	case *ast.SwitchStatement:
+		c.resolveExpression(n.Value)
+		c.resolveBody(n, n.Body)
+	case *ast.CaseStatement:
+		if s, ok := c.innermost(isSwitch).(*ast.SwitchStatement); ok {
+			s.Cases = append(s.Cases, n)
+		} else if n.Value == nil {
+			c.errorf(n, "'default' label not within a switch statement")
+		} else {
+			c.errorf(n, "case label not within a switch statement")
+		}
+		if n.Value != nil {
+			c.resolveExpression(n.Value)
+		}
+		c.resolveStatement(n.Body)
+	case *ast.LabeledStatement:
+		switch prior := c.labels[n.Label.Value]; {
+		case c.labels == nil:
+			c.errorf(n, "label '%s' not within a function", n.Label.Value)
+		case prior != nil:
+			c.errorf(n, "redefinition of label '%s' (previously declared at %v)",
+				n.Label.Value, prior.Pos())
+		default:
+			c.labels[n.Label.Value] = n
+		}
+		c.resolveStatement(n.Body)
+	case *ast.GotoStatement:
+		if c.labels == nil {
+			c.errorf(n, "goto statement not within a function")
+		}
+		c.gotos = append(c.gotos, n)
+	case *ast.BreakStatement:
+		n.Target = c.innermost(func(ast.Statement) bool { return true })
+		if n.Target == nil {
+			c.errorf(n, "break statement not within a loop or switch")
+		}
+	case *ast.ContinueStatement:
+		n.Target = c.innermost(isLoop)
+		if n.Target == nil {
+			c.errorf(n, "continue statement not within a loop")
+		}
+	default:
+		panic(fmt.Sprintf("unhandled statement type %T", s))
+	}
+}
+
+// resolveGotos resolves the targets of the goto statements of a function.
+// Labels have function scope, so a goto may jump to a label before it, or in
+// another block. A jump may enter the scope of a variable, skipping its
+// initialization. C forbids a jump into the scope of a variably modified
+// declaration, but the lengths of arrays are constants, so there are none.
+func (c *checker) resolveGotos() {
+	for _, g := range c.gotos {
+		g.Target = c.labels[g.Label.Value]
+		if g.Target == nil {
+			c.errorf(&ast.Identifier{Token: g.Label}, "use of undeclared label '%s'",
+				g.Label.Value)
+		}
+	}
+	c.labels, c.gotos = nil, nil
+}
+
+// resolveBody resolves the body of a loop or switch, which encloses the
+// jumps and case labels within it.
+func (c *checker) resolveBody(s, body ast.Statement) {
+	c.enclosing = append(c.enclosing, s)
+	c.resolveStatement(body)
+	c.enclosing = c.enclosing[:len(c.enclosing)-1]
+}
+
+// innermost returns the innermost enclosing loop or switch which matches a
+// predicate, or nil if there is none.
+func (c *checker) innermost(match func(ast.Statement) bool) ast.Statement {
+	for i := len(c.enclosing) - 1; i >= 0; i-- {
+		if match(c.enclosing[i]) {
+			return c.enclosing[i]
+		}
+	}
+	return nil
+}
+
+func isLoop(s ast.Statement) bool {
+	switch s.(type) {
+	case *ast.WhileStatement, *ast.DoWhileStatement, *ast.ForStatement:
+		return true
+	}
+	return false
+}
+
+func isSwitch(s ast.Statement) bool {
+	_, ok := s.(*ast.SwitchStatement)
+	return ok
+}
+
+func (c *checker) resolveExpression(e ast.Expression) {
+	switch n := e.(type) {
+	case *ast.IntLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+	case *ast.Identifier:
+		c.resolveIdentifier(n)
+		c.markRead(n)
+	case *ast.UnaryOp:
+		c.resolveExpression(n.Operand)
+	case *ast.BinaryOp:
+		c.resolveExpression(n.Lhs)
+		c.resolveExpression(n.Rhs)
+	case *ast.Assignment:
+		c.resolveExpression(n.Lhs)
+		c.resolveExpression(n.Rhs)
+	case *ast.CompoundAssignment:
+		c.resolveExpression(n.Lhs)
+		c.resolveExpression(n.Rhs)
+	case *ast.IncDecOp:
+		c.resolveExpression(n.Operand)
+	case *ast.ConditionalExpression:
+		c.resolveExpression(n.Cond)
+		c.resolveExpression(n.Then)
+		c.resolveExpression(n.Else)
+	case *ast.Call:
+		c.resolveIdentifier(n.Function)
+		for _, a := range n.Args {
+			c.resolveExpression(a)
+		}
+	case *ast.Subscript:
+		c.resolveExpression(n.Array)
+		c.resolveExpression(n.Index)
+	case *ast.Member:
+		c.resolveExpression(n.X)
+	case *ast.Sizeof:
+		if n.TypeName == nil {
+			c.resolveExpression(n.Operand)
+			break
+		}
+		n.Of = c.typeName(n.TypeName)
+	case *ast.Conversion:
+		// Only casts are in the tree before it is checked.
+		c.resolveExpression(n.Operand)
+		n.Type = c.typeName(n.TypeName)
+	default:
+		panic(fmt.Sprintf("unhandled expression type %T", e))
+	}
+}
+
+// resolveEffect resolves an expression whose value is not used, such as that
+// of an expression statement. If it assigns to, increments or decrements a
+// variable, that variable is not read, even by a compound assignment, since
+// the value which it computes is only stored.
+func (c *checker) resolveEffect(e ast.Expression) {
+	var target ast.Expression
+	switch n := e.(type) {
+	case *ast.Assignment:
+		target = n.Lhs
+		c.resolveExpression(n.Rhs)
+	case *ast.CompoundAssignment:
+		target = n.Lhs
+		c.resolveExpression(n.Rhs)
+	case *ast.IncDecOp:
+		target = n.Operand
+	default:
+		c.resolveExpression(e)
+		return
+	}
+	if i, ok := target.(*ast.Identifier); ok {
+		c.resolveIdentifier(i)
+	} else {
+		c.resolveExpression(target)
+	}
+}
+
+// typeName returns the type named by a type name. The struct that it names is
+// looked up in the scope of the expression.
+func (c *checker) typeName(n *ast.TypeName) types.Type {
+	return c.declaredType(n, c.specifiedType(n, n.Type, n.Tag), n.Pointers,
+		"", n.Lengths, false)
+}
+
+// resolveIdentifier resolves an identifier which is used as a value.
+func (c *checker) resolveIdentifier(i *ast.Identifier) {
+	name := i.Token.Value
+	i.Symbol = c.scope.Lookup(name)
+	if i.Symbol == nil {
+		if decl := c.scope.declaredLater(name); decl != nil {
+			c.errorf(i, "'%s' used before its declaration at %v", name, decl.Pos())
+		} else {
+			c.errorf(i, "undefined identifier '%s'", name)
+		}
+	}
+}
@@ -0,0 +1,723 @@
+package sema
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// check parses and checks a program.
+func check(t *testing.T, input string) (*ast.Program, error) {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program, Check(program)
+}
+
+var validPrograms = []string{
+	"int main() { return 0; }",
+	"int main() { int a; return 0; }",
+	"int main() { int a = 1; int b = a + 2; return a * b; }",
+	"int main() { int a; a = 2; return a; }",
+	"int main() { int a; int b; a = b = 3; return a; }",
+	"int main() { int a = a; return a; }",
+	"int main() { int a = 1; { int a = 2; } return a; }",
+	"int main() { int a = 1; { a = 2; int b = a; } return a; }",
+	"int main() { { int a; } { int a; } return 0; }",
+	"int foo() { int a; return 1; } int main() { int a; return 2; }",
+	"double f() { double a = 1.5; return a * 2.0; }",
+	"float f() { float a = 1.5f; a = a / 2.5f; return -a; }",
+	"int main() { double a = 1.5; return a < 2.0 && !a; }",
+	"int main() { double a = 1.5; return 1 || a; }",
+	// Implicit conversions.
+	"int main() { double a = 1; return 0; }",
+	"int main() { return 1.5; }",
+	"int main() { int a; a = 1.5f; return a; }",
+	"int main() { return 1 + 2.0 == 3; }",
+	"int main() { double a = 1.5; float b = 1.5f; return a < b; }",
+	// Functions.
+	"int f(int a, int b) { return a + b; } int main() { return f(1, 2); }",
+	"int f(int a) { { int a = 2; } return a; }",
+	"int putchar(int); int main() { return putchar(65); }",
+	"int f(int); int f(int x); int f(int y) { return y; } int f(int);",
+	"int main() { return f(1); } int f(int a) { return a; }",
+	"int f(double d); int main() { return f(1) + f(2.5f); }",
+	"int f(int f) { return f; }",
+	// If statements.
+	"int main() { int a = 1; if (a) a = 2; else { int a = 3; } return a; }",
+	"int main() { double d; if (d && !d) return 1; return 0; }",
+	"int main() { if (1) { int a; } else { int a; } return 0; }",
+	// Loops.
+	"int main() { int i = 0; while (i < 3) i = i + 1; return i; }",
+	"int main() { do { int a; break; } while (1); return 0; }",
+	"int main() { for (int i = 0; i < 3; i = i + 1) { int i = 2; continue; } return 0; }",
+	"int main() { int i; for (int i = 0;;) break; for (i = 0;;) break; return i; }",
+	"int main() { for (;;) { while (1) break; continue; } }",
+	// Switches.
+	"int main() { int a = 1; switch (a) { case 1: return 2; case -1: break; default: a = 3; } return a; }",
+	"int main() { switch (1) { case 1: switch (2) { case 1: break; } case 2: return 1; } return 0; }",
+	"int main() { for (;;) switch (1) { case 1: continue; default: break; } }",
+	"int main() { switch (1) { case 1 + 2 * 3: case 2 < 3 && !0: case ~0: return 0; } }",
+	"int main() { switch (1) { case 0 && 1 / 0: case 1 || 1 / 0: return 0; } }",
+	"int main() { int a = 2; switch (a) { case 1: { int a = 3; case 2: return a; } } return 0; }",
+	"int main() { switch (1) case 1: while (0) { default: return 0; } }",
+	"int main() { switch (1) { case 1: switch (2) { case 1: default: break; } default: return 0; } }",
+	// Compound assignment and increment operators.
+	"int main() { int a = 1; a += 2; a -= 3; a *= 4; a /= 5; a %= 6; return a; }",
+	"int main() { int a = 1; a <<= 2; a >>= 3; a &= 4; a |= 5; a ^= 6; return a; }",
+	"int main() { int a = 1; a += 1.5; double d = 1; d *= a; d /= 2.5f; return a; }",
+	"int main() { int a = 1; double d = a++ + ++a; d--; --d; return a % 2; }",
+	"int main() { int a = 1; int b = a += 2; return b; }",
+	// Conditional expressions.
+	"int main() { int a = 1; return a ? a + 1 : -a; }",
+	"int main() { double d; return d ? 1 : 2.5f; }",
+	"int main() { int a; int b = a ? a = 2 : 0 ? 3 : 4; return b; }",
+	"int main() { switch (1) { case 1 ? 2 : 1 / 0: case 0 ? 1 / 0 : 3: return 0; } }",
+	// Pointers.
+	"int main() { int a = 1; int *p = &a; *p = 2; return *p + a; }",
+	"int main() { int a; int *p = &a; int **q = &p; **q = 3; return a; }",
+	"int main() { int a; int *p = &a; int *q = p + 1; q = 1 + q - 1; return q - p; }",
+	"int main() { int a; int *p = &a; p += 2; p -= 2; p++; --p; return p == &a; }",
+	"int main() { int *p = 0; p = 1 - 1; return !p || p != 0 && 0 == p; }",
+	"int main() { int a; int *p = &a; if (p) while (p < &a + 1) p++; return p >= &a; }",
+	"int main() { int a; int *p = &a; int *q = a ? p : 0; q = a ? 0 : q; return q == p; }",
+	"int main() { double d; double *p = &*&d; return *p; }",
+	"int *f(int *p) { return p; } int main() { int a; return *f(&a) + (f(0) == 0); }",
+	// Arrays.
+	"int main() { int a[3]; a[0] = 1; 2[a] = a[0] + 1; int *p = a; return *(p + 1) + a[2 - 1]; }",
+	"int main() { int a[2][3]; a[1][2] = 4; int *p = a[1]; return p[2] + (&a[1] - a); }",
+	"int main() { double d[2 * 2 + 1]; for (double *p = d; p < d + 5; p++) *p = 0; return d == &d[0]; }",
+	"int f(int a[], int n); int f(int *a, int n) { return a[n]; } int main() { int b[2]; return f(b, 1); }",
+	"int g(int m[][2]) { return m[1][1]; } int main() { int m[3][2]; m[0][0] = 1; return g(m) + !m; }",
+	// Structs.
+	"struct p { int x; double y; }; int main() { struct p a; a.x = 1; a.y = a.x; return a.x; }",
+	"struct n { int v; struct n *next; }; int main() { struct n a; struct n *p = &a; p->next = p; return p->next->v; }",
+	"int f(struct s *p); struct s { int a[2]; }; int f(struct s *p) { return p->a[1]; }",
+	"struct a { struct b *b; }; struct b { int x; }; int main() { struct a a; return a.b->x; }",
+	"struct in { int x; }; struct out { struct in i[2]; }; int main() { struct out o; o.i[1].x++; return (&o.i[1])->x; }",
+	"struct s { int x; }; int main() { struct s s; int *p = &s.x; return *p; }",
+	// Globals.
+	"int g = 1; int main() { g = g + 1; return g; }",
+	"int a[3]; struct s { int x; }; struct s s; int *p; int main() { p = &a[1]; s.x = *p; return s.x; }",
+	"int f() { return g; } int g = -2 * 3; double d = -1.5; float e = 2; int h = 2.5;",
+	"int g; int main() { int g = 2; return g; }",
+	"int *p = 0; double d = 1 ? 2 : 3; int main() { return p == 0; }",
+	// Sizeof is an integer constant, and its operand is not evaluated.
+	"struct s { char c; double d; }; int a[sizeof(struct s)]; int main() { switch (2) { case sizeof(int *) / 4: return sizeof a / sizeof a[0]; } }",
+	"struct n { struct n *next[sizeof(struct n *)]; }; int n = sizeof(struct n); int main() { int i; return sizeof i++; }",
+	// Enumerators are int constants, which may be used in case labels and
+	// the lengths of arrays, and hidden by local variables.
+	"enum color { RED, GREEN, BLUE = 5, WHITE }; int a[WHITE]; int main() { enum color c = GREEN; switch (c) { case RED: return 0; case WHITE: return a[5]; } return sizeof(enum color) + BLUE; }",
+	"struct s { int a[M]; }; enum { N = 2, M = N * 3, L = -M + sizeof(int) }; int g = N + M; int main() { int N = 1; struct s x; return N + sizeof x.a[L]; }",
+	// Casts between arithmetic types, between pointers, and between pointers
+	// and integers. An integer cast of a constant is constant.
+	"struct s { int a; }; int f(double d, int *p) { char *c = (char *)p; return (int)d + (char)(float)d + (int)c + ((struct s *)c)->a + *(int *)(long_p(p)); } int long_p(int *p) { return 0; }",
+	"int a[(int)2.5]; char c = (char)300; int *p = (int *)0; int main() { switch (1) { case (char)257: return (int)(double)sizeof a; } }",
+	// Labels have function scope, in their own namespace, so a goto may
+	// jump forwards, backwards, or into another block.
+	"int main() { int a = 0; goto a; a: a++; { b: if (a < 3) goto a; } if (0) goto b; switch (a) { case 3: goto c; } c: return a; } int f() { a: goto a; }",
+	// Typedef names, which may name incomplete structs and be used by the
+	// fields of structs. A parameter of an array type is a pointer.
+	"typedef int T; typedef T *P; typedef int A[2]; typedef struct s S; struct s { T x; P p; S *next; }; int sum(A a) { a = 0; return 0; } int main() { A a; S s; s.p = &s.x; a[0] = (T)1.5; return sum(a) + sizeof(A) / sizeof(T); }",
+	"typedef double D; D f(D d) { return d; } int main() { int D = 2; return D + f(1); }",
+	// A global may be declared extern any number of times, before or after
+	// its definition, or without one, and a static function or global keeps
+	// its linkage when it is redeclared.
+	"extern int n; extern int n; int main() { return n + m; } int n = 1; extern int n; extern int m;",
+	"static int n; extern int n; static int f(); int f(); extern int f() { return n; }",
+}
+
+func TestValidPrograms(t *testing.T) {
+	for _, input := range validPrograms {
+		_, err := check(t, input)
+		assert.Nil(t, err, input)
+	}
+}
+
+var invalidPrograms = []struct {
+	input  string
+	errors []string
+}{
+	{"int main() { int a; int a; return 0; }",
+		[]string{"1:21: redefinition of 'a' (previously declared at 1:14)"}},
+	{"int main() { return 0; } int main() { return 1; }",
+		[]string{"1:26: redefinition of 'main' (previously declared at 1:1)"}},
+	{"int main() { return a; }",
+		[]string{"1:21: undefined identifier 'a'"}},
+	{"int main() { return0; }",
+		[]string{"1:14: undefined identifier 'return0'"}},
+	{"int main() { a = 1; int a; return a; }",
+		[]string{"1:14: 'a' used before its declaration at 1:21"}},
+	{"int main() { { b = 1; } int b; return b; }",
+		[]string{"1:16: 'b' used before its declaration at 1:25"}},
+	{"int main() { { int a; } return a; }",
+		[]string{"1:32: undefined identifier 'a'"}},
+	{"int main() { int a; a + 3 = 4; return a; }",
+		[]string{"1:21: expression is not assignable"}},
+	{"int main() { int a; !a = 3; return a; }",
+		[]string{"1:21: expression is not assignable"}},
+	{"int main() { return main; }",
+		[]string{"1:21: cannot use function 'main' as a value"}},
+	{"int main() { 1 = 2; return 0; }",
+		[]string{"1:14: cannot assign to a literal"}},
+	{"int main() { int a; 2.5 = a; return 0; }",
+		[]string{"1:21: cannot assign to a literal"}},
+	{"double f() { return ~1.5; }",
+		[]string{"1:21: invalid operand of type double to '~'"}},
+	{"int main() { return 1 + x + 2.0; }",
+		[]string{"1:25: undefined identifier 'x'"}},
+	{"int main() { return ~x + ~1.5; }",
+		[]string{
+			"1:22: undefined identifier 'x'",
+			"1:26: invalid operand of type double to '~'",
+		}},
+	{"int main() { return 1.5 = main; }",
+		[]string{
+			"1:21: cannot assign to a literal",
+			"1:27: cannot use function 'main' as a value",
+		}},
+	{"int f(int a, int a) { return a; }",
+		[]string{"1:14: redefinition of 'a' (previously declared at 1:7)"}},
+	{"int f(int a) { int a; return a; }",
+		[]string{"1:16: redefinition of 'a' (previously declared at 1:7)"}},
+	{"int f(int) { return 0; }",
+		[]string{"1:7: parameter name omitted"}},
+	{"int f(int); double f(int);",
+		[]string{"1:13: conflicting types for 'f' (previously declared at 1:1)"}},
+	{"int f(int a) { return a; } int f(double a);",
+		[]string{"1:28: conflicting types for 'f' (previously declared at 1:1)"}},
+	{"int f(); int f() { return 0; } int f() { return 1; }",
+		[]string{"1:32: redefinition of 'f' (previously declared at 1:10)"}},
+	{"int main() { return f(); }",
+		[]string{"1:21: undefined identifier 'f'"}},
+	{"int main() { int a; return a(); }",
+		[]string{"1:28: called object 'a' is not a function"}},
+	{"int f(int a); int main() { return f(); }",
+		[]string{"1:35: too few arguments to function 'f' (expected 1, found 0)"}},
+	{"int f(); int main() { return f(1, 2); }",
+		[]string{"1:30: too many arguments to function 'f' (expected 0, found 2)"}},
+	{"int f(char *, ...); int main() { return f(); }",
+		[]string{"1:41: too few arguments to function 'f' (expected at least 1, found 0)"}},
+	{"int f(int a, ...) { return a; }",
+		[]string{"1:1: definition of variadic function 'f' is not supported"}},
+	{"int f(int, ...); int main() { return f(1, 2); } int f(int);",
+		[]string{"1:49: conflicting types for 'f' (previously declared at 1:1)"}},
+	{"struct s { int x; }; int f(int, ...); int main() { struct s a; return f(1, a); }",
+		[]string{"1:76: used struct type value where scalar is required"}},
+	{`int main() { "a" = 0; return "b"++; }`,
+		[]string{
+			"1:14: assignment to expression with array type char [2]",
+			"1:30: assignment to expression with array type char [2]",
+		}},
+	{"int f(); int main() { return f(x); }",
+		[]string{
+			"1:30: too many arguments to function 'f' (expected 0, found 1)",
+			"1:32: undefined identifier 'x'",
+		}},
+	{"int f(); int main() { f() = 1; return f; }",
+		[]string{
+			"1:23: expression is not assignable",
+			"1:39: cannot use function 'f' as a value",
+		}},
+	{"int main() { if (x) return 1; else return y; }",
+		[]string{
+			"1:18: undefined identifier 'x'",
+			"1:43: undefined identifier 'y'",
+		}},
+	{"int main() { if (1) { int a; } return a; }",
+		[]string{"1:39: undefined identifier 'a'"}},
+	{"int main() { if (main) return 1; return 0; }",
+		[]string{"1:18: cannot use function 'main' as a value"}},
+	{"int main() { break; }",
+		[]string{"1:14: break statement not within a loop or switch"}},
+	{"int main() { if (1) continue; return 0; }",
+		[]string{"1:21: continue statement not within a loop"}},
+	{"int main() { case 1: return 0; }",
+		[]string{"1:14: case label not within a switch statement"}},
+	{"int main() { while (1) { default: break; } }",
+		[]string{"1:26: 'default' label not within a switch statement"}},
+	{"int main() { switch (1) { case 0: continue; } return 0; }",
+		[]string{"1:35: continue statement not within a loop"}},
+	{"int main() { switch (1) { case 1: case 2: case 1: return 0; } }",
+		[]string{"1:43: duplicate case value '1' (previously used at 1:27)"}},
+	{"int main() { switch (1) { case 3: case 1 + 2: return 0; } }",
+		[]string{"1:35: duplicate case value '3' (previously used at 1:27)"}},
+	{"int main() { switch (1) { case 2147483648: case -2147483648: return 0; } }",
+		[]string{"1:44: duplicate case value '-2147483648' (previously used at 1:27)"}},
+	{"int main() { switch (1u) { case -1: case 0xffffffff: return 0; } }",
+		[]string{"1:37: duplicate case value '4294967295' (previously used at 1:28)"}},
+	{"int main() { switch (1) { default: default: return 0; } }",
+		[]string{"1:36: multiple default labels in one switch (previously used at 1:27)"}},
+	{"int main() { int a; switch (a) { case a: case 1 / 0: case 1.5: return 0; } }",
+		[]string{
+			"1:39: case label does not reduce to an integer constant",
+			"1:47: case label does not reduce to an integer constant",
+			"1:59: case label does not reduce to an integer constant",
+		}},
+	{"int main() { switch (1) { case x: return 0; } }",
+		[]string{"1:32: undefined identifier 'x'"}},
+	{"int main() { switch (1.5) { case 1: return 0; } }",
+		[]string{"1:22: switch quantity not an integer"}},
+	{"int main() { double d; return d & 1 | 2.5 ^ 3 << 4.5f >> d; }",
+		[]string{
+			"1:31: invalid operands of types double and int to '&'",
+			"1:45: invalid operands of types int and float to '<<'",
+		}},
+	{"int main() { double d; return d % 2; }",
+		[]string{"1:31: invalid operands of types double and int to '%'"}},
+	{"int main() { float f; return 1 % f; }",
+		[]string{"1:30: invalid operands of types int and float to '%'"}},
+	{"int main() { int a; double d; a %= d; d <<= 1; d &= a; a |= 1.5; return a; }",
+		[]string{
+			"1:31: invalid operands of types int and double to '%='",
+			"1:39: invalid operands of types double and int to '<<='",
+			"1:48: invalid operands of types double and int to '&='",
+			"1:56: invalid operands of types int and double to '|='",
+		}},
+	{"int main() { int a; 1 += a; a + 1 -= 2; return a; }",
+		[]string{
+			"1:21: cannot assign to a literal",
+			"1:29: expression is not assignable",
+		}},
+	{"int main() { int a; ++1; (a + 1)--; ++-a; return a++++; }",
+		[]string{
+			"1:23: cannot assign to a literal",
+			"1:27: expression is not assignable",
+			"1:39: expression is not assignable",
+			"1:50: expression is not assignable",
+		}},
+	{"int main() { main++; return x += 1; }",
+		[]string{
+			"1:14: cannot use function 'main' as a value",
+			"1:29: undefined identifier 'x'",
+		}},
+	{"int main() { int a; switch (1) { case a++: case 1 % 0: return 0; } }",
+		[]string{
+			"1:39: case label does not reduce to an integer constant",
+			"1:49: case label does not reduce to an integer constant",
+		}},
+	{"int main() { return x ? y : z; }",
+		[]string{
+			"1:21: undefined identifier 'x'",
+			"1:25: undefined identifier 'y'",
+			"1:29: undefined identifier 'z'",
+		}},
+	{"int main() { return main ? 1 : main; }",
+		[]string{
+			"1:21: cannot use function 'main' as a value",
+			"1:32: cannot use function 'main' as a value",
+		}},
+	{"int main() { int a; 1 ? a : a = 2; return a; }",
+		[]string{"1:21: expression is not assignable"}},
+	{"int main() { int a; switch (1) { case 1 ? a : 2: return 0; } }",
+		[]string{"1:39: case label does not reduce to an integer constant"}},
+	{"int main() { for (int i = 0;;) break; return i; }",
+		[]string{"1:46: undefined identifier 'i'"}},
+	{"int main() { while (x) { } do { } while (y); }",
+		[]string{
+			"1:21: undefined identifier 'x'",
+			"1:42: undefined identifier 'y'",
+		}},
+	{"int main() { int a = 1; return *a + *1.5; }",
+		[]string{
+			"1:32: invalid type argument of unary '*' (have int)",
+			"1:37: invalid type argument of unary '*' (have double)",
+		}},
+	{"int main() { int a; int *p = &1; p = &(a + 1); p = &(&a); return 0; }",
+		[]string{
+			"1:30: lvalue required as unary '&' operand",
+			"1:38: lvalue required as unary '&' operand",
+			"1:52: lvalue required as unary '&' operand",
+		}},
+	{"int main() { int a; int *p = a; double *q = &a; p = 1; return p; }",
+		[]string{
+			"1:30: cannot convert a value of type int to int *",
+			"1:45: cannot convert a value of type int * to double *",
+			"1:53: cannot convert a value of type int to int *",
+			"1:63: cannot convert a value of type int * to int",
+		}},
+	{"int main() { int *p; double *q; return p * 2 + (p + q) + (p - q) + (p < q) + (p == 1); }",
+		[]string{
+			"1:40: invalid operands of types int * and int to '*'",
+			"1:49: invalid operands of types int * and double * to '+'",
+			"1:59: invalid operands of types int * and double * to '-'",
+			"1:69: invalid operands of types int * and double * to '<'",
+			"1:79: invalid operands of types int * and int to '=='",
+		}},
+	{"int main() { int *p; double d; p + d; 1 - p; p < 0; -p; ~p; return 0; }",
+		[]string{
+			"1:32: invalid operands of types int * and double to '+'",
+			"1:39: invalid operands of types int and int * to '-'",
+			"1:46: invalid operands of types int * and int to '<'",
+			"1:53: invalid operand of type int * to '-'",
+			"1:57: invalid operand of type int * to '~'",
+		}},
+	{"int main() { int a; int *p; p *= 2; a += p; p += 1.5; p %= 2; return 0; }",
+		[]string{
+			"1:29: invalid operands of types int * and int to '*='",
+			"1:37: invalid operands of types int and int * to '+='",
+			"1:45: invalid operands of types int * and double to '+='",
+			"1:55: invalid operands of types int * and int to '%='",
+		}},
+	{"int main() { int a; int *p; double *q; return *(a ? p : q) + *(a ? p : 1); }",
+		[]string{
+			"1:49: type mismatch in conditional expression (int * and double *)",
+			"1:64: type mismatch in conditional expression (int * and int)",
+		}},
+	{"int main() { int *p; switch (p) { } return 0; }",
+		[]string{"1:30: switch quantity not an integer"}},
+	{"int main() { int a[0]; int b[-1]; int n = 2; int c[n]; int d[]; return 0; }",
+		[]string{
+			"1:20: size of array 'a' is not positive",
+			"1:30: size of array 'b' is not positive",
+			"1:52: size of array 'c' is not an integer constant",
+			"1:56: array size missing in 'd'",
+		}},
+	{"int f(int a[][]); int g(int b[1.5]); int main() { int a[2]; return 0; }",
+		[]string{
+			"1:7: array size missing in 'a'",
+			"1:31: size of array 'b' is not an integer constant",
+		}},
+	{"int main() { int a[2]; int b[2]; int c[2] = a; a = b; a++; a += 1; return 0; }",
+		[]string{
+			"1:45: invalid initializer for array 'c'",
+			"1:48: assignment to expression with array type int [2]",
+			"1:55: assignment to expression with array type int [2]",
+			"1:60: assignment to expression with array type int [2]",
+		}},
+	{"int main() { int a; int b[2]; double *p; return a[0] + b[1.5] + b[p] + p[a]; }",
+		[]string{
+			"1:49: subscripted value is neither array nor pointer",
+			"1:58: array subscript is not an integer",
+			"1:67: array subscript is not an integer",
+		}},
+	{"int f(double *p); int main() { int a[2]; int *r = &a; return f(a); }",
+		[]string{
+			"1:51: cannot convert a value of type int (*)[2] to int *",
+			"1:64: cannot convert a value of type int * to double *",
+		}},
+	{"struct s { int x; int x; struct s y; struct t *z; struct u w; }; struct s { int x; };",
+		[]string{
+			"1:19: duplicate member 'x'",
+			"1:26: field 'y' has incomplete type struct s",
+			"1:38: undefined struct 't'",
+			"1:51: undefined struct 'u'",
+			"1:66: redefinition of 'struct s' (previously declared at 1:1)",
+		}},
+	{"struct s { int x; }; int main() { struct s a; struct s b; a = b; return a.y + a->x; }",
+		[]string{
+			"1:59: assignment of struct s is not supported",
+			"1:75: 'struct s' has no member named 'y'",
+			"1:79: invalid type argument of '->' (have struct s)",
+		}},
+	{"struct s { int x; }; int main() { struct s a; int b = a; struct s c = a; return b.x; }",
+		[]string{
+			"1:55: cannot convert a value of type struct s to int",
+			"1:71: initialization of struct 'c' is not supported",
+			"1:81: request for member 'x' in something not a structure",
+		}},
+	{"struct s { int x; }; int main() { struct s a; if (a) a; return !a + (a && 1) + (a == a); }",
+		[]string{
+			"1:51: used struct type value where scalar is required",
+			"1:54: used struct type value where scalar is required",
+			"1:65: used struct type value where scalar is required",
+			"1:70: used struct type value where scalar is required",
+			"1:81: invalid operands of types struct s and struct s to '=='",
+		}},
+	{"struct s { int x; }; struct s f(); int g(struct s a); int h(struct s *p) { return p->x; }",
+		[]string{
+			"1:22: returning struct s by value is not supported",
+			"1:42: passing struct s by value is not supported",
+		}},
+	{"int a = 1; int b = a; int c = b + 1; int d = f(); int f(); int *p = &a; int e = 1 / 0;",
+		[]string{
+			"1:20: initializer element is not constant",
+			"1:31: initializer element is not constant",
+			"1:46: undefined identifier 'f'",
+			"1:69: initializer element is not constant",
+			"1:81: initializer element is not constant",
+		}},
+	{"int a; double a; int main; int main() { return x; } int x[2] = 0; int *p = 1;",
+		[]string{
+			"1:8: redefinition of 'a' (previously declared at 1:1)",
+			"1:28: redefinition of 'main' (previously declared at 1:18)",
+			"1:48: cannot convert a value of type int * to int",
+			"1:64: invalid initializer for array 'x'",
+			"1:76: cannot convert a value of type int to int *",
+		}},
+	{"struct s { int a[sizeof(struct s)]; };",
+		[]string{"1:18: invalid application of 'sizeof' to incomplete type struct s"}},
+	{"int f(); int main() { return sizeof f + sizeof(x) + sizeof(struct t); }",
+		[]string{
+			"1:37: cannot use function 'f' as a value",
+			"1:48: undefined identifier 'x'",
+			"1:60: undefined struct 't'",
+		}},
+	{"int main() { return sizeof(int [0]) + sizeof(double [2][]) + sizeof(int [main()]); }",
+		[]string{
+			"1:33: size of unnamed array is not positive",
+			"1:46: array size missing in type name",
+			"1:74: size of unnamed array is not an integer constant",
+		}},
+	{"struct s { int a; }; struct s g; int main() { int *p; double d; return (int [2])p + (struct s)g + (double)p + *(int *)d + (int)g + (float)main; }",
+		[]string{
+			"1:72: cast specifies array type",
+			"1:85: conversion to non-scalar type requested",
+			"1:99: invalid cast from int * to double",
+			"1:112: invalid cast from double to int *",
+			"1:128: used struct type value where scalar is required",
+			"1:139: cannot use function 'main' as a value",
+		}},
+	{"int h; int g = (int)h; int *p = (int *)1; struct s { int a; }; int main() { return (struct t *)0 + (int)x; }",
+		[]string{
+			"1:16: initializer element is not constant",
+			"1:33: initializer element is not constant",
+			"1:85: undefined struct 't'",
+			"1:105: undefined identifier 'x'",
+		}},
+	{"enum e { A, B, A }; enum e { C = A }; enum { D = 1.5, E = F, F }; enum g x; int main() { A = 1; return &B; }",
+		[]string{
+			"1:16: redefinition of 'A' (previously declared at 1:10)",
+			"1:21: redefinition of 'enum e' (previously declared at 1:1)",
+			"1:50: enumerator value for 'D' is not an integer constant",
+			"1:59: undefined identifier 'F'",
+			"1:67: undefined enum 'g'",
+			"1:90: expression is not assignable",
+			"1:104: lvalue required as unary '&' operand",
+		}},
+	{"enum { f, g = 2147483647, h }; int f(); int main() { switch (0) { case g: case 2147483647: break; } }",
+		[]string{
+			"1:27: overflow in enumeration values",
+			"1:32: redefinition of 'f' (previously declared at 1:8)",
+			"1:75: duplicate case value '2147483647' (previously used at 1:67)",
+		}},
+	{"typedef int T; typedef struct t U; typedef int A[0]; typedef T T; int T; int main() { return T; }",
+		[]string{
+			"1:16: undefined struct 't'",
+			"1:50: size of array 'A' is not positive",
+			"1:54: redefinition of 'T' (previously declared at 1:1)",
+			"1:67: redefinition of 'T' (previously declared at 1:1)",
+			"1:94: cannot use typedef 'T' as a value",
+		}},
+	{"int main() { goto a; a: b: a: goto c; } int f() { goto b; }",
+		[]string{
+			"1:28: redefinition of label 'a' (previously declared at 1:22)",
+			"1:36: use of undeclared label 'c'",
+			"1:56: use of undeclared label 'b'",
+		}},
+	{"int main() { return 9223372036854775808 + 0x8000000000000000 + 4294967296u; }",
+		[]string{
+			"1:21: integer literal 9223372036854775808 is too large for its type",
+		}},
+	{"extern int a; long a; extern int b = 1; int b; int main() { extern int c; return c; }",
+		[]string{
+			"1:15: conflicting types for 'a' (previously declared at 1:1)",
+			"1:41: redefinition of 'b' (previously declared at 1:23)",
+			"1:61: storage class 'extern' of local variable 'c' is not supported",
+		}},
+	{"int n; static int n; extern int f(); static int f() { return 0; }",
+		[]string{
+			"1:8: redefinition of 'n' (previously declared at 1:1)",
+			"1:38: static declaration of 'f' follows non-static declaration (previously declared at 1:22)",
+		}},
+	{"extern int n; static int n;",
+		[]string{
+			"1:15: static declaration of 'n' follows non-static declaration (previously declared at 1:1)",
+		}},
+	{"int main() { int a; int a; return b + c; }",
+		[]string{
+			"1:21: redefinition of 'a' (previously declared at 1:14)",
+			"1:35: undefined identifier 'b'",
+			"1:39: undefined identifier 'c'",
+		}},
+}
+
+func TestInvalidPrograms(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range invalidPrograms {
+		_, err := check(t, test.input)
+		if !assert.IsType(ErrorList{}, err, test.input) {
+			continue
+		}
+		var messages []string
+		for _, e := range err.(ErrorList) {
+			messages = append(messages, e.Error())
+		}
+		assert.Equal(test.errors, messages, test.input)
+	}
+}
+
+func TestErrorListError(t *testing.T) {
+	assert := assert.New(t)
+	_, err := check(t, "int main() { return a + b; }")
+	assert.EqualError(err,
+		"1:21: undefined identifier 'a'\n1:25: undefined identifier 'b'")
+}
+
+func TestErrorDiagnostic(t *testing.T) {
+	assert := assert.New(t)
+	_, err := check(t, "int main() { return abc + 1.5 % 2; }")
+	if assert.IsType(ErrorList{}, err) {
+		errors := err.(ErrorList)
+		assert.Len(errors, 2)
+		// The extent of an identifier is known.
+		assert.Equal(&diag.Diagnostic{
+			Severity: diag.Error,
+			Pos:      token.Position{Offset: 20, Line: 1, Column: 21},
+			Length:   3,
+			Msg:      "undefined identifier 'abc'",
+			Code:     "semantic",
+		}, errors[0].Diagnostic())
+		assert.Equal(0, errors[1].Diagnostic().Length)
+	}
+}
+
+func TestCheckAnnotatesSymbols(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "int main() { int a = 1; { int a = 2; a = 3; } return a; }")
+	assert.Nil(err)
+
+	main := program.Functions[0]
+	assert.Equal(ast.FunctionSymbol, main.Symbol.Kind)
+	assert.Equal("main", main.Symbol.Name)
+	assert.Equal(main, main.Symbol.Decl)
+
+	outer := main.Body[0].(*ast.VariableDeclaration)
+	assert.Equal(ast.VariableSymbol, outer.Symbol.Kind)
+	assert.Equal(outer, outer.Symbol.Decl)
+
+	block := main.Body[1].(*ast.Block)
+	inner := block.Statements[0].(*ast.VariableDeclaration)
+	assignment := block.Statements[1].(*ast.ExpressionStatement).
+		Expression.(*ast.Assignment)
+	assert.True(inner.Symbol == assignment.Lhs.(*ast.Identifier).Symbol)
+
+	ret := main.Body[2].(*ast.ReturnStatement)
+	assert.True(outer.Symbol == ret.Value.(*ast.Identifier).Symbol)
+	assert.False(outer.Symbol == inner.Symbol)
+}
+
+func TestCheckResolvesJumpTargets(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int main() {
+  while (1) {
+    for (;;) { if (1) break; }
+    continue;
+  }
+}`)
+	assert.Nil(err)
+	outer := program.Functions[0].Body[0].(*ast.WhileStatement)
+	body := outer.Body.(*ast.Block)
+	// A break exits the innermost loop.
+	inner := body.Statements[0].(*ast.ForStatement)
+	brk := inner.Body.(*ast.Block).Statements[0].(*ast.IfStatement).Then
+	assert.True(brk.(*ast.BreakStatement).Target == inner)
+	assert.True(body.Statements[1].(*ast.ContinueStatement).Target == outer)
+}
+
+func TestCheckCollectsCases(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int main() {
+  for (;;)
+    switch (1) {
+    case 1 + 1:
+      { default: break; }
+    case -1:
+      continue;
+    }
+}`)
+	assert.Nil(err)
+	loop := program.Functions[0].Body[0].(*ast.ForStatement)
+	s := loop.Body.(*ast.SwitchStatement)
+	body := s.Body.(*ast.Block).Statements
+	if !assert.Len(s.Cases, 3) {
+		return
+	}
+	// Cases are collected in source order, with their values.
+	assert.True(s.Cases[0] == body[0])
+	assert.Equal(int64(2), s.Cases[0].Constant)
+	dflt := s.Cases[0].Body.(*ast.Block).Statements[0].(*ast.CaseStatement)
+	assert.True(s.Cases[1] == dflt)
+	assert.Nil(dflt.Value)
+	assert.Equal(int64(-1), s.Cases[2].Constant)
+	// A break exits the switch, but a continue applies to the loop.
+	assert.True(dflt.Body.(*ast.BreakStatement).Target == s)
+	assert.True(s.Cases[2].Body.(*ast.ContinueStatement).Target == loop)
+}
+
+func TestCheckAnnotatesFunctionSymbols(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int f(int);
+int main() { return f(1); }
+int f(int a) { return a; }`)
+	assert.Nil(err)
+
+	prototype, main, f := program.Functions[0], program.Functions[1], program.Functions[2]
+	// Every declaration of a function shares a symbol, which is declared by
+	// its definition.
+	assert.True(prototype.Symbol == f.Symbol)
+	assert.Equal(f, f.Symbol.Decl)
+	call := main.Body[0].(*ast.ReturnStatement).Value.(*ast.Call)
+	assert.True(f.Symbol == call.Function.Symbol)
+
+	a := f.Params[0]
+	assert.Equal(ast.VariableSymbol, a.Symbol.Kind)
+	assert.Equal(a, a.Symbol.Decl)
+	ret := f.Body[0].(*ast.ReturnStatement)
+	assert.True(a.Symbol == ret.Value.(*ast.Identifier).Symbol)
+	assert.Nil(prototype.Params[0].Symbol)
+}
+
+func TestCheckAnnotatesGlobalSymbols(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `extern int n;
+static double d;
+int main() { return n; }
+int n = 2;
+extern int n;
+extern double d;`)
+	assert.Nil(err)
+
+	first, d, n, last := program.Globals[0], program.Globals[1], program.Globals[2], program.Globals[3]
+	// Every declaration of a global shares a symbol, which is declared by its
+	// definition, and has the linkage of its first declaration.
+	assert.True(first.Symbol == n.Symbol && last.Symbol == n.Symbol)
+	assert.Equal(n, n.Symbol.Decl)
+	assert.False(n.Symbol.Static)
+	assert.True(d.Symbol == program.Globals[4].Symbol)
+	assert.True(d.Symbol.Static)
+	assert.False(first.IsDefinition())
+	assert.True(n.IsDefinition())
+	ret := program.Functions[0].Body[0].(*ast.ReturnStatement)
+	assert.True(n.Symbol == ret.Value.(*ast.Identifier).Symbol)
+}
+
+func TestRecordTypesAndSymbols(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		"int main() { double a = 1; return a; }")))
+	assert.NoError(err)
+	typeTable, symbolTable := ast.TypeTable{}, ast.SymbolTable{}
+	assert.NoError(Check(program, RecordTypes(typeTable), RecordSymbols(symbolTable)))
+	main := program.Functions[0]
+	decl := main.Body[0].(*ast.VariableDeclaration)
+	ret := main.Body[1].(*ast.ReturnStatement)
+	// The inserted conversions are numbered, and recorded.
+	conversion := decl.Init.(*ast.Conversion)
+	assert.NotEqual(ast.NodeID(0), conversion.ID())
+	assert.Equal(types.Double, typeTable.Of(conversion))
+	assert.Equal(types.Int, typeTable.Of(conversion.Operand))
+	assert.Equal(types.Int, typeTable.Of(ret.Value))
+	a := ret.Value.(*ast.Conversion).Operand
+	assert.Equal(types.Double, typeTable.Of(a))
+	assert.Equal(decl.Symbol, symbolTable.Of(a))
+	assert.Equal(decl.Symbol, symbolTable.Of(decl))
+	assert.Equal(main.Symbol, symbolTable.Of(main))
+	assert.Equal(3, len(symbolTable))
+}
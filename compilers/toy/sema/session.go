@@ -0,0 +1,133 @@
+package sema
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+)
+
+// A Session checks the input of an interactive interpreter, one enum,
+// typedef, struct, function or statement at a time. Enums, typedefs, structs
+// and functions are checked as they are in a program, and statements as
+// though each followed the statements before it in the body of a function.
+// The variables declared by statements are globals, which a function may use
+// if they were declared before it. A variable declared by a statement may be
+// redeclared by a later statement, which hides it, but not from the functions
+// which already use it. Input which is rejected does not change the session.
+type Session struct {
+	definitions *Scope // The enums, typedefs and structs declared so far.
+	variables   *Scope // The functions, and variables declared by statements, so far.
+}
+
+// NewSession returns a session in which nothing has been declared.
+func NewSession() *Session {
+	definitions := NewScope(nil)
+	return &Session{definitions: definitions, variables: NewScope(definitions)}
+}
+
+// CheckFunction checks a function definition or prototype. If the function
+// is invalid, the returned error is an ErrorList.
+func (s *Session) CheckFunction(f *ast.Function) error {
+	existing := s.variables.LookupLocal(f.Name.Value)
+	var decl ast.Node
+	if existing != nil {
+		decl = existing.Decl
+	}
+	c := &checker{scope: s.variables, layout: types.LP64}
+	c.program(&ast.Program{Functions: []*ast.Function{f}})
+	err := c.err()
+	if err != nil {
+		// Undo the declaration of the function.
+		if existing == nil {
+			delete(s.variables.symbols, f.Name.Value)
+		} else {
+			existing.Decl = decl
+		}
+	}
+	return err
+}
+
+// CheckStruct checks a struct definition. If the struct is invalid, the
+// returned error is an ErrorList.
+func (s *Session) CheckStruct(d *ast.StructDeclaration) error {
+	name := "struct " + d.Name.Value
+	existing := s.definitions.LookupLocal(name)
+	c := &checker{scope: s.definitions, layout: types.LP64}
+	c.program(&ast.Program{Structs: []*ast.StructDeclaration{d}})
+	err := c.err()
+	if err != nil && existing == nil {
+		// Undo the declaration of the struct.
+		delete(s.definitions.symbols, name)
+	}
+	return err
+}
+
+// CheckEnum checks an enum definition. If the enum is invalid, the returned
+// error is an ErrorList.
+func (s *Session) CheckEnum(d *ast.EnumDeclaration) error {
+	var names []string
+	if d.Name.Value != "" {
+		names = append(names, "enum "+d.Name.Value)
+	}
+	for _, e := range d.Enumerators {
+		names = append(names, e.Name.Value)
+	}
+	var added []string
+	for _, name := range names {
+		if s.definitions.LookupLocal(name) == nil {
+			added = append(added, name)
+		}
+	}
+	c := &checker{scope: s.definitions, layout: types.LP64}
+	c.program(&ast.Program{Enums: []*ast.EnumDeclaration{d}})
+	err := c.err()
+	if err != nil {
+		// Undo the declarations of the enum and its enumerators.
+		for _, name := range added {
+			delete(s.definitions.symbols, name)
+		}
+	}
+	return err
+}
+
+// CheckTypedef checks a typedef declaration. If it is invalid, the returned
+// error is an ErrorList.
+func (s *Session) CheckTypedef(d *ast.TypedefDeclaration) error {
+	existing := s.definitions.LookupLocal(d.Name.Value)
+	c := &checker{scope: s.definitions, layout: types.LP64}
+	c.program(&ast.Program{Typedefs: []*ast.TypedefDeclaration{d}})
+	err := c.err()
+	if err != nil && existing == nil {
+		// Undo the declaration of the typedef name.
+		delete(s.definitions.symbols, d.Name.Value)
+	}
+	return err
+}
+
+// IsTypedef returns whether a name is a typedef name which has been declared
+// so far, and is not hidden by a variable. It classifies the identifiers of
+// later input, by the parser.Typedefs option.
+func (s *Session) IsTypedef(name string) bool {
+	symbol := s.variables.Lookup(name)
+	return symbol != nil && symbol.Kind == ast.TypedefSymbol
+}
+
+// CheckStatement checks a statement. If it is invalid, the returned error is
+// an ErrorList.
+func (s *Session) CheckStatement(statement ast.Statement) error {
+	c := &checker{scope: NewScope(s.variables), layout: types.LP64}
+	c.resolveStatement(statement)
+	c.checkStatement(statement)
+	err := c.err()
+	if err == nil {
+		for name, symbol := range c.scope.symbols {
+			s.variables.symbols[name] = symbol
+		}
+	}
+	return err
+}
+
+// CheckExpression checks an expression, as though it were an expression
+// statement. If it is invalid, the returned error is an ErrorList.
+func (s *Session) CheckExpression(e ast.Expression) error {
+	return s.CheckStatement(&ast.ExpressionStatement{Expression: e})
+}
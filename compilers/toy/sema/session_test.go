@@ -0,0 +1,182 @@
+package sema
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// checkInput parses a line of input and checks each function and statement
+// of it in a session, returning the first error.
+func checkInput(t *testing.T, s *Session, input string) ([]ast.Node, error) {
+	nodes, err := parser.ParseInput(lexer.NewLexerTokenStream(lexer.Lex(input)),
+		parser.Typedefs(s.IsTypedef))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *ast.EnumDeclaration:
+			err = s.CheckEnum(n)
+		case *ast.TypedefDeclaration:
+			err = s.CheckTypedef(n)
+		case *ast.StructDeclaration:
+			err = s.CheckStruct(n)
+		case *ast.Function:
+			err = s.CheckFunction(n)
+		case ast.Statement:
+			err = s.CheckStatement(n)
+		case ast.Expression:
+			err = s.CheckExpression(n)
+		}
+		if err != nil {
+			return nodes, err
+		}
+	}
+	return nodes, nil
+}
+
+func TestSessionVariables(t *testing.T) {
+	assert := assert.New(t)
+	s := NewSession()
+	_, err := checkInput(t, s, "int a = 1;")
+	assert.NoError(err)
+	nodes, err := checkInput(t, s, "a + 2.5")
+	assert.NoError(err)
+	assert.Equal(types.Double, ast.TypeOf(nodes[0].(ast.Expression)))
+	// A variable may be redeclared.
+	_, err = checkInput(t, s, "double a = 2;")
+	assert.NoError(err)
+	nodes, err = checkInput(t, s, "a")
+	assert.NoError(err)
+	assert.Equal(types.Double, ast.TypeOf(nodes[0].(ast.Expression)))
+	// Variables declared in a block are not kept.
+	_, err = checkInput(t, s, "{ int b = 1; }")
+	assert.NoError(err)
+	_, err = checkInput(t, s, "b")
+	assert.EqualError(err, "1:1: undefined identifier 'b'")
+}
+
+func TestSessionRejectedStatement(t *testing.T) {
+	assert := assert.New(t)
+	s := NewSession()
+	_, err := checkInput(t, s, "int a = b;")
+	assert.EqualError(err, "1:9: undefined identifier 'b'")
+	_, err = checkInput(t, s, "a")
+	assert.EqualError(err, "1:1: undefined identifier 'a'")
+}
+
+func TestSessionFunctions(t *testing.T) {
+	assert := assert.New(t)
+	s := NewSession()
+	_, err := checkInput(t, s, "int f(int x);")
+	assert.NoError(err)
+	_, err = checkInput(t, s, "int g() { return f(1); }")
+	assert.NoError(err)
+	_, err = checkInput(t, s, "int f(int x) { return x + 1; } f(2)")
+	assert.NoError(err)
+	// Functions may not be redefined.
+	_, err = checkInput(t, s, "int f(int x) { return x; }")
+	assert.EqualError(err, "1:1: redefinition of 'f' (previously declared at 1:1)")
+	// Functions see the variables declared by statements before them.
+	_, err = checkInput(t, s, "int h() { return a; }")
+	assert.EqualError(err, "1:18: undefined identifier 'a'")
+	_, err = checkInput(t, s, "int a = 1; int h() { return a; }")
+	assert.NoError(err)
+	// A function may not have the name of a variable.
+	_, err = checkInput(t, s, "int a() { return 1; }")
+	assert.EqualError(err, "1:1: redefinition of 'a' (previously declared at 1:1)")
+	// Redeclaring the variable does not change the function which uses it.
+	nodes, err := checkInput(t, s, "double a = 2; h()")
+	assert.NoError(err)
+	assert.Equal(types.Int, ast.TypeOf(nodes[1].(ast.Expression)))
+}
+
+func TestSessionRejectedFunction(t *testing.T) {
+	assert := assert.New(t)
+	s := NewSession()
+	_, err := checkInput(t, s, "int f() { return x; }")
+	assert.Error(err)
+	// The rejected definition does not declare the function.
+	_, err = checkInput(t, s, "f()")
+	assert.EqualError(err, "1:1: undefined identifier 'f'")
+	_, err = checkInput(t, s, "int f(); int f() { return x; }")
+	assert.Error(err)
+	// Nor define a declared function.
+	_, err = checkInput(t, s, "int f() { return 1; }")
+	assert.NoError(err)
+}
+
+func TestSessionStructs(t *testing.T) {
+	assert := assert.New(t)
+	s := NewSession()
+	_, err := checkInput(t, s, "struct s { struct t *p; };")
+	assert.EqualError(err, "1:12: undefined struct 't'")
+	// The rejected definition does not declare the struct.
+	_, err = checkInput(t, s, "struct s a;")
+	assert.EqualError(err, "1:1: undefined struct 's'")
+	_, err = checkInput(t, s, "struct s { int x; }; struct s a; a.x = 2; int f(struct s *p) { return p->x; }")
+	assert.NoError(err)
+	_, err = checkInput(t, s, "f(&a) == 2")
+	assert.NoError(err)
+	_, err = checkInput(t, s, "struct s { int y; };")
+	assert.EqualError(err, "1:1: redefinition of 'struct s' (previously declared at 1:1)")
+}
+
+func TestSessionEnums(t *testing.T) {
+	assert := assert.New(t)
+	s := NewSession()
+	_, err := checkInput(t, s, "enum e { A, B = x };")
+	assert.EqualError(err, "1:17: undefined identifier 'x'")
+	// The rejected definition declares neither the enum nor its enumerators.
+	_, err = checkInput(t, s, "enum e { A, B }; enum e c = B; c + A")
+	assert.NoError(err)
+	_, err = checkInput(t, s, "enum { C = B + 1, A };")
+	assert.EqualError(err, "1:19: redefinition of 'A' (previously declared at 1:10)")
+	_, err = checkInput(t, s, "C")
+	assert.EqualError(err, "1:1: undefined identifier 'C'")
+}
+
+func TestSessionTypedefs(t *testing.T) {
+	assert := assert.New(t)
+	s := NewSession()
+	_, err := checkInput(t, s, "typedef struct t T;")
+	assert.EqualError(err, "1:1: undefined struct 't'")
+	// The rejected declaration does not declare the typedef name.
+	assert.False(s.IsTypedef("T"))
+	_, err = checkInput(t, s, "typedef int T; T * p; T x = 2; p = &x; *p")
+	assert.NoError(err)
+	assert.True(s.IsTypedef("T"))
+	// A variable hides the typedef name.
+	_, err = checkInput(t, s, "int T = 3; T * x")
+	assert.NoError(err)
+	assert.False(s.IsTypedef("T"))
+	assert.False(s.IsTypedef("x"))
+}
+
+func TestSessionUnknownTypeName(t *testing.T) {
+	assert := assert.New(t)
+	// A parser may classify an identifier as a typedef name which has not
+	// been declared.
+	nodes, err := parser.ParseInput(lexer.NewLexerTokenStream(lexer.Lex("T x;")),
+		parser.Typedefs(func(string) bool { return true }))
+	if assert.NoError(err) {
+		assert.EqualError(NewSession().CheckStatement(nodes[0].(ast.Statement)),
+			"1:1: unknown type name 'T'")
+	}
+}
+
+func TestSessionReturn(t *testing.T) {
+	assert := assert.New(t)
+	_, err := checkInput(t, NewSession(), "return 1;")
+	assert.EqualError(err, "1:1: return statement not within a function")
+	_, err = checkInput(t, NewSession(), "break;")
+	assert.EqualError(err, "1:1: break statement not within a loop or switch")
+	_, err = checkInput(t, NewSession(), "goto a;")
+	assert.EqualError(err, "1:1: goto statement not within a function")
+	_, err = checkInput(t, NewSession(), "a: 1;")
+	assert.EqualError(err, "1:1: label 'a' not within a function")
+}
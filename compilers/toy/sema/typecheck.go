@@ -0,0 +1,812 @@
+package sema
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/consteval"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"strings"
+)
+
+// Type checking runs after identifiers have been resolved. It annotates every
+// expression with its type, and wraps operands in implicit conversions
+// wherever C would convert them: to a common type for arithmetic and
+// comparisons, and to the target type for assignments, initializers, and
+// return values. An array whose value is used is converted to a pointer to its
+// first element. It also checks that the operands of assignments and of '&'
+// are lvalues, which designate objects in memory, rather than rvalues.
+//
+// A struct is only accessed through its fields, or through a pointer to it:
+// structs may not be assigned, compared, or passed to or returned from
+// functions.
+//
+// An expression whose type cannot be determined has a nil type. The error has
+// already been reported, so nil types are accepted silently to avoid a
+// cascade of errors.
+
+// checkFunction type checks the body of a function.
+func (c *checker) checkFunction(f *ast.Function) {
+	if f.Prototype {
+		return
+	}
+	c.function = f
+	c.checkStatements(f.Body)
+}
+
+// checkGlobal type checks the declaration of a global variable. Its
+// initializer is stored in the data of the program rather than computed at
+// run time, so it must be constant.
+func (c *checker) checkGlobal(d *ast.VariableDeclaration) {
+	errors := len(c.errors)
+	c.checkStatement(d)
+	if d.Init == nil || len(c.errors) > errors || ast.TypeOf(d.Init) == nil {
+		return
+	}
+	f, i, ok := consteval.Initializer(d.Init)
+	if !ok {
+		c.errorf(d.Init, "initializer element is not constant")
+		return
+	}
+	d.Constant, d.IntConstant = f, i
+}
+
+func (c *checker) checkStatements(statements []ast.Statement) {
+	for _, s := range statements {
+		c.checkStatement(s)
+	}
+}
+
+func (c *checker) checkStatement(s ast.Statement) {
+	switch n := s.(type) {
+	case *ast.ReturnStatement:
+		n.Value = c.rvalue(n.Value)
+		if c.function == nil {
+			c.errorf(n, "return statement not within a function")
+			return
+		}
+		n.Value = c.convert(n.Value,
+			c.function.Symbol.Type.(*types.Function).Result)
+	case *ast.ExpressionStatement:
+		n.Expression = c.scalar(n.Expression)
+	case *ast.VariableDeclaration:
+		if n.Init != nil {
+			n.Init = c.rvalue(n.Init)
+			if types.IsArray(n.Symbol.Type) {
+				c.errorf(n.Init, "invalid initializer for array '%s'", n.Name.Value)
+				return
+			}
+			if types.IsStruct(n.Symbol.Type) {
+				c.errorf(n.Init, "initialization of struct '%s' is not supported",
+					n.Name.Value)
+				return
+			}
+			n.Init = c.convert(n.Init, n.Symbol.Type)
+		}
+	case *ast.Block:
+		c.checkStatements(n.Statements)
+	case *ast.IfStatement:
+		// Like the operands of logical operators, conditions are compared
+		// against zero, so are not converted.
+		n.Cond = c.scalar(n.Cond)
+		c.checkStatement(n.Then)
+		if n.Else != nil {
+			c.checkStatement(n.Else)
+		}
+	case *ast.WhileStatement:
+		n.Cond = c.scalar(n.Cond)
+		c.checkStatement(n.Body)
+	case *ast.DoWhileStatement:
+		c.checkStatement(n.Body)
+		n.Cond = c.scalar(n.Cond)
+	case *ast.ForStatement:
+		if n.Init != nil {
+			c.checkStatement(n.Init)
+		}
+		if n.Cond != nil {
+			n.Cond = c.scalar(n.Cond)
+		}
+		if n.Post != nil {
+			n.Post = c.scalar(n.Post)
+		}
+		c.checkStatement(n.Body)
+	case *ast.SwitchStatement:
+		n.Value = c.rvalue(n.Value)
+		if t := ast.TypeOf(n.Value); t != nil && !types.IsInteger(t) {
+			c.errorf(n.Value, "switch quantity not an integer")
+		} else {
+			n.Value = c.convert(n.Value, promote(t))
+		}
+		c.checkStatement(n.Body)
+		c.checkCases(n)
+	case *ast.CaseStatement:
+		if n.Value != nil {
+			n.Value = c.rvalue(n.Value)
+		}
+		c.checkStatement(n.Body)
+	case *ast.LabeledStatement:
+		c.checkStatement(n.Body)
+	case *ast.BreakStatement, *ast.ContinueStatement, *ast.GotoStatement:
+	default:
+		panic(fmt.Sprintf("unhandled statement type %T", s))
+	}
+}
+
+// checkCases evaluates the case labels of a switch, each of which must have a
+// distinct constant value, and checks that it has at most one default label.
+func (c *checker) checkCases(s *ast.SwitchStatement) {
+	seen := make(map[int64]*ast.CaseStatement)
+	var def *ast.CaseStatement
+	for _, cs := range s.Cases {
+		if cs.Value == nil {
+			if def != nil {
+				c.errorf(cs, "multiple default labels in one switch (previously used at %v)",
+					def.Pos())
+			} else {
+				def = cs
+			}
+			continue
+		}
+		v, ok := consteval.Int(cs.Value)
+		if !ok {
+			if ast.TypeOf(cs.Value) != nil {
+				c.errorf(cs.Value, "case label does not reduce to an integer constant")
+			}
+			continue
+		}
+		// The value is converted to the promoted type of the switch.
+		if t := ast.TypeOf(s.Value); types.IsInteger(t) {
+			v = consteval.Convert(v, t)
+		}
+		cs.Constant = v
+		if prior, ok := seen[cs.Constant]; ok {
+			c.errorf(cs, "duplicate case value '%d' (previously used at %v)", v,
+				prior.Pos())
+			continue
+		}
+		seen[cs.Constant] = cs
+	}
+}
+
+// checkExpression sets the type of an expression and its operands.
+func (c *checker) checkExpression(e ast.Expression) {
+	switch n := e.(type) {
+	case *ast.IntLiteral:
+		n.Type = literalType(n)
+		if n.Type == nil {
+			c.errorf(n, "integer literal %s is too large for its type", n.Token.Value)
+		}
+	case *ast.FloatLiteral:
+		n.Type = types.Double
+		if strings.ContainsAny(n.Token.Value, "fF") {
+			n.Type = types.Float
+		}
+	case *ast.StringLiteral:
+		n.Type = types.NewArray(types.Char, int64(len(n.Value))+1)
+	case *ast.Identifier:
+		n.Type = c.checkIdentifier(n)
+	case *ast.UnaryOp:
+		n.Type = c.checkUnaryOp(n)
+		c.checkOverflow(n, n.Operator.Type, n.Operand)
+	case *ast.BinaryOp:
+		n.Type = c.checkBinaryOp(n)
+		c.checkOverflow(n, n.Operator.Type, n.Lhs, n.Rhs)
+	case *ast.Assignment:
+		n.Type = c.checkAssignment(n)
+	case *ast.CompoundAssignment:
+		n.Type = c.checkCompoundAssignment(n)
+	case *ast.IncDecOp:
+		n.Type = c.checkIncDecOp(n)
+	case *ast.ConditionalExpression:
+		n.Type = c.checkConditional(n)
+	case *ast.Call:
+		n.Type = c.checkCall(n)
+	case *ast.Subscript:
+		n.Type = c.checkSubscript(n)
+	case *ast.Member:
+		n.Type = c.checkMember(n)
+	case *ast.Sizeof:
+		n.Type = c.checkSizeof(n)
+	case *ast.Conversion:
+		if n.TypeName == nil {
+			c.checkExpression(n.Operand)
+			break
+		}
+		n.Type = c.checkCast(n)
+	default:
+		panic(fmt.Sprintf("unhandled expression type %T", e))
+	}
+}
+
+// rvalue checks an expression whose value is used, and returns it. An array
+// is converted to a pointer to its first element.
+func (c *checker) rvalue(e ast.Expression) ast.Expression {
+	c.checkExpression(e)
+	if a, ok := ast.TypeOf(e).(*types.Array); ok {
+		return &ast.Conversion{Operand: e, Type: types.NewPointer(a.Elem),
+			Implicit: true}
+	}
+	return e
+}
+
+// scalar checks an expression whose value is compared against zero, or
+// discarded, and returns it. Unlike that of a scalar, the value of a struct
+// cannot be tested or discarded.
+func (c *checker) scalar(e ast.Expression) ast.Expression {
+	e = c.rvalue(e)
+	c.checkScalar(e)
+	return e
+}
+
+// checkScalar reports an error if an expression is a struct, and returns
+// whether it is not.
+func (c *checker) checkScalar(e ast.Expression) bool {
+	if types.IsStruct(ast.TypeOf(e)) {
+		c.errorf(e, "used struct type value where scalar is required")
+		return false
+	}
+	return true
+}
+
+// checkIdentifier returns the type of the variable or enumerator that an
+// identifier names.
+func (c *checker) checkIdentifier(i *ast.Identifier) types.Type {
+	if i.Symbol == nil {
+		return nil
+	}
+	if i.Symbol.Kind != ast.VariableSymbol && i.Symbol.Kind != ast.EnumeratorSymbol {
+		c.errorf(i, "cannot use %s '%s' as a value", i.Symbol.Kind,
+			i.Token.Value)
+		return nil
+	}
+	return i.Symbol.Type
+}
+
+// checkCall checks the arguments of a call against the parameters of the
+// function, converting each to the type of its parameter, and returns the
+// result type of the function. The arguments which follow the parameters of a
+// variadic function undergo the default argument promotions: a float is
+// converted to a double, and a char to an int.
+func (c *checker) checkCall(call *ast.Call) types.Type {
+	for i := range call.Args {
+		call.Args[i] = c.rvalue(call.Args[i])
+	}
+	name := call.Function.Token.Value
+	if call.Function.Symbol == nil {
+		return nil
+	}
+	f, ok := call.Function.Symbol.Type.(*types.Function)
+	if !ok {
+		c.errorf(call.Function, "called object '%s' is not a function", name)
+		return nil
+	}
+	call.Function.Type = f
+	if len(call.Args) < len(f.Params) && f.Variadic {
+		c.errorf(call, "too few arguments to function '%s' (expected at least %d, found %d)",
+			name, len(f.Params), len(call.Args))
+		return f.Result
+	}
+	if len(call.Args) != len(f.Params) && !f.Variadic {
+		quantity := "few"
+		if len(call.Args) > len(f.Params) {
+			quantity = "many"
+		}
+		c.errorf(call, "too %s arguments to function '%s' (expected %d, found %d)",
+			quantity, name, len(f.Params), len(call.Args))
+		return f.Result
+	}
+	for i := range call.Args {
+		if i < len(f.Params) {
+			call.Args[i] = c.convert(call.Args[i], f.Params[i])
+			continue
+		}
+		t := ast.TypeOf(call.Args[i])
+		if t == types.Float {
+			t = types.Double
+		}
+		if c.checkScalar(call.Args[i]) {
+			call.Args[i] = c.convert(call.Args[i], promote(t))
+		}
+	}
+	return f.Result
+}
+
+func (c *checker) checkUnaryOp(u *ast.UnaryOp) types.Type {
+	// The operand of '&' designates an object, so an array is not converted.
+	if u.Operator.Type == token.BitwiseAndToken {
+		c.checkExpression(u.Operand)
+	} else {
+		u.Operand = c.rvalue(u.Operand)
+	}
+	t := ast.TypeOf(u.Operand)
+	if t == nil {
+		return nil
+	}
+	switch u.Operator.Type {
+	case token.LogicalNegationToken:
+		if !c.checkScalar(u.Operand) {
+			return nil
+		}
+		return types.Int
+	case token.BitwiseAndToken:
+		return c.checkAddressOf(u, t)
+	case token.MultiplicationToken:
+		p, ok := t.(*types.Pointer)
+		if !ok {
+			c.errorf(u, "invalid type argument of unary '*' (have %v)", t)
+			return nil
+		}
+		return p.Elem
+	case token.BitwiseComplementToken:
+		if !types.IsInteger(t) {
+			c.errorf(u, "invalid operand of type %v to '%s'", t, u.Operator.Value)
+			return nil
+		}
+	case token.NegationToken:
+		if !types.IsArithmetic(t) {
+			c.errorf(u, "invalid operand of type %v to '%s'", t, u.Operator.Value)
+			return nil
+		}
+	}
+	u.Operand = c.convert(u.Operand, promote(t))
+	return promote(t)
+}
+
+// checkSizeof computes the size of the type of the operand of sizeof, or of
+// its type name, which must be complete. The operand is not evaluated, so an
+// array is not converted to a pointer.
+func (c *checker) checkSizeof(s *ast.Sizeof) types.Type {
+	if s.Operand != nil {
+		c.checkExpression(s.Operand)
+		s.Of = ast.TypeOf(s.Operand)
+	}
+	if s.Of == nil {
+		return nil
+	}
+	if st, ok := s.Of.(*types.Struct); ok && !st.Complete {
+		c.errorf(s, "invalid application of 'sizeof' to incomplete type %v", s.Of)
+		return nil
+	}
+	s.Value = int64(c.layout.Sizeof(s.Of))
+	return types.Int
+}
+
+// checkCast returns the type of a cast, which must be scalar, as must its
+// operand. Arithmetic values convert to each other, and pointers to other
+// pointers and to and from integers.
+func (c *checker) checkCast(n *ast.Conversion) types.Type {
+	n.Operand = c.rvalue(n.Operand)
+	from, to := ast.TypeOf(n.Operand), n.Type
+	if from == nil || to == nil {
+		return nil
+	}
+	switch {
+	case types.IsArray(to):
+		c.errorf(n, "cast specifies array type")
+	case types.IsStruct(to):
+		c.errorf(n, "conversion to non-scalar type requested")
+	case !c.checkScalar(n.Operand):
+	case types.IsArithmetic(from) && types.IsArithmetic(to),
+		types.IsPointer(from) && (types.IsPointer(to) || types.IsInteger(to)),
+		types.IsInteger(from) && types.IsPointer(to):
+		return to
+	default:
+		c.errorf(n, "invalid cast from %v to %v", from, to)
+	}
+	return nil
+}
+
+// checkAddressOf returns the type of a pointer to the operand of '&', which
+// must be an lvalue. A variable whose address is taken is marked, since it
+// must be kept in memory.
+func (c *checker) checkAddressOf(u *ast.UnaryOp, t types.Type) types.Type {
+	if !isLvalue(u.Operand) {
+		c.errorf(u, "lvalue required as unary '&' operand")
+		return nil
+	}
+	if i, ok := u.Operand.(*ast.Identifier); ok {
+		i.Symbol.AddressTaken = true
+	}
+	return types.NewPointer(t)
+}
+
+// checkSubscript returns the type of the element that a subscript designates.
+// Like the operands of '+', which the subscript is equivalent to, one operand
+// must be a pointer, and the other an integer.
+func (c *checker) checkSubscript(s *ast.Subscript) types.Type {
+	s.Array = c.rvalue(s.Array)
+	s.Index = c.rvalue(s.Index)
+	array, index := ast.TypeOf(s.Array), ast.TypeOf(s.Index)
+	if array == nil || index == nil {
+		return nil
+	}
+	if types.IsInteger(array) {
+		array, index = index, array
+	}
+	p, ok := array.(*types.Pointer)
+	if !ok {
+		c.errorf(s, "subscripted value is neither array nor pointer")
+		return nil
+	}
+	if !types.IsInteger(index) {
+		c.errorf(s.Index, "array subscript is not an integer")
+		return nil
+	}
+	return p.Elem
+}
+
+// checkMember returns the type of the field that a member access designates.
+// The operand of '.' designates a struct, so is not converted, and that of
+// "->" is a pointer to a struct.
+func (c *checker) checkMember(m *ast.Member) types.Type {
+	var t types.Type
+	if m.Operator.Type == token.ArrowToken {
+		m.X = c.rvalue(m.X)
+		t = ast.TypeOf(m.X)
+		if t == nil {
+			return nil
+		}
+		p, ok := t.(*types.Pointer)
+		if !ok || !types.IsStruct(p.Elem) {
+			c.errorf(m, "invalid type argument of '->' (have %v)", t)
+			return nil
+		}
+		t = p.Elem
+	} else {
+		c.checkExpression(m.X)
+		t = ast.TypeOf(m.X)
+		if t == nil {
+			return nil
+		}
+		if !types.IsStruct(t) {
+			c.errorf(m, "request for member '%s' in something not a structure",
+				m.Name.Value)
+			return nil
+		}
+	}
+	s := t.(*types.Struct)
+	_, f := s.Field(m.Name.Value)
+	if f == nil {
+		c.errorf(&ast.Identifier{Token: m.Name}, "'%v' has no member named '%s'",
+			s, m.Name.Value)
+		return nil
+	}
+	return f.Type
+}
+
+// isLvalue returns whether an expression designates an object: a variable, an
+// element of an array, a field of a struct which is an lvalue or is pointed
+// to, the target of a pointer, or a string literal.
+func isLvalue(e ast.Expression) bool {
+	switch n := e.(type) {
+	case *ast.Identifier:
+		// An enumerator is a constant rather than an object.
+		return n.Symbol == nil || n.Symbol.Kind != ast.EnumeratorSymbol
+	case *ast.Subscript, *ast.StringLiteral:
+		return true
+	case *ast.Member:
+		return n.Operator.Type == token.ArrowToken || isLvalue(n.X)
+	case *ast.UnaryOp:
+		return n.Operator.Type == token.MultiplicationToken
+	}
+	return false
+}
+
+func (c *checker) checkBinaryOp(b *ast.BinaryOp) types.Type {
+	b.Lhs = c.rvalue(b.Lhs)
+	b.Rhs = c.rvalue(b.Rhs)
+	lhs, rhs := ast.TypeOf(b.Lhs), ast.TypeOf(b.Rhs)
+	if lhs == nil || rhs == nil {
+		return nil
+	}
+	switch b.Operator.Type {
+	case token.AndToken, token.OrToken:
+		// The operands of logical operators are each compared against zero, so
+		// are not converted to a common type.
+		if !c.checkScalar(b.Lhs) || !c.checkScalar(b.Rhs) {
+			return nil
+		}
+		return types.Int
+	}
+	if types.IsPointer(lhs) || types.IsPointer(rhs) {
+		return c.checkPointerOp(b, lhs, rhs)
+	}
+
+	if !types.IsArithmetic(lhs) || !types.IsArithmetic(rhs) ||
+		integerOperators[b.Operator.Type] &&
+			(!types.IsInteger(lhs) || !types.IsInteger(rhs)) {
+		c.errorf(b, "invalid operands of types %v and %v to '%s'", lhs, rhs,
+			b.Operator.Value)
+		return nil
+	}
+	if isShift(b.Operator.Type) {
+		// The operands of a shift are promoted separately, and the result
+		// has the type of the left operand.
+		b.Lhs = c.convert(b.Lhs, promote(lhs))
+		b.Rhs = c.convert(b.Rhs, promote(rhs))
+		return promote(lhs)
+	}
+	t := commonType(lhs, rhs)
+	b.Lhs = c.convert(b.Lhs, t)
+	b.Rhs = c.convert(b.Rhs, t)
+	switch b.Operator.Type {
+	case token.EqualToken, token.NotEqualToken, token.LessThanToken,
+		token.LessThanOrEqualToken, token.GreaterThanToken,
+		token.GreaterThanOrEqualToken:
+		return types.Int
+	}
+	return t
+}
+
+// checkPointerOp checks a binary operator with a pointer operand. A pointer
+// may be offset by an integer, or subtracted from or compared with a pointer
+// of the same type. It may also be compared for equality with a null pointer
+// constant, which is converted to the type of the pointer. Offsets and
+// differences are in units of the type pointed to.
+func (c *checker) checkPointerOp(b *ast.BinaryOp, lhs, rhs types.Type) types.Type {
+	switch b.Operator.Type {
+	case token.AdditionToken:
+		if types.IsPointer(lhs) && types.IsInteger(rhs) {
+			return lhs
+		}
+		if types.IsInteger(lhs) && types.IsPointer(rhs) {
+			return rhs
+		}
+	case token.NegationToken:
+		if types.IsPointer(lhs) && types.IsInteger(rhs) {
+			return lhs
+		}
+		if lhs == rhs {
+			return types.Int
+		}
+	case token.EqualToken, token.NotEqualToken:
+		if consteval.IsNullPointerConstant(b.Lhs) {
+			b.Lhs = c.convert(b.Lhs, rhs)
+			return types.Int
+		}
+		if consteval.IsNullPointerConstant(b.Rhs) {
+			b.Rhs = c.convert(b.Rhs, lhs)
+			return types.Int
+		}
+		fallthrough
+	case token.LessThanToken, token.LessThanOrEqualToken,
+		token.GreaterThanToken, token.GreaterThanOrEqualToken:
+		if lhs == rhs {
+			return types.Int
+		}
+	}
+	c.errorf(b, "invalid operands of types %v and %v to '%s'", lhs, rhs,
+		b.Operator.Value)
+	return nil
+}
+
+// checkConditional converts the operands of a conditional expression to their
+// common type, which is the type of the result. Pointer operands must have the
+// same type, unless one is a null pointer constant. Like the condition of an
+// if statement, the condition is compared against zero, so is not converted.
+func (c *checker) checkConditional(e *ast.ConditionalExpression) types.Type {
+	e.Cond = c.scalar(e.Cond)
+	e.Then = c.rvalue(e.Then)
+	e.Else = c.rvalue(e.Else)
+	then, els := ast.TypeOf(e.Then), ast.TypeOf(e.Else)
+	if ast.TypeOf(e.Cond) == nil || then == nil || els == nil ||
+		!c.checkScalar(e.Then) || !c.checkScalar(e.Else) {
+		return nil
+	}
+	var t types.Type
+	switch {
+	case types.IsPointer(then) && consteval.IsNullPointerConstant(e.Else):
+		t = then
+	case types.IsPointer(els) && consteval.IsNullPointerConstant(e.Then):
+		t = els
+	case types.IsPointer(then) || types.IsPointer(els):
+		if then != els {
+			c.errorf(e, "type mismatch in conditional expression (%v and %v)",
+				then, els)
+			return nil
+		}
+		t = then
+	default:
+		t = commonType(then, els)
+	}
+	e.Then = c.convert(e.Then, t)
+	e.Else = c.convert(e.Else, t)
+	return t
+}
+
+func (c *checker) checkAssignment(a *ast.Assignment) types.Type {
+	c.checkExpression(a.Lhs)
+	a.Rhs = c.rvalue(a.Rhs)
+	if !c.checkAssignable(a.Lhs) {
+		return nil
+	}
+	t := ast.TypeOf(a.Lhs)
+	a.Rhs = c.convert(a.Rhs, t)
+	return t
+}
+
+// The operators whose operands must be integers.
+var integerOperators = map[token.TokenType]bool{
+	token.ModuloToken:               true,
+	token.BitwiseAndToken:           true,
+	token.BitwiseOrToken:            true,
+	token.BitwiseXorToken:           true,
+	token.ShiftLeftToken:            true,
+	token.ShiftRightToken:           true,
+	token.ModuloAssignmentToken:     true,
+	token.ShiftLeftAssignmentToken:  true,
+	token.ShiftRightAssignmentToken: true,
+	token.BitwiseAndAssignmentToken: true,
+	token.BitwiseOrAssignmentToken:  true,
+	token.BitwiseXorAssignmentToken: true,
+}
+
+// checkCompoundAssignment converts the right operand of a compound assignment
+// to the common type of its operands, in which the operator is computed. The
+// result is converted back to the type of the lvalue. A pointer may only be
+// offset by an integer, with += or -=.
+func (c *checker) checkCompoundAssignment(a *ast.CompoundAssignment) types.Type {
+	c.checkExpression(a.Lhs)
+	a.Rhs = c.rvalue(a.Rhs)
+	if !c.checkAssignable(a.Lhs) {
+		return nil
+	}
+	lhs, rhs := ast.TypeOf(a.Lhs), ast.TypeOf(a.Rhs)
+	if lhs == nil || rhs == nil {
+		return lhs
+	}
+	if integerOperators[a.Operator.Type] &&
+		(!types.IsInteger(lhs) || !types.IsInteger(rhs)) {
+		c.errorf(a, "invalid operands of types %v and %v to '%s'", lhs, rhs,
+			a.Operator.Value)
+		return lhs
+	}
+	if types.IsPointer(lhs) || types.IsPointer(rhs) {
+		op := a.Operator.Type
+		if !types.IsPointer(lhs) || !types.IsInteger(rhs) ||
+			op != token.AdditionAssignmentToken && op != token.SubtractionAssignmentToken {
+			c.errorf(a, "invalid operands of types %v and %v to '%s'", lhs, rhs,
+				a.Operator.Value)
+			return lhs
+		}
+		a.OperandType = lhs
+		return lhs
+	}
+	if isShift(a.Operator.Type) {
+		a.OperandType = promote(lhs)
+		a.Rhs = c.convert(a.Rhs, promote(rhs))
+		return lhs
+	}
+	a.OperandType = commonType(lhs, rhs)
+	a.Rhs = c.convert(a.Rhs, a.OperandType)
+	return lhs
+}
+
+// isShift returns whether an operator is a shift, or a compound assignment
+// of one.
+func isShift(op token.TokenType) bool {
+	switch op {
+	case token.ShiftLeftToken, token.ShiftRightToken,
+		token.ShiftLeftAssignmentToken, token.ShiftRightAssignmentToken:
+		return true
+	}
+	return false
+}
+
+func (c *checker) checkIncDecOp(i *ast.IncDecOp) types.Type {
+	c.checkExpression(i.Operand)
+	if !c.checkAssignable(i.Operand) {
+		return nil
+	}
+	return ast.TypeOf(i.Operand)
+}
+
+// checkAssignable reports an error if an expression is not an lvalue, or is
+// an array or struct, which may not be assigned as a whole. Identifiers which
+// do not name variables were reported when checked.
+func (c *checker) checkAssignable(e ast.Expression) bool {
+	if isLvalue(e) {
+		switch t := ast.TypeOf(e); {
+		case types.IsArray(t):
+			c.errorf(e, "assignment to expression with array type %v", t)
+			return false
+		case types.IsStruct(t):
+			c.errorf(e, "assignment of %v is not supported", t)
+			return false
+		}
+		return true
+	}
+	switch n := e.(type) {
+	case *ast.IntLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+		c.errorf(n, "cannot assign to a literal")
+	default:
+		c.errorf(n, "expression is not assignable")
+	}
+	return false
+}
+
+// convert returns an expression which converts e to type t, or e if it
+// already has that type. Arithmetic types convert to each other, and a null
+// pointer constant to any pointer type.
+func (c *checker) convert(e ast.Expression, t types.Type) ast.Expression {
+	from := ast.TypeOf(e)
+	if from == nil || t == nil || from == t {
+		return e
+	}
+	if types.IsPointer(t) && consteval.IsNullPointerConstant(e) {
+		return &ast.Conversion{Operand: e, Type: t, Implicit: true}
+	}
+	if !types.IsArithmetic(from) || !types.IsArithmetic(t) {
+		c.errorf(e, "cannot convert a value of type %v to %v", from, t)
+		return e
+	}
+	c.checkNarrowing(e, t)
+	return &ast.Conversion{Operand: e, Type: t, Implicit: true}
+}
+
+// The conversion rank of each arithmetic type. Operands of different types are
+// converted to the type of greater rank. An unsigned type ranks above the
+// signed type of its width, which converts to it, and so wraps around if it
+// is negative, and a long ranks above an unsigned int, each of whose values
+// it represents.
+var rank = map[types.Type]int{
+	types.Int:          0,
+	types.UnsignedInt:  1,
+	types.Long:         2,
+	types.UnsignedLong: 3,
+	types.Float:        4,
+	types.Double:       5,
+}
+
+// commonType returns the type that the operands of an arithmetic operator are
+// converted to, according to the usual arithmetic conversions.
+func commonType(lhs, rhs types.Type) types.Type {
+	lhs, rhs = promote(lhs), promote(rhs)
+	if rank[rhs] > rank[lhs] {
+		return rhs
+	}
+	return lhs
+}
+
+// literalType returns the type of an integer literal: the first of a list of
+// types which can represent its value, or nil if none can. The list is int
+// and long for a decimal literal, and int, unsigned int, long and unsigned
+// long for a hexadecimal, octal or binary one, so that 0xffffffff is
+// unsigned. A "u" suffix leaves only the unsigned types of the list, and an
+// "l" suffix only the long ones, and a literal with a "u" suffix may be any
+// unsigned type.
+func literalType(l *ast.IntLiteral) types.Type {
+	candidates := []types.Type{types.Int, types.Long}
+	decimal := l.Token.Type != token.NumberToken || l.Token.Value[0] != '0'
+	if !decimal || l.HasUnsignedSuffix() {
+		candidates = []types.Type{types.Int, types.UnsignedInt, types.Long, types.UnsignedLong}
+	}
+	for _, t := range candidates {
+		switch {
+		case l.HasUnsignedSuffix() && !types.IsUnsigned(t):
+		case l.HasLongSuffix() && types.Width(t) != 64:
+		case uint64(l.Value) <= maxValue(t):
+			return t
+		}
+	}
+	return nil
+}
+
+// maxValue returns the greatest value of an integer type.
+func maxValue(t types.Type) uint64 {
+	if types.IsUnsigned(t) {
+		return 1<<types.Width(t) - 1
+	}
+	return 1<<(types.Width(t)-1) - 1
+}
+
+// promote returns the type that an operand of type t is converted to before
+// an arithmetic operator is applied: a char or short, signed or unsigned, is
+// promoted to an int, which represents each of their values, and other types
+// are unchanged.
+func promote(t types.Type) types.Type {
+	if types.IsInteger(t) && types.Width(t) < 32 {
+		return types.Int
+	}
+	return t
+}
@@ -0,0 +1,433 @@
+package sema
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckAnnotatesTypes(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "double f() { float a; return 1.5 * 2.0; }")
+	assert.Nil(err)
+
+	f := program.Functions[0]
+	assert.Equal(&types.Function{Result: types.Double}, f.Symbol.Type)
+	decl := f.Body[0].(*ast.VariableDeclaration)
+	assert.Equal(types.Float, decl.Symbol.Type)
+
+	mul := f.Body[1].(*ast.ReturnStatement).Value.(*ast.BinaryOp)
+	assert.Equal(types.Double, mul.Type)
+	assert.Equal(types.Double, ast.TypeOf(mul.Lhs))
+
+	program, err = check(t, "int main() { double a; return !a == (a > 1.0); }")
+	assert.Nil(err)
+	eq := program.Functions[0].Body[1].(*ast.ReturnStatement).Value
+	assert.Equal(types.Int, ast.TypeOf(eq))
+	assert.Equal(types.Int, ast.TypeOf(eq.(*ast.BinaryOp).Lhs))
+}
+
+// conversion returns the type that an expression is implicitly converted to,
+// or nil if it is not a conversion.
+func conversion(e ast.Expression) types.Type {
+	if c, ok := e.(*ast.Conversion); ok && c.Implicit {
+		return c.Type
+	}
+	return nil
+}
+
+func TestCheckInsertsConversions(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int main() {
+  double d = 1;
+  float f = d;
+  int i = 2.5f;
+  i = d + i;
+  return f > i;
+}`)
+	if !assert.Nil(err) {
+		return
+	}
+	body := program.Functions[0].Body
+	assert.Equal(types.Double, conversion(body[0].(*ast.VariableDeclaration).Init))
+	assert.Equal(types.Float, conversion(body[1].(*ast.VariableDeclaration).Init))
+	assert.Equal(types.Int, conversion(body[2].(*ast.VariableDeclaration).Init))
+
+	// The operands of d + i are converted to double, and the result to int.
+	assign := body[3].(*ast.ExpressionStatement).Expression.(*ast.Assignment)
+	assert.Equal(types.Int, conversion(assign.Rhs))
+	add := assign.Rhs.(*ast.Conversion).Operand.(*ast.BinaryOp)
+	assert.Equal(types.Double, add.Type)
+	assert.Nil(conversion(add.Lhs))
+	assert.Equal(types.Double, conversion(add.Rhs))
+
+	// The comparison is between floats, and is not converted for the return.
+	ret := body[4].(*ast.ReturnStatement).Value.(*ast.BinaryOp)
+	assert.Equal(types.Int, ret.Type)
+	assert.Nil(conversion(ret.Lhs))
+	assert.Equal(types.Float, conversion(ret.Rhs))
+}
+
+func TestCheckCall(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "double f(int a, float b); int main() { return f(1.5, 2); }")
+	if !assert.Nil(err) {
+		return
+	}
+	f := program.Functions[0]
+	assert.Equal(&types.Function{Params: []types.Type{types.Int, types.Float},
+		Result: types.Double}, f.Symbol.Type)
+
+	ret := program.Functions[1].Body[0].(*ast.ReturnStatement)
+	assert.Equal(types.Int, conversion(ret.Value))
+	call := ret.Value.(*ast.Conversion).Operand.(*ast.Call)
+	assert.Equal(types.Double, call.Type)
+	assert.Equal(f.Symbol.Type, call.Function.Type)
+	// Each argument is converted to the type of its parameter.
+	assert.Equal(types.Int, conversion(call.Args[0]))
+	assert.Equal(types.Float, conversion(call.Args[1]))
+}
+
+func TestCheckVariadicCall(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int printf(char *format, ...);
+int main() { char c; float f; printf("%c %f %d", c, f, 1); return 0; }`)
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal(&types.Function{Params: []types.Type{types.NewPointer(types.Char)},
+		Result: types.Int, Variadic: true}, program.Functions[0].Symbol.Type)
+	call := program.Functions[1].Body[2].(*ast.ExpressionStatement).Expression.(*ast.Call)
+	// A string literal is an array, converted to a pointer to its first
+	// character.
+	assert.Equal(types.NewPointer(types.Char), conversion(call.Args[0]))
+	format := call.Args[0].(*ast.Conversion).Operand.(*ast.StringLiteral)
+	assert.Equal(types.NewArray(types.Char, 9), format.Type)
+	// The variable arguments undergo the default argument promotions.
+	assert.Equal(types.Int, conversion(call.Args[1]))
+	assert.Equal(types.Double, conversion(call.Args[2]))
+	assert.Nil(conversion(call.Args[3]))
+}
+
+func TestCheckCharPromotion(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int main() {
+  char a = 'x';
+  char b = -a;
+  a += b;
+  return a + b;
+}`)
+	if !assert.Nil(err) {
+		return
+	}
+	body := program.Functions[0].Body
+	assert.Equal(types.Char, body[0].(*ast.VariableDeclaration).Symbol.Type)
+	// The operands of arithmetic operators are promoted to int.
+	neg := body[1].(*ast.VariableDeclaration).Init.(*ast.Conversion).Operand.(*ast.UnaryOp)
+	assert.Equal(types.Int, neg.Type)
+	assert.Equal(types.Int, conversion(neg.Operand))
+	assign := body[2].(*ast.ExpressionStatement).Expression.(*ast.CompoundAssignment)
+	assert.Equal(types.Char, assign.Type)
+	assert.Equal(types.Int, assign.OperandType)
+	add := body[3].(*ast.ReturnStatement).Value.(*ast.BinaryOp)
+	assert.Equal(types.Int, add.Type)
+	assert.Equal(types.Int, conversion(add.Lhs))
+	assert.Equal(types.Int, conversion(add.Rhs))
+}
+
+func TestCheckIfStatement(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "double f(double d) { if (d) return 1; else return d; }")
+	if !assert.Nil(err) {
+		return
+	}
+	s := program.Functions[0].Body[0].(*ast.IfStatement)
+	// The condition is compared against zero, so is not converted.
+	assert.Equal(types.Double, ast.TypeOf(s.Cond))
+	assert.Nil(conversion(s.Cond))
+	assert.Equal(types.Double, conversion(s.Then.(*ast.ReturnStatement).Value))
+	assert.Nil(conversion(s.Else.(*ast.ReturnStatement).Value))
+}
+
+func TestCheckLogicalOperandsAreNotConverted(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "double f() { return 1 && 2.5; }")
+	if !assert.Nil(err) {
+		return
+	}
+	ret := program.Functions[0].Body[0].(*ast.ReturnStatement)
+	assert.Equal(types.Double, conversion(ret.Value))
+	and := ret.Value.(*ast.Conversion).Operand.(*ast.BinaryOp)
+	assert.Equal(types.Int, and.Type)
+	assert.Nil(conversion(and.Lhs))
+	assert.Nil(conversion(and.Rhs))
+}
+
+func TestCheckConditional(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "double f(double d, int a) { return d ? a : 1.5f; }")
+	if !assert.Nil(err) {
+		return
+	}
+	c := program.Functions[0].Body[0].(*ast.ReturnStatement).Value.(*ast.Conversion).
+		Operand.(*ast.ConditionalExpression)
+	// The operands are converted to their common type, but the condition is
+	// compared against zero, so is not.
+	assert.Equal(types.Float, c.Type)
+	assert.Nil(conversion(c.Cond))
+	assert.Equal(types.Float, conversion(c.Then))
+	assert.Nil(conversion(c.Else))
+}
+
+func TestCheckUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int main() {
+  unsigned a = 1u;
+  unsigned int b = 0xffffffff;
+  signed c = -1;
+  a << c;
+  return c < a + 2147483647;
+}`)
+	if !assert.Nil(err) {
+		return
+	}
+	body := program.Functions[0].Body
+	assert.Equal(types.UnsignedInt, body[0].(*ast.VariableDeclaration).Symbol.Type)
+	assert.Equal(types.UnsignedInt, ast.TypeOf(body[0].(*ast.VariableDeclaration).Init))
+	assert.Equal(types.UnsignedInt, body[1].(*ast.VariableDeclaration).Symbol.Type)
+	// A hexadecimal literal too large for an int is unsigned.
+	assert.Equal(types.UnsignedInt, ast.TypeOf(body[1].(*ast.VariableDeclaration).Init))
+	assert.Equal(types.Int, body[2].(*ast.VariableDeclaration).Symbol.Type)
+	// The operands of a shift are not converted to a common type.
+	shift := body[3].(*ast.ExpressionStatement).Expression.(*ast.BinaryOp)
+	assert.Equal(types.UnsignedInt, shift.Type)
+	assert.Nil(conversion(shift.Rhs))
+	// An int operand is converted to unsigned int.
+	lt := body[4].(*ast.ReturnStatement).Value.(*ast.BinaryOp)
+	assert.Equal(types.Int, lt.Type)
+	assert.Equal(types.UnsignedInt, conversion(lt.Lhs))
+	add := lt.Rhs.(*ast.BinaryOp)
+	assert.Equal(types.UnsignedInt, add.Type)
+	assert.Equal(types.UnsignedInt, conversion(add.Rhs))
+}
+
+func TestCheckIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int main() {
+  short a;
+  unsigned short int b;
+  long c;
+  unsigned long int d;
+  signed char e;
+  a + b;
+  c + 1u;
+  d + c;
+  2147483648;
+  0xffffffff;
+  1L;
+  1ul;
+  return 0;
+}`)
+	if !assert.Nil(err) {
+		return
+	}
+	body := program.Functions[0].Body
+	for i, want := range []types.Type{types.Short, types.UnsignedShort, types.Long,
+		types.UnsignedLong, types.Char} {
+		assert.Equal(want, body[i].(*ast.VariableDeclaration).Symbol.Type)
+	}
+	// Integers narrower than an int are promoted to int, and an unsigned int
+	// is converted to a long, which can represent all of its values.
+	for i, want := range []types.Type{types.Int, types.Long, types.UnsignedLong} {
+		assert.Equal(want, ast.TypeOf(body[5+i].(*ast.ExpressionStatement).Expression))
+	}
+	// A literal has the first type which can represent its value, of those
+	// allowed by its suffix and base.
+	for i, want := range []types.Type{types.Long, types.UnsignedInt, types.Long,
+		types.UnsignedLong} {
+		assert.Equal(want, ast.TypeOf(body[8+i].(*ast.ExpressionStatement).Expression))
+	}
+}
+
+func TestCheckCompoundAssignment(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "int f(int a, float b) { a += b; b -= 1; return a++; }")
+	if !assert.Nil(err) {
+		return
+	}
+	body := program.Functions[0].Body
+	// The operator is computed in the common type of the operands, and the
+	// result has the type of the lvalue.
+	add := body[0].(*ast.ExpressionStatement).Expression.(*ast.CompoundAssignment)
+	assert.Equal(types.Int, add.Type)
+	assert.Equal(types.Float, add.OperandType)
+	assert.Nil(conversion(add.Rhs))
+	sub := body[1].(*ast.ExpressionStatement).Expression.(*ast.CompoundAssignment)
+	assert.Equal(types.Float, sub.Type)
+	assert.Equal(types.Float, conversion(sub.Rhs))
+	inc := body[2].(*ast.ReturnStatement).Value.(*ast.IncDecOp)
+	assert.Equal(types.Int, inc.Type)
+}
+
+func TestCheckPointers(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int f(int *p, int a) {
+  int **q = &p;
+  p = p == 0 ? *q + a : 0;
+  return p - *q;
+}`)
+	if !assert.Nil(err) {
+		return
+	}
+	f := program.Functions[0]
+	ptr := types.NewPointer(types.Int)
+	assert.Equal(&types.Function{Params: []types.Type{ptr, types.Int},
+		Result: types.Int}, f.Symbol.Type)
+	// Only the variable whose address is taken is marked.
+	assert.True(f.Params[0].Symbol.AddressTaken)
+	assert.False(f.Params[1].Symbol.AddressTaken)
+
+	decl := f.Body[0].(*ast.VariableDeclaration)
+	assert.Equal(types.NewPointer(ptr), decl.Symbol.Type)
+	assert.Equal(types.NewPointer(ptr), ast.TypeOf(decl.Init))
+
+	// Null pointer constants are converted to the type of the other operand.
+	c := f.Body[1].(*ast.ExpressionStatement).Expression.(*ast.Assignment).
+		Rhs.(*ast.ConditionalExpression)
+	assert.Equal(ptr, c.Type)
+	assert.Equal(ptr, conversion(c.Cond.(*ast.BinaryOp).Rhs))
+	add := c.Then.(*ast.BinaryOp)
+	assert.Equal(ptr, add.Type)
+	assert.Equal(ptr, ast.TypeOf(add.Lhs))
+	assert.Nil(conversion(add.Rhs))
+	assert.Equal(ptr, conversion(c.Else))
+
+	// The difference of two pointers is an int.
+	ret := f.Body[2].(*ast.ReturnStatement).Value
+	assert.Equal(types.Int, ast.TypeOf(ret))
+	assert.Nil(conversion(ret))
+}
+
+func TestCheckArrays(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `int f(int m[][3], int n) {
+  int a[2][3];
+  int *p = a[n];
+  return m[0][1] + (&a[1] - a);
+}`)
+	if !assert.Nil(err) {
+		return
+	}
+	f := program.Functions[0]
+	row := types.NewArray(types.Int, 3)
+	// A parameter declared as an array is a pointer to its first element.
+	assert.Equal(types.NewPointer(row), f.Params[0].Symbol.Type)
+	decl := f.Body[0].(*ast.VariableDeclaration)
+	assert.Equal(types.NewArray(row, 2), decl.Symbol.Type)
+
+	// a decays to a pointer to its first row, and a[n] to a pointer to its
+	// first element.
+	init := f.Body[1].(*ast.VariableDeclaration).Init
+	assert.Equal(types.NewPointer(types.Int), conversion(init))
+	sub := init.(*ast.Conversion).Operand.(*ast.Subscript)
+	assert.Equal(row, sub.Type)
+	assert.Equal(types.NewPointer(row), conversion(sub.Array))
+
+	// The operand of '&' does not decay.
+	diff := f.Body[2].(*ast.ReturnStatement).Value.(*ast.BinaryOp).Rhs.(*ast.BinaryOp)
+	addr := diff.Lhs.(*ast.UnaryOp)
+	assert.Equal(types.NewPointer(row), addr.Type)
+	assert.Nil(conversion(addr.Operand))
+	assert.Equal(types.NewPointer(row), conversion(diff.Rhs))
+}
+
+func TestCheckStructs(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, `struct point { int x; double y; };
+int f(struct point *p) {
+  struct point a;
+  a.y = p->x;
+  return a.x;
+}`)
+	if !assert.Nil(err) {
+		return
+	}
+	s := program.Structs[0].Symbol.Type.(*types.Struct)
+	assert.True(s.Complete)
+	assert.Equal([]*types.Field{{Name: "x", Type: types.Int}, {Name: "y", Type: types.Double}},
+		s.Fields)
+	f := program.Functions[0]
+	assert.Equal(types.NewPointer(s), f.Params[0].Symbol.Type)
+	assert.Equal(s, f.Body[0].(*ast.VariableDeclaration).Symbol.Type)
+
+	// The operand of '.' is not converted, and fields have their own types.
+	assign := f.Body[1].(*ast.ExpressionStatement).Expression.(*ast.Assignment)
+	lhs := assign.Lhs.(*ast.Member)
+	assert.Equal(types.Double, lhs.Type)
+	assert.Equal(s, ast.TypeOf(lhs.X))
+	assert.Equal(types.Double, conversion(assign.Rhs))
+	rhs := assign.Rhs.(*ast.Conversion).Operand.(*ast.Member)
+	assert.Equal(types.Int, rhs.Type)
+	assert.Equal(types.NewPointer(s), ast.TypeOf(rhs.X))
+}
+
+func TestCheckCast(t *testing.T) {
+	assert := assert.New(t)
+	program, err := check(t, "int main() { char s[2]; return (int)(char *)s; }")
+	if !assert.Nil(err) {
+		return
+	}
+	// The operand of a cast is an rvalue, so an array is converted to a
+	// pointer.
+	c := program.Functions[0].Body[1].(*ast.ReturnStatement).Value.(*ast.Conversion)
+	assert.False(c.Implicit)
+	assert.Equal(types.Int, c.Type)
+	inner := c.Operand.(*ast.Conversion)
+	assert.Equal(types.NewPointer(types.Char), inner.Type)
+	assert.Equal(types.NewPointer(types.Char), conversion(inner.Operand))
+}
+
+func TestCheckSizeof(t *testing.T) {
+	assert := assert.New(t)
+	input := `struct s { char c; int *p; };
+int f(int a[2]) {
+  int b[3];
+  return sizeof a + sizeof b + sizeof(struct s [2]) + sizeof "abc";
+}`
+	var sizes [][]int64
+	for _, layout := range []types.Layout{types.LP64, types.ILP32} {
+		program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+		if !assert.NoError(err) {
+			return
+		}
+		if !assert.Nil(Check(program, Layout(layout))) {
+			return
+		}
+		var values []int64
+		for e := program.Functions[0].Body[1].(*ast.ReturnStatement).Value; ; {
+			b, ok := e.(*ast.BinaryOp)
+			if !ok {
+				values = append([]int64{e.(*ast.Sizeof).Value}, values...)
+				break
+			}
+			values = append([]int64{b.Rhs.(*ast.Sizeof).Value}, values...)
+			e = b.Lhs
+		}
+		sizes = append(sizes, values)
+	}
+	// The size of a pointer depends on the target, and an array operand is
+	// not converted to a pointer, unless it is a parameter.
+	assert.Equal([][]int64{{8, 12, 32, 4}, {4, 12, 16, 4}}, sizes)
+
+	program, err := check(t, "int main() { int a[2]; return sizeof a; }")
+	if !assert.Nil(err) {
+		return
+	}
+	s := program.Functions[0].Body[1].(*ast.ReturnStatement).Value.(*ast.Sizeof)
+	assert.Equal(types.Int, s.Type)
+	assert.Equal(types.NewArray(types.Int, 2), s.Of)
+	assert.Nil(conversion(s.Operand))
+}
@@ -0,0 +1,283 @@
+package sema
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/consteval"
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A warning about a program which is valid, but probably not what was meant.
+type Warning struct {
+	Pos    token.Position
+	Length int // The length of the offending source text in runes, if known.
+	Msg    string
+	// The name of the check which found it, such as diag.Shadow.
+	Name string
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%v: warning: %s", w.Pos, w.Msg)
+}
+
+// Diagnostic returns the warning as a diagnostic, whose code is the name of
+// its check.
+func (w *Warning) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{
+		Severity: diag.Warning,
+		Pos:      w.Pos,
+		Length:   w.Length,
+		Msg:      w.Msg,
+		Code:     w.Name,
+	}
+}
+
+// ReportWarnings returns an Option which passes each warning about a program
+// to report, in source order. Every check is run, and the warnings are only
+// reported if the program is valid.
+func ReportWarnings(report func(*Warning)) Option {
+	return func(c *checker) {
+		c.reportWarning = report
+	}
+}
+
+func (c *checker) warnf(node ast.Node, name, format string, args ...interface{}) {
+	w := &Warning{
+		Pos:  node.Pos(),
+		Msg:  fmt.Sprintf(format, args...),
+		Name: name,
+	}
+	if i, ok := node.(*ast.Identifier); ok {
+		w.Length = utf8.RuneCountInString(i.Token.Value)
+	}
+	c.warnings = append(c.warnings, w)
+}
+
+// reportWarnings reports the warnings found, if the program is valid.
+func (c *checker) reportWarnings() {
+	if c.reportWarning == nil || len(c.errors) > 0 {
+		return
+	}
+	sort.SliceStable(c.warnings, func(i, j int) bool {
+		return c.warnings[i].Pos.Offset < c.warnings[j].Pos.Offset
+	})
+	for _, w := range c.warnings {
+		c.reportWarning(w)
+	}
+}
+
+// checkShadow warns if a variable which is about to be declared hides a
+// variable or parameter of an enclosing scope. A redeclaration in the same
+// scope is an error instead.
+func (c *checker) checkShadow(d *ast.VariableDeclaration) {
+	if c.scope.LookupLocal(d.Name.Value) != nil {
+		return
+	}
+	for s := c.scope.Outer; s != nil; s = s.Outer {
+		prior := s.LookupLocal(d.Name.Value)
+		if prior == nil {
+			continue
+		}
+		if prior.Kind != ast.VariableSymbol {
+			return
+		}
+		kind := "variable"
+		if _, ok := prior.Decl.(*ast.Parameter); ok {
+			kind = "parameter"
+		} else if s.Outer == nil {
+			kind = "global variable"
+		}
+		c.warnf(d, diag.Shadow, "declaration of '%s' shadows a %s declared at %v",
+			d.Name.Value, kind, prior.Decl.Pos())
+		return
+	}
+}
+
+// markRead records that the value of the symbol of an identifier is read.
+func (c *checker) markRead(i *ast.Identifier) {
+	if i.Symbol == nil {
+		return
+	}
+	if c.read == nil {
+		c.read = make(map[*ast.Symbol]bool)
+	}
+	c.read[i.Symbol] = true
+}
+
+// checkUnused warns, at its declaration, of each parameter and local variable
+// of the function just resolved whose value is never read. A variable which
+// is only assigned to is unused. Those whose names begin with an underscore
+// are meant to be unused, and are not reported.
+func (c *checker) checkUnused() {
+	for _, s := range c.locals {
+		if c.read[s] || strings.HasPrefix(s.Name, "_") {
+			continue
+		}
+		if _, ok := s.Decl.(*ast.Parameter); ok {
+			c.warnf(s.Decl, diag.UnusedParameter, "unused parameter '%s'", s.Name)
+		} else {
+			c.warnf(s.Decl, diag.UnusedVariable, "unused variable '%s'", s.Name)
+		}
+	}
+	c.locals = nil
+}
+
+// checkNarrowing warns if the implicit conversion of an expression to type t
+// may change its value: if t is an integer type and the expression is
+// floating, or if t is a smaller type of the same kind. A constant whose
+// value t represents exactly is not narrowed, and neither is a floating
+// literal converted to float, which is the usual way to write one.
+func (c *checker) checkNarrowing(e ast.Expression, t types.Type) {
+	from := ast.TypeOf(e)
+	switch {
+	case types.IsInteger(t) && types.IsFloating(from):
+		if v, ok := consteval.Float(e); ok && v == math.Trunc(v) && fits(v, t) {
+			return
+		}
+	case sizes[t] < sizes[from] && types.IsFloating(t) == types.IsFloating(from):
+		if _, ok := consteval.Float(e); ok {
+			return
+		}
+		if v, ok := consteval.Int(e); ok && fits(float64(v), t) {
+			return
+		}
+	default:
+		return
+	}
+	c.warnf(e, diag.Narrowing, "implicit conversion from %v to %v may change its value",
+		from, t)
+}
+
+// checkOverflow warns if an int operator on constant operands overflows,
+// which is undefined behavior, though the value wraps around unless overflow
+// is trapped.
+func (c *checker) checkOverflow(e ast.Expression, op token.TokenType, operands ...ast.Expression) {
+	t := ast.TypeOf(e)
+	if t != types.Int && t != types.Long {
+		return
+	}
+	values := make([]int64, len(operands))
+	for i, operand := range operands {
+		v, ok := consteval.Int(operand)
+		if !ok {
+			return
+		}
+		values[i] = v
+	}
+	if !consteval.Overflows(op, types.Width(t), values...) {
+		return
+	}
+	v, _ := consteval.Int(e)
+	c.warnf(e, diag.Overflow, "integer overflow in expression of type %v results in %d", t, v)
+}
+
+// The relative sizes of the arithmetic types, whichever the layout.
+var sizes = map[types.Type]int{
+	types.Char:          1,
+	types.UnsignedChar:  1,
+	types.Short:         2,
+	types.UnsignedShort: 2,
+	types.Int:           4,
+	types.UnsignedInt:   4,
+	types.Long:          8,
+	types.UnsignedLong:  8,
+	types.Float:         4,
+	types.Double:        8,
+}
+
+// fits returns whether an integer value is in the range of an integer type.
+func fits(v float64, t types.Type) bool {
+	if types.IsUnsigned(t) {
+		return v >= 0 && v < math.Ldexp(1, int(types.Width(t)))
+	}
+	limit := math.Ldexp(1, int(types.Width(t))-1)
+	return v >= -limit && v < limit
+}
+
+// The letters of the Cyrillic and Greek scripts which look the same as a
+// Latin letter, by the Latin letter. The skeleton of a name replaces each.
+var confusables = map[rune]rune{
+	'А': 'A', 'а': 'a', 'В': 'B', 'С': 'C', 'с': 'c', 'Е': 'E', 'е': 'e',
+	'Н': 'H', 'І': 'I', 'і': 'i', 'Ј': 'J', 'ј': 'j', 'К': 'K', 'М': 'M',
+	'О': 'O', 'о': 'o', 'Р': 'P', 'р': 'p', 'Ѕ': 'S', 'ѕ': 's', 'Т': 'T',
+	'Х': 'X', 'х': 'x', 'У': 'Y', 'у': 'y', 'ԁ': 'd', 'һ': 'h', 'ԛ': 'q',
+	'ԝ': 'w', 'Α': 'A', 'Β': 'B',
+	'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N',
+	'Ο': 'O', 'ο': 'o', 'Ρ': 'P', 'ρ': 'p', 'Τ': 'T', 'Υ': 'Y', 'υ': 'u',
+	'Χ': 'X', 'ν': 'v', 'ι': 'i',
+}
+
+// skeleton returns the form of a name in which each letter which looks the
+// same as a Latin letter is replaced by it, so that names which look the
+// same have the same skeleton.
+func skeleton(name string) string {
+	return strings.Map(func(r rune) rune {
+		if l, ok := confusables[r]; ok {
+			return l
+		}
+		return r
+	}, name)
+}
+
+// scriptOf returns the name of the script of a letter, or "" if it is
+// common to many scripts, as digits and the underscore are.
+func scriptOf(r rune) string {
+	if r < utf8.RuneSelf {
+		if unicode.IsLetter(r) {
+			return "Latin"
+		}
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// checkConfusable warns if the name of a symbol which is about to be
+// declared mixes the letters of different scripts, or looks the same as the
+// name of a symbol declared before it. Names of only ASCII characters are
+// never mixed, but may be confused with a name which is not.
+func (c *checker) checkConfusable(symbol *ast.Symbol) {
+	name := symbol.Name
+	ascii := true
+	for i := 0; i < len(name); i++ {
+		ascii = ascii && name[i] < utf8.RuneSelf
+	}
+	if !ascii {
+		var scripts []string
+		for _, r := range name {
+			if s := scriptOf(r); s != "" && (len(scripts) == 0 || scripts[0] != s) {
+				scripts = append(scripts, s)
+			}
+			if len(scripts) > 1 {
+				c.warnf(symbol.Decl, diag.Confusable, "identifier '%s' mixes %s and %s letters",
+					name, scripts[0], scripts[1])
+				break
+			}
+		}
+	}
+	if c.skeletons == nil {
+		c.skeletons = make(map[string]*ast.Symbol)
+	}
+	key := name
+	if !ascii {
+		key = skeleton(name)
+	}
+	prior, ok := c.skeletons[key]
+	if !ok {
+		c.skeletons[key] = symbol
+	} else if prior.Name != name {
+		c.warnf(symbol.Decl, diag.Confusable, "identifier '%s' looks the same as '%s' declared at %v",
+			name, prior.Name, prior.Decl.Pos())
+	}
+}
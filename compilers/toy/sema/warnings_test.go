@@ -0,0 +1,146 @@
+package sema
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/diag"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// warnings parses and checks a valid program, returning the warnings about it
+// which a check found.
+func warnings(t *testing.T, input, name string) []string {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	err = Check(program, ReportWarnings(func(w *Warning) {
+		if w.Name == name {
+			found = append(found, w.String())
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestWarningsOnlyForValidPrograms(t *testing.T) {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(
+		"int main() { int a; return b; }")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reported := 0
+	err = Check(program, ReportWarnings(func(*Warning) { reported++ }))
+	assert.Error(t, err)
+	assert.Equal(t, 0, reported)
+}
+
+func TestUnusedVariableWarning(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"1:14: warning: unused variable 'a'",
+		"1:34: warning: unused variable 'c'",
+	}, warnings(t, "int main() { int a; int b = 2; { int c = b; } return 0; }",
+		diag.UnusedVariable))
+	// Any use counts, even in its own initializer or in sizeof.
+	assert.Empty(warnings(t, "int main() { int a = a; int b; return sizeof b; }",
+		diag.UnusedVariable))
+	// Globals and parameters are not local variables.
+	assert.Empty(warnings(t, "int g; int f(int p) { return 0; }", diag.UnusedVariable))
+	// A variable which is only assigned to is unused, unless the value of the
+	// assignment is.
+	assert.Equal([]string{
+		"1:14: warning: unused variable 'a'",
+		"1:21: warning: unused variable 'b'",
+	}, warnings(t, "int main() { int a; int b = 0; a = 1; b += 2; b++; for (;; a = 2) break; return 0; }",
+		diag.UnusedVariable))
+	assert.Empty(warnings(t, "int main() { int a; int b = 0; int c[2]; c[0] = 1; return (a = 1) + b++; }",
+		diag.UnusedVariable))
+	// The address of a variable may be used to read it.
+	assert.Empty(warnings(t, "int main() { int a; int *p = &a; *p = 1; return 0; }",
+		diag.UnusedVariable))
+	// Names beginning with an underscore are meant to be unused.
+	assert.Empty(warnings(t, "int main() { int _a; int _ = 2; return 0; }", diag.UnusedVariable))
+}
+
+func TestUnusedParameterWarning(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"1:14: warning: unused parameter 'b'",
+		"1:49: warning: unused parameter 'q'",
+	}, warnings(t, "int f(int a, int b) { return a; } int g(int *p, int q) { q = 1; return *p; }",
+		diag.UnusedParameter))
+	// Prototypes have no bodies to use their parameters.
+	assert.Empty(warnings(t, "int f(int a); int g(int _unused) { return 0; }",
+		diag.UnusedParameter))
+}
+
+func TestShadowWarning(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"1:27: warning: declaration of 'a' shadows a variable declared at 1:14",
+	}, warnings(t, "int main() { int a = 1; { int a = 2; return a; } }", diag.Shadow))
+	assert.Equal([]string{
+		"1:18: warning: declaration of 'p' shadows a parameter declared at 1:7",
+		"1:60: warning: declaration of 'g' shadows a global variable declared at 1:43",
+	}, warnings(t, "int f(int p) { { int p = 0; return p; } } int g; int h() { int g = 0; return g; }",
+		diag.Shadow))
+	assert.Equal([]string{
+		"1:30: warning: declaration of 'i' shadows a variable declared at 1:14",
+	}, warnings(t, "int main() { int i = 0; for (int i = 0; i < 2; i = i + 1) {} return i; }",
+		diag.Shadow))
+	// Functions are not shadowed, and neither are variables of other scopes.
+	assert.Empty(warnings(t, "int f() { int f = 0; return f; }", diag.Shadow))
+	assert.Empty(warnings(t, "int main() { { int a = 0; } { int a = 1; } return 0; }",
+		diag.Shadow))
+}
+
+func TestNarrowingWarning(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"1:37: warning: implicit conversion from double to int may change its value",
+		"1:49: warning: implicit conversion from int to char may change its value",
+		"1:65: warning: implicit conversion from double to float may change its value",
+	}, warnings(t, "double f(double d, int i) { int a = d; char c = i; float x; x = d; return a + c + x; }",
+		diag.Narrowing))
+	assert.Equal([]string{
+		"1:28: warning: implicit conversion from double to int may change its value",
+	}, warnings(t, "int f() { int a = 2.0; a = 2.5; return a; }", diag.Narrowing))
+	// Constants which are represented exactly, floating literals assigned to
+	// floats and widening conversions do not narrow.
+	assert.Empty(warnings(t, "double f(int i, char c) { char d = 65; float x = 0.1; double y = i + c; return i + d + x + y; }",
+		diag.Narrowing))
+	assert.Equal([]string{
+		"1:20: warning: implicit conversion from int to char may change its value",
+	}, warnings(t, "int f() { char c = 300; return c; }", diag.Narrowing))
+}
+
+func TestConfusableWarning(t *testing.T) {
+	assert := assert.New(t)
+	// "pаss" has a Cyrillic "а".
+	assert.Equal([]string{
+		"1:1: warning: identifier 'p\u0430ss' mixes Latin and Cyrillic letters",
+		"1:11: warning: identifier 'pass' looks the same as 'p\u0430ss' declared at 1:1",
+	}, warnings(t, "int p\u0430ss; int pass; int main() { return 0; }", diag.Confusable))
+	// Names of one script are not mixed, and a name may be declared again.
+	assert.Empty(warnings(t, "int \u03c0; int \u0441\u0447\u0451\u0442; int main() { int \u03c0 = 1; return \u03c0; }",
+		diag.Confusable))
+}
+
+func TestOverflowWarning(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"1:19: warning: integer overflow in expression of type int results in -2147483648",
+		"1:43: warning: integer overflow in expression of type int results in 0",
+		"1:65: warning: integer overflow in expression of type int results in -2147483648",
+	}, warnings(t, "int f() { int a = 2147483647 + 1; int b = 65536 * 65536; return -(-2147483647 - 1) + a + b; }",
+		diag.Overflow))
+	// Arithmetic which is in range, on variables or in wider or narrower
+	// types does not overflow, and neither does a shift.
+	assert.Empty(warnings(t, "int f(int i) { double d = 2147483647.0 + 1; char c = (char)127 + 1; return i + 2147483647 + (1 << 31) + -2147483647 - 1 + c + d; }",
+		diag.Overflow))
+}
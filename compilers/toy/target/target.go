@@ -0,0 +1,194 @@
+// Package target describes the machines for which code is generated, and
+// keeps a registry of the backends which generate it.
+//
+// A backend registers a Target for each machine and operating system whose
+// conventions it follows, under a name like a target triple, such as
+// "x86_64-linux" or "arm64-darwin". A program which generates code, such as
+// toycc, imports the backends for their registration, and looks targets up
+// by name, so that each is used in the same way.
+package target
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Target generates code for a machine, following the conventions of an
+// operating system.
+type Target interface {
+	// Name returns the name of the target in the registry.
+	Name() string
+	// Arch returns the name of the architecture, such as "x86-64", and OS
+	// that of the operating system, such as "linux", or "" if the code does
+	// not run on one.
+	Arch() string
+	OS() string
+	// Layout returns the sizes and alignments of types.
+	Layout() types.Layout
+	// Registers returns the registers which may hold temporaries.
+	Registers() Registers
+	// CallingConvention returns how arguments are passed and results
+	// returned.
+	CallingConvention() CallingConvention
+	// Syntax returns the syntax of the generated code.
+	Syntax() Syntax
+	// Generate writes the code for a program to w. Options which the target
+	// does not support are ignored.
+	Generate(w io.Writer, program *ir.Program, options Options) error
+}
+
+// The registers of a target which may hold integers and pointers, and
+// floating-point values. Either is empty if every temporary of that kind is
+// kept in memory.
+type Registers struct {
+	Int   []string
+	Float []string
+}
+
+// A CallingConvention describes how the arguments of a call are passed, in
+// order, in the registers of their kind, followed by the stack, and in which
+// register the result is returned.
+type CallingConvention struct {
+	Name        string // The name of the convention, such as "System V AMD64".
+	IntArgs     []string
+	FloatArgs   []string
+	IntResult   string
+	FloatResult string
+	// The alignment in bytes of the stack pointer at a call.
+	StackAlign int
+}
+
+// The syntax of generated code.
+type Syntax int
+
+const (
+	ATT Syntax = iota // The AT&T syntax of x86 assembly, as used by GNU as.
+	ARM               // The syntax of AArch64 assembly of the ARM manuals.
+	WAT               // The WebAssembly text format.
+)
+
+func (s Syntax) String() string {
+	switch s {
+	case ATT:
+		return "att"
+	case ARM:
+		return "arm"
+	case WAT:
+		return "wat"
+	}
+	return fmt.Sprintf("Syntax(%d)", int(s))
+}
+
+// The options of code generation.
+type Options struct {
+	// Keep every temporary on the stack, rather than in registers.
+	NoRegisterAllocation bool
+	// Return from each call in tail position, rather than jumping to its
+	// callee.
+	NoTailCalls bool
+	// Check the stack canary of each function before it returns.
+	SanitizeStack bool
+	// Trap int arithmetic which overflows, rather than wrapping around.
+	TrapOverflow bool
+	// Simplify the generated code with peephole optimizations.
+	Peephole bool
+	// Write x86 assembly in Intel syntax, rather than AT&T syntax.
+	IntelSyntax bool
+	// Generate position-independent code, which may be linked into a shared
+	// object.
+	PIC bool
+	// The source of the program, for debug information, or nil to emit none.
+	Debug *Source
+}
+
+// The source of a program, for debug information.
+type Source struct {
+	Filename string // The name of the source file.
+	Dir      string // The directory it was compiled in, if the name is relative.
+	// Position returns the position in a source file which a position of the
+	// program came from, or is nil if the positions of the program are in
+	// the source file.
+	Position func(token.Position) token.Position
+}
+
+var (
+	mu       sync.Mutex
+	registry = make(map[string]Target)
+)
+
+// Register adds a target to the registry, under its name. It panics if
+// another target has the name.
+func Register(t Target) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := registry[t.Name()]; ok {
+		panic(fmt.Sprintf("target %s is already registered", t.Name()))
+	}
+	registry[t.Name()] = t
+}
+
+// Lookup returns the target with a name. The name may instead be that of an
+// architecture, such as "x86-64" or "arm64", for the target of the
+// architecture for the operating system of the host, or else for Linux, or
+// else the first of the architecture by name.
+func Lookup(name string) (Target, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := registry[name]; ok {
+		return t, nil
+	}
+	var found Target
+	rank := func(t Target) int {
+		if t.OS() == runtime.GOOS {
+			return 0
+		}
+		if t.OS() == "linux" {
+			return 1
+		}
+		return 2
+	}
+	for _, t := range registry {
+		if t.Arch() != name {
+			continue
+		}
+		if found == nil || rank(t) < rank(found) ||
+			rank(t) == rank(found) && t.Name() < found.Name() {
+			found = t
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown target %s, expected one of %s", name,
+			strings.Join(names(), ", "))
+	}
+	return found, nil
+}
+
+// Names returns the names of the registered targets, and of their
+// architectures, in order.
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return names()
+}
+
+func names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for name, t := range registry {
+		for _, n := range []string{name, t.Arch()} {
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,66 @@
+package target
+
+import (
+	"github.com/ChrisCummins/phd/compilers/toy/ir"
+	"github.com/ChrisCummins/phd/compilers/toy/types"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// A target which generates nothing.
+type fake struct {
+	name, arch, os string
+}
+
+func (t fake) Name() string                         { return t.name }
+func (t fake) Arch() string                         { return t.arch }
+func (t fake) OS() string                           { return t.os }
+func (t fake) Layout() types.Layout                 { return types.LP64 }
+func (t fake) Registers() Registers                 { return Registers{} }
+func (t fake) CallingConvention() CallingConvention { return CallingConvention{} }
+func (t fake) Syntax() Syntax                       { return ATT }
+
+func (t fake) Generate(w io.Writer, program *ir.Program, options Options) error {
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+	linux := fake{"toy-linux", "toy", "linux"}
+	host := fake{"toy-" + runtime.GOOS, "toy", runtime.GOOS}
+	other := fake{"other-minix", "other", "minix"}
+	Register(linux)
+	if runtime.GOOS != "linux" {
+		Register(host)
+	}
+	Register(other)
+
+	target, err := Lookup("toy-linux")
+	assert.NoError(err)
+	assert.Equal(linux, target)
+	// An architecture is that of the host's operating system.
+	target, err = Lookup("toy")
+	assert.NoError(err)
+	assert.Equal(host, target)
+	// Or of Linux, or the first by name, if the host has none.
+	Register(fake{"other-plan9", "other", "plan9"})
+	target, err = Lookup("other")
+	assert.NoError(err)
+	assert.Equal(other, target)
+
+	assert.Contains(Names(), "toy")
+	assert.Contains(Names(), "toy-linux")
+	_, err = Lookup("sparc")
+	assert.EqualError(err, "unknown target sparc, expected one of "+strings.Join(Names(), ", "))
+	assert.Panics(func() { Register(linux) })
+}
+
+func TestSyntaxString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("att", ATT.String())
+	assert.Equal("wat", WAT.String())
+	assert.Equal("Syntax(7)", Syntax(7).String())
+}
@@ -0,0 +1,80 @@
+package token
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// WriteText writes a list of tokens, one per line, in aligned columns of
+// their position, their type, and their value as a quoted string, such as:
+//
+//	1:1   int         "int"
+//	1:5   identifier  "main"
+func WriteText(w io.Writer, tokens []Token) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, t := range tokens {
+		fmt.Fprintf(tw, "%v\t%v\t%q\n", t.Position(), t.Type, t.Value)
+	}
+	return tw.Flush()
+}
+
+// The columns of the CSV representation of a token.
+var csvHeader = []string{"file", "line", "column", "offset", "type", "category", "value"}
+
+// WriteCSV writes a list of tokens of a source file as CSV, with a header
+// row, and a row of the columns of csvHeader for each token. The file of a
+// token is its own, if it was set by a line directive.
+func WriteCSV(w io.Writer, filename string, tokens []Token) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, t := range tokens {
+		cw.Write([]string{fileOf(filename, t), strconv.Itoa(t.Line), strconv.Itoa(t.Column),
+			strconv.Itoa(t.Offset), t.Type.String(), t.Type.Category().String(), t.Value})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// The JSON representation of a token.
+type jsonToken struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+	Type     string `json:"type"`
+	Category string `json:"category"`
+	Value    string `json:"value"`
+}
+
+// WriteJSON writes a list of tokens of a source file as a JSON array. Each
+// token is an object such as:
+//
+//	{"file": "a.c", "line": 1, "column": 5, "offset": 4, "type": "identifier",
+//	 "category": "identifier", "value": "main"}
+func WriteJSON(w io.Writer, filename string, tokens []Token) error {
+	list := make([]jsonToken, len(tokens))
+	for i, t := range tokens {
+		list[i] = jsonToken{
+			File:     fileOf(filename, t),
+			Line:     t.Line,
+			Column:   t.Column,
+			Offset:   t.Offset,
+			Type:     t.Type.String(),
+			Category: t.Type.Category().String(),
+			Value:    t.Value,
+		}
+	}
+	return json.NewEncoder(w).Encode(list)
+}
+
+// fileOf returns the name of the file of a token of a source file.
+func fileOf(filename string, t Token) string {
+	if t.Filename != "" {
+		return t.Filename
+	}
+	return filename
+}
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// printed are the tokens of "int main" and a string literal of a header.
+var printed = []Token{
+	{Type: IntKeywordToken, Value: "int", Offset: 0, Line: 1, Column: 1},
+	{Type: IdentifierToken, Value: "main", Offset: 4, Line: 1, Column: 5},
+	{Type: StringLiteralToken, Value: "a,b", Offset: 0, Line: 10, Column: 1, Filename: "a.h"},
+}
+
+func TestWriteText(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.NoError(WriteText(&b, printed))
+	assert.Equal(`1:1       int             "int"
+1:5       identifier      "main"
+a.h:10:1  string literal  "a,b"
+`, b.String())
+}
+
+func TestWriteCSV(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.NoError(WriteCSV(&b, "a.c", printed))
+	assert.Equal(`file,line,column,offset,type,category,value
+a.c,1,1,0,int,keyword,int
+a.c,1,5,4,identifier,identifier,main
+a.h,10,1,0,string literal,literal,"a,b"
+`, b.String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	assert := assert.New(t)
+	var b bytes.Buffer
+	assert.NoError(WriteJSON(&b, "a.c", printed[:2]))
+	assert.JSONEq(`[
+		{"file": "a.c", "line": 1, "column": 1, "offset": 0, "type": "int",
+		 "category": "keyword", "value": "int"},
+		{"file": "a.c", "line": 1, "column": 5, "offset": 4, "type": "identifier",
+		 "category": "identifier", "value": "main"}]`, b.String())
+	b.Reset()
+	assert.NoError(WriteJSON(&b, "a.c", nil))
+	assert.Equal("[]\n", b.String())
+}
@@ -9,6 +9,71 @@ type TokenType uint8
 type Token struct {
 	Type  TokenType
 	Value string
+	// The source location of the first rune of the token.
+	Offset int // Byte offset, starting at 0.
+	Line   int // Line number, starting at 1.
+	Column int // Column number in runes, starting at 1.
+	// The file of the token, if it was named by a line directive rather than
+	// being the file which was lexed.
+	Filename string
+	// The source text around the token, if the lexer preserves it.
+	Trivia *Trivia
+}
+
+// The trivia of a token: the source text which is not part of any token, such
+// as whitespace, comments and line directives, which belongs to the token
+// that it is next to, and the source text of the token itself. The sources of
+// the tokens of a file without lexical errors, up to and including the end of
+// file token, are the text of the file.
+type Trivia struct {
+	// The trivia after the trailing trivia of the token before.
+	Leading string
+	// The source text of the token, which its value differs from for a
+	// literal with escape sequences. An error token has none, and the input
+	// which it skips is trivia.
+	Text string
+	// The trivia after the token up to the end of its line, not including the
+	// newline.
+	Trailing string
+}
+
+// Source returns the source text of a token with its trivia, or its value if
+// its trivia was not preserved.
+func (t Token) Source() string {
+	if t.Trivia == nil {
+		return t.Value
+	}
+	return t.Trivia.Leading + t.Trivia.Text + t.Trivia.Trailing
+}
+
+// A location in the source text. The filename is empty for a location in the
+// file which is being compiled, unless it was set by a line directive.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid returns whether the position has been set. Lines are numbered from
+// 1, so the zero Position is invalid.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns a "file:line:column" representation of a position, or
+// "line:column" if it has no filename.
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 // A list of token types.
@@ -17,31 +82,148 @@ const (
 	EofToken
 	IdentifierToken
 	NumberToken
+	FloatLiteralToken  // A floating-point constant, such as 1.5 or 1e10f.
+	StringLiteralToken // A string literal. The value is the decoded string.
+	CharLiteralToken   // A character constant. The value is the decoded rune.
+	CommentToken       // A comment, only emitted if comments are preserved.
 	// Punctuation.
 	OpenBraceToken          // {
 	CloseBraceToken         // }
 	OpenParenthesisToken    // (
 	CloseParenthesisToken   // )
+	OpenBracketToken        // [
+	CloseBracketToken       // ]
 	SemicolonToken          // ;
+	CommaToken              // ,
+	ColonToken              // :
+	QuestionToken           // ?
+	DotToken                // .
+	ArrowToken              // ->
+	EllipsisToken           // ...
 	LogicalNegationToken    // !
 	BitwiseComplementToken  // ~
 	NegationToken           // -
 	AdditionToken           // +
 	MultiplicationToken     // *
 	DivisionToken           // /
+	ModuloToken             // %
 	AndToken                // &&
 	OrToken                 // ||
+	BitwiseAndToken         // &
+	BitwiseOrToken          // |
+	BitwiseXorToken         // ^
+	ShiftLeftToken          // <<
+	ShiftRightToken         // >>
 	EqualToken              // ==
 	NotEqualToken           // !=
 	LessThanToken           // <
 	LessThanOrEqualToken    // <=
 	GreaterThanToken        // >
 	GreaterThanOrEqualToken // >=
+	AssignmentToken         // =
+	IncrementToken          // ++
+	DecrementToken          // --
+	// Compound assignment operators.
+	AdditionAssignmentToken       // +=
+	SubtractionAssignmentToken    // -=
+	MultiplicationAssignmentToken // *=
+	DivisionAssignmentToken       // /=
+	ModuloAssignmentToken         // %=
+	ShiftLeftAssignmentToken      // <<=
+	ShiftRightAssignmentToken     // >>=
+	BitwiseAndAssignmentToken     // &=
+	BitwiseOrAssignmentToken      // |=
+	BitwiseXorAssignmentToken     // ^=
 	// Keywords.
-	IntKeywordToken    // int
-	ReturnKeywordToken // return
+	IntKeywordToken      // int
+	ReturnKeywordToken   // return
+	FloatKeywordToken    // float
+	DoubleKeywordToken   // double
+	IfKeywordToken       // if
+	ElseKeywordToken     // else
+	WhileKeywordToken    // while
+	DoKeywordToken       // do
+	ForKeywordToken      // for
+	BreakKeywordToken    // break
+	ContinueKeywordToken // continue
+	SwitchKeywordToken   // switch
+	CaseKeywordToken     // case
+	DefaultKeywordToken  // default
+	StructKeywordToken   // struct
+	CharKeywordToken     // char
+	SizeofKeywordToken   // sizeof
+	EnumKeywordToken     // enum
+	TypedefKeywordToken  // typedef
+	GotoKeywordToken     // goto
+	UnsignedKeywordToken // unsigned
+	SignedKeywordToken   // signed
+	ShortKeywordToken    // short
+	LongKeywordToken     // long
+	ExternKeywordToken   // extern
+	StaticKeywordToken   // static
 )
 
+// Keywords maps the reserved words to their token types. A keyword is added
+// by adding its token type, after the others, and an entry here.
+var Keywords = map[string]TokenType{
+	"break":    BreakKeywordToken,
+	"case":     CaseKeywordToken,
+	"char":     CharKeywordToken,
+	"continue": ContinueKeywordToken,
+	"default":  DefaultKeywordToken,
+	"do":       DoKeywordToken,
+	"double":   DoubleKeywordToken,
+	"else":     ElseKeywordToken,
+	"enum":     EnumKeywordToken,
+	"extern":   ExternKeywordToken,
+	"float":    FloatKeywordToken,
+	"for":      ForKeywordToken,
+	"goto":     GotoKeywordToken,
+	"if":       IfKeywordToken,
+	"int":      IntKeywordToken,
+	"long":     LongKeywordToken,
+	"return":   ReturnKeywordToken,
+	"short":    ShortKeywordToken,
+	"signed":   SignedKeywordToken,
+	"sizeof":   SizeofKeywordToken,
+	"static":   StaticKeywordToken,
+	"struct":   StructKeywordToken,
+	"switch":   SwitchKeywordToken,
+	"typedef":  TypedefKeywordToken,
+	"unsigned": UnsignedKeywordToken,
+	"while":    WhileKeywordToken,
+}
+
+// The length of the longest keyword.
+var maxKeywordLength = func() int {
+	n := 0
+	for k := range Keywords {
+		if len(k) > n {
+			n = len(k)
+		}
+	}
+	return n
+}()
+
+// Lookup returns the token type of an identifier, which is that of a keyword
+// if it is a reserved word. The keywords are lower case words of more than
+// one letter, so most other identifiers are told apart without a lookup.
+func Lookup(identifier string) TokenType {
+	if len(identifier) < 2 || len(identifier) > maxKeywordLength ||
+		identifier[0] < 'a' || identifier[0] > 'z' {
+		return IdentifierToken
+	}
+	if t, ok := Keywords[identifier]; ok {
+		return t
+	}
+	return IdentifierToken
+}
+
+// Position returns the source location of the token.
+func (t Token) Position() Position {
+	return Position{Filename: t.Filename, Offset: t.Offset, Line: t.Line, Column: t.Column}
+}
+
 // String returns a stringified representation of a token.
 func (t Token) String() string {
 	switch t.Type {
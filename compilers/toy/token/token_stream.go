@@ -1,11 +1,36 @@
 package token
 
+// A stream of tokens.
 type TokenStream interface {
+	// Next advances to the next token, returning false at the end of the
+	// stream.
 	Next() bool
+	// Value returns the current token.
 	Value() Token
+	// Peek returns the next token without consuming it.
 	Peek() Token
+	// PeekN returns the n-th next token without consuming any tokens, where
+	// n >= 1. PeekN(1) is equal to Peek(). Past the end of the stream, its
+	// final token is returned: an EofToken, or the ErrorToken at which the
+	// lexer stopped. A stream which ends without either returns an EofToken.
+	PeekN(n int) Token
+	// Checkpoint returns the position of the stream, to which Rewind returns
+	// it, so that a parser can read ahead speculatively and then backtrack.
+	// Checkpoints are rewound to or released in the reverse of the order in
+	// which they are taken.
+	Checkpoint() Checkpoint
+	// Rewind returns the stream to a checkpoint, so that the tokens after it
+	// are read again, and releases it and any checkpoints taken after it.
+	Rewind(c Checkpoint)
+	// Release discards a checkpoint which will not be rewound to, and any
+	// taken after it, so that the tokens before them need not be kept.
+	Release(c Checkpoint)
 }
 
+// A Checkpoint is a position in a TokenStream: the number of tokens which
+// had been consumed when it was taken.
+type Checkpoint int
+
 type SliceTokenStream struct {
 	tokens   []Token
 	position int
@@ -30,8 +55,31 @@ func (i *SliceTokenStream) Value() Token {
 }
 
 func (i *SliceTokenStream) Peek() Token {
-	if i.position > len(i.tokens)-1 {
+	return i.PeekN(1)
+}
+
+func (i *SliceTokenStream) PeekN(n int) Token {
+	if n < 1 {
+		panic("PeekN requires n >= 1")
+	}
+	// i.position is the index of the next token.
+	if i.position+n-1 > len(i.tokens)-1 {
+		if last := len(i.tokens) - 1; last >= 0 &&
+			(i.tokens[last].Type == EofToken || i.tokens[last].Type == ErrorToken) {
+			return i.tokens[last]
+		}
 		return Token{Type: EofToken, Value: "EOF"}
 	}
-	return i.tokens[i.position]
+	return i.tokens[i.position+n-1]
 }
+
+func (i *SliceTokenStream) Checkpoint() Checkpoint {
+	return Checkpoint(i.position)
+}
+
+func (i *SliceTokenStream) Rewind(c Checkpoint) {
+	i.position = int(c)
+}
+
+// Release does nothing, as every token of the slice is kept.
+func (i *SliceTokenStream) Release(c Checkpoint) {}
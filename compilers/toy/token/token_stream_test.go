@@ -9,35 +9,85 @@ func TestSliceTokenStream(t *testing.T) {
 	assert := assert.New(t)
 
 	tokens := []Token{
-		Token{IntKeywordToken, "int"},
-		Token{IdentifierToken, "main"},
-		Token{OpenParenthesisToken, "("},
-		Token{CloseParenthesisToken, ")"},
-		Token{OpenBraceToken, "{"},
-		Token{ReturnKeywordToken, "return"},
-		Token{NumberToken, "100"},
-		Token{SemicolonToken, ";"},
-		Token{CloseBraceToken, "}"},
+		Token{Type: IntKeywordToken, Value: "int"},
+		Token{Type: IdentifierToken, Value: "main"},
+		Token{Type: OpenParenthesisToken, Value: "("},
+		Token{Type: CloseParenthesisToken, Value: ")"},
+		Token{Type: OpenBraceToken, Value: "{"},
+		Token{Type: ReturnKeywordToken, Value: "return"},
+		Token{Type: NumberToken, Value: "100"},
+		Token{Type: SemicolonToken, Value: ";"},
+		Token{Type: CloseBraceToken, Value: "}"},
 	}
 
 	ts := NewSliceTokenStream(tokens)
 	assert.True(ts.Next())
-	assert.Equal(Token{IntKeywordToken, "int"}, ts.Value())
+	assert.Equal(Token{Type: IntKeywordToken, Value: "int"}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(Token{IdentifierToken, "main"}, ts.Value())
+	assert.Equal(Token{Type: IdentifierToken, Value: "main"}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(Token{OpenParenthesisToken, "("}, ts.Value())
+	assert.Equal(Token{Type: OpenParenthesisToken, Value: "("}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(Token{CloseParenthesisToken, ")"}, ts.Value())
+	assert.Equal(Token{Type: CloseParenthesisToken, Value: ")"}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(Token{OpenBraceToken, "{"}, ts.Value())
+	assert.Equal(Token{Type: OpenBraceToken, Value: "{"}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(Token{ReturnKeywordToken, "return"}, ts.Value())
+	assert.Equal(Token{Type: ReturnKeywordToken, Value: "return"}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(Token{NumberToken, "100"}, ts.Value())
+	assert.Equal(Token{Type: NumberToken, Value: "100"}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(Token{SemicolonToken, ";"}, ts.Value())
+	assert.Equal(Token{Type: SemicolonToken, Value: ";"}, ts.Value())
 	assert.True(ts.Next())
-	assert.Equal(Token{CloseBraceToken, "}"}, ts.Value())
+	assert.Equal(Token{Type: CloseBraceToken, Value: "}"}, ts.Value())
 	assert.False(ts.Next())
 }
+
+func TestSliceTokenStreamPeekN(t *testing.T) {
+	assert := assert.New(t)
+
+	tokens := []Token{
+		Token{Type: OpenParenthesisToken, Value: "("},
+		Token{Type: IntKeywordToken, Value: "int"},
+		Token{Type: CloseParenthesisToken, Value: ")"},
+	}
+
+	ts := NewSliceTokenStream(tokens)
+	assert.Equal(tokens[0], ts.Peek())
+	assert.Equal(tokens[0], ts.PeekN(1))
+	assert.Equal(tokens[1], ts.PeekN(2))
+	assert.Equal(tokens[2], ts.PeekN(3))
+	assert.Equal(EofToken, ts.PeekN(4).Type)
+	assert.True(ts.Next())
+	assert.Equal(tokens[1], ts.PeekN(1))
+	assert.Equal(tokens[2], ts.PeekN(2))
+	assert.Equal(EofToken, ts.PeekN(3).Type)
+	assert.Panics(func() { ts.PeekN(0) })
+
+	// Past the end, a stream which ends with an error token returns it.
+	tokens = []Token{
+		{Type: IdentifierToken, Value: "x"},
+		{Type: ErrorToken, Value: "unterminated comment"},
+	}
+	ts = NewSliceTokenStream(tokens)
+	assert.Equal(tokens[1], ts.PeekN(2))
+	assert.Equal(tokens[1], ts.PeekN(5))
+}
+
+func TestSliceTokenStreamRewind(t *testing.T) {
+	assert := assert.New(t)
+	ts := NewSliceTokenStream([]Token{
+		{Type: IdentifierToken, Value: "x"},
+		{Type: SemicolonToken, Value: ";"},
+	})
+	c := ts.Checkpoint()
+	assert.True(ts.Next())
+	assert.True(ts.Next())
+	assert.False(ts.Next())
+	ts.Rewind(c)
+	assert.Equal(IdentifierToken, ts.Peek().Type)
+	assert.True(ts.Next())
+	c = ts.Checkpoint()
+	assert.True(ts.Next())
+	ts.Release(c)
+	assert.Equal(SemicolonToken, ts.Value().Type)
+}
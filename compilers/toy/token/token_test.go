@@ -7,8 +7,48 @@ import (
 
 func TestTokenString(t *testing.T) {
 	assert := assert.New(t)
-	assert.Equal(`EOF`, Token{EofToken, ""}.String())
-	assert.Equal(`"abc"`, Token{IdentifierToken, "abc"}.String())
+	assert.Equal(`EOF`, Token{Type: EofToken, Value: ""}.String())
+	assert.Equal(`"abc"`, Token{Type: IdentifierToken, Value: "abc"}.String())
 	assert.Equal(`"0123456789"...`,
-		Token{IdentifierToken, "01234567890123456789"}.String())
+		Token{Type: IdentifierToken, Value: "01234567890123456789"}.String())
+}
+
+func TestTokenPosition(t *testing.T) {
+	assert := assert.New(t)
+	tok := Token{Type: IdentifierToken, Value: "abc", Offset: 10, Line: 2,
+		Column: 3}
+	assert.Equal(Position{Offset: 10, Line: 2, Column: 3}, tok.Position())
+	assert.Equal("2:3", tok.Position().String())
+	assert.True(tok.Position().IsValid())
+	assert.False(Position{}.IsValid())
+
+	tok.Filename = "a.h"
+	assert.Equal(Position{Filename: "a.h", Offset: 10, Line: 2, Column: 3}, tok.Position())
+	assert.Equal("a.h:2:3", tok.Position().String())
+	assert.Equal("a.h", Position{Filename: "a.h"}.String())
+	assert.Equal("-", Position{}.String())
+}
+
+func TestTokenSource(t *testing.T) {
+	assert := assert.New(t)
+	tok := Token{Type: StringLiteralToken, Value: "a\n"}
+	assert.Equal("a\n", tok.Source())
+	tok.Trivia = &Trivia{Leading: "\n  ", Text: `"a\n"`, Trailing: " // b"}
+	assert.Equal("\n  \"a\\n\" // b", tok.Source())
+}
+
+func TestLookup(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(WhileKeywordToken, Lookup("while"))
+	assert.Equal(TypedefKeywordToken, Lookup("typedef"))
+	assert.Equal(IdentifierToken, Lookup("whiles"))
+	assert.Equal(IdentifierToken, Lookup("While"))
+}
+
+func TestKeywords(t *testing.T) {
+	assert := assert.New(t)
+	for word, typ := range Keywords {
+		assert.Equal(word, typ.String())
+		assert.Equal(KeywordCategory, typ.Category())
+	}
 }
@@ -0,0 +1,187 @@
+package token
+
+import "fmt"
+
+// The Category of a type of token.
+type Category uint8
+
+const (
+	SpecialCategory     Category = iota // Errors, the end of file, and comments.
+	IdentifierCategory                  // Identifiers.
+	LiteralCategory                     // Numbers, strings and characters.
+	KeywordCategory                     // Reserved words.
+	OperatorCategory                    // Operators, such as "+" and "+=".
+	PunctuationCategory                 // Brackets and separators, such as "(" and ";".
+)
+
+func (c Category) String() string {
+	switch c {
+	case SpecialCategory:
+		return "special"
+	case IdentifierCategory:
+		return "identifier"
+	case LiteralCategory:
+		return "literal"
+	case KeywordCategory:
+		return "keyword"
+	case OperatorCategory:
+		return "operator"
+	case PunctuationCategory:
+		return "punctuation"
+	}
+	return fmt.Sprintf("Category(%d)", int(c))
+}
+
+// The Associativity of a binary operator, which decides how a sequence of
+// operators of the same precedence is grouped.
+type Associativity uint8
+
+const (
+	LeftAssociative  Associativity = iota // a - b - c is (a - b) - c.
+	RightAssociative                      // a = b = c is a = (b = c).
+)
+
+// The name and category of each type of token. The name of an operator,
+// punctuator or keyword is its text.
+var types = [...]struct {
+	name     string
+	category Category
+}{
+	ErrorToken:                    {"error", SpecialCategory},
+	EofToken:                      {"EOF", SpecialCategory},
+	IdentifierToken:               {"identifier", IdentifierCategory},
+	NumberToken:                   {"number", LiteralCategory},
+	FloatLiteralToken:             {"floating-point constant", LiteralCategory},
+	StringLiteralToken:            {"string literal", LiteralCategory},
+	CharLiteralToken:              {"character constant", LiteralCategory},
+	CommentToken:                  {"comment", SpecialCategory},
+	OpenBraceToken:                {"{", PunctuationCategory},
+	CloseBraceToken:               {"}", PunctuationCategory},
+	OpenParenthesisToken:          {"(", PunctuationCategory},
+	CloseParenthesisToken:         {")", PunctuationCategory},
+	OpenBracketToken:              {"[", PunctuationCategory},
+	CloseBracketToken:             {"]", PunctuationCategory},
+	SemicolonToken:                {";", PunctuationCategory},
+	CommaToken:                    {",", PunctuationCategory},
+	ColonToken:                    {":", PunctuationCategory},
+	QuestionToken:                 {"?", OperatorCategory},
+	DotToken:                      {".", OperatorCategory},
+	ArrowToken:                    {"->", OperatorCategory},
+	EllipsisToken:                 {"...", PunctuationCategory},
+	LogicalNegationToken:          {"!", OperatorCategory},
+	BitwiseComplementToken:        {"~", OperatorCategory},
+	NegationToken:                 {"-", OperatorCategory},
+	AdditionToken:                 {"+", OperatorCategory},
+	MultiplicationToken:           {"*", OperatorCategory},
+	DivisionToken:                 {"/", OperatorCategory},
+	ModuloToken:                   {"%", OperatorCategory},
+	AndToken:                      {"&&", OperatorCategory},
+	OrToken:                       {"||", OperatorCategory},
+	BitwiseAndToken:               {"&", OperatorCategory},
+	BitwiseOrToken:                {"|", OperatorCategory},
+	BitwiseXorToken:               {"^", OperatorCategory},
+	ShiftLeftToken:                {"<<", OperatorCategory},
+	ShiftRightToken:               {">>", OperatorCategory},
+	EqualToken:                    {"==", OperatorCategory},
+	NotEqualToken:                 {"!=", OperatorCategory},
+	LessThanToken:                 {"<", OperatorCategory},
+	LessThanOrEqualToken:          {"<=", OperatorCategory},
+	GreaterThanToken:              {">", OperatorCategory},
+	GreaterThanOrEqualToken:       {">=", OperatorCategory},
+	AssignmentToken:               {"=", OperatorCategory},
+	IncrementToken:                {"++", OperatorCategory},
+	DecrementToken:                {"--", OperatorCategory},
+	AdditionAssignmentToken:       {"+=", OperatorCategory},
+	SubtractionAssignmentToken:    {"-=", OperatorCategory},
+	MultiplicationAssignmentToken: {"*=", OperatorCategory},
+	DivisionAssignmentToken:       {"/=", OperatorCategory},
+	ModuloAssignmentToken:         {"%=", OperatorCategory},
+	ShiftLeftAssignmentToken:      {"<<=", OperatorCategory},
+	ShiftRightAssignmentToken:     {">>=", OperatorCategory},
+	BitwiseAndAssignmentToken:     {"&=", OperatorCategory},
+	BitwiseOrAssignmentToken:      {"|=", OperatorCategory},
+	BitwiseXorAssignmentToken:     {"^=", OperatorCategory},
+	IntKeywordToken:               {"int", KeywordCategory},
+	ReturnKeywordToken:            {"return", KeywordCategory},
+	FloatKeywordToken:             {"float", KeywordCategory},
+	DoubleKeywordToken:            {"double", KeywordCategory},
+	IfKeywordToken:                {"if", KeywordCategory},
+	ElseKeywordToken:              {"else", KeywordCategory},
+	WhileKeywordToken:             {"while", KeywordCategory},
+	DoKeywordToken:                {"do", KeywordCategory},
+	ForKeywordToken:               {"for", KeywordCategory},
+	BreakKeywordToken:             {"break", KeywordCategory},
+	ContinueKeywordToken:          {"continue", KeywordCategory},
+	SwitchKeywordToken:            {"switch", KeywordCategory},
+	CaseKeywordToken:              {"case", KeywordCategory},
+	DefaultKeywordToken:           {"default", KeywordCategory},
+	StructKeywordToken:            {"struct", KeywordCategory},
+	CharKeywordToken:              {"char", KeywordCategory},
+	SizeofKeywordToken:            {"sizeof", KeywordCategory},
+	EnumKeywordToken:              {"enum", KeywordCategory},
+	TypedefKeywordToken:           {"typedef", KeywordCategory},
+	GotoKeywordToken:              {"goto", KeywordCategory},
+	UnsignedKeywordToken:          {"unsigned", KeywordCategory},
+	SignedKeywordToken:            {"signed", KeywordCategory},
+	ShortKeywordToken:             {"short", KeywordCategory},
+	LongKeywordToken:              {"long", KeywordCategory},
+	ExternKeywordToken:            {"extern", KeywordCategory},
+	StaticKeywordToken:            {"static", KeywordCategory},
+}
+
+// String returns the name of a type of token, which is the text of an
+// operator, punctuator or keyword, and otherwise a description such as
+// "identifier".
+func (t TokenType) String() string {
+	if int(t) < len(types) {
+		return types[t].name
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
+// Category returns the category of a type of token.
+func (t TokenType) Category() Category {
+	if int(t) < len(types) {
+		return types[t].category
+	}
+	return SpecialCategory
+}
+
+// The binary operators, with their precedence, which is higher for those
+// which bind tighter, and associativity. The conditional and assignment
+// operators, which bind looser than any of these, are not included.
+var binaryOperators = map[TokenType]struct {
+	precedence    int
+	associativity Associativity
+}{
+	OrToken:                 {1, LeftAssociative},
+	AndToken:                {2, LeftAssociative},
+	BitwiseOrToken:          {3, LeftAssociative},
+	BitwiseXorToken:         {4, LeftAssociative},
+	BitwiseAndToken:         {5, LeftAssociative},
+	EqualToken:              {6, LeftAssociative},
+	NotEqualToken:           {6, LeftAssociative},
+	LessThanToken:           {7, LeftAssociative},
+	LessThanOrEqualToken:    {7, LeftAssociative},
+	GreaterThanToken:        {7, LeftAssociative},
+	GreaterThanOrEqualToken: {7, LeftAssociative},
+	ShiftLeftToken:          {8, LeftAssociative},
+	ShiftRightToken:         {8, LeftAssociative},
+	AdditionToken:           {9, LeftAssociative},
+	NegationToken:           {9, LeftAssociative},
+	MultiplicationToken:     {10, LeftAssociative},
+	DivisionToken:           {10, LeftAssociative},
+	ModuloToken:             {10, LeftAssociative},
+}
+
+// Precedence returns the precedence of a binary operator, which is at least
+// 1 and higher for operators which bind tighter, or 0 if the type is not
+// that of a binary operator.
+func (t TokenType) Precedence() int {
+	return binaryOperators[t].precedence
+}
+
+// Associativity returns the associativity of a binary operator.
+func (t TokenType) Associativity() Associativity {
+	return binaryOperators[t].associativity
+}
@@ -0,0 +1,42 @@
+package token
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTokenTypeString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("identifier", IdentifierToken.String())
+	assert.Equal("<<=", ShiftLeftAssignmentToken.String())
+	assert.Equal("typedef", TypedefKeywordToken.String())
+	assert.Equal("TokenType(200)", TokenType(200).String())
+	// Every type has a name.
+	for typ := ErrorToken; typ <= StaticKeywordToken; typ++ {
+		assert.NotEqual("", typ.String())
+	}
+}
+
+func TestTokenTypeCategory(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(SpecialCategory, EofToken.Category())
+	assert.Equal(IdentifierCategory, IdentifierToken.Category())
+	assert.Equal(LiteralCategory, StringLiteralToken.Category())
+	assert.Equal(KeywordCategory, WhileKeywordToken.Category())
+	assert.Equal(OperatorCategory, AdditionAssignmentToken.Category())
+	assert.Equal(PunctuationCategory, SemicolonToken.Category())
+	assert.Equal("punctuation", PunctuationCategory.String())
+}
+
+func TestTokenTypePrecedence(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(MultiplicationToken.Precedence() > AdditionToken.Precedence())
+	assert.Equal(AdditionToken.Precedence(), NegationToken.Precedence())
+	assert.True(AndToken.Precedence() > OrToken.Precedence())
+	assert.Equal(1, OrToken.Precedence())
+	assert.Equal(LeftAssociative, NegationToken.Associativity())
+	// Operators which are not binary have none.
+	assert.Equal(0, AssignmentToken.Precedence())
+	assert.Equal(0, LogicalNegationToken.Precedence())
+	assert.Equal(0, SemicolonToken.Precedence())
+}
@@ -0,0 +1,82 @@
+package types
+
+import "fmt"
+
+// A Layout gives the sizes and alignments of types on a target, in bytes.
+type Layout struct {
+	PointerSize int
+}
+
+// The layouts of 64-bit targets, whose pointers are 8 bytes, and of 32-bit
+// targets, such as wasm32, whose pointers are 4 bytes. The integer types
+// have the same size on both: a char is 1 byte, a short 2, an int 4 and a
+// long 8, so that the value of a constant expression does not depend on the
+// target.
+var (
+	LP64  = Layout{PointerSize: 8}
+	ILP32 = Layout{PointerSize: 4}
+)
+
+// Sizeof returns the size of a value of type t.
+func (l Layout) Sizeof(t Type) int {
+	switch t := t.(type) {
+	case *Basic:
+		switch t.Kind {
+		case FloatKind:
+			return 4
+		case DoubleKind:
+			return 8
+		}
+		return int(Width(t) / 8)
+	case *Pointer:
+		return l.PointerSize
+	case *Array:
+		return int(t.Len) * l.Sizeof(t.Elem)
+	case *Struct:
+		if t.Complete && len(t.Fields) > 0 {
+			// The size is padded so that the fields of each element of an
+			// array of the struct are aligned.
+			last := len(t.Fields) - 1
+			end := l.Offsetof(t, last) + l.Sizeof(t.Fields[last].Type)
+			return align(end, l.Alignof(t))
+		}
+	}
+	panic(fmt.Sprintf("type %v has no size", t))
+}
+
+// Alignof returns the alignment of a value of type t. Every scalar type is
+// aligned to its size, an array to the alignment of its elements, and a
+// struct to the greatest alignment of its fields.
+func (l Layout) Alignof(t Type) int {
+	switch t := t.(type) {
+	case *Array:
+		return l.Alignof(t.Elem)
+	case *Struct:
+		alignment := 1
+		for _, f := range t.Fields {
+			if a := l.Alignof(f.Type); a > alignment {
+				alignment = a
+			}
+		}
+		return alignment
+	}
+	return l.Sizeof(t)
+}
+
+// Offsetof returns the offset of the i'th field of a struct from its start.
+// Each field follows the previous one, padded to its alignment.
+func (l Layout) Offsetof(s *Struct, i int) int {
+	offset := 0
+	for j, f := range s.Fields[:i+1] {
+		offset = align(offset, l.Alignof(f.Type))
+		if j < i {
+			offset += l.Sizeof(f.Type)
+		}
+	}
+	return offset
+}
+
+// align rounds n up to a multiple of alignment.
+func align(n, alignment int) int {
+	return (n + alignment - 1) / alignment * alignment
+}
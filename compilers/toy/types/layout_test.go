@@ -0,0 +1,64 @@
+package types
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSizeof(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(4, LP64.Sizeof(Int))
+	assert.Equal(1, LP64.Sizeof(Char))
+	assert.Equal(4, LP64.Sizeof(Float))
+	assert.Equal(8, LP64.Sizeof(Double))
+	assert.Equal(8, LP64.Sizeof(NewPointer(Int)))
+	assert.Equal(4, ILP32.Sizeof(NewPointer(Double)))
+	assert.Equal(8, ILP32.Sizeof(Double))
+	assert.Equal(40, LP64.Sizeof(NewArray(Int, 10)))
+	assert.Equal(24, LP64.Sizeof(NewArray(NewArray(Int, 3), 2)))
+	assert.Equal(80, LP64.Sizeof(NewArray(NewPointer(Int), 10)))
+	assert.Equal(40, ILP32.Sizeof(NewArray(NewPointer(Int), 10)))
+	assert.Panics(func() { LP64.Sizeof(&Function{Result: Int}) })
+	assert.Panics(func() { LP64.Sizeof(&Struct{Tag: "s"}) })
+}
+
+// newStruct returns a complete struct with fields of the given types, named
+// "a", "b", and so on.
+func newStruct(fields ...Type) *Struct {
+	s := &Struct{Tag: "s", Complete: true}
+	for i, t := range fields {
+		s.Fields = append(s.Fields, &Field{Name: string(rune('a' + i)), Type: t})
+	}
+	return s
+}
+
+func TestStructLayout(t *testing.T) {
+	assert := assert.New(t)
+	s := newStruct(Int, Double, Int)
+	assert.Equal(0, LP64.Offsetof(s, 0))
+	assert.Equal(8, LP64.Offsetof(s, 1))
+	assert.Equal(16, LP64.Offsetof(s, 2))
+	// The size is padded to the alignment of the double.
+	assert.Equal(24, LP64.Sizeof(s))
+	assert.Equal(8, LP64.Alignof(s))
+	p := newStruct(Int, NewPointer(Int))
+	assert.Equal(8, LP64.Offsetof(p, 1))
+	assert.Equal(16, LP64.Sizeof(p))
+	assert.Equal(4, ILP32.Offsetof(p, 1))
+	assert.Equal(8, ILP32.Sizeof(p))
+	// A nested struct is aligned as its most aligned field.
+	n := newStruct(Int, s, NewArray(Int, 3))
+	assert.Equal(8, LP64.Offsetof(n, 1))
+	assert.Equal(32, LP64.Offsetof(n, 2))
+	assert.Equal(48, LP64.Sizeof(n))
+}
+
+func TestAlignof(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(4, LP64.Alignof(Int))
+	assert.Equal(8, LP64.Alignof(Double))
+	assert.Equal(8, LP64.Alignof(NewPointer(Int)))
+	assert.Equal(4, ILP32.Alignof(NewPointer(Int)))
+	assert.Equal(8, LP64.Alignof(NewArray(Double, 3)))
+	assert.Equal(4, LP64.Alignof(NewArray(NewArray(Int, 3), 2)))
+}
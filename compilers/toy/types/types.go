@@ -0,0 +1,277 @@
+// Package types defines the types of the toy language.
+package types
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// A type. Types are compared by identity: each basic type, pointer type, and
+// array type has a single instance, and each struct declaration declares a
+// distinct struct type.
+type Type interface {
+	String() string
+}
+
+// The kind of a basic type.
+type BasicKind int
+
+const (
+	IntKind BasicKind = iota
+	FloatKind
+	DoubleKind
+	CharKind
+	ShortKind
+	LongKind
+)
+
+// A built-in scalar type. An integer type is signed or unsigned, and an
+// unsigned type has the kind and size of the signed type of its width.
+type Basic struct {
+	Kind     BasicKind
+	Unsigned bool
+	name     string
+}
+
+func (b *Basic) String() string {
+	return b.name
+}
+
+// The basic types.
+var (
+	Int    = &Basic{Kind: IntKind, name: "int"}
+	Float  = &Basic{Kind: FloatKind, name: "float"}
+	Double = &Basic{Kind: DoubleKind, name: "double"}
+	Char   = &Basic{Kind: CharKind, name: "char"}
+	Short  = &Basic{Kind: ShortKind, name: "short"}
+	Long   = &Basic{Kind: LongKind, name: "long"}
+
+	UnsignedChar  = &Basic{Kind: CharKind, Unsigned: true, name: "unsigned char"}
+	UnsignedShort = &Basic{Kind: ShortKind, Unsigned: true, name: "unsigned short"}
+	UnsignedInt   = &Basic{Kind: IntKind, Unsigned: true, name: "unsigned int"}
+	UnsignedLong  = &Basic{Kind: LongKind, Unsigned: true, name: "unsigned long"}
+)
+
+// A pointer type.
+type Pointer struct {
+	Elem Type // The type of the value pointed to.
+}
+
+func (p *Pointer) String() string {
+	// Stars are written together, as in "int **".
+	if _, ok := p.Elem.(*Pointer); ok {
+		return p.Elem.String() + "*"
+	}
+	// The star binds before the length of an array, as in "int (*)[3]".
+	if a, ok := p.Elem.(*Array); ok {
+		elem, lengths := a.split()
+		return elem.String() + " (*)" + lengths
+	}
+	return p.Elem.String() + " *"
+}
+
+// The instance of each pointer type, by the type pointed to.
+var (
+	pointersMu sync.Mutex
+	pointers   = make(map[Type]*Pointer)
+)
+
+// NewPointer returns the type of pointers to elem.
+func NewPointer(elem Type) *Pointer {
+	pointersMu.Lock()
+	defer pointersMu.Unlock()
+	p, ok := pointers[elem]
+	if !ok {
+		p = &Pointer{Elem: elem}
+		pointers[elem] = p
+	}
+	return p
+}
+
+// An array type, of a fixed number of elements.
+type Array struct {
+	Elem Type // The type of each element.
+	Len  int64
+}
+
+func (a *Array) String() string {
+	elem, lengths := a.split()
+	// As with pointers, there is no space after a star, as in "int *[4]".
+	if _, ok := elem.(*Pointer); ok {
+		return elem.String() + lengths
+	}
+	return elem.String() + " " + lengths
+}
+
+// split returns the innermost element type of an array of arrays, and its
+// lengths from outermost to innermost, as in "[2][3]".
+func (a *Array) split() (Type, string) {
+	var lengths strings.Builder
+	var t Type = a
+	for {
+		inner, ok := t.(*Array)
+		if !ok {
+			return t, lengths.String()
+		}
+		fmt.Fprintf(&lengths, "[%d]", inner.Len)
+		t = inner.Elem
+	}
+}
+
+type arrayKey struct {
+	elem Type
+	len  int64
+}
+
+// The instance of each array type, by its element type and length.
+var (
+	arraysMu sync.Mutex
+	arrays   = make(map[arrayKey]*Array)
+)
+
+// NewArray returns the type of arrays of n elements of type elem.
+func NewArray(elem Type, n int64) *Array {
+	arraysMu.Lock()
+	defer arraysMu.Unlock()
+	key := arrayKey{elem, n}
+	a, ok := arrays[key]
+	if !ok {
+		a = &Array{Elem: elem, Len: n}
+		arrays[key] = a
+	}
+	return a
+}
+
+// A struct type, whose fields are laid out in memory in the order declared.
+// A struct is incomplete until its fields are known, so that it may contain
+// pointers to itself.
+type Struct struct {
+	Tag      string // The name of the struct.
+	Fields   []*Field
+	Complete bool // Whether the fields are known.
+}
+
+// A field of a struct.
+type Field struct {
+	Name string
+	Type Type
+}
+
+func (s *Struct) String() string {
+	return "struct " + s.Tag
+}
+
+// Field returns the index of the field with the given name, and the field, or
+// -1 and nil if the struct has no such field.
+func (s *Struct) Field(name string) (int, *Field) {
+	for i, f := range s.Fields {
+		if f.Name == name {
+			return i, f
+		}
+	}
+	return -1, nil
+}
+
+// A function type. A variadic function may be called with more arguments
+// than it has parameters, as in "int printf(char *format, ...)".
+type Function struct {
+	Params   []Type
+	Result   Type
+	Variadic bool
+}
+
+func (f *Function) String() string {
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = p.String()
+	}
+	if f.Variadic {
+		params = append(params, "...")
+	}
+	return fmt.Sprintf("%v(%s)", f.Result, strings.Join(params, ", "))
+}
+
+// Identical returns whether two types are the same. Basic, pointer, array,
+// and struct types are identical only to themselves, and function types are
+// identical if their parameter and result types are, and both or neither are
+// variadic.
+func Identical(x, y Type) bool {
+	fx, ok := x.(*Function)
+	if !ok {
+		return x == y
+	}
+	fy, ok := y.(*Function)
+	if !ok || len(fx.Params) != len(fy.Params) || fx.Variadic != fy.Variadic ||
+		!Identical(fx.Result, fy.Result) {
+		return false
+	}
+	for i := range fx.Params {
+		if !Identical(fx.Params[i], fy.Params[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsInteger returns whether t is an integer type.
+func IsInteger(t Type) bool {
+	b, ok := t.(*Basic)
+	return ok && !IsFloating(b)
+}
+
+// IsUnsigned returns whether t is an unsigned integer type, whose values are
+// never negative and wrap around modulo 2 to the power of its width.
+func IsUnsigned(t Type) bool {
+	b, ok := t.(*Basic)
+	return ok && b.Unsigned
+}
+
+// Width returns the width of an integer type in bits, which is the same on
+// every target: 8 for char, 16 for short, 32 for int and 64 for long.
+func Width(t Type) uint {
+	switch t.(*Basic).Kind {
+	case CharKind:
+		return 8
+	case ShortKind:
+		return 16
+	case LongKind:
+		return 64
+	}
+	return 32
+}
+
+// IsFloating returns whether t is a floating-point type.
+func IsFloating(t Type) bool {
+	b, ok := t.(*Basic)
+	return ok && (b.Kind == FloatKind || b.Kind == DoubleKind)
+}
+
+// IsArithmetic returns whether t is an integer or floating-point type.
+func IsArithmetic(t Type) bool {
+	return IsInteger(t) || IsFloating(t)
+}
+
+// IsPointer returns whether t is a pointer type.
+func IsPointer(t Type) bool {
+	_, ok := t.(*Pointer)
+	return ok
+}
+
+// IsScalar returns whether t is an arithmetic or pointer type, whose values
+// may be compared against zero.
+func IsScalar(t Type) bool {
+	return IsArithmetic(t) || IsPointer(t)
+}
+
+// IsArray returns whether t is an array type.
+func IsArray(t Type) bool {
+	_, ok := t.(*Array)
+	return ok
+}
+
+// IsStruct returns whether t is a struct type.
+func IsStruct(t Type) bool {
+	_, ok := t.(*Struct)
+	return ok
+}
@@ -0,0 +1,137 @@
+package types
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("int", Int.String())
+	assert.Equal("float", Float.String())
+	assert.Equal("double", Double.String())
+	assert.Equal("unsigned int", UnsignedInt.String())
+	assert.Equal("double()", (&Function{Result: Double}).String())
+	assert.Equal("int(int, double)",
+		(&Function{Params: []Type{Int, Double}, Result: Int}).String())
+	assert.Equal("int(char *, ...)", (&Function{Params: []Type{NewPointer(Char)},
+		Result: Int, Variadic: true}).String())
+	assert.Equal("int *", NewPointer(Int).String())
+	assert.Equal("double **", NewPointer(NewPointer(Double)).String())
+	assert.Equal("int [10]", NewArray(Int, 10).String())
+	assert.Equal("int [2][3]", NewArray(NewArray(Int, 3), 2).String())
+	assert.Equal("int *[4]", NewArray(NewPointer(Int), 4).String())
+	assert.Equal("int (*)[3]", NewPointer(NewArray(Int, 3)).String())
+	s := &Struct{Tag: "point"}
+	assert.Equal("struct point", s.String())
+	assert.Equal("struct point *", NewPointer(s).String())
+	assert.Equal("struct point [2]", NewArray(s, 2).String())
+}
+
+func TestNewPointer(t *testing.T) {
+	assert := assert.New(t)
+	p := NewPointer(Int)
+	assert.Equal(Int, p.Elem)
+	assert.True(p == NewPointer(Int))
+	assert.True(NewPointer(p) == NewPointer(NewPointer(Int)))
+	assert.False(Type(p) == Type(NewPointer(Float)))
+}
+
+func TestNewArray(t *testing.T) {
+	assert := assert.New(t)
+	a := NewArray(Int, 3)
+	assert.Equal(Int, a.Elem)
+	assert.Equal(int64(3), a.Len)
+	assert.True(a == NewArray(Int, 3))
+	assert.False(Type(a) == Type(NewArray(Int, 4)))
+	assert.False(Type(a) == Type(NewArray(Float, 3)))
+}
+
+func TestStructField(t *testing.T) {
+	assert := assert.New(t)
+	x, y := &Field{Name: "x", Type: Int}, &Field{Name: "y", Type: Double}
+	s := &Struct{Tag: "point", Fields: []*Field{x, y}, Complete: true}
+	i, f := s.Field("y")
+	assert.Equal(1, i)
+	assert.True(f == y)
+	i, f = s.Field("z")
+	assert.Equal(-1, i)
+	assert.Nil(f)
+}
+
+func TestIdentical(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(Identical(Int, Int))
+	assert.False(Identical(Int, Double))
+	f := &Function{Params: []Type{Int, Double}, Result: Int}
+	assert.True(Identical(f, &Function{Params: []Type{Int, Double}, Result: Int}))
+	assert.False(Identical(f, &Function{Params: []Type{Int}, Result: Int}))
+	assert.False(Identical(f, &Function{Params: []Type{Int, Float}, Result: Int}))
+	assert.False(Identical(f, &Function{Params: []Type{Int, Double}, Result: Float}))
+	assert.False(Identical(f, &Function{Params: []Type{Int, Double}, Result: Int,
+		Variadic: true}))
+	assert.False(Identical(f, Int))
+	assert.False(Identical(Int, f))
+	assert.True(Identical(NewPointer(Int), NewPointer(Int)))
+	assert.False(Identical(NewPointer(Int), NewPointer(Float)))
+	assert.False(Identical(NewPointer(Int), Int))
+}
+
+func TestPredicates(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsInteger(Int))
+	assert.False(IsInteger(Double))
+	assert.True(IsInteger(Char))
+	assert.True(IsFloating(Float))
+	assert.True(IsFloating(Double))
+	assert.False(IsFloating(Int))
+	assert.True(IsArithmetic(Int))
+	assert.True(IsArithmetic(Double))
+	f := &Function{Result: Int}
+	assert.False(IsInteger(f))
+	assert.False(IsArithmetic(f))
+	p := NewPointer(Int)
+	assert.True(IsPointer(p))
+	assert.False(IsPointer(Int))
+	assert.False(IsArithmetic(p))
+	assert.True(IsScalar(p))
+	assert.True(IsScalar(Float))
+	assert.False(IsScalar(f))
+	a := NewArray(Int, 2)
+	assert.True(IsArray(a))
+	assert.False(IsArray(p))
+	s := &Struct{Tag: "s"}
+	assert.True(IsStruct(s))
+	assert.False(IsStruct(p))
+	assert.False(IsScalar(s))
+	assert.False(IsScalar(a))
+}
+
+func TestIntegerTypes(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsInteger(UnsignedInt))
+	assert.True(IsUnsigned(UnsignedInt))
+	assert.False(IsUnsigned(Int))
+	assert.False(IsUnsigned(Char))
+	assert.False(IsUnsigned(NewPointer(Int)))
+	assert.Equal(4, LP64.Sizeof(UnsignedInt))
+}
+
+func TestIntegerWidths(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		typ   Type
+		width uint
+	}{{Char, 8}, {UnsignedChar, 8}, {Short, 16}, {UnsignedShort, 16}, {Int, 32},
+		{UnsignedInt, 32}, {Long, 64}, {UnsignedLong, 64}} {
+		assert.True(IsInteger(test.typ), "%v", test.typ)
+		assert.Equal(test.width, Width(test.typ), "%v", test.typ)
+		// The sizes of integers are the same on every target.
+		assert.Equal(int(test.width/8), LP64.Sizeof(test.typ), "%v", test.typ)
+		assert.Equal(int(test.width/8), ILP32.Sizeof(test.typ), "%v", test.typ)
+	}
+	assert.True(IsUnsigned(UnsignedShort))
+	assert.False(IsUnsigned(Long))
+	assert.Equal("unsigned long", UnsignedLong.String())
+	assert.Equal(8, LP64.Alignof(NewArray(Long, 3)))
+}
@@ -0,0 +1,96 @@
+// Package xref finds the cross references of a checked program: the names in
+// its source text which refer to symbols, and those which declare them.
+package xref
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/token"
+	"sort"
+)
+
+// A name in the source text which refers to a symbol, or declares it.
+type Name struct {
+	Token  token.Token
+	Symbol *ast.Symbol
+}
+
+// IsDeclaration returns whether a name is that of the declaration of its
+// symbol.
+func (n Name) IsDeclaration() bool {
+	d := Declaration(n.Symbol)
+	return d.Value != "" && d.Position() == n.Token.Position()
+}
+
+// Names returns the names of a program whose symbols semantic analysis has
+// recorded in a table, by sema.RecordSymbols: its resolved identifiers and
+// the names of its declarations, in source order. A program with semantic
+// errors has the names which were resolved before them.
+func Names(program *ast.Program, symbols ast.SymbolTable) []Name {
+	var names []Name
+	ast.Inspect(program, func(node ast.Node) bool {
+		var t token.Token
+		switch n := node.(type) {
+		case *ast.Identifier:
+			t = n.Token
+		case *ast.VariableDeclaration:
+			t = n.Name
+		case *ast.Parameter:
+			t = n.Name
+		case *ast.Function:
+			t = n.Name
+		case *ast.Enumerator:
+			t = n.Name
+		case *ast.EnumDeclaration:
+			t = n.Name
+		case *ast.StructDeclaration:
+			t = n.Name
+		case *ast.TypedefDeclaration:
+			t = n.Name
+		default:
+			return true
+		}
+		if s := symbols.Of(node); s != nil && t.Value != "" {
+			names = append(names, Name{t, s})
+		}
+		return true
+	})
+	sort.SliceStable(names, func(i, j int) bool {
+		return names[i].Token.Offset < names[j].Token.Offset
+	})
+	return names
+}
+
+// Declaration returns the name of the declaration of a symbol, or the zero
+// Token if it is not known.
+func Declaration(s *ast.Symbol) token.Token {
+	switch d := s.Decl.(type) {
+	case *ast.VariableDeclaration:
+		return d.Name
+	case *ast.Parameter:
+		return d.Name
+	case *ast.Function:
+		return d.Name
+	case *ast.Enumerator:
+		return d.Name
+	case *ast.EnumDeclaration:
+		return d.Name
+	case *ast.StructDeclaration:
+		return d.Name
+	case *ast.TypedefDeclaration:
+		return d.Name
+	}
+	return token.Token{}
+}
+
+// Describe returns a short description of a symbol: its kind, name and type,
+// or the value of an enumerator, such as "variable x: int *".
+func Describe(s *ast.Symbol) string {
+	switch s.Kind {
+	case ast.StructSymbol, ast.EnumSymbol:
+		return s.Name
+	case ast.EnumeratorSymbol:
+		return fmt.Sprintf("%v %s = %d", s.Kind, s.Name, s.Value)
+	}
+	return fmt.Sprintf("%v %s: %v", s.Kind, s.Name, s.Type)
+}
@@ -0,0 +1,119 @@
+package xref
+
+import (
+	"fmt"
+	"github.com/ChrisCummins/phd/compilers/toy/ast"
+	"github.com/ChrisCummins/phd/compilers/toy/lexer"
+	"github.com/ChrisCummins/phd/compilers/toy/parser"
+	"github.com/ChrisCummins/phd/compilers/toy/sema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// check parses and checks a program, which may have semantic errors, and
+// returns its names.
+func check(t *testing.T, input string) []Name {
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols := make(ast.SymbolTable)
+	sema.Check(program, sema.RecordSymbols(symbols))
+	return Names(program, symbols)
+}
+
+// describeNames returns a "line:column name (declaration)" description of
+// each name.
+func describeNames(names []Name) []string {
+	var result []string
+	for _, n := range names {
+		s := fmt.Sprintf("%v %s", n.Token.Position(), n.Token.Value)
+		if n.IsDeclaration() {
+			s += " (declaration)"
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func TestNames(t *testing.T) {
+	assert := assert.New(t)
+	names := check(t, `struct point { int x; };
+enum color { RED };
+typedef int number;
+number f(number n);
+number f(number n) {
+  struct point p;
+  p.x = RED;
+  return f(n - p.x);
+}
+`)
+	assert.Equal([]string{
+		"1:8 point (declaration)",
+		"2:6 color (declaration)",
+		"2:14 RED (declaration)",
+		"3:13 number (declaration)",
+		// The parameters of a prototype declare no symbols.
+		"4:8 f",
+		"5:8 f (declaration)",
+		"5:17 n (declaration)",
+		"6:16 p (declaration)",
+		"7:3 p",
+		"7:9 RED",
+		"8:10 f",
+		"8:12 n",
+		"8:16 p",
+	}, describeNames(names))
+}
+
+func TestNamesOfTable(t *testing.T) {
+	assert := assert.New(t)
+	program, err := parser.Parse(lexer.NewLexerTokenStream(lexer.Lex("int x;")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(sema.Check(program))
+	// The symbols are those of the table, not of the nodes.
+	assert.Empty(Names(program, ast.SymbolTable{}))
+}
+
+func TestNamesWithErrors(t *testing.T) {
+	assert := assert.New(t)
+	names := check(t, "int main() {\n  int a = b;\n  return a;\n}\n")
+	assert.Equal([]string{
+		"1:5 main (declaration)",
+		"2:7 a (declaration)",
+		"3:10 a",
+	}, describeNames(names))
+}
+
+func TestDescribe(t *testing.T) {
+	assert := assert.New(t)
+	names := check(t, `struct s { int x; };
+enum e { A, B = 7 };
+typedef char *string;
+double g[3];
+int f(struct s *p, ...) { return B; }
+`)
+	var descriptions []string
+	for _, n := range names {
+		if n.IsDeclaration() {
+			descriptions = append(descriptions, Describe(n.Symbol))
+		}
+	}
+	assert.Equal([]string{
+		"struct s",
+		"enum e",
+		"enumerator A = 0",
+		"enumerator B = 7",
+		"typedef string: char *",
+		"variable g: double [3]",
+		"function f: int(struct s *, ...)",
+		"variable p: struct s *",
+	}, descriptions)
+}
+
+func TestDeclaration(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", Declaration(&ast.Symbol{Kind: ast.VariableSymbol}).Value)
+}